@@ -1,88 +1,252 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
-	"github.com/gofiber/fiber/v3/middleware/logger"
 	"github.com/gofiber/fiber/v3/middleware/recover"
 	"github.com/joho/godotenv"
 
+	"agent-workspace/backend/internal/agent"
+	"agent-workspace/backend/internal/artifacts"
+	"agent-workspace/backend/internal/auth"
 	"agent-workspace/backend/internal/browser"
+	"agent-workspace/backend/internal/config"
+	"agent-workspace/backend/internal/files"
+	"agent-workspace/backend/internal/health"
+	"agent-workspace/backend/internal/httpapi"
 	"agent-workspace/backend/internal/mcp"
 	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/internal/ratelimit"
 	"agent-workspace/backend/internal/terminal"
+	"agent-workspace/backend/internal/usage"
 	"agent-workspace/backend/internal/watchdog"
+	"agent-workspace/backend/internal/webhooks"
 	"agent-workspace/backend/internal/websocket"
+	"agent-workspace/backend/internal/webui"
+	"agent-workspace/backend/pkg/apierror"
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/metrics"
+	"agent-workspace/backend/pkg/models"
 	"agent-workspace/backend/pkg/ollama"
+	"agent-workspace/backend/pkg/tracing"
 )
 
-type FileNode struct {
-	Name     string     `json:"name"`
-	Type     string     `json:"type"` // "file" or "directory"
-	Path     string     `json:"path"`
-	Children []FileNode `json:"children,omitempty"`
+// watchdogErrorStatus maps watchdog errors to HTTP status codes
+func watchdogErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, watchdog.ErrInvalidAlertQuery), errors.Is(err, watchdog.ErrInvalidProposal), errors.Is(err, watchdog.ErrInvalidAnalyticsQuery),
+		errors.Is(err, watchdog.ErrInvalidScan), errors.Is(err, watchdog.ErrInvalidCommit), errors.Is(err, watchdog.ErrInvalidTaskMetrics),
+		errors.Is(err, watchdog.ErrInvalidAlertAction):
+		return 400
+	case errors.Is(err, watchdog.ErrAlertNotFound), errors.Is(err, watchdog.ErrProposalNotFound), errors.Is(err, watchdog.ErrCommentNotFound):
+		return 404
+	case errors.Is(err, watchdog.ErrProposalConflict), errors.Is(err, watchdog.ErrAlertConflict):
+		return 409
+	case errors.Is(err, watchdog.ErrCommitsDisabled), errors.Is(err, watchdog.ErrRegressionsDisabled):
+		return 503
+	default:
+		return 500
+	}
 }
 
-func buildFileTree(rootPath string) (*FileNode, error) {
-	info, err := os.Stat(rootPath)
-	if err != nil {
-		return nil, err
+// authErrorStatus maps authentication errors to HTTP status codes
+func authErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrInvalidKeyRequest):
+		return 400
+	case errors.Is(err, auth.ErrUnauthorized):
+		return 401
+	case errors.Is(err, auth.ErrForbidden):
+		return 403
+	case errors.Is(err, auth.ErrKeyNotFound):
+		return 404
+	default:
+		return 500
 	}
+}
+
+// authRules sets the scope each route needs; the first match applies and
+// unmatched routes need admin
+var authRules = []auth.Rule{
+	{Prefix: "/health"},
+	{Prefix: "/livez"},
+	{Prefix: "/readyz"},
+	{Prefix: "/.well-known/agent.json"}, // A2A discovery
+	{Prefix: "/api/auth/keys", Scope: auth.ScopeAdmin},
+	{Prefix: "/api/auth", Scope: auth.ScopeRead},
+	{Prefix: "/ws/watchdog", Scope: auth.ScopeRead},
+	{Prefix: "/ws/", Scope: auth.ScopeBrowse}, // A2A checks each method's scope too
+	{Prefix: "/api/logs", Scope: auth.ScopeAdmin},
+	{Prefix: "/api/webhooks", Scope: auth.ScopeAdmin},     // URLs and secrets
+	{Prefix: "/api/chat/stream", Scope: auth.ScopeBrowse}, // the /ws/chat fallback
+	{Prefix: "/api/openapi.json"},
+	{Method: fiber.MethodGet, Scope: auth.ScopeRead},
+	{Prefix: "/api/chat/", Scope: auth.ScopeBrowse},
+	{Prefix: "/api/files", Scope: auth.ScopeExecute},
+	{Prefix: "/api/agent/", Scope: auth.ScopeExecute},
+	{Prefix: "/api/tasks", Scope: auth.ScopeExecute},
+	{Prefix: "/api/artifacts", Scope: auth.ScopeExecute},
+	{Prefix: "/api/memory/delete", Scope: auth.ScopeAdmin},
+	{Prefix: "/api/memory/", Scope: auth.ScopeExecute},
+	{Prefix: "/api/evolve/", Scope: auth.ScopeExecute},
+	{Prefix: "/api/watchdog/task-metrics", Scope: auth.ScopeExecute},
+	{Prefix: "/api/watchdog/scan", Scope: auth.ScopeExecute},
+	{Prefix: "/api/watchdog/commits/check", Scope: auth.ScopeExecute},
+}
 
-	node := &FileNode{
-		Name: info.Name(),
-		Path: rootPath,
+// callerName returns the authenticated principal's name, or name, or when
+// it's empty the X-Caller header, or the client's address
+func callerName(c fiber.Ctx, name string) string {
+	if principal := auth.FromContext(c); principal != nil && principal.Via != auth.ViaDisabled {
+		return principal.Name
+	}
+	if name == "" {
+		name = c.Get("X-Caller")
 	}
+	if name == "" {
+		name = "api:" + c.IP()
+	}
+	return name
+}
 
-	if info.IsDir() {
-		node.Type = "directory"
+// memoryErrorStatus maps memory system errors to HTTP status codes
+func memoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, memory.ErrInvalidMemoryRequest):
+		return 400
+	case errors.Is(err, memory.ErrTaskNotFound), errors.Is(err, memory.ErrBlobNotFound), errors.Is(err, memory.ErrDocumentNotFound),
+		errors.Is(err, memory.ErrConversationNotFound):
+		return 404
+	case errors.Is(err, memory.ErrTaskExists):
+		return 409
+	case errors.Is(err, memory.ErrMemoryUnavailable):
+		return 503
+	default:
+		return 500
+	}
+}
 
-		entries, err := os.ReadDir(rootPath)
-		if err != nil {
-			return nil, err
-		}
+// agentErrorStatus maps agent controller errors to HTTP status codes
+func agentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, agent.ErrInvalidCommand):
+		return 400
+	case errors.Is(err, memory.ErrTaskNotFound):
+		return 404
+	case errors.Is(err, agent.ErrAgentBusy), errors.Is(err, agent.ErrInvalidState):
+		return 409
+	default:
+		return 500
+	}
+}
 
-		node.Children = make([]FileNode, 0)
-		for _, entry := range entries {
-			// Skip hidden files and common ignore patterns
-			if entry.Name()[0] == '.' || entry.Name() == "node_modules" || entry.Name() == "vendor" {
-				continue
-			}
+// fileErrorStatus maps file errors to HTTP status codes
+func fileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, files.ErrInvalidPath), errors.Is(err, files.ErrIsDirectory), errors.Is(err, files.ErrInvalidDiff),
+		errors.Is(err, files.ErrInvalidSearch), errors.Is(err, files.ErrInvalidWorkspace):
+		return 400
+	case errors.Is(err, files.ErrOutsideWorkspace):
+		return 403
+	case errors.Is(err, files.ErrNotFound), errors.Is(err, files.ErrWorkspaceNotFound):
+		return 404
+	case errors.Is(err, files.ErrExists), errors.Is(err, files.ErrNotEmpty), errors.Is(err, files.ErrConflict),
+		errors.Is(err, files.ErrWorkspaceExists):
+		return 409
+	case errors.Is(err, files.ErrTooLarge):
+		return 413
+	case errors.Is(err, files.ErrBinary):
+		return 415
+	case errors.Is(err, errFilesDisabled):
+		return 503
+	default:
+		return 500
+	}
+}
 
-			childPath := rootPath + "/" + entry.Name()
-			childNode, err := buildFileTree(childPath)
-			if err != nil {
-				continue // Skip files we can't read
-			}
-			node.Children = append(node.Children, *childNode)
-		}
-	} else {
-		node.Type = "file"
+// artifactErrorStatus maps artifact store errors to HTTP status codes
+func artifactErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, artifacts.ErrInvalidArtifact):
+		return 400
+	case errors.Is(err, artifacts.ErrArtifactNotFound):
+		return 404
+	case errors.Is(err, artifacts.ErrArtifactTooLarge):
+		return 413
+	default:
+		return 500
+	}
+}
+
+// webhookErrorStatus maps webhook errors to HTTP status codes
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidWebhook):
+		return 400
+	case errors.Is(err, webhooks.ErrWebhookNotFound):
+		return 404
+	default:
+		return 500
 	}
+}
+
+// modelErrorStatus maps Ollama model errors to HTTP status codes; other
+// errors mean Ollama couldn't be reached or failed
+func modelErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ollama.ErrModelUnsuited):
+		return 400
+	case errors.Is(err, ollama.ErrModelNotFound):
+		return 404
+	case errors.Is(err, ollama.ErrPullRunning):
+		return 409
+	default:
+		return 502
+	}
+}
 
-	return node, nil
+// workspaceLocal holds the name of the workspace an API request works in
+const workspaceLocal = "workspace"
+
+// errFilesDisabled is returned by file routes when the workspace root couldn't be opened
+var errFilesDisabled = errors.New("file routes are disabled")
+
+// requestWorkspace returns the workspace named by the X-Workspace header or
+// ?workspace=, or ""
+func requestWorkspace(c fiber.Ctx) string {
+	workspace := c.Get("X-Workspace")
+	if workspace == "" {
+		workspace = c.Query("workspace")
+	}
+	return workspace
 }
 
-func validateEnv() error {
-	required := []string{
-		"NEO4J_URI",
-		"NEO4J_USER",
-		"NEO4J_PASSWORD",
+// memoryContext tags a request's context with its caller for the memory audit
+// log (the X-Caller header if set, otherwise the client address), its request
+// ID and its workspace, if any
+func memoryContext(c fiber.Ctx) context.Context {
+	caller := c.Get("X-Caller")
+	if caller == "" {
+		caller = "api:" + c.IP()
 	}
+	ctx := memory.WithCaller(logging.RequestContext(c), caller)
 
-	for _, key := range required {
-		if os.Getenv(key) == "" {
-			return fmt.Errorf("required environment variable %s not set", key)
-		}
+	if workspace, _ := c.Locals(workspaceLocal).(string); workspace != "" {
+		ctx = memory.WithWorkspace(ctx, workspace)
 	}
-	return nil
+	return ctx
 }
 
 func main() {
@@ -96,224 +260,1974 @@ func main() {
 	envLoaded := false
 	for _, path := range envPaths {
 		if err := godotenv.Load(path); err == nil {
-			log.Printf("Loaded environment from %s", path)
+			slog.Info("loaded environment", "path", path)
 			envLoaded = true
 			break
 		}
 	}
 
 	if !envLoaded {
-		log.Printf("Warning: No .env file found, using system environment")
+		slog.Warn("no .env file found, using the system environment")
 	}
 
-	// Validate environment
-	log.Println("→ Validating environment...")
-	if err := validateEnv(); err != nil {
-		log.Fatal(err)
+	// Load and validate the configuration: YAML file, environment and flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+
+	// Structured logging, to stderr and the /api/logs tail
+	logTail := logging.Setup(cfg.Logging)
+	if cfg.File != "" {
+		slog.Info("configuration loaded", "file", cfg.File)
+	} else {
+		slog.Info("configuration loaded")
+	}
+
+	// Agent tasks are traced when an OTLP endpoint is set
+	tracer := tracing.NewTracer(cfg.Tracing)
+	tracing.SetDefault(tracer)
+	if tracer.Enabled() {
+		slog.Info("tracing enabled", "endpoint", cfg.Tracing.Endpoint, "sampling", cfg.Tracing.SampleRatio)
 	}
-	log.Println("✓ Environment validated")
 
 	// Initialize Fiber app
-	log.Println("→ Initializing Fiber app...")
 	app := fiber.New(fiber.Config{
 		AppName: "Agentic Command Center v1.0",
+		// Room for imported task traces, which carry their screenshots, and
+		// uploaded artifacts
+		BodyLimit: int(max(memory.TraceImportMaxBytesFromEnv(), cfg.Artifacts.MaxBytes)),
+		// Errors handlers return, and unknown routes, get the error envelope
+		ErrorHandler: apierror.Handler,
+		// Behind a proxy, the client's address comes from ProxyHeader, but
+		// only on requests from a trusted proxy; the check stays on with
+		// none listed, or every client could set the header
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxyList(),
+		ProxyHeader:             cfg.Server.ProxyHeader,
 	})
-	log.Println("✓ Fiber app initialized")
 
 	// Middleware
 	app.Use(recover.New())
-	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${method} ${path} (${latency})\n",
-	}))
+	app.Use(logging.Middleware())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowOriginsFunc: cfg.Server.AllowsOrigin,
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Workspace", logging.RequestIDHeader},
+		ExposeHeaders:    []string{logging.RequestIDHeader},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowCredentials: true,
 	}))
+	// Browsers don't apply CORS to WebSockets, so handshakes are held to
+	// the same origins; clients that aren't browsers send no Origin
+	app.Use("/ws", func(c fiber.Ctx) error {
+		if origin := c.Get(fiber.HeaderOrigin); origin != "" && !cfg.Server.AllowsOrigin(origin) {
+			return apierror.Send(c, 403, "origin not allowed")
+		}
+		return c.Next()
+	})
+	slog.Info("allowed origins", "origins", cfg.Server.Origins)
+	for _, origin := range cfg.Server.Origins {
+		if origin == "*" {
+			slog.Warn("CORS_ORIGINS allows every origin; list the frontend's origins in production")
+		}
+	}
+	if len(cfg.Server.TrustedProxies) > 0 {
+		slog.Info("trusting proxies", "header", cfg.Server.ProxyHeader, "proxies", cfg.Server.TrustedProxies)
+	}
+
+	// The frontend, when there's a build, is served ahead of authentication:
+	// the page is public and its calls to the API authenticate
+	uiServed := false
+	if cfg.WebUI.Enabled {
+		assets, source, err := webui.Assets(cfg.WebUI)
+		switch {
+		case errors.Is(err, webui.ErrNoAssets):
+			slog.Info("frontend not embedded; run it with npm run dev or set WEBUI_DIR")
+		case err != nil:
+			slog.Warn("frontend not served", "error", err)
+		default:
+			app.Use(webui.Handler(assets, "/api", "/ws", "/health", "/livez", "/readyz", "/metrics", "/.well-known"))
+			uiServed = true
+			slog.Info("serving the frontend", "source", source)
+		}
+	}
+
+	// Authentication runs after CORS so preflight requests don't need credentials
+	authenticator, err := auth.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		fatal("failed to initialize authentication", "error", err)
+	}
+	app.Use(authenticator.Middleware(authRules))
+	if authenticator.Enabled() {
+		slog.Info("authentication enabled")
+	} else {
+		slog.Warn("authentication disabled, every request is treated as an admin")
+	}
+
+	// Rate limits keep runaway clients from swamping Ollama and Chrome
+	rateConfig := cfg.RateLimit
+	slog.Info("rate limits", "api", rateConfig.REST, "heavy", rateConfig.Heavy, "websocket", rateConfig.WebSocket)
 
 	// Initialize Ollama client
-	log.Println("→ Initializing Ollama client...")
-	ollamaHost := os.Getenv("OLLAMA_HOST")
-	if ollamaHost == "" {
-		ollamaHost = "http://localhost:11434"
+	ollamaClient := ollama.NewClientWithConfig(cfg.Ollama)
+	modelPulls := ollama.NewPulls(ollamaClient)
+	slog.Info("ollama client initialized", "host", cfg.Ollama.Host)
+
+	// Chat, summaries, reranking and drafted fixes go to the reasoner
+	reasoner, err := llm.New(cfg.LLM.Reasoner, cfg.Ollama)
+	if err != nil {
+		fatal("failed to create the reasoner's LLM provider", "error", err)
 	}
-	ollamaClient := ollama.NewClient()
-	log.Println("✓ Ollama client initialized")
+	slog.Info("LLM providers",
+		"planner", cfg.LLM.Planner.Provider, "reasoner", cfg.LLM.Reasoner.Provider, "embedder", cfg.LLM.Embedder.Provider)
 
-	// Initialize long-term memory (skip for now - hangs on Neo4j connection)
-	log.Println("→ Skipping long-term memory (Neo4j connection hangs)...")
-	var longTerm *memory.LongTermMemory = nil
-	log.Println("✓ Continuing without long-term memory")
+	// Initialize long-term memory in the background; runs degraded until Neo4j is reachable
+	longTerm := memory.StartLongTermMemory()
+	longTerm.StartRetention(memory.RetentionConfigFromEnv())
+	if cfg.Features.MemoryRerank {
+		longTerm.SetReranker(memory.NewLLMReranker(reasoner))
+	}
+	auditLog, err := memory.NewAuditLogFromEnv()
+	if err != nil {
+		slog.Warn("memory audit log disabled", "error", err)
+	} else if auditLog != nil {
+		longTerm.SetAuditLog(auditLog)
+	}
+	slog.Info("long-term memory connecting in background")
 
 	// Initialize short-term memory
 	shortTerm := memory.NewShortTermMemory()
-	log.Println("✓ Short-term memory initialized")
+	if blobStore, err := memory.NewDiskBlobStoreFromEnv(); err != nil {
+		slog.Warn("screenshot store unavailable, keeping screenshots in memory", "error", err)
+	} else {
+		shortTerm.SetBlobStore(blobStore)
+	}
+	shortTerm.SetEmbedder(memory.NewEmbeddingGenerator())
+	slog.Info("short-term memory initialized")
+
+	// Restore short-term memory snapshots so interrupted tasks can resume
+	if snapshotStore, err := memory.NewSnapshotStoreFromEnv(); err != nil {
+		slog.Warn("short-term memory snapshots disabled", "error", err)
+	} else {
+		restored, err := shortTerm.EnableSnapshots(snapshotStore, memory.SnapshotIntervalFromEnv())
+		if err != nil {
+			slog.Warn("failed to restore short-term memory", "error", err)
+		} else {
+			slog.Info("short-term memory restored", "tasks", restored, "interrupted", len(shortTerm.InterruptedTasks()))
+		}
+	}
+
+	// Evict stale and oversized tasks, archiving them to long-term memory first
+	shortTerm.StartJanitor(memory.JanitorConfigFromEnv(), longTerm)
+
+	// Promote finished tasks to the knowledge graph on a schedule
+	consolidator := memory.NewConsolidator(longTerm, shortTerm, reasoner)
+	consolidator.Start(memory.ConsolidationIntervalFromEnv())
+
+	// Index each workspace's files into its long-term memory on request
+	indexerConfig := memory.IndexerConfigFromEnv()
+	indexers := memory.NewIndexers(longTerm, indexerConfig)
 
 	// Combine memory system
 	memorySystem := memory.NewSystem(longTerm, shortTerm)
-	log.Println("✓ Memory system combined")
+	slog.Info("memory system combined")
+
+	// Persist chat history per session; chat falls back to single-turn without it
+	conversations, err := memory.NewConversationStoreFromEnv(reasoner)
+	if err != nil {
+		slog.Warn("conversation history disabled", "error", err)
+	} else {
+		slog.Info("conversation store initialized")
+	}
+
+	// Keep the files agent runs produce; artifact routes answer 503 without it
+	artifactStore, err := artifacts.Open(cfg.Artifacts)
+	if err != nil {
+		slog.Warn("artifact store disabled", "error", err)
+	} else {
+		slog.Info("artifact store initialized", "dir", cfg.Artifacts.Dir)
+	}
+
+	// Total the tokens every model request uses; /api/usage answers 503 without it
+	usageLedger, err := usage.Open(cfg.Usage)
+	if err != nil {
+		slog.Warn("token usage accounting disabled", "error", err)
+	} else {
+		llm.SetRecorder(usageLedger)
+		slog.Info("token usage ledger initialized", "path", cfg.Usage.DBPath)
+	}
 
 	// Initialize terminal manager
 	terminalMgr := terminal.NewManager(&terminal.Config{
 		DefaultShell: "/bin/bash",
 		MaxSessions:  10,
 	})
-	log.Println("✓ Terminal manager initialized")
+	slog.Info("terminal manager initialized")
 
 	// Initialize MCP client (for other MCP servers like filesystem, memory, etc.)
 	mcpClient := mcp.NewClient(&mcp.Config{
 		ConfigPath: "./backend/mcp-config.json",
 	})
-	log.Println("✓ MCP client initialized")
+	slog.Info("MCP client initialized")
+
+	// Confine file routes to the open workspaces' roots
+	workspaces, err := files.NewRegistry(cfg.Files)
+	if err != nil {
+		slog.Warn("file routes disabled", "error", err)
+	} else {
+		slog.Info("workspace active", "workspace", workspaces.Active())
+	}
 
 	// Initialize ChromeDP browser manager (Go-native browser automation)
-	log.Println("→ Starting ChromeDP browser...")
+	slog.Info("starting ChromeDP browser")
 	browserMgr := browser.NewManager(shortTerm)
 	if err := browserMgr.Initialize(); err != nil {
-		log.Fatalf("Failed to start browser: %v", err)
+		fatal("failed to start browser", "error", err)
+	}
+	if artifactStore != nil {
+		browserMgr.SetArtifacts(artifactStore)
 	}
-	log.Println("✓ ChromeDP browser started")
+	slog.Info("ChromeDP browser started")
 
 	// Initialize watchdog
 	watchdogSvc := watchdog.NewWatchdog(&watchdog.Config{
-		Enabled:        true,
+		Enabled:        cfg.Features.Watchdog,
 		ScanInterval:   time.Second * 30,
 		MinConfidence:  0.7,
 		AlertThreshold: watchdog.SeverityWarning,
+		AlertCooldown:  time.Hour,
 		Memory:         memorySystem,
 	})
-	watchdogSvc.Start()
-	log.Println("✓ Watchdog started")
+	if err := watchdogSvc.OpenAlertStore(watchdog.AlertStoreConfigFromEnv()); err != nil {
+		slog.Warn("watchdog alerts won't survive restarts", "error", err)
+	}
+
+	// Alerts are sent to the configured webhook, Slack and email sinks
+	if notifyConfig, err := watchdog.NotifierConfigFromEnv(); err != nil {
+		slog.Warn("watchdog notifications disabled", "error", err)
+	} else if len(notifyConfig.Sinks) > 0 {
+		watchdogSvc.SetNotifier(watchdog.NewNotifier(notifyConfig))
+		slog.Info("watchdog notifications enabled", "sinks", len(notifyConfig.Sinks))
+	}
+	if err := watchdogSvc.Start(); err != nil {
+		slog.Warn("watchdog not started", "error", err)
+	} else {
+		slog.Info("watchdog started")
+	}
+
+	// Secret scanning keeps acknowledged findings in a baseline file
+	if secretConfig, err := watchdog.SecretScannerConfigFromEnv(); err != nil {
+		slog.Warn("using the default secret scanner", "error", err)
+	} else if scanner, err := watchdog.NewSecretScanner(secretConfig); err != nil {
+		slog.Warn("using the default secret scanner", "error", err)
+	} else {
+		watchdogSvc.SetSecretScanner(scanner)
+	}
+
+	// Approved proposals are built and tested on a scratch branch before they're merged
+	watchdogSvc.SetPipeline(watchdog.NewPipeline(watchdog.PipelineConfigFromEnv(), terminalMgr))
+
+	// External linters run in sandboxed terminal sessions next to the built-in checks
+	analyzers, err := watchdog.AnalyzersFromEnv(terminalMgr)
+	if err != nil {
+		slog.Warn("some watchdog analyzers are disabled", "error", err)
+	}
+	for _, analyzer := range analyzers {
+		if err := watchdogSvc.RegisterAnalyzer(analyzer); err != nil {
+			slog.Warn("failed to register watchdog analyzer", "error", err)
+		}
+	}
+
+	// Every reward is kept in an append-only ledger for evolution analytics
+	if ledger, err := watchdog.NewRewardLedgerFromEnv(); err != nil {
+		slog.Warn("rewards won't survive restarts", "error", err)
+	} else {
+		watchdogSvc.SetRewardLedger(ledger)
+	}
+
+	// Alerts that keep recurring in one package draft a proposal to fix them
+	watchdogSvc.SetCorrelator(watchdog.NewCorrelator(watchdog.CorrelationConfigFromEnv(), reasoner))
+
+	// Dependency manifests are checked against the OSV vulnerability database
+	if scanner, err := watchdog.NewDependencyScanner(watchdog.DependencyScannerConfigFromEnv()); err != nil {
+		slog.Warn("dependency scanning disabled", "error", err)
+	} else {
+		watchdogSvc.SetDependencyScanner(scanner)
+	}
+
+	// Shifts in how each strategy reasons and reflects are flagged as concept drift
+	if driftConfig, err := watchdog.DriftConfigFromEnv(); err != nil {
+		slog.Warn("concept drift detection disabled", "error", err)
+	} else if detector, err := watchdog.NewDriftDetector(driftConfig, memory.NewEmbeddingGenerator()); err != nil {
+		slog.Warn("concept drift detection disabled", "error", err)
+	} else {
+		watchdogSvc.SetDriftDetector(detector)
+	}
+
+	// Tasks that get slower, retry more or use more tokens after an
+	// evolution raise an alert and a proposal to revert it
+	if regressionConfig, err := watchdog.RegressionConfigFromEnv(); err != nil {
+		slog.Warn("regression detection disabled", "error", err)
+	} else if detector, err := watchdog.NewRegressionDetector(regressionConfig); err != nil {
+		slog.Warn("regression detection disabled", "error", err)
+	} else {
+		watchdogSvc.SetRegressionDetector(detector)
+	}
+
+	// Agents can scan their own changes before committing them
+	watchdogSvc.SetScanConfig(watchdog.ScanConfigFromEnv())
+	watchdogSvc.SetReviewConfig(watchdog.ReviewConfigFromEnv())
+	watchdogSvc.SetSLAConfig(watchdog.SLAConfigFromEnv())
+
+	// User rules are reloaded whenever the rules file changes
+	watchdogSvc.SetRules(watchdog.NewRulesEngineFromEnv())
+
+	// Stream workspace file changes into the watchdog's analyzers
+	if cfg.Features.WatchdogWatch {
+		watchConfig, err := watchdog.WatcherConfigFromEnv()
+		if err != nil {
+			slog.Warn("watchdog file watcher disabled", "error", err)
+		} else if err := watchdogSvc.Watch(watchConfig); err != nil {
+			slog.Warn("watchdog file watcher disabled", "error", err)
+		}
+	}
+
+	// Terminal commands agents and users run are checked for anomalies
+	if commandConfig, err := watchdog.CommandMonitorConfigFromEnv(); err != nil {
+		slog.Warn("terminal command monitoring disabled", "error", err)
+	} else if monitor, err := watchdog.NewCommandMonitor(commandConfig); err != nil {
+		slog.Warn("terminal command monitoring disabled", "error", err)
+	} else if err := watchdogSvc.WatchCommands(monitor, terminalMgr.History()); err != nil {
+		slog.Warn("terminal command monitoring disabled", "error", err)
+	}
+
+	// New commits are analyzed and attributed to their human or agent authors
+	if cfg.Features.WatchdogCommits {
+		if err := watchdogSvc.WatchCommits(watchdog.NewCommitMonitor(watchdog.CommitMonitorConfigFromEnv())); err != nil {
+			slog.Warn("watchdog commit monitoring disabled", "error", err)
+		}
+	}
+
+	// The agent plans commands and runs them with the browser, terminal and MCP tools
+	agentController := agent.NewController(longTerm, shortTerm, browserMgr, terminalMgr, mcpClient, watchdogSvc)
+	agentController.SetConsolidator(consolidator)
+	agentController.SetBudget(cfg.Budget)
+	slog.Info("agent controller initialized")
+
+	// Webhooks notify external services of finished tasks, new proposals and
+	// error alerts; webhook routes answer 503 without them
+	hooks, err := webhooks.Open(cfg.Webhooks)
+	stopHookEvents := func() {}
+	if err != nil {
+		slog.Warn("webhooks disabled", "error", err)
+	} else {
+		hooks.Start()
+		agentController.SetTaskListener(func(task models.Task) {
+			hooks.Emit("task."+task.Status, task)
+		})
+
+		var events <-chan watchdog.Event
+		events, stopHookEvents = watchdogSvc.Events().Subscribe(0, watchdog.EventProposalCreated, watchdog.EventAlertCreated)
+		go func() {
+			for event := range events {
+				switch event.Type {
+				case watchdog.EventProposalCreated:
+					hooks.Emit(webhooks.EventProposalCreated, event.Payload)
+				case watchdog.EventAlertCreated:
+					if alert, ok := event.Payload.(watchdog.Alert); ok && alert.Severity == watchdog.AlertSeverityError {
+						hooks.Emit(webhooks.EventAlertError, alert)
+					}
+				}
+			}
+		}()
+		slog.Info("webhooks initialized")
+	}
+
+	// Metrics read live watchdog, memory and LLM circuit state on each scrape
+	watchdogSvc.RegisterMetrics(metrics.Default)
+	memorySystem.RegisterMetrics(metrics.Default)
+	llm.RegisterMetrics(metrics.Default)
+
+	// Dependencies are probed in the background; /readyz waits on the required ones
+	checker := health.NewChecker(cfg.Health)
+	checker.Add("ollama", ollamaClient.Ping)
+	checker.Add("neo4j", longTerm.Ping)
+	checker.Add("browser", func(ctx context.Context) error {
+		err := browserMgr.Ping(ctx)
+		if errors.Is(err, browser.ErrNotStarted) {
+			return health.ErrIdle
+		}
+		return err
+	})
+	checker.AddGroup("mcp", func() map[string]health.Check {
+		checks := make(map[string]health.Check)
+		for _, name := range mcpClient.ListServers() {
+			checks[name] = func(ctx context.Context) error { return mcpClient.Ping(ctx, name) }
+		}
+		return checks
+	})
+	checker.RegisterMetrics(metrics.Default)
+	checker.Start()
+	slog.Info("health probes started", "interval", cfg.Health.Interval, "required", cfg.Health.Required)
 
 	// Routes
 	api := app.Group("/api")
+	api.Use(ratelimit.Middleware(rateConfig))
+
+	// API requests work in the workspace they name, or the active one
+	api.Use(func(c fiber.Ctx) error {
+		workspace := requestWorkspace(c)
+		if workspace == "" && workspaces != nil {
+			workspace = workspaces.Active()
+		}
+		c.Locals(workspaceLocal, workspace)
+		return c.Next()
+	})
 
 	// Health check
 	app.Get("/health", func(c fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status":    "ok",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"services": fiber.Map{
-				"memory":   longTerm != nil,
-				"ollama":   ollamaClient != nil,
-				"browser":  true,
-				"terminal": terminalMgr.IsHealthy(),
-				"mcp":      mcpClient.IsHealthy(),
-				"watchdog": watchdogSvc.IsRunning(),
+		report := checker.Report()
+		return c.JSON(httpapi.Health{
+			Status:    report.Status,
+			Ready:     report.Ready,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Uptime:    checker.Uptime().Round(time.Second).String(),
+			Services: httpapi.HealthServices{
+				Memory:    longTerm.Status(),
+				ShortTerm: shortTerm.JanitorStats(),
+				Ollama:    checker.Up("ollama"),
+				Browser:   checker.Up("browser"),
+				Terminal:  terminalMgr.IsHealthy(),
+				MCP:       checker.Up("mcp"),
+				Watchdog:  watchdogSvc.IsRunning(),
 			},
+			Probes: report.Probes,
 		})
 	})
 
-	// TODO: Agent, EvoX, and Watchdog routes will be added when implementations are ready
+	// Liveness: the process answers, whatever its dependencies' state, so
+	// an orchestrator only restarts it when it hangs
+	app.Get("/livez", func(c fiber.Ctx) error {
+		return c.JSON(httpapi.Liveness{Status: "ok", Uptime: checker.Uptime().Round(time.Second).String()})
+	})
 
-	// Memory routes
-	api.Post("/memory/store", func(c fiber.Ctx) error {
-		var req struct {
-			Type    string                 `json:"type"`
-			Content string                 `json:"content"`
-			Context map[string]interface{} `json:"context"`
+	// Readiness: every required probe is up and the server isn't shutting down
+	app.Get("/readyz", func(c fiber.Ctx) error {
+		report := checker.Report()
+		readiness := httpapi.Readiness{Status: report.Status, Ready: report.Ready, Failing: checker.Failing()}
+		if !report.Ready {
+			return c.Status(503).JSON(readiness)
+		}
+		return c.JSON(readiness)
+	})
+
+	// Prometheus metrics
+	app.Get("/metrics", func(c fiber.Ctx) error {
+		var buf bytes.Buffer
+		if err := metrics.Default.WriteText(&buf); err != nil {
+			return apierror.Send(c, 500, err.Error())
+		}
+		c.Set("Content-Type", metrics.ContentType)
+		return c.Send(buf.Bytes())
+	})
+
+	// OpenAPI document, rendered once from the route table
+	apiSpec := httpapi.Spec(func(method, path string) string {
+		return auth.ScopeFor(authRules, method, path)
+	})
+	apiDocument := apiSpec.Document()
+	api.Get("/openapi.json", func(c fiber.Ctx) error {
+		return c.JSON(apiDocument)
+	})
+
+	// Effective configuration, without secrets
+	api.Get("/config", func(c fiber.Ctx) error {
+		return c.JSON(cfg.Public())
+	})
+
+	// Recent log records, newest last
+	api.Get("/logs", func(c fiber.Ctx) error {
+		var req logging.TailQuery
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		entries, err := logTail.Query(req)
+		if err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+		return c.JSON(httpapi.LogList{Entries: entries, Count: len(entries)})
+	})
+
+	// TODO: EvoX routes will be added when the implementation is ready
+
+	// Agent routes
+	api.Post("/agent/initialize", func(c fiber.Ctx) error {
+		var req models.InitializeRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, "invalid request body")
+			}
+		}
+
+		sessionID, err := agentController.Initialize(req)
+		if err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
 		}
+
+		return c.JSON(httpapi.AgentSession{SessionID: sessionID, Status: agentController.GetStatus()})
+	})
+
+	// Commands are planned before returning, then run in the background
+	api.Post("/agent/command", func(c fiber.Ctx) error {
+		var req models.CommandRequest
 		if err := c.Bind().JSON(&req); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			return apierror.Send(c, 400, "invalid request body")
 		}
 
-		switch req.Type {
-		case "conversation":
-			return c.JSON(fiber.Map{"success": true})
-		case "code":
-			return c.JSON(fiber.Map{"success": true})
-		default:
-			return c.Status(400).JSON(fiber.Map{"error": "invalid type"})
+		taskID, err := agentController.ExecuteCommand(req)
+		if err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
 		}
+		logging.FromContext(logging.RequestContext(c)).Info("task accepted", "task_id", taskID)
+
+		return c.Status(202).JSON(httpapi.TaskAccepted{TaskID: taskID, Status: agentController.GetStatus()})
 	})
 
-	api.Post("/memory/query", func(c fiber.Ctx) error {
-		var req struct {
-			Query string `json:"query"`
-			Limit int    `json:"limit"`
+	api.Get("/agent/status", func(c fiber.Ctx) error {
+		return c.JSON(agentController.GetStatus())
+	})
+
+	api.Post("/agent/pause", func(c fiber.Ctx) error {
+		if err := agentController.Pause(); err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
+		}
+		return c.JSON(agentController.GetStatus())
+	})
+
+	api.Post("/agent/resume", func(c fiber.Ctx) error {
+		if err := agentController.Resume(); err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
+		}
+		return c.JSON(agentController.GetStatus())
+	})
+
+	// Cancellation takes effect once the step in progress returns
+	api.Post("/agent/cancel", func(c fiber.Ctx) error {
+		taskID, err := agentController.Cancel()
+		if err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
 		}
+		return c.Status(202).JSON(httpapi.TaskAccepted{TaskID: taskID, Status: agentController.GetStatus()})
+	})
+
+	// Tasks started since boot, then interrupted ones that can be resumed
+	api.Get("/agent/tasks", func(c fiber.Ctx) error {
+		tasks := agentController.ListTasks(models.TaskListRequest{})
+		return c.JSON(httpapi.TaskList{Tasks: tasks, Count: len(tasks)})
+	})
+
+	// Task routes; step progress streams to /ws/chat as task_step messages
+	api.Post("/tasks", func(c fiber.Ctx) error {
+		var req models.TaskCreateRequest
 		if err := c.Bind().JSON(&req); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			return apierror.Send(c, 400, "invalid request body")
+		}
+
+		taskID, err := agentController.ExecuteCommand(models.CommandRequest{Command: req.Goal, Context: req.Context, Budget: req.Budget})
+		if err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
+		}
+		logging.FromContext(logging.RequestContext(c)).Info("task accepted", "task_id", taskID)
+		task, err := agentController.GetTask(taskID)
+		if err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
 		}
 
-		// Query memory system
-		results := []map[string]interface{}{}
-		return c.JSON(fiber.Map{"results": results})
+		return c.Status(201).JSON(task)
 	})
 
-	// File operations routes
-	api.Get("/files/tree", func(c fiber.Ctx) error {
-		path := c.Query("path", ".")
+	api.Get("/tasks", func(c fiber.Ctx) error {
+		var req models.TaskListRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
 
-		// Build file tree
-		tree, err := buildFileTree(path)
+		tasks := agentController.ListTasks(req)
+		return c.JSON(httpapi.TaskList{Tasks: tasks, Count: len(tasks)})
+	})
+
+	api.Get("/tasks/:id", func(c fiber.Ctx) error {
+		task, err := agentController.GetTask(c.Params("id"))
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
 		}
 
-		return c.JSON(tree)
+		return c.JSON(task)
 	})
 
-	api.Get("/files/content", func(c fiber.Ctx) error {
-		path := c.Query("path")
-		if path == "" {
-			return c.Status(400).JSON(fiber.Map{"error": "path required"})
+	// Cancelling takes effect once the step in progress returns
+	api.Delete("/tasks/:id", func(c fiber.Ctx) error {
+		if _, err := agentController.CancelTask(c.Params("id")); err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
 		}
-		// Return file content
-		return c.JSON(fiber.Map{"path": path, "content": ""})
+		task, err := agentController.GetTask(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, agentErrorStatus(err), err.Error())
+		}
+
+		return c.Status(202).JSON(task)
 	})
 
-	// WebSocket routes
-	app.Get("/ws/chat", websocket.HandleChatWebSocket(nil))
-	app.Get("/ws/browser", websocket.HandleA2AWebSocket(mcpClient, browserMgr, terminalMgr)) // Browser + Terminal automation with JSON-RPC 2.0
-	app.Get("/ws/a2a", websocket.HandleA2AWebSocket(mcpClient, browserMgr, terminalMgr)) // A2A protocol with browser + terminal
-	log.Println("✓ A2A WebSocket registered with browser and terminal support")
+	// Authentication routes
+	api.Get("/auth/whoami", func(c fiber.Ctx) error {
+		return c.JSON(httpapi.WhoAmI{
+			Enabled:   authenticator.Enabled(),
+			Principal: auth.FromContext(c),
+		})
+	})
 
-	// Graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	// Exchange an API key for a session token, optionally with a narrower scope
+	api.Post("/auth/sessions", func(c fiber.Ctx) error {
+		var req models.SessionRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
 
-	go func() {
-		<-sigChan
-		log.Println("\n🛑 Shutting down gracefully...")
+		token, session, err := authenticator.IssueSession(auth.FromContext(c), req.Scope)
+		if err != nil {
+			return apierror.Send(c, authErrorStatus(err), err.Error())
+		}
 
-		// Cleanup
-		log.Println("  → Stopping watchdog...")
-		watchdogSvc.Stop()
+		return c.Status(201).JSON(httpapi.SessionToken{
+			Token:     token,
+			Scope:     session.Scope,
+			ExpiresAt: session.ExpiresAt,
+		})
+	})
 
-		log.Println("  → Closing terminals...")
-		terminalMgr.CloseAll()
+	// API key management; keys exist only while authentication is enabled
+	keys := authenticator.Keys()
+	keysDisabled := func(c fiber.Ctx) error {
+		return apierror.Send(c, 503, "authentication is disabled")
+	}
 
-		log.Println("  → Disconnecting MCP...")
-		mcpClient.DisconnectAll()
+	api.Get("/auth/keys", func(c fiber.Ctx) error {
+		if keys == nil {
+			return keysDisabled(c)
+		}
+
+		return c.JSON(httpapi.KeyList{Keys: keys.List()})
+	})
 
-		if longTerm != nil {
-			log.Println("  → Closing memory...")
-			longTerm.Close()
+	api.Post("/auth/keys", func(c fiber.Ctx) error {
+		if keys == nil {
+			return keysDisabled(c)
 		}
 
-		log.Println("  → Stopping server...")
-		app.Shutdown()
+		var req models.APIKeyRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
 
-		log.Println("✓ Shutdown complete")
-		os.Exit(0)
-	}()
+		key, secret, err := keys.Create(req.Name, req.Scope, time.Duration(req.ExpiresInDays)*24*time.Hour, callerName(c, ""))
+		if err != nil {
+			return apierror.Send(c, authErrorStatus(err), err.Error())
+		}
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+		// The secret is only ever returned here
+		return c.Status(201).JSON(httpapi.KeyCreated{Key: key, Secret: secret})
+	})
+
+	api.Delete("/auth/keys/:id", func(c fiber.Ctx) error {
+		if keys == nil {
+			return keysDisabled(c)
+		}
+
+		key, err := keys.Revoke(c.Params("id"), callerName(c, ""))
+		if err != nil {
+			return apierror.Send(c, authErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(key)
+	})
+
+	// Watchdog routes
+	api.Get("/watchdog/alerts", func(c fiber.Ctx) error {
+		var req models.WatchdogAlertQuery
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		page, err := watchdogSvc.QueryAlerts(req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(page)
+	})
+
+	// Alert workflow: acknowledging takes ownership and stops the SLA timer,
+	// resolving closes an alert until it reappears, ignoring closes it for good
+	alertActions := map[string]func(string, models.AlertActionRequest) (*watchdog.Alert, error){
+		"acknowledge": watchdogSvc.AcknowledgeAlert,
+		"assign":      watchdogSvc.AssignAlert,
+		"resolve":     watchdogSvc.ResolveAlert,
+		"ignore":      watchdogSvc.IgnoreAlert,
+		"reopen":      watchdogSvc.ReopenAlert,
+	}
+	for action, handle := range alertActions {
+		api.Post("/watchdog/alerts/:id/"+action, func(c fiber.Ctx) error {
+			var req models.AlertActionRequest
+			if len(c.Body()) > 0 {
+				if err := c.Bind().JSON(&req); err != nil {
+					return apierror.Send(c, 400, err.Error())
+				}
+			}
+			req.Actor = callerName(c, req.Actor)
+
+			alert, err := handle(c.Params("id"), req)
+			if err != nil {
+				return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+			}
+
+			return c.JSON(alert)
+		})
 	}
 
-	log.Println("\n🚀 Agentic Self-Evolving Command Center")
-	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	log.Printf("Server: http://localhost:%s\n", port)
-	log.Printf("Health: http://localhost:%s/health\n", port)
-	log.Printf("WebSocket Chat: ws://localhost:%s/ws/chat\n", port)
-	log.Printf("WebSocket A2A: ws://localhost:%s/ws/a2a\n", port)
-	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	log.Println("Press Ctrl+C to stop")
+	api.Post("/watchdog/scan", func(c fiber.Ctx) error {
+		var req models.WatchdogScanRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := watchdogSvc.Scan(c.Context(), req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Get("/watchdog/commits", func(c fiber.Ctx) error {
+		reports, err := watchdogSvc.CommitReports()
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.CommitList{Commits: reports})
+	})
+
+	// Called by scripts/watchdog-pre-commit.sh with the staged diff as the
+	// body, or with a JSON CommitCheckRequest
+	api.Post("/watchdog/commits/check", func(c fiber.Ctx) error {
+		var req models.CommitCheckRequest
+		if strings.HasPrefix(c.Get("Content-Type"), "application/json") {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		} else {
+			req = models.CommitCheckRequest{Author: c.Get("X-Commit-Author"), Email: c.Get("X-Commit-Email"), Diff: string(c.Body())}
+		}
+
+		report, err := watchdogSvc.CheckCommit(req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		if report.Blocked {
+			return c.Status(422).JSON(report)
+		}
+		return c.JSON(report)
+	})
+
+	// Agents report each finished task's duration, retries and token usage
+	api.Post("/watchdog/task-metrics", func(c fiber.Ctx) error {
+		var req models.TaskMetricsRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		if err := watchdogSvc.RecordTaskMetrics(req); err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+		return c.JSON(httpapi.Success{Success: true})
+	})
+
+	api.Get("/watchdog/alert-groups", func(c fiber.Ctx) error {
+		return c.JSON(httpapi.AlertGroupList{Groups: watchdogSvc.AlertGroups()})
+	})
+
+	api.Get("/watchdog/proposals", func(c fiber.Ctx) error {
+		return c.JSON(httpapi.ProposalList{Proposals: watchdogSvc.GetProposals()})
+	})
+
+	api.Post("/watchdog/proposals", func(c fiber.Ctx) error {
+		var req models.ProposalRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+		req.Author = callerName(c, req.Author)
+
+		id, err := watchdogSvc.SubmitProposal(req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.Status(201).JSON(httpapi.ProposalCreated{ProposalID: id})
+	})
+
+	api.Get("/watchdog/proposals/:id", func(c fiber.Ctx) error {
+		proposal, err := watchdogSvc.GetProposal(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(proposal)
+	})
+
+	api.Get("/watchdog/proposals/:id/diff", func(c fiber.Ctx) error {
+		proposal, err := watchdogSvc.GetProposal(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.ProposalDiff{Files: proposal.Diffs, Comments: proposal.Comments})
+	})
+
+	api.Post("/watchdog/proposals/:id/submit", func(c fiber.Ctx) error {
+		var req models.ProposalReviewRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
+		req.Reviewer = callerName(c, req.Reviewer)
+
+		proposal, err := watchdogSvc.SubmitForReview(c.Params("id"), req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(proposal)
+	})
+
+	api.Post("/watchdog/proposals/:id/comments", func(c fiber.Ctx) error {
+		var req models.ProposalCommentRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+		req.Author = callerName(c, req.Author)
+
+		comment, err := watchdogSvc.AddComment(c.Params("id"), req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.Status(201).JSON(comment)
+	})
+
+	api.Post("/watchdog/proposals/:id/comments/:comment/resolve", func(c fiber.Ctx) error {
+		var req models.ProposalCommentResolveRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
+		resolved := req.Resolved == nil || *req.Resolved
+
+		if err := watchdogSvc.ResolveComment(c.Params("id"), c.Params("comment"), resolved); err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.CommentResolved{Resolved: resolved})
+	})
+
+	api.Post("/watchdog/proposals/:id/approve", func(c fiber.Ctx) error {
+		var req models.ProposalReviewRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
+		req.Reviewer = callerName(c, req.Reviewer)
+
+		proposal, err := watchdogSvc.ApproveProposal(c.Params("id"), req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		if proposal.Status != watchdog.ProposalApproved {
+			// Still waiting for more approvals
+			return c.JSON(httpapi.ProposalApproval{Approved: false, Proposal: proposal})
+		}
+		// The pipeline runs in the background; poll the proposal for its execution
+		return c.Status(202).JSON(httpapi.ProposalApproval{Approved: true, Proposal: proposal})
+	})
+
+	api.Post("/watchdog/proposals/:id/apply", func(c fiber.Ctx) error {
+		var req models.ProposalReviewRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
+		req.Reviewer = callerName(c, req.Reviewer)
+
+		proposal, err := watchdogSvc.MarkApplied(c.Params("id"), req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(proposal)
+	})
+
+	api.Post("/watchdog/proposals/:id/verify", func(c fiber.Ctx) error {
+		var req models.ProposalReviewRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
+		req.Reviewer = callerName(c, req.Reviewer)
+
+		proposal, err := watchdogSvc.VerifyProposal(c.Params("id"), req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(proposal)
+	})
+
+	api.Post("/watchdog/proposals/:id/reject", func(c fiber.Ctx) error {
+		var req models.ProposalRejectRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
+
+		if err := watchdogSvc.RejectProposal(c.Params("id"), callerName(c, req.Reviewer), req.Reason); err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.ProposalRejected{Rejected: true})
+	})
+
+	api.Post("/watchdog/proposals/:id/rollback", func(c fiber.Ctx) error {
+		if err := watchdogSvc.RollbackProposal(c.Params("id")); err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.ProposalRolledBack{RolledBack: true})
+	})
+
+	// Evolution routes
+	api.Post("/evolve/reward", func(c fiber.Ctx) error {
+		var req models.RewardRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+		req.Reviewer = callerName(c, req.Reviewer)
+
+		if err := watchdogSvc.SetReward(req); err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.Success{Success: true})
+	})
+
+	api.Get("/evolve/analytics", func(c fiber.Ctx) error {
+		var req models.EvolveAnalyticsQuery
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		analytics, err := watchdogSvc.EvolutionAnalytics(req)
+		if err != nil {
+			return apierror.Send(c, watchdogErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(analytics)
+	})
+
+	// Memory routes
+	api.Post("/memory/store", func(c fiber.Ctx) error {
+		var req models.MemoryStoreRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := memorySystem.Store(memoryContext(c), req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Post("/memory/query", func(c fiber.Ctx) error {
+		var req models.MemoryQueryRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := memorySystem.Query(memoryContext(c), req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Post("/memory/vector-search", func(c fiber.Ctx) error {
+		var req models.VectorSearchRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := memorySystem.VectorSearch(memoryContext(c), req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Post("/memory/delete", func(c fiber.Ctx) error {
+		var req models.MemoryDeleteRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := memorySystem.Delete(memoryContext(c), req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Post("/memory/feedback", func(c fiber.Ctx) error {
+		var req models.MemoryFeedbackRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := memorySystem.Feedback(memoryContext(c), req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Get("/memory/graph", func(c fiber.Ctx) error {
+		var req models.MemoryGraphRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := memorySystem.Graph(memoryContext(c), req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	// workspaceIndexer returns the indexer of the request's workspace, or the
+	// status to fail with
+	workspaceIndexer := func(c fiber.Ctx) (*memory.Indexer, int, error) {
+		name, _ := c.Locals(workspaceLocal).(string)
+		if name == "" {
+			name = memory.DefaultWorkspace
+		}
+		root := indexerConfig.Root
+		if workspaces != nil {
+			workspace, err := workspaces.Get(name)
+			if err != nil {
+				return nil, fileErrorStatus(err), err
+			}
+			root = workspace.Root()
+		}
+
+		indexer, err := indexers.For(name, root)
+		if err != nil {
+			return nil, memoryErrorStatus(err), err
+		}
+		return indexer, 0, nil
+	}
+
+	api.Post("/memory/index", func(c fiber.Ctx) error {
+		var req models.MemoryIndexRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return apierror.Send(c, 400, err.Error())
+			}
+		}
+
+		indexer, status, err := workspaceIndexer(c)
+		if err != nil {
+			return apierror.Send(c, status, err.Error())
+		}
+
+		progress, err := indexer.Start(req.Path, req.Force)
+		if errors.Is(err, memory.ErrIndexRunning) {
+			return apierror.SendDetails(c, 409, err.Error(), map[string]interface{}{"progress": progress})
+		}
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.Status(202).JSON(progress)
+	})
+
+	api.Get("/memory/index", func(c fiber.Ctx) error {
+		indexer, status, err := workspaceIndexer(c)
+		if err != nil {
+			return apierror.Send(c, status, err.Error())
+		}
+
+		return c.JSON(indexer.Progress())
+	})
+
+	// Schema versions, store counts and the startup integrity check; 503 until memory is ready
+	api.Get("/memory/health", func(c fiber.Ctx) error {
+		health := longTerm.Health(c.Context())
+		if !health.Ready {
+			return c.Status(503).JSON(health)
+		}
+
+		return c.JSON(health)
+	})
+
+	api.Get("/memory/audit", func(c fiber.Ctx) error {
+		if auditLog == nil {
+			return apierror.Send(c, 503, "memory audit log disabled")
+		}
+
+		var req models.MemoryAuditRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := auditLog.Query(req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Get("/memory/tasks", func(c fiber.Ctx) error {
+		var req models.MemoryTaskListRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := memorySystem.ListTasks(memoryContext(c), req)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Get("/memory/workspaces", func(c fiber.Ctx) error {
+		workspaces, err := memorySystem.Workspaces()
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.WorkspaceNames{Workspaces: workspaces})
+	})
+
+	api.Get("/memory/screenshots/:id", func(c fiber.Ctx) error {
+		data, err := memorySystem.Screenshot(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		// Blobs are content-addressed, so the response never changes
+		c.Set("Content-Type", "image/png")
+		c.Set("Cache-Control", "public, max-age=31536000, immutable")
+		return c.Send(data)
+	})
+
+	api.Get("/memory/tasks/:id", func(c fiber.Ctx) error {
+		result, err := memorySystem.GetTask(memoryContext(c), c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Get("/memory/tasks/:id/export", func(c fiber.Ctx) error {
+		var buf bytes.Buffer
+		if err := memorySystem.ExportTask(memoryContext(c), c.Params("id"), &buf); err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		c.Set("Content-Type", "application/gzip")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "task-"+c.Params("id")+".trace.json.gz"))
+		return c.Send(buf.Bytes())
+	})
+
+	// The body is a bundle from /memory/tasks/:id/export; ?task_id= imports it under a new ID
+	api.Post("/memory/tasks/import", func(c fiber.Ctx) error {
+		var req models.MemoryTaskImportRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		summary, err := memorySystem.ImportTask(memoryContext(c), bytes.NewReader(c.Body()), req.TaskID)
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.Status(201).JSON(summary)
+	})
+
+	// Chat sessions, each seen only by the principal that started it; resume
+	// one over /ws/chat with a resume_session message
+	api.Get("/chat/sessions", func(c fiber.Ctx) error {
+		if conversations == nil {
+			return apierror.Send(c, 503, "conversation history is disabled")
+		}
+		sessions, err := conversations.List(auth.OwnerOf(c))
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.ChatSessionList{Sessions: sessions, Count: len(sessions)})
+	})
+
+	api.Get("/chat/sessions/:id", func(c fiber.Ctx) error {
+		if conversations == nil {
+			return apierror.Send(c, 503, "conversation history is disabled")
+		}
+		conv, err := conversations.Find(c.Params("id"), auth.OwnerOf(c))
+		if err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(conv)
+	})
+
+	api.Delete("/chat/sessions/:id", func(c fiber.Ctx) error {
+		if conversations == nil {
+			return apierror.Send(c, 503, "conversation history is disabled")
+		}
+		if err := conversations.Delete(c.Params("id"), auth.OwnerOf(c)); err != nil {
+			return apierror.Send(c, memoryErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.Deleted{Deleted: c.Params("id")})
+	})
+
+	// Artifacts: files agent runs produce, linked to their tasks
+	api.Get("/artifacts", func(c fiber.Ctx) error {
+		if artifactStore == nil {
+			return apierror.Send(c, 503, "artifact store is disabled")
+		}
+		var req models.ArtifactListRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		page, err := artifactStore.List(req)
+		if err != nil {
+			return apierror.Send(c, artifactErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(page)
+	})
+
+	// The body is the artifact's contents; its content type is taken from
+	// the Content-Type header, or detected
+	api.Post("/artifacts", func(c fiber.Ctx) error {
+		if artifactStore == nil {
+			return apierror.Send(c, 503, "artifact store is disabled")
+		}
+		var req models.ArtifactCreateRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		if req.Kind == "" {
+			req.Kind = artifacts.KindFile
+		}
+		contentType := c.Get(fiber.HeaderContentType)
+		if contentType == fiber.MIMEOctetStream {
+			contentType = ""
+		}
+
+		artifact, err := artifactStore.PutBytes(artifacts.Artifact{
+			TaskID:      req.TaskID,
+			Name:        req.Name,
+			Kind:        req.Kind,
+			ContentType: contentType,
+			Source:      artifacts.SourceAPI,
+		}, c.Body())
+		if err != nil {
+			return apierror.Send(c, artifactErrorStatus(err), err.Error())
+		}
+
+		return c.Status(201).JSON(artifact)
+	})
+
+	api.Get("/artifacts/:id", func(c fiber.Ctx) error {
+		if artifactStore == nil {
+			return apierror.Send(c, 503, "artifact store is disabled")
+		}
+		artifact, err := artifactStore.Get(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, artifactErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(artifact)
+	})
+
+	api.Get("/artifacts/:id/content", func(c fiber.Ctx) error {
+		if artifactStore == nil {
+			return apierror.Send(c, 503, "artifact store is disabled")
+		}
+		artifact, file, err := artifactStore.Content(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, artifactErrorStatus(err), err.Error())
+		}
+
+		// Served as a download, so pages a task saved don't run on this origin
+		c.Set("Content-Type", artifact.ContentType)
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", artifact.Name))
+		c.Set("X-Content-Type-Options", "nosniff")
+		c.Set("ETag", `"`+artifact.SHA256+`"`)
+		// The stream is closed once it's sent
+		return c.SendStream(file, int(artifact.Size))
+	})
+
+	api.Put("/artifacts/:id", func(c fiber.Ctx) error {
+		if artifactStore == nil {
+			return apierror.Send(c, 503, "artifact store is disabled")
+		}
+		var req models.ArtifactUpdateRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+		artifact, err := artifactStore.Update(c.Params("id"), req)
+		if err != nil {
+			return apierror.Send(c, artifactErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(artifact)
+	})
+
+	api.Delete("/artifacts/:id", func(c fiber.Ctx) error {
+		if artifactStore == nil {
+			return apierror.Send(c, 503, "artifact store is disabled")
+		}
+		if err := artifactStore.Delete(c.Params("id")); err != nil {
+			return apierror.Send(c, artifactErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.Deleted{Deleted: c.Params("id")})
+	})
+
+	// Webhooks and their delivery log
+	api.Get("/webhooks", func(c fiber.Ctx) error {
+		if hooks == nil {
+			return apierror.Send(c, 503, "webhooks are disabled")
+		}
+		list, err := hooks.List()
+		if err != nil {
+			return apierror.Send(c, webhookErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.WebhookList{Webhooks: list, Count: len(list)})
+	})
+
+	api.Post("/webhooks", func(c fiber.Ctx) error {
+		if hooks == nil {
+			return apierror.Send(c, 503, "webhooks are disabled")
+		}
+		var req models.WebhookCreateRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+		webhook, err := hooks.Create(req)
+		if err != nil {
+			return apierror.Send(c, webhookErrorStatus(err), err.Error())
+		}
+
+		return c.Status(201).JSON(webhook)
+	})
+
+	api.Get("/webhooks/deliveries", func(c fiber.Ctx) error {
+		if hooks == nil {
+			return apierror.Send(c, 503, "webhooks are disabled")
+		}
+		var req models.WebhookDeliveryListRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		page, err := hooks.Deliveries(req)
+		if err != nil {
+			return apierror.Send(c, webhookErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(page)
+	})
+
+	api.Get("/webhooks/:id", func(c fiber.Ctx) error {
+		if hooks == nil {
+			return apierror.Send(c, 503, "webhooks are disabled")
+		}
+		webhook, err := hooks.Get(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, webhookErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(webhook)
+	})
+
+	api.Put("/webhooks/:id", func(c fiber.Ctx) error {
+		if hooks == nil {
+			return apierror.Send(c, 503, "webhooks are disabled")
+		}
+		var req models.WebhookUpdateRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+		webhook, err := hooks.Update(c.Params("id"), req)
+		if err != nil {
+			return apierror.Send(c, webhookErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(webhook)
+	})
+
+	api.Delete("/webhooks/:id", func(c fiber.Ctx) error {
+		if hooks == nil {
+			return apierror.Send(c, 503, "webhooks are disabled")
+		}
+		if err := hooks.Delete(c.Params("id")); err != nil {
+			return apierror.Send(c, webhookErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.Deleted{Deleted: c.Params("id")})
+	})
+
+	// Queues a ping; follow it in the delivery log
+	api.Post("/webhooks/:id/test", func(c fiber.Ctx) error {
+		if hooks == nil {
+			return apierror.Send(c, 503, "webhooks are disabled")
+		}
+		delivery, err := hooks.Test(c.Params("id"))
+		if err != nil {
+			return apierror.Send(c, webhookErrorStatus(err), err.Error())
+		}
+
+		return c.Status(202).JSON(delivery)
+	})
+
+	// Ollama models: what's installed, downloads and the models in use
+	api.Get("/models", func(c fiber.Ctx) error {
+		list, err := ollamaClient.ListModels(c.Context())
+		if err != nil {
+			return apierror.Send(c, modelErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.ModelList{Models: list, Active: ollamaClient.Models(), Pulls: modelPulls.List()})
+	})
+
+	api.Get("/models/show", func(c fiber.Ctx) error {
+		var req models.ModelRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		if req.Name == "" {
+			return apierror.Send(c, 400, "name is required")
+		}
+		info, err := ollamaClient.ShowModel(c.Context(), req.Name)
+		if err != nil {
+			return apierror.Send(c, modelErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(info)
+	})
+
+	// Follow the download in GET /api/models or model_pull chat messages
+	api.Post("/models/pull", func(c fiber.Ctx) error {
+		var req models.ModelRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+		if req.Name == "" {
+			return apierror.Send(c, 400, "name is required")
+		}
+		pull, err := modelPulls.Start(req.Name)
+		if errors.Is(err, ollama.ErrPullRunning) {
+			return apierror.SendDetails(c, 409, err.Error(), map[string]interface{}{"pull": pull})
+		}
+
+		return c.Status(202).JSON(pull)
+	})
+
+	api.Post("/models/warm", func(c fiber.Ctx) error {
+		var req models.ModelRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+		if req.Name == "" {
+			return apierror.Send(c, 400, "name is required")
+		}
+		start := time.Now()
+		if err := ollamaClient.WarmModel(c.Context(), req.Name); err != nil {
+			return apierror.Send(c, modelErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.ModelWarmed{Model: req.Name, LatencyMs: float64(time.Since(start).Microseconds()) / 1000})
+	})
+
+	api.Put("/models/active", func(c fiber.Ctx) error {
+		var req models.ModelSwitchRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+		if req.Chat == "" && req.Embedding == "" && req.Vision == "" {
+			return apierror.Send(c, 400, "chat, embedding or vision is required")
+		}
+		switched := ollama.ActiveModels{Chat: req.Chat, Embedding: req.Embedding, Vision: req.Vision}
+		if err := ollamaClient.SwitchModels(c.Context(), switched, memory.DefaultEmbeddingConfig().Dimension); err != nil {
+			return apierror.Send(c, modelErrorStatus(err), err.Error())
+		}
+
+		active := ollamaClient.Models()
+		logging.FromContext(logging.RequestContext(c)).Info("switched models",
+			"chat", active.Chat, "embedding", active.Embedding, "vision", active.Vision, "caller", callerName(c, ""))
+		return c.JSON(active)
+	})
+
+	// Token usage: every model request by day and model, agent tasks' by task
+	api.Get("/usage", func(c fiber.Ctx) error {
+		if usageLedger == nil {
+			return apierror.Send(c, 503, "token usage accounting is disabled")
+		}
+		var req models.UsageRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		if req.Days < 0 || req.Tasks < 0 {
+			return apierror.Send(c, 400, "days and tasks can't be negative")
+		}
+		report, err := usageLedger.Report(req)
+		if err != nil {
+			return apierror.Send(c, 500, err.Error())
+		}
+
+		return c.JSON(report)
+	})
+
+	// Workspaces: roots the file routes can serve, one of them active
+	api.Get("/workspace", func(c fiber.Ctx) error {
+		if workspaces == nil {
+			return apierror.Send(c, fileErrorStatus(errFilesDisabled), errFilesDisabled.Error())
+		}
+
+		return c.JSON(httpapi.WorkspaceList{Active: workspaces.Active(), Workspaces: workspaces.List()})
+	})
+
+	api.Post("/workspace", func(c fiber.Ctx) error {
+		if workspaces == nil {
+			return apierror.Send(c, fileErrorStatus(errFilesDisabled), errFilesDisabled.Error())
+		}
+		var req models.WorkspaceOpenRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+
+		info, err := workspaces.Open(req.Name, req.Root, req.Activate)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		logging.FromContext(logging.RequestContext(c)).Info("workspace opened", "workspace", info.Name, "root", info.Root)
+		return c.Status(201).JSON(info)
+	})
+
+	api.Post("/workspace/switch", func(c fiber.Ctx) error {
+		if workspaces == nil {
+			return apierror.Send(c, fileErrorStatus(errFilesDisabled), errFilesDisabled.Error())
+		}
+		var req models.WorkspaceSwitchRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+
+		info, err := workspaces.Switch(req.Name)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		logging.FromContext(logging.RequestContext(c)).Info("switched workspace", "workspace", info.Name)
+		return c.JSON(info)
+	})
+
+	// Closing a workspace forgets it; its files and memory are left alone
+	api.Delete("/workspace/:name", func(c fiber.Ctx) error {
+		if workspaces == nil {
+			return apierror.Send(c, fileErrorStatus(errFilesDisabled), errFilesDisabled.Error())
+		}
+		if err := workspaces.Close(c.Params("name")); err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.WorkspaceClosed{Closed: c.Params("name"), Active: workspaces.Active()})
+	})
+
+	// File operations routes, confined to the request's workspace root
+	filesFor := func(c fiber.Ctx) (*files.Workspace, error) {
+		if workspaces == nil {
+			return nil, errFilesDisabled
+		}
+		name, _ := c.Locals(workspaceLocal).(string)
+		return workspaces.Get(name)
+	}
+
+	api.Get("/files/tree", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileTreeRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		tree, tag, err := workspaceFiles.Tree(req)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		// Clients that send back the ETag get a 304 while nothing listed changed
+		etag := `"` + tag + `"`
+		c.Set("ETag", etag)
+		if c.Get("If-None-Match") == etag {
+			return c.SendStatus(304)
+		}
+		return c.JSON(tree)
+	})
+
+	api.Get("/files/content", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileReadRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		content, err := workspaceFiles.Read(req.Path)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(content)
+	})
+
+	api.Get("/files/search", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileSearchRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, err.Error())
+		}
+
+		result, err := workspaceFiles.Search(c.Context(), req)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	api.Put("/files/content", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileWriteRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+
+		written, err := workspaceFiles.Write(req.Path, req.Content)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(written)
+	})
+
+	api.Post("/files", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileCreateRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+		if req.Type != "" && req.Type != "file" && req.Type != "directory" {
+			return apierror.Send(c, 400, "type must be file or directory")
+		}
+
+		created, err := workspaceFiles.Create(req.Path, req.Content, req.Type == "directory")
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.Status(201).JSON(created)
+	})
+
+	// Directories need ?recursive=true unless they're empty
+	api.Delete("/files", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileDeleteRequest
+		if err := c.Bind().Query(&req); err != nil {
+			return apierror.Send(c, 400, "invalid query parameters")
+		}
+		if err := workspaceFiles.Delete(req.Path, req.Recursive); err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.Deleted{Deleted: req.Path})
+	})
+
+	api.Post("/files/rename", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileRenameRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+
+		path, err := workspaceFiles.Rename(req.From, req.To)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(httpapi.FileRenamed{Path: path})
+	})
+
+	// Conflicting diffs get a 409 with the per-hunk report and the content
+	// with conflict markers; nothing is written
+	api.Post("/files/diff", func(c fiber.Ctx) error {
+		workspaceFiles, err := filesFor(c)
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+		var req models.FileDiffRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			return apierror.Send(c, 400, "invalid request body")
+		}
+
+		result, err := workspaceFiles.ApplyDiff(req.Path, req.Diff, req.DryRun)
+		if errors.Is(err, files.ErrConflict) {
+			return apierror.SendDetails(c, 409, err.Error(), map[string]interface{}{"result": result})
+		}
+		if err != nil {
+			return apierror.Send(c, fileErrorStatus(err), err.Error())
+		}
+
+		return c.JSON(result)
+	})
+
+	// WebSocket routes
+	chatHub := websocket.NewHandler(websocket.NewChatTools(browserMgr, terminalMgr, mcpClient), conversations)
+	browserHub := websocket.NewA2AHandler(mcpClient, browserMgr, terminalMgr, memorySystem)
+	a2aHub := websocket.NewA2AHandler(mcpClient, browserMgr, terminalMgr, memorySystem)
+	chatHub.SetRateLimit(rateConfig.WebSocket)
+	browserHub.SetRateLimit(rateConfig.WebSocket)
+	a2aHub.SetRateLimit(rateConfig.WebSocket)
+	browserHub.SetConfig(cfg.A2A)
+	a2aHub.SetConfig(cfg.A2A)
+	app.Get("/ws/chat", chatHub.HandleWebSocket)
+	// Server-Sent Events fallback for networks that block WebSockets
+	api.Get("/chat/stream", chatHub.HandleStream)
+	api.Post("/chat/message", chatHub.HandleStreamMessage)
+	// Who is connected to chat and the task each is viewing
+	api.Get("/chat/presence", func(c fiber.Ctx) error {
+		users := chatHub.Presence()
+		return c.JSON(httpapi.PresenceList{Users: users, Count: len(users)})
+	})
+	modelPulls.SetNotify(chatHub.BroadcastModelPull)
+	agentController.SetStateListener(chatHub.BroadcastAgentState)
+	agentController.SetStepListener(chatHub.BroadcastTaskStep)
+	// A task's terminal output and browser updates only go to the clients viewing it
+	agentController.SetTerminalListener(chatHub.BroadcastTerminalOutput)
+	agentController.SetBrowserListener(chatHub.BroadcastBrowserUpdate)
+	app.Get("/ws/browser", browserHub.HandleWebSocket) // Browser + Terminal automation with JSON-RPC 2.0
+	app.Get("/ws/a2a", a2aHub.HandleWebSocket)         // A2A protocol with browser + terminal
+	a2aHub.SetTaskRunner(agentController)
+
+	// A2A agent card, so other agents can discover what /ws/a2a offers
+	app.Get("/.well-known/agent.json", func(c fiber.Ctx) error {
+		return c.JSON(a2aHub.AgentCard(websocket.WebSocketURL(c, "/ws/a2a")))
+	})
+	slog.Info("A2A WebSocket registered with browser and terminal support")
+
+	// Live watchdog alerts, proposals and scans
+	app.Get("/ws/watchdog", websocket.HandleWatchdogWebSocket(watchdogSvc.Events()))
+
+	// Every route should be in the OpenAPI document
+	documented := make(map[string]bool)
+	for _, path := range apiSpec.Paths() {
+		documented[path] = true
+	}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method != fiber.MethodHead && !documented[route.Method+" "+route.Path] {
+			slog.Warn("route is missing from the OpenAPI document", "method", route.Method, "path", route.Path)
+		}
+	}
+
+	// Graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		slog.Info("shutting down gracefully")
+		checker.Drain()
+
+		// Bound the whole shutdown so a hung backend can't keep the process alive
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+
+		// Cleanup; connections go first so the commands they're running
+		// finish before the services under them close
+		slog.Info("closing WebSocket connections")
+		if err := chatHub.Stop(shutdownCtx); err != nil {
+			slog.Warn("chat connections didn't drain", "error", err)
+		}
+		if err := browserHub.Stop(shutdownCtx); err != nil {
+			slog.Warn("browser connections didn't drain", "error", err)
+		}
+		if err := a2aHub.Stop(shutdownCtx); err != nil {
+			slog.Warn("A2A connections didn't drain", "error", err)
+		}
+
+		slog.Info("stopping model pulls")
+		modelPulls.Close()
+
+		slog.Info("stopping watchdog")
+		watchdogSvc.Close()
+		checker.Stop()
+
+		if hooks != nil {
+			slog.Info("stopping webhooks")
+			stopHookEvents()
+			if err := hooks.Close(); err != nil {
+				slog.Warn("failed to close webhook outbox", "error", err)
+			}
+		}
+
+		slog.Info("closing API keys")
+		if err := authenticator.Close(); err != nil {
+			slog.Warn("failed to close API keys", "error", err)
+		}
+
+		slog.Info("closing terminals")
+		terminalMgr.CloseAll()
+
+		slog.Info("disconnecting MCP")
+		mcpClient.DisconnectAll()
+
+		slog.Info("closing memory")
+		indexers.Stop()
+		shortTerm.StopJanitor()
+		consolidator.Stop()
+		if err := shortTerm.StopSnapshots(); err != nil {
+			slog.Warn("failed to write final snapshot", "error", err)
+		}
+		if err := longTerm.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("failed to close long-term memory", "error", err)
+		}
+		if auditLog != nil {
+			if err := auditLog.Close(); err != nil {
+				slog.Warn("failed to close memory audit log", "error", err)
+			}
+		}
+		if conversations != nil {
+			if err := conversations.Close(); err != nil {
+				slog.Warn("failed to close conversation store", "error", err)
+			}
+		}
+		if artifactStore != nil {
+			if err := artifactStore.Close(); err != nil {
+				slog.Warn("failed to close artifact store", "error", err)
+			}
+		}
+		if usageLedger != nil {
+			llm.SetRecorder(nil)
+			if err := usageLedger.Close(); err != nil {
+				slog.Warn("failed to close usage ledger", "error", err)
+			}
+		}
+
+		slog.Info("flushing traces")
+		if err := tracer.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("failed to flush traces", "error", err)
+		}
+
+		slog.Info("stopping server")
+		app.Shutdown()
+
+		slog.Info("shutdown complete")
+		os.Exit(0)
+	}()
+
+	// Start server
+	port := cfg.Server.Port
+	scheme, wsScheme := "http", "ws"
+	if cfg.Server.TLS() {
+		scheme, wsScheme = "https", "wss"
+	}
+
+	base := fmt.Sprintf("%s://localhost:%d", scheme, port)
+	wsBase := fmt.Sprintf("%s://localhost:%d", wsScheme, port)
+	endpoints := []any{
+		"url", base,
+		"addr", cfg.Server.Addr(),
+		"health", base + "/health",
+		"chat", wsBase + "/ws/chat",
+		"chat_stream", base + "/api/chat/stream",
+		"a2a", wsBase + "/ws/a2a",
+		"watchdog", wsBase + "/ws/watchdog",
+		"openapi", base + "/api/openapi.json",
+	}
+	if uiServed {
+		endpoints = append(endpoints, "frontend", base+"/")
+	}
+	slog.Info("Agentic Self-Evolving Command Center listening", endpoints...)
+
+	err = app.Listen(cfg.Server.Addr(), fiber.ListenConfig{
+		ListenerNetwork: cfg.Server.Network(),
+		CertFile:        cfg.Server.TLSCert,
+		CertKeyFile:     cfg.Server.TLSKey,
+	})
+	fatal("server stopped", "error", err)
+}
 
-	log.Fatal(app.Listen(":" + port))
+// fatal logs why the server can't run and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
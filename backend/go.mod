@@ -4,12 +4,18 @@ go 1.25
 
 require (
 github.com/MegaGrindStone/go-light-rag v0.1.0
+github.com/chromedp/cdproto v0.0.0-20231011050154-1d073bb38998
 github.com/chromedp/chromedp v0.9.3
+github.com/fsnotify/fsnotify v1.7.0
 github.com/gofiber/fiber/v3 v3.0.0-beta.2
 github.com/gofiber/websocket/v3 v3.0.0-beta.1
 github.com/google/uuid v1.5.0
+github.com/jackc/pgx/v5 v5.9.2
 github.com/joho/godotenv v1.5.1
 github.com/neo4j/neo4j-go-driver/v5 v5.15.0
+github.com/philippgille/chromem-go v0.7.0
+go.etcd.io/bbolt v1.4.0
+gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
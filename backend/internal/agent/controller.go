@@ -2,7 +2,13 @@ package agent
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,7 +17,47 @@ import (
 	"agent-workspace/backend/internal/memory"
 	"agent-workspace/backend/internal/terminal"
 	"agent-workspace/backend/internal/watchdog"
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
 	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/tracing"
+)
+
+// Agent states reported by GetStatus
+const (
+	StateIdle        = "idle"
+	StateInitialized = "initialized"
+	StateWorking     = "working"
+	StatePaused      = "paused"
+	StateCancelling  = "cancelling"
+)
+
+// Step statuses in a task's steps
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepCompleted = "completed"
+	StepFailed    = "failed"
+	StepCancelled = "cancelled"
+)
+
+// Step events passed to the step listener; a cancelled step fails
+const (
+	EventStepStarted   = "started"
+	EventStepCompleted = "completed"
+	EventStepFailed    = "failed"
+)
+
+// maxTaskHistory bounds the finished tasks ListTasks remembers
+const maxTaskHistory = 100
+
+var (
+	// ErrInvalidCommand is returned for commands without text
+	ErrInvalidCommand = errors.New("invalid command")
+	// ErrAgentBusy is returned when a task is started while another runs
+	ErrAgentBusy = errors.New("agent busy")
+	// ErrInvalidState is returned for transitions the current state doesn't allow
+	ErrInvalidState = errors.New("invalid agent state")
 )
 
 // Controller orchestrates the agent's operations
@@ -25,8 +71,21 @@ type Controller struct {
 	gemma        *GemmaClient
 	planner      *Planner
 	executor     *Executor
+	consolidator *memory.Consolidator
+	budget       models.TaskBudget // every task's, unless its own is lower
 	state        string
 	currentTask  string
+	sessionID    string
+	cancel       context.CancelFunc // cancels the running task
+	span         *tracing.Span      // the running task's root span
+	meter        *llm.Meter         // counts the running task's tokens
+	resumed      chan struct{}      // closed when a paused task resumes
+	tasks        []models.Task      // started since boot, oldest first
+	listener     func(state, taskID string)
+	taskListener func(task models.Task)
+	stepListener func(taskID, event string, step models.TaskStep)
+	termListener func(taskID, output string)
+	pageListener func(taskID, screenshot string, elements []models.BrowserElement)
 	mu           sync.RWMutex
 }
 
@@ -49,7 +108,7 @@ func NewController(
 		mcpClient:    mcpClient,
 		watchdog:     wdog,
 		gemma:        gemma,
-		state:        "idle",
+		state:        StateIdle,
 	}
 
 	c.planner = NewPlanner(c)
@@ -58,106 +117,686 @@ func NewController(
 	return c
 }
 
-// Initialize initializes the agent
+// Initialize initializes the agent, keeping the session ID asked for if any
 func (c *Controller) Initialize(req models.InitializeRequest) (string, error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
-	sessionID := fmt.Sprintf("session_%d", time.Now().Unix())
-	c.state = "initialized"
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = fmt.Sprintf("session_%d", time.Now().Unix())
+	}
 
 	// Initialize browser if needed
 	if err := c.browserMgr.Initialize(); err != nil {
+		c.mu.Unlock()
 		return "", fmt.Errorf("failed to initialize browser: %w", err)
 	}
 
 	// Start watchdog
-	if err := c.watchdog.Start(); err != nil {
-		return "", fmt.Errorf("failed to start watchdog: %w", err)
+	if !c.watchdog.IsRunning() {
+		if err := c.watchdog.Start(); err != nil {
+			c.mu.Unlock()
+			return "", fmt.Errorf("failed to start watchdog: %w", err)
+		}
+	}
+
+	c.sessionID = sessionID
+	if c.state == StateIdle {
+		c.state = StateInitialized
 	}
+	c.mu.Unlock()
+	c.notify()
 
 	return sessionID, nil
 }
 
 // ExecuteCommand executes a user command
 func (c *Controller) ExecuteCommand(req models.CommandRequest) (string, error) {
-	c.mu.Lock()
-	taskID := fmt.Sprintf("task_%d", time.Now().Unix())
-	c.currentTask = taskID
-	c.state = "working"
-	c.mu.Unlock()
+	if req.Resume && req.TaskID != "" {
+		return c.ResumeTask(req.TaskID)
+	}
+
+	if strings.TrimSpace(req.Command) == "" {
+		return "", fmt.Errorf("%w: command is required", ErrInvalidCommand)
+	}
+
+	budget, err := c.taskBudget(req.Budget)
+	if err != nil {
+		return "", err
+	}
+
+	taskID := fmt.Sprintf("task_%d", time.Now().UnixNano())
+	ctx, err := c.start(taskID, req.Command, budget)
+	if err != nil {
+		return "", err
+	}
 
 	// Create task memory
 	taskMem := c.shortTermMem.CreateTask(taskID)
 
 	// Store command in long-term memory
-	ctx := context.Background()
 	if err := c.longTermMem.StoreConversation(ctx, req.Command, ""); err != nil {
-		fmt.Printf("Warning: failed to store conversation: %v\n", err)
+		logging.FromContext(ctx).Warn("failed to store conversation", "error", err)
 	}
 
-	// Plan execution
+	// Plan execution; a task cancelled while planning was still accepted
 	plan, err := c.planner.CreatePlan(ctx, req.Command, taskMem)
 	if err != nil {
-		c.mu.Lock()
-		c.state = "idle"
-		c.mu.Unlock()
+		err = budgetError(ctx, err)
+		c.finish(taskID, err)
+		if ctx.Err() != nil {
+			return taskID, nil
+		}
 		return "", fmt.Errorf("failed to create plan: %w", err)
 	}
 
-	// Execute plan asynchronously
-	go func() {
-		if err := c.executor.ExecutePlan(ctx, plan, taskMem); err != nil {
-			fmt.Printf("Execution error: %v\n", err)
+	// Record the plan so the task can be resumed after a crash
+	planData, err := json.Marshal(plan)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to serialize plan", "error", err)
+	}
+	taskMem.SetPlan(req.Command, planData)
+
+	c.runPlan(ctx, plan, taskMem)
+
+	return taskID, nil
+}
+
+// ResumeTask continues an interrupted task from its last completed step
+func (c *Controller) ResumeTask(taskID string) (string, error) {
+	taskMem, err := c.shortTermMem.GetTask(taskID)
+	if err != nil {
+		return "", err
+	}
+
+	if status := taskMem.GetStatus(); status != memory.TaskStatusInterrupted {
+		return "", fmt.Errorf("%w: task %s is %s, not interrupted", ErrInvalidState, taskID, status)
+	}
+
+	goal, planData, _ := taskMem.GetPlan()
+	if len(planData) == 0 {
+		return "", fmt.Errorf("%w: task %s has no recorded plan", ErrInvalidState, taskID)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(planData, &plan); err != nil {
+		return "", fmt.Errorf("failed to decode plan: %w", err)
+	}
+
+	c.mu.RLock()
+	budget := c.budget
+	c.mu.RUnlock()
+
+	ctx, err := c.start(taskID, goal, budget)
+	if err != nil {
+		return "", err
+	}
+	c.runPlan(ctx, &plan, taskMem)
+
+	return taskID, nil
+}
+
+// ListTasks returns the tasks started since boot, newest first, followed by
+// tasks a restart interrupted that haven't been resumed. Tasks can be
+// filtered by status and type.
+func (c *Controller) ListTasks(filter models.TaskListRequest) []models.Task {
+	c.mu.RLock()
+	all := make([]models.Task, 0, len(c.tasks))
+	seen := make(map[string]bool, len(c.tasks))
+	for i := len(c.tasks) - 1; i >= 0; i-- {
+		all = append(all, c.withUsage(cloneTask(c.tasks[i])))
+		seen[c.tasks[i].ID] = true
+	}
+	c.mu.RUnlock()
+
+	for _, task := range c.ListResumableTasks() {
+		if !seen[task.ID] {
+			all = append(all, task)
 		}
+	}
 
-		c.mu.Lock()
-		c.state = "idle"
+	tasks := make([]models.Task, 0, len(all))
+	for _, task := range all {
+		if (filter.Status != "" && task.Status != filter.Status) || (filter.Type != "" && task.Type != filter.Type) {
+			continue
+		}
+		if filter.Limit > 0 && len(tasks) >= filter.Limit {
+			break
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// GetTask returns a task started since boot, or one a restart interrupted
+func (c *Controller) GetTask(taskID string) (*models.Task, error) {
+	c.mu.RLock()
+	if task := c.task(taskID); task != nil {
+		found := c.withUsage(cloneTask(*task))
+		c.mu.RUnlock()
+		return &found, nil
+	}
+	c.mu.RUnlock()
+
+	for _, task := range c.ListResumableTasks() {
+		if task.ID == taskID {
+			return &task, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", memory.ErrTaskNotFound, taskID)
+}
+
+// ListResumableTasks returns tasks interrupted mid-execution by a restart
+func (c *Controller) ListResumableTasks() []models.Task {
+	tasks := make([]models.Task, 0)
+
+	for _, id := range c.shortTermMem.InterruptedTasks() {
+		taskMem, err := c.shortTermMem.GetTask(id)
+		if err != nil {
+			continue
+		}
+
+		goal, planData, completed := taskMem.GetPlan()
+		steps := make([]models.TaskStep, 0)
+		var plan Plan
+		if json.Unmarshal(planData, &plan) == nil {
+			steps = planSteps(&plan, completed)
+		}
+		tasks = append(tasks, models.Task{
+			ID:        id,
+			Type:      "command",
+			Status:    memory.TaskStatusInterrupted,
+			Goal:      goal,
+			Steps:     steps,
+			CreatedAt: taskMem.CreatedAt,
+			Resume:    true,
+		})
+	}
+
+	return tasks
+}
+
+// SetStateListener registers a function called after each state change,
+// e.g. to broadcast it to clients
+func (c *Controller) SetStateListener(listener func(state, taskID string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.listener = listener
+}
+
+// SetTaskListener registers a function called with each task once it
+// completes, fails or is cancelled, e.g. to notify webhooks
+func (c *Controller) SetTaskListener(listener func(task models.Task)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.taskListener = listener
+}
+
+// SetStepListener registers a function called when a step starts, completes
+// or fails, e.g. to stream a task's progress to clients
+func (c *Controller) SetStepListener(listener func(taskID, event string, step models.TaskStep)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stepListener = listener
+}
+
+// SetTerminalListener registers a function called with the output of each
+// terminal step, e.g. to stream it to the clients viewing the task
+func (c *Controller) SetTerminalListener(listener func(taskID, output string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.termListener = listener
+}
+
+// SetBrowserListener registers a function called with the page each
+// browser step saw, as a base64 PNG, and the elements found on it
+func (c *Controller) SetBrowserListener(listener func(taskID, screenshot string, elements []models.BrowserElement)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pageListener = listener
+}
+
+// SetConsolidator enables promoting finished tasks to long-term memory on completion
+func (c *Controller) SetConsolidator(consolidator *memory.Consolidator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.consolidator = consolidator
+}
+
+// SetBudget sets the tokens and time every task may use; a task may ask
+// for less
+func (c *Controller) SetBudget(budget models.TaskBudget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = budget
+}
+
+// BudgetFromEnv reads AGENT_TASK_MAX_TOKENS and AGENT_TASK_MAX_SECONDS,
+// the budget of every task; unset or 0 is no limit
+func BudgetFromEnv() (models.TaskBudget, error) {
+	var budget models.TaskBudget
+	for env, limit := range map[string]*int{
+		"AGENT_TASK_MAX_TOKENS":  &budget.MaxTokens,
+		"AGENT_TASK_MAX_SECONDS": &budget.MaxSeconds,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return models.TaskBudget{}, fmt.Errorf("invalid %s %q, expected a number, 0 for no limit", env, value)
+		}
+		*limit = parsed
+	}
+	return budget, nil
+}
+
+// taskBudget combines the budget a task asked for with the server's,
+// keeping the lower of each limit
+func (c *Controller) taskBudget(requested *models.TaskBudget) (models.TaskBudget, error) {
+	c.mu.RLock()
+	budget := c.budget
+	c.mu.RUnlock()
+
+	if requested == nil {
+		return budget, nil
+	}
+	if requested.MaxTokens < 0 || requested.MaxSeconds < 0 {
+		return budget, fmt.Errorf("%w: budget limits can't be negative", ErrInvalidCommand)
+	}
+	lower := func(limit, asked int) int {
+		if asked > 0 && (limit == 0 || asked < limit) {
+			return asked
+		}
+		return limit
+	}
+	budget.MaxTokens = lower(budget.MaxTokens, requested.MaxTokens)
+	budget.MaxSeconds = lower(budget.MaxSeconds, requested.MaxSeconds)
+	return budget, nil
+}
+
+// budgetError returns why a task's context ended in place of err when the
+// task ran out of budget and err doesn't say so
+func budgetError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, llm.ErrBudgetExceeded) {
+		return err
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, llm.ErrBudgetExceeded) {
+		return cause
+	}
+	return err
+}
+
+// start makes a task the running one, returning the context that cancels
+// it. The context is also cancelled once the task runs out of budget.
+func (c *Controller) start(taskID, goal string, budget models.TaskBudget) (context.Context, error) {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w with task %s", ErrAgentBusy, c.currentTask)
+	}
+
+	// The task ID correlates the task's memory, terminal and log records,
+	// and its trace ties together the plan, steps and tool calls
+	ctx, cancel := context.WithCancel(memory.WithCaller(logging.WithRequestID(context.Background(), taskID), "agent"))
+	ctx, span := tracing.Start(ctx, "agent.task", "task.id", taskID, "task.goal", goal)
+	if span != nil {
+		ctx = logging.With(ctx, "trace_id", span.TraceID())
+	}
+	ctx, meter := llm.WithMeter(ctx, taskID, budget.MaxTokens)
+	if budget.MaxSeconds > 0 {
+		limit := time.Duration(budget.MaxSeconds) * time.Second
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeoutCause(ctx, limit, fmt.Errorf("%w: ran for %s", llm.ErrBudgetExceeded, limit))
+		cancelTask := cancel
+		cancel = func() {
+			stop()
+			cancelTask()
+		}
+	}
+	c.cancel = cancel
+	c.span = span
+	c.meter = meter
+	c.currentTask = taskID
+	c.state = StateWorking
+
+	// A resumed task replaces its earlier entry
+	for i, task := range c.tasks {
+		if task.ID == taskID {
+			c.tasks = append(c.tasks[:i], c.tasks[i+1:]...)
+			break
+		}
+	}
+	task := models.Task{
+		ID:        taskID,
+		Type:      "command",
+		Status:    memory.TaskStatusRunning,
+		Goal:      goal,
+		Steps:     make([]models.TaskStep, 0),
+		CreatedAt: time.Now().UTC(),
+		TraceID:   span.TraceID(),
+	}
+	if budget != (models.TaskBudget{}) {
+		task.Budget = &budget
+	}
+	c.tasks = append(c.tasks, task)
+	if len(c.tasks) > maxTaskHistory {
+		c.tasks = c.tasks[len(c.tasks)-maxTaskHistory:]
+	}
+	c.mu.Unlock()
+	c.notify()
+
+	logging.FromContext(ctx).Info("task started", "goal", goal)
+	return ctx, nil
+}
+
+// finish records how the running task ended and returns the agent to idle
+func (c *Controller) finish(taskID string, err error) {
+	c.mu.Lock()
+	var finished *models.Task
+	status := memory.TaskStatusCompleted
+	switch {
+	case errors.Is(err, context.Canceled):
+		status = memory.TaskStatusCancelled
+	case err != nil:
+		status = memory.TaskStatusFailed
+	}
+	if task := c.task(taskID); task != nil {
+		completed := time.Now().UTC()
+		task.Status = status
+		task.CompletedAt = &completed
+		if status == memory.TaskStatusFailed {
+			task.Error = err.Error()
+		}
+		if c.currentTask == taskID {
+			usage := c.meter.Usage()
+			task.Usage = &usage
+		}
+		copied := *task
+		copied.Steps = append([]models.TaskStep(nil), task.Steps...)
+		finished = &copied
+	}
+
+	if c.currentTask == taskID {
+		c.span.SetAttributes("task.status", status)
+		if status == memory.TaskStatusFailed {
+			c.span.RecordError(err)
+		}
+		c.span.End()
+		c.span = nil
+		c.meter = nil
+		c.cancel()
+		c.cancel = nil
+		c.resumed = nil
 		c.currentTask = ""
+		c.state = StateIdle
+	}
+	listener := c.taskListener
+	c.mu.Unlock()
+	c.notify()
+
+	if listener != nil && finished != nil {
+		listener(*finished)
+	}
+}
+
+// task finds a task started since boot; callers must hold c.mu
+func (c *Controller) task(taskID string) *models.Task {
+	for i := range c.tasks {
+		if c.tasks[i].ID == taskID {
+			return &c.tasks[i]
+		}
+	}
+	return nil
+}
+
+// setSteps lists a plan's steps on its task, the first completed of them done
+func (c *Controller) setSteps(taskID string, plan *Plan, completed int) {
+	steps := planSteps(plan, completed)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if task := c.task(taskID); task != nil {
+		task.Steps = steps
+	}
+}
+
+// updateStep records a step's new status and passes it to the step listener
+func (c *Controller) updateStep(taskID string, index int, status string, err error) {
+	c.mu.Lock()
+	task := c.task(taskID)
+	if task == nil || index < 0 || index >= len(task.Steps) {
 		c.mu.Unlock()
+		return
+	}
+
+	step := &task.Steps[index]
+	now := time.Now().UTC()
+	step.Status = status
+	event := EventStepCompleted
+	switch status {
+	case StepRunning:
+		event = EventStepStarted
+		step.StartedAt = now
+	case StepFailed, StepCancelled:
+		event = EventStepFailed
+		step.Result = map[string]interface{}{"error": err.Error()}
+	}
+	if status != StepRunning {
+		step.CompletedAt = &now
+	}
+	updated, listener := *step, c.stepListener
+	c.mu.Unlock()
+
+	if listener != nil {
+		listener(taskID, event, updated)
+	}
+}
+
+// terminalOutput passes a terminal step's output to the terminal listener
+func (c *Controller) terminalOutput(taskID, output string) {
+	c.mu.RLock()
+	listener := c.termListener
+	c.mu.RUnlock()
+
+	if listener != nil {
+		listener(taskID, output)
+	}
+}
+
+// browserUpdate passes the page a browser step saw to the browser listener
+func (c *Controller) browserUpdate(taskID string, screenshot []byte) {
+	c.mu.RLock()
+	listener := c.pageListener
+	c.mu.RUnlock()
+
+	if listener != nil {
+		listener(taskID, base64.StdEncoding.EncodeToString(screenshot), c.browserMgr.GetElements())
+	}
+}
+
+// planSteps describes a plan's steps, the first completed of them done
+func planSteps(plan *Plan, completed int) []models.TaskStep {
+	steps := make([]models.TaskStep, len(plan.Steps))
+	for i, step := range plan.Steps {
+		steps[i] = models.TaskStep{
+			ID:          strconv.Itoa(step.ID),
+			Description: step.Description,
+			Type:        step.Tool,
+			Status:      StepPending,
+		}
+		if i < completed {
+			steps[i].Status = StepCompleted
+		}
+	}
+	return steps
+}
+
+// withUsage fills in the running task's token usage so far; callers must
+// hold c.mu
+func (c *Controller) withUsage(task models.Task) models.Task {
+	if task.ID == c.currentTask && c.meter != nil {
+		usage := c.meter.Usage()
+		task.Usage = &usage
+	}
+	return task
+}
+
+// cloneTask copies a task so it can be read while its steps change
+func cloneTask(task models.Task) models.Task {
+	task.Steps = append(make([]models.TaskStep, 0, len(task.Steps)), task.Steps...)
+	return task
+}
+
+// notify passes the current state to the state listener
+func (c *Controller) notify() {
+	c.mu.RLock()
+	listener, state, taskID := c.listener, c.state, c.currentTask
+	c.mu.RUnlock()
+
+	if listener != nil {
+		listener(state, taskID)
+	}
+}
+
+// waitWhilePaused blocks until a paused task is resumed or cancelled
+func (c *Controller) waitWhilePaused(ctx context.Context) error {
+	c.mu.RLock()
+	resumed := c.resumed
+	c.mu.RUnlock()
+
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+// runPlan executes a plan asynchronously and returns the agent to idle when done
+func (c *Controller) runPlan(ctx context.Context, plan *Plan, taskMem *memory.TaskMemory) {
+	go func() {
+		err := budgetError(ctx, c.executor.ExecutePlan(ctx, plan, taskMem))
+		logger := logging.FromContext(ctx)
+		switch {
+		case errors.Is(err, context.Canceled):
+			logger.Info("task cancelled")
+		case err != nil:
+			logger.Error("task failed", "error", err)
+		default:
+			logger.Info("task completed", "steps", len(plan.Steps))
+		}
+
+		c.mu.RLock()
+		consolidator := c.consolidator
+		c.mu.RUnlock()
+
+		// Failed and cancelled tasks are consolidated too; their lessons are
+		// often the most useful
+		if consolidator != nil {
+			if _, err := consolidator.ConsolidateTask(context.WithoutCancel(ctx), taskMem); err != nil {
+				logging.FromContext(ctx).Warn("failed to consolidate task", "error", err)
+			}
+		}
+
+		c.finish(taskMem.TaskID, err)
 	}()
+}
 
-	return taskID, nil
+// Status is the agent's state and the task it's working on
+type Status struct {
+	State       string `json:"state"`
+	CurrentTask string `json:"current_task"`
+	SessionID   string `json:"session_id"`
+	Timestamp   string `json:"timestamp"`
 }
 
 // GetStatus returns the agent's current status
-func (c *Controller) GetStatus() interface{} {
+func (c *Controller) GetStatus() Status {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	return map[string]interface{}{
-		"state":        c.state,
-		"current_task": c.currentTask,
-		"timestamp":    time.Now().Format(time.RFC3339),
+	return Status{
+		State:       c.state,
+		CurrentTask: c.currentTask,
+		SessionID:   c.sessionID,
+		Timestamp:   time.Now().Format(time.RFC3339),
 	}
 }
 
-// Pause pauses the agent
+// Pause pauses the running task before its next step
 func (c *Controller) Pause() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.state != "working" {
-		return fmt.Errorf("agent not working")
+	if c.state != StateWorking {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: agent not working", ErrInvalidState)
 	}
 
-	c.state = "paused"
+	c.state = StatePaused
+	c.resumed = make(chan struct{})
+	c.mu.Unlock()
+	c.notify()
 	return nil
 }
 
 // Resume resumes the agent
 func (c *Controller) Resume() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.state != "paused" {
-		return fmt.Errorf("agent not paused")
+	if c.state != StatePaused {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: agent not paused", ErrInvalidState)
 	}
 
-	c.state = "working"
+	c.state = StateWorking
+	close(c.resumed)
+	c.resumed = nil
+	c.mu.Unlock()
+	c.notify()
 	return nil
 }
 
+// Cancel stops the running or paused task, returning its ID. The agent
+// reports cancelling until the step in progress returns.
+func (c *Controller) Cancel() (string, error) {
+	return c.CancelTask("")
+}
+
+// CancelTask cancels a task by ID, or the running one for ""; only the
+// running or paused task can be cancelled
+func (c *Controller) CancelTask(taskID string) (string, error) {
+	c.mu.Lock()
+	if taskID != "" && taskID != c.currentTask {
+		known := c.task(taskID) != nil
+		c.mu.Unlock()
+		if !known {
+			if _, err := c.GetTask(taskID); err != nil {
+				return "", err
+			}
+		}
+		return "", fmt.Errorf("%w: task %s isn't running", ErrInvalidState, taskID)
+	}
+	if c.cancel == nil || c.state == StateCancelling {
+		c.mu.Unlock()
+		return "", fmt.Errorf("%w: no task to cancel", ErrInvalidState)
+	}
+
+	taskID = c.currentTask
+	c.cancel()
+	c.state = StateCancelling
+	c.mu.Unlock()
+	c.notify()
+	return taskID, nil
+}
+
 // GetFileTree returns the file tree
 func (c *Controller) GetFileTree(path string) (interface{}, error) {
 	// TODO: Implement file tree retrieval
@@ -204,7 +843,7 @@ func (c *Controller) SearchFiles(query string) (interface{}, error) {
 
 // QueryMemory queries the knowledge graph
 func (c *Controller) QueryMemory(req models.MemoryQueryRequest) (interface{}, error) {
-	ctx := context.Background()
+	ctx := memory.WithCaller(context.Background(), "agent")
 	result, err := c.longTermMem.Query(ctx, req.Query)
 	if err != nil {
 		return nil, err
@@ -218,7 +857,7 @@ func (c *Controller) QueryMemory(req models.MemoryQueryRequest) (interface{}, er
 
 // StoreMemory stores content in memory
 func (c *Controller) StoreMemory(req models.MemoryStoreRequest) (interface{}, error) {
-	ctx := context.Background()
+	ctx := memory.WithCaller(context.Background(), "agent")
 	if err := c.longTermMem.Store(ctx, req.Content, req.Metadata); err != nil {
 		return nil, err
 	}
@@ -230,7 +869,7 @@ func (c *Controller) StoreMemory(req models.MemoryStoreRequest) (interface{}, er
 
 // GetMemoryContext retrieves memory context
 func (c *Controller) GetMemoryContext(query string, maxTokens int) (interface{}, error) {
-	ctx := context.Background()
+	ctx := memory.WithCaller(context.Background(), "agent")
 	context, err := c.longTermMem.GetContext(ctx, query, maxTokens)
 	if err != nil {
 		return nil, err
@@ -244,8 +883,8 @@ func (c *Controller) GetMemoryContext(query string, maxTokens int) (interface{},
 
 // VectorSearch performs vector search
 func (c *Controller) VectorSearch(req models.VectorSearchRequest) (interface{}, error) {
-	ctx := context.Background()
-	results, err := c.longTermMem.VectorSearch(ctx, req.Query, req.TopK)
+	ctx := memory.WithCaller(context.Background(), "agent")
+	results, err := c.longTermMem.VectorSearch(ctx, req.Query, memory.MemoryFilter{}, req.TopK, req.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -268,9 +907,13 @@ func (c *Controller) SubmitProposal(req models.ProposalRequest) (interface{}, er
 		return nil, err
 	}
 
+	status := watchdog.ProposalReview
+	if req.Draft {
+		status = watchdog.ProposalDraft
+	}
 	return map[string]interface{}{
 		"proposal_id": id,
-		"status":      "pending",
+		"status":      status,
 	}, nil
 }
 
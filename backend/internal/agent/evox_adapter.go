@@ -4,37 +4,33 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 
-	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/llm"
 	"agent-workspace/backend/pkg/ollama"
 )
 
 // EvoXAdapter wraps Gemma 3 to be compatible with EvoAgentX framework
 // EvoAgentX expects LLMs to implement: generate(), generate_async(), and structured output parsing
-// This adapter provides the bridge between our Ollama-based Gemma client and EvoX expectations
+// This adapter provides the bridge between our Gemma client and EvoX expectations
 type EvoXAdapter struct {
-	gemma  *GemmaClient
-	ollama *ollama.Client
+	gemma    *GemmaClient
+	provider llm.Provider
 }
 
 // NewEvoXAdapter creates a new EvoX-compatible adapter
-func NewEvoXAdapter(gemma *GemmaClient, ollama *ollama.Client) *EvoXAdapter {
+func NewEvoXAdapter(gemma *GemmaClient, provider llm.Provider) *EvoXAdapter {
 	return &EvoXAdapter{
-		gemma:  gemma,
-		ollama: ollama,
+		gemma:    gemma,
+		provider: provider,
 	}
 }
 
 // Generate provides synchronous generation compatible with EvoAgentX
 // EvoAgentX calls this with: generate(prompt, temperature, max_tokens, stop_sequences)
 func (e *EvoXAdapter) Generate(ctx context.Context, prompt string, temperature float64, maxTokens int) (string, error) {
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
 
 	return e.gemma.GenerateResponse(ctx, messages, temperature)
@@ -43,43 +39,33 @@ func (e *EvoXAdapter) Generate(ctx context.Context, prompt string, temperature f
 // GenerateStream provides streaming generation compatible with EvoAgentX
 // EvoAgentX uses this for real-time output during agent execution
 func (e *EvoXAdapter) GenerateStream(ctx context.Context, prompt string, temperature float64, callback func(string) error) error {
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
 
 	return e.gemma.GenerateResponseStream(ctx, messages, temperature, callback)
 }
 
 // GenerateStructured generates structured output (JSON) compatible with EvoAgentX
-// EvoAgentX uses this for workflow generation, action parsing, and evaluation
+// EvoAgentX uses this for workflow generation, action parsing, and evaluation.
+// The reply must match the JSON Schema of schema's type; it is requested in
+// JSON mode, repaired and retried (see llm.GenerateJSON).
 func (e *EvoXAdapter) GenerateStructured(ctx context.Context, prompt string, schema interface{}, temperature float64) (interface{}, error) {
-	// Add JSON schema instruction to prompt
-	schemaJSON, err := json.Marshal(schema)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
+	ctx, span := e.gemma.startSpan(ctx, messages, temperature)
+	defer span.End()
 
-	structuredPrompt := fmt.Sprintf(`%s
-
-IMPORTANT: Respond with valid JSON matching this schema:
-%s
-
-Return ONLY the JSON, no additional text.`, prompt, string(schemaJSON))
-
-	// Generate response
-	response, err := e.Generate(ctx, structuredPrompt, temperature, 0)
+	response, err := llm.GenerateJSON(ctx, e.provider, messages, llm.SchemaOf(reflect.TypeOf(schema)), temperature)
 	if err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
 
 	// Parse JSON response
 	var result interface{}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
+	if err := json.Unmarshal(response, &result); err != nil {
 		return nil, fmt.Errorf("failed to parse structured response: %w", err)
 	}
 
@@ -102,7 +88,7 @@ type EvoXWorkflowResponse struct {
 // EvoXNode represents an agent node in the workflow
 type EvoXNode struct {
 	ID          string                 `json:"id"`
-	Type        string                 `json:"type"` // "agent", "tool", "evaluator"
+	Type        string                 `json:"type" enum:"agent|tool|evaluator"`
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Config      map[string]interface{} `json:"config"`
@@ -112,7 +98,7 @@ type EvoXNode struct {
 type EvoXEdge struct {
 	From string `json:"from"`
 	To   string `json:"to"`
-	Type string `json:"type"` // "sequential", "conditional", "parallel"
+	Type string `json:"type" enum:"sequential|conditional|parallel"`
 }
 
 // GenerateWorkflow generates an EvoAgentX-compatible workflow
@@ -129,37 +115,11 @@ Create a workflow with nodes (agents/tools) and edges (connections).
 Each node should have a clear purpose and configuration.
 Return the workflow as JSON.`, request.Goal, request.Tools, request.Constraints)
 
-	schema := EvoXWorkflowResponse{
-		Nodes: []EvoXNode{
-			{
-				ID:          "example",
-				Type:        "agent",
-				Name:        "Example Agent",
-				Description: "Description of what this agent does",
-				Config:      map[string]interface{}{"key": "value"},
-			},
-		},
-		Edges: []EvoXEdge{
-			{From: "node1", To: "node2", Type: "sequential"},
-		},
-	}
-
-	result, err := e.GenerateStructured(ctx, prompt, schema, 0.7)
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert result to workflow response
-	workflowJSON, err := json.Marshal(result)
+	workflow, err := generateStructured[EvoXWorkflowResponse](ctx, e.gemma, prompt, 0.7)
 	if err != nil {
 		return nil, err
 	}
 
-	var workflow EvoXWorkflowResponse
-	if err := json.Unmarshal(workflowJSON, &workflow); err != nil {
-		return nil, err
-	}
-
 	return &workflow, nil
 }
 
@@ -196,28 +156,11 @@ What should the agent do next? Consider:
 Return the action as JSON with type, command, parameters, and reasoning.`, 
 		request.Observation, request.Goal, request.History)
 
-	schema := EvoXAction{
-		Type:       "browser",
-		Command:    "navigate",
-		Parameters: map[string]interface{}{"url": "https://example.com"},
-		Reasoning:  "Explanation of why this action is chosen",
-	}
-
-	result, err := e.GenerateStructured(ctx, prompt, schema, 0.5)
-	if err != nil {
-		return nil, err
-	}
-
-	actionJSON, err := json.Marshal(result)
+	action, err := generateStructured[EvoXAction](ctx, e.gemma, prompt, 0.5)
 	if err != nil {
 		return nil, err
 	}
 
-	var action EvoXAction
-	if err := json.Unmarshal(actionJSON, &action); err != nil {
-		return nil, err
-	}
-
 	return &action, nil
 }
 
@@ -255,29 +198,11 @@ Provide:
 
 Return as JSON.`, request.Task, request.Goal, request.Result)
 
-	schema := EvoXEvaluation{
-		Score:       0.8,
-		Feedback:    "Detailed evaluation feedback",
-		Strengths:   []string{"Strength 1", "Strength 2"},
-		Weaknesses:  []string{"Weakness 1"},
-		Suggestions: []string{"Suggestion 1", "Suggestion 2"},
-	}
-
-	result, err := e.GenerateStructured(ctx, prompt, schema, 0.3)
-	if err != nil {
-		return nil, err
-	}
-
-	evalJSON, err := json.Marshal(result)
+	evaluation, err := generateStructured[EvoXEvaluation](ctx, e.gemma, prompt, 0.3)
 	if err != nil {
 		return nil, err
 	}
 
-	var evaluation EvoXEvaluation
-	if err := json.Unmarshal(evalJSON, &evaluation); err != nil {
-		return nil, err
-	}
-
 	return &evaluation, nil
 }
 
@@ -311,7 +236,7 @@ func (e *EvoXAdapter) SupportsStructuredOutput() bool {
 
 // GetEvoXAdapter returns an EvoX-compatible adapter
 func (c *Controller) GetEvoXAdapter() *EvoXAdapter {
-	return NewEvoXAdapter(c.gemma, c.ollama)
+	return NewEvoXAdapter(c.gemma, c.gemma.provider)
 }
 
 // Example usage in your agent system:
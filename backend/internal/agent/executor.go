@@ -2,9 +2,17 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/internal/terminal"
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/tracing"
 )
 
 // Executor executes plans
@@ -19,13 +27,46 @@ func NewExecutor(controller *Controller) *Executor {
 	}
 }
 
-// ExecutePlan executes a plan
+// ExecutePlan executes a plan, skipping steps already completed before an interruption
 func (e *Executor) ExecutePlan(ctx context.Context, plan *Plan, taskMem *memory.TaskMemory) error {
-	// Execute each step
-	for _, step := range plan.Steps {
-		if err := e.ExecuteStep(ctx, step, taskMem); err != nil {
+	taskMem.SetStatus(memory.TaskStatusRunning)
+	_, _, completed := taskMem.GetPlan()
+	e.controller.setSteps(taskMem.TaskID, plan, completed)
+
+	// The planner may publish a revised plan to the task context mid-run
+	updates, unsubscribe := taskMem.SubscribeContext("plan")
+	defer unsubscribe()
+
+	// Execute each step, waiting between steps while paused
+	for i := completed; i < len(plan.Steps); i++ {
+		if err := e.controller.waitWhilePaused(ctx); err != nil {
+			taskMem.SetStatus(memory.TaskStatusCancelled)
+			return err
+		}
+		if revised := revisedPlan(updates, plan); revised != nil {
+			e.adoptPlan(ctx, revised, taskMem)
+			plan, i = revised, -1 // restart at the revision's first step
+			continue
+		}
+		step := plan.Steps[i]
+
+		e.controller.updateStep(taskMem.TaskID, i, StepRunning, nil)
+		if err := e.tracedStep(ctx, i, step, taskMem); err != nil {
 			// Store failure
 			taskMem.AddAction(step.Tool, step.Action, step.Parameters, nil, false, err.Error())
+			if cause := context.Cause(ctx); errors.Is(cause, llm.ErrBudgetExceeded) {
+				// Out of budget: the step failed, with none left to reflect on it
+				e.controller.updateStep(taskMem.TaskID, i, StepFailed, cause)
+				taskMem.SetStatus(memory.TaskStatusFailed)
+				return fmt.Errorf("step %d failed: %w", step.ID, cause)
+			}
+			if ctx.Err() != nil {
+				e.controller.updateStep(taskMem.TaskID, i, StepCancelled, ctx.Err())
+				taskMem.SetStatus(memory.TaskStatusCancelled)
+				return fmt.Errorf("step %d cancelled: %w", step.ID, ctx.Err())
+			}
+			e.controller.updateStep(taskMem.TaskID, i, StepFailed, err)
+			taskMem.SetStatus(memory.TaskStatusFailed)
 
 			// Generate reflection on failure
 			reflection, _ := e.controller.gemma.GenerateReflection(ctx, step.Description, err.Error(), false)
@@ -36,18 +77,65 @@ func (e *Executor) ExecutePlan(ctx context.Context, plan *Plan, taskMem *memory.
 
 		// Store success
 		taskMem.AddAction(step.Tool, step.Action, step.Parameters, "success", true, "")
+		taskMem.MarkStepCompleted()
+		e.controller.updateStep(taskMem.TaskID, i, StepCompleted, nil)
 	}
+	taskMem.SetStatus(memory.TaskStatusCompleted)
 
 	// Generate final reflection
 	reflection, _ := e.controller.gemma.GenerateReflection(ctx, plan.Goal, "Plan completed successfully", true)
 	taskMem.AddReflection(plan.ID, reflection, []string{}, []string{})
 
 	// Store in long-term memory
-	e.controller.longTermMem.StoreAction(ctx, plan.Goal, "Completed successfully", true)
+	e.controller.longTermMem.StoreAction(memory.WithCaller(ctx, "executor"), plan.Goal, "Completed successfully", true)
 
 	return nil
 }
 
+// revisedPlan returns the newest plan published since the last check, or nil
+// if the plan is unchanged
+func revisedPlan(updates <-chan memory.ContextChange, current *Plan) *Plan {
+	var revised *Plan
+	for {
+		select {
+		case change, ok := <-updates:
+			if !ok {
+				return revised
+			}
+			if plan, isPlan := change.Value.(*Plan); isPlan && plan != nil && plan.ID != current.ID {
+				revised = plan
+			}
+		default:
+			return revised
+		}
+	}
+}
+
+// adoptPlan switches execution to a revised plan, recording it so a resume
+// continues the revision rather than the original
+func (e *Executor) adoptPlan(ctx context.Context, plan *Plan, taskMem *memory.TaskMemory) {
+	logger := logging.FromContext(ctx)
+	logger.Info("switching to revised plan", "plan_id", plan.ID, "steps", len(plan.Steps))
+
+	planData, err := json.Marshal(plan)
+	if err != nil {
+		logger.Warn("failed to serialize plan", "error", err)
+	}
+	taskMem.SetPlan(plan.Goal, planData)
+	e.controller.setSteps(taskMem.TaskID, plan, 0)
+}
+
+// tracedStep executes a step in a span of its own
+func (e *Executor) tracedStep(ctx context.Context, index int, step Step, taskMem *memory.TaskMemory) error {
+	ctx, span := tracing.Start(ctx, "agent.step",
+		"step.id", step.ID, "step.index", index, "step.tool", step.Tool, "step.action", step.Action)
+	defer span.End()
+
+	err := e.ExecuteStep(ctx, step, taskMem)
+	span.RecordError(err)
+	return err
+}
+
 // ExecuteStep executes a single step
 func (e *Executor) ExecuteStep(ctx context.Context, step Step, taskMem *memory.TaskMemory) error {
 	switch step.Tool {
@@ -65,27 +153,38 @@ func (e *Executor) ExecuteStep(ctx context.Context, step Step, taskMem *memory.T
 // executeBrowserStep executes a browser step
 func (e *Executor) executeBrowserStep(ctx context.Context, step Step, taskMem *memory.TaskMemory) error {
 	action := step.Action
+	e.controller.browserMgr.SetTask(taskMem.TaskID)
 
 	// Capture screenshot
+	_, span := tracing.Start(ctx, "browser.screenshot")
 	screenshot, err := e.controller.browserMgr.CaptureScreenshot(taskMem.TaskID)
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		return fmt.Errorf("failed to capture screenshot: %w", err)
 	}
 
 	// Detect elements
+	_, span = tracing.Start(ctx, "browser.analyze")
 	elements, err := e.controller.browserMgr.AnalyzeScreenshot(models.VisionAnalyzeRequest{
 		TaskID:     taskMem.TaskID,
 		Goal:       step.Description,
 		Screenshot: screenshot,
 	})
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		return fmt.Errorf("failed to analyze screenshot: %w", err)
 	}
 
+	e.controller.browserUpdate(taskMem.TaskID, screenshot)
+
 	// Store screenshot
-	taskMem.AddScreenshot(screenshot, []interface{}{elements}, map[string]interface{}{
+	if _, err := taskMem.AddScreenshot(screenshot, []interface{}{elements}, map[string]interface{}{
 		"step": step.ID,
-	})
+	}); err != nil {
+		logging.FromContext(ctx).Warn("failed to store screenshot", "step", step.ID, "error", err)
+	}
 
 	// Determine action using Gemma
 	elementStrs := make([]string, 0)
@@ -99,17 +198,24 @@ func (e *Executor) executeBrowserStep(ctx context.Context, step Step, taskMem *m
 		}
 	}
 
-	actionPlan, err := e.controller.gemma.AnalyzeScreenshot(ctx, elementStrs, step.Description)
+	actionPlan, err := e.controller.gemma.AnalyzeScreenshot(ctx, screenshot, elementStrs, step.Description)
 	if err != nil {
 		return fmt.Errorf("failed to analyze screenshot: %w", err)
 	}
 
 	// Parse and execute action
 	// TODO: Parse actionPlan and execute specific browser actions
-	// For now, just navigate if URL is in action
-	if contains(action, "http") {
-		url := extractURL(action)
-		if err := e.controller.browserMgr.Navigate(url); err != nil {
+	// For now, navigate to a URL named in the step, or else in the model's plan
+	url := extractURL(action)
+	if url == "" {
+		url = extractURL(actionPlan)
+	}
+	if url != "" {
+		_, span := tracing.Start(ctx, "browser.navigate", "url", url)
+		err := e.controller.browserMgr.Navigate(url)
+		span.RecordError(err)
+		span.End()
+		if err != nil {
 			return fmt.Errorf("failed to navigate: %w", err)
 		}
 	}
@@ -119,31 +225,44 @@ func (e *Executor) executeBrowserStep(ctx context.Context, step Step, taskMem *m
 
 // executeTerminalStep executes a terminal step
 func (e *Executor) executeTerminalStep(ctx context.Context, step Step, taskMem *memory.TaskMemory) error {
-	// Execute command
-	output, err := e.controller.terminalMgr.ExecuteWithContext(ctx, step.Action)
+	// Execute command, recording it in the terminal history as AI-sourced
+	entry, err := terminal.NewExecutor(e.controller.terminalMgr).ExecuteInSessionWithContext(ctx, "default", step.Action, "ai")
 	if err != nil {
 		return fmt.Errorf("command failed: %w", err)
 	}
+	output := entry.Output
+	e.controller.terminalOutput(taskMem.TaskID, output)
 
 	// Store output
 	taskMem.AddAction("terminal", step.Action, step.Parameters, output, true, "")
 
 	// Store in long-term memory
-	e.controller.longTermMem.StoreAction(ctx, step.Action, output, true)
+	e.controller.longTermMem.StoreAction(memory.WithCaller(ctx, "executor"), step.Action, output, true)
 
 	return nil
 }
 
 // executeMCPStep executes an MCP step
 func (e *Executor) executeMCPStep(ctx context.Context, step Step, taskMem *memory.TaskMemory) error {
-	// Parse MCP tool call
-	// TODO: Parse step.Action to extract server, tool, and args
+	// Steps laid out through tool calls name the server and tool
 	server := "dynamic-thinking"
 	tool := "perceive"
 	args := step.Parameters
+	if name, ok := step.Parameters["server"].(string); ok && name != "" {
+		server = name
+		tool = step.Action
+		if name, ok := step.Parameters["tool"].(string); ok && name != "" {
+			tool = name
+		}
+		args, _ = step.Parameters["arguments"].(map[string]interface{})
+	}
 
 	// Call MCP tool
+	_, span := tracing.Start(ctx, "mcp.call", "mcp.server", server, "mcp.tool", tool)
+	span.SetKind(tracing.KindClient)
 	result, err := e.controller.mcpClient.CallTool(server, tool, args)
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		return fmt.Errorf("MCP tool call failed: %w", err)
 	}
@@ -156,10 +275,6 @@ func (e *Executor) executeMCPStep(ctx context.Context, step Step, taskMem *memor
 
 // Helper functions
 
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && s[:len(substr)] == substr
-}
-
 func extractURL(s string) string {
 	// Simple URL extraction
 	words := strings.Fields(s)
@@ -2,32 +2,110 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
 
-	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
 	"agent-workspace/backend/pkg/ollama"
+	"agent-workspace/backend/pkg/tracing"
 )
 
-// GemmaClient handles communication with Gemma 3 via Ollama
+// GemmaClient handles communication with the planner's model, Gemma 3 via
+// Ollama unless LLM_PLANNER_PROVIDER names another
 type GemmaClient struct {
-	client *ollama.Client
+	provider llm.Provider
+	options  ollama.Options
 }
 
 // NewGemmaClient creates a new Gemma client
 func NewGemmaClient() *GemmaClient {
 	return &GemmaClient{
-		client: ollama.NewClient(),
+		provider: llm.ProviderFor(llm.RolePlanner),
 	}
 }
 
+// WithOptions returns a client whose calls override the provider's
+// generation settings with those options sets, such as a seed for
+// reproducible replies. Structured replies keep the provider's settings,
+// so stop sequences can't cut their JSON short.
+func (g *GemmaClient) WithOptions(options ollama.Options) *GemmaClient {
+	return &GemmaClient{provider: g.provider, options: g.options.Merge(options)}
+}
+
 // GenerateResponse generates a response from Gemma
-func (g *GemmaClient) GenerateResponse(ctx context.Context, messages []models.Message, temperature float64) (string, error) {
-	return g.client.ChatCompletion(messages, temperature)
+func (g *GemmaClient) GenerateResponse(ctx context.Context, messages []ollama.ChatMessage, temperature float64) (string, error) {
+	ctx, span := g.startSpan(ctx, messages, temperature)
+	defer span.End()
+
+	resp, err := g.provider.ChatCompletion(ctx, llm.Request{Messages: messages, Temperature: temperature, Options: g.options})
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		err := fmt.Errorf("model returned no choices")
+		span.RecordError(err)
+		return "", err
+	}
+	span.SetAttributes("gen_ai.usage.input_tokens", resp.Usage.PromptTokens, "gen_ai.usage.output_tokens", resp.Usage.CompletionTokens,
+		"gen_ai.response.model", resp.Model)
+	return resp.Choices[0].Message.Content, nil
 }
 
-// GenerateResponseStream generates a streaming response
-func (g *GemmaClient) GenerateResponseStream(ctx context.Context, messages []models.Message, temperature float64, callback func(string) error) error {
-	return g.client.ChatCompletionStream(messages, temperature, callback)
+// GenerateToolCalls generates a response offering tools, returning its text
+// and the calls the model made; it fails with ollama.ErrToolsUnsupported
+// when the model can't call tools
+func (g *GemmaClient) GenerateToolCalls(ctx context.Context, messages []ollama.ChatMessage, tools []ollama.Tool, temperature float64) (string, []ollama.ToolCall, error) {
+	ctx, span := g.startSpan(ctx, messages, temperature)
+	defer span.End()
+
+	if !g.provider.SupportsTools() {
+		err := fmt.Errorf("%w: %s", ollama.ErrToolsUnsupported, g.provider.Model())
+		span.RecordError(err)
+		return "", nil, err
+	}
+	resp, err := g.provider.ChatCompletion(ctx, llm.Request{Messages: messages, Tools: tools, Temperature: temperature, Options: g.options})
+	if err != nil {
+		span.RecordError(err)
+		return "", nil, err
+	}
+	if len(resp.Choices) == 0 {
+		err := fmt.Errorf("model returned no choices")
+		span.RecordError(err)
+		return "", nil, err
+	}
+	span.SetAttributes("gen_ai.usage.input_tokens", resp.Usage.PromptTokens, "gen_ai.usage.output_tokens", resp.Usage.CompletionTokens,
+		"gen_ai.response.model", resp.Model, "llm.tool_calls", len(resp.Choices[0].Message.ToolCalls))
+	return resp.Choices[0].Message.Content, resp.Choices[0].Message.ToolCalls, nil
+}
+
+// GenerateResponseStream generates a streaming response, stopping when ctx
+// is cancelled
+func (g *GemmaClient) GenerateResponseStream(ctx context.Context, messages []ollama.ChatMessage, temperature float64, callback func(string) error) error {
+	ctx, span := g.startSpan(ctx, messages, temperature)
+	defer span.End()
+
+	result, err := g.provider.Stream(ctx, llm.Request{Messages: messages, Temperature: temperature, Options: g.options}, callback)
+	span.RecordError(err)
+	if err == nil {
+		span.SetAttributes("gen_ai.usage.input_tokens", result.Usage.PromptTokens, "gen_ai.usage.output_tokens", result.Usage.CompletionTokens,
+			"gen_ai.response.finish_reasons", result.FinishReason, "gen_ai.response.model", result.Model)
+	}
+	return err
+}
+
+// startSpan starts the span of a model call
+func (g *GemmaClient) startSpan(ctx context.Context, messages []ollama.ChatMessage, temperature float64) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, "llm.chat",
+		"gen_ai.system", g.provider.Name(),
+		"gen_ai.request.model", g.provider.Model(),
+		"gen_ai.request.temperature", temperature,
+		"llm.messages", len(messages))
+	span.SetKind(tracing.KindClient)
+	return ctx, span
 }
 
 // GeneratePlan generates an execution plan
@@ -47,18 +125,102 @@ Generate a detailed execution plan with these sections:
 
 Be specific and actionable.`, command, context)
 
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
 
 	return g.GenerateResponse(ctx, messages, 0.7)
 }
 
+// planStep is a step of a plan as the model lays it out
+type planStep struct {
+	Tool        string                 `json:"tool" enum:"browser|terminal|mcp" description:"the tool the step uses"`
+	Description string                 `json:"description" description:"what the step does"`
+	Command     string                 `json:"command" description:"the URL to open, shell command to run or MCP tool to call"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty" description:"further arguments; for mcp, the server, tool and its arguments"`
+}
+
+// planStepTool is the function GeneratePlanSteps has the model call once per step
+var planStepTool = ollama.NewTool("add_step", "Add the next step of the plan", llm.SchemaOf(reflect.TypeOf(planStep{})))
+
+// GeneratePlanSteps has the model lay out a plan as steps for executing
+// directly: as one add_step call per step when it supports tools, and as
+// structured JSON otherwise
+func (g *GemmaClient) GeneratePlanSteps(ctx context.Context, command string, plan string) ([]Step, error) {
+	prompt := fmt.Sprintf(`Turn this plan into steps an agent can execute.
+
+User Command: %s
+
+Plan:
+%s
+
+`, command, plan)
+
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt + "Call add_step once for each step, in order."},
+	}
+
+	_, calls, err := g.GenerateToolCalls(ctx, messages, []ollama.Tool{planStepTool}, 0.3)
+	if errors.Is(err, ollama.ErrToolsUnsupported) {
+		laidOut, err := generateStructured[struct {
+			Steps []planStep `json:"steps"`
+		}](ctx, g, prompt+"List the steps in order.", 0.3)
+		if err != nil {
+			return nil, err
+		}
+		return stepsLaidOut(laidOut.Steps), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	laidOut := make([]planStep, 0, len(calls))
+	for _, call := range calls {
+		var step planStep
+		if call.Function.Name != "add_step" || json.Unmarshal([]byte(call.Function.Arguments), &step) != nil {
+			continue
+		}
+		laidOut = append(laidOut, step)
+	}
+	return stepsLaidOut(laidOut), nil
+}
+
+// stepsLaidOut numbers the steps the model laid out, dropping any without a
+// known tool or a command
+func stepsLaidOut(laidOut []planStep) []Step {
+	steps := make([]Step, 0, len(laidOut))
+	for _, step := range laidOut {
+		if step.Command == "" || (step.Tool != "browser" && step.Tool != "terminal" && step.Tool != "mcp") {
+			continue
+		}
+		if step.Parameters == nil {
+			step.Parameters = make(map[string]interface{})
+		}
+		steps = append(steps, Step{
+			ID:          len(steps) + 1,
+			Description: step.Description,
+			Tool:        step.Tool,
+			Action:      step.Command,
+			Parameters:  step.Parameters,
+		})
+	}
+	return steps
+}
+
+// generateStructured has the model answer prompt with JSON matching the
+// schema of T, and decodes it
+func generateStructured[T any](ctx context.Context, g *GemmaClient, prompt string, temperature float64) (T, error) {
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
+	}
+	ctx, span := g.startSpan(ctx, messages, temperature)
+	defer span.End()
+
+	result, err := llm.GenerateStructured[T](ctx, g.provider, messages, temperature)
+	span.RecordError(err)
+	return result, err
+}
+
 // GenerateReasoning generates reasoning for a decision
 func (g *GemmaClient) GenerateReasoning(ctx context.Context, situation string, options []string) (string, error) {
 	optionsText := ""
@@ -81,18 +243,64 @@ Analyze each option and provide:
 
 Be logical and thorough.`, situation, optionsText)
 
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
 
 	return g.GenerateResponse(ctx, messages, 0.7)
 }
 
+// reasoningSamples is how many answers ChooseOption votes on
+const reasoningSamples = 5
+
+// optionChoice is the model's pick among numbered options
+type optionChoice struct {
+	Choice    int    `json:"choice" description:"number of the best option, from 1"`
+	Reasoning string `json:"reasoning" description:"why it is better than the others"`
+}
+
+// ChooseOption picks the best of options for the reason phase. Several
+// answers are sampled and the option most of them pick wins. It returns
+// the option's index, the reasoning of an answer picking it, and the share
+// of answers that did.
+func (g *GemmaClient) ChooseOption(ctx context.Context, situation string, options []string) (int, string, float64, error) {
+	if len(options) == 0 {
+		return 0, "", 0, fmt.Errorf("no options to choose from")
+	}
+	optionsText := ""
+	for i, opt := range options {
+		optionsText += fmt.Sprintf("%d. %s\n", i+1, opt)
+	}
+
+	prompt := fmt.Sprintf(`You are an AI agent making a decision.
+
+Situation: %s
+
+Options:
+%s
+Weigh the pros and cons of each option, then choose the best one.`, situation, optionsText)
+
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
+	}
+	ctx, span := g.startSpan(ctx, messages, 0.7)
+	defer span.End()
+
+	consensus, err := llm.SelfConsistency[optionChoice](ctx, g.provider, messages, 0.7, reasoningSamples)
+	if err != nil {
+		span.RecordError(err)
+		return 0, "", 0, err
+	}
+	choice := consensus.Answer.Choice
+	if choice < 1 || choice > len(options) {
+		err := fmt.Errorf("model chose option %d of %d", choice, len(options))
+		span.RecordError(err)
+		return 0, "", 0, err
+	}
+	span.SetAttributes("llm.samples", consensus.Samples, "llm.agreement", consensus.Agreement["choice"])
+	return choice - 1, consensus.Answer.Reasoning, consensus.Agreement["choice"], nil
+}
+
 // GenerateReflection generates a reflection on results
 func (g *GemmaClient) GenerateReflection(ctx context.Context, action string, result string, success bool) (string, error) {
 	statusText := "succeeded"
@@ -114,53 +322,87 @@ Provide a reflection with:
 
 Be honest and constructive.`, action, result, statusText)
 
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
 
 	return g.GenerateResponse(ctx, messages, 0.7)
 }
 
-// ParseAction parses an action from text
+// actionTools are the functions ParseAction offers, one per action type
+var actionTools = []ollama.Tool{
+	ollama.NewTool("browser", "Act in the web browser", actionToolParameters("the browser action, such as navigate, click or type")),
+	ollama.NewTool("terminal", "Run a shell command", actionToolParameters("the shell command to run")),
+	ollama.NewTool("mcp", "Call a tool on an MCP server", actionToolParameters("the MCP tool to call")),
+}
+
+// actionToolParameters is the schema of an action tool's arguments
+func actionToolParameters(command string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"command":    map[string]interface{}{"type": "string", "description": command},
+			"parameters": map[string]interface{}{"type": "object", "description": "further arguments of the action"},
+		},
+		"required": []string{"command"},
+	}
+}
+
+// actionSpec is an action as the model describes it in JSON
+type actionSpec struct {
+	Type       string                 `json:"type" enum:"browser|terminal|mcp"`
+	Command    string                 `json:"command" description:"the specific command"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// ParseAction parses an action from text, through a tool call when the
+// model supports them and as structured JSON otherwise
 func (g *GemmaClient) ParseAction(ctx context.Context, text string) (*Action, error) {
+	if action, err := g.callAction(ctx, text); err == nil {
+		return action, nil
+	} else if !errors.Is(err, ollama.ErrToolsUnsupported) && !errors.Is(err, errNoToolCall) {
+		return nil, err
+	}
+
 	prompt := fmt.Sprintf(`Parse this text into a structured action.
 
-Text: %s
+Text: %s`, text)
 
-Return JSON with:
-{
-  "type": "browser|terminal|mcp",
-  "command": "the specific command",
-  "parameters": {"key": "value"}
+	// Fall back to running the text as a terminal command when the model
+	// can't describe it
+	parsed, err := generateStructured[actionSpec](ctx, g, prompt, 0.3)
+	if errors.Is(err, llm.ErrInvalidStructuredOutput) || (err == nil && parsed.Command == "") {
+		return &Action{Type: "terminal", Command: text}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Action{Type: parsed.Type, Command: parsed.Command, Parameters: parsed.Parameters}, nil
 }
 
-Only return the JSON, nothing else.`, text)
+// errNoToolCall is returned when the model answered without calling a tool
+var errNoToolCall = errors.New("model made no tool call")
 
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+// callAction asks the model to call the action tool text describes
+func (g *GemmaClient) callAction(ctx context.Context, text string) (*Action, error) {
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: "Call the tool that carries out this action:\n\n" + text},
 	}
-
-	response, err := g.GenerateResponse(ctx, messages, 0.3)
+	_, calls, err := g.GenerateToolCalls(ctx, messages, actionTools, 0.3)
 	if err != nil {
 		return nil, err
 	}
+	if len(calls) == 0 {
+		return nil, errNoToolCall
+	}
 
-	// TODO: Parse JSON response into Action struct
-	// For now, return a placeholder
-	return &Action{
-		Type:    "terminal",
-		Command: text,
-	}, nil
+	args, err := calls[0].Args()
+	command, _ := args["command"].(string)
+	if err != nil || command == "" {
+		return nil, errNoToolCall
+	}
+	parameters, _ := args["parameters"].(map[string]interface{})
+	return &Action{Type: calls[0].Function.Name, Command: command, Parameters: parameters}, nil
 }
 
 // GenerateCode generates code
@@ -171,20 +413,17 @@ func (g *GemmaClient) GenerateCode(ctx context.Context, description string, lang
 
 Only return the code, no explanations.`, language, description)
 
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
 
 	return g.GenerateResponse(ctx, messages, 0.5)
 }
 
-// AnalyzeScreenshot analyzes a screenshot description
-func (g *GemmaClient) AnalyzeScreenshot(ctx context.Context, elements []string, goal string) (string, error) {
+// AnalyzeScreenshot shows the vision model a screenshot and the elements
+// detected on it, falling back to the element list alone when the model
+// can't take the image
+func (g *GemmaClient) AnalyzeScreenshot(ctx context.Context, screenshot []byte, elements []string, goal string) (string, error) {
 	elementsText := ""
 	for i, elem := range elements {
 		elementsText += fmt.Sprintf("%d: %s\n", i, elem)
@@ -205,13 +444,26 @@ Determine:
 
 Be specific and use element numbers.`, goal, elementsText)
 
-	messages := []models.Message{
-		{
-			Role: "user",
-			Parts: []models.MessagePart{
-				{Type: "text", Text: prompt},
-			},
-		},
+	if len(screenshot) > 0 {
+		ctx, span := tracing.Start(ctx, "llm.vision",
+			"gen_ai.system", g.provider.Name(),
+			"gen_ai.request.model", g.provider.VisionModel(),
+			"llm.images", 1)
+		span.SetKind(tracing.KindClient)
+		resp, err := g.provider.Vision(ctx, "The attached screenshot shows the page.\n\n"+prompt, [][]byte{screenshot}, 0.7)
+		span.RecordError(err)
+		if err == nil {
+			span.SetAttributes("gen_ai.usage.input_tokens", resp.Usage.PromptTokens, "gen_ai.usage.output_tokens", resp.Usage.CompletionTokens)
+		}
+		span.End()
+		if err == nil {
+			return resp.Choices[0].Message.Content, nil
+		}
+		logging.FromContext(ctx).Warn("vision model failed, analyzing the element list alone", "error", err)
+	}
+
+	messages := []ollama.ChatMessage{
+		{Role: "user", Content: prompt},
 	}
 
 	return g.GenerateResponse(ctx, messages, 0.7)
@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/tracing"
 )
 
 // Planner creates execution plans
@@ -42,20 +44,31 @@ func NewPlanner(controller *Controller) *Planner {
 
 // CreatePlan creates an execution plan
 func (p *Planner) CreatePlan(ctx context.Context, command string, taskMem *memory.TaskMemory) (*Plan, error) {
+	ctx, span := tracing.Start(ctx, "agent.plan", "task.id", taskMem.TaskID)
+	defer span.End()
+
 	// Get relevant context from long-term memory
-	contextStr, err := p.controller.longTermMem.GetContext(ctx, command, 2000)
+	contextStr, err := p.controller.longTermMem.GetContext(memory.WithCaller(ctx, "planner"), command, 2000)
 	if err != nil {
 		contextStr = "No relevant context found"
 	}
 
+	// Recall relevant entries from this task (e.g. when re-planning after a failure)
+	if recalled, err := taskMem.Search(ctx, command, nil, 5); err == nil && len(recalled) > 0 {
+		contextStr += "\n\nEarlier in this task:\n" + memory.FormatSearchResults(recalled)
+	}
+
 	// Generate plan using Gemma
 	planText, err := p.controller.gemma.GeneratePlan(ctx, command, contextStr)
 	if err != nil {
+		span.RecordError(err)
 		return nil, fmt.Errorf("failed to generate plan: %w", err)
 	}
 
 	// Parse plan text into structured plan
 	plan := p.parsePlan(planText, command)
+	p.structureSteps(ctx, plan)
+	span.SetAttributes("plan.id", plan.ID, "plan.steps", len(plan.Steps))
 
 	// Store plan in task memory
 	taskMem.SetContext("plan", plan)
@@ -146,6 +159,28 @@ func (p *Planner) parsePlan(planText, command string) *Plan {
 	return plan
 }
 
+// structureSteps replaces the steps parsed from a plan's text with ones the
+// model lays out through tool calls or structured JSON, naming the exact
+// command and arguments of each
+func (p *Planner) structureSteps(ctx context.Context, plan *Plan) {
+	steps, err := p.controller.gemma.GeneratePlanSteps(ctx, plan.Goal, plan.Context)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to structure plan steps, keeping the parsed ones", "error", err)
+		return
+	}
+	if len(steps) == 0 {
+		return
+	}
+
+	plan.Steps = steps
+	plan.Tools = make([]string, 0)
+	for _, step := range steps {
+		if !contains(plan.Tools, step.Tool) {
+			plan.Tools = append(plan.Tools, step.Tool)
+		}
+	}
+}
+
 // detectTool detects which tool to use based on description
 func (p *Planner) detectTool(description string) string {
 	lower := strings.ToLower(description)
@@ -183,6 +218,7 @@ func (p *Planner) RevisePlan(ctx context.Context, plan *Plan, feedback string) (
 
 	// Parse revised plan
 	revisedPlan := p.parsePlan(revisedText, plan.Goal)
+	p.structureSteps(ctx, revisedPlan)
 	revisedPlan.ID = fmt.Sprintf("plan_%d_revised", generateTimestamp())
 
 	return revisedPlan, nil
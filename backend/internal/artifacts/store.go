@@ -0,0 +1,429 @@
+// Package artifacts keeps the files agent runs produce, such as
+// screenshots, browser downloads, generated code and reports. Contents live
+// on disk; their metadata, including the task each belongs to, in Bolt.
+package artifacts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// artifactBucket holds one JSON-encoded Artifact per ID
+var artifactBucket = []byte("artifacts")
+
+// Artifact kinds
+const (
+	KindScreenshot = "screenshot"
+	KindDownload   = "download"
+	KindCode       = "code"
+	KindReport     = "report"
+	KindFile       = "file"
+)
+
+// Where artifacts come from
+const (
+	SourceAgent   = "agent"
+	SourceBrowser = "browser"
+	SourceAPI     = "api"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+	maxNameLength    = 255
+)
+
+var (
+	// ErrArtifactNotFound is returned for unknown artifact IDs
+	ErrArtifactNotFound = errors.New("artifact not found")
+	// ErrInvalidArtifact is returned for malformed artifacts and queries
+	ErrInvalidArtifact = errors.New("invalid artifact")
+	// ErrArtifactTooLarge is returned for contents over the size limit
+	ErrArtifactTooLarge = errors.New("artifact too large")
+)
+
+// Config sets where artifacts are kept and how large one may be
+type Config struct {
+	Dir      string // contents, one file per artifact
+	DBPath   string // metadata
+	MaxBytes int64
+}
+
+// DefaultConfig keeps artifacts under ./data of up to 100 MB each
+func DefaultConfig() Config {
+	return Config{
+		Dir:      "./data/artifacts",
+		DBPath:   "./data/artifacts.db",
+		MaxBytes: 100 << 20,
+	}
+}
+
+// ConfigFromEnv reads ARTIFACTS_DIR, ARTIFACTS_DB_PATH and ARTIFACTS_MAX_MB
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	if value := os.Getenv("ARTIFACTS_DIR"); value != "" {
+		config.Dir = value
+	}
+	if value := os.Getenv("ARTIFACTS_DB_PATH"); value != "" {
+		config.DBPath = value
+	}
+	if value := os.Getenv("ARTIFACTS_MAX_MB"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return DefaultConfig(), fmt.Errorf("invalid ARTIFACTS_MAX_MB %q, expected a positive number", value)
+		}
+		config.MaxBytes = int64(parsed) << 20
+	}
+	return config, nil
+}
+
+// Artifact describes a stored file
+type Artifact struct {
+	ID          string            `json:"id"`
+	TaskID      string            `json:"task_id,omitempty"`
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind"`
+	ContentType string            `json:"content_type"`
+	Size        int64             `json:"size"`
+	SHA256      string            `json:"sha256"`
+	Source      string            `json:"source"`        // agent, browser or api
+	URL         string            `json:"url,omitempty"` // where a download came from
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// Page is one page of artifacts matching a query, newest first
+type Page struct {
+	Artifacts []Artifact `json:"artifacts"`
+	Total     int        `json:"total"`
+	Offset    int        `json:"offset"`
+	Limit     int        `json:"limit"`
+}
+
+// Store keeps artifacts' contents under a directory and their metadata in
+// a Bolt database
+type Store struct {
+	dir      string
+	maxBytes int64
+	db       *bolt.DB
+	mu       sync.Mutex // orders writes to a content file with its metadata
+}
+
+// Open opens (or creates) the store config describes
+func Open(config Config) (*Store, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(config.DBPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact database directory: %w", err)
+	}
+
+	db, err := bolt.Open(config.DBPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(artifactBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create artifact bucket: %w", err)
+	}
+
+	return &Store{dir: config.Dir, maxBytes: config.MaxBytes, db: db}, nil
+}
+
+// Close closes the metadata database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// MaxBytes is the largest artifact the store takes
+func (s *Store) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// StagingDir is where files bound for the store, such as browser downloads,
+// can be written before Put moves them in
+func (s *Store) StagingDir() string {
+	return filepath.Join(s.dir, "staging")
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id[:2], id)
+}
+
+// Put stores content as a new artifact described by artifact, whose name
+// and kind are required. The ID, size, hash and times are filled in; a
+// missing content type is detected from the name, then the content.
+func (s *Store) Put(artifact Artifact, content io.Reader) (Artifact, error) {
+	artifact.Name = strings.TrimSpace(artifact.Name)
+	if err := validate(artifact); err != nil {
+		return Artifact{}, err
+	}
+
+	artifact.ID = uuid.New().String()
+	path := s.path(artifact.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Artifact{}, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	// Write to a temp file and rename so readers never see partial contents
+	tmp, err := os.CreateTemp(filepath.Dir(path), artifact.ID+".tmp-*")
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to create artifact: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	sniff := &prefixWriter{max: 512}
+	size, err := io.Copy(io.MultiWriter(tmp, hash, sniff), io.LimitReader(content, s.maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if size > s.maxBytes {
+		return Artifact{}, fmt.Errorf("%w: the limit is %d bytes", ErrArtifactTooLarge, s.maxBytes)
+	}
+
+	now := time.Now().UTC()
+	artifact.Size = size
+	artifact.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	artifact.CreatedAt = now
+	artifact.UpdatedAt = now
+	if artifact.ContentType == "" {
+		artifact.ContentType = mime.TypeByExtension(filepath.Ext(artifact.Name))
+	}
+	if artifact.ContentType == "" {
+		artifact.ContentType = http.DetectContentType(sniff.data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Artifact{}, fmt.Errorf("failed to store artifact: %w", err)
+	}
+	if err := s.save(artifact); err != nil {
+		os.Remove(path)
+		return Artifact{}, err
+	}
+	return artifact, nil
+}
+
+// PutBytes stores data as a new artifact
+func (s *Store) PutBytes(artifact Artifact, data []byte) (Artifact, error) {
+	return s.Put(artifact, bytes.NewReader(data))
+}
+
+// Get returns an artifact's metadata
+func (s *Store) Get(id string) (Artifact, error) {
+	var artifact Artifact
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(artifactBucket).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrArtifactNotFound, id)
+		}
+		return json.Unmarshal(data, &artifact)
+	})
+	if err != nil {
+		return Artifact{}, err
+	}
+	return artifact, nil
+}
+
+// Content opens an artifact's contents; the caller closes them
+func (s *Store) Content(id string) (Artifact, *os.File, error) {
+	artifact, err := s.Get(id)
+	if err != nil {
+		return Artifact{}, nil, err
+	}
+
+	file, err := os.Open(s.path(artifact.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		return Artifact{}, nil, fmt.Errorf("%w: %s has no contents", ErrArtifactNotFound, id)
+	}
+	if err != nil {
+		return Artifact{}, nil, fmt.Errorf("failed to open artifact: %w", err)
+	}
+	return artifact, file, nil
+}
+
+// List returns a page of the artifacts matching req, newest first
+func (s *Store) List(req models.ArtifactListRequest) (*Page, error) {
+	if req.Kind != "" && !validKind(req.Kind) {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidArtifact, req.Kind)
+	}
+
+	offset, limit := req.Offset, req.Limit
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	matched := make([]Artifact, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(artifactBucket).ForEach(func(k, v []byte) error {
+			var artifact Artifact
+			if err := json.Unmarshal(v, &artifact); err != nil {
+				slog.Warn("skipping undecodable artifact", "artifact_id", string(k), "error", err)
+				return nil
+			}
+			switch {
+			case req.TaskID != "" && artifact.TaskID != req.TaskID:
+			case req.Kind != "" && artifact.Kind != req.Kind:
+			case req.Source != "" && artifact.Source != req.Source:
+			default:
+				matched = append(matched, artifact)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	page := &Page{Artifacts: make([]Artifact, 0), Total: len(matched), Offset: offset, Limit: limit}
+	if offset < len(matched) {
+		page.Artifacts = matched[offset:min(offset+limit, len(matched))]
+	}
+	return page, nil
+}
+
+// Update changes the fields req sets: the name, the task the artifact
+// belongs to, its kind and its metadata, which replaces the old
+func (s *Store) Update(id string, req models.ArtifactUpdateRequest) (Artifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	artifact, err := s.Get(id)
+	if err != nil {
+		return Artifact{}, err
+	}
+	if req.Name != nil {
+		artifact.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.TaskID != nil {
+		artifact.TaskID = *req.TaskID
+	}
+	if req.Kind != nil {
+		artifact.Kind = *req.Kind
+	}
+	if req.Metadata != nil {
+		artifact.Metadata = req.Metadata
+	}
+	if err := validate(artifact); err != nil {
+		return Artifact{}, err
+	}
+
+	artifact.UpdatedAt = time.Now().UTC()
+	if err := s.save(artifact); err != nil {
+		return Artifact{}, err
+	}
+	return artifact, nil
+}
+
+// Delete removes an artifact and its contents
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(artifactBucket).Delete([]byte(id))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete artifact: %w", err)
+	}
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("failed to remove contents of artifact", "artifact_id", id, "error", err)
+	}
+	return nil
+}
+
+// save writes an artifact's metadata
+func (s *Store) save(artifact Artifact) error {
+	data, err := json.Marshal(artifact)
+	if err != nil {
+		return fmt.Errorf("failed to encode artifact: %w", err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(artifactBucket).Put([]byte(artifact.ID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save artifact: %w", err)
+	}
+	return nil
+}
+
+// validate checks an artifact's name and kind
+func validate(artifact Artifact) error {
+	switch {
+	case artifact.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidArtifact)
+	case len(artifact.Name) > maxNameLength || strings.ContainsAny(artifact.Name, "/\\\x00"):
+		return fmt.Errorf("%w: name must be a file name of at most %d bytes", ErrInvalidArtifact, maxNameLength)
+	case !validKind(artifact.Kind):
+		return fmt.Errorf("%w: kind must be screenshot, download, code, report or file", ErrInvalidArtifact)
+	}
+	return nil
+}
+
+func validKind(kind string) bool {
+	switch kind {
+	case KindScreenshot, KindDownload, KindCode, KindReport, KindFile:
+		return true
+	}
+	return false
+}
+
+// prefixWriter keeps the first max bytes written to it, for sniffing the
+// content type
+type prefixWriter struct {
+	data []byte
+	max  int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.max - len(w.data); room > 0 {
+		w.data = append(w.data, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scopes, from least to most privileged. Each scope includes the ones
+// before it, so an execute key can also read and browse.
+const (
+	ScopeRead    = "read"    // view state: GET routes and event streams
+	ScopeBrowse  = "browse"  // drive the browser and chat with the agent
+	ScopeExecute = "execute" // run terminal commands, write memory and report to the watchdog
+	ScopeAdmin   = "admin"   // manage keys and review alerts and proposals
+)
+
+// Scopes lists every scope from least to most privileged
+var Scopes = []string{ScopeRead, ScopeBrowse, ScopeExecute, ScopeAdmin}
+
+// How a principal authenticated
+const (
+	ViaAPIKey   = "api_key"
+	ViaSession  = "session"
+	ViaAdminKey = "admin_key"
+	ViaDisabled = "disabled" // authentication is off and every request is an admin
+)
+
+var (
+	// ErrUnauthorized is returned for missing, malformed, expired or revoked credentials
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned when a principal's scope doesn't cover a request
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalidKeyRequest is returned for malformed key and session requests
+	ErrInvalidKeyRequest = errors.New("invalid key request")
+	// ErrKeyNotFound is returned for unknown API key IDs
+	ErrKeyNotFound = errors.New("api key not found")
+)
+
+// Principal is who a request was made by
+type Principal struct {
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	KeyID     string     `json:"key_id,omitempty"`
+	Via       string     `json:"via"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // when a session ends
+}
+
+// Allows reports whether the principal's scope covers scope. A nil
+// principal allows nothing.
+func (p *Principal) Allows(scope string) bool {
+	return p != nil && scopeRank(p.Scope) >= scopeRank(scope)
+}
+
+// scopeRank orders scopes; unknown scopes rank below read
+func scopeRank(scope string) int {
+	return slices.Index(Scopes, scope)
+}
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	return scopeRank(scope) >= 0
+}
+
+// Config configures authentication
+type Config struct {
+	Enabled    bool
+	AdminKey   string // a key with the admin scope that isn't stored; empty disables it
+	JWTSecret  []byte
+	SessionTTL time.Duration
+	KeysPath   string
+}
+
+// ConfigFromEnv reads AUTH_ENABLED, AUTH_ADMIN_KEY, AUTH_KEYS_PATH,
+// JWT_SECRET and JWT_EXPIRATION. Without a JWT secret one is generated, so
+// sessions don't survive a restart.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Enabled:    true,
+		AdminKey:   os.Getenv("AUTH_ADMIN_KEY"),
+		JWTSecret:  []byte(os.Getenv("JWT_SECRET")),
+		SessionTTL: 24 * time.Hour,
+		KeysPath:   "./data/auth.db",
+	}
+
+	if value := os.Getenv("AUTH_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid AUTH_ENABLED: %w", err)
+		}
+		config.Enabled = enabled
+	}
+	if value := os.Getenv("AUTH_KEYS_PATH"); value != "" {
+		config.KeysPath = value
+	}
+	if value := os.Getenv("JWT_EXPIRATION"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return config, fmt.Errorf("invalid JWT_EXPIRATION %q", value)
+		}
+		config.SessionTTL = ttl
+	}
+
+	if len(config.AdminKey) > 0 && len(config.AdminKey) < 32 {
+		return config, fmt.Errorf("AUTH_ADMIN_KEY must be at least 32 characters")
+	}
+	if len(config.JWTSecret) == 0 {
+		config.JWTSecret = make([]byte, 32)
+		if _, err := rand.Read(config.JWTSecret); err != nil {
+			return config, fmt.Errorf("failed to generate JWT secret: %w", err)
+		}
+		if config.Enabled {
+			slog.Warn("JWT_SECRET not set, sessions won't survive a restart")
+		}
+	} else if len(config.JWTSecret) < 32 {
+		return config, fmt.Errorf("JWT_SECRET must be at least 32 characters")
+	}
+	return config, nil
+}
+
+// Authenticator checks API keys and session tokens
+type Authenticator struct {
+	config Config
+	keys   *KeyStore // nil when authentication is disabled
+}
+
+// NewAuthenticator opens the key store. When authentication is enabled and
+// there are no keys and no admin key, an admin key is created and logged
+// once so the server can be reached at all.
+func NewAuthenticator(config Config) (*Authenticator, error) {
+	a := &Authenticator{config: config}
+	if !config.Enabled {
+		return a, nil
+	}
+
+	keys, err := OpenKeyStore(config.KeysPath)
+	if err != nil {
+		return nil, err
+	}
+	a.keys = keys
+
+	if config.AdminKey == "" && len(keys.List()) == 0 {
+		key, secret, err := keys.Create("bootstrap", ScopeAdmin, 0, "system")
+		if err != nil {
+			keys.Close()
+			return nil, fmt.Errorf("failed to create bootstrap key: %w", err)
+		}
+		// The secret goes straight to stderr, so it stays out of the log
+		// tail that /api/logs serves
+		slog.Info("created admin API key, its secret is printed to stderr once", "key_id", key.ID)
+		fmt.Fprintf(os.Stderr, "\n🔑 Admin API key %s, store it now, it won't be shown again: %s\n\n", key.ID, secret)
+	}
+	return a, nil
+}
+
+// Close closes the key store
+func (a *Authenticator) Close() error {
+	if a.keys == nil {
+		return nil
+	}
+	return a.keys.Close()
+}
+
+// Enabled reports whether requests need credentials
+func (a *Authenticator) Enabled() bool {
+	return a.config.Enabled
+}
+
+// Keys returns the API key store, or nil when authentication is disabled
+func (a *Authenticator) Keys() *KeyStore {
+	return a.keys
+}
+
+// Authenticate resolves an API key or session token to its principal
+func (a *Authenticator) Authenticate(token string) (*Principal, error) {
+	if !a.config.Enabled {
+		return &Principal{Name: "anonymous", Scope: ScopeAdmin, Via: ViaDisabled}, nil
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%w: no credentials", ErrUnauthorized)
+	}
+
+	if strings.Count(token, ".") == 2 {
+		return a.authenticateSession(token)
+	}
+	if a.config.AdminKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AdminKey)) == 1 {
+		return &Principal{Name: "admin", Scope: ScopeAdmin, Via: ViaAdminKey}, nil
+	}
+
+	key, err := a.keys.Lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Name: key.Name, Scope: key.Scope, KeyID: key.ID, Via: ViaAPIKey}, nil
+}
+
+// authenticateSession checks a session token and that the key it was
+// issued for is still valid; a key whose scope was lowered lowers its
+// sessions too
+func (a *Authenticator) authenticateSession(token string) (*Principal, error) {
+	claims, err := verifyJWT(a.config.JWTSecret, token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	scope := claims.Scope
+	if claims.KeyID != "" {
+		key, err := a.keys.active(claims.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		if scopeRank(key.Scope) < scopeRank(scope) {
+			scope = key.Scope
+		}
+	}
+
+	expires := time.Unix(claims.ExpiresAt, 0)
+	return &Principal{Name: claims.Subject, Scope: scope, KeyID: claims.KeyID, Via: ViaSession, ExpiresAt: &expires}, nil
+}
+
+// IssueSession exchanges an API key principal for a session token with
+// scope, or the key's own scope when empty. Sessions can't be issued from
+// sessions, so they can't be extended past their key's intent.
+func (a *Authenticator) IssueSession(p *Principal, scope string) (string, *Principal, error) {
+	if p == nil || p.Via == ViaSession {
+		return "", nil, fmt.Errorf("%w: sessions are issued for API keys", ErrInvalidKeyRequest)
+	}
+	if scope == "" {
+		scope = p.Scope
+	}
+	if !ValidScope(scope) {
+		return "", nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidKeyRequest, scope)
+	}
+	if !p.Allows(scope) {
+		return "", nil, fmt.Errorf("%w: %s can't be granted by a %s key", ErrForbidden, scope, p.Scope)
+	}
+
+	now := time.Now()
+	expires := now.Add(a.config.SessionTTL)
+	token, err := signJWT(a.config.JWTSecret, sessionClaims{
+		Subject:   p.Name,
+		KeyID:     p.KeyID,
+		Scope:     scope,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	expires = time.Unix(expires.Unix(), 0)
+	return token, &Principal{Name: p.Name, Scope: scope, KeyID: p.KeyID, Via: ViaSession, ExpiresAt: &expires}, nil
+}
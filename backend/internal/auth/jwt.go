@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jwtHeader is the only header sessions are signed with
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// sessionClaims are the claims of a session token
+type sessionClaims struct {
+	Subject   string `json:"sub"`
+	KeyID     string `json:"kid,omitempty"` // the API key the session was issued for
+	Scope     string `json:"scope"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// signJWT signs claims as an HS256 JWT
+func signJWT(secret []byte, claims sessionClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session claims: %w", err)
+	}
+
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + jwtSignature(secret, signed), nil
+}
+
+// verifyJWT checks a token's signature and expiry and returns its claims
+func verifyJWT(secret []byte, token string, now time.Time) (*sessionClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, fmt.Errorf("%w: malformed session token", ErrUnauthorized)
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(jwtSignature(secret, parts[0]+"."+parts[1]))) {
+		return nil, fmt.Errorf("%w: bad session signature", ErrUnauthorized)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed session token", ErrUnauthorized)
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed session claims", ErrUnauthorized)
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: session expired", ErrUnauthorized)
+	}
+	if !ValidScope(claims.Scope) {
+		return nil, fmt.Errorf("%w: unknown session scope", ErrUnauthorized)
+	}
+	return &claims, nil
+}
+
+// jwtSignature returns the base64url HMAC-SHA256 of signed
+func jwtSignature(secret []byte, signed string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// keyBucket holds API keys keyed by ID
+var keyBucket = []byte("api_keys")
+
+const (
+	// keyPrefix starts every generated key so leaked keys are easy to grep for
+	keyPrefix = "acc_"
+	// lastUsedInterval is how stale a key's persisted last use may get
+	lastUsedInterval = time.Minute
+)
+
+// APIKey is a stored API key. The key itself is only returned when it's
+// created; the store keeps its hash.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // the key's first characters, to recognize it
+	Scope      string     `json:"scope"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy  string     `json:"revoked_by,omitempty"`
+}
+
+// keyRecord is how a key is persisted
+type keyRecord struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// KeyStore persists API keys in a Bolt database
+type KeyStore struct {
+	db *bolt.DB
+
+	mu     sync.Mutex
+	keys   map[string]*keyRecord // ID -> key
+	byHash map[string]string     // hash -> ID
+}
+
+// OpenKeyStore opens or creates the key store at path
+func OpenKeyStore(path string) (*KeyStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create key store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key store: %w", err)
+	}
+
+	s := &KeyStore{db: db, keys: make(map[string]*keyRecord), byHash: make(map[string]string)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(keyBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var record keyRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				slog.Warn("skipping undecodable API key", "key_id", string(k), "error", err)
+				return nil
+			}
+			s.keys[record.ID] = &record
+			s.byHash[record.Hash] = record.ID
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+
+	return s, nil
+}
+
+// Close closes the store's database
+func (s *KeyStore) Close() error {
+	return s.db.Close()
+}
+
+// Create stores a new key with scope that expires after ttl, or never when
+// ttl is zero. It returns the key and its secret, which isn't kept.
+func (s *KeyStore) Create(name, scope string, ttl time.Duration, createdBy string) (*APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidKeyRequest)
+	}
+	if !ValidScope(scope) {
+		return nil, "", fmt.Errorf("%w: scope must be one of %s", ErrInvalidKeyRequest, strings.Join(Scopes, ", "))
+	}
+	if ttl < 0 {
+		return nil, "", fmt.Errorf("%w: expiry can't be in the past", ErrInvalidKeyRequest)
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := keyPrefix + hex.EncodeToString(raw)
+
+	now := time.Now()
+	record := &keyRecord{
+		APIKey: APIKey{
+			ID:        uuid.New().String(),
+			Name:      name,
+			Prefix:    secret[:len(keyPrefix)+8],
+			Scope:     scope,
+			CreatedBy: createdBy,
+			CreatedAt: now,
+		},
+		Hash: hashKey(secret),
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		record.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.putLocked(record); err != nil {
+		return nil, "", err
+	}
+	s.keys[record.ID] = record
+	s.byHash[record.Hash] = record.ID
+
+	key := record.APIKey
+	return &key, secret, nil
+}
+
+// List returns every key, revoked ones included, oldest first
+func (s *KeyStore) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, record := range s.keys {
+		keys = append(keys, record.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Revoke disables a key and the sessions issued for it
+func (s *KeyStore) Revoke(id, revokedBy string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	if record.RevokedAt == nil {
+		updated := *record
+		now := time.Now()
+		updated.RevokedAt = &now
+		updated.RevokedBy = revokedBy
+		if err := s.putLocked(&updated); err != nil {
+			return nil, err
+		}
+		*record = updated
+	}
+
+	key := record.APIKey
+	return &key, nil
+}
+
+// Lookup returns the valid key whose secret is secret and notes its use
+func (s *KeyStore) Lookup(secret string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.byHash[hashKey(secret)]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key", ErrUnauthorized)
+	}
+	record, err := s.activeLocked(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	persist := record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > lastUsedInterval
+	record.LastUsedAt = &now
+	if persist {
+		if err := s.putLocked(record); err != nil {
+			slog.Warn("failed to record use of API key", "key_id", record.ID, "error", err)
+		}
+	}
+
+	key := record.APIKey
+	return &key, nil
+}
+
+// active returns the key with id if it's neither revoked nor expired
+func (s *KeyStore) active(id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.activeLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	key := record.APIKey
+	return &key, nil
+}
+
+// activeLocked returns the key with id if it's neither revoked nor
+// expired; callers must hold s.mu
+func (s *KeyStore) activeLocked(id string) (*keyRecord, error) {
+	record, ok := s.keys[id]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: unknown API key", ErrUnauthorized)
+	case record.RevokedAt != nil:
+		return nil, fmt.Errorf("%w: API key %s was revoked", ErrUnauthorized, record.Prefix)
+	case record.ExpiresAt != nil && time.Now().After(*record.ExpiresAt):
+		return nil, fmt.Errorf("%w: API key %s expired", ErrUnauthorized, record.Prefix)
+	}
+	return record, nil
+}
+
+// putLocked persists a key; callers must hold s.mu
+func (s *KeyStore) putLocked(record *keyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode API key: %w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(keyBucket).Put([]byte(record.ID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store API key: %w", err)
+	}
+	return nil
+}
+
+// hashKey returns the hex SHA-256 of an API key; keys are random enough
+// that a slow hash adds nothing
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"agent-workspace/backend/pkg/apierror"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// principalKey is the fiber.Ctx local holding a request's principal
+const principalKey = "auth.principal"
+
+// Rule sets the scope requests to a route need. Rules are matched in
+// order; the first whose method and path prefix match applies. Prefixes
+// match whole path segments, ignoring case and trailing slashes.
+type Rule struct {
+	Method string // empty matches every method
+	Prefix string
+	Scope  string // empty leaves the route public
+}
+
+// matches reports whether the rule applies to a request
+func (r Rule) matches(method, path string) bool {
+	return (r.Method == "" || r.Method == method) && HasPathPrefix(path, r.Prefix)
+}
+
+// NormalizePath returns a request path as Fiber routes it, ignoring case
+// and a trailing slash
+func NormalizePath(path string) string {
+	path = strings.TrimRight(strings.ToLower(path), "/")
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// HasPathPrefix reports whether path is prefix or lies under it, comparing
+// whole segments the way Fiber routes them, so /healthX isn't under /health
+func HasPathPrefix(path, prefix string) bool {
+	path, prefix = NormalizePath(path), NormalizePath(prefix)
+	return prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Middleware authenticates every request and checks its scope against the
+// first matching rule. Routes no rule matches need the admin scope.
+// Credentials are read from an "Authorization: Bearer" or X-API-Key header,
+// or for WebSocket handshakes and event streams, which browsers can't add
+// headers to, from the token query parameter.
+func (a *Authenticator) Middleware(rules []Rule) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		scope := ScopeFor(rules, c.Method(), c.Path())
+
+		token := requestToken(c)
+		if scope == "" && token == "" {
+			return c.Next()
+		}
+
+		principal, err := a.Authenticate(token)
+		if err != nil {
+			if scope == "" {
+				return c.Next()
+			}
+			return Deny(c, err)
+		}
+		if scope != "" && !principal.Allows(scope) {
+			return Deny(c, fmt.Errorf("%w: %s %s needs the %s scope", ErrForbidden, c.Method(), c.Path(), scope))
+		}
+
+		c.Locals(principalKey, principal)
+		return c.Next()
+	}
+}
+
+// Deny responds to a request that failed authentication or authorization
+func Deny(c fiber.Ctx, err error) error {
+	if errors.Is(err, ErrForbidden) {
+		return apierror.Send(c, 403, err.Error())
+	}
+	c.Set("WWW-Authenticate", `Bearer realm="agent-workspace"`)
+	return apierror.Send(c, 401, err.Error())
+}
+
+// ScopeFor returns the scope the first matching rule sets for a route, or
+// admin when none matches
+func ScopeFor(rules []Rule, method, path string) string {
+	for _, rule := range rules {
+		if rule.matches(method, path) {
+			return rule.Scope
+		}
+	}
+	return ScopeAdmin
+}
+
+// FromContext returns the principal a request authenticated as, or nil
+func FromContext(c fiber.Ctx) *Principal {
+	principal, _ := c.Locals(principalKey).(*Principal)
+	return principal
+}
+
+// OwnerOf names the principal whose data a request sees: its own name, or
+// none when authentication is off
+func OwnerOf(c fiber.Ctx) string {
+	principal := FromContext(c)
+	if principal == nil || principal.Via == ViaDisabled {
+		return ""
+	}
+	return principal.Name
+}
+
+// requestToken returns the credentials a request carries
+func requestToken(c fiber.Ctx) string {
+	if header := c.Get("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if key := c.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if strings.EqualFold(c.Get("Upgrade"), "websocket") || strings.Contains(c.Get("Accept"), "text/event-stream") {
+		return c.Query("token")
+	}
+	return ""
+}
@@ -38,7 +38,7 @@ func (m *Manager) ClickBySelector(selector string) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "click_by_selector",
 		chromedp.WaitVisible(selector),
 		chromedp.Click(selector),
 	)
@@ -53,7 +53,7 @@ func (m *Manager) TypeBySelector(selector, text string) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "type_by_selector",
 		chromedp.WaitVisible(selector),
 		chromedp.SendKeys(selector, text),
 	)
@@ -78,7 +78,7 @@ func (m *Manager) SelectOption(selector, value string) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "select_option",
 		chromedp.WaitVisible(selector),
 		chromedp.SetValue(selector, value),
 	)
@@ -93,7 +93,7 @@ func (m *Manager) CheckCheckbox(selector string) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "check_checkbox",
 		chromedp.WaitVisible(selector),
 		chromedp.SetAttributeValue(selector, "checked", "true"),
 	)
@@ -108,7 +108,7 @@ func (m *Manager) UncheckCheckbox(selector string) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "uncheck_checkbox",
 		chromedp.WaitVisible(selector),
 		chromedp.RemoveAttribute(selector, "checked"),
 	)
@@ -124,7 +124,7 @@ func (m *Manager) GetText(selector string) (string, error) {
 	defer cancel()
 
 	var text string
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "get_text",
 		chromedp.WaitVisible(selector),
 		chromedp.Text(selector, &text),
 	)
@@ -142,7 +142,7 @@ func (m *Manager) GetAttribute(selector, attribute string) (string, error) {
 	defer cancel()
 
 	var value string
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "get_attribute",
 		chromedp.WaitVisible(selector),
 		chromedp.AttributeValue(selector, attribute, &value, nil),
 	)
@@ -168,7 +168,7 @@ func (m *Manager) Hover(elementID int) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "hover",
 		chromedp.MouseClickXY(element.X+element.Width/2, element.Y+element.Height/2, chromedp.ButtonNone),
 	)
 }
@@ -201,7 +201,7 @@ func (m *Manager) RightClick(elementID int) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "right_click",
 		chromedp.MouseClickXY(element.X+element.Width/2, element.Y+element.Height/2, chromedp.ButtonRight),
 	)
 }
@@ -225,7 +225,7 @@ func (m *Manager) ScrollToElement(elementID int) error {
 	defer cancel()
 
 	script := fmt.Sprintf("window.scrollTo(%f, %f)", element.X, element.Y-100)
-	return chromedp.Run(ctx,
+	return m.run(ctx, "scroll_to_element",
 		chromedp.Evaluate(script, nil),
 	)
 }
@@ -239,7 +239,7 @@ func (m *Manager) WaitForNavigation(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(m.ctx, timeout)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "wait_for_navigation",
 		chromedp.WaitReady("body"),
 	)
 }
@@ -253,7 +253,7 @@ func (m *Manager) GoBack() error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "go_back",
 		chromedp.NavigateBack(),
 	)
 }
@@ -267,7 +267,7 @@ func (m *Manager) GoForward() error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "go_forward",
 		chromedp.NavigateForward(),
 	)
 }
@@ -281,7 +281,7 @@ func (m *Manager) Reload() error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "reload",
 		chromedp.Reload(),
 	)
 }
@@ -295,7 +295,7 @@ func (m *Manager) SetViewport(width, height int64) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "set_viewport",
 		chromedp.EmulateViewport(width, height),
 	)
 }
@@ -310,7 +310,7 @@ func (m *Manager) GetCookies() ([]interface{}, error) {
 	defer cancel()
 
 	var cookies []interface{}
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "get_cookies",
 		chromedp.Evaluate("document.cookie", &cookies),
 	)
 
@@ -326,7 +326,7 @@ func (m *Manager) ClearCookies() error {
 	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "clear_cookies",
 		chromedp.Evaluate("document.cookie.split(';').forEach(c => document.cookie = c.replace(/^ +/, '').replace(/=.*/, '=;expires=' + new Date().toUTCString() + ';path=/'))", nil),
 	)
 }
@@ -340,7 +340,7 @@ func (m *Manager) SubmitForm(selector string) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "submit_form",
 		chromedp.WaitVisible(selector),
 		chromedp.Submit(selector),
 	)
@@ -363,7 +363,7 @@ func (m *Manager) FillForm(fields map[string]string) error {
 		)
 	}
 
-	return chromedp.Run(ctx, tasks...)
+	return m.run(ctx, "fill_form", tasks...)
 }
 
 // TakeFullPageScreenshot takes a full page screenshot
@@ -376,7 +376,7 @@ func (m *Manager) TakeFullPageScreenshot() ([]byte, error) {
 	defer cancel()
 
 	var buf []byte
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "take_full_page_screenshot",
 		chromedp.FullScreenshot(&buf, 90),
 	)
 
@@ -402,7 +402,7 @@ func (m *Manager) IsElementVisible(selector string) (bool, error) {
 		})()
 	`, selector)
 
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "is_element_visible",
 		chromedp.Evaluate(script, &visible),
 	)
 
@@ -0,0 +1,157 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/internal/artifacts"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/chromedp"
+)
+
+// download is a file Chrome is downloading into the staging directory
+type download struct {
+	name   string
+	url    string
+	taskID string
+}
+
+// SetArtifacts keeps screenshots taken for a task and the files the
+// browser downloads in store; tabs opened afterwards share it
+func (m *Manager) SetArtifacts(store *artifacts.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.artifacts = store
+}
+
+// SetTask sets the task downloads from now on belong to
+func (m *Manager) SetTask(taskID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.task = taskID
+}
+
+// keepScreenshot stores a screenshot taken for a task as an artifact
+func (m *Manager) keepScreenshot(taskID string, png []byte) {
+	m.mu.RLock()
+	store, url := m.artifacts, m.currentURL
+	m.mu.RUnlock()
+
+	if store == nil || taskID == "" {
+		return
+	}
+	_, err := store.PutBytes(artifacts.Artifact{
+		TaskID:      taskID,
+		Name:        fmt.Sprintf("screenshot-%s.png", time.Now().UTC().Format("20060102-150405.000")),
+		Kind:        artifacts.KindScreenshot,
+		ContentType: "image/png",
+		Source:      artifacts.SourceBrowser,
+		URL:         url,
+	}, png)
+	if err != nil {
+		slog.Warn("failed to keep screenshot", "task_id", taskID, "error", err)
+	}
+}
+
+// enableDownloads returns an action letting the page download files into
+// the store's staging directory and storing each as an artifact once it
+// completes, or nil when there's no store or downloads are already enabled
+func (m *Manager) enableDownloads() chromedp.Action {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.artifacts == nil || m.downloadsEnabled {
+		return nil
+	}
+	m.downloadsEnabled = true
+	store, browserCtx := m.artifacts, m.ctx
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		staging := store.StagingDir()
+		if err := os.MkdirAll(staging, 0755); err != nil {
+			return fmt.Errorf("failed to create download directory: %w", err)
+		}
+
+		pending := make(map[string]download)
+		// Listen for as long as the browser lives, not just this action
+		chromedp.ListenTarget(browserCtx, func(ev interface{}) {
+			switch ev := ev.(type) {
+			case *browser.EventDownloadWillBegin:
+				m.mu.RLock()
+				taskID := m.task
+				m.mu.RUnlock()
+				pending[ev.GUID] = download{name: downloadName(ev.SuggestedFilename), url: ev.URL, taskID: taskID}
+
+			case *browser.EventDownloadProgress:
+				d, ok := pending[ev.GUID]
+				if !ok {
+					return
+				}
+				switch ev.State {
+				case browser.DownloadProgressStateCompleted:
+					delete(pending, ev.GUID)
+					// Listeners run on chromedp's event loop, which mustn't block
+					go keepDownload(store, filepath.Join(staging, ev.GUID), d)
+				case browser.DownloadProgressStateCanceled:
+					delete(pending, ev.GUID)
+					os.Remove(filepath.Join(staging, ev.GUID))
+				}
+			}
+		})
+
+		params := browser.SetDownloadBehavior(browser.SetDownloadBehaviorBehaviorAllowAndName).
+			WithDownloadPath(staging).
+			WithEventsEnabled(true)
+		if c := chromedp.FromContext(browserCtx); c != nil && c.BrowserContextID != "" {
+			params = params.WithBrowserContextID(c.BrowserContextID)
+		}
+		if err := params.Do(ctx); err != nil {
+			return fmt.Errorf("failed to enable downloads: %w", err)
+		}
+		return nil
+	})
+}
+
+// keepDownload moves a completed download from staging into the store
+func keepDownload(store *artifacts.Store, path string, d download) {
+	defer os.Remove(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Warn("failed to open download", "file", d.name, "error", err)
+		return
+	}
+	defer file.Close()
+
+	artifact, err := store.Put(artifacts.Artifact{
+		TaskID: d.taskID,
+		Name:   d.name,
+		Kind:   artifacts.KindDownload,
+		Source: artifacts.SourceBrowser,
+		URL:    d.url,
+	}, file)
+	if err != nil {
+		slog.Warn("failed to keep download", "file", d.name, "error", err)
+		return
+	}
+	slog.Info("kept download", "file", d.name, "artifact_id", artifact.ID)
+}
+
+// downloadName makes the name a page suggests for a download safe to store
+func downloadName(suggested string) string {
+	name := filepath.Base(strings.ReplaceAll(suggested, "\\", "/"))
+	name = strings.ReplaceAll(name, "\x00", "")
+	if name == "." || name == "/" || name == "" {
+		return "download"
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
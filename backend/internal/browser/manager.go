@@ -2,16 +2,28 @@ package browser
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"agent-workspace/backend/internal/artifacts"
 	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/pkg/metrics"
 	"agent-workspace/backend/pkg/models"
 
 	"github.com/chromedp/chromedp"
 )
 
+// ErrNotStarted is returned by Ping before the browser's first action
+// launches Chrome
+var ErrNotStarted = errors.New("browser not started")
+
+// actionsTotal counts browser actions by action and outcome
+var actionsTotal = metrics.NewCounterVec("browser_actions_total",
+	"Browser actions run through chromedp", "action", "status")
+
 // Manager manages browser automation
 type Manager struct {
 	ctx          context.Context
@@ -23,6 +35,10 @@ type Manager struct {
 	elements     []models.BrowserElement
 	mu           sync.RWMutex
 	initialized  bool
+
+	artifacts        *artifacts.Store
+	task             string // downloads belong to this task
+	downloadsEnabled bool
 }
 
 // NewManager creates a new browser manager
@@ -63,6 +79,40 @@ func (m *Manager) Initialize() error {
 	return nil
 }
 
+// NewTab opens a tab in the manager's browser with its own navigation
+// state and browser context, so it shares no cookies or storage with other
+// tabs. Cleanup closes it; it also closes with the manager.
+func (m *Manager) NewTab() (*Manager, error) {
+	if err := m.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	// A tab needs the browser to be running, which the first run does
+	parent := m.GetContext()
+	if err := chromedp.Run(parent); err != nil {
+		return nil, fmt.Errorf("failed to start browser: %w", err)
+	}
+
+	ctx, cancel := chromedp.NewContext(parent, chromedp.WithNewBrowserContext())
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open tab: %w", err)
+	}
+
+	m.mu.RLock()
+	store := m.artifacts
+	m.mu.RUnlock()
+
+	return &Manager{
+		ctx:          ctx,
+		cancel:       cancel,
+		shortTermMem: m.shortTermMem,
+		elements:     make([]models.BrowserElement, 0),
+		initialized:  true,
+		artifacts:    store,
+	}, nil
+}
+
 // Navigate navigates to a URL
 func (m *Manager) Navigate(url string) error {
 	if err := m.ensureInitialized(); err != nil {
@@ -76,7 +126,7 @@ func (m *Manager) Navigate(url string) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "navigate",
 		chromedp.Navigate(url),
 		chromedp.WaitReady("body"),
 	)
@@ -101,7 +151,7 @@ func (m *Manager) Click(elementID int) error {
 	defer cancel()
 
 	// Click at element coordinates
-	return chromedp.Run(ctx,
+	return m.run(ctx, "click",
 		chromedp.MouseClickXY(element.X+element.Width/2, element.Y+element.Height/2),
 	)
 }
@@ -125,7 +175,7 @@ func (m *Manager) Type(elementID int, text string) error {
 	defer cancel()
 
 	// Click element first, then type
-	return chromedp.Run(ctx,
+	return m.run(ctx, "type",
 		chromedp.MouseClickXY(element.X+element.Width/2, element.Y+element.Height/2),
 		chromedp.Sleep(100*time.Millisecond),
 		chromedp.SendKeys("body", text),
@@ -165,7 +215,7 @@ func (m *Manager) Scroll(x, y int) error {
 	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "scroll",
 		chromedp.Evaluate(fmt.Sprintf("window.scrollBy(%d, %d)", x, y), nil),
 	)
 }
@@ -180,7 +230,7 @@ func (m *Manager) ExecuteScript(script string) (interface{}, error) {
 	defer cancel()
 
 	var result interface{}
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "execute_script",
 		chromedp.Evaluate(script, &result),
 	)
 
@@ -197,7 +247,7 @@ func (m *Manager) GetPageTitle() (string, error) {
 	defer cancel()
 
 	var title string
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "get_page_title",
 		chromedp.Title(&title),
 	)
 
@@ -214,7 +264,7 @@ func (m *Manager) GetPageHTML() (string, error) {
 	defer cancel()
 
 	var html string
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "get_page_html",
 		chromedp.OuterHTML("html", &html),
 	)
 
@@ -230,7 +280,7 @@ func (m *Manager) WaitForElement(selector string, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(m.ctx, timeout)
 	defer cancel()
 
-	return chromedp.Run(ctx,
+	return m.run(ctx, "wait_for_element",
 		chromedp.WaitVisible(selector),
 	)
 }
@@ -253,9 +303,60 @@ func (m *Manager) Cleanup() error {
 	}
 
 	m.initialized = false
+	m.downloadsEnabled = false
 	return nil
 }
 
+// Ping evaluates a script in the browser's page, checking Chrome and its
+// target answer before ctx ends
+func (m *Manager) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	browserCtx, initialized := m.ctx, m.initialized
+	m.mu.RUnlock()
+
+	if !initialized {
+		return ErrNotStarted
+	}
+	if err := browserCtx.Err(); err != nil {
+		return fmt.Errorf("browser closed: %w", err)
+	}
+	if c := chromedp.FromContext(browserCtx); c == nil || c.Browser == nil || c.Target == nil {
+		return ErrNotStarted
+	}
+
+	// Bound the script by ctx without cancelling the browser's own context
+	pingCtx, cancel := context.WithCancel(browserCtx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	var result int
+	if err := chromedp.Run(pingCtx, chromedp.Evaluate(`1 + 1`, &result)); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("browser did not answer: %w", ctx.Err())
+		}
+		return fmt.Errorf("browser did not answer: %w", err)
+	}
+	return nil
+}
+
+// run runs chromedp tasks and counts them as one action
+func (m *Manager) run(ctx context.Context, action string, tasks ...chromedp.Action) error {
+	if enable := m.enableDownloads(); enable != nil {
+		if err := chromedp.Run(ctx, enable); err != nil {
+			slog.Warn("browser downloads won't be kept", "error", err)
+		}
+	}
+
+	err := chromedp.Run(ctx, tasks...)
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	actionsTotal.Inc(action, status)
+	return err
+}
+
 // ensureInitialized ensures the browser is initialized
 func (m *Manager) ensureInitialized() error {
 	m.mu.RLock()
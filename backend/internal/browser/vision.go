@@ -29,7 +29,7 @@ func (m *Manager) CaptureScreenshot(taskID string) ([]byte, error) {
 	defer cancel()
 
 	var buf []byte
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "capture_screenshot",
 		chromedp.CaptureScreenshot(&buf),
 	)
 
@@ -37,6 +37,7 @@ func (m *Manager) CaptureScreenshot(taskID string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to capture screenshot: %w", err)
 	}
 
+	m.keepScreenshot(taskID, buf)
 	return buf, nil
 }
 
@@ -162,7 +163,7 @@ func (m *Manager) detectElements() ([]models.BrowserElement, error) {
 	`
 
 	var result []map[string]interface{}
-	err := chromedp.Run(ctx,
+	err := m.run(ctx, "detect_elements",
 		chromedp.Evaluate(script, &result),
 	)
 
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"agent-workspace/backend/internal/agent"
+	"agent-workspace/backend/internal/artifacts"
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/internal/files"
+	"agent-workspace/backend/internal/health"
+	"agent-workspace/backend/internal/ratelimit"
+	"agent-workspace/backend/internal/usage"
+	"agent-workspace/backend/internal/webhooks"
+	"agent-workspace/backend/internal/websocket"
+	"agent-workspace/backend/internal/webui"
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/ollama"
+	"agent-workspace/backend/pkg/tracing"
+)
+
+// Where a setting's value came from, from weakest to strongest
+const (
+	SourceFile = "file"
+	SourceEnv  = "env"
+	SourceFlag = "flag"
+)
+
+// Server sets where the server listens and who may call it
+type Server struct {
+	Host           string // empty listens on every interface
+	Port           int
+	FrontendURL    string
+	Origins        []string // CORS_ORIGINS: origins browsers may call from, FrontendURL by default
+	TLSCert        string   // SERVER_TLS_CERT and SERVER_TLS_KEY serve HTTPS when both are set
+	TLSKey         string
+	TrustedProxies []string // SERVER_TRUSTED_PROXIES: addresses whose ProxyHeader names the client
+	ProxyHeader    string   // SERVER_PROXY_HEADER, X-Forwarded-For by default
+}
+
+// Addr is the address to listen on
+func (s Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Network is the network to listen on: IPv6 for an IPv6 host, else IPv4
+func (s Server) Network() string {
+	if ip := net.ParseIP(s.Host); ip != nil && ip.To4() == nil {
+		return "tcp6"
+	}
+	return "tcp4"
+}
+
+// TLS reports whether the server serves HTTPS
+func (s Server) TLS() bool {
+	return s.TLSCert != "" && s.TLSKey != ""
+}
+
+// Neo4j sets the graph database long-term memory connects to
+type Neo4j struct {
+	URI      string
+	User     string
+	Password string
+}
+
+// Features switches optional subsystems on and off
+type Features struct {
+	Watchdog        bool // WATCHDOG_ENABLED
+	WatchdogWatch   bool // WATCHDOG_WATCH: watch the workspace for changes
+	WatchdogCommits bool // WATCHDOG_COMMITS: check new commits
+	MemoryRerank    bool // MEMORY_RERANK: rerank memory hits with the model
+}
+
+// Config is the server's effective configuration, one typed section per
+// subsystem. Subsystems not given a section here still read their settings
+// from the environment, which Load fills from the file and flags too.
+type Config struct {
+	File      string // the YAML file loaded, or empty
+	Server    Server
+	Neo4j     Neo4j
+	Ollama    ollama.Config
+	LLM       llm.Config
+	Budget    models.TaskBudget // every agent task's
+	Auth      auth.Config
+	RateLimit ratelimit.Config
+	Logging   logging.Config
+	Tracing   tracing.Config
+	Files     files.Config
+	A2A       websocket.A2AConfig
+	Health    health.Config
+	WebUI     webui.Config
+	Webhooks  webhooks.Config
+	Artifacts artifacts.Config
+	Usage     usage.Config
+	Features  Features
+
+	sources      map[string]string // settings given by the file or flags, by name
+	jwtSecretSet bool
+}
+
+// Load reads the configuration. Settings are named like environment
+// variables; the environment overrides the YAML file named by -config or
+// CONFIG_FILE, and flags override both. The merged settings are written
+// back to the environment, then every section is parsed and validated; the
+// error lists every problem found.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	overrides := make(map[string]string)
+	flags.Func("set", "a setting as NAME=value; repeatable", func(value string) error {
+		name, setting, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected NAME=value, got %q", value)
+		}
+		overrides[strings.ToUpper(strings.TrimSpace(name))] = setting
+		return nil
+	})
+	flags.Func("port", "port to listen on (SERVER_PORT)", func(value string) error {
+		overrides["SERVER_PORT"] = value
+		return nil
+	})
+	flags.Func("host", "address to listen on, empty for every interface (SERVER_HOST)", func(value string) error {
+		overrides["SERVER_HOST"] = value
+		return nil
+	})
+	flags.Func("log-level", "debug, info, warn or error (LOG_LEVEL)", func(value string) error {
+		overrides["LOG_LEVEL"] = value
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	config := &Config{File: *file, sources: make(map[string]string)}
+	if config.File != "" {
+		settings, err := readFile(config.File)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range settings {
+			if _, ok := os.LookupEnv(name); ok {
+				config.sources[name] = SourceEnv
+				continue
+			}
+			os.Setenv(name, value)
+			config.sources[name] = SourceFile
+		}
+	}
+	for name, value := range overrides {
+		os.Setenv(name, value)
+		config.sources[name] = SourceFlag
+	}
+
+	return config, config.parse()
+}
+
+// parse fills every section from the environment
+func (c *Config) parse() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	c.Server = Server{
+		Host:        os.Getenv("SERVER_HOST"),
+		Port:        8080,
+		FrontendURL: "http://localhost:3000",
+		TLSCert:     os.Getenv("SERVER_TLS_CERT"),
+		TLSKey:      os.Getenv("SERVER_TLS_KEY"),
+		ProxyHeader: os.Getenv("SERVER_PROXY_HEADER"),
+	}
+	port := os.Getenv("SERVER_PORT")
+	if port == "" {
+		port = os.Getenv("PORT")
+	}
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			check(fmt.Errorf("invalid SERVER_PORT %q, expected 1-65535", port))
+		} else {
+			c.Server.Port = n
+		}
+	}
+	if value := os.Getenv("FRONTEND_URL"); value != "" {
+		c.Server.FrontendURL = value
+	}
+	c.Server.Origins = []string{strings.TrimSuffix(c.Server.FrontendURL, "/")}
+	if value := os.Getenv("CORS_ORIGINS"); value != "" {
+		c.Server.Origins = splitList(value)
+	}
+	for _, origin := range c.Server.Origins {
+		if _, err := parseOrigin(origin); err != nil {
+			check(fmt.Errorf("invalid CORS_ORIGINS entry: %w", err))
+		}
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		check(fmt.Errorf("SERVER_TLS_CERT and SERVER_TLS_KEY must be set together"))
+	}
+	for name, path := range map[string]string{"SERVER_TLS_CERT": c.Server.TLSCert, "SERVER_TLS_KEY": c.Server.TLSKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			check(fmt.Errorf("invalid %s: %w", name, err))
+		}
+	}
+	c.Server.TrustedProxies = splitList(os.Getenv("SERVER_TRUSTED_PROXIES"))
+	for _, proxy := range c.Server.TrustedProxies {
+		if !validProxy(proxy) {
+			check(fmt.Errorf("invalid SERVER_TRUSTED_PROXIES entry %q, expected an IP, a CIDR, loopback, private or link-local", proxy))
+		}
+	}
+	if c.Server.ProxyHeader == "" {
+		c.Server.ProxyHeader = "X-Forwarded-For"
+	}
+
+	c.Neo4j = Neo4j{URI: os.Getenv("NEO4J_URI"), User: os.Getenv("NEO4J_USER"), Password: os.Getenv("NEO4J_PASSWORD")}
+	for name, value := range map[string]string{"NEO4J_URI": c.Neo4j.URI, "NEO4J_USER": c.Neo4j.User, "NEO4J_PASSWORD": c.Neo4j.Password} {
+		if value == "" {
+			check(fmt.Errorf("required setting %s not set", name))
+		}
+	}
+
+	var err error
+	c.Ollama = ollama.ConfigFromEnv()
+	c.LLM, err = llm.ConfigFromEnv()
+	check(err)
+	c.Budget, err = agent.BudgetFromEnv()
+	check(err)
+	c.Auth, err = auth.ConfigFromEnv()
+	check(err)
+	c.jwtSecretSet = os.Getenv("JWT_SECRET") != ""
+	c.RateLimit, err = ratelimit.ConfigFromEnv()
+	check(err)
+	c.Logging, err = logging.ConfigFromEnv()
+	check(err)
+	c.Tracing, err = tracing.ConfigFromEnv()
+	check(err)
+	c.Files = files.ConfigFromEnv()
+	c.A2A = websocket.A2AConfigFromEnv()
+	c.Health, err = health.ConfigFromEnv()
+	check(err)
+	c.WebUI, err = webui.ConfigFromEnv()
+	check(err)
+	c.Webhooks, err = webhooks.ConfigFromEnv()
+	check(err)
+	c.Artifacts, err = artifacts.ConfigFromEnv()
+	check(err)
+	c.Usage, err = usage.ConfigFromEnv()
+	check(err)
+
+	c.Features = Features{Watchdog: true, WatchdogWatch: true, WatchdogCommits: true, MemoryRerank: true}
+	for name, feature := range map[string]*bool{
+		"WATCHDOG_ENABLED": &c.Features.Watchdog,
+		"WATCHDOG_WATCH":   &c.Features.WatchdogWatch,
+		"WATCHDOG_COMMITS": &c.Features.WatchdogCommits,
+		"MEMORY_RERANK":    &c.Features.MemoryRerank,
+	} {
+		if value := os.Getenv(name); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				check(fmt.Errorf("invalid %s %q, expected true or false", name, value))
+				continue
+			}
+			*feature = enabled
+		}
+	}
+
+	// Report problems in a stable order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// Sources names the settings given by the file or flags, and where each
+// came from
+func (c *Config) Sources() map[string]string {
+	sources := make(map[string]string, len(c.sources))
+	for name, source := range c.sources {
+		sources[name] = source
+	}
+	return sources
+}
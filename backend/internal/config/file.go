@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readFile reads a YAML configuration file into settings named like
+// environment variables. Nested keys are joined with underscores, so
+//
+//	rate_limit:
+//	  rest: 20,40
+//
+// sets RATE_LIMIT_REST; lists are joined with commas.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	settings := make(map[string]string)
+	if err := flatten(settings, "", document); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// flatten adds the settings under a YAML mapping, prefixing their names
+func flatten(settings map[string]string, prefix string, mapping map[string]interface{}) error {
+	for key, value := range mapping {
+		name := prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(settings, name+"_", v); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				if _, nested := item.(map[string]interface{}); nested {
+					return fmt.Errorf("%s: lists may only hold plain values", name)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			settings[name] = strings.Join(items, ",")
+		case nil:
+			settings[name] = ""
+		default:
+			settings[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Trusted proxy ranges that can be named instead of listed
+const (
+	ProxiesLoopback  = "loopback"
+	ProxiesPrivate   = "private"
+	ProxiesLinkLocal = "link-local"
+)
+
+// proxyRanges are the CIDRs each named range stands for
+var proxyRanges = map[string][]string{
+	ProxiesLoopback:  {"127.0.0.0/8", "::1/128"},
+	ProxiesPrivate:   {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+	ProxiesLinkLocal: {"169.254.0.0/16", "fe80::/10"},
+}
+
+// originPattern is an allowed origin. The port may be * for any port, as
+// in http://localhost:*, and the host may start with *. for any subdomain,
+// as in https://*.example.com.
+type originPattern struct {
+	scheme string
+	host   string
+	port   string
+}
+
+// parseOrigin reads an origin or origin pattern; * alone matches every origin
+func parseOrigin(origin string) (originPattern, error) {
+	if origin == "*" {
+		return originPattern{scheme: "*", host: "*", port: "*"}, nil
+	}
+
+	scheme, rest, ok := strings.Cut(strings.ToLower(strings.TrimSpace(origin)), "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return originPattern{}, fmt.Errorf("origin %q must start with http:// or https://", origin)
+	}
+	if rest == "" || strings.ContainsAny(rest, "/?#@") {
+		return originPattern{}, fmt.Errorf("origin %q must be a scheme and host, without a path", origin)
+	}
+
+	host, port := rest, ""
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "]") {
+		host, port = rest[:i], rest[i+1:]
+		if port == "" {
+			return originPattern{}, fmt.Errorf("origin %q has an empty port", origin)
+		}
+	}
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[scheme]
+	} else if _, err := strconv.ParseUint(port, 10, 16); err != nil && port != "*" {
+		return originPattern{}, fmt.Errorf("origin %q has an invalid port", origin)
+	}
+	if strings.Contains(strings.TrimPrefix(host, "*."), "*") || host == "*." {
+		return originPattern{}, fmt.Errorf("origin %q may only use * for the port or a leading subdomain", origin)
+	}
+	return originPattern{scheme: scheme, host: host, port: port}, nil
+}
+
+// matches reports whether an origin fits the pattern
+func (p originPattern) matches(origin originPattern) bool {
+	if p.scheme == "*" {
+		return true
+	}
+	if p.scheme != origin.scheme || (p.port != "*" && p.port != origin.port) {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.host, "*"); ok {
+		return strings.HasSuffix(origin.host, suffix)
+	}
+	return p.host == origin.host
+}
+
+// AllowsOrigin reports whether browsers may call the API and open
+// WebSockets from origin
+func (s Server) AllowsOrigin(origin string) bool {
+	parsed, err := parseOrigin(origin)
+	if err != nil || parsed.scheme == "*" || strings.Contains(parsed.host+parsed.port, "*") {
+		return false
+	}
+	for _, allowed := range s.Origins {
+		if pattern, err := parseOrigin(allowed); err == nil && pattern.matches(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedProxyList is the IPs and CIDRs the app trusts, named ranges
+// spelled out: with none listed, the client's address is the connection's
+func (s Server) TrustedProxyList() []string {
+	proxies := make([]string, 0, len(s.TrustedProxies))
+	for _, proxy := range s.TrustedProxies {
+		if ranges, ok := proxyRanges[strings.ToLower(proxy)]; ok {
+			proxies = append(proxies, ranges...)
+		} else {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// validProxy reports whether a trusted proxy is an IP, a CIDR or a named range
+func validProxy(proxy string) bool {
+	if _, ok := proxyRanges[strings.ToLower(proxy)]; ok {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return true
+	}
+	return net.ParseIP(proxy) != nil
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
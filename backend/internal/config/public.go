@@ -0,0 +1,159 @@
+package config
+
+import (
+	"sort"
+
+	"agent-workspace/backend/internal/webui"
+	"agent-workspace/backend/pkg/llm"
+)
+
+// Public returns the configuration with secrets left out: passwords, keys
+// and export headers are only reported as set or not
+func (c *Config) Public() map[string]interface{} {
+	headers := make([]string, 0, len(c.Tracing.Headers))
+	for name := range c.Tracing.Headers {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+
+	format := "text"
+	if c.Logging.JSON {
+		format = "json"
+	}
+
+	return map[string]interface{}{
+		"file": c.File,
+		"server": map[string]interface{}{
+			"host":            c.Server.Host,
+			"port":            c.Server.Port,
+			"frontend_url":    c.Server.FrontendURL,
+			"origins":         c.Server.Origins,
+			"tls":             c.Server.TLS(),
+			"tls_cert":        c.Server.TLSCert,
+			"tls_key":         c.Server.TLSKey,
+			"trusted_proxies": c.Server.TrustedProxies,
+			"proxy_header":    c.Server.ProxyHeader,
+		},
+		"neo4j": map[string]interface{}{
+			"uri":          c.Neo4j.URI,
+			"user":         c.Neo4j.User,
+			"password_set": c.Neo4j.Password != "",
+		},
+		"ollama": map[string]interface{}{
+			"host":            c.Ollama.Host,
+			"model":           c.Ollama.Model,
+			"embed_model":     c.Ollama.EmbedModel,
+			"vision_model":    c.Ollama.VisionModel,
+			"native_tools":    c.Ollama.NativeTools,
+			"num_ctx":         c.Ollama.Options.NumCtx,
+			"keep_alive":      c.Ollama.Options.KeepAlive,
+			"max_concurrency": c.Ollama.MaxConcurrency,
+		},
+		"llm": map[string]interface{}{
+			"planner":  publicRole(c.LLM.Planner),
+			"reasoner": publicRole(c.LLM.Reasoner),
+			"embedder": publicRole(c.LLM.Embedder),
+			"policy": map[string]interface{}{
+				"timeout":           c.LLM.Policy.Timeout.String(),
+				"embed_timeout":     c.LLM.Policy.EmbedTimeout.String(),
+				"max_retries":       c.LLM.Policy.MaxRetries,
+				"retry_backoff":     c.LLM.Policy.RetryBackoff.String(),
+				"breaker_threshold": c.LLM.Policy.BreakerThreshold,
+				"breaker_cooldown":  c.LLM.Policy.BreakerCooldown.String(),
+			},
+			"cache": map[string]interface{}{
+				"ttl":             c.LLM.Cache.TTL.String(),
+				"max_temperature": c.LLM.Cache.MaxTemperature,
+				"max_entries":     c.LLM.Cache.MaxEntries,
+			},
+		},
+		"budget": map[string]interface{}{
+			"task_max_tokens":  c.Budget.MaxTokens,
+			"task_max_seconds": c.Budget.MaxSeconds,
+		},
+		"auth": map[string]interface{}{
+			"enabled":       c.Auth.Enabled,
+			"keys_path":     c.Auth.KeysPath,
+			"session_ttl":   c.Auth.SessionTTL.String(),
+			"admin_key_set": c.Auth.AdminKey != "",
+			// A secret is generated when none is set
+			"jwt_secret_set": c.jwtSecretSet,
+		},
+		"rate_limit": map[string]interface{}{
+			"rest":         c.RateLimit.REST.String(),
+			"heavy":        c.RateLimit.Heavy.String(),
+			"heavy_routes": c.RateLimit.HeavyRoutes,
+			"websocket":    c.RateLimit.WebSocket.String(),
+		},
+		"logging": map[string]interface{}{
+			"level":     c.Logging.Level.String(),
+			"format":    format,
+			"tail_size": c.Logging.TailSize,
+		},
+		"tracing": map[string]interface{}{
+			"enabled":      c.Tracing.Endpoint != "",
+			"endpoint":     c.Tracing.Endpoint,
+			"service_name": c.Tracing.ServiceName,
+			"sample_ratio": c.Tracing.SampleRatio,
+			"headers":      headers,
+		},
+		"files": map[string]interface{}{
+			"root":          c.Files.Root,
+			"max_bytes":     c.Files.MaxBytes,
+			"backup_dir":    c.Files.BackupDir,
+			"tree_ignore":   c.Files.TreeIgnore,
+			"registry_path": c.Files.RegistryPath,
+		},
+		"a2a": map[string]interface{}{
+			"workers":       c.A2A.Workers,
+			"queue_size":    c.A2A.QueueSize,
+			"method_limits": c.A2A.MethodLimits,
+		},
+		"health": map[string]interface{}{
+			"interval": c.Health.Interval.String(),
+			"timeout":  c.Health.Timeout.String(),
+			"required": c.Health.Required,
+		},
+		"webui": map[string]interface{}{
+			"enabled":  c.WebUI.Enabled,
+			"dir":      c.WebUI.Dir,
+			"embedded": webui.Embedded(),
+		},
+		"webhooks": map[string]interface{}{
+			"db_path":       c.Webhooks.DBPath,
+			"max_attempts":  c.Webhooks.MaxAttempts,
+			"timeout":       c.Webhooks.Timeout.String(),
+			"retry_backoff": c.Webhooks.RetryBackoff.String(),
+			"log_size":      c.Webhooks.LogSize,
+		},
+		"artifacts": map[string]interface{}{
+			"dir":       c.Artifacts.Dir,
+			"db_path":   c.Artifacts.DBPath,
+			"max_bytes": c.Artifacts.MaxBytes,
+		},
+		"usage": map[string]interface{}{
+			"db_path":        c.Usage.DBPath,
+			"retention_days": c.Usage.RetentionDays,
+		},
+		"features": map[string]interface{}{
+			"watchdog":         c.Features.Watchdog,
+			"watchdog_watch":   c.Features.WatchdogWatch,
+			"watchdog_commits": c.Features.WatchdogCommits,
+			"memory_rerank":    c.Features.MemoryRerank,
+		},
+		"sources": c.Sources(),
+	}
+}
+
+// publicRole reports a role's provider settings, its API key only as set or not
+func publicRole(role llm.RoleConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"provider":        role.Provider,
+		"base_url":        role.BaseURL,
+		"model":           role.Model,
+		"max_tokens":      role.MaxTokens,
+		"context_window":  role.ContextWindow,
+		"fallback_models": role.FallbackModels,
+		"api_key_set":     role.APIKey != "",
+	}
+}
@@ -0,0 +1,427 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidDiff is returned for patches that can't be parsed or that
+	// touch more than one file
+	ErrInvalidDiff = errors.New("invalid diff")
+	// ErrConflict is returned when a diff doesn't apply cleanly
+	ErrConflict = errors.New("diff does not apply cleanly")
+)
+
+// Hunk statuses reported by ApplyDiff
+const (
+	HunkApplied  = "applied"  // matched where the header said
+	HunkOffset   = "offset"   // matched elsewhere in the file
+	HunkMerged   = "merged"   // merged three-way with nearby changes
+	HunkConflict = "conflict" // overlaps changes the diff didn't expect
+)
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// HunkResult reports how one hunk was applied
+type HunkResult struct {
+	Index    int    `json:"index"`
+	OldStart int    `json:"old_start"`
+	Line     int    `json:"line"`             // where the hunk landed, 1-based
+	Offset   int    `json:"offset,omitempty"` // lines away from where the header said
+	Status   string `json:"status"`
+	Current  string `json:"current,omitempty"` // conflicting lines in the file
+	Incoming string `json:"incoming,omitempty"`
+}
+
+// DiffResult is the outcome of applying a diff to a file
+type DiffResult struct {
+	Path      string       `json:"path"`
+	DryRun    bool         `json:"dry_run"`
+	Applied   bool         `json:"applied"` // the file was written
+	Created   bool         `json:"created,omitempty"`
+	Deleted   bool         `json:"deleted,omitempty"`
+	Hunks     []HunkResult `json:"hunks"`
+	Conflicts int          `json:"conflicts"`
+	Additions int          `json:"additions"`
+	Deletions int          `json:"deletions"`
+	Content   string       `json:"content"` // the patched file, with conflict markers if any
+	Backup    string       `json:"backup,omitempty"`
+}
+
+// patchHunk is one parsed hunk of a single-file diff
+type patchHunk struct {
+	oldStart int
+	old      []string // context and removed lines
+	new      []string // context and added lines
+}
+
+// filePatch is a parsed single-file diff
+type filePatch struct {
+	create bool // old side is /dev/null
+	delete bool // new side is /dev/null
+	hunks  []patchHunk
+}
+
+// ApplyDiff applies a unified diff to a file. Hunks that no longer match
+// are found again nearby, or merged three-way with what changed around
+// them. A dry run, or a diff with conflicts, leaves the file alone and
+// returns the would-be content; conflicts also return ErrConflict. Before
+// a file is changed its original is copied to the backup directory.
+func (w *Workspace) ApplyDiff(path, diff string, dryRun bool) (*DiffResult, error) {
+	patch, err := parsePatch(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := w.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &DiffResult{Path: w.Rel(abs), DryRun: dryRun, Hunks: make([]HunkResult, 0, len(patch.hunks))}
+
+	original := ""
+	exists := true
+	if _, err := os.Stat(abs); errors.Is(err, os.ErrNotExist) && patch.create {
+		exists = false
+		result.Created = true
+	} else if err == nil && patch.create {
+		return nil, fmt.Errorf("%w: the diff creates %s", ErrExists, path)
+	} else {
+		file, err := w.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		original = file.Content
+	}
+
+	result.Content = applyHunks(original, patch.hunks, result)
+	result.Deleted = patch.delete && result.Conflicts == 0 && result.Content == ""
+	if result.Conflicts > 0 {
+		return result, fmt.Errorf("%w: %d of %d hunks conflict in %s", ErrConflict, result.Conflicts, len(patch.hunks), path)
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if exists {
+		if result.Backup, err = w.backup(abs, original); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case result.Deleted:
+		if err := os.Remove(abs); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+	case exists:
+		if _, err := w.Write(path, result.Content); err != nil {
+			return nil, err
+		}
+	default:
+		if _, err := w.Create(path, result.Content, false); err != nil {
+			return nil, err
+		}
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// backup copies a file's original content into the backup directory,
+// mirroring its path and stamping the copy with the time
+func (w *Workspace) backup(abs, content string) (string, error) {
+	if w.backupDir == "" {
+		return "", nil
+	}
+	rel := filepath.FromSlash(w.Rel(abs))
+	dst := filepath.Join(w.backupDir, rel+"."+time.Now().UTC().Format("20060102T150405.000000000")+".orig")
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", rel, err)
+	}
+	if err := os.WriteFile(dst, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", rel, err)
+	}
+	return dst, nil
+}
+
+// parsePatch parses a unified diff for a single file. The ---/+++ headers
+// are optional; more than one pair is refused.
+func parsePatch(diff string) (*filePatch, error) {
+	patch := &filePatch{}
+	var hunk *patchHunk
+	oldLeft, newLeft, headers := 0, 0, 0
+
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				hunk.new = append(hunk.new, line[1:])
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				hunk.old = append(hunk.old, line[1:])
+				oldLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				content := strings.TrimPrefix(line, " ")
+				hunk.old = append(hunk.old, content)
+				hunk.new = append(hunk.new, content)
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			if headers++; headers > 1 {
+				return nil, fmt.Errorf("%w: it changes more than one file", ErrInvalidDiff)
+			}
+			patch.create = isDevNull(line[4:])
+		case strings.HasPrefix(line, "+++ "):
+			patch.delete = isDevNull(line[4:])
+		case strings.HasPrefix(line, "@@"):
+			match := hunkHeaderPattern.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("%w: malformed hunk header: %s", ErrInvalidDiff, line)
+			}
+			if hunk != nil {
+				patch.hunks = append(patch.hunks, *hunk)
+			}
+			hunk = &patchHunk{oldStart: atoiOr(match[1], 0)}
+			oldLeft, newLeft = atoiOr(match[2], 1), atoiOr(match[4], 1)
+		}
+	}
+	if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+		return nil, fmt.Errorf("%w: it ends inside a hunk", ErrInvalidDiff)
+	}
+	if hunk != nil {
+		patch.hunks = append(patch.hunks, *hunk)
+	}
+	if len(patch.hunks) == 0 {
+		return nil, fmt.Errorf("%w: no hunks", ErrInvalidDiff)
+	}
+	return patch, nil
+}
+
+// applyHunks applies hunks in order, recording each one's outcome and the
+// line counts in result
+func applyHunks(content string, hunks []patchHunk, result *DiffResult) string {
+	lines, trailingNewline := splitLines(content)
+	delta := 0 // how far earlier hunks moved the lines after them
+
+	for i, hunk := range hunks {
+		expected := hunk.oldStart - 1 + delta
+		if len(hunk.old) == 0 {
+			expected++ // a pure insertion's header names the line before it
+		}
+		expected = clamp(expected, 0, len(lines))
+
+		report := HunkResult{Index: i, OldStart: hunk.oldStart}
+		replacement, at, span := hunk.new, expected, len(hunk.old)
+
+		if pos, ok := findLines(lines, hunk.old, expected); ok {
+			at = pos
+			report.Status = HunkApplied
+			if pos != expected {
+				report.Status = HunkOffset
+				report.Offset = pos - expected
+			}
+		} else {
+			// The context moved on: merge the hunk with what's at its place now
+			span = clamp(len(hunk.old), 0, len(lines)-at)
+			current := lines[at : at+span]
+			merged, conflicts := merge3(hunk.old, current, hunk.new)
+			replacement = merged
+			report.Status = HunkMerged
+			if conflicts {
+				report.Status = HunkConflict
+				report.Current = strings.Join(current, "\n")
+				report.Incoming = strings.Join(hunk.new, "\n")
+				result.Conflicts++
+			}
+		}
+
+		result.Additions += len(hunk.new) - commonLines(hunk.old, hunk.new)
+		result.Deletions += len(hunk.old) - commonLines(hunk.old, hunk.new)
+		report.Line = at + 1
+
+		next := make([]string, 0, len(lines)-span+len(replacement))
+		next = append(next, lines[:at]...)
+		next = append(next, replacement...)
+		next = append(next, lines[at+span:]...)
+		lines = next
+		delta = at + len(replacement) - (hunk.oldStart - 1 + len(hunk.old))
+		if len(hunk.old) == 0 {
+			delta--
+		}
+		result.Hunks = append(result.Hunks, report)
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	joined := strings.Join(lines, "\n")
+	if trailingNewline || content == "" {
+		joined += "\n"
+	}
+	return joined
+}
+
+// findLines finds want in lines, preferring the position closest to near
+func findLines(lines, want []string, near int) (int, bool) {
+	if len(want) == 0 {
+		return near, true
+	}
+	last := len(lines) - len(want)
+	for distance := 0; near-distance >= 0 || near+distance <= last; distance++ {
+		if pos := near - distance; pos >= 0 && pos <= last && equalLines(lines[pos:pos+len(want)], want) {
+			return pos, true
+		}
+		if pos := near + distance; distance > 0 && pos >= 0 && pos <= last && equalLines(lines[pos:pos+len(want)], want) {
+			return pos, true
+		}
+	}
+	return 0, false
+}
+
+// merge3 merges the changes from base to ours and from base to theirs.
+// Where both changed the same lines differently the result holds both
+// between conflict markers and conflicts is set.
+func merge3(base, ours, theirs []string) (merged []string, conflicts bool) {
+	toOurs, toTheirs := matchLines(base, ours), matchLines(base, theirs)
+	merged = make([]string, 0, len(ours)+len(theirs))
+	b, o, t := 0, 0, 0
+
+	for {
+		// The next base line both sides kept is where they agree again
+		sync := b
+		for sync < len(base) && (toOurs[sync] < 0 || toTheirs[sync] < 0) {
+			sync++
+		}
+		oEnd, tEnd := len(ours), len(theirs)
+		if sync < len(base) {
+			oEnd, tEnd = toOurs[sync], toTheirs[sync]
+		}
+
+		baseChunk, ourChunk, theirChunk := base[b:sync], ours[o:oEnd], theirs[t:tEnd]
+		switch {
+		case equalLines(ourChunk, baseChunk):
+			merged = append(merged, theirChunk...)
+		case equalLines(theirChunk, baseChunk), equalLines(ourChunk, theirChunk):
+			merged = append(merged, ourChunk...)
+		default:
+			conflicts = true
+			merged = append(merged, "<<<<<<< current")
+			merged = append(merged, ourChunk...)
+			merged = append(merged, "=======")
+			merged = append(merged, theirChunk...)
+			merged = append(merged, ">>>>>>> diff")
+		}
+
+		if sync == len(base) {
+			return merged, conflicts
+		}
+		merged = append(merged, base[sync])
+		b, o, t = sync+1, oEnd+1, tEnd+1
+	}
+}
+
+// matchLines maps each line of a to the line of b it's paired with in a
+// longest common subsequence, or -1
+func matchLines(a, b []string) []int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	matches := make([]int, len(a))
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case j < len(b) && a[i] == b[j]:
+			matches[i] = j
+			i++
+			j++
+		case j < len(b) && lcs[i][j+1] >= lcs[i+1][j]:
+			j++
+		default:
+			matches[i] = -1
+			i++
+		}
+	}
+	return matches
+}
+
+// commonLines counts the lines two sides of a hunk share
+func commonLines(a, b []string) int {
+	count := 0
+	for _, match := range matchLines(a, b) {
+		if match >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// splitLines splits content into lines, reporting whether it ended in a newline
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return []string{}, false
+	}
+	trailing := strings.HasSuffix(content, "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n"), trailing
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func clamp(n, low, high int) int {
+	if n < low {
+		return low
+	}
+	if n > high {
+		return high
+	}
+	return n
+}
+
+func isDevNull(path string) bool {
+	if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+		path = path[:tab]
+	}
+	return path == "/dev/null"
+}
+
+func atoiOr(s string, fallback int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return fallback
+}
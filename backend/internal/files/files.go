@@ -0,0 +1,398 @@
+package files
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+var (
+	// ErrInvalidPath is returned for empty or malformed paths
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrOutsideWorkspace is returned for paths that leave the workspace root
+	ErrOutsideWorkspace = errors.New("path is outside the workspace")
+	// ErrNotFound is returned for files that don't exist
+	ErrNotFound = errors.New("file not found")
+	// ErrExists is returned when creating or renaming onto an existing file
+	ErrExists = errors.New("file already exists")
+	// ErrIsDirectory is returned when a file operation is given a directory
+	ErrIsDirectory = errors.New("path is a directory")
+	// ErrNotEmpty is returned when deleting a non-empty directory without recursive
+	ErrNotEmpty = errors.New("directory is not empty")
+	// ErrTooLarge is returned for files over the size limit
+	ErrTooLarge = errors.New("file too large")
+	// ErrBinary is returned when reading a file that isn't text
+	ErrBinary = errors.New("file is not text")
+)
+
+// Config configures the file endpoints
+type Config struct {
+	Root      string // every path is confined to this directory
+	MaxBytes  int64  // largest file that can be read or written
+	BackupDir string // where originals are kept before a diff changes them; empty disables backups
+	// TreeIgnore are names the tree leaves out on top of .gitignore and .agentignore
+	TreeIgnore []string
+	// RegistryPath is where the open workspaces and the active one are saved
+	RegistryPath string
+}
+
+// DefaultConfig serves the working directory with a 1 MB file limit
+func DefaultConfig() Config {
+	return Config{
+		Root:         ".",
+		MaxBytes:     1024 * 1024,
+		BackupDir:    "./data/file-backups",
+		TreeIgnore:   []string{"node_modules", "vendor"},
+		RegistryPath: "./data/workspaces.json",
+	}
+}
+
+// ConfigFromEnv reads WORKSPACE_ROOT, FILES_MAX_KB, FILES_BACKUP_DIR,
+// FILES_TREE_IGNORE and WORKSPACES_PATH
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+	if root := os.Getenv("WORKSPACE_ROOT"); root != "" {
+		config.Root = root
+	}
+	if dir, ok := os.LookupEnv("FILES_BACKUP_DIR"); ok {
+		config.BackupDir = dir
+	}
+	if path, ok := os.LookupEnv("WORKSPACES_PATH"); ok {
+		config.RegistryPath = path
+	}
+	if names, ok := os.LookupEnv("FILES_TREE_IGNORE"); ok {
+		config.TreeIgnore = make([]string, 0)
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.TreeIgnore = append(config.TreeIgnore, name)
+			}
+		}
+	}
+	if kb, err := strconv.Atoi(os.Getenv("FILES_MAX_KB")); err == nil && kb > 0 {
+		config.MaxBytes = int64(kb) * 1024
+	}
+	return config
+}
+
+// Workspace reads and writes files under a root directory
+type Workspace struct {
+	root       string // absolute, symlinks resolved
+	maxBytes   int64
+	backupDir  string // absolute, or empty
+	treeIgnore map[string]bool
+
+	listMu   sync.Mutex
+	listings map[string]dirListing // directory listings by absolute path
+}
+
+// NewWorkspace opens the workspace rooted at config.Root
+func NewWorkspace(config Config) (*Workspace, error) {
+	root, err := filepath.Abs(config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workspace root: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("workspace root %s is not a directory", root)
+	}
+
+	maxBytes := config.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultConfig().MaxBytes
+	}
+	backupDir := config.BackupDir
+	if backupDir != "" {
+		if backupDir, err = filepath.Abs(backupDir); err != nil {
+			return nil, fmt.Errorf("failed to resolve backup directory: %w", err)
+		}
+	}
+	treeIgnore := make(map[string]bool)
+	for _, name := range config.TreeIgnore {
+		treeIgnore[name] = true
+	}
+	return &Workspace{
+		root:       root,
+		maxBytes:   maxBytes,
+		backupDir:  backupDir,
+		treeIgnore: treeIgnore,
+		listings:   make(map[string]dirListing),
+	}, nil
+}
+
+// Root returns the workspace's absolute root
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// Resolve turns a path relative to the root, or absolute inside it, into
+// an absolute path, refusing paths that leave the root directly or through
+// a symlink. The path itself needn't exist.
+func (w *Workspace) Resolve(path string) (string, error) {
+	if strings.TrimSpace(path) == "" || strings.ContainsRune(path, 0) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, path)
+	}
+
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(w.root, path)
+	}
+	abs = filepath.Clean(abs)
+	if !w.contains(abs) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideWorkspace, path)
+	}
+
+	if abs == w.root {
+		return w.root, nil
+	}
+
+	// Resolve symlinks in the part of the parent that exists, so a linked
+	// directory inside the workspace can't lead out of it
+	existing, rest := filepath.Dir(abs), ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = filepath.Dir(existing)
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	resolved := filepath.Join(real, rest, filepath.Base(abs))
+	if !w.contains(resolved) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideWorkspace, path)
+	}
+
+	// The path itself may be a link; it's used as one, but must point inside
+	if info, err := os.Lstat(resolved); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(resolved)
+		if err == nil && !w.contains(target) {
+			return "", fmt.Errorf("%w: %s links outside it", ErrOutsideWorkspace, path)
+		}
+	}
+	return resolved, nil
+}
+
+// Rel returns an absolute path inside the workspace relative to its root
+func (w *Workspace) Rel(abs string) string {
+	rel, err := filepath.Rel(w.root, abs)
+	if err != nil {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
+
+// contains reports whether a clean absolute path is the root or under it
+func (w *Workspace) contains(abs string) bool {
+	rel, err := filepath.Rel(w.root, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Read returns a text file's content and language
+func (w *Workspace) Read(path string) (*models.FileContent, error) {
+	abs, err := w.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, statError(path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrIsDirectory, path)
+	}
+	if info.Size() > w.maxBytes {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrTooLarge, path, info.Size(), w.maxBytes)
+	}
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: %s", ErrBinary, path)
+	}
+
+	return &models.FileContent{
+		Path:     w.Rel(abs),
+		Content:  string(data),
+		Language: DetectLanguage(abs),
+		Size:     int64(len(data)),
+	}, nil
+}
+
+// Write replaces an existing file's content, keeping its permissions
+func (w *Workspace) Write(path, content string) (*models.FileContent, error) {
+	abs, err := w.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, statError(path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrIsDirectory, path)
+	}
+	if err := w.writeFile(abs, content, info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	return w.describe(abs, content), nil
+}
+
+// Create makes a new file with content, or a directory when dir is set,
+// creating missing parent directories
+func (w *Workspace) Create(path, content string, dir bool) (*models.FileContent, error) {
+	abs, err := w.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	if abs == w.root {
+		return nil, fmt.Errorf("%w: %s is the workspace root", ErrExists, path)
+	}
+	if _, err := os.Lstat(abs); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrExists, path)
+	}
+
+	if dir {
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		return &models.FileContent{Path: w.Rel(abs)}, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := w.writeFile(abs, content, 0644); err != nil {
+		return nil, err
+	}
+	return w.describe(abs, content), nil
+}
+
+// Delete removes a file, or a directory: an empty one, or any when
+// recursive is set. The root can't be deleted.
+func (w *Workspace) Delete(path string, recursive bool) error {
+	abs, err := w.Resolve(path)
+	if err != nil {
+		return err
+	}
+	if abs == w.root {
+		return fmt.Errorf("%w: can't delete the workspace root", ErrInvalidPath)
+	}
+
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return statError(path, err)
+	}
+	if info.IsDir() && !recursive {
+		if entries, err := os.ReadDir(abs); err == nil && len(entries) > 0 {
+			return fmt.Errorf("%w: %s", ErrNotEmpty, path)
+		}
+	}
+
+	if recursive {
+		err = os.RemoveAll(abs)
+	} else {
+		err = os.Remove(abs)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", path, err)
+	}
+	return nil
+}
+
+// Rename moves a file or directory, refusing to replace an existing one
+func (w *Workspace) Rename(from, to string) (string, error) {
+	src, err := w.Resolve(from)
+	if err != nil {
+		return "", err
+	}
+	dst, err := w.Resolve(to)
+	if err != nil {
+		return "", err
+	}
+	if src == w.root || dst == w.root {
+		return "", fmt.Errorf("%w: can't rename the workspace root", ErrInvalidPath)
+	}
+
+	if _, err := os.Lstat(src); err != nil {
+		return "", statError(from, err)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return "", fmt.Errorf("%w: %s", ErrExists, to)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to rename %s: %w", from, err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return "", fmt.Errorf("failed to rename %s: %w", from, err)
+	}
+	return w.Rel(dst), nil
+}
+
+// writeFile writes content through a temporary file so readers never see
+// a partial write
+func (w *Workspace) writeFile(abs, content string, perm fs.FileMode) error {
+	if int64(len(content)) > w.maxBytes {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, len(content), w.maxBytes)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(abs), "."+filepath.Base(abs)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", w.Rel(abs), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", w.Rel(abs), err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", w.Rel(abs), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", w.Rel(abs), err)
+	}
+	if err := os.Rename(tmp.Name(), abs); err != nil {
+		return fmt.Errorf("failed to write %s: %w", w.Rel(abs), err)
+	}
+	return nil
+}
+
+// describe returns what was written to a file
+func (w *Workspace) describe(abs, content string) *models.FileContent {
+	return &models.FileContent{
+		Path:     w.Rel(abs),
+		Language: DetectLanguage(abs),
+		Size:     int64(len(content)),
+	}
+}
+
+// statError wraps a stat failure, mapping a missing file to ErrNotFound
+func statError(path string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	return fmt.Errorf("failed to stat %s: %w", path, err)
+}
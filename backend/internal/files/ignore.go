@@ -0,0 +1,127 @@
+package files
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one pattern from a .gitignore file
+type ignoreRule struct {
+	base     string // directory of the .gitignore, slash-separated, "" for the root
+	pattern  string
+	negate   bool // "!pattern" re-includes
+	dirOnly  bool // "pattern/" only matches directories
+	anchored bool // a slash before the end ties the pattern to base
+}
+
+// ignoreFiles are read in each directory, later ones taking precedence;
+// .agentignore hides paths from the agent that git still tracks
+var ignoreFiles = []string{".gitignore", ".agentignore"}
+
+// loadIgnoreRules reads the ignore files in dir, if there are any. base is
+// dir relative to the workspace root.
+func loadIgnoreRules(dir, base string) []ignoreRule {
+	rules := make([]ignoreRule, 0)
+	for _, name := range ignoreFiles {
+		rules = append(rules, readIgnoreFile(filepath.Join(dir, name), base)...)
+	}
+	return rules
+}
+
+// readIgnoreFile parses one gitignore-style file
+func readIgnoreFile(path, base string) []ignoreRule {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	rules := make([]ignoreRule, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`) // "\#" and "\!" are literal
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// matches reports whether the rule applies to a slash-separated path
+// relative to the workspace root
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if r.anchored {
+		return matchGlob(r.pattern, rel)
+	}
+	return matchGlob(r.pattern, path.Base(rel))
+}
+
+// ignored reports whether the last rule matching a path excludes it
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	excluded := false
+	for _, rule := range rules {
+		if rule.matches(rel, isDir) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// matchGlob matches a slash-separated path against a glob in which "**"
+// stands for any number of directories
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(name); skip++ {
+				if matchSegments(pattern[1:], name[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,76 @@
+package files
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languages maps file extensions to the language editors highlight them as
+var languages = map[string]string{
+	".go":    "go",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".py":    "python",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".php":   "php",
+	".swift": "swift",
+	".sh":    "shell",
+	".bash":  "shell",
+	".zsh":   "shell",
+	".ps1":   "powershell",
+	".sql":   "sql",
+	".html":  "html",
+	".htm":   "html",
+	".css":   "css",
+	".scss":  "scss",
+	".less":  "less",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".md":    "markdown",
+	".proto": "protobuf",
+	".lua":   "lua",
+	".r":     "r",
+	".txt":   "plaintext",
+}
+
+// fileNames maps well-known extensionless files to their language
+var fileNames = map[string]string{
+	"dockerfile": "dockerfile",
+	"makefile":   "makefile",
+	"go.mod":     "go",
+	"go.sum":     "plaintext",
+	".env":       "shell",
+	".gitignore": "plaintext",
+}
+
+// DetectLanguage guesses a file's language from its name, returning
+// "plaintext" when it doesn't know
+func DetectLanguage(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	if language, ok := fileNames[name]; ok {
+		return language
+	}
+	if strings.HasPrefix(name, ".env.") {
+		return "shell"
+	}
+	if language, ok := languages[filepath.Ext(name)]; ok {
+		return language
+	}
+	return "plaintext"
+}
@@ -0,0 +1,297 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWorkspace is the workspace rooted at WORKSPACE_ROOT; it can't be
+// closed and is active until another is switched to
+const DefaultWorkspace = "default"
+
+var (
+	// ErrInvalidWorkspace is returned for bad workspace names and roots
+	ErrInvalidWorkspace = errors.New("invalid workspace")
+	// ErrWorkspaceNotFound is returned for workspaces that were never opened
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	// ErrWorkspaceExists is returned when opening a name already used for another root
+	ErrWorkspaceExists = errors.New("workspace already exists")
+)
+
+// workspaceNamePattern matches the memory system's workspace names, which
+// workspace names double as
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,47}$`)
+
+// WorkspaceInfo describes an open workspace
+type WorkspaceInfo struct {
+	Name     string    `json:"name"`
+	Root     string    `json:"root"`
+	Active   bool      `json:"active"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// registryState is what the registry persists
+type registryState struct {
+	Active     string          `json:"active"`
+	Workspaces []WorkspaceInfo `json:"workspaces"`
+}
+
+// Registry keeps the workspace roots that have been opened, which one is
+// active, and a Workspace for each. The selection survives restarts.
+type Registry struct {
+	config Config
+	path   string // state file; empty keeps the selection in memory only
+
+	mu         sync.Mutex
+	active     string
+	infos      map[string]WorkspaceInfo
+	workspaces map[string]*Workspace // opened on first use
+}
+
+// NewRegistry opens the default workspace at config.Root and restores the
+// workspaces and selection saved at config.RegistryPath. Saved workspaces
+// whose root is gone stay listed but fail when used.
+func NewRegistry(config Config) (*Registry, error) {
+	defaultWorkspace, err := NewWorkspace(config)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{
+		config:     config,
+		path:       config.RegistryPath,
+		active:     DefaultWorkspace,
+		infos:      make(map[string]WorkspaceInfo),
+		workspaces: map[string]*Workspace{DefaultWorkspace: defaultWorkspace},
+	}
+
+	var state registryState
+	if r.path != "" {
+		data, err := os.ReadFile(r.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read workspaces: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &state); err != nil {
+				return nil, fmt.Errorf("failed to decode workspaces: %w", err)
+			}
+		}
+	}
+
+	for _, info := range state.Workspaces {
+		if info.Name != DefaultWorkspace && workspaceNamePattern.MatchString(info.Name) {
+			info.Active = false
+			r.infos[info.Name] = info
+		}
+	}
+	// The default workspace always follows WORKSPACE_ROOT
+	opened := time.Now().UTC()
+	for _, info := range state.Workspaces {
+		if info.Name == DefaultWorkspace {
+			opened = info.OpenedAt
+		}
+	}
+	r.infos[DefaultWorkspace] = WorkspaceInfo{Name: DefaultWorkspace, Root: defaultWorkspace.Root(), OpenedAt: opened}
+
+	if _, ok := r.infos[state.Active]; ok {
+		r.active = state.Active
+	}
+	return r, nil
+}
+
+// Active returns the active workspace's name
+func (r *Registry) Active() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.active
+}
+
+// Get returns a workspace by name, or the active one for ""
+func (r *Registry) Get(name string) (*Workspace, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if name == "" {
+		name = r.active
+	}
+	if ws, ok := r.workspaces[name]; ok {
+		return ws, nil
+	}
+	info, ok := r.infos[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, name)
+	}
+
+	ws, err := NewWorkspace(r.configFor(name, info.Root))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidWorkspace, name, err)
+	}
+	r.workspaces[name] = ws
+	return ws, nil
+}
+
+// List returns every open workspace, the default first and the rest by name
+func (r *Registry) List() []WorkspaceInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]WorkspaceInfo, 0, len(r.infos))
+	for _, info := range r.infos {
+		info.Active = info.Name == r.active
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if (list[i].Name == DefaultWorkspace) != (list[j].Name == DefaultWorkspace) {
+			return list[i].Name == DefaultWorkspace
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Open adds a workspace rooted at an existing directory, switching to it
+// when activate is set. Opening a name again with the same root is a no-op.
+func (r *Registry) Open(name, root string, activate bool) (*WorkspaceInfo, error) {
+	if !workspaceNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: name %q must be 1-48 lowercase letters, digits, '-' or '_'", ErrInvalidWorkspace, name)
+	}
+	if root == "" {
+		return nil, fmt.Errorf("%w: root is required", ErrInvalidWorkspace)
+	}
+	ws, err := NewWorkspace(r.configFor(name, root))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkspace, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, exists := r.infos[name]
+	if exists && info.Root != ws.Root() {
+		return nil, fmt.Errorf("%w: %s is open at %s", ErrWorkspaceExists, name, info.Root)
+	}
+	if !exists {
+		info = WorkspaceInfo{Name: name, Root: ws.Root(), OpenedAt: time.Now().UTC()}
+		r.infos[name] = info
+		r.workspaces[name] = ws
+	}
+
+	previous := r.active
+	if activate {
+		r.active = name
+	}
+	if err := r.save(); err != nil {
+		r.active = previous
+		if !exists {
+			delete(r.infos, name)
+			delete(r.workspaces, name)
+		}
+		return nil, err
+	}
+
+	info.Active = r.active == name
+	return &info, nil
+}
+
+// Switch makes a workspace the active one
+func (r *Registry) Switch(name string) (*WorkspaceInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, ok := r.infos[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, name)
+	}
+
+	previous := r.active
+	r.active = name
+	if err := r.save(); err != nil {
+		r.active = previous
+		return nil, err
+	}
+
+	info.Active = true
+	return &info, nil
+}
+
+// Close forgets a workspace, leaving its files alone. Closing the active
+// workspace switches back to the default one.
+func (r *Registry) Close(name string) error {
+	if name == DefaultWorkspace {
+		return fmt.Errorf("%w: the default workspace can't be closed", ErrInvalidWorkspace)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, ok := r.infos[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrWorkspaceNotFound, name)
+	}
+	ws, hadWorkspace := r.workspaces[name]
+
+	previous := r.active
+	delete(r.infos, name)
+	delete(r.workspaces, name)
+	if r.active == name {
+		r.active = DefaultWorkspace
+	}
+	if err := r.save(); err != nil {
+		r.infos[name] = info
+		if hadWorkspace {
+			r.workspaces[name] = ws
+		}
+		r.active = previous
+		return err
+	}
+	return nil
+}
+
+// configFor is the config of a non-default workspace: its own root, and
+// backups kept apart from other workspaces'
+func (r *Registry) configFor(name, root string) Config {
+	config := r.config
+	config.Root = root
+	if config.BackupDir != "" {
+		config.BackupDir = filepath.Join(config.BackupDir, "workspaces", name)
+	}
+	return config
+}
+
+// save writes the registry through a temporary file so a crash can't leave
+// it half written; callers must hold r.mu
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	state := registryState{Active: r.active, Workspaces: make([]WorkspaceInfo, 0, len(r.infos))}
+	for _, info := range r.infos {
+		state.Workspaces = append(state.Workspaces, info)
+	}
+	sort.Slice(state.Workspaces, func(i, j int) bool { return state.Workspaces[i].Name < state.Workspaces[j].Name })
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode workspaces: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create workspaces directory: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write workspaces: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("failed to write workspaces: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+const (
+	// defaultSearchLimit is how many matches a search returns unless asked
+	defaultSearchLimit = 200
+	// maxSearchLimit caps the matches one search can ask for
+	maxSearchLimit = 2000
+	// maxSearchContext caps the context lines around each match
+	maxSearchContext = 10
+	// maxMatchLineLength truncates very long matched lines, e.g. minified code
+	maxMatchLineLength = 500
+)
+
+// ErrInvalidSearch is returned for searches without a name or pattern, or
+// with a pattern that doesn't compile
+var ErrInvalidSearch = errors.New("invalid search")
+
+// LineMatch is one line matching a search pattern
+type LineMatch struct {
+	Line   int      `json:"line"`   // 1-based
+	Column int      `json:"column"` // 1-based, in bytes
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// SearchFile is a file found by a search, with its matching lines when
+// the search had a pattern
+type SearchFile struct {
+	Path     string      `json:"path"`
+	Language string      `json:"language"`
+	Matches  []LineMatch `json:"matches,omitempty"`
+}
+
+// SearchResult is what a search found
+type SearchResult struct {
+	Files     []SearchFile `json:"files"`
+	Matches   int          `json:"matches"`  // matched lines, or files for a name-only search
+	Searched  int          `json:"searched"` // files looked at
+	Truncated bool         `json:"truncated"`
+}
+
+// Search finds files by name and lines by pattern under a directory,
+// skipping .git, .gitignored paths, dotfiles, binaries and files over the
+// size limit the way ripgrep does
+func (w *Workspace) Search(ctx context.Context, opts models.FileSearchRequest) (*SearchResult, error) {
+	if opts.Name == "" && opts.Pattern == "" {
+		return nil, fmt.Errorf("%w: a name or pattern is required", ErrInvalidSearch)
+	}
+
+	var pattern *regexp.Regexp
+	if opts.Pattern != "" {
+		expr := opts.Pattern
+		if opts.Literal {
+			expr = regexp.QuoteMeta(expr)
+		}
+		if opts.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		var err error
+		if pattern, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+	around := clamp(opts.Context, 0, maxSearchContext)
+
+	start := opts.Path
+	if start == "" {
+		start = "."
+	}
+	dir, err := w.Resolve(start)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return nil, statError(start, err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s is not a directory", ErrInvalidPath, start)
+	}
+
+	// Rules from the root down to the start directory apply too
+	rules := make(map[string][]ignoreRule)
+	if !opts.NoIgnore {
+		inherited := loadIgnoreRules(w.root, "")
+		rel := w.Rel(dir)
+		if rel != "." {
+			walked := ""
+			for _, part := range strings.Split(rel, "/") {
+				walked = path.Join(walked, part)
+				inherited = append(inherited, loadIgnoreRules(filepath.Join(w.root, filepath.FromSlash(walked)), walked)...)
+			}
+		}
+		rules[rel] = inherited
+	}
+
+	result := &SearchResult{Files: make([]SearchFile, 0)}
+	err = filepath.WalkDir(dir, func(abs string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if abs == dir {
+				return err
+			}
+			return nil // unreadable entries are skipped
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel := w.Rel(abs)
+		name := d.Name()
+		parent := path.Dir(rel)
+		if abs != dir {
+			if name == ".git" || (!opts.Hidden && strings.HasPrefix(name, ".")) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !opts.NoIgnore && ignored(rules[parent], rel, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.IsDir() {
+			if !opts.NoIgnore && abs != dir {
+				rules[rel] = append(append([]ignoreRule(nil), rules[parent]...), loadIgnoreRules(abs, rel)...)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !matchName(opts.Name, rel, name) {
+			return nil
+		}
+
+		file := SearchFile{Path: rel, Language: DetectLanguage(abs)}
+		if pattern == nil {
+			result.Searched++
+			result.Files = append(result.Files, file)
+			result.Matches++
+			if result.Matches >= limit {
+				result.Truncated = true
+				return filepath.SkipAll
+			}
+			return nil
+		}
+
+		lines, ok := w.searchable(abs)
+		if !ok {
+			return nil
+		}
+		result.Searched++
+		for i, line := range lines {
+			loc := pattern.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			if result.Matches >= limit {
+				result.Truncated = true
+				break
+			}
+			file.Matches = append(file.Matches, LineMatch{
+				Line:   i + 1,
+				Column: loc[0] + 1,
+				Text:   truncateLine(line),
+				Before: contextLines(lines, i-around, i),
+				After:  contextLines(lines, i+1, i+1+around),
+			})
+			result.Matches++
+		}
+		if len(file.Matches) > 0 {
+			result.Files = append(result.Files, file)
+		}
+		if result.Truncated {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", start, err)
+	}
+	return result, nil
+}
+
+// searchable returns a file's lines, or false for files that are too big
+// or aren't text
+func (w *Workspace) searchable(abs string) ([]string, bool) {
+	info, err := os.Stat(abs)
+	if err != nil || info.Size() > w.maxBytes {
+		return nil, false
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return nil, false
+	}
+	lines, _ := splitLines(string(data))
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines, true
+}
+
+// matchName reports whether a file matches a name query: a glob, or a
+// case-insensitive substring when it has no wildcards. Queries with a
+// slash match the path relative to the root, others the file name.
+func matchName(query, rel, name string) bool {
+	if query == "" {
+		return true
+	}
+	target := name
+	if strings.Contains(query, "/") {
+		target = rel
+	}
+	if !strings.ContainsAny(query, "*?[") {
+		return strings.Contains(strings.ToLower(target), strings.ToLower(query))
+	}
+	return matchGlob(strings.TrimPrefix(query, "/"), target)
+}
+
+// contextLines returns lines[from:to], clamped and truncated
+func contextLines(lines []string, from, to int) []string {
+	from, to = clamp(from, 0, len(lines)), clamp(to, 0, len(lines))
+	if from >= to {
+		return nil
+	}
+	out := make([]string, 0, to-from)
+	for _, line := range lines[from:to] {
+		out = append(out, truncateLine(line))
+	}
+	return out
+}
+
+func truncateLine(line string) string {
+	if len(line) <= maxMatchLineLength {
+		return line
+	}
+	cut := maxMatchLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "…"
+}
@@ -0,0 +1,217 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+const (
+	// defaultTreeDepth is how many levels a tree request expands unless asked
+	defaultTreeDepth = 2
+	// maxTreeDepth caps the levels one request can expand
+	maxTreeDepth = 10
+	// defaultTreeChildren is how many entries a directory lists unless asked
+	defaultTreeChildren = 500
+	// maxTreeChildren caps the entries one directory can list
+	maxTreeChildren = 5000
+	// maxCachedListings bounds the directory listing cache
+	maxCachedListings = 10000
+)
+
+// treeEntry is one entry of a cached directory listing
+type treeEntry struct {
+	name string
+	dir  bool
+}
+
+// dirListing is a directory's entries as of its modification time
+type dirListing struct {
+	modTime time.Time
+	entries []treeEntry
+}
+
+// Tree lists the directory at req.Path, expanding req.Depth levels.
+// Directories below that come back with Lazy set, to be expanded by asking
+// for their path. Entries past req.MaxChildren are counted in Omitted.
+// Paths in .gitignore and .agentignore files, dotfiles and the configured
+// ignore names are left out. The returned tag changes whenever a listed
+// directory or ignore file does.
+func (w *Workspace) Tree(req models.FileTreeRequest) (*models.FileNode, string, error) {
+	depth := req.Depth
+	if depth <= 0 {
+		depth = defaultTreeDepth
+	}
+	depth = min(depth, maxTreeDepth)
+	maxChildren := req.MaxChildren
+	if maxChildren <= 0 {
+		maxChildren = defaultTreeChildren
+	}
+	maxChildren = min(maxChildren, maxTreeChildren)
+
+	start := req.Path
+	if start == "" {
+		start = "."
+	}
+	abs, err := w.Resolve(start)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, "", statError(start, err)
+	}
+
+	tag := sha256.New()
+	fmt.Fprintf(tag, "%d %d %t %t\n", depth, maxChildren, req.Hidden, req.NoIgnore)
+
+	rel := w.Rel(abs)
+	node := &models.FileNode{Name: info.Name(), Path: rel, Type: "file"}
+	if rel == "." {
+		node.Name = filepath.Base(w.root)
+	}
+	if !info.IsDir() {
+		node.Size = info.Size()
+		node.Modified = info.ModTime()
+		fmt.Fprintf(tag, "%s %d %d\n", rel, info.Size(), info.ModTime().UnixNano())
+		return node, hex.EncodeToString(tag.Sum(nil)), nil
+	}
+
+	var rules []ignoreRule
+	if !req.NoIgnore {
+		rules = w.inheritedRules(rel, tag)
+	}
+	if err := w.expand(node, abs, rules, depth, maxChildren, req, tag); err != nil {
+		return nil, "", err
+	}
+	return node, hex.EncodeToString(tag.Sum(nil)), nil
+}
+
+// expand fills in a directory node's children, depth levels down
+func (w *Workspace) expand(node *models.FileNode, abs string, rules []ignoreRule, depth, maxChildren int, req models.FileTreeRequest, tag hash.Hash) error {
+	node.Type = "directory"
+	if depth == 0 {
+		node.Lazy = true
+		return nil
+	}
+
+	listing, err := w.list(abs)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", node.Path, err)
+	}
+	fmt.Fprintf(tag, "%s %d\n", node.Path, listing.modTime.UnixNano())
+	if !req.NoIgnore {
+		rules = append(append([]ignoreRule(nil), rules...), w.dirRules(abs, node.Path, tag)...)
+	}
+
+	node.Children = make([]*models.FileNode, 0)
+	for _, entry := range listing.entries {
+		if entry.name == ".git" || (!req.Hidden && strings.HasPrefix(entry.name, ".")) || w.treeIgnore[entry.name] {
+			continue
+		}
+		rel := path.Join(node.Path, entry.name)
+		if !req.NoIgnore && ignored(rules, rel, entry.dir) {
+			continue
+		}
+		if len(node.Children) >= maxChildren {
+			node.Omitted++
+			continue
+		}
+
+		child := &models.FileNode{Name: entry.name, Path: rel, Type: "file"}
+		if entry.dir {
+			if err := w.expand(child, filepath.Join(abs, entry.name), rules, depth-1, maxChildren, req, tag); err != nil {
+				continue // skip directories we can't read
+			}
+		}
+		node.Children = append(node.Children, child)
+	}
+	return nil
+}
+
+// list returns a directory's entries, reusing the last listing while the
+// directory's modification time hasn't changed
+func (w *Workspace) list(abs string) (dirListing, error) {
+	info, err := os.Stat(abs)
+	if err != nil {
+		return dirListing{}, err
+	}
+
+	w.listMu.Lock()
+	cached, ok := w.listings[abs]
+	w.listMu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached, nil
+	}
+
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return dirListing{}, err
+	}
+	listing := dirListing{modTime: info.ModTime(), entries: make([]treeEntry, 0, len(entries))}
+	for _, entry := range entries {
+		listing.entries = append(listing.entries, treeEntry{
+			name: entry.Name(),
+			dir:  entry.IsDir() || (entry.Type()&fs.ModeSymlink != 0 && w.linksToDir(filepath.Join(abs, entry.Name()))),
+		})
+	}
+
+	w.listMu.Lock()
+	if len(w.listings) >= maxCachedListings {
+		w.listings = make(map[string]dirListing)
+	}
+	w.listings[abs] = listing
+	w.listMu.Unlock()
+	return listing, nil
+}
+
+// linksToDir reports whether a symlink points at a directory inside the
+// workspace; links leading out of it are listed as plain files
+func (w *Workspace) linksToDir(abs string) bool {
+	target, err := filepath.EvalSymlinks(abs)
+	if err != nil || !w.contains(target) {
+		return false
+	}
+	info, err := os.Stat(target)
+	return err == nil && info.IsDir()
+}
+
+// inheritedRules loads the ignore rules of the root and every directory
+// down to, but not including, rel
+func (w *Workspace) inheritedRules(rel string, tag hash.Hash) []ignoreRule {
+	rules := make([]ignoreRule, 0)
+	if rel == "." {
+		return rules
+	}
+	rules = append(rules, w.dirRules(w.root, "", tag)...)
+	walked := ""
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		walked = path.Join(walked, part)
+		rules = append(rules, w.dirRules(filepath.Join(w.root, filepath.FromSlash(walked)), walked, tag)...)
+	}
+	return rules
+}
+
+// dirRules loads a directory's ignore rules, adding its ignore files'
+// modification times to tag
+func (w *Workspace) dirRules(abs, rel string, tag hash.Hash) []ignoreRule {
+	if rel == "." {
+		rel = ""
+	}
+	for _, name := range ignoreFiles {
+		if info, err := os.Stat(filepath.Join(abs, name)); err == nil {
+			fmt.Fprintf(tag, "%s/%s %d %d\n", rel, name, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return loadIgnoreRules(abs, rel)
+}
@@ -0,0 +1,362 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe states
+const (
+	StatusUp      = "up"
+	StatusDown    = "down"
+	StatusIdle    = "idle"    // the dependency hasn't started, as a browser no one has used
+	StatusPending = "pending" // not probed yet
+)
+
+// ErrIdle is returned by a check whose dependency hasn't started yet; an
+// idle probe doesn't count against readiness
+var ErrIdle = errors.New("not started")
+
+// Config sets how often dependencies are probed and which ones the server
+// needs to take traffic
+type Config struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	Required []string // probe names; a group's name requires every member
+}
+
+// DefaultConfig probes every 15 seconds and waits on Neo4j and Ollama
+func DefaultConfig() Config {
+	return Config{
+		Interval: 15 * time.Second,
+		Timeout:  5 * time.Second,
+		Required: []string{"neo4j", "ollama"},
+	}
+}
+
+// ConfigFromEnv reads HEALTH_INTERVAL and HEALTH_TIMEOUT, durations such
+// as "15s", and HEALTH_REQUIRED, the comma-separated probes /readyz waits on
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+
+	for env, duration := range map[string]*time.Duration{
+		"HEALTH_INTERVAL": &config.Interval,
+		"HEALTH_TIMEOUT":  &config.Timeout,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return DefaultConfig(), fmt.Errorf("invalid %s %q, expected a duration such as 15s", env, value)
+		}
+		*duration = parsed
+	}
+	if config.Timeout > config.Interval {
+		return DefaultConfig(), fmt.Errorf("HEALTH_TIMEOUT %s must not exceed HEALTH_INTERVAL %s", config.Timeout, config.Interval)
+	}
+
+	if value, ok := os.LookupEnv("HEALTH_REQUIRED"); ok {
+		config.Required = make([]string, 0)
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.Required = append(config.Required, name)
+			}
+		}
+	}
+	return config, nil
+}
+
+// Check probes one dependency, returning before ctx ends
+type Check func(ctx context.Context) error
+
+// Result is a probe's latest outcome. The last error is kept after the
+// probe recovers, so a flapping dependency shows what went wrong.
+type Result struct {
+	Status      string     `json:"status"`
+	Required    bool       `json:"required"`
+	LatencyMs   float64    `json:"latency_ms"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Report is every probe's latest result. Ready is false while a required
+// probe is down or hasn't run yet, and once the server starts shutting down.
+type Report struct {
+	Status string            `json:"status"` // "ok", "degraded" with an optional probe down, "unavailable" or "draining"
+	Ready  bool              `json:"ready"`
+	Probes map[string]Result `json:"probes"`
+}
+
+// probe is a named check, or a group whose members can change, such as
+// the connected MCP servers
+type probe struct {
+	name    string
+	check   Check
+	members func() map[string]Check
+}
+
+// Checker probes dependencies in the background and keeps their results,
+// so health endpoints answer without waiting on them
+type Checker struct {
+	config   Config
+	probes   []probe
+	results  map[string]Result
+	started  time.Time
+	draining bool
+	mu       sync.RWMutex
+	stop     chan struct{}
+}
+
+// NewChecker creates a checker with no probes
+func NewChecker(config Config) *Checker {
+	return &Checker{
+		config:  config,
+		results: make(map[string]Result),
+		started: time.Now(),
+	}
+}
+
+// Add registers a probe
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probes = append(c.probes, probe{name: name, check: check})
+	c.results[name] = Result{Status: StatusPending, Required: c.required(name)}
+}
+
+// AddGroup registers a probe per member members returns on each run,
+// named group/member; members that go away are dropped from the report
+func (c *Checker) AddGroup(group string, members func() map[string]Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probes = append(c.probes, probe{name: group, members: members})
+}
+
+// Start probes now and then every interval until Stop
+func (c *Checker) Start() {
+	c.mu.Lock()
+	c.stop = make(chan struct{})
+	stop := c.stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+
+		c.Run(context.Background())
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.Run(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops background probing
+func (c *Checker) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// Drain marks the server not ready, so orchestrators stop sending it
+// traffic while it shuts down
+func (c *Checker) Drain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.draining = true
+}
+
+// Run probes every dependency at once and waits for them, each bounded by
+// the timeout
+func (c *Checker) Run(ctx context.Context) {
+	c.mu.RLock()
+	probes := append([]probe(nil), c.probes...)
+	c.mu.RUnlock()
+
+	checks := make(map[string]Check)
+	groups := make(map[string]bool)
+	for _, p := range probes {
+		if p.members == nil {
+			checks[p.name] = p.check
+			continue
+		}
+		groups[p.name] = true
+		for member, check := range p.members() {
+			checks[p.name+"/"+member] = check
+		}
+	}
+
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.record(name, c.probe(ctx, check))
+		}()
+	}
+	wg.Wait()
+
+	// Drop members that left their group since the last run
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.results {
+		group, _, ok := strings.Cut(name, "/")
+		if _, current := checks[name]; ok && groups[group] && !current {
+			delete(c.results, name)
+		}
+	}
+}
+
+// outcome is one run of a check
+type outcome struct {
+	err     error
+	latency time.Duration
+	at      time.Time
+}
+
+// probe runs check, giving up when the timeout passes even if check
+// ignores its context
+func (c *Checker) probe(ctx context.Context, check Check) outcome {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("no answer within %s", c.config.Timeout)
+	}
+	return outcome{err: err, latency: time.Since(start), at: start}
+}
+
+// record keeps a probe's outcome and logs when it goes down or recovers
+func (c *Checker) record(name string, o outcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := c.results[name]
+	previous := result.Status
+	result.Required = c.required(name)
+	result.LatencyMs = float64(o.latency.Microseconds()) / 1000
+	result.LastChecked = &o.at
+
+	switch {
+	case o.err == nil:
+		result.Status = StatusUp
+		result.LastSuccess = &o.at
+	case errors.Is(o.err, ErrIdle):
+		result.Status = StatusIdle
+	default:
+		result.Status = StatusDown
+		result.LastError = o.err.Error()
+		result.LastErrorAt = &o.at
+	}
+	c.results[name] = result
+
+	if result.Status == StatusDown && previous != StatusDown {
+		slog.Warn("health probe failing", "probe", name, "error", o.err)
+	} else if result.Status == StatusUp && previous == StatusDown {
+		slog.Info("health probe recovered", "probe", name)
+	}
+}
+
+// required reports whether name is required by itself or by its group
+func (c *Checker) required(name string) bool {
+	group, _, _ := strings.Cut(name, "/")
+	for _, required := range c.config.Required {
+		if required == name || required == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Report returns every probe's latest result
+func (c *Checker) Report() Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	report := Report{Status: "ok", Ready: true, Probes: make(map[string]Result, len(c.results))}
+	for name, result := range c.results {
+		report.Probes[name] = result
+		if result.Status != StatusDown && result.Status != StatusPending {
+			continue
+		}
+		if result.Required {
+			report.Ready = false
+			report.Status = "unavailable"
+		} else if result.Status == StatusDown && report.Status == "ok" {
+			report.Status = "degraded"
+		}
+	}
+	if c.draining {
+		report.Ready = false
+		report.Status = "draining"
+	}
+	return report
+}
+
+// Up reports whether a probe, or every member of a group, is up
+func (c *Checker) Up(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if result, ok := c.results[name]; ok {
+		return result.Status == StatusUp
+	}
+	for member, result := range c.results {
+		if strings.HasPrefix(member, name+"/") && result.Status != StatusUp {
+			return false
+		}
+	}
+	return true
+}
+
+// Failing names the required probes keeping the server from being ready
+func (c *Checker) Failing() []string {
+	var failing []string
+	for name, result := range c.Report().Probes {
+		if result.Required && (result.Status == StatusDown || result.Status == StatusPending) {
+			failing = append(failing, name)
+		}
+	}
+	sort.Strings(failing)
+	return failing
+}
+
+// Uptime is how long the checker has existed, which is about how long the
+// server has been up
+func (c *Checker) Uptime() time.Duration {
+	return time.Since(c.started)
+}
+
+// Config returns the checker's configuration
+func (c *Checker) Config() Config {
+	return c.config
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"strconv"
+
+	"agent-workspace/backend/pkg/metrics"
+)
+
+// RegisterMetrics adds gauges reading each probe's latest result to registry
+func (c *Checker) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("health_probe_up", "Whether each dependency probe last succeeded",
+		[]string{"probe", "required"}, func() []metrics.Sample {
+			return c.samples(func(result Result) (float64, bool) {
+				if result.Status == StatusUp {
+					return 1, true
+				}
+				return 0, result.Status == StatusDown
+			})
+		})
+
+	registry.NewGaugeFunc("health_probe_latency_seconds", "How long each dependency probe last took",
+		[]string{"probe", "required"}, func() []metrics.Sample {
+			return c.samples(func(result Result) (float64, bool) {
+				return result.LatencyMs / 1000, result.LastChecked != nil
+			})
+		})
+}
+
+// samples reads a value from each probe's result, skipping those value
+// has nothing for
+func (c *Checker) samples(value func(Result) (float64, bool)) []metrics.Sample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	samples := make([]metrics.Sample, 0, len(c.results))
+	for name, result := range c.results {
+		v, ok := value(result)
+		if !ok {
+			continue
+		}
+		samples = append(samples, metrics.Sample{Labels: []string{name, strconv.FormatBool(result.Required)}, Value: v})
+	}
+	return samples
+}
@@ -0,0 +1,215 @@
+// Package httpapi defines the REST API's response models and documents
+// every route. Request models live in pkg/models; the handlers in
+// cmd/server answer with these types, and Spec renders both as OpenAPI.
+package httpapi
+
+import (
+	"time"
+
+	"agent-workspace/backend/internal/agent"
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/internal/files"
+	"agent-workspace/backend/internal/health"
+	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/internal/watchdog"
+	"agent-workspace/backend/internal/webhooks"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// Health reports whether the server and each service is up, with every
+// dependency probe's latest result
+type Health struct {
+	Status    string                   `json:"status"`
+	Ready     bool                     `json:"ready"`
+	Timestamp string                   `json:"timestamp"`
+	Uptime    string                   `json:"uptime"`
+	Services  HealthServices           `json:"services"`
+	Probes    map[string]health.Result `json:"probes"`
+}
+
+// HealthServices reports each service's state; Ollama, Browser and MCP
+// are whether their probes last succeeded
+type HealthServices struct {
+	Memory    map[string]interface{} `json:"memory"`
+	ShortTerm map[string]interface{} `json:"short_term"`
+	Ollama    bool                   `json:"ollama"`
+	Browser   bool                   `json:"browser"`
+	Terminal  bool                   `json:"terminal"`
+	MCP       bool                   `json:"mcp"`
+	Watchdog  bool                   `json:"watchdog"`
+}
+
+// Liveness reports that the server is running
+type Liveness struct {
+	Status string `json:"status"`
+	Uptime string `json:"uptime"`
+}
+
+// Readiness reports whether the server can take traffic, and the required
+// probes stopping it when it can't
+type Readiness struct {
+	Status  string   `json:"status"`
+	Ready   bool     `json:"ready"`
+	Failing []string `json:"failing,omitempty"`
+}
+
+// LogList is a page of recent log records
+type LogList struct {
+	Entries []logging.Entry `json:"entries"`
+	Count   int             `json:"count"`
+}
+
+// AgentSession is the session an initialized agent works in
+type AgentSession struct {
+	SessionID string       `json:"session_id"`
+	Status    agent.Status `json:"status"`
+}
+
+// TaskAccepted names a task that was started or cancelled in the background
+type TaskAccepted struct {
+	TaskID string       `json:"task_id"`
+	Status agent.Status `json:"status"`
+}
+
+// TaskList lists agent tasks
+type TaskList struct {
+	Tasks []models.Task `json:"tasks"`
+	Count int           `json:"count"`
+}
+
+// WhoAmI reports who a request authenticated as
+type WhoAmI struct {
+	Enabled   bool            `json:"enabled"`
+	Principal *auth.Principal `json:"principal"`
+}
+
+// SessionToken is a session token issued for an API key
+type SessionToken struct {
+	Token     string     `json:"token"`
+	Scope     string     `json:"scope"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// KeyList lists API keys, without their secrets
+type KeyList struct {
+	Keys []auth.APIKey `json:"keys"`
+}
+
+// KeyCreated is a new API key; its secret is only ever returned here
+type KeyCreated struct {
+	Key    *auth.APIKey `json:"key"`
+	Secret string       `json:"secret"`
+}
+
+// CommitList lists analyzed commits
+type CommitList struct {
+	Commits []watchdog.CommitReport `json:"commits"`
+}
+
+// AlertGroupList lists alerts grouped by what raised them
+type AlertGroupList struct {
+	Groups []watchdog.AlertGroup `json:"groups"`
+}
+
+// ProposalList lists change proposals
+type ProposalList struct {
+	Proposals []*watchdog.Proposal `json:"proposals"`
+}
+
+// ProposalCreated names a submitted proposal
+type ProposalCreated struct {
+	ProposalID string `json:"proposal_id"`
+}
+
+// ProposalDiff is a proposal's changes and the review comments on them
+type ProposalDiff struct {
+	Files    []watchdog.FileDiff      `json:"files"`
+	Comments []watchdog.ReviewComment `json:"comments"`
+}
+
+// CommentResolved reports a review comment's state
+type CommentResolved struct {
+	Resolved bool `json:"resolved"`
+}
+
+// ProposalApproval reports whether an approval was the last one needed
+type ProposalApproval struct {
+	Approved bool               `json:"approved"`
+	Proposal *watchdog.Proposal `json:"proposal"`
+}
+
+// ProposalRejected confirms a rejection
+type ProposalRejected struct {
+	Rejected bool `json:"rejected"`
+}
+
+// ProposalRolledBack confirms a rollback
+type ProposalRolledBack struct {
+	RolledBack bool `json:"rolled_back"`
+}
+
+// Success confirms a request that returns nothing else
+type Success struct {
+	Success bool `json:"success"`
+}
+
+// WorkspaceNames lists the workspaces memory holds
+type WorkspaceNames struct {
+	Workspaces []string `json:"workspaces"`
+}
+
+// ChatSessionList lists stored conversations
+type ChatSessionList struct {
+	Sessions []memory.ConversationInfo `json:"sessions"`
+	Count    int                       `json:"count"`
+}
+
+// PresenceList lists the users connected to chat, longest connected first
+type PresenceList struct {
+	Users []models.Presence `json:"users"`
+	Count int               `json:"count"`
+}
+
+// WebhookList lists the configured webhooks, without their secrets
+type WebhookList struct {
+	Webhooks []webhooks.Webhook `json:"webhooks"`
+	Count    int                `json:"count"`
+}
+
+// ModelList lists the models installed in Ollama, the ones in use and
+// the downloads since startup
+type ModelList struct {
+	Models []ollama.Model      `json:"models"`
+	Active ollama.ActiveModels `json:"active"`
+	Pulls  []ollama.PullStatus `json:"pulls"`
+}
+
+// ModelWarmed reports a model loaded into memory
+type ModelWarmed struct {
+	Model     string  `json:"model"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Deleted names what a request deleted
+type Deleted struct {
+	Deleted string `json:"deleted"`
+}
+
+// WorkspaceList lists the open workspaces
+type WorkspaceList struct {
+	Active     string                `json:"active"`
+	Workspaces []files.WorkspaceInfo `json:"workspaces"`
+}
+
+// WorkspaceClosed names a closed workspace and the one now active
+type WorkspaceClosed struct {
+	Closed string `json:"closed"`
+	Active string `json:"active"`
+}
+
+// FileRenamed is a renamed file's new path
+type FileRenamed struct {
+	Path string `json:"path"`
+}
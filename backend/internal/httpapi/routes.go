@@ -0,0 +1,326 @@
+package httpapi
+
+import (
+	"strings"
+
+	"agent-workspace/backend/internal/agent"
+	"agent-workspace/backend/internal/artifacts"
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/internal/files"
+	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/internal/usage"
+	"agent-workspace/backend/internal/watchdog"
+	"agent-workspace/backend/internal/webhooks"
+	"agent-workspace/backend/pkg/apierror"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/ollama"
+	"agent-workspace/backend/pkg/openapi"
+)
+
+// object is a JSON object without a fixed shape
+type object = map[string]interface{}
+
+// ok answers 200 with body
+func ok(body interface{}) []openapi.Response {
+	return []openapi.Response{{Status: 200, Body: body}}
+}
+
+// status answers status with body
+func status(code int, body interface{}, description string) openapi.Response {
+	return openapi.Response{Status: code, Body: body, Description: description}
+}
+
+// upgrade is a WebSocket route's handshake
+func upgrade(path, tag, summary string) openapi.Operation {
+	return openapi.Operation{
+		Method:    "GET",
+		Path:      path,
+		Tag:       tag,
+		Summary:   summary,
+		Responses: []openapi.Response{status(101, nil, "Switching to the WebSocket protocol")},
+		Errors:    []int{426, 503},
+	}
+}
+
+// Spec documents every route. scope returns the scope a route needs;
+// routes under /api can also be rate limited.
+func Spec(scope func(method, path string) string) openapi.Spec {
+	operations := Operations()
+	for i := range operations {
+		if strings.HasPrefix(operations[i].Path, "/api/") {
+			operations[i].Errors = append(operations[i].Errors, 429)
+		}
+	}
+
+	return openapi.Spec{
+		Title:   "Agentic Command Center API",
+		Version: "1.0",
+		Description: "Agent tasks, memory, workspace files and the watchdog. Failed requests answer with an " +
+			"error envelope carrying a code, message, details and the request ID.",
+		Operations: operations,
+		ErrorBody:  apierror.Envelope{},
+		Scope:      scope,
+	}
+}
+
+// Operations lists every route the server serves
+func Operations() []openapi.Operation {
+	operations := []openapi.Operation{
+		// Server
+		{Method: "GET", Path: "/health", Tag: "server", Summary: "Report the server's and each service's health, with every dependency probe",
+			Responses: ok(Health{})},
+		{Method: "GET", Path: "/livez", Tag: "server", Summary: "Liveness: the server is running", Responses: ok(Liveness{})},
+		{Method: "GET", Path: "/readyz", Tag: "server", Summary: "Readiness: every required dependency probe is up",
+			Responses: []openapi.Response{
+				status(200, Readiness{}, "The server can take traffic"),
+				status(503, Readiness{}, "A required probe is down or hasn't run yet, or the server is shutting down"),
+			}},
+		{Method: "GET", Path: "/metrics", Tag: "server", Summary: "Prometheus metrics",
+			Responses: []openapi.Response{{Status: 200, ContentType: openapi.Text}}, Errors: []int{500}},
+		{Method: "GET", Path: "/api/openapi.json", Tag: "server", Summary: "This document", Responses: ok(object{})},
+		{Method: "GET", Path: "/api/config", Tag: "server", Summary: "The effective configuration, without secrets", Responses: ok(object{})},
+		{Method: "GET", Path: "/api/logs", Tag: "server", Summary: "Recent log records, newest last",
+			Query: logging.TailQuery{}, Responses: ok(LogList{}), Errors: []int{400}},
+
+		// Agent
+		{Method: "POST", Path: "/api/agent/initialize", Tag: "agent", Summary: "Start the browser and watchdog if needed",
+			Body: models.InitializeRequest{}, OptionalBody: true, Responses: ok(AgentSession{}), Errors: []int{400, 500}},
+		{Method: "POST", Path: "/api/agent/command", Tag: "agent", Summary: "Plan a command and run it in the background",
+			Body: models.CommandRequest{}, Responses: []openapi.Response{status(202, TaskAccepted{}, "The task was planned and started")},
+			Errors: []int{400, 404, 409, 500}},
+		{Method: "GET", Path: "/api/agent/status", Tag: "agent", Summary: "The agent's state and current task", Responses: ok(agent.Status{})},
+		{Method: "POST", Path: "/api/agent/pause", Tag: "agent", Summary: "Hold the task before its next step", Responses: ok(agent.Status{}), Errors: []int{409}},
+		{Method: "POST", Path: "/api/agent/resume", Tag: "agent", Summary: "Let a paused task go on", Responses: ok(agent.Status{}), Errors: []int{409}},
+		{Method: "POST", Path: "/api/agent/cancel", Tag: "agent", Summary: "Cancel the task once its current step returns",
+			Responses: []openapi.Response{status(202, TaskAccepted{}, "The task is cancelling")}, Errors: []int{409}},
+		{Method: "GET", Path: "/api/agent/tasks", Tag: "agent", Summary: "Tasks since startup, then interrupted ones", Responses: ok(TaskList{})},
+
+		// Tasks
+		{Method: "POST", Path: "/api/tasks", Tag: "tasks", Summary: "Plan and start a task",
+			Body: models.TaskCreateRequest{}, Responses: []openapi.Response{status(201, models.Task{}, "The planned task")},
+			Errors: []int{400, 409, 500}},
+		{Method: "GET", Path: "/api/tasks", Tag: "tasks", Summary: "List tasks",
+			Query: models.TaskListRequest{}, Responses: ok(TaskList{}), Errors: []int{400}},
+		{Method: "GET", Path: "/api/tasks/:id", Tag: "tasks", Summary: "A task with its steps", Responses: ok(models.Task{}), Errors: []int{404}},
+		{Method: "DELETE", Path: "/api/tasks/:id", Tag: "tasks", Summary: "Cancel a running or paused task",
+			Responses: []openapi.Response{status(202, models.Task{}, "The task is cancelling")}, Errors: []int{404, 409}},
+
+		// Authentication
+		{Method: "GET", Path: "/api/auth/whoami", Tag: "auth", Summary: "Who the request authenticated as", Responses: ok(WhoAmI{})},
+		{Method: "POST", Path: "/api/auth/sessions", Tag: "auth", Summary: "Exchange an API key for a session token",
+			Body: models.SessionRequest{}, OptionalBody: true, Responses: []openapi.Response{status(201, SessionToken{}, "The session token")},
+			Errors: []int{400}},
+		{Method: "GET", Path: "/api/auth/keys", Tag: "auth", Summary: "List API keys", Responses: ok(KeyList{}), Errors: []int{503}},
+		{Method: "POST", Path: "/api/auth/keys", Tag: "auth", Summary: "Create an API key",
+			Body: models.APIKeyRequest{}, Responses: []openapi.Response{status(201, KeyCreated{}, "The key and its secret, shown only once")},
+			Errors: []int{400, 503}},
+		{Method: "DELETE", Path: "/api/auth/keys/:id", Tag: "auth", Summary: "Revoke an API key and its sessions",
+			Responses: ok(auth.APIKey{}), Errors: []int{404, 503}},
+
+		// Watchdog
+		{Method: "GET", Path: "/api/watchdog/alerts", Tag: "watchdog", Summary: "Query alerts",
+			Query: models.WatchdogAlertQuery{}, Responses: ok(watchdog.AlertPage{}), Errors: []int{400}},
+		{Method: "POST", Path: "/api/watchdog/scan", Tag: "watchdog", Summary: "Scan files or a diff",
+			Body: models.WatchdogScanRequest{}, Responses: ok(watchdog.ScanResult{}), Errors: []int{400}},
+		{Method: "GET", Path: "/api/watchdog/commits", Tag: "watchdog", Summary: "Analyzed commits", Responses: ok(CommitList{}), Errors: []int{503}},
+		{Method: "POST", Path: "/api/watchdog/commits/check", Tag: "watchdog", Summary: "Check a commit before it's made",
+			Description: "Takes a JSON body, or the staged diff as the body with X-Commit-Author and X-Commit-Email headers.",
+			Body:        models.CommitCheckRequest{},
+			Responses: []openapi.Response{
+				status(200, watchdog.CommitReport{}, "The commit may go ahead"),
+				status(422, watchdog.CommitReport{}, "The commit is blocked"),
+			},
+			Errors: []int{400, 503}},
+		{Method: "POST", Path: "/api/watchdog/task-metrics", Tag: "watchdog", Summary: "Report a finished task's metrics",
+			Body: models.TaskMetricsRequest{}, Responses: ok(Success{}), Errors: []int{400, 503}},
+		{Method: "GET", Path: "/api/watchdog/alert-groups", Tag: "watchdog", Summary: "Recurring alerts grouped by package", Responses: ok(AlertGroupList{})},
+		{Method: "GET", Path: "/api/watchdog/proposals", Tag: "watchdog", Summary: "List change proposals", Responses: ok(ProposalList{})},
+		{Method: "POST", Path: "/api/watchdog/proposals", Tag: "watchdog", Summary: "Submit a change proposal",
+			Body: models.ProposalRequest{}, Responses: []openapi.Response{status(201, ProposalCreated{}, "The proposal's ID")},
+			Errors: []int{400}},
+		{Method: "GET", Path: "/api/watchdog/proposals/:id", Tag: "watchdog", Summary: "A change proposal",
+			Responses: ok(watchdog.Proposal{}), Errors: []int{404}},
+		{Method: "GET", Path: "/api/watchdog/proposals/:id/diff", Tag: "watchdog", Summary: "A proposal's changes and review comments",
+			Responses: ok(ProposalDiff{}), Errors: []int{404}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/submit", Tag: "watchdog", Summary: "Submit a proposal for review",
+			Body: models.ProposalReviewRequest{}, OptionalBody: true, Responses: ok(watchdog.Proposal{}), Errors: []int{400, 404, 409}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/comments", Tag: "watchdog", Summary: "Comment on a proposal",
+			Body: models.ProposalCommentRequest{}, Responses: []openapi.Response{status(201, watchdog.ReviewComment{}, "The comment")},
+			Errors: []int{400, 404}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/comments/:comment/resolve", Tag: "watchdog", Summary: "Resolve or reopen a review comment",
+			Body: models.ProposalCommentResolveRequest{}, OptionalBody: true, Responses: ok(CommentResolved{}), Errors: []int{400, 404}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/approve", Tag: "watchdog", Summary: "Approve a proposal",
+			Body: models.ProposalReviewRequest{}, OptionalBody: true,
+			Responses: []openapi.Response{
+				status(200, ProposalApproval{}, "More approvals are needed"),
+				status(202, ProposalApproval{}, "Approved; the pipeline runs in the background"),
+			},
+			Errors: []int{400, 404, 409}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/apply", Tag: "watchdog", Summary: "Mark a proposal applied",
+			Body: models.ProposalReviewRequest{}, OptionalBody: true, Responses: ok(watchdog.Proposal{}), Errors: []int{400, 404, 409}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/verify", Tag: "watchdog", Summary: "Verify an applied proposal",
+			Body: models.ProposalReviewRequest{}, OptionalBody: true, Responses: ok(watchdog.Proposal{}), Errors: []int{400, 404, 409}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/reject", Tag: "watchdog", Summary: "Reject a proposal",
+			Body: models.ProposalRejectRequest{}, OptionalBody: true, Responses: ok(ProposalRejected{}), Errors: []int{400, 404, 409}},
+		{Method: "POST", Path: "/api/watchdog/proposals/:id/rollback", Tag: "watchdog", Summary: "Roll back an applied proposal",
+			Responses: ok(ProposalRolledBack{}), Errors: []int{404, 409}},
+
+		// Evolution
+		{Method: "POST", Path: "/api/evolve/reward", Tag: "evolve", Summary: "Reward an evolution",
+			Body: models.RewardRequest{}, Responses: ok(Success{}), Errors: []int{400}},
+		{Method: "GET", Path: "/api/evolve/analytics", Tag: "evolve", Summary: "Rewards by strategy over time",
+			Query: models.EvolveAnalyticsQuery{}, Responses: ok(watchdog.EvolutionAnalytics{}), Errors: []int{400}},
+
+		// Memory
+		{Method: "POST", Path: "/api/memory/store", Tag: "memory", Summary: "Store a memory",
+			Body: models.MemoryStoreRequest{}, Responses: ok(object{}), Errors: []int{400, 503}},
+		{Method: "POST", Path: "/api/memory/query", Tag: "memory", Summary: "Query long- and short-term memory",
+			Body: models.MemoryQueryRequest{}, Responses: ok(models.MemoryQueryResponse{}), Errors: []int{400, 503}},
+		{Method: "POST", Path: "/api/memory/vector-search", Tag: "memory", Summary: "Find memories similar to a query",
+			Body: models.VectorSearchRequest{}, Responses: ok(models.VectorSearchResponse{}), Errors: []int{400, 503}},
+		{Method: "POST", Path: "/api/memory/delete", Tag: "memory", Summary: "Delete memories",
+			Body: models.MemoryDeleteRequest{}, Responses: ok(object{}), Errors: []int{400, 404, 503}},
+		{Method: "POST", Path: "/api/memory/feedback", Tag: "memory", Summary: "Rate a memory's usefulness",
+			Body: models.MemoryFeedbackRequest{}, Responses: ok(object{}), Errors: []int{400, 404, 503}},
+		{Method: "GET", Path: "/api/memory/graph", Tag: "memory", Summary: "The knowledge graph around an entity",
+			Query: models.MemoryGraphRequest{}, Responses: ok(memory.GraphNeighborhood{}), Errors: []int{400, 503}},
+		{Method: "POST", Path: "/api/memory/index", Tag: "memory", Summary: "Index the workspace's files",
+			Body: models.MemoryIndexRequest{}, OptionalBody: true,
+			Responses: []openapi.Response{status(202, memory.IndexProgress{}, "Indexing started")},
+			Errors:    []int{400, 404, 409, 503}},
+		{Method: "GET", Path: "/api/memory/index", Tag: "memory", Summary: "Indexing progress", Responses: ok(memory.IndexProgress{}), Errors: []int{404}},
+		{Method: "GET", Path: "/api/memory/health", Tag: "memory", Summary: "Schema versions, store counts and the integrity check",
+			Responses: []openapi.Response{
+				status(200, memory.MemoryHealth{}, "Memory is ready"),
+				status(503, memory.MemoryHealth{}, "Memory isn't ready yet"),
+			}},
+		{Method: "GET", Path: "/api/memory/audit", Tag: "memory", Summary: "Query the memory audit log",
+			Query: models.MemoryAuditRequest{}, Responses: ok(memory.AuditPage{}), Errors: []int{400, 503}},
+		{Method: "GET", Path: "/api/memory/tasks", Tag: "memory", Summary: "List remembered tasks",
+			Query: models.MemoryTaskListRequest{}, Responses: ok(models.MemoryTaskListResponse{}), Errors: []int{400}},
+		{Method: "GET", Path: "/api/memory/workspaces", Tag: "memory", Summary: "Workspaces memory holds", Responses: ok(WorkspaceNames{}), Errors: []int{503}},
+		{Method: "GET", Path: "/api/memory/screenshots/:id", Tag: "memory", Summary: "A screenshot",
+			Responses: []openapi.Response{{Status: 200, ContentType: "image/png"}}, Errors: []int{404}},
+		{Method: "GET", Path: "/api/memory/tasks/:id", Tag: "memory", Summary: "A remembered task", Responses: ok(object{}), Errors: []int{404}},
+		{Method: "GET", Path: "/api/memory/tasks/:id/export", Tag: "memory", Summary: "Export a task trace with its screenshots",
+			Responses: []openapi.Response{{Status: 200, ContentType: "application/gzip"}}, Errors: []int{404}},
+		{Method: "POST", Path: "/api/memory/tasks/import", Tag: "memory", Summary: "Import an exported task trace",
+			Query: models.MemoryTaskImportRequest{}, Body: []byte{}, BodyType: "application/gzip",
+			Responses: []openapi.Response{status(201, object{}, "The imported task")}, Errors: []int{400, 409}},
+
+		// Artifacts
+		{Method: "GET", Path: "/api/artifacts", Tag: "artifacts", Summary: "List artifacts, newest first",
+			Query: models.ArtifactListRequest{}, Responses: ok(artifacts.Page{}), Errors: []int{400, 503}},
+		{Method: "POST", Path: "/api/artifacts", Tag: "artifacts", Summary: "Upload an artifact",
+			Description: "The body is the artifact's contents. Its content type is the Content-Type header's, or detected from the name and contents.",
+			Query:       models.ArtifactCreateRequest{}, Body: []byte{}, BodyType: "application/octet-stream",
+			Responses: []openapi.Response{status(201, artifacts.Artifact{}, "The stored artifact")}, Errors: []int{400, 413, 503}},
+		{Method: "GET", Path: "/api/artifacts/:id", Tag: "artifacts", Summary: "An artifact's metadata", Responses: ok(artifacts.Artifact{}), Errors: []int{404, 503}},
+		{Method: "GET", Path: "/api/artifacts/:id/content", Tag: "artifacts", Summary: "Download an artifact",
+			Responses: []openapi.Response{{Status: 200, ContentType: "application/octet-stream"}}, Errors: []int{404, 503}},
+		{Method: "PUT", Path: "/api/artifacts/:id", Tag: "artifacts", Summary: "Rename an artifact, link it to a task or change its metadata",
+			Body: models.ArtifactUpdateRequest{}, Responses: ok(artifacts.Artifact{}), Errors: []int{400, 404, 503}},
+		{Method: "DELETE", Path: "/api/artifacts/:id", Tag: "artifacts", Summary: "Delete an artifact and its contents", Responses: ok(Deleted{}), Errors: []int{404, 503}},
+
+		// Webhooks
+		{Method: "GET", Path: "/api/webhooks", Tag: "webhooks", Summary: "List webhooks, without their secrets", Responses: ok(WebhookList{}), Errors: []int{503}},
+		{Method: "POST", Path: "/api/webhooks", Tag: "webhooks", Summary: "Add a webhook",
+			Description: "Events: task.completed, task.failed, task.cancelled, proposal.created and alert.error; task.* style prefixes and * match several. The response carries the signing secret, generated when none is given; it isn't returned again.",
+			Body:        models.WebhookCreateRequest{},
+			Responses:   []openapi.Response{status(201, webhooks.Webhook{}, "The webhook with its secret")}, Errors: []int{400, 503}},
+		{Method: "GET", Path: "/api/webhooks/deliveries", Tag: "webhooks", Summary: "The delivery log, newest first",
+			Query: models.WebhookDeliveryListRequest{}, Responses: ok(webhooks.DeliveryPage{}), Errors: []int{400, 503}},
+		{Method: "GET", Path: "/api/webhooks/:id", Tag: "webhooks", Summary: "A webhook, without its secret", Responses: ok(webhooks.Webhook{}), Errors: []int{404, 503}},
+		{Method: "PUT", Path: "/api/webhooks/:id", Tag: "webhooks", Summary: "Change a webhook or rotate its secret",
+			Body: models.WebhookUpdateRequest{}, Responses: ok(webhooks.Webhook{}), Errors: []int{400, 404, 503}},
+		{Method: "DELETE", Path: "/api/webhooks/:id", Tag: "webhooks", Summary: "Delete a webhook", Responses: ok(Deleted{}), Errors: []int{404, 503}},
+		{Method: "POST", Path: "/api/webhooks/:id/test", Tag: "webhooks", Summary: "Send a webhook.ping delivery",
+			Responses: []openapi.Response{status(202, webhooks.Delivery{}, "The queued delivery")}, Errors: []int{404, 503}},
+
+		// Ollama models
+		{Method: "GET", Path: "/api/models", Tag: "models", Summary: "List installed models, the ones in use and downloads since startup",
+			Responses: ok(ModelList{}), Errors: []int{502}},
+		{Method: "GET", Path: "/api/models/show", Tag: "models", Summary: "A model's details, parameters and capabilities",
+			Query: models.ModelRequest{}, Responses: ok(ollama.ModelInfo{}), Errors: []int{400, 404, 502}},
+		{Method: "POST", Path: "/api/models/pull", Tag: "models", Summary: "Download a model in the background",
+			Description: "Progress is in GET /api/models and sent to /ws/chat clients as model_pull messages.",
+			Body:        models.ModelRequest{},
+			Responses:   []openapi.Response{status(202, ollama.PullStatus{}, "The started download")}, Errors: []int{400, 409}},
+		{Method: "POST", Path: "/api/models/warm", Tag: "models", Summary: "Load a model into memory before a task needs it",
+			Body: models.ModelRequest{}, Responses: ok(ModelWarmed{}), Errors: []int{400, 404, 502}},
+		{Method: "PUT", Path: "/api/models/active", Tag: "models", Summary: "Switch the chat, embedding or vision model until restart",
+			Body: models.ModelSwitchRequest{}, Responses: ok(ollama.ActiveModels{}), Errors: []int{400, 404, 502}},
+
+		// Token usage
+		{Method: "GET", Path: "/api/usage", Tag: "usage", Summary: "Tokens used by day, by model and by agent task",
+			Query: models.UsageRequest{}, Responses: ok(usage.Report{}), Errors: []int{400, 503}},
+
+		// Chat
+		{Method: "GET", Path: "/api/chat/sessions", Tag: "chat", Summary: "List conversations", Responses: ok(ChatSessionList{}), Errors: []int{503}},
+		{Method: "GET", Path: "/api/chat/sessions/:id", Tag: "chat", Summary: "A conversation", Responses: ok(memory.Conversation{}), Errors: []int{404, 503}},
+		{Method: "DELETE", Path: "/api/chat/sessions/:id", Tag: "chat", Summary: "Delete a conversation", Responses: ok(Deleted{}), Errors: []int{404, 503}},
+		{Method: "GET", Path: "/api/chat/stream", Tag: "chat", Summary: "Stream chat over Server-Sent Events",
+			Description: "Carries the /ws/chat messages, each as an event named after its type. The connected event's stream_id is what messages are posted with.",
+			Query:       models.ChatStreamRequest{},
+			Responses:   []openapi.Response{{Status: 200, ContentType: openapi.EventStream}}, Errors: []int{400, 503}},
+		{Method: "GET", Path: "/api/chat/presence", Tag: "chat", Summary: "Who is connected to chat and the task each is viewing",
+			Responses: ok(PresenceList{})},
+		{Method: "POST", Path: "/api/chat/message", Tag: "chat", Summary: "Send a message up a chat stream",
+			Body: models.ChatStreamMessageRequest{},
+			Responses: []openapi.Response{
+				status(200, models.ChatStreamMessageResponse{}, "Handled at once: a session resumed, missed broadcasts queued or the viewed task switched"),
+				status(202, models.ChatStreamMessageResponse{}, "Accepted; replies arrive on the stream"),
+			},
+			Errors: []int{400, 404, 503}},
+
+		// Workspaces
+		{Method: "GET", Path: "/api/workspace", Tag: "workspace", Summary: "List open workspaces", Responses: ok(WorkspaceList{}), Errors: []int{503}},
+		{Method: "POST", Path: "/api/workspace", Tag: "workspace", Summary: "Open a directory as a workspace",
+			Body: models.WorkspaceOpenRequest{}, Responses: []openapi.Response{status(201, files.WorkspaceInfo{}, "The opened workspace")},
+			Errors: []int{400, 404, 409, 503}},
+		{Method: "POST", Path: "/api/workspace/switch", Tag: "workspace", Summary: "Switch the active workspace",
+			Body: models.WorkspaceSwitchRequest{}, Responses: ok(files.WorkspaceInfo{}), Errors: []int{400, 404, 503}},
+		{Method: "DELETE", Path: "/api/workspace/:name", Tag: "workspace", Summary: "Close a workspace, leaving its files",
+			Responses: ok(WorkspaceClosed{}), Errors: []int{400, 404, 409, 503}},
+
+		// Files
+		{Method: "GET", Path: "/api/files/tree", Tag: "files", Summary: "List a directory",
+			Description: "Answers 304 when If-None-Match matches the ETag.",
+			Query:       models.FileTreeRequest{},
+			Responses:   []openapi.Response{status(200, models.FileNode{}, ""), status(304, nil, "Nothing listed has changed")},
+			Errors:      []int{400, 403, 404, 503}},
+		{Method: "GET", Path: "/api/files/content", Tag: "files", Summary: "Read a file",
+			Query: models.FileReadRequest{}, Responses: ok(models.FileContent{}), Errors: []int{400, 404, 413, 415, 503}},
+		{Method: "GET", Path: "/api/files/search", Tag: "files", Summary: "Find files by name and lines by pattern",
+			Query: models.FileSearchRequest{}, Responses: ok(files.SearchResult{}), Errors: []int{400, 404, 503}},
+		{Method: "PUT", Path: "/api/files/content", Tag: "files", Summary: "Write a file",
+			Body: models.FileWriteRequest{}, Responses: ok(models.FileContent{}), Errors: []int{400, 404, 413, 503}},
+		{Method: "POST", Path: "/api/files", Tag: "files", Summary: "Create a file or directory",
+			Body: models.FileCreateRequest{}, Responses: []openapi.Response{status(201, models.FileContent{}, "The created file")},
+			Errors: []int{400, 409, 413, 503}},
+		{Method: "DELETE", Path: "/api/files", Tag: "files", Summary: "Delete a file or directory",
+			Query: models.FileDeleteRequest{}, Responses: ok(Deleted{}), Errors: []int{400, 404, 409, 503}},
+		{Method: "POST", Path: "/api/files/rename", Tag: "files", Summary: "Rename or move a file",
+			Body: models.FileRenameRequest{}, Responses: ok(FileRenamed{}), Errors: []int{400, 404, 409, 503}},
+		{Method: "POST", Path: "/api/files/diff", Tag: "files", Summary: "Apply a unified diff to a file",
+			Description: "A conflicting diff fails with 409; the error's details.result holds the per-hunk report.",
+			Body:        models.FileDiffRequest{}, Responses: ok(files.DiffResult{}), Errors: []int{400, 404, 409, 503}},
+
+		// Agent-to-agent and WebSockets
+		{Method: "GET", Path: "/.well-known/agent.json", Tag: "a2a", Summary: "The A2A agent card", Responses: ok(models.AgentCard{})},
+		upgrade("/ws/chat", "chat", "Chat with the agent"),
+		upgrade("/ws/browser", "a2a", "Browser and terminal automation over JSON-RPC 2.0"),
+		upgrade("/ws/a2a", "a2a", "The A2A protocol over JSON-RPC 2.0"),
+		upgrade("/ws/watchdog", "watchdog", "Live watchdog alerts, proposals and scans"),
+	}
+
+	// Alert workflow actions share a shape
+	for _, action := range []string{"acknowledge", "assign", "resolve", "ignore", "reopen"} {
+		operations = append(operations, openapi.Operation{
+			Method: "POST", Path: "/api/watchdog/alerts/:id/" + action, Tag: "watchdog", Summary: strings.ToUpper(action[:1]) + action[1:] + " an alert",
+			Body: models.AlertActionRequest{}, OptionalBody: true, Responses: ok(watchdog.Alert{}), Errors: []int{400, 404, 409},
+		})
+	}
+	return operations
+}
@@ -2,8 +2,11 @@ package lightrag
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	golightrag "github.com/MegaGrindStone/go-light-rag"
 	"github.com/MegaGrindStone/go-light-rag/handler"
@@ -12,12 +15,22 @@ import (
 	"github.com/philippgille/chromem-go"
 )
 
+// ErrClientClosed is returned by operations on a closed client
+var ErrClientClosed = errors.New("lightrag client closed")
+
+// defaultCloseTimeout bounds Close, which has no caller context
+const defaultCloseTimeout = 10 * time.Second
+
 // Client wraps go-light-rag with our application-specific logic
 type Client struct {
 	llm     llm.LLM
 	store   Storage
 	handler handler.DocumentHandler
 	logger  *log.Logger
+
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup // operations Shutdown waits for
 }
 
 // Storage combines all storage interfaces
@@ -87,12 +100,15 @@ func NewClient(ctx context.Context, cfg *Config) (*Client, error) {
 		storage.EmbeddingFunc(embeddingFunc),
 	)
 	if err != nil {
+		closeStorage(ctx, graphDB)
 		return nil, fmt.Errorf("failed to initialize ChromeM: %w", err)
 	}
 
 	// Initialize BoltDB for key-value storage
 	kvDB, err := storage.NewBolt(cfg.KVDBPath)
 	if err != nil {
+		closeStorage(ctx, vecDB)
+		closeStorage(ctx, graphDB)
 		return nil, fmt.Errorf("failed to initialize BoltDB: %w", err)
 	}
 
@@ -123,6 +139,11 @@ func NewClient(ctx context.Context, cfg *Config) (*Client, error) {
 
 // InsertPerception stores perception data in LightRAG
 func (c *Client) InsertPerception(ctx context.Context, id string, content string, metadata map[string]interface{}) (string, error) {
+	if err := c.begin(); err != nil {
+		return "", err
+	}
+	defer c.inflight.Done()
+
 	doc := golightrag.Document{
 		ID:      id,
 		Content: content,
@@ -139,6 +160,11 @@ func (c *Client) InsertPerception(ctx context.Context, id string, content string
 
 // InsertReasoning stores reasoning data in LightRAG
 func (c *Client) InsertReasoning(ctx context.Context, id string, branches []string, selected string, perceptionUUID string) (string, error) {
+	if err := c.begin(); err != nil {
+		return "", err
+	}
+	defer c.inflight.Done()
+
 	// Combine branches into content
 	content := fmt.Sprintf("Reasoning Branches:\n")
 	for i, branch := range branches {
@@ -162,6 +188,11 @@ func (c *Client) InsertReasoning(ctx context.Context, id string, branches []stri
 
 // InsertAction stores action execution data in LightRAG
 func (c *Client) InsertAction(ctx context.Context, id string, plan string, result string, reasoningUUID string) (string, error) {
+	if err := c.begin(); err != nil {
+		return "", err
+	}
+	defer c.inflight.Done()
+
 	content := fmt.Sprintf("Action Plan:\n%s\n\nResult:\n%s\n\nBased on Reasoning: %s\n", plan, result, reasoningUUID)
 
 	doc := golightrag.Document{
@@ -179,6 +210,11 @@ func (c *Client) InsertAction(ctx context.Context, id string, plan string, resul
 
 // InsertReflection stores reflection data in LightRAG
 func (c *Client) InsertReflection(ctx context.Context, id string, learnings []string, patterns []string, actionUUID string) (string, error) {
+	if err := c.begin(); err != nil {
+		return "", err
+	}
+	defer c.inflight.Done()
+
 	content := fmt.Sprintf("Learnings:\n")
 	for i, learning := range learnings {
 		content += fmt.Sprintf("%d. %s\n", i+1, learning)
@@ -206,6 +242,11 @@ func (c *Client) InsertReflection(ctx context.Context, id string, learnings []st
 
 // Query performs semantic search across all stored data
 func (c *Client) Query(ctx context.Context, query string) (*QueryResult, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.inflight.Done()
+
 	conversation := []golightrag.QueryConversation{
 		{
 			Role:    golightrag.RoleUser,
@@ -281,13 +322,101 @@ func (c *Client) QueryByUUID(ctx context.Context, uuid string) (*Source, error)
 	return nil, fmt.Errorf("no data found for UUID: %s", uuid)
 }
 
-// Close closes all storage connections
-func (c *Client) Close() error {
-	// Close all storage backends
-	// Note: Implement Close methods as needed
+// begin registers an in-flight operation, failing once the client is closed.
+// Callers must call c.inflight.Done when finished.
+func (c *Client) begin() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClientClosed
+	}
+	c.inflight.Add(1)
 	return nil
 }
 
+// Close closes all storage connections, waiting up to defaultCloseTimeout
+// for in-flight operations
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+
+	return c.Shutdown(ctx)
+}
+
+// Shutdown rejects new operations, waits for in-flight ones until ctx is
+// done, then closes the graph, vector and key-value stores. It is safe to
+// call more than once.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		if c.logger != nil {
+			c.logger.Printf("Closing storage with operations still running: %v", ctx.Err())
+		}
+	}
+
+	// Close in reverse order of creation
+	var errs []error
+	if err := closeStorage(ctx, c.store.KV); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close BoltDB: %w", err))
+	}
+	if err := closeStorage(ctx, c.store.Vector); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close ChromeM: %w", err))
+	}
+	if err := closeStorage(ctx, c.store.Graph); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close Neo4j: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// closeStorage closes a storage backend if it holds resources. Neo4j takes a
+// context; Bolt's Close blocks on pending transactions, so it is abandoned if
+// ctx ends first. ChromeM persists on every write and has nothing to close.
+func closeStorage(ctx context.Context, s interface{}) error {
+	var closeFn func() error
+
+	switch closer := s.(type) {
+	case interface{ Close(context.Context) error }:
+		return closer.Close(ctx)
+	case storage.Bolt:
+		// storage.Bolt exposes its database but has no Close of its own
+		if closer.DB == nil {
+			return nil
+		}
+		closeFn = closer.DB.Close
+	case interface{ Close() error }:
+		closeFn = closer.Close
+	default:
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- closeFn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // QueryResult holds the results from a LightRAG query
 type QueryResult struct {
 	LocalEntities  []Entity
@@ -0,0 +1,330 @@
+package lightrag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	golightrag "github.com/MegaGrindStone/go-light-rag"
+	"github.com/MegaGrindStone/go-light-rag/storage"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrDocumentNotFound is returned when no stored chunk or graph element derives from a document
+var ErrDocumentNotFound = errors.New("document not found")
+
+// sourcesBucket is the Bolt bucket go-light-rag keeps document chunks in
+var sourcesBucket = []byte("sources")
+
+// DeleteResult counts what DeleteDocument removed or trimmed
+type DeleteResult struct {
+	Chunks               int `json:"chunks"`
+	EntitiesDeleted      int `json:"entities_deleted"`
+	EntitiesUpdated      int `json:"entities_updated"` // still backed by other documents
+	RelationshipsDeleted int `json:"relationships_deleted"`
+	RelationshipsUpdated int `json:"relationships_updated"`
+}
+
+// graphCleanup lists the graph elements a deletion removed, for vector cleanup
+type graphCleanup struct {
+	entities      []string
+	relationships [][2]string
+}
+
+// chunkPrefix is the prefix go-light-rag gives every chunk ID of a document
+// ("<doc>-chunk-<n>")
+func chunkPrefix(id string) string {
+	return id + "-chunk-"
+}
+
+// UpdateDocument replaces a document's content, removing everything derived
+// from the previous version before inserting the new one
+func (c *Client) UpdateDocument(ctx context.Context, id, content string) error {
+	if err := c.begin(); err != nil {
+		return err
+	}
+	defer c.inflight.Done()
+
+	if _, err := c.deleteDocument(ctx, id); err != nil && !errors.Is(err, ErrDocumentNotFound) {
+		return fmt.Errorf("failed to remove previous version: %w", err)
+	}
+
+	doc := golightrag.Document{
+		ID:      id,
+		Content: content,
+	}
+
+	if err := golightrag.Insert(doc, c.handler, c.store, c.llm, c.logger); err != nil {
+		return fmt.Errorf("failed to insert document: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDocument removes a document's chunks and the graph entities and
+// relationships extracted from it. Elements also extracted from other
+// documents are kept with the document's chunks dropped from their sources;
+// their merged descriptions are left as they are.
+func (c *Client) DeleteDocument(ctx context.Context, id string) (*DeleteResult, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.inflight.Done()
+
+	return c.deleteDocument(ctx, id)
+}
+
+func (c *Client) deleteDocument(ctx context.Context, id string) (*DeleteResult, error) {
+	result := &DeleteResult{}
+	prefix := chunkPrefix(id)
+
+	// The graph goes first: once no entity cites the chunks, queries can't reach them
+	cleanup, err := c.deleteGraphSources(ctx, prefix, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean up graph: %w", err)
+	}
+
+	if err := c.deleteVectors(ctx, cleanup); err != nil {
+		return nil, fmt.Errorf("failed to clean up vectors: %w", err)
+	}
+
+	chunks, err := c.deleteChunks(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	result.Chunks = chunks
+
+	if result.Chunks == 0 && result.EntitiesDeleted == 0 && result.EntitiesUpdated == 0 &&
+		result.RelationshipsDeleted == 0 && result.RelationshipsUpdated == 0 {
+		return result, ErrDocumentNotFound
+	}
+
+	return result, nil
+}
+
+// deleteGraphSources drops chunks with prefix from every entity's and
+// relationship's source_ids, deleting elements left without sources
+func (c *Client) deleteGraphSources(ctx context.Context, prefix string, result *DeleteResult) (*graphCleanup, error) {
+	graph, ok := c.store.Graph.(storage.Neo4J)
+	if !ok {
+		return nil, fmt.Errorf("graph storage %T does not support deletion", c.store.Graph)
+	}
+
+	session := graph.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	cleanup, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		cleanup := &graphCleanup{entities: []string{}}
+
+		// Relationships
+		records, err := tx.Run(ctx, `
+			MATCH (a:base)-[r:DIRECTED]->(b:base)
+			WHERE r.source_ids CONTAINS $prefix
+			RETURN a.entity_id AS source, b.entity_id AS target, r.source_ids AS source_ids`,
+			map[string]interface{}{"prefix": prefix})
+		if err != nil {
+			return nil, err
+		}
+
+		relUpdates := make([]map[string]interface{}, 0)
+		relDeletes := make([]map[string]interface{}, 0)
+		for records.Next(ctx) {
+			values := records.Record().Values
+			source, _ := values[0].(string)
+			target, _ := values[1].(string)
+			sourceIDs, _ := values[2].(string)
+
+			pair := map[string]interface{}{"source": source, "target": target}
+			if remaining, changed := removeSources(sourceIDs, prefix); !changed {
+				continue
+			} else if remaining == "" {
+				relDeletes = append(relDeletes, pair)
+				cleanup.relationships = append(cleanup.relationships, [2]string{source, target})
+			} else {
+				pair["source_ids"] = remaining
+				relUpdates = append(relUpdates, pair)
+			}
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		// Entities
+		records, err = tx.Run(ctx, `
+			MATCH (n:base)
+			WHERE n.source_ids CONTAINS $prefix
+			RETURN n.entity_id AS name, n.source_ids AS source_ids`,
+			map[string]interface{}{"prefix": prefix})
+		if err != nil {
+			return nil, err
+		}
+
+		entityUpdates := make([]map[string]interface{}, 0)
+		for records.Next(ctx) {
+			values := records.Record().Values
+			name, _ := values[0].(string)
+			sourceIDs, _ := values[1].(string)
+
+			if remaining, changed := removeSources(sourceIDs, prefix); !changed {
+				continue
+			} else if remaining == "" {
+				cleanup.entities = append(cleanup.entities, name)
+			} else {
+				entityUpdates = append(entityUpdates, map[string]interface{}{"name": name, "source_ids": remaining})
+			}
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		// Relationships of deleted entities go with them, even if other documents cite them
+		records, err = tx.Run(ctx, `
+			MATCH (a:base)-[r:DIRECTED]->(b:base)
+			WHERE a.entity_id IN $names OR b.entity_id IN $names
+			RETURN a.entity_id AS source, b.entity_id AS target`,
+			map[string]interface{}{"names": cleanup.entities})
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			source, _ := values[0].(string)
+			target, _ := values[1].(string)
+			cleanup.relationships = appendPairIfMissing(cleanup.relationships, [2]string{source, target})
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		statements := []struct {
+			query  string
+			params map[string]interface{}
+		}{
+			{`
+			UNWIND $rels AS rel
+			MATCH (:base {entity_id: rel.source})-[r:DIRECTED]->(:base {entity_id: rel.target})
+			SET r.source_ids = rel.source_ids`, map[string]interface{}{"rels": relUpdates}},
+			{`
+			UNWIND $rels AS rel
+			MATCH (:base {entity_id: rel.source})-[r:DIRECTED]->(:base {entity_id: rel.target})
+			DELETE r`, map[string]interface{}{"rels": relDeletes}},
+			{`
+			UNWIND $entities AS entity
+			MATCH (n:base {entity_id: entity.name})
+			SET n.source_ids = entity.source_ids`, map[string]interface{}{"entities": entityUpdates}},
+			{`
+			MATCH (n:base)
+			WHERE n.entity_id IN $names
+			DETACH DELETE n`, map[string]interface{}{"names": cleanup.entities}},
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Run(ctx, stmt.query, stmt.params); err != nil {
+				return nil, err
+			}
+		}
+
+		result.RelationshipsUpdated = len(relUpdates)
+		result.RelationshipsDeleted = len(cleanup.relationships)
+		result.EntitiesUpdated = len(entityUpdates)
+		result.EntitiesDeleted = len(cleanup.entities)
+
+		return cleanup, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cleanup.(*graphCleanup), nil
+}
+
+// deleteVectors removes the embeddings of deleted entities and relationships
+func (c *Client) deleteVectors(ctx context.Context, cleanup *graphCleanup) error {
+	if len(cleanup.entities) == 0 && len(cleanup.relationships) == 0 {
+		return nil
+	}
+
+	vectors, ok := c.store.Vector.(storage.Chromem)
+	if !ok {
+		return fmt.Errorf("vector storage %T does not support deletion", c.store.Vector)
+	}
+
+	// Upserts add a new vector per call, so match on metadata rather than ID
+	for _, name := range cleanup.entities {
+		where := map[string]string{"entity_name": name}
+		if err := vectors.EntitiesColl.Delete(ctx, where, nil); err != nil {
+			return fmt.Errorf("failed to delete entity %s: %w", name, err)
+		}
+	}
+
+	for _, pair := range cleanup.relationships {
+		where := map[string]string{"source_entity": pair[0], "target_entity": pair[1]}
+		if err := vectors.RelationshipsColl.Delete(ctx, where, nil); err != nil {
+			return fmt.Errorf("failed to delete relationship %s -> %s: %w", pair[0], pair[1], err)
+		}
+	}
+
+	return nil
+}
+
+// deleteChunks removes a document's chunks from the key-value store
+func (c *Client) deleteChunks(prefix string) (int, error) {
+	kv, ok := c.store.KV.(storage.Bolt)
+	if !ok {
+		return 0, fmt.Errorf("key-value storage %T does not support deletion", c.store.KV)
+	}
+
+	deleted := 0
+	err := kv.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sourcesBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		// Collect first; deleting while iterating skips keys
+		keys := make([][]byte, 0)
+		cursor := bucket.Cursor()
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cursor.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+
+	return deleted, err
+}
+
+// removeSources drops source IDs with prefix from a separator-joined list,
+// reporting whether any were removed
+func removeSources(sourceIDs, prefix string) (string, bool) {
+	kept := make([]string, 0)
+	changed := false
+
+	for _, id := range strings.Split(sourceIDs, golightrag.GraphFieldSeparator) {
+		switch {
+		case strings.HasPrefix(id, prefix):
+			changed = true
+		case id != "":
+			kept = append(kept, id)
+		}
+	}
+
+	return strings.Join(kept, golightrag.GraphFieldSeparator), changed
+}
+
+func appendPairIfMissing(pairs [][2]string, pair [2]string) [][2]string {
+	for _, p := range pairs {
+		if p == pair {
+			return pairs
+		}
+	}
+	return append(pairs, pair)
+}
@@ -2,11 +2,13 @@ package mcp
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"agent-workspace/backend/pkg/models"
@@ -30,6 +32,7 @@ type Server struct {
 	Tools   []Tool
 	Status  string
 	mu      sync.Mutex
+	pinging atomic.Bool // a ping is waiting on the server
 }
 
 // Tool represents an MCP tool
@@ -211,6 +214,34 @@ func (c *Client) GetServerStatus(name string) (string, error) {
 	return server.Status, nil
 }
 
+// Ping sends the server an MCP ping, checking it answers before ctx ends.
+// A server that hasn't answered the last ping isn't sent another.
+func (c *Client) Ping(ctx context.Context, name string) error {
+	c.mu.RLock()
+	server, exists := c.servers[name]
+	c.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("server %s not found", name)
+	}
+	if !server.pinging.CompareAndSwap(false, true) {
+		return fmt.Errorf("server %s has not answered the last ping", name)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer server.pinging.Store(false)
+		done <- server.ping()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("server %s did not answer: %w", name, ctx.Err())
+	}
+}
+
 // Cleanup disconnects all servers
 func (c *Client) Cleanup() {
 	c.mu.Lock()
@@ -318,6 +349,25 @@ func (s *Server) callTool(name string, args map[string]interface{}) (map[string]
 	return resp.Result, nil
 }
 
+// ping sends a ping request
+func (s *Server) ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp, err := s.sendRequest(MCPRequest{
+		JSONRPC: "2.0",
+		ID:      int(time.Now().Unix()),
+		Method:  "ping",
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("MCP error %d: %s", resp.Error.Code, resp.Error.Message)
+	}
+	return nil
+}
+
 // sendRequest sends a request and waits for response
 func (s *Server) sendRequest(req MCPRequest) (*MCPResponse, error) {
 	// Marshal request
@@ -0,0 +1,260 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/models"
+)
+
+// maxAuditQueryChars bounds how much of a query or stored content an entry keeps
+const maxAuditQueryChars = 500
+
+// AuditEntry records one access to long-term memory
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Operation  string    `json:"operation"` // "store", "query" or "delete"
+	Method     string    `json:"method"`    // the LongTermMemory method, e.g. "search", "upsert"
+	Caller     string    `json:"caller"`
+	Workspace  string    `json:"workspace"`
+	RequestID  string    `json:"request_id,omitempty"`  // the API request or agent task behind the access
+	Query      string    `json:"query,omitempty"`       // query text, stored content or delete filter, truncated
+	DocumentID string    `json:"document_id,omitempty"` // stores only
+	Results    int       `json:"results"`               // hits returned, documents written or deleted
+	LatencyMs  float64   `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AuditPage is one page of audit entries, newest first
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+	HasMore bool         `json:"has_more"`
+}
+
+// AuditLog appends memory accesses to a JSON-lines file. Entries are never
+// rewritten, so the file is a reviewable history of what the agent learned,
+// looked up and forgot.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewAuditLog opens (or creates) the audit log at path for appending
+func NewAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &AuditLog{path: path, file: file}, nil
+}
+
+// NewAuditLogFromEnv opens the log at MEMORY_AUDIT_LOG_PATH, or returns nil
+// when MEMORY_AUDIT is false
+func NewAuditLogFromEnv() (*AuditLog, error) {
+	if getEnv("MEMORY_AUDIT", "true") == "false" {
+		return nil, nil
+	}
+	return NewAuditLog(getEnv("MEMORY_AUDIT_LOG_PATH", "./data/memory_audit.jsonl"))
+}
+
+// Record appends an entry. Failures are logged rather than returned so an
+// audit problem never fails the memory operation itself.
+func (a *AuditLog) Record(entry AuditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		slog.Warn("failed to encode audit entry", "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return
+	}
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		slog.Warn("failed to write audit entry", "error", err)
+	}
+}
+
+// Query returns matching entries, newest first. Since and Until are RFC 3339
+// timestamps; every set field must match.
+func (a *AuditLog) Query(req models.MemoryAuditRequest) (*AuditPage, error) {
+	offset, limit := normalizePage(req.Offset, req.Limit)
+
+	var since, until time.Time
+	var err error
+	if req.Since != "" {
+		if since, err = time.Parse(time.RFC3339, req.Since); err != nil {
+			return nil, fmt.Errorf("%w: since: %v", ErrInvalidMemoryRequest, err)
+		}
+	}
+	if req.Until != "" {
+		if until, err = time.Parse(time.RFC3339, req.Until); err != nil {
+			return nil, fmt.Errorf("%w: until: %v", ErrInvalidMemoryRequest, err)
+		}
+	}
+
+	// Hold the lock so a concurrent append can't be read half-written
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	matched := make([]AuditEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		switch {
+		case req.Operation != "" && entry.Operation != req.Operation:
+		case req.Caller != "" && entry.Caller != req.Caller:
+		case !since.IsZero() && entry.Time.Before(since):
+		case !until.IsZero() && entry.Time.After(until):
+		default:
+			matched = append(matched, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	// The file is in append order
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+
+	return &AuditPage{
+		Entries: paginate(matched, offset, limit),
+		Total:   len(matched),
+		Offset:  offset,
+		Limit:   limit,
+		HasMore: offset+limit < len(matched),
+	}, nil
+}
+
+// Close closes the log file
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+type auditContextKey int
+
+const (
+	callerKey auditContextKey = iota
+	auditedKey
+)
+
+// WithCaller tags ctx with who is accessing memory, e.g. "planner" or "api:10.0.0.5"
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// CallerFrom returns the caller set by WithCaller, or "unknown"
+func CallerFrom(ctx context.Context) string {
+	if caller, ok := ctx.Value(callerKey).(string); ok && caller != "" {
+		return caller
+	}
+	return "unknown"
+}
+
+// SetAuditLog sets the log long-term memory accesses are recorded to; nil disables auditing
+func (m *LongTermMemory) SetAuditLog(audit *AuditLog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audit = audit
+}
+
+// beginAudit starts timing an operation. The returned context marks it as
+// audited so nested calls (GetContext searching, Upsert embedding) aren't
+// recorded again; finish records the entry.
+func (m *LongTermMemory) beginAudit(ctx context.Context, operation, method, query string) (context.Context, func(results int, documentID string, err error)) {
+	m.mu.RLock()
+	audit := m.audit
+	m.mu.RUnlock()
+
+	if audit == nil || ctx.Value(auditedKey) != nil {
+		return ctx, func(int, string, error) {}
+	}
+
+	start := time.Now()
+	entry := AuditEntry{
+		Time:      start,
+		Operation: operation,
+		Method:    method,
+		Caller:    CallerFrom(ctx),
+		Workspace: WorkspaceFrom(ctx),
+		RequestID: logging.RequestID(ctx),
+		Query:     truncateAudit(query),
+	}
+
+	return context.WithValue(ctx, auditedKey, true), func(results int, documentID string, err error) {
+		entry.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		entry.Results = results
+		entry.DocumentID = documentID
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		audit.Record(entry)
+		logging.FromContext(ctx).Debug("memory access", "operation", operation, "method", method,
+			"results", results, "latency_ms", entry.LatencyMs, "error", entry.Error)
+	}
+}
+
+// auditFilter renders a filter for the audit log
+func auditFilter(filter MemoryFilter) string {
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return fmt.Sprintf("%+v", filter)
+	}
+	return string(data)
+}
+
+func truncateAudit(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= maxAuditQueryChars {
+		return text
+	}
+	// Back up to a rune boundary
+	cut := maxAuditQueryChars
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
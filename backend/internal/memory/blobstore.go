@@ -0,0 +1,170 @@
+package memory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrBlobNotFound is returned when a blob ID has no stored data
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore holds large binary payloads (screenshots) by content hash so
+// TaskMemory only keeps references. Implementations may be local disk or
+// an object store.
+type BlobStore interface {
+	Put(data []byte) (string, error)
+	Get(id string) ([]byte, error)
+	Delete(id string) error
+}
+
+// blobID returns the content address of data
+func blobID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// validBlobID reports whether id is a well-formed SHA-256 hex digest
+func validBlobID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// DiskBlobStore stores blobs as files under root, sharded by hash prefix
+type DiskBlobStore struct {
+	root string
+}
+
+// NewDiskBlobStore creates a disk-backed blob store rooted at root
+func NewDiskBlobStore(root string) (*DiskBlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	return &DiskBlobStore{root: root}, nil
+}
+
+// NewDiskBlobStoreFromEnv creates a blob store at SCREENSHOT_STORE_PATH
+func NewDiskBlobStoreFromEnv() (*DiskBlobStore, error) {
+	return NewDiskBlobStore(getEnv("SCREENSHOT_STORE_PATH", "./data/screenshots"))
+}
+
+func (s *DiskBlobStore) path(id string) string {
+	return filepath.Join(s.root, id[:2], id)
+}
+
+// Put writes data if it is not already stored and returns its ID
+func (s *DiskBlobStore) Put(data []byte) (string, error) {
+	id := blobID(data)
+	path := s.path(id)
+
+	if _, err := os.Stat(path); err == nil {
+		return id, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// Write to a temp file and rename so readers never see partial blobs
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	return id, nil
+}
+
+// Get reads a blob by ID
+func (s *DiskBlobStore) Get(id string) ([]byte, error) {
+	if !validBlobID(id) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, id)
+	}
+
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	return data, nil
+}
+
+// Delete removes a blob; deleting a missing blob is not an error
+func (s *DiskBlobStore) Delete(id string) error {
+	if !validBlobID(id) {
+		return nil
+	}
+
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+
+	return nil
+}
+
+// MemoryBlobStore keeps blobs in process memory; used when no disk store is configured
+type MemoryBlobStore struct {
+	blobs map[string][]byte
+	mu    sync.RWMutex
+}
+
+// NewMemoryBlobStore creates an in-memory blob store
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{
+		blobs: make(map[string][]byte),
+	}
+}
+
+// Put stores data and returns its ID
+func (s *MemoryBlobStore) Put(data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := blobID(data)
+	s.blobs[id] = data
+	return id, nil
+}
+
+// Get returns a blob by ID
+func (s *MemoryBlobStore) Get(id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, exists := s.blobs[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, id)
+	}
+	return data, nil
+}
+
+// Delete removes a blob
+func (s *MemoryBlobStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, id)
+	return nil
+}
@@ -0,0 +1,287 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	lightrag "github.com/MegaGrindStone/go-light-rag"
+	"github.com/MegaGrindStone/go-light-rag/storage"
+)
+
+// ErrMemoryUnavailable is returned while long-term memory is connecting or degraded
+var ErrMemoryUnavailable = errors.New("long-term memory unavailable")
+
+const (
+	// reconnectMinDelay is the first backoff delay between connection attempts
+	reconnectMinDelay = 2 * time.Second
+	// reconnectMaxDelay caps the backoff delay between connection attempts
+	reconnectMaxDelay = 60 * time.Second
+)
+
+func newLongTermMemory() *LongTermMemory {
+	return &LongTermMemory{
+		status:    "connecting",
+		dedup:     DedupConfigFromEnv(),
+		federated: FederatedConfigFromEnv(),
+		stopCh:    make(chan struct{}),
+
+		rewardWeight: getEnvWeight("MEMORY_REWARD_WEIGHT", 0.2),
+
+		contextCandidates:  getEnvInt("MEMORY_CONTEXT_CANDIDATES", 20),
+		contextTopK:        getEnvInt("MEMORY_CONTEXT_TOP_K", 5),
+		contextChunkTokens: getEnvInt("MEMORY_CONTEXT_CHUNK_TOKENS", 256),
+		tokens:             NewTokenEstimator(getEnv("OLLAMA_MODEL", "gemma3:27b")),
+	}
+}
+
+// StartLongTermMemory returns immediately and connects in the background.
+// Until the first connection succeeds, operations return ErrMemoryUnavailable.
+func StartLongTermMemory() *LongTermMemory {
+	m := newLongTermMemory()
+
+	go func() {
+		if !m.connectWithBackoff() {
+			return
+		}
+		m.monitorLoop()
+	}()
+
+	return m
+}
+
+// IsReady reports whether long-term memory can serve requests
+func (m *LongTermMemory) IsReady() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.initialized
+}
+
+// Status returns the connection state and the last connection error, if any
+func (m *LongTermMemory) Status() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := map[string]interface{}{
+		"status": m.status,
+		"ready":  m.initialized,
+	}
+	if m.lastError != nil {
+		status["error"] = m.lastError.Error()
+	}
+
+	return status
+}
+
+// connect initializes any missing storage backends and the LightRAG instance
+func (m *LongTermMemory) connect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status == "closed" {
+		return ErrMemoryUnavailable
+	}
+
+	err := m.connectLocked(ctx)
+	if err != nil {
+		m.initialized = false
+		m.status = "degraded"
+		m.lastError = err
+		return err
+	}
+
+	m.initialized = true
+	m.status = "ready"
+	m.lastError = nil
+	return nil
+}
+
+func (m *LongTermMemory) connectLocked(ctx context.Context) error {
+	// Fail fast if the embedding model is missing; placeholder vectors make search meaningless
+	if m.embeddings == nil {
+		embeddings := NewEmbeddingGenerator()
+		if err := embeddings.Verify(ctx); err != nil {
+			return fmt.Errorf("failed to initialize embeddings: %w", err)
+		}
+		m.embeddings = embeddings
+	}
+
+	// Local stores are opened once; Bolt holds a file lock for the process lifetime
+	if m.chromemStore == nil {
+		chromem, err := initChromem(m.embeddings)
+		if err != nil {
+			return fmt.Errorf("failed to initialize ChromeM: %w", err)
+		}
+		m.chromemStore = chromem
+	}
+
+	if m.boltStore == nil {
+		bolt, err := initBolt()
+		if err != nil {
+			return fmt.Errorf("failed to initialize Bolt: %w", err)
+		}
+		m.boltStore = bolt
+	}
+
+	if m.documents == nil {
+		documents, err := openDocumentIndex()
+		if err != nil {
+			return fmt.Errorf("failed to initialize document index: %w", err)
+		}
+		m.documents = documents
+	}
+
+	if m.vectors == nil {
+		vectors, err := NewVectorStoreFromEnv(ctx, m.embeddings.Dimension())
+		if err != nil {
+			return fmt.Errorf("failed to initialize vector store: %w", err)
+		}
+		if err := m.documents.migrateEmbeddings(ctx, vectors); err != nil {
+			vectors.Close()
+			return err
+		}
+		m.vectors = vectors
+	}
+
+	// Neo4j is re-dialed on every attempt
+	if m.neo4jStorage != nil {
+		m.neo4jStorage.Close(context.Background())
+		m.neo4jStorage = nil
+	}
+
+	neo4j, err := initNeo4j(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize Neo4j: %w", err)
+	}
+	m.neo4jStorage = neo4j
+
+	schema, err := m.migrateNeo4j(ctx)
+	if err != nil {
+		return err
+	}
+	m.graphSchema = schema
+
+	// Initialize LightRAG
+	rag, err := m.newRAG(m.chromemStore, m.boltStore)
+	if err != nil {
+		return err
+	}
+	m.rag = rag
+
+	return m.reconnectWorkspaces()
+}
+
+// newRAG builds a LightRAG instance over the current Neo4j connection
+func (m *LongTermMemory) newRAG(chromem *storage.Chromem, bolt *storage.Bolt) (*lightrag.LightRAG, error) {
+	rag, err := lightrag.New(
+		lightrag.WithGraphStorage(m.neo4jStorage),
+		lightrag.WithVectorStorage(chromem),
+		lightrag.WithKVStorage(bolt),
+		lightrag.WithEmbeddingFunc(m.embeddings.EmbeddingFunc()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize LightRAG: %w", err)
+	}
+	return rag, nil
+}
+
+// connectWithBackoff retries connect until it succeeds or memory is closed
+func (m *LongTermMemory) connectWithBackoff() bool {
+	delay := reconnectMinDelay
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		err := m.connect(ctx)
+		cancel()
+
+		if err == nil {
+			slog.Info("long-term memory connected")
+			return true
+		}
+		if errors.Is(err, ErrMemoryUnavailable) {
+			return false
+		}
+
+		slog.Warn("long-term memory unavailable, retrying", "retry_in", delay, "error", err)
+
+		select {
+		case <-m.stopCh:
+			return false
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// monitorLoop periodically verifies Neo4j and reconnects when it drops
+func (m *LongTermMemory) monitorLoop() {
+	interval := time.Duration(getEnvInt("NEO4J_HEALTH_INTERVAL_SECONDS", 30)) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		err := m.verify()
+		if err == nil {
+			continue
+		}
+		slog.Warn("lost connection to Neo4j, reconnecting", "error", err)
+
+		if !m.connectWithBackoff() {
+			return
+		}
+	}
+}
+
+// verify checks Neo4j connectivity and marks memory degraded on failure
+func (m *LongTermMemory) verify() error {
+	m.mu.RLock()
+	neo4jStorage := m.neo4jStorage
+	m.mu.RUnlock()
+
+	if neo4jStorage == nil {
+		return ErrMemoryUnavailable
+	}
+
+	timeout := time.Duration(getEnvInt("NEO4J_CONNECT_TIMEOUT_SECONDS", 10)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := neo4jStorage.Client.VerifyConnectivity(ctx)
+	if err != nil {
+		m.mu.Lock()
+		if m.status != "closed" {
+			m.initialized = false
+			m.status = "degraded"
+			m.lastError = err
+		}
+		m.mu.Unlock()
+	}
+
+	return err
+}
+
+// Ping checks Neo4j answers before ctx ends. Unlike the connection monitor
+// it leaves the memory status alone.
+func (m *LongTermMemory) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	neo4jStorage := m.neo4jStorage
+	m.mu.RUnlock()
+
+	if neo4jStorage == nil {
+		return ErrMemoryUnavailable
+	}
+	return neo4jStorage.Client.VerifyConnectivity(ctx)
+}
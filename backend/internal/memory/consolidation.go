@@ -0,0 +1,312 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// Entity is a concept extracted from a finished task
+type Entity struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// Relation links two extracted entities
+type Relation struct {
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// Consolidation is the knowledge distilled from one task's execution trace
+type Consolidation struct {
+	TaskID    string     `json:"task_id"`
+	TraceID   string     `json:"trace_id"`
+	Summary   string     `json:"summary"`
+	Lessons   []string   `json:"lessons"`
+	Entities  []Entity   `json:"entities"`
+	Relations []Relation `json:"relations"`
+}
+
+// Consolidator promotes finished short-term tasks into long-term memory
+type Consolidator struct {
+	longTerm  *LongTermMemory
+	shortTerm *ShortTermMemory
+	llm       llm.Provider // the reasoner's
+	stopCh    chan struct{}
+}
+
+// NewConsolidator creates a consolidator
+func NewConsolidator(longTerm *LongTermMemory, shortTerm *ShortTermMemory, llm llm.Provider) *Consolidator {
+	return &Consolidator{
+		longTerm:  longTerm,
+		shortTerm: shortTerm,
+		llm:       llm,
+	}
+}
+
+// ConsolidationIntervalFromEnv returns CONSOLIDATION_INTERVAL_MINUTES (default nightly)
+func ConsolidationIntervalFromEnv() time.Duration {
+	return time.Duration(getEnvInt("CONSOLIDATION_INTERVAL_MINUTES", 24*60)) * time.Minute
+}
+
+// Start sweeps for unconsolidated finished tasks every interval
+func (c *Consolidator) Start(interval time.Duration) {
+	c.stopCh = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case <-ticker.C:
+				count, err := c.ConsolidatePending(WithCaller(llm.WithPriority(context.Background(), llm.PriorityBackground), "consolidation"))
+				if err != nil {
+					slog.Warn("consolidation sweep stopped early", "error", err)
+				}
+				if count > 0 {
+					slog.Info("consolidated tasks into long-term memory", "tasks", count)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic sweep
+func (c *Consolidator) Stop() {
+	if c.stopCh != nil {
+		close(c.stopCh)
+		c.stopCh = nil
+	}
+}
+
+// ConsolidatePending consolidates every finished task not yet consolidated
+func (c *Consolidator) ConsolidatePending(ctx context.Context) (int, error) {
+	count := 0
+
+	for _, task := range c.shortTerm.Tasks() {
+		status := task.GetStatus()
+		if status != TaskStatusCompleted && status != TaskStatusFailed {
+			continue
+		}
+		if task.IsConsolidated() {
+			continue
+		}
+
+		if _, err := c.ConsolidateTask(ctx, task); err != nil {
+			// Long-term memory being down affects every task; retry on the next sweep
+			if errors.Is(err, ErrMemoryUnavailable) {
+				return count, err
+			}
+			logging.FromContext(ctx).Warn("failed to consolidate task", "task_id", task.TaskID, "error", err)
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// ConsolidateTask summarizes a task with the LLM, stores the summary in the
+// task's workspace and links extracted entities to the task's execution trace
+// in Neo4j
+func (c *Consolidator) ConsolidateTask(ctx context.Context, task *TaskMemory) (*Consolidation, error) {
+	ctx = WithWorkspace(ctx, task.Workspace)
+
+	if !c.longTerm.IsReady() {
+		return nil, ErrMemoryUnavailable
+	}
+
+	consolidation, err := c.extract(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+
+	content := formatConsolidation(consolidation)
+	metadata := map[string]interface{}{
+		"type":         "task_summary",
+		"task_id":      consolidation.TaskID,
+		"trace_id":     consolidation.TraceID,
+		"doc_id":       "task_summary:" + consolidation.TaskID,
+		"merge_policy": string(MergeReplace),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+	if err := c.longTerm.Store(ctx, content, metadata); err != nil {
+		return nil, fmt.Errorf("failed to store summary: %w", err)
+	}
+
+	if err := c.longTerm.LinkTrace(ctx, consolidation); err != nil {
+		return nil, fmt.Errorf("failed to link entities: %w", err)
+	}
+
+	task.MarkConsolidated()
+	return consolidation, nil
+}
+
+// extract asks the LLM for a summary, lessons, entities and relations
+func (c *Consolidator) extract(ctx context.Context, task *TaskMemory) (*Consolidation, error) {
+	goal, _, _ := task.GetPlan()
+
+	var trace strings.Builder
+	for _, entry := range task.entries(nil) {
+		fmt.Fprintf(&trace, "[%s] %s\n", entry.Kind, entry.Content)
+	}
+
+	prompt := fmt.Sprintf(`Consolidate this finished agent task into long-term knowledge.
+
+Goal: %s
+Outcome: %s
+
+Execution trace:
+%s
+Respond with only a JSON object:
+{"summary": "2-4 sentences", "lessons": ["..."], "entities": [{"name": "", "type": "tool|website|file|concept|error", "description": ""}], "relations": [{"source": "", "target": "", "type": "", "description": ""}]}`,
+		goal, task.GetStatus(), trace.String())
+
+	resp, err := c.llm.ChatCompletion(ctx, llm.Request{
+		Messages:    []ollama.ChatMessage{{Role: "user", Content: prompt}},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize task: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("failed to summarize task: empty response")
+	}
+
+	consolidation, err := parseConsolidation(resp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	// The short-term trace is exported under the task ID, so it doubles as the trace ID
+	consolidation.TaskID = task.TaskID
+	consolidation.TraceID = task.TaskID
+
+	return consolidation, nil
+}
+
+// parseConsolidation decodes the LLM's JSON, tolerating surrounding prose or code fences
+func parseConsolidation(text string) (*Consolidation, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON object in consolidation response")
+	}
+
+	var consolidation Consolidation
+	if err := json.Unmarshal([]byte(text[start:end+1]), &consolidation); err != nil {
+		return nil, fmt.Errorf("failed to parse consolidation: %w", err)
+	}
+
+	if strings.TrimSpace(consolidation.Summary) == "" {
+		return nil, fmt.Errorf("consolidation response has no summary")
+	}
+
+	return &consolidation, nil
+}
+
+// formatConsolidation renders a consolidation as text for LightRAG
+func formatConsolidation(c *Consolidation) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Task %s summary (trace %s):\n%s\n", c.TaskID, c.TraceID, c.Summary)
+	if len(c.Lessons) > 0 {
+		b.WriteString("\nLessons:\n")
+		for _, lesson := range c.Lessons {
+			fmt.Fprintf(&b, "- %s\n", lesson)
+		}
+	}
+
+	return b.String()
+}
+
+// LinkTrace writes extracted entities and relations to Neo4j, each linked to
+// an ExecutionTrace node for provenance
+func (m *LongTermMemory) LinkTrace(ctx context.Context, c *Consolidation) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return ErrMemoryUnavailable
+	}
+
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		_, err := tx.Run(ctx, `
+			MERGE (t:ExecutionTrace {id: $trace_id})
+			SET t.task_id = $task_id, t.summary = $summary, t.consolidated_at = datetime()`,
+			map[string]interface{}{
+				"trace_id": c.TraceID,
+				"task_id":  c.TaskID,
+				"summary":  c.Summary,
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entity := range c.Entities {
+			if entity.Name == "" {
+				continue
+			}
+			_, err := tx.Run(ctx, `
+				MERGE (e:Entity {name: $name})
+				ON CREATE SET e.type = $type, e.description = $description
+				WITH e
+				MATCH (t:ExecutionTrace {id: $trace_id})
+				MERGE (e)-[:EXTRACTED_FROM]->(t)`,
+				map[string]interface{}{
+					"name":        entity.Name,
+					"type":        entity.Type,
+					"description": entity.Description,
+					"trace_id":    c.TraceID,
+				})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, relation := range c.Relations {
+			if relation.Source == "" || relation.Target == "" {
+				continue
+			}
+			_, err := tx.Run(ctx, `
+				MERGE (a:Entity {name: $source})
+				MERGE (b:Entity {name: $target})
+				MERGE (a)-[r:RELATED {type: $type}]->(b)
+				SET r.description = $description, r.trace_id = $trace_id`,
+				map[string]interface{}{
+					"source":      relation.Source,
+					"target":      relation.Target,
+					"type":        relation.Type,
+					"description": relation.Description,
+					"trace_id":    c.TraceID,
+				})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// defaultContextTokens is the budget used when GetContext is given none
+const defaultContextTokens = 2000
+
+// TokenEstimator approximates how many tokens a model's tokenizer produces for text
+type TokenEstimator struct {
+	charsPerToken float64
+}
+
+// charsPerTokenByFamily holds average characters per token for English text and code
+var charsPerTokenByFamily = map[string]float64{
+	"gemma":   3.8,
+	"llama":   3.6,
+	"mistral": 3.6,
+	"qwen":    3.3,
+	"phi":     3.5,
+}
+
+// NewTokenEstimator returns an estimator tuned for the model's family, e.g. "gemma3:27b"
+func NewTokenEstimator(model string) *TokenEstimator {
+	model = strings.ToLower(model)
+	for family, ratio := range charsPerTokenByFamily {
+		if strings.HasPrefix(model, family) {
+			return &TokenEstimator{charsPerToken: ratio}
+		}
+	}
+	return &TokenEstimator{charsPerToken: 4}
+}
+
+// Count estimates the token count of text. CJK characters are counted as one
+// token each since subword tokenizers rarely merge them.
+func (e *TokenEstimator) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	var cjk, other int
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+
+	// Short words cost at least a token each, so never estimate below the word count
+	estimate := math.Ceil(float64(other) / e.charsPerToken)
+	if words := float64(len(strings.Fields(text))); other > cjk && words > estimate {
+		estimate = words
+	}
+
+	return cjk + int(estimate)
+}
+
+// contextChunk is a slice of a hit's content considered for packing
+type contextChunk struct {
+	hit    int // index into the ranked hits
+	index  int // position within the hit's content
+	text   string
+	tokens int
+	score  float64
+}
+
+// packContext greedily fills maxTokens with the highest-scoring chunks of
+// hits and cites each source document. Hits must be in relevance order.
+func packContext(hits []MemoryHit, maxTokens, chunkTokens int, tokens *TokenEstimator) string {
+	if maxTokens <= 0 {
+		maxTokens = defaultContextTokens
+	}
+
+	chunks := make([]contextChunk, 0, len(hits))
+	for i, hit := range hits {
+		for j, text := range splitChunks(hit.Content, chunkTokens, tokens) {
+			chunks = append(chunks, contextChunk{
+				hit:    i,
+				index:  j,
+				text:   text,
+				tokens: tokens.Count(text),
+				score:  hit.Score,
+			})
+		}
+	}
+
+	// Stable sort keeps earlier hits and earlier chunks ahead on ties
+	sort.SliceStable(chunks, func(a, b int) bool {
+		return chunks[a].score > chunks[b].score
+	})
+
+	citations := make(map[int]int) // hit index -> citation number
+	selected := make([]contextChunk, 0)
+	used := tokens.Count("Sources:\n")
+
+	for _, chunk := range chunks {
+		cost := chunk.tokens + 2 // "[n] " prefix and separator
+		citation, cited := citations[chunk.hit]
+		if !cited {
+			citation = len(citations) + 1
+			cost += tokens.Count(formatSource(citation, hits[chunk.hit]))
+		}
+
+		if used+cost > maxTokens {
+			continue
+		}
+
+		used += cost
+		citations[chunk.hit] = citation
+		selected = append(selected, chunk)
+	}
+
+	if len(selected) == 0 {
+		return ""
+	}
+
+	// Present chunks grouped by source in citation order, each in document order
+	sort.SliceStable(selected, func(a, b int) bool {
+		ca, cb := citations[selected[a].hit], citations[selected[b].hit]
+		if ca != cb {
+			return ca < cb
+		}
+		return selected[a].index < selected[b].index
+	})
+
+	var b strings.Builder
+	for _, chunk := range selected {
+		fmt.Fprintf(&b, "[%d] %s\n\n", citations[chunk.hit], chunk.text)
+	}
+
+	order := make([]int, 0, len(citations))
+	for hit := range citations {
+		order = append(order, hit)
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return citations[order[a]] < citations[order[b]]
+	})
+
+	b.WriteString("Sources:\n")
+	for _, hit := range order {
+		b.WriteString(formatSource(citations[hit], hits[hit]))
+	}
+
+	return b.String()
+}
+
+// formatSource renders one citation line
+func formatSource(citation int, hit MemoryHit) string {
+	detail := hit.Type
+	if path, ok := hit.Metadata["filepath"].(string); ok && path != "" {
+		detail += ", " + path
+	}
+	if !hit.StoredAt.IsZero() {
+		detail += ", " + hit.StoredAt.Format("2006-01-02")
+	}
+	return fmt.Sprintf("[%d] %s (%s)\n", citation, hit.ID, detail)
+}
+
+// splitChunks splits content on blank lines into chunks of about chunkTokens,
+// hard-splitting paragraphs that are larger on their own
+func splitChunks(content string, chunkTokens int, tokens *TokenEstimator) []string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil
+	}
+	if chunkTokens <= 0 || tokens.Count(content) <= chunkTokens {
+		return []string{content}
+	}
+
+	chunks := make([]string, 0)
+	var current strings.Builder
+	currentTokens := 0
+
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, strings.TrimSpace(current.String()))
+			current.Reset()
+			currentTokens = 0
+		}
+	}
+
+	for _, paragraph := range strings.Split(content, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		n := tokens.Count(paragraph)
+		if n > chunkTokens {
+			flush()
+			chunks = append(chunks, splitWords(paragraph, chunkTokens, tokens)...)
+			continue
+		}
+
+		if currentTokens+n > chunkTokens {
+			flush()
+		}
+		current.WriteString(paragraph)
+		current.WriteString("\n\n")
+		currentTokens += n
+	}
+	flush()
+
+	return chunks
+}
+
+// splitWords splits an oversized paragraph at word boundaries
+func splitWords(paragraph string, chunkTokens int, tokens *TokenEstimator) []string {
+	chunks := make([]string, 0)
+	words := make([]string, 0)
+	count := 0
+
+	for _, word := range strings.Fields(paragraph) {
+		n := tokens.Count(word)
+		if count+n > chunkTokens && len(words) > 0 {
+			chunks = append(chunks, strings.Join(words, " "))
+			words = words[:0]
+			count = 0
+		}
+		words = append(words, word)
+		count += n
+	}
+	if len(words) > 0 {
+		chunks = append(chunks, strings.Join(words, " "))
+	}
+
+	return chunks
+}
+
+// truncateToTokens cuts text at a word boundary so it fits maxTokens
+func truncateToTokens(text string, maxTokens int, tokens *TokenEstimator) string {
+	if maxTokens <= 0 {
+		maxTokens = defaultContextTokens
+	}
+	if tokens.Count(text) <= maxTokens {
+		return text
+	}
+
+	parts := splitWords(text, maxTokens, tokens)
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[0]
+}
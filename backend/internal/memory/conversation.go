@@ -0,0 +1,422 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// conversationBucket holds one JSON-encoded Conversation per session ID
+var conversationBucket = []byte("conversations")
+
+// ErrConversationNotFound is returned for sessions with no stored
+// conversation, or whose conversation belongs to another owner
+var ErrConversationNotFound = errors.New("conversation not found")
+
+const (
+	// maxConversationToolEvents is how many tool events a conversation keeps
+	maxConversationToolEvents = 200
+	// conversationTitleLength is how much of the first message titles a conversation
+	conversationTitleLength = 80
+)
+
+// Conversation is a chat session's recent turns plus a rolling summary of
+// older ones. Only its owner, the principal that started it, can see or
+// continue it; conversations started with authentication off have none.
+type Conversation struct {
+	SessionID  string               `json:"session_id"`
+	Owner      string               `json:"owner,omitempty"`
+	Title      string               `json:"title,omitempty"` // the start of the first user message
+	Summary    string               `json:"summary,omitempty"`
+	Summarized int                  `json:"summarized"` // messages folded into Summary
+	Messages   []ollama.ChatMessage `json:"messages"`
+	ToolEvents []ToolEvent          `json:"tool_events,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+// ToolEvent is a tool the model called during a conversation
+type ToolEvent struct {
+	ID        string                 `json:"id"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Success   bool                   `json:"success"`
+	Result    interface{}            `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// ConversationInfo describes a stored conversation without its messages
+type ConversationInfo struct {
+	SessionID  string    `json:"session_id"`
+	Title      string    `json:"title,omitempty"`
+	Messages   int       `json:"messages"` // including those folded into the summary
+	ToolEvents int       `json:"tool_events"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ConversationStore keeps per-session chat history in BoltDB. Only the last
+// window messages are replayed verbatim; older turns are condensed by the LLM
+// into a rolling summary.
+type ConversationStore struct {
+	db     *bolt.DB
+	llm    llm.Provider
+	window int
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // per-session, so one slow summary doesn't block other chats
+}
+
+// NewConversationStore opens (or creates) the conversation database at path
+func NewConversationStore(path string, llm llm.Provider, window int) (*ConversationStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create conversation directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open conversation database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(conversationBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create conversation bucket: %w", err)
+	}
+
+	// Keep at least one full exchange in the window
+	if window < 2 {
+		window = 2
+	}
+
+	return &ConversationStore{
+		db:     db,
+		llm:    llm,
+		window: window,
+		locks:  make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// NewConversationStoreFromEnv opens the store at CONVERSATION_STORE_PATH with a
+// window of CONVERSATION_WINDOW_MESSAGES
+func NewConversationStoreFromEnv(llm llm.Provider) (*ConversationStore, error) {
+	return NewConversationStore(
+		getEnv("CONVERSATION_STORE_PATH", "./data/conversations.db"),
+		llm,
+		getEnvInt("CONVERSATION_WINDOW_MESSAGES", 20),
+	)
+}
+
+// sessionLock returns the mutex serializing updates to one session
+func (s *ConversationStore) sessionLock(sessionID string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.locks[sessionID]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[sessionID] = lock
+	}
+	return lock
+}
+
+// Get returns owner's conversation in a session, or an empty one if the
+// session has none yet
+func (s *ConversationStore) Get(sessionID, owner string) (*Conversation, error) {
+	conv, err := s.load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if conv == nil {
+		now := time.Now()
+		conv = &Conversation{
+			SessionID: sessionID,
+			Owner:     owner,
+			Messages:  []ollama.ChatMessage{},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+	if conv.Owner != owner {
+		return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, sessionID)
+	}
+
+	return conv, nil
+}
+
+// Find returns owner's stored conversation in a session
+func (s *ConversationStore) Find(sessionID, owner string) (*Conversation, error) {
+	conv, err := s.load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil || conv.Owner != owner {
+		return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, sessionID)
+	}
+	return conv, nil
+}
+
+// load reads a session's stored conversation, or nil when it has none
+func (s *ConversationStore) load(sessionID string) (*Conversation, error) {
+	var conv *Conversation
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(conversationBucket).Get([]byte(sessionID))
+		if data == nil {
+			return nil
+		}
+		conv = &Conversation{}
+		return json.Unmarshal(data, conv)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation %s: %w", sessionID, err)
+	}
+	return conv, nil
+}
+
+// History returns the messages to send ahead of owner's new user turn: the
+// rolling summary as a system message, then the recent window
+func (s *ConversationStore) History(sessionID, owner string) ([]ollama.ChatMessage, error) {
+	conv, err := s.Get(sessionID, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]ollama.ChatMessage, 0, len(conv.Messages)+1)
+	if conv.Summary != "" {
+		history = append(history, ollama.ChatMessage{
+			Role:    "system",
+			Content: "Summary of the earlier conversation:\n" + conv.Summary,
+		})
+	}
+	history = append(history, conv.Messages...)
+
+	return history, nil
+}
+
+// Append records owner's new turns and, once the window overflows, folds the
+// oldest messages into the rolling summary. If summarization fails the
+// overflow is kept and retried on the next append, up to twice the window.
+func (s *ConversationStore) Append(sessionID, owner string, messages ...ollama.ChatMessage) error {
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	conv, err := s.Get(sessionID, owner)
+	if err != nil {
+		return err
+	}
+
+	conv.Messages = append(conv.Messages, messages...)
+	conv.UpdatedAt = time.Now()
+	if conv.Title == "" {
+		for _, msg := range messages {
+			if msg.Role == "user" {
+				conv.Title = conversationTitle(msg.Content)
+				break
+			}
+		}
+	}
+
+	if overflow := len(conv.Messages) - s.window; overflow > 0 {
+		// Evict whole exchanges so the window never starts with a reply
+		// or a tool result
+		for overflow < len(conv.Messages) && conv.Messages[overflow].Role != "user" {
+			overflow++
+		}
+		evicted := conv.Messages[:overflow]
+
+		summary, err := s.summarize(conv.Summary, evicted)
+		switch {
+		case err == nil:
+			conv.Summary = summary
+			conv.Summarized += len(evicted)
+			conv.Messages = append([]ollama.ChatMessage{}, conv.Messages[overflow:]...)
+		case len(conv.Messages) > 2*s.window:
+			slog.Warn("dropping unsummarized messages from conversation", "session_id", sessionID, "messages", len(evicted), "error", err)
+			conv.Messages = append([]ollama.ChatMessage{}, conv.Messages[overflow:]...)
+		default:
+			slog.Warn("failed to summarize conversation, will retry", "session_id", sessionID, "error", err)
+		}
+	}
+
+	return s.save(conv)
+}
+
+// RecordToolEvent adds a tool call to owner's conversation in a session,
+// keeping the last maxConversationToolEvents
+func (s *ConversationStore) RecordToolEvent(sessionID, owner string, event ToolEvent) error {
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	conv, err := s.Get(sessionID, owner)
+	if err != nil {
+		return err
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	conv.ToolEvents = append(conv.ToolEvents, event)
+	if overflow := len(conv.ToolEvents) - maxConversationToolEvents; overflow > 0 {
+		conv.ToolEvents = append([]ToolEvent{}, conv.ToolEvents[overflow:]...)
+	}
+	conv.UpdatedAt = time.Now()
+
+	return s.save(conv)
+}
+
+// List describes owner's stored conversations, most recently updated first
+func (s *ConversationStore) List(owner string) ([]ConversationInfo, error) {
+	infos := make([]ConversationInfo, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(conversationBucket).ForEach(func(k, v []byte) error {
+			var conv Conversation
+			if err := json.Unmarshal(v, &conv); err != nil {
+				slog.Warn("skipping undecodable conversation", "session_id", string(k), "error", err)
+				return nil
+			}
+			if conv.Owner != owner {
+				return nil
+			}
+			infos = append(infos, ConversationInfo{
+				SessionID:  conv.SessionID,
+				Title:      conv.Title,
+				Messages:   conv.Summarized + len(conv.Messages),
+				ToolEvents: len(conv.ToolEvents),
+				CreatedAt:  conv.CreatedAt,
+				UpdatedAt:  conv.UpdatedAt,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].UpdatedAt.After(infos[j].UpdatedAt)
+	})
+	return infos, nil
+}
+
+// conversationTitle shortens a message to a title
+func conversationTitle(content string) string {
+	title := strings.Join(strings.Fields(content), " ")
+	if runes := []rune(title); len(runes) > conversationTitleLength {
+		title = string(runes[:conversationTitleLength]) + "…"
+	}
+	return title
+}
+
+// summarize merges evicted messages into the previous summary
+func (s *ConversationStore) summarize(previous string, evicted []ollama.ChatMessage) (string, error) {
+	if s.llm == nil {
+		return "", fmt.Errorf("no LLM configured")
+	}
+
+	var transcript strings.Builder
+	for _, msg := range evicted {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+
+	if previous == "" {
+		previous = "(none)"
+	}
+
+	prompt := fmt.Sprintf(`You maintain a running summary of a conversation between a user and an AI agent.
+
+Current summary:
+%s
+
+New messages:
+%s
+Rewrite the summary to include the new messages. Keep the user's goals, decisions, facts, names, file paths and open questions; drop pleasantries. Respond with only the summary, at most 200 words.`,
+		previous, transcript.String())
+
+	resp, err := s.llm.ChatCompletion(llm.WithPriority(context.Background(), llm.PriorityBackground), llm.Request{
+		Messages:    []ollama.ChatMessage{{Role: "user", Content: prompt}},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("failed to summarize conversation: empty response")
+	}
+
+	summary := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if summary == "" {
+		return "", fmt.Errorf("failed to summarize conversation: empty summary")
+	}
+
+	return summary, nil
+}
+
+// save writes a conversation back to the database
+func (s *ConversationStore) save(conv *Conversation) error {
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation: %w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(conversationBucket).Put([]byte(conv.SessionID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store conversation %s: %w", conv.SessionID, err)
+	}
+	return nil
+}
+
+// Delete forgets owner's history in a session
+func (s *ConversationStore) Delete(sessionID, owner string) error {
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(conversationBucket)
+		data := bucket.Get([]byte(sessionID))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrConversationNotFound, sessionID)
+		}
+		var conv Conversation
+		if err := json.Unmarshal(data, &conv); err != nil {
+			return err
+		}
+		if conv.Owner != owner {
+			return fmt.Errorf("%w: %s", ErrConversationNotFound, sessionID)
+		}
+		return bucket.Delete([]byte(sessionID))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// Close closes the conversation database
+func (s *ConversationStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"agent-workspace/backend/pkg/ollama"
+)
+
+func TestConversationsAreHiddenFromOtherPrincipals(t *testing.T) {
+	store, err := NewConversationStore(filepath.Join(t.TempDir(), "conversations.db"), nil, 10)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	turn := ollama.ChatMessage{Role: "user", Content: "hello"}
+	if err := store.Append("alice-chat", "alice", turn); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	if _, err := store.Find("alice-chat", "alice"); err != nil {
+		t.Errorf("owner failed to find own conversation: %v", err)
+	}
+	if _, err := store.Find("alice-chat", "bob"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Find by another principal returned %v, want ErrConversationNotFound", err)
+	}
+	if _, err := store.Get("alice-chat", "bob"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Get by another principal returned %v, want ErrConversationNotFound", err)
+	}
+	if _, err := store.History("alice-chat", "bob"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("History by another principal returned %v, want ErrConversationNotFound", err)
+	}
+	if err := store.Append("alice-chat", "bob", turn); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Append by another principal returned %v, want ErrConversationNotFound", err)
+	}
+	if err := store.RecordToolEvent("alice-chat", "bob", ToolEvent{}); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("RecordToolEvent by another principal returned %v, want ErrConversationNotFound", err)
+	}
+	// Nor is a conversation started with authentication off anyone's
+	if _, err := store.Find("alice-chat", ""); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Find without a principal returned %v, want ErrConversationNotFound", err)
+	}
+
+	sessions, err := store.List("bob")
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("another principal listed %d conversations, want none", len(sessions))
+	}
+	sessions, err = store.List("alice")
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "alice-chat" {
+		t.Errorf("owner listed %+v, want alice-chat", sessions)
+	}
+
+	if err := store.Delete("alice-chat", "bob"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Delete by another principal returned %v, want ErrConversationNotFound", err)
+	}
+	conv, err := store.Find("alice-chat", "alice")
+	if err != nil {
+		t.Fatalf("conversation gone after another principal's delete: %v", err)
+	}
+	if len(conv.Messages) != 1 {
+		t.Errorf("conversation has %d messages, want 1", len(conv.Messages))
+	}
+	if err := store.Delete("alice-chat", "alice"); err != nil {
+		t.Errorf("owner failed to delete own conversation: %v", err)
+	}
+}
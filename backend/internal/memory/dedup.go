@@ -0,0 +1,501 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MergePolicy decides what Store does when content matches an existing document
+type MergePolicy string
+
+const (
+	// MergeSkip keeps the existing document and drops the new content
+	MergeSkip MergePolicy = "skip"
+	// MergeReplace inserts the new content and makes it the only tracked version
+	MergeReplace MergePolicy = "replace"
+	// MergeAppendVersion inserts the new content as the next version of the document
+	MergeAppendVersion MergePolicy = "append_version"
+)
+
+// documentBucket holds one JSON-encoded documentRecord per document key of the
+// default workspace; other workspaces use "documents/<name>"
+var documentBucket = []byte("documents")
+
+// StoreResult describes what Upsert did with a piece of content
+type StoreResult struct {
+	Action      string  `json:"action"` // "inserted", "skipped", "replaced", "versioned"
+	DocumentID  string  `json:"document_id"`
+	Version     int     `json:"version"`
+	DuplicateOf string  `json:"duplicate_of,omitempty"`
+	Similarity  float64 `json:"similarity,omitempty"`
+}
+
+// documentVersion is one stored revision of a document
+type documentVersion struct {
+	Version  int       `json:"version"`
+	Hash     string    `json:"hash"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// documentRecord tracks the current content, hash and metadata of a stored document
+type documentRecord struct {
+	Key       string                 `json:"key"`
+	Type      string                 `json:"type"`
+	Hash      string                 `json:"hash"`
+	Version   int                    `json:"version"`
+	Content   string                 `json:"content"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Embedding []float64              `json:"embedding,omitempty"` // legacy; vectors now live in the VectorStore
+	Versions  []documentVersion      `json:"versions"`
+	StoredAt  time.Time              `json:"stored_at"`
+
+	// Usage signals for importance scoring
+	AccessCount  int       `json:"access_count,omitempty"`
+	LastAccessed time.Time `json:"last_accessed,omitempty"`
+	Reward       float64   `json:"reward,omitempty"`
+	Feedback     int       `json:"feedback,omitempty"`
+}
+
+// DedupConfig configures duplicate detection for long-term inserts
+type DedupConfig struct {
+	Policy              MergePolicy
+	SimilarityThreshold float64 // cosine similarity at or above which content is a near-duplicate
+}
+
+// DedupConfigFromEnv reads MEMORY_MERGE_POLICY and MEMORY_DEDUP_THRESHOLD
+func DedupConfigFromEnv() DedupConfig {
+	threshold, err := strconv.ParseFloat(getEnv("MEMORY_DEDUP_THRESHOLD", "0.95"), 64)
+	if err != nil || threshold <= 0 {
+		threshold = 0.95
+	}
+
+	policy, err := ParseMergePolicy(getEnv("MEMORY_MERGE_POLICY", string(MergeSkip)))
+	if err != nil {
+		policy = MergeSkip
+	}
+
+	return DedupConfig{
+		Policy:              policy,
+		SimilarityThreshold: threshold,
+	}
+}
+
+// ParseMergePolicy validates a merge policy name
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	switch policy := MergePolicy(name); policy {
+	case MergeSkip, MergeReplace, MergeAppendVersion:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown merge policy %q", name)
+	}
+}
+
+// documentIndex persists document records in BoltDB and caches them for
+// near-duplicate scans
+type documentIndex struct {
+	db      *bolt.DB
+	bucket  []byte
+	shared  bool // a workspace's view of another index's database
+	records map[string]*documentRecord
+	dirty   map[string]bool // records with unsaved access or reward changes
+	mu      sync.RWMutex
+
+	// Set when the database is opened
+	schema    SchemaVersion
+	integrity IntegrityReport
+}
+
+// openDocumentIndex opens the index at DEDUP_INDEX_PATH, migrates and checks
+// it, and loads every record
+func openDocumentIndex() (*documentIndex, error) {
+	path := getEnv("DEDUP_INDEX_PATH", "./data/documents.db")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create document index directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document index: %w", err)
+	}
+
+	schema, err := migrateBolt(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	integrity, err := checkDocumentIntegrity(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if integrity.Problems > 0 {
+		slog.Warn("document index integrity check found problems",
+			"problems", integrity.Problems, "records", integrity.Checked, "example", integrity.Details[0])
+	}
+
+	index, err := loadDocumentIndex(db, documentBucket)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	index.schema = schema
+	index.integrity = integrity
+
+	return index, nil
+}
+
+// workspace opens the index of a non-default workspace, kept in its own
+// bucket of the same database
+func (i *documentIndex) workspace(name string) (*documentIndex, error) {
+	index, err := loadDocumentIndex(i.db, []byte(workspaceBucketPrefix+name))
+	if err != nil {
+		return nil, err
+	}
+	index.shared = true
+	return index, nil
+}
+
+// loadDocumentIndex creates bucket if missing and loads every record in it,
+// skipping records that fail to decode
+func loadDocumentIndex(db *bolt.DB, bucket []byte) (*documentIndex, error) {
+	index := &documentIndex{
+		db:      db,
+		bucket:  bucket,
+		records: make(map[string]*documentRecord),
+		dirty:   make(map[string]bool),
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var record documentRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				// Reported by the integrity check rather than failing startup
+				slog.Warn("skipping undecodable document", "document_id", string(k), "error", err)
+				return nil
+			}
+			index.records[record.Key] = &record
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load document index: %w", err)
+	}
+
+	return index, nil
+}
+
+// byHash returns the record whose current content has the given hash
+func (i *documentIndex) byHash(hash string) *documentRecord {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for _, record := range i.records {
+		if record.Hash == hash {
+			return record
+		}
+	}
+	return nil
+}
+
+// get returns the record stored under key
+func (i *documentIndex) get(key string) *documentRecord {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.records[key]
+}
+
+// put writes a record to disk and the cache
+func (i *documentIndex) put(record *documentRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode document %s: %w", record.Key, err)
+	}
+
+	err = i.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(i.bucket).Put([]byte(record.Key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store document %s: %w", record.Key, err)
+	}
+
+	i.mu.Lock()
+	i.records[record.Key] = record
+	delete(i.dirty, record.Key)
+	i.mu.Unlock()
+
+	return nil
+}
+
+// migrateEmbeddings moves embeddings kept in index records by earlier
+// versions into the vector store
+func (i *documentIndex) migrateEmbeddings(ctx context.Context, vectors VectorStore) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for key, record := range i.records {
+		if len(record.Embedding) == 0 {
+			continue
+		}
+		if err := vectors.Upsert(ctx, key, record.Embedding, record.vectorMetadata()); err != nil {
+			return fmt.Errorf("failed to migrate embedding for %s: %w", key, err)
+		}
+		record.Embedding = nil
+		i.dirty[key] = true
+	}
+
+	return nil
+}
+
+// Close saves pending access counts and closes the index database, which a
+// workspace index leaves open for the index it was opened from
+func (i *documentIndex) Close() error {
+	if i.shared {
+		return i.flush()
+	}
+	if err := i.flush(); err != nil {
+		i.db.Close()
+		return err
+	}
+	return i.db.Close()
+}
+
+// contentHash hashes content with surrounding whitespace trimmed
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// documentKey identifies the logical document content belongs to. An explicit
+// doc_id wins, code is keyed by file path, and anything else by its hash.
+func documentKey(docType, hash string, metadata map[string]interface{}) string {
+	if id, ok := metadata["doc_id"].(string); ok && id != "" {
+		return id
+	}
+	if path, ok := metadata["filepath"].(string); ok && path != "" && docType == "code" {
+		return "code:" + path
+	}
+	return docType + ":" + hash[:16]
+}
+
+// Upsert stores content unless it duplicates an existing document. Exact
+// duplicates (same content hash) are always skipped; content that shares a
+// document key or is a near-duplicate by embedding is merged according to the
+// policy in metadata["merge_policy"], falling back to the configured default.
+// LightRAG cannot delete, so replaced content stays in the graph; the index
+// only stops tracking it as the document's current version.
+func (m *LongTermMemory) Upsert(ctx context.Context, content string, metadata map[string]interface{}) (*StoreResult, error) {
+	ctx, finish := m.beginAudit(ctx, "store", "upsert", content)
+	result, err := m.upsert(ctx, content, metadata)
+	if result != nil {
+		written := 1
+		if result.Action == "skipped" {
+			written = 0
+		}
+		finish(written, result.DocumentID, err)
+	} else {
+		finish(0, "", err)
+	}
+	return result, err
+}
+
+func (m *LongTermMemory) upsert(ctx context.Context, content string, metadata map[string]interface{}) (*StoreResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.initialized {
+		return nil, ErrMemoryUnavailable
+	}
+
+	ws, err := m.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := m.dedup.Policy
+	if name, ok := metadata["merge_policy"].(string); ok && name != "" {
+		parsed, err := ParseMergePolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		policy = parsed
+	}
+
+	docType, _ := metadata["type"].(string)
+	hash := contentHash(content)
+
+	if existing := ws.documents.byHash(hash); existing != nil {
+		return &StoreResult{
+			Action:      "skipped",
+			DocumentID:  existing.Key,
+			Version:     existing.Version,
+			DuplicateOf: existing.Key,
+			Similarity:  1,
+		}, nil
+	}
+
+	// Near-duplicate detection is best effort; LightRAG will surface an
+	// embedding outage on insert anyway
+	embedding, err := m.embeddings.Generate(ctx, content)
+	if err != nil {
+		embedding = nil
+	}
+
+	key := documentKey(docType, hash, metadata)
+	existing := ws.documents.get(key)
+	similarity := 0.0
+	if existing == nil && embedding != nil {
+		existing, similarity, err = m.nearestDocument(ctx, ws, docType, embedding)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if existing == nil {
+		if err := ws.rag.Insert(ctx, content); err != nil {
+			return nil, fmt.Errorf("failed to insert document: %w", err)
+		}
+
+		now := time.Now()
+		record := &documentRecord{
+			Key:      key,
+			Type:     docType,
+			Hash:     hash,
+			Version:  1,
+			Content:  content,
+			Metadata: recordMetadata(metadata),
+			Versions: []documentVersion{{Version: 1, Hash: hash, StoredAt: now}},
+			StoredAt: now,
+		}
+		if err := m.saveDocument(ctx, ws, record, embedding); err != nil {
+			return nil, err
+		}
+
+		return &StoreResult{Action: "inserted", DocumentID: key, Version: 1}, nil
+	}
+
+	result := &StoreResult{
+		DocumentID:  existing.Key,
+		Version:     existing.Version,
+		DuplicateOf: existing.Key,
+		Similarity:  similarity,
+	}
+
+	if policy == MergeSkip {
+		result.Action = "skipped"
+		return result, nil
+	}
+
+	version := existing.Version + 1
+	insert := content
+	if policy == MergeAppendVersion {
+		// Label the revision so graph entities extracted from it can be told apart
+		insert = fmt.Sprintf("Document %s, version %d:\n%s", existing.Key, version, content)
+	}
+
+	if err := ws.rag.Insert(ctx, insert); err != nil {
+		return nil, fmt.Errorf("failed to insert document: %w", err)
+	}
+
+	now := time.Now()
+	record := &documentRecord{
+		Key:      existing.Key,
+		Type:     existing.Type,
+		Hash:     hash,
+		Version:  version,
+		Content:  content,
+		Metadata: recordMetadata(metadata),
+		StoredAt: now,
+
+		// A new revision keeps the usage history of the document it updates
+		AccessCount:  existing.AccessCount,
+		LastAccessed: existing.LastAccessed,
+		Reward:       existing.Reward,
+		Feedback:     existing.Feedback,
+	}
+
+	current := documentVersion{Version: version, Hash: hash, StoredAt: now}
+	if policy == MergeAppendVersion {
+		record.Versions = append(append([]documentVersion{}, existing.Versions...), current)
+		result.Action = "versioned"
+	} else {
+		record.Versions = []documentVersion{current}
+		result.Action = "replaced"
+	}
+
+	if err := m.saveDocument(ctx, ws, record, embedding); err != nil {
+		return nil, err
+	}
+
+	result.Version = version
+	return result, nil
+}
+
+// nearestDocument returns the most similar document of the same type at or
+// above the near-duplicate threshold
+func (m *LongTermMemory) nearestDocument(ctx context.Context, ws *workspaceStores, docType string, embedding []float64) (*documentRecord, float64, error) {
+	matches, err := ws.vectors.Query(ctx, embedding, 1, map[string]string{"type": docType})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(matches) == 0 || matches[0].Score < m.dedup.SimilarityThreshold {
+		return nil, 0, nil
+	}
+	return ws.documents.get(matches[0].ID), matches[0].Score, nil
+}
+
+// saveDocument mirrors the record into the graph and vector store, then
+// commits it to the index
+func (m *LongTermMemory) saveDocument(ctx context.Context, ws *workspaceStores, record *documentRecord, embedding []float64) error {
+	if err := m.writeDocumentNode(ctx, ws, record); err != nil {
+		return fmt.Errorf("failed to index document %s in graph: %w", record.Key, err)
+	}
+
+	if embedding != nil {
+		if err := ws.vectors.Upsert(ctx, record.Key, embedding, record.vectorMetadata()); err != nil {
+			return fmt.Errorf("failed to index document %s vector: %w", record.Key, err)
+		}
+	}
+
+	return ws.documents.put(record)
+}
+
+// vectorMetadata returns the exact-match fields pushed down to the vector store
+func (r *documentRecord) vectorMetadata() map[string]string {
+	metadata := map[string]string{"type": r.Type}
+	if taskID, ok := r.Metadata["task_id"].(string); ok && taskID != "" {
+		metadata["task_id"] = taskID
+	}
+	return metadata
+}
+
+// recordMetadata copies metadata without per-call options such as merge_policy
+func recordMetadata(metadata map[string]interface{}) map[string]interface{} {
+	stored := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		if k == "merge_policy" {
+			continue
+		}
+		stored[k] = v
+	}
+	return stored
+}
@@ -3,38 +3,202 @@ package memory
 import (
 	"context"
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
-	"agent-workspace/backend/pkg/ollama"
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
 )
 
-// EmbeddingGenerator generates embeddings using Ollama
+// EmbeddingConfig configures embedding generation
+type EmbeddingConfig struct {
+	Dimension   int           // Expected vector size, e.g. 768 for nomic-embed-text
+	BatchSize   int           // Texts sent per request
+	Concurrency int           // Batches requested at once
+	MaxRetries  int           // Retries per batch on failure
+	RetryDelay  time.Duration // Initial backoff, doubled on each retry
+}
+
+// DefaultEmbeddingConfig returns the embedding configuration from the environment
+func DefaultEmbeddingConfig() *EmbeddingConfig {
+	return &EmbeddingConfig{
+		Dimension:   getEnvInt("EMBEDDING_DIMENSION", 768),
+		BatchSize:   getEnvInt("EMBEDDING_BATCH_SIZE", 16),
+		Concurrency: getEnvInt("EMBEDDING_CONCURRENCY", 4),
+		MaxRetries:  getEnvInt("EMBEDDING_MAX_RETRIES", 3),
+		RetryDelay:  500 * time.Millisecond,
+	}
+}
+
+// EmbeddingGenerator generates embeddings with the embedder's provider,
+// Ollama unless LLM_EMBEDDER_PROVIDER names another
 type EmbeddingGenerator struct {
-	client *ollama.Client
+	provider llm.Provider
+	config   *EmbeddingConfig
 }
 
 // NewEmbeddingGenerator creates a new embedding generator
 func NewEmbeddingGenerator() *EmbeddingGenerator {
+	return NewEmbeddingGeneratorWithConfig(DefaultEmbeddingConfig())
+}
+
+// NewEmbeddingGeneratorWithConfig creates an embedding generator with explicit settings
+func NewEmbeddingGeneratorWithConfig(config *EmbeddingConfig) *EmbeddingGenerator {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+
 	return &EmbeddingGenerator{
-		client: ollama.NewClient(),
+		provider: llm.ProviderFor(llm.RoleEmbedder),
+		config:   config,
+	}
+}
+
+// Dimension returns the configured embedding dimension
+func (g *EmbeddingGenerator) Dimension() int {
+	return g.config.Dimension
+}
+
+// Verify checks that the embedding model is reachable and returns vectors of the configured dimension
+func (g *EmbeddingGenerator) Verify(ctx context.Context) error {
+	embedding, err := g.Generate(ctx, "embedding model health check")
+	if err != nil {
+		return fmt.Errorf("embedding model %s unavailable: %w", g.provider.EmbedModel(), err)
 	}
+
+	logging.FromContext(ctx).Info("embedding model ready", "model", g.provider.EmbedModel(), "dimension", len(embedding))
+	return nil
 }
 
 // Generate generates an embedding for text
 func (g *EmbeddingGenerator) Generate(ctx context.Context, text string) ([]float64, error) {
-	return g.client.CreateEmbedding(text)
+	embeddings, err := g.GenerateBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings[0], nil
 }
 
-// GenerateBatch generates embeddings for multiple texts
+// GenerateBatch generates embeddings for multiple texts, in the texts'
+// order. Batches are requested a few at a time, each with retry; the first
+// to fail cancels the rest.
 func (g *EmbeddingGenerator) GenerateBatch(ctx context.Context, texts []string) ([][]float64, error) {
-	return g.client.CreateEmbeddings(texts)
+	embeddings := make([][]float64, len(texts))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, g.config.Concurrency)
+
+	for start := 0; start < len(texts); start += g.config.BatchSize {
+		end := min(start+g.config.BatchSize, len(texts))
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			batch, err := g.generateWithRetry(ctx, texts[start:end])
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("failed to embed texts %d-%d: %w", start, end-1, err)
+					cancel()
+				})
+				return
+			}
+			copy(embeddings[start:end], batch)
+		}(start, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("embedding cancelled: %w", err)
+	}
+	return embeddings, nil
+}
+
+// generateWithRetry embeds a single batch, backing off between attempts
+func (g *EmbeddingGenerator) generateWithRetry(ctx context.Context, texts []string) ([][]float64, error) {
+	delay := g.config.RetryDelay
+	var lastErr error
+
+	for attempt := 0; attempt <= g.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		embeddings, err := g.provider.Embed(ctx, texts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if len(embeddings) != len(texts) {
+			return nil, fmt.Errorf("got %d embeddings for %d texts", len(embeddings), len(texts))
+		}
+
+		if err := g.checkDimensions(embeddings); err != nil {
+			// A dimension mismatch is a configuration error; retrying won't help
+			return nil, err
+		}
+
+		return embeddings, nil
+	}
+
+	return nil, fmt.Errorf("after %d attempts: %w", g.config.MaxRetries+1, lastErr)
+}
+
+// checkDimensions validates embeddings against the configured dimension
+func (g *EmbeddingGenerator) checkDimensions(embeddings [][]float64) error {
+	if g.config.Dimension <= 0 {
+		return nil
+	}
+
+	for _, embedding := range embeddings {
+		if len(embedding) != g.config.Dimension {
+			return fmt.Errorf("embedding dimension mismatch: model %s returned %d, expected %d (set EMBEDDING_DIMENSION)",
+				g.provider.EmbedModel(), len(embedding), g.config.Dimension)
+		}
+	}
+
+	return nil
 }
 
 // CreateEmbeddingFunction creates an embedding function for LightRAG
 func CreateEmbeddingFunction() func(context.Context, []string) ([][]float64, error) {
-	generator := NewEmbeddingGenerator()
-	
+	return NewEmbeddingGenerator().EmbeddingFunc()
+}
+
+// EmbeddingFunc adapts the generator to the LightRAG embedding function signature
+func (g *EmbeddingGenerator) EmbeddingFunc() func(context.Context, []string) ([][]float64, error) {
 	return func(ctx context.Context, texts []string) ([][]float64, error) {
-		return generator.GenerateBatch(ctx, texts)
+		return g.GenerateBatch(ctx, texts)
 	}
 }
 
@@ -44,33 +208,28 @@ func CosineSimilarity(a, b []float64) (float64, error) {
 		return 0, fmt.Errorf("embeddings must have same length")
 	}
 
-	var dotProduct, normA, normB float64
-
-	for i := range a {
-		dotProduct += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
-	}
-
+	normA, normB := dot(a, a), dot(b, b)
 	if normA == 0 || normB == 0 {
 		return 0, nil
 	}
 
-	return dotProduct / (sqrt(normA) * sqrt(normB)), nil
+	return dot(a, b) / math.Sqrt(normA*normB), nil
 }
 
-// FindMostSimilar finds the most similar embedding from a list
+// FindMostSimilar finds the most similar embedding from a list, skipping
+// candidates whose length differs from the query
 func FindMostSimilar(query []float64, candidates [][]float64) (int, float64, error) {
 	if len(candidates) == 0 {
 		return -1, 0, fmt.Errorf("no candidates provided")
 	}
 
+	scores := BatchCosineSimilarity(query, candidates, nil)
+
 	maxSimilarity := -1.0
 	maxIndex := -1
 
-	for i, candidate := range candidates {
-		similarity, err := CosineSimilarity(query, candidate)
-		if err != nil {
+	for i, similarity := range scores {
+		if len(candidates[i]) != len(query) {
 			continue
 		}
 
@@ -86,19 +245,3 @@ func FindMostSimilar(query []float64, candidates [][]float64) (int, float64, err
 
 	return maxIndex, maxSimilarity, nil
 }
-
-// Helper function for square root
-func sqrt(x float64) float64 {
-	if x == 0 {
-		return 0
-	}
-
-	// Newton's method for square root
-	z := x
-	for i := 0; i < 10; i++ {
-		z -= (z*z - x) / (2 * z)
-	}
-
-	return z
-}
-
@@ -0,0 +1,368 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+
+	"agent-workspace/backend/pkg/logging"
+)
+
+// codeGraphSource marks hits from the code graph written by scripts/mirror_code_to_neo4j.go
+const codeGraphSource = "code_graph"
+
+// codeQueryStopwords are dropped from queries before symbol matching
+var codeQueryStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "how": true, "what": true, "does": true,
+	"this": true, "that": true, "from": true, "into": true, "where": true, "when": true, "code": true,
+}
+
+// FederatedConfig weighs the code graph against embedded documents in federated search
+type FederatedConfig struct {
+	CodeWeight     float64 // multiplier for normalized code graph scores
+	DocumentWeight float64 // multiplier for normalized vector scores
+	JoinBoost      float64 // added, scaled by the other side's score, when both sources point at the same file
+}
+
+// FederatedConfigFromEnv reads MEMORY_CODE_GRAPH_WEIGHT, MEMORY_DOCUMENT_WEIGHT and MEMORY_JOIN_BOOST
+func FederatedConfigFromEnv() FederatedConfig {
+	return FederatedConfig{
+		CodeWeight:     getEnvWeight("MEMORY_CODE_GRAPH_WEIGHT", 1.0),
+		DocumentWeight: getEnvWeight("MEMORY_DOCUMENT_WEIGHT", 1.0),
+		JoinBoost:      getEnvWeight("MEMORY_JOIN_BOOST", 0.25),
+	}
+}
+
+func getEnvWeight(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// FederatedSearch joins the code graph and long-term documents: symbols are
+// found by name and expanded through their files, documents by embedding.
+// Each source's scores are normalized to [0, 1] and weighted, and hits whose
+// file also appears in the other source are boosted. If one source fails the
+// other's hits are still returned.
+func (m *LongTermMemory) FederatedSearch(ctx context.Context, query string, filter MemoryFilter, topK int) ([]MemoryHit, error) {
+	ctx, finish := m.beginAudit(ctx, "query", "federated_search", query)
+	hits, err := m.federatedSearch(ctx, query, filter, topK)
+	finish(len(hits), "", err)
+	return hits, err
+}
+
+func (m *LongTermMemory) federatedSearch(ctx context.Context, query string, filter MemoryFilter, topK int) ([]MemoryHit, error) {
+	if topK <= 0 {
+		topK = 10
+	}
+	if strings.TrimSpace(query) == "" || !filter.admitsCodeGraph() {
+		return m.Search(ctx, query, filter, topK)
+	}
+
+	var (
+		wg                sync.WaitGroup
+		docHits, codeHits []MemoryHit
+		docErr, codeErr   error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		docHits, docErr = m.Search(ctx, query, filter, topK)
+	}()
+	go func() {
+		defer wg.Done()
+		codeHits, codeErr = m.SearchCodeGraph(ctx, query, topK)
+	}()
+	wg.Wait()
+
+	if docErr != nil && codeErr != nil {
+		return nil, docErr
+	}
+	if docErr != nil {
+		logging.FromContext(ctx).Warn("document search failed, using code graph only", "error", docErr)
+	}
+	if codeErr != nil {
+		logging.FromContext(ctx).Warn("code graph search failed, using documents only", "error", codeErr)
+	}
+
+	if filter.FilepathPrefix != "" {
+		kept := make([]MemoryHit, 0, len(codeHits))
+		for _, hit := range codeHits {
+			if path, _ := hit.Metadata["filepath"].(string); strings.HasPrefix(path, filter.FilepathPrefix) {
+				kept = append(kept, hit)
+			}
+		}
+		codeHits = kept
+	}
+
+	m.mu.RLock()
+	config := m.federated
+	m.mu.RUnlock()
+
+	return mergeFederated(docHits, codeHits, config, topK), nil
+}
+
+// mergeFederated scores both sources on one scale and returns the best topK
+func mergeFederated(docHits, codeHits []MemoryHit, config FederatedConfig, topK int) []MemoryHit {
+	normalizeScores(docHits)
+	normalizeScores(codeHits)
+
+	docFiles := hitFiles(docHits)
+	codeFiles := hitFiles(codeHits)
+
+	merged := make([]MemoryHit, 0, len(docHits)+len(codeHits))
+	for _, hit := range docHits {
+		hit.Source = "long_term"
+		hit.Score = config.DocumentWeight*hit.Score + config.JoinBoost*fileScore(codeFiles, hit)
+		merged = append(merged, hit)
+	}
+	for _, hit := range codeHits {
+		hit.Score = config.CodeWeight*hit.Score + config.JoinBoost*fileScore(docFiles, hit)
+		merged = append(merged, hit)
+	}
+
+	// Stable sort keeps documents ahead of code on ties, each in first-stage order
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+
+	if len(merged) > topK {
+		merged = merged[:topK]
+	}
+	return merged
+}
+
+// normalizeScores rescales scores so the best hit has 1
+func normalizeScores(hits []MemoryHit) {
+	best := 0.0
+	for _, hit := range hits {
+		best = max(best, hit.Score)
+	}
+	if best <= 0 {
+		return
+	}
+	for i := range hits {
+		hits[i].Score /= best
+	}
+}
+
+// hitFiles maps each file path cited by hits to its best score
+func hitFiles(hits []MemoryHit) map[string]float64 {
+	files := make(map[string]float64)
+	for _, hit := range hits {
+		if path := hitPath(hit); path != "" {
+			files[path] = max(files[path], hit.Score)
+		}
+	}
+	return files
+}
+
+// fileScore returns the best score in files for the hit's file. The code
+// mirror and the indexer may root paths differently, so a path matches
+// another that ends with it.
+func fileScore(files map[string]float64, hit MemoryHit) float64 {
+	path := hitPath(hit)
+	if path == "" {
+		return 0
+	}
+
+	best := 0.0
+	for other, score := range files {
+		if other == path || strings.HasSuffix(other, "/"+path) || strings.HasSuffix(path, "/"+other) {
+			best = max(best, score)
+		}
+	}
+	return best
+}
+
+func hitPath(hit MemoryHit) string {
+	path, _ := hit.Metadata["filepath"].(string)
+	if path == "" {
+		return ""
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+}
+
+// admitsCodeGraph reports whether code graph hits can satisfy the filter.
+// They are semantic "code" documents without task or timestamp metadata.
+func (f MemoryFilter) admitsCodeGraph() bool {
+	if f.TaskID != "" || !f.Since.IsZero() || !f.Until.IsZero() {
+		return false
+	}
+	types, restricted := f.types()
+	if !restricted {
+		return true
+	}
+	for _, t := range types {
+		if t == "code" {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchCodeGraph finds functions, types and files in the mirrored code graph
+// whose names, paths or documentation match the query, each with the other
+// symbols and imports of its file. Scores are in [0, 1].
+func (m *LongTermMemory) SearchCodeGraph(ctx context.Context, query string, limit int) ([]MemoryHit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return nil, ErrMemoryUnavailable
+	}
+
+	terms := codeQueryTerms(query)
+	if len(terms) == 0 {
+		return []MemoryHit{}, nil
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		records, err := tx.Run(ctx, `
+			MATCH (n)
+			WHERE n:Function OR n:Class OR n:File
+			WITH n, toLower(coalesce(n.name, '')) AS name, toLower(coalesce(n.path, '')) AS path,
+				toLower(coalesce(n.documentation, '')) AS doc
+			WITH n, reduce(s = 0.0, t IN $terms | s +
+				CASE
+					WHEN name = t THEN 1.0
+					WHEN name STARTS WITH t THEN 0.7
+					WHEN name CONTAINS t THEN 0.5
+					WHEN path CONTAINS t THEN 0.4
+					WHEN doc CONTAINS t THEN 0.25
+					ELSE 0.0
+				END) / size($terms) AS score
+			WHERE score > 0
+			ORDER BY score DESC
+			LIMIT $limit
+			OPTIONAL MATCH (owner:File)-[:DEFINES_FUNCTION|DEFINES_CLASS]->(n)
+			WITH n, score, CASE WHEN n:File THEN n ELSE owner END AS file
+			OPTIONAL MATCH (file)-[:DEFINES_FUNCTION|DEFINES_CLASS]->(related)
+			WHERE related <> n
+			WITH n, score, file, collect(DISTINCT related.name)[..12] AS related
+			OPTIONAL MATCH (file)-[:HAS_IMPORT]->(imp:Import)
+			RETURN CASE WHEN n:Function THEN 'function' WHEN n:Class THEN coalesce(n.type, 'type') ELSE 'file' END AS kind,
+				coalesce(n.signature, n.fully_qualified_name, n.path) AS key,
+				coalesce(n.name, '') AS name,
+				coalesce(n.documentation, '') AS documentation,
+				coalesce(file.path, '') AS filepath,
+				related,
+				collect(DISTINCT imp.module)[..12] AS imports,
+				score
+			ORDER BY score DESC`,
+			map[string]interface{}{
+				"terms": terms,
+				"limit": limit,
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		hits := make([]MemoryHit, 0, limit)
+		for records.Next(ctx) {
+			values := records.Record().Values
+			kind, _ := values[0].(string)
+			key, _ := values[1].(string)
+			name, _ := values[2].(string)
+			documentation, _ := values[3].(string)
+			path, _ := values[4].(string)
+			related := stringList(values[5])
+			imports := stringList(values[6])
+			score, _ := values[7].(float64)
+			if key == "" || kind == "" {
+				continue
+			}
+
+			hits = append(hits, MemoryHit{
+				ID:      "codegraph:" + kind + ":" + key,
+				Type:    "code",
+				Kind:    KindSemantic,
+				Source:  codeGraphSource,
+				Content: codeGraphContent(kind, key, documentation, path, related, imports),
+				Score:   score,
+				Metadata: map[string]interface{}{
+					"filepath":    path,
+					"symbol":      name,
+					"symbol_kind": kind,
+					"related":     related,
+					"imports":     imports,
+				},
+			})
+		}
+		return hits, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search code graph: %w", err)
+	}
+
+	return result.([]MemoryHit), nil
+}
+
+// codeQueryTerms extracts lowercase identifier-like terms from a query
+func codeQueryTerms(query string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	terms := make([]string, 0, len(fields))
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if len(field) < 3 || codeQueryStopwords[field] || seen[field] {
+			continue
+		}
+		seen[field] = true
+		terms = append(terms, field)
+	}
+	return terms
+}
+
+// codeGraphContent renders a code graph hit for context packing
+func codeGraphContent(kind, key, documentation, path string, related, imports []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", strings.ToUpper(kind[:1])+kind[1:], key)
+	if path != "" && kind != "file" {
+		fmt.Fprintf(&b, " in %s", path)
+	}
+	b.WriteString("\n")
+	if documentation = strings.TrimSpace(documentation); documentation != "" {
+		b.WriteString(documentation + "\n")
+	}
+	if len(related) > 0 {
+		label := "Same file"
+		if kind == "file" {
+			label = "Defines"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", label, strings.Join(related, ", "))
+	}
+	if len(imports) > 0 {
+		fmt.Fprintf(&b, "Imports: %s\n", strings.Join(imports, ", "))
+	}
+	return b.String()
+}
+
+// stringList converts a Neo4j list value to strings, skipping nulls
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,276 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const (
+	defaultGraphDepth = 1
+	maxGraphDepth     = 3
+	defaultGraphLimit = 50
+	maxGraphLimit     = 300
+	graphSeedLimit    = 5
+)
+
+// ragFieldSeparator joins merged descriptions on LightRAG entities
+const ragFieldSeparator = "<SEP>"
+
+// GraphNode is an entity in an exported knowledge graph neighborhood
+type GraphNode struct {
+	ID          string `json:"id"`
+	Label       string `json:"label"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Depth       int    `json:"depth"` // hops from the nearest seed
+	Seed        bool   `json:"seed,omitempty"`
+}
+
+// GraphEdge is a relationship between two exported nodes
+type GraphEdge struct {
+	ID          string  `json:"id"`
+	Source      string  `json:"source"`
+	Target      string  `json:"target"`
+	Label       string  `json:"label,omitempty"`
+	Weight      float64 `json:"weight"`
+	Description string  `json:"description,omitempty"`
+}
+
+// GraphNeighborhood is the subgraph around a node or query, shaped for visualization
+type GraphNeighborhood struct {
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Depth     int         `json:"depth"`
+	Limit     int         `json:"limit"`
+	Truncated bool        `json:"truncated"` // the node limit cut the expansion short
+}
+
+// Neighborhood exports the entities within depth hops of node, or of the
+// entities best matching query when node is empty. Both LightRAG entities and
+// entities extracted by consolidation are included; at most limit nodes are
+// returned, nearest first.
+func (m *LongTermMemory) Neighborhood(ctx context.Context, node, query string, depth, limit int) (*GraphNeighborhood, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return nil, ErrMemoryUnavailable
+	}
+
+	if depth <= 0 {
+		depth = defaultGraphDepth
+	}
+	if depth > maxGraphDepth {
+		depth = maxGraphDepth
+	}
+	if limit <= 0 {
+		limit = defaultGraphLimit
+	}
+	if limit > maxGraphLimit {
+		limit = maxGraphLimit
+	}
+
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		graph := &GraphNeighborhood{
+			Nodes: []GraphNode{},
+			Edges: []GraphEdge{},
+			Depth: depth,
+			Limit: limit,
+		}
+
+		seeds, err := graphSeeds(ctx, tx, node, query, min(limit, graphSeedLimit))
+		if err != nil {
+			return nil, err
+		}
+
+		exported := make(map[string]bool, limit)
+		for _, seed := range seeds {
+			seed.Seed = true
+			exported[seed.ID] = true
+			graph.Nodes = append(graph.Nodes, seed)
+		}
+
+		edgeIndex := make(map[string]bool)
+		frontier := make([]string, 0, len(seeds))
+		for _, seed := range seeds {
+			frontier = append(frontier, seed.ID)
+		}
+
+		// Expand one hop at a time so the node limit keeps the closest entities
+		for hop := 1; hop <= depth && len(frontier) > 0; hop++ {
+			records, err := tx.Run(ctx, `
+				MATCH (a)-[r:DIRECTED|RELATED]-(b)
+				WHERE (a:base OR a:Entity) AND coalesce(a.entity_id, a.name) IN $frontier
+					AND (b:base OR b:Entity)
+				WITH DISTINCT r, b
+				RETURN coalesce(startNode(r).entity_id, startNode(r).name) AS source,
+					coalesce(endNode(r).entity_id, endNode(r).name) AS target,
+					coalesce(r.keywords, r.type, type(r)) AS label,
+					coalesce(r.weight, 1.0) AS weight,
+					coalesce(r.description, '') AS description,
+					coalesce(b.entity_id, b.name) AS name,
+					coalesce(b.entity_type, b.type, '') AS type,
+					coalesce(b.description, '') AS node_description
+				ORDER BY weight DESC
+				LIMIT $edge_limit`,
+				map[string]interface{}{
+					"frontier":   frontier,
+					"edge_limit": limit * 4,
+				})
+			if err != nil {
+				return nil, err
+			}
+
+			next := make([]string, 0)
+			for records.Next(ctx) {
+				values := records.Record().Values
+				source, _ := values[0].(string)
+				target, _ := values[1].(string)
+				name, _ := values[5].(string)
+				if source == "" || target == "" || name == "" {
+					continue
+				}
+
+				// Edges are only kept when both ends are exported
+				if !exported[name] {
+					if len(graph.Nodes) >= limit {
+						graph.Truncated = true
+						continue
+					}
+					nodeType, _ := values[6].(string)
+					description, _ := values[7].(string)
+					exported[name] = true
+					graph.Nodes = append(graph.Nodes, GraphNode{
+						ID:          name,
+						Label:       name,
+						Type:        nodeType,
+						Description: graphDescription(description),
+						Depth:       hop,
+					})
+					next = append(next, name)
+				}
+
+				label, _ := values[2].(string)
+				edgeID := source + "->" + target + ":" + label
+				if edgeIndex[edgeID] {
+					continue
+				}
+				edgeIndex[edgeID] = true
+
+				description, _ := values[4].(string)
+				graph.Edges = append(graph.Edges, GraphEdge{
+					ID:          edgeID,
+					Source:      source,
+					Target:      target,
+					Label:       label,
+					Weight:      graphWeight(values[3]),
+					Description: graphDescription(description),
+				})
+			}
+			if err := records.Err(); err != nil {
+				return nil, err
+			}
+
+			frontier = next
+		}
+
+		return graph, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export graph: %w", err)
+	}
+
+	return result.(*GraphNeighborhood), nil
+}
+
+// graphSeeds finds the entities a neighborhood starts from: node by name, or
+// the entities whose names and descriptions best match the query terms
+func graphSeeds(ctx context.Context, tx neo4j.ManagedTransaction, node, query string, limit int) ([]GraphNode, error) {
+	var (
+		records neo4j.ResultWithContext
+		err     error
+	)
+
+	if node != "" {
+		records, err = tx.Run(ctx, `
+			MATCH (n)
+			WHERE (n:base AND n.entity_id = $node) OR (n:Entity AND n.name = $node)
+			RETURN coalesce(n.entity_id, n.name) AS name,
+				coalesce(n.entity_type, n.type, '') AS type,
+				coalesce(n.description, '') AS description
+			LIMIT 1`,
+			map[string]interface{}{"node": node})
+	} else {
+		terms := make([]string, 0)
+		for _, term := range strings.Fields(strings.ToLower(query)) {
+			if len(term) >= 3 {
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) == 0 {
+			return []GraphNode{}, nil
+		}
+
+		// Name matches count double so "auth" prefers the Auth entity over entities mentioning it
+		records, err = tx.Run(ctx, `
+			MATCH (n)
+			WHERE n:base OR n:Entity
+			WITH n, toLower(coalesce(n.entity_id, n.name)) AS name, toLower(coalesce(n.description, '')) AS description
+			WITH n, size([t IN $terms WHERE name CONTAINS t]) * 2 + size([t IN $terms WHERE description CONTAINS t]) AS score
+			WHERE score > 0
+			RETURN coalesce(n.entity_id, n.name) AS name,
+				coalesce(n.entity_type, n.type, '') AS type,
+				coalesce(n.description, '') AS description
+			ORDER BY score DESC
+			LIMIT $limit`,
+			map[string]interface{}{
+				"terms": terms,
+				"limit": limit,
+			})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := make([]GraphNode, 0, limit)
+	for records.Next(ctx) {
+		values := records.Record().Values
+		name, _ := values[0].(string)
+		if name == "" {
+			continue
+		}
+		nodeType, _ := values[1].(string)
+		description, _ := values[2].(string)
+		seeds = append(seeds, GraphNode{
+			ID:          name,
+			Label:       name,
+			Type:        nodeType,
+			Description: graphDescription(description),
+		})
+	}
+
+	return seeds, records.Err()
+}
+
+// graphDescription turns LightRAG's merged descriptions into lines
+func graphDescription(description string) string {
+	return strings.ReplaceAll(description, ragFieldSeparator, "\n")
+}
+
+// graphWeight reads a relationship weight, which Neo4j may return as int or float
+func graphWeight(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	default:
+		return 1
+	}
+}
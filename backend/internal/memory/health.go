@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	bolt "go.etcd.io/bbolt"
+)
+
+// healthLabels are the graph node labels counted by Health
+var healthLabels = []string{"Document", "Entity", "ExecutionTrace", "Project", "File", "Function", "Class"}
+
+// StoreHealth reports a store's schema version and how much it holds
+type StoreHealth struct {
+	Schema SchemaVersion  `json:"schema"`
+	Counts map[string]int `json:"counts,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// MemoryHealth is the long-term memory health report
+type MemoryHealth struct {
+	Status    string                 `json:"status"`
+	Ready     bool                   `json:"ready"`
+	Error     string                 `json:"error,omitempty"`
+	Stores    map[string]StoreHealth `json:"stores"` // "document_index" and "neo4j"
+	Integrity *IntegrityReport       `json:"integrity,omitempty"`
+}
+
+// Health reports the connection state, each store's schema version and
+// contents, and the startup integrity check. Stores that aren't open are
+// omitted, so the report is available while memory is degraded.
+func (m *LongTermMemory) Health(ctx context.Context) *MemoryHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	health := &MemoryHealth{
+		Status: m.status,
+		Ready:  m.initialized,
+		Stores: make(map[string]StoreHealth),
+	}
+	if m.lastError != nil {
+		health.Error = m.lastError.Error()
+	}
+
+	if m.documents != nil {
+		store := StoreHealth{Schema: m.documents.schema}
+		counts, err := bucketCounts(m.documents.db)
+		if err != nil {
+			store.Error = err.Error()
+		}
+		store.Counts = counts
+		health.Stores["document_index"] = store
+
+		integrity := m.documents.integrity
+		health.Integrity = &integrity
+	}
+
+	if m.initialized {
+		store := StoreHealth{Schema: m.graphSchema}
+		counts, err := m.labelCounts(ctx)
+		if err != nil {
+			store.Error = err.Error()
+		}
+		store.Counts = counts
+		health.Stores["neo4j"] = store
+	}
+
+	return health
+}
+
+// bucketCounts returns the number of keys in each top-level bucket
+func bucketCounts(db *bolt.DB) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			counts[string(name)] = bucket.Stats().KeyN
+			return nil
+		})
+	})
+	if err != nil {
+		return counts, fmt.Errorf("failed to count document index: %w", err)
+	}
+
+	return counts, nil
+}
+
+// labelCounts returns the number of graph nodes with each of healthLabels
+func (m *LongTermMemory) labelCounts(ctx context.Context) (map[string]int, error) {
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		counts := make(map[string]int, len(healthLabels))
+		for _, label := range healthLabels {
+			// Labels can't be parameters; healthLabels are fixed names
+			records, err := tx.Run(ctx, fmt.Sprintf(`MATCH (n:%s) RETURN count(n)`, label), nil)
+			if err != nil {
+				return nil, err
+			}
+			record, err := records.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			count, _ := record.Values[0].(int64)
+			counts[label] = int(count)
+		}
+		return counts, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count graph nodes: %w", err)
+	}
+
+	return result.(map[string]int), nil
+}
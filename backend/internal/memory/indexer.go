@@ -0,0 +1,627 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrIndexRunning is returned when an index run is requested while one is in progress
+var ErrIndexRunning = errors.New("workspace indexing already running")
+
+// indexedFileBucket holds one JSON-encoded indexedFile per workspace-relative
+// path for the default workspace; other workspaces get a bucket with their
+// name appended
+var indexedFileBucket = []byte("indexed_files")
+
+// indexedFileBucketOf returns the indexed file bucket of a workspace
+func indexedFileBucketOf(workspace string) []byte {
+	if workspace == DefaultWorkspace {
+		return indexedFileBucket
+	}
+	return []byte(string(indexedFileBucket) + "/" + workspace)
+}
+
+// maxIndexErrors caps the per-file errors kept in IndexProgress
+const maxIndexErrors = 20
+
+// codeLanguages maps source extensions to the language recorded with indexed code
+var codeLanguages = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".ts":   "typescript",
+	".tsx":  "typescript",
+	".js":   "javascript",
+	".jsx":  "javascript",
+	".rs":   "rust",
+	".java": "java",
+	".sh":   "bash",
+	".sql":  "sql",
+}
+
+// docExtensions are prose files indexed as documentation
+var docExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+	".rst":      true,
+	".adoc":     true,
+}
+
+// IndexerConfig configures workspace indexing
+type IndexerConfig struct {
+	Root         string
+	Workspace    string // memory workspace the files are stored in
+	MaxFileBytes int64
+	IgnoreDirs   map[string]bool
+	Extensions   map[string]bool // empty indexes every known code and doc extension
+}
+
+// IndexerConfigFromEnv reads WORKSPACE_ROOT, INDEX_MAX_FILE_KB, INDEX_IGNORE_DIRS and INDEX_EXTENSIONS
+func IndexerConfigFromEnv() IndexerConfig {
+	config := IndexerConfig{
+		Root:         getEnv("WORKSPACE_ROOT", "."),
+		Workspace:    DefaultWorkspace,
+		MaxFileBytes: int64(getEnvInt("INDEX_MAX_FILE_KB", 512)) * 1024,
+		IgnoreDirs:   make(map[string]bool),
+		Extensions:   make(map[string]bool),
+	}
+
+	for _, dir := range strings.Split(getEnv("INDEX_IGNORE_DIRS", "node_modules,vendor,data,dist,build"), ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			config.IgnoreDirs[dir] = true
+		}
+	}
+
+	for _, ext := range strings.Split(getEnv("INDEX_EXTENSIONS", ""), ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			config.Extensions[strings.ToLower(ext)] = true
+		}
+	}
+
+	return config
+}
+
+// IndexProgress reports the state of the current or last index run
+type IndexProgress struct {
+	Status      string     `json:"status"` // "idle", "running", "completed", "failed", "cancelled"
+	Path        string     `json:"path,omitempty"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Indexed     int        `json:"indexed"`
+	Unchanged   int        `json:"unchanged"`
+	Skipped     int        `json:"skipped"` // too large or binary
+	Failed      int        `json:"failed"`
+	Removed     int        `json:"removed"`
+	CurrentFile string     `json:"current_file,omitempty"`
+	Errors      []string   `json:"errors,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// indexedFile is what the indexer remembers about a file it stored
+type indexedFile struct {
+	Hash       string    `json:"hash"`
+	DocumentID string    `json:"document_id"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	IndexedAt  time.Time `json:"indexed_at"`
+}
+
+// Indexer stores workspace files in long-term memory, re-inserting only files
+// whose content changed since the last run
+type Indexer struct {
+	longTerm *LongTermMemory
+	config   IndexerConfig
+
+	mu       sync.Mutex
+	progress IndexProgress
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewIndexer creates a workspace indexer
+func NewIndexer(longTerm *LongTermMemory, config IndexerConfig) *Indexer {
+	return &Indexer{
+		longTerm: longTerm,
+		config:   config,
+		progress: IndexProgress{Status: "idle"},
+	}
+}
+
+// Start begins indexing path, relative to the workspace root, in the
+// background. An empty path indexes the whole workspace; force re-reads every
+// file instead of trusting the recorded size, mtime and hash, so documents
+// missing from long-term memory are stored again.
+func (ix *Indexer) Start(path string, force bool) (IndexProgress, error) {
+	if !ix.longTerm.IsReady() {
+		return IndexProgress{}, ErrMemoryUnavailable
+	}
+
+	rel, err := ix.relativePath(path)
+	if err != nil {
+		return IndexProgress{}, err
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.progress.Status == "running" {
+		return ix.snapshotLocked(), ErrIndexRunning
+	}
+
+	// Embedding the workspace waits behind chat and tasks
+	ctx := llm.WithPriority(WithCaller(context.Background(), "indexer"), llm.PriorityBackground)
+	ctx, cancel := context.WithCancel(WithWorkspace(ctx, ix.config.Workspace))
+	now := time.Now()
+	ix.progress = IndexProgress{Status: "running", Path: rel, StartedAt: &now}
+	ix.cancel = cancel
+	ix.done = make(chan struct{})
+
+	go ix.run(ctx, rel, force, ix.done)
+
+	return ix.snapshotLocked(), nil
+}
+
+// Progress returns a copy of the current progress
+func (ix *Indexer) Progress() IndexProgress {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.snapshotLocked()
+}
+
+// Stop cancels a running index and waits for it to finish
+func (ix *Indexer) Stop() {
+	ix.mu.Lock()
+	cancel, done := ix.cancel, ix.done
+	ix.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Indexers keeps an Indexer per workspace, each storing its workspace's
+// files in that workspace's memory
+type Indexers struct {
+	longTerm *LongTermMemory
+	config   IndexerConfig
+
+	mu          sync.Mutex
+	byWorkspace map[string]*Indexer
+}
+
+// NewIndexers creates per-workspace indexers sharing config's limits
+func NewIndexers(longTerm *LongTermMemory, config IndexerConfig) *Indexers {
+	return &Indexers{
+		longTerm:    longTerm,
+		config:      config,
+		byWorkspace: make(map[string]*Indexer),
+	}
+}
+
+// For returns the indexer of a workspace rooted at root. A workspace
+// reopened at another root gets a new indexer once the old one is idle.
+func (s *Indexers) For(workspace, root string) (*Indexer, error) {
+	if err := ValidateWorkspace(workspace); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ix, ok := s.byWorkspace[workspace]; ok {
+		if ix.config.Root == root || ix.Progress().Status == "running" {
+			return ix, nil
+		}
+	}
+
+	config := s.config
+	config.Root = root
+	config.Workspace = workspace
+	ix := NewIndexer(s.longTerm, config)
+	s.byWorkspace[workspace] = ix
+	return ix, nil
+}
+
+// Stop stops every workspace's running index
+func (s *Indexers) Stop() {
+	s.mu.Lock()
+	indexers := make([]*Indexer, 0, len(s.byWorkspace))
+	for _, ix := range s.byWorkspace {
+		indexers = append(indexers, ix)
+	}
+	s.mu.Unlock()
+
+	for _, ix := range indexers {
+		ix.Stop()
+	}
+}
+
+func (ix *Indexer) snapshotLocked() IndexProgress {
+	progress := ix.progress
+	progress.Errors = append([]string(nil), ix.progress.Errors...)
+	return progress
+}
+
+// update applies fn to the progress under the lock
+func (ix *Indexer) update(fn func(p *IndexProgress)) {
+	ix.mu.Lock()
+	fn(&ix.progress)
+	ix.mu.Unlock()
+}
+
+// relativePath cleans a workspace-relative path and rejects paths outside the root
+func (ix *Indexer) relativePath(path string) (string, error) {
+	rel := filepath.ToSlash(filepath.Clean("/" + strings.TrimSpace(path)))
+	rel = strings.TrimPrefix(rel, "/")
+	if rel == "" {
+		rel = "."
+	}
+
+	info, err := os.Stat(filepath.Join(ix.config.Root, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidMemoryRequest, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%w: %s is not a directory", ErrInvalidMemoryRequest, rel)
+	}
+
+	return rel, nil
+}
+
+func (ix *Indexer) run(ctx context.Context, rel string, force bool, done chan struct{}) {
+	defer close(done)
+
+	err := ix.index(ctx, rel, force)
+
+	ix.update(func(p *IndexProgress) {
+		now := time.Now()
+		p.FinishedAt = &now
+		p.CurrentFile = ""
+		switch {
+		case errors.Is(err, context.Canceled):
+			p.Status = "cancelled"
+		case err != nil:
+			p.Status = "failed"
+			p.Error = err.Error()
+		default:
+			p.Status = "completed"
+		}
+	})
+
+	ix.mu.Lock()
+	ix.cancel()
+	ix.cancel = nil
+	progress := ix.snapshotLocked()
+	ix.mu.Unlock()
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logging.FromContext(ctx).Warn("workspace indexing failed", "error", err)
+		return
+	}
+	logging.FromContext(ctx).Info("indexed workspace", "path", progress.Path, "indexed", progress.Indexed,
+		"unchanged", progress.Unchanged, "removed", progress.Removed, "failed", progress.Failed)
+}
+
+// index stores every changed file under rel and forgets files that were deleted
+func (ix *Indexer) index(ctx context.Context, rel string, force bool) error {
+	files, err := ix.collect(rel)
+	if err != nil {
+		return err
+	}
+	ix.update(func(p *IndexProgress) { p.Total = len(files) })
+
+	known, err := ix.longTerm.indexedFiles(ix.config.Workspace, rel)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool, len(files))
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		present[path] = true
+		ix.update(func(p *IndexProgress) { p.CurrentFile = path })
+
+		outcome, err := ix.indexFile(ctx, path, known[path], force)
+		ix.update(func(p *IndexProgress) {
+			p.Processed++
+			switch {
+			case err != nil:
+				p.Failed++
+				if len(p.Errors) < maxIndexErrors {
+					p.Errors = append(p.Errors, fmt.Sprintf("%s: %v", path, err))
+				}
+			case outcome == "indexed":
+				p.Indexed++
+			case outcome == "unchanged":
+				p.Unchanged++
+			default:
+				p.Skipped++
+			}
+		})
+
+		// Without long-term memory every remaining file would fail the same way
+		if errors.Is(err, ErrMemoryUnavailable) {
+			return err
+		}
+	}
+
+	removed := make([]string, 0)
+	for path := range known {
+		if !present[path] {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+
+	if err := ix.longTerm.forgetIndexedFiles(ctx, removed, known); err != nil {
+		return err
+	}
+	ix.update(func(p *IndexProgress) { p.Removed = len(removed) })
+
+	return nil
+}
+
+// collect lists indexable files under rel as workspace-relative slash paths
+func (ix *Indexer) collect(rel string) ([]string, error) {
+	files := make([]string, 0)
+	start := filepath.Join(ix.config.Root, filepath.FromSlash(rel))
+
+	err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if path != start && (strings.HasPrefix(name, ".") || ix.config.IgnoreDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !ix.indexable(name) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(ix.config.Root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk workspace: %w", err)
+	}
+
+	return files, nil
+}
+
+// indexable reports whether a file name has an extension the indexer handles
+func (ix *Indexer) indexable(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := codeLanguages[ext]; !ok && !docExtensions[ext] {
+		return false
+	}
+	return len(ix.config.Extensions) == 0 || ix.config.Extensions[ext]
+}
+
+// indexFile stores one file if it changed and returns "indexed", "unchanged" or "skipped"
+func (ix *Indexer) indexFile(ctx context.Context, path string, previous *indexedFile, force bool) (string, error) {
+	full := filepath.Join(ix.config.Root, filepath.FromSlash(path))
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > ix.config.MaxFileBytes {
+		return "skipped", nil
+	}
+
+	// Same size and mtime is taken as unchanged without reading the file
+	if !force && previous != nil && previous.Size == info.Size() && previous.ModTime.Equal(info.ModTime()) {
+		return "unchanged", nil
+	}
+
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) != -1 {
+		return "skipped", nil
+	}
+
+	state := &indexedFile{
+		Hash:      contentHash(string(data)),
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		IndexedAt: time.Now(),
+	}
+
+	if !force && previous != nil && previous.Hash == state.Hash {
+		// Touched but not edited; remember the new mtime to skip the read next time
+		state.DocumentID = previous.DocumentID
+		state.IndexedAt = previous.IndexedAt
+		return "unchanged", ix.longTerm.recordIndexedFile(ix.config.Workspace, path, state)
+	}
+
+	content, metadata := indexedContent(path, string(data))
+	state.DocumentID = metadata["doc_id"].(string)
+
+	result, err := ix.longTerm.Upsert(ctx, content, metadata)
+	if err != nil {
+		return "", err
+	}
+
+	outcome := "indexed"
+	if result.Action == "skipped" {
+		outcome = "unchanged"
+	}
+	return outcome, ix.longTerm.recordIndexedFile(ix.config.Workspace, path, state)
+}
+
+// indexedContent formats a file for LightRAG: code gets the same header as
+// StoreCode so its entities are extracted as code, everything else is stored
+// as documentation
+func indexedContent(path, data string) (string, map[string]interface{}) {
+	metadata := map[string]interface{}{
+		"filepath":     path,
+		"source":       "workspace_index",
+		"merge_policy": string(MergeReplace),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+
+	if language, ok := codeLanguages[strings.ToLower(filepath.Ext(path))]; ok {
+		metadata["type"] = "code"
+		metadata["language"] = language
+		metadata["doc_id"] = "code:" + path
+		return fmt.Sprintf("File: %s\nLanguage: %s\nCode:\n%s", path, language, data), metadata
+	}
+
+	metadata["type"] = "documentation"
+	metadata["doc_id"] = "doc:" + path
+	return fmt.Sprintf("File: %s\n\n%s", path, data), metadata
+}
+
+// indexedFiles returns what the indexer stored for a workspace's files under
+// rel, keyed by path
+func (m *LongTermMemory) indexedFiles(workspace, rel string) (map[string]*indexedFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return nil, ErrMemoryUnavailable
+	}
+
+	prefix := ""
+	if rel != "." {
+		prefix = rel + "/"
+	}
+
+	files := make(map[string]*indexedFile)
+	err := m.documents.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(indexedFileBucketOf(workspace))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = cursor.Next() {
+			var file indexedFile
+			if err := json.Unmarshal(v, &file); err != nil {
+				return fmt.Errorf("failed to decode indexed file %s: %w", k, err)
+			}
+			files[string(k)] = &file
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load indexed files: %w", err)
+	}
+
+	return files, nil
+}
+
+// recordIndexedFile remembers the state of a file the indexer stored
+func (m *LongTermMemory) recordIndexedFile(workspace, path string, file *indexedFile) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return ErrMemoryUnavailable
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode indexed file: %w", err)
+	}
+
+	err = m.documents.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(indexedFileBucketOf(workspace))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(path), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record indexed file %s: %w", path, err)
+	}
+	return nil
+}
+
+// forgetIndexedFiles deletes the documents of files removed from the workspace
+func (m *LongTermMemory) forgetIndexedFiles(ctx context.Context, paths []string, known map[string]*indexedFile) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if file := known[path]; file != nil && file.DocumentID != "" {
+			keys = append(keys, file.DocumentID)
+		}
+	}
+
+	ctx, finish := m.beginAudit(ctx, "delete", "forget_indexed_files", strings.Join(paths, ", "))
+	err := m.forgetDocuments(ctx, paths, keys)
+	finish(len(keys), "", err)
+	return err
+}
+
+// forgetDocuments removes the documents of deleted files and their index state
+func (m *LongTermMemory) forgetDocuments(ctx context.Context, paths, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.initialized {
+		return ErrMemoryUnavailable
+	}
+
+	ws, err := m.scope(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := m.deleteDocuments(ctx, ws, keys); err != nil {
+		return err
+	}
+
+	err = m.documents.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(indexedFileBucketOf(ws.name))
+		if bucket == nil {
+			return nil
+		}
+		for _, path := range paths {
+			if err := bucket.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to forget indexed files: %w", err)
+	}
+	return nil
+}
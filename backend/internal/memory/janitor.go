@@ -0,0 +1,265 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"agent-workspace/backend/pkg/logging"
+)
+
+// TaskArchiver persists a task before the janitor evicts it
+type TaskArchiver interface {
+	ArchiveTask(ctx context.Context, task *TaskMemory) error
+}
+
+// JanitorConfig bounds short-term memory; zero disables a limit
+type JanitorConfig struct {
+	Interval       time.Duration
+	MaxAge         time.Duration
+	MaxTasks       int
+	MaxBytes       int64
+	ArchiveOnEvict bool
+}
+
+// JanitorStats counts janitor runs and evictions
+type JanitorStats struct {
+	Runs            int64
+	EvictedByAge    int64
+	EvictedByCount  int64
+	EvictedByBytes  int64
+	Archived        int64
+	ArchiveFailures int64
+	BytesFreed      int64
+	LastRun         time.Time
+}
+
+// evictionCandidate is a task considered during a janitor pass
+type evictionCandidate struct {
+	id           string
+	task         *TaskMemory
+	lastAccessed time.Time
+	bytes        int64
+	running      bool
+	reason       string
+}
+
+// JanitorConfigFromEnv reads janitor limits from the environment
+func JanitorConfigFromEnv() JanitorConfig {
+	return JanitorConfig{
+		Interval:       time.Duration(getEnvInt("SHORT_TERM_JANITOR_INTERVAL_SECONDS", 60)) * time.Second,
+		MaxAge:         time.Duration(getEnvInt("SHORT_TERM_MAX_AGE_MINUTES", 120)) * time.Minute,
+		MaxTasks:       getEnvInt("SHORT_TERM_MAX_TASKS", 100),
+		MaxBytes:       int64(getEnvInt("SHORT_TERM_MAX_BYTES", 256*1024*1024)),
+		ArchiveOnEvict: getEnv("SHORT_TERM_ARCHIVE_ON_EVICT", "true") == "true",
+	}
+}
+
+// StartJanitor periodically evicts tasks that exceed the configured limits.
+// Running tasks are only evicted by age; archiver may be nil.
+func (m *ShortTermMemory) StartJanitor(config JanitorConfig, archiver TaskArchiver) {
+	m.mu.Lock()
+	m.janitorStop = make(chan struct{})
+	stop := m.janitorStop
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.RunJanitor(WithCaller(context.Background(), "janitor"), config, archiver)
+			}
+		}
+	}()
+}
+
+// StopJanitor stops the background janitor
+func (m *ShortTermMemory) StopJanitor() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.janitorStop != nil {
+		close(m.janitorStop)
+		m.janitorStop = nil
+	}
+}
+
+// RunJanitor performs a single eviction pass and returns the number of evicted tasks
+func (m *ShortTermMemory) RunJanitor(ctx context.Context, config JanitorConfig, archiver TaskArchiver) int {
+	evict := m.selectEvictions(config)
+
+	for _, candidate := range evict {
+		if !config.ArchiveOnEvict || archiver == nil {
+			continue
+		}
+
+		// Memory pressure wins: a failed archive is counted but does not block eviction
+		if err := archiver.ArchiveTask(ctx, candidate.task); err != nil {
+			logging.FromContext(ctx).Warn("failed to archive task before eviction", "task_id", candidate.id, "error", err)
+			m.recordJanitor(func(s *JanitorStats) { s.ArchiveFailures++ })
+			continue
+		}
+		m.recordJanitor(func(s *JanitorStats) { s.Archived++ })
+	}
+
+	m.mu.Lock()
+	removed := make([]string, 0, len(evict))
+	removedTasks := make([]*TaskMemory, 0, len(evict))
+	for _, candidate := range evict {
+		if m.tasks[candidate.id] != candidate.task {
+			continue
+		}
+		delete(m.tasks, candidate.id)
+		removed = append(removed, candidate.id)
+		removedTasks = append(removedTasks, candidate.task)
+
+		switch candidate.reason {
+		case "age":
+			m.janitorStats.EvictedByAge++
+		case "count":
+			m.janitorStats.EvictedByCount++
+		case "bytes":
+			m.janitorStats.EvictedByBytes++
+		}
+		m.janitorStats.BytesFreed += candidate.bytes
+	}
+	m.deleteSnapshots(removed...)
+	m.releaseBlobs(removedTasks...)
+	closeTaskSubscriptions(removedTasks...)
+	m.janitorStats.Runs++
+	m.janitorStats.LastRun = time.Now()
+	m.mu.Unlock()
+
+	if len(removed) > 0 {
+		logging.FromContext(ctx).Info("evicted short-term tasks", "tasks", len(removed))
+	}
+
+	return len(removed)
+}
+
+// JanitorStats returns eviction metrics and current usage
+func (m *ShortTermMemory) JanitorStats() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var totalBytes int64
+	for _, task := range m.tasks {
+		totalBytes += task.SizeBytes()
+	}
+
+	stats := m.janitorStats
+	result := map[string]interface{}{
+		"tasks":            len(m.tasks),
+		"bytes":            totalBytes,
+		"runs":             stats.Runs,
+		"evicted_by_age":   stats.EvictedByAge,
+		"evicted_by_count": stats.EvictedByCount,
+		"evicted_by_bytes": stats.EvictedByBytes,
+		"archived":         stats.Archived,
+		"archive_failures": stats.ArchiveFailures,
+		"bytes_freed":      stats.BytesFreed,
+	}
+	if !stats.LastRun.IsZero() {
+		result["last_run"] = stats.LastRun.Format(time.RFC3339)
+	}
+
+	return result
+}
+
+// selectEvictions picks tasks past MaxAge, then least recently used idle
+// tasks until MaxTasks and MaxBytes are satisfied
+func (m *ShortTermMemory) selectEvictions(config JanitorConfig) []*evictionCandidate {
+	m.mu.RLock()
+	candidates := make([]*evictionCandidate, 0, len(m.tasks))
+	for id, task := range m.tasks {
+		candidates = append(candidates, &evictionCandidate{
+			id:           id,
+			task:         task,
+			lastAccessed: task.LastAccessed,
+			bytes:        task.SizeBytes(),
+			running:      task.GetStatus() == TaskStatusRunning,
+		})
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastAccessed.Before(candidates[j].lastAccessed)
+	})
+
+	var totalBytes int64
+	for _, c := range candidates {
+		totalBytes += c.bytes
+	}
+	remaining := len(candidates)
+
+	evict := make([]*evictionCandidate, 0)
+	mark := func(c *evictionCandidate, reason string) {
+		c.reason = reason
+		evict = append(evict, c)
+		remaining--
+		totalBytes -= c.bytes
+	}
+
+	if config.MaxAge > 0 {
+		cutoff := time.Now().Add(-config.MaxAge)
+		for _, c := range candidates {
+			if c.lastAccessed.Before(cutoff) {
+				mark(c, "age")
+			}
+		}
+	}
+
+	for _, c := range candidates {
+		if c.reason != "" || c.running {
+			continue
+		}
+
+		switch {
+		case config.MaxTasks > 0 && remaining > config.MaxTasks:
+			mark(c, "count")
+		case config.MaxBytes > 0 && totalBytes > config.MaxBytes:
+			mark(c, "bytes")
+		}
+	}
+
+	return evict
+}
+
+func (m *ShortTermMemory) recordJanitor(update func(*JanitorStats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(&m.janitorStats)
+}
+
+// SizeBytes estimates the memory held by the task, including the screenshot
+// bytes it references in the blob store
+func (t *TaskMemory) SizeBytes() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	// Fixed overhead per entry covers timestamps, IDs and small maps
+	const entryOverhead = 256
+
+	size := int64(len(t.Plan))
+	for _, s := range t.Screenshots {
+		size += int64(s.Size) + entryOverhead
+	}
+	for _, r := range t.Reasoning {
+		size += int64(len(r.Prompt)+len(r.Response)+len(r.Reasoning)) + entryOverhead
+	}
+	for _, a := range t.Actions {
+		size += int64(len(a.Command)+len(a.Error)) + entryOverhead
+	}
+	for _, r := range t.Reflections {
+		size += int64(len(r.Critique)) + entryOverhead
+	}
+	size += int64(len(t.Perceptions)+len(t.Context)) * entryOverhead
+
+	return size
+}
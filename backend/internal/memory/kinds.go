@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MemoryKind separates what happened (episodic) from what is true (semantic)
+// and how to do things (procedural)
+type MemoryKind string
+
+const (
+	// KindEpisodic covers traces of past work: conversations, actions, task archives
+	KindEpisodic MemoryKind = "episodic"
+	// KindSemantic covers facts: concepts and code
+	KindSemantic MemoryKind = "semantic"
+	// KindProcedural covers how-tos and runbooks
+	KindProcedural MemoryKind = "procedural"
+)
+
+// kindByType assigns every long-term document type to a memory kind
+var kindByType = map[string]MemoryKind{
+	"conversation":    KindEpisodic,
+	"action":          KindEpisodic,
+	"task_archive":    KindEpisodic,
+	"task_summary":    KindEpisodic,
+	"proposal_reward": KindEpisodic,
+	"concept":         KindSemantic,
+	"code":            KindSemantic,
+	"documentation":   KindSemantic,
+	"procedure":       KindProcedural,
+}
+
+// ragModes are the LightRAG retrieval modes accepted in a query mode
+var ragModes = map[string]bool{"naive": true, "local": true, "global": true, "hybrid": true}
+
+// KindOf returns the memory kind of a document type; unknown types are semantic
+func KindOf(docType string) MemoryKind {
+	if kind, ok := kindByType[docType]; ok {
+		return kind
+	}
+	return KindSemantic
+}
+
+// ParseMemoryKind validates a memory kind name
+func ParseMemoryKind(name string) (MemoryKind, error) {
+	switch kind := MemoryKind(name); kind {
+	case KindEpisodic, KindSemantic, KindProcedural:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unknown memory kind %q", name)
+	}
+}
+
+// label is the Neo4j label carried by Document nodes of this kind
+func (k MemoryKind) label() string {
+	switch k {
+	case KindEpisodic:
+		return "Episodic"
+	case KindProcedural:
+		return "Procedural"
+	default:
+		return "Semantic"
+	}
+}
+
+// typesOfKinds returns the document types belonging to any of kinds, sorted
+func typesOfKinds(kinds []MemoryKind) []string {
+	types := make([]string, 0, len(kindByType))
+	for docType, kind := range kindByType {
+		for _, k := range kinds {
+			if k == kind {
+				types = append(types, docType)
+				break
+			}
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ParseQueryMode splits a query mode such as "hybrid", "procedural" or
+// "local+semantic,procedural" into a LightRAG mode and the memory kinds to
+// search. Either part may be absent; no kinds means every kind.
+func ParseQueryMode(mode string) (string, []MemoryKind, error) {
+	ragMode := ""
+	kinds := make([]MemoryKind, 0)
+
+	for _, part := range strings.FieldsFunc(mode, func(r rune) bool { return r == '+' || r == ',' }) {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if ragModes[part] {
+			if ragMode != "" && ragMode != part {
+				return "", nil, fmt.Errorf("conflicting retrieval modes %q and %q", ragMode, part)
+			}
+			ragMode = part
+			continue
+		}
+
+		kind, err := ParseMemoryKind(part)
+		if err != nil {
+			return "", nil, fmt.Errorf("unknown query mode %q", part)
+		}
+		kinds = append(kinds, kind)
+	}
+
+	return ragMode, kinds, nil
+}
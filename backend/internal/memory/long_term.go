@@ -2,12 +2,20 @@ package memory
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	lightrag "github.com/MegaGrindStone/go-light-rag"
 	"github.com/MegaGrindStone/go-light-rag/storage"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/config"
+
+	"agent-workspace/backend/pkg/logging"
 )
 
 // LongTermMemory manages long-term knowledge storage
@@ -16,8 +24,29 @@ type LongTermMemory struct {
 	neo4jStorage *storage.Neo4J
 	chromemStore *storage.Chromem
 	boltStore    *storage.Bolt
+	embeddings   *EmbeddingGenerator
+	documents    *documentIndex
+	vectors      VectorStore
+	graphSchema  SchemaVersion
+	workspaces   map[string]*workspaceStores // open non-default workspaces
+	workspacesMu sync.Mutex
+	reranker     Reranker
+	audit        *AuditLog
+	dedup        DedupConfig
+	federated    FederatedConfig
+	rewardWeight float64 // how far feedback reward shifts search scores
 	mu           sync.RWMutex
 	initialized  bool
+	status       string // "connecting", "ready", "degraded", "closed"
+	lastError    error
+	stopCh       chan struct{}
+
+	// GetContext retrieves contextCandidates hits, keeps the best contextTopK
+	// and packs them into the token budget in chunks of contextChunkTokens
+	contextCandidates  int
+	contextTopK        int
+	contextChunkTokens int
+	tokens             *TokenEstimator
 }
 
 // MemoryEntry represents a memory entry
@@ -30,71 +59,71 @@ type MemoryEntry struct {
 	Timestamp time.Time
 }
 
-// NewLongTermMemory creates a new long-term memory system
+// NewLongTermMemory creates a new long-term memory system, blocking until connected
 func NewLongTermMemory() (*LongTermMemory, error) {
-	// Initialize storage backends
-	neo4j, err := initNeo4j()
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Neo4j: %w", err)
-	}
+	m := newLongTermMemory()
 
-	chromem, err := initChromem()
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize ChromeM: %w", err)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
 
-	bolt, err := initBolt()
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Bolt: %w", err)
+	if err := m.connect(ctx); err != nil {
+		return nil, err
 	}
 
-	// Create embedding function
-	embeddingFunc := createEmbeddingFunction()
+	go m.monitorLoop()
 
-	// Initialize LightRAG
-	rag, err := lightrag.New(
-		lightrag.WithGraphStorage(neo4j),
-		lightrag.WithVectorStorage(chromem),
-		lightrag.WithKVStorage(bolt),
-		lightrag.WithEmbeddingFunc(embeddingFunc),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize LightRAG: %w", err)
-	}
-
-	return &LongTermMemory{
-		rag:          rag,
-		neo4jStorage: neo4j,
-		chromemStore: chromem,
-		boltStore:    bolt,
-		initialized:  true,
-	}, nil
+	return m, nil
 }
 
-// Store stores content in long-term memory
+// Store stores content in long-term memory, skipping or merging duplicates (see Upsert)
 func (m *LongTermMemory) Store(ctx context.Context, content string, metadata map[string]interface{}) error {
-	if !m.initialized {
-		return fmt.Errorf("memory system not initialized")
-	}
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Insert into LightRAG
-	return m.rag.Insert(ctx, content)
+	_, err := m.Upsert(ctx, content, metadata)
+	return err
 }
 
 // Query queries the knowledge graph
 func (m *LongTermMemory) Query(ctx context.Context, query string) (string, error) {
-	if !m.initialized {
-		return "", fmt.Errorf("memory system not initialized")
+	return m.QueryWithMode(ctx, query, "hybrid")
+}
+
+// QueryWithMode queries long-term memory with a LightRAG retrieval mode
+// ("naive", "local", "global" or "hybrid")
+func (m *LongTermMemory) QueryWithMode(ctx context.Context, query, mode string) (string, error) {
+	ctx, finish := m.beginAudit(ctx, "query", "rag_"+mode, query)
+	answer, err := m.queryWithMode(ctx, query, mode)
+	results := 0
+	if answer != "" {
+		results = 1
 	}
+	finish(results, "", err)
+	return answer, err
+}
 
+func (m *LongTermMemory) queryWithMode(ctx context.Context, query, mode string) (string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	if !m.initialized {
+		return "", ErrMemoryUnavailable
+	}
+
+	ws, err := m.scope(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	queryMode := lightrag.ModeHybrid
+	switch mode {
+	case "naive":
+		queryMode = lightrag.ModeNaive
+	case "local":
+		queryMode = lightrag.ModeLocal
+	case "global":
+		queryMode = lightrag.ModeGlobal
+	}
+
 	// Query LightRAG
-	result, err := m.rag.Query(ctx, query, lightrag.ModeHybrid)
+	result, err := ws.rag.Query(ctx, query, queryMode)
 	if err != nil {
 		return "", fmt.Errorf("failed to query: %w", err)
 	}
@@ -102,22 +131,55 @@ func (m *LongTermMemory) Query(ctx context.Context, query string) (string, error
 	return result, nil
 }
 
-// VectorSearch performs vector similarity search
-func (m *LongTermMemory) VectorSearch(ctx context.Context, query string, topK int) ([]string, error) {
-	if !m.initialized {
-		return nil, fmt.Errorf("memory system not initialized")
-	}
+// VectorSearch is a plain k-nearest-neighbour search: the topK documents
+// passing filter nearest to query after skipping offset, scored by raw cosine
+// similarity with no reward adjustment or reranking
+func (m *LongTermMemory) VectorSearch(ctx context.Context, query string, filter MemoryFilter, topK, offset int) ([]MemoryHit, error) {
+	ctx, finish := m.beginAudit(ctx, "query", "vector_search", query)
+	hits, err := m.vectorSearch(ctx, query, filter, topK, offset)
+	finish(len(hits), "", err)
+	return hits, err
+}
 
+func (m *LongTermMemory) vectorSearch(ctx context.Context, query string, filter MemoryFilter, topK, offset int) ([]MemoryHit, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	// Perform vector search through LightRAG
-	result, err := m.rag.Query(ctx, query, lightrag.ModeLocal)
+	if !m.initialized {
+		return nil, ErrMemoryUnavailable
+	}
+	if topK <= 0 {
+		topK = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	ws, err := m.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if types, restricted := filter.types(); restricted && len(types) == 0 {
+		return []MemoryHit{}, nil
+	}
+
+	embedding, err := m.embeddings.Generate(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	hits, err := m.nearestVectors(ctx, ws, embedding, filter, offset+topK)
 	if err != nil {
 		return nil, fmt.Errorf("failed to vector search: %w", err)
 	}
+	if offset >= len(hits) {
+		return []MemoryHit{}, nil
+	}
 
-	return []string{result}, nil
+	hits = hits[offset:]
+	ws.documents.touch(hitIDs(hits))
+	return hits, nil
 }
 
 // StoreConversation stores a conversation in memory
@@ -174,9 +236,81 @@ func (m *LongTermMemory) StoreAction(ctx context.Context, action, result string,
 	return m.Store(ctx, content, metadata)
 }
 
-// GetContext retrieves relevant context for a query
+// ArchiveTask stores a condensed record of a short-term task in its workspace
+func (m *LongTermMemory) ArchiveTask(ctx context.Context, task *TaskMemory) error {
+	ctx = WithWorkspace(ctx, task.Workspace)
+	goal, _, completed := task.GetPlan()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Task: %s\nGoal: %s\nStatus: %s\nCompleted steps: %d\n", task.TaskID, goal, task.GetStatus(), completed)
+
+	for _, action := range task.GetActions() {
+		fmt.Fprintf(&b, "Action [%s] %s success=%v", action.Type, action.Command, action.Success)
+		if action.Error != "" {
+			fmt.Fprintf(&b, " error=%s", action.Error)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, reflection := range task.GetReflections() {
+		fmt.Fprintf(&b, "Reflection: %s\n", reflection.Critique)
+	}
+
+	metadata := map[string]interface{}{
+		"type":         "task_archive",
+		"task_id":      task.TaskID,
+		"doc_id":       "task_archive:" + task.TaskID,
+		"merge_policy": string(MergeReplace),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+
+	return m.Store(ctx, b.String(), metadata)
+}
+
+// SetReranker sets the second-stage reranker used by GetContext; nil keeps vector order
+func (m *LongTermMemory) SetReranker(reranker Reranker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reranker = reranker
+}
+
+// GetContext assembles at most maxTokens of context for a query. Documents and
+// code graph symbols are retrieved together (see FederatedSearch) and
+// reranked when a reranker is set, the most relevant chunks are packed into
+// the budget and each is cited by source. With no hits it falls back to a
+// LightRAG answer.
 func (m *LongTermMemory) GetContext(ctx context.Context, query string, maxTokens int) (string, error) {
-	return m.Query(ctx, query)
+	hits, err := m.FederatedSearch(ctx, query, MemoryFilter{}, m.contextCandidates)
+	if err != nil {
+		return "", err
+	}
+	if len(hits) == 0 {
+		answer, err := m.Query(ctx, query)
+		if err != nil {
+			return "", err
+		}
+		return truncateToTokens(answer, maxTokens, m.tokens), nil
+	}
+
+	m.mu.RLock()
+	reranker := m.reranker
+	m.mu.RUnlock()
+
+	if reranker != nil {
+		reranked, err := reranker.Rerank(ctx, query, hits)
+		if err != nil {
+			logging.FromContext(ctx).Warn("reranking failed, using vector order", "error", err)
+		} else {
+			hits = reranked
+		}
+	}
+
+	if len(hits) > m.contextTopK {
+		hits = hits[:m.contextTopK]
+	}
+
+	return packContext(hits, maxTokens, m.contextChunkTokens, m.tokens), nil
 }
 
 // GetRelatedConcepts finds concepts related to a query
@@ -198,51 +332,137 @@ func (m *LongTermMemory) GetCodeContext(ctx context.Context, filepath string) (s
 	return m.Query(ctx, query)
 }
 
-// Cleanup closes all connections
+// Cleanup closes all connections, allowing up to 10 seconds
 func (m *LongTermMemory) Cleanup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return m.Shutdown(ctx)
+}
+
+// Shutdown stops background loops and closes every storage backend, giving up
+// on backends still closing when ctx ends. Later calls are no-ops.
+func (m *LongTermMemory) Shutdown(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if !m.initialized {
+	if m.status == "closed" {
 		return nil
 	}
 
-	// Close storage backends
+	close(m.stopCh)
+	m.status = "closed"
+	m.initialized = false
+
+	// Keep closing after a failure so one bad backend doesn't leak the rest
+	var errs []error
+
 	if m.neo4jStorage != nil {
-		// Neo4j close handled by driver
+		if err := m.neo4jStorage.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Neo4j: %w", err))
+		}
+		m.neo4jStorage = nil
+	}
+
+	// Workspace indexes share the default index's database, so close them first
+	errs = append(errs, m.closeWorkspaces(ctx)...)
+
+	if m.documents != nil {
+		if err := m.documents.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close document index: %w", err))
+		}
+		m.documents = nil
+	}
+
+	if m.vectors != nil {
+		if err := m.vectors.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close vector store: %w", err))
+		}
+		m.vectors = nil
 	}
 
 	if m.chromemStore != nil {
-		// ChromeM close
+		if err := closeStorage(ctx, m.chromemStore); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close ChromeM: %w", err))
+		}
+		m.chromemStore = nil
 	}
 
 	if m.boltStore != nil {
-		// Bolt close
+		if err := closeStorage(ctx, m.boltStore); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Bolt: %w", err))
+		}
+		m.boltStore = nil
 	}
 
-	m.initialized = false
-	return nil
+	m.rag = nil
+	return errors.Join(errs...)
+}
+
+// closeStorage closes a LightRAG storage backend if it holds resources.
+// Bolt's Close blocks on open transactions, so it is abandoned if ctx ends
+// first; ChromeM persists on every write and has nothing to close.
+func closeStorage(ctx context.Context, s interface{}) error {
+	var closeFn func() error
+
+	switch closer := s.(type) {
+	case *storage.Bolt:
+		// storage.Bolt exposes its database but has no Close of its own
+		if closer.DB == nil {
+			return nil
+		}
+		closeFn = closer.DB.Close
+	case interface{ Close() error }:
+		closeFn = closer.Close
+	default:
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- closeFn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Helper functions
 
-func initNeo4j() (*storage.Neo4J, error) {
+func initNeo4j(ctx context.Context) (*storage.Neo4J, error) {
 	// Get configuration from environment
 	uri := getEnv("NEO4J_URI", "bolt://localhost:7687")
-	username := getEnv("NEO4J_USERNAME", "neo4j")
+	username := getEnv("NEO4J_USER", "neo4j")
 	password := getEnv("NEO4J_PASSWORD", "password")
+	connectTimeout := time.Duration(getEnvInt("NEO4J_CONNECT_TIMEOUT_SECONDS", 10)) * time.Second
 
-	return storage.NewNeo4J(uri, username, password)
+	driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(username, password, ""),
+		func(c *config.Config) {
+			c.SocketConnectTimeout = connectTimeout
+			c.ConnectionAcquisitionTimeout = connectTimeout
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create driver: %w", err)
+	}
+
+	// Bound the handshake so an unreachable server can't hang the caller
+	verifyCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if err := driver.VerifyConnectivity(verifyCtx); err != nil {
+		driver.Close(context.Background())
+		return nil, fmt.Errorf("neo4j at %s unreachable: %w", uri, err)
+	}
+
+	return &storage.Neo4J{Client: driver}, nil
 }
 
-func initChromem() (*storage.Chromem, error) {
+func initChromem(embeddings *EmbeddingGenerator) (*storage.Chromem, error) {
 	// ChromeM uses in-memory storage by default
 	dbPath := getEnv("CHROMEM_DB_PATH", "./data/chromem.db")
-	
-	// Create embedding function for ChromeM
-	embeddingFunc := createEmbeddingFunction()
-	
-	return storage.NewChromem(dbPath, 5, embeddingFunc)
+
+	return storage.NewChromem(dbPath, 5, embeddings.EmbeddingFunc())
 }
 
 func initBolt() (*storage.Bolt, error) {
@@ -250,28 +470,17 @@ func initBolt() (*storage.Bolt, error) {
 	return storage.NewBolt(dbPath)
 }
 
-func createEmbeddingFunction() func(context.Context, []string) ([][]float64, error) {
-	return func(ctx context.Context, texts []string) ([][]float64, error) {
-		// Use Ollama for embeddings
-		embeddings := make([][]float64, len(texts))
-		
-		// TODO: Implement actual Ollama embedding calls
-		// For now, return placeholder embeddings
-		for i := range texts {
-			// Create a simple embedding (should be replaced with actual Ollama call)
-			embeddings[i] = make([]float64, 768) // Standard embedding size
-			for j := range embeddings[i] {
-				embeddings[i][j] = 0.1 // Placeholder value
-			}
-		}
-		
-		return embeddings, nil
-	}
-}
-
 func getEnv(key, defaultValue string) string {
-	// TODO: Implement environment variable reading
-	// For now, return default value
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+)
+
+// metricsTimeout bounds the store queries run on each scrape
+const metricsTimeout = 5 * time.Second
+
+// RegisterMetrics adds gauges for the size of each memory store to registry.
+// Long-term counts come from Health, so stores that aren't open are omitted.
+func (s *System) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("memory_store_items", "Items held by each long-term memory store",
+		[]string{"store", "collection"}, func() []metrics.Sample {
+			samples := make([]metrics.Sample, 0)
+			if s.LongTerm == nil {
+				return samples
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), metricsTimeout)
+			defer cancel()
+
+			for store, health := range s.LongTerm.Health(ctx).Stores {
+				for collection, count := range health.Counts {
+					samples = append(samples, metrics.Sample{Labels: []string{store, collection}, Value: float64(count)})
+				}
+			}
+			return samples
+		})
+
+	registry.NewGaugeFunc("memory_short_term_tasks", "Tasks held in short-term memory", nil, func() []metrics.Sample {
+		if s.ShortTerm == nil {
+			return []metrics.Sample{{Value: 0}}
+		}
+		return []metrics.Sample{{Value: float64(len(s.ShortTerm.ListTasks()))}}
+	})
+}
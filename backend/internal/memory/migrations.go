@@ -0,0 +1,289 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	bolt "go.etcd.io/bbolt"
+
+	"agent-workspace/backend/pkg/logging"
+)
+
+// schemaBucket records the document index database's schema version
+var (
+	schemaBucket     = []byte("schema")
+	schemaVersionKey = []byte("version")
+)
+
+// maxIntegrityProblems caps how many problems an integrity report lists
+const maxIntegrityProblems = 20
+
+// SchemaVersion is a store's schema version and the newest this build knows
+type SchemaVersion struct {
+	Version int      `json:"version"`
+	Latest  int      `json:"latest"`
+	Applied []string `json:"applied,omitempty"` // migrations applied at startup
+}
+
+// boltMigration upgrades the document index database by one version
+type boltMigration struct {
+	description string
+	apply       func(tx *bolt.Tx) error
+}
+
+// boltMigrations are applied in order; migration i brings the database to
+// version i+1. Only ever append.
+var boltMigrations = []boltMigration{
+	{"create document and indexed file buckets", func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{documentBucket, indexedFileBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"backfill document version history", backfillDocumentVersions},
+}
+
+// neo4jMigration upgrades the graph schema by one version. Schema changes
+// can't share a transaction with data, so each statement runs on its own.
+type neo4jMigration struct {
+	description string
+	statements  []string
+}
+
+// neo4jMigrations are applied in order; migration i brings the graph to
+// version i+1. Only ever append.
+var neo4jMigrations = []neo4jMigration{
+	{"unique code graph keys", []string{
+		`CREATE CONSTRAINT project_name IF NOT EXISTS FOR (p:Project) REQUIRE p.name IS UNIQUE`,
+		`CREATE CONSTRAINT file_path IF NOT EXISTS FOR (f:File) REQUIRE f.path IS UNIQUE`,
+		`CREATE CONSTRAINT function_signature IF NOT EXISTS FOR (fn:Function) REQUIRE fn.signature IS UNIQUE`,
+	}},
+	{"index document ids", []string{
+		`CREATE INDEX document_id IF NOT EXISTS FOR (d:Document) ON (d.id)`,
+	}},
+	{"assign legacy documents to the default workspace", []string{
+		`MATCH (d:Document)
+		WHERE none(label IN labels(d) WHERE label STARTS WITH 'Workspace_')
+		SET d:` + workspaceLabel(DefaultWorkspace),
+	}},
+}
+
+// migrateBolt brings the document index database up to the latest schema,
+// one transaction per migration
+func migrateBolt(db *bolt.DB) (SchemaVersion, error) {
+	schema := SchemaVersion{Latest: len(boltMigrations)}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schemaBucket)
+		if bucket == nil {
+			return nil
+		}
+		version, err := strconv.Atoi(string(bucket.Get(schemaVersionKey)))
+		if err != nil {
+			return fmt.Errorf("failed to read schema version: %w", err)
+		}
+		schema.Version = version
+		return nil
+	})
+	if err != nil {
+		return schema, err
+	}
+
+	if schema.Version > schema.Latest {
+		return schema, fmt.Errorf("document index schema version %d is newer than this build supports (%d)", schema.Version, schema.Latest)
+	}
+
+	for version := schema.Version + 1; version <= schema.Latest; version++ {
+		migration := boltMigrations[version-1]
+		err := db.Update(func(tx *bolt.Tx) error {
+			if err := migration.apply(tx); err != nil {
+				return err
+			}
+			bucket, err := tx.CreateBucketIfNotExists(schemaBucket)
+			if err != nil {
+				return err
+			}
+			return bucket.Put(schemaVersionKey, []byte(strconv.Itoa(version)))
+		})
+		if err != nil {
+			return schema, fmt.Errorf("failed to migrate document index to version %d (%s): %w", version, migration.description, err)
+		}
+
+		schema.Version = version
+		schema.Applied = append(schema.Applied, migration.description)
+		slog.Info("document index migrated", "version", version, "migration", migration.description)
+	}
+
+	return schema, nil
+}
+
+// backfillDocumentVersions gives records written before version history was
+// kept a history holding their current version
+func backfillDocumentVersions(tx *bolt.Tx) error {
+	return forEachDocumentBucket(tx, func(_ string, bucket *bolt.Bucket) error {
+		updates := make(map[string][]byte)
+
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record documentRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				// Left for the integrity check to report
+				return nil
+			}
+			if len(record.Versions) > 0 {
+				return nil
+			}
+			if record.Version == 0 {
+				record.Version = 1
+			}
+			record.Versions = []documentVersion{{Version: record.Version, Hash: record.Hash, StoredAt: record.StoredAt}}
+
+			data, err := json.Marshal(&record)
+			if err != nil {
+				return fmt.Errorf("failed to encode document %s: %w", k, err)
+			}
+			updates[string(k)] = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Buckets can't be written while being iterated
+		for key, data := range updates {
+			if err := bucket.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// forEachDocumentBucket calls fn with the document bucket of every workspace
+func forEachDocumentBucket(tx *bolt.Tx, fn func(workspace string, bucket *bolt.Bucket) error) error {
+	return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+		if string(name) == string(documentBucket) {
+			return fn(DefaultWorkspace, bucket)
+		}
+		if workspace, ok := strings.CutPrefix(string(name), workspaceBucketPrefix); ok {
+			return fn(workspace, bucket)
+		}
+		return nil
+	})
+}
+
+// migrateNeo4j brings the graph up to the latest schema. The version is kept
+// on a SchemaVersion node and advanced after each migration, so an
+// interrupted run resumes where it stopped.
+func (m *LongTermMemory) migrateNeo4j(ctx context.Context) (SchemaVersion, error) {
+	schema := SchemaVersion{Latest: len(neo4jMigrations)}
+
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		records, err := tx.Run(ctx, `
+			OPTIONAL MATCH (s:SchemaVersion {store: 'memory'})
+			RETURN coalesce(s.version, 0)`, nil)
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		version, _ := record.Values[0].(int64)
+		return int(version), nil
+	})
+	if err != nil {
+		return schema, fmt.Errorf("failed to read graph schema version: %w", err)
+	}
+	schema.Version = result.(int)
+
+	if schema.Version > schema.Latest {
+		return schema, fmt.Errorf("graph schema version %d is newer than this build supports (%d)", schema.Version, schema.Latest)
+	}
+
+	for version := schema.Version + 1; version <= schema.Latest; version++ {
+		migration := neo4jMigrations[version-1]
+
+		for _, statement := range migration.statements {
+			if _, err := session.Run(ctx, statement, nil); err != nil {
+				return schema, fmt.Errorf("failed to migrate graph to version %d (%s): %w", version, migration.description, err)
+			}
+		}
+
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			_, err := tx.Run(ctx, `
+				MERGE (s:SchemaVersion {store: 'memory'})
+				SET s.version = $version, s.updated_at = datetime()`,
+				map[string]interface{}{"version": version})
+			return nil, err
+		})
+		if err != nil {
+			return schema, fmt.Errorf("failed to record graph schema version %d: %w", version, err)
+		}
+
+		schema.Version = version
+		schema.Applied = append(schema.Applied, migration.description)
+		logging.FromContext(ctx).Info("graph schema migrated", "version", version, "migration", migration.description)
+	}
+
+	return schema, nil
+}
+
+// IntegrityReport summarizes the startup check of stored document records
+type IntegrityReport struct {
+	Checked  int      `json:"checked"`
+	Problems int      `json:"problems"`
+	Details  []string `json:"details,omitempty"` // the first problems found
+}
+
+// checkDocumentIntegrity verifies that every stored document record decodes,
+// is stored under its own key, matches its content hash and has a version
+// history ending at its current version
+func checkDocumentIntegrity(db *bolt.DB) (IntegrityReport, error) {
+	var report IntegrityReport
+	problem := func(workspace, key, format string, args ...interface{}) {
+		report.Problems++
+		if len(report.Details) < maxIntegrityProblems {
+			report.Details = append(report.Details, fmt.Sprintf("%s/%s: %s", workspace, key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return forEachDocumentBucket(tx, func(workspace string, bucket *bolt.Bucket) error {
+			return bucket.ForEach(func(k, v []byte) error {
+				report.Checked++
+				key := string(k)
+
+				var record documentRecord
+				if err := json.Unmarshal(v, &record); err != nil {
+					problem(workspace, key, "undecodable record: %v", err)
+					return nil
+				}
+				if record.Key != key {
+					problem(workspace, key, "stored under the wrong key (record key %q)", record.Key)
+				}
+				if record.Hash != contentHash(record.Content) {
+					problem(workspace, key, "content does not match its hash")
+				}
+				if n := len(record.Versions); n == 0 || record.Versions[n-1].Version != record.Version {
+					problem(workspace, key, "version history does not end at version %d", record.Version)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to check document integrity: %w", err)
+	}
+
+	return report, nil
+}
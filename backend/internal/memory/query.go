@@ -0,0 +1,345 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// MemoryFilter restricts long-term queries by document metadata; zero fields match everything
+type MemoryFilter struct {
+	Types          []string     `json:"types,omitempty"`
+	Kinds          []MemoryKind `json:"kinds,omitempty"`
+	FilepathPrefix string       `json:"filepath_prefix,omitempty"`
+	TaskID         string       `json:"task_id,omitempty"`
+	Since          time.Time    `json:"since,omitempty"`
+	Until          time.Time    `json:"until,omitempty"`
+}
+
+// MemoryHit is a long-term document matched by Search
+type MemoryHit struct {
+	ID       string                 `json:"id"`
+	Type     string                 `json:"type"`
+	Kind     MemoryKind             `json:"kind"`
+	Source   string                 `json:"source,omitempty"` // set by FederatedSearch: "long_term" or "code_graph"
+	Content  string                 `json:"content"`
+	Score    float64                `json:"score"`
+	Version  int                    `json:"version"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	StoredAt time.Time              `json:"stored_at"`
+}
+
+// types returns the document types the filter admits once Types and Kinds
+// are intersected, and whether it restricts types at all
+func (f MemoryFilter) types() ([]string, bool) {
+	if len(f.Kinds) == 0 {
+		return f.Types, len(f.Types) > 0
+	}
+
+	kindTypes := typesOfKinds(f.Kinds)
+	if len(f.Types) == 0 {
+		return kindTypes, true
+	}
+
+	types := make([]string, 0, len(f.Types))
+	for _, t := range f.Types {
+		for _, kt := range kindTypes {
+			if t == kt {
+				types = append(types, t)
+				break
+			}
+		}
+	}
+	return types, true
+}
+
+// matches reports whether a document record satisfies the filter
+func (f MemoryFilter) matches(record *documentRecord) bool {
+	if types, restricted := f.types(); restricted {
+		found := false
+		for _, t := range types {
+			if t == record.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.FilepathPrefix != "" {
+		path, _ := record.Metadata["filepath"].(string)
+		if !strings.HasPrefix(path, f.FilepathPrefix) {
+			return false
+		}
+	}
+
+	if f.TaskID != "" {
+		taskID, _ := record.Metadata["task_id"].(string)
+		if taskID != f.TaskID {
+			return false
+		}
+	}
+
+	if !f.Since.IsZero() && record.StoredAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && record.StoredAt.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+// Search returns up to topK documents matching filter. With a query, documents
+// are ranked by embedding similarity in the vector store; without one, the
+// filter runs as a graph query and the newest documents come first.
+func (m *LongTermMemory) Search(ctx context.Context, query string, filter MemoryFilter, topK int) ([]MemoryHit, error) {
+	ctx, finish := m.beginAudit(ctx, "query", "search", query)
+	hits, err := m.search(ctx, query, filter, topK)
+	finish(len(hits), "", err)
+	return hits, err
+}
+
+func (m *LongTermMemory) search(ctx context.Context, query string, filter MemoryFilter, topK int) ([]MemoryHit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return nil, ErrMemoryUnavailable
+	}
+	if topK <= 0 {
+		topK = 10
+	}
+
+	ws, err := m.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Types and kinds that share no document type can match nothing
+	if types, restricted := filter.types(); restricted && len(types) == 0 {
+		return []MemoryHit{}, nil
+	}
+
+	if strings.TrimSpace(query) == "" {
+		ids, err := m.filterDocumentNodes(ctx, ws, filter, topK)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter documents: %w", err)
+		}
+
+		hits := make([]MemoryHit, 0, len(ids))
+		for _, id := range ids {
+			if record := ws.documents.get(id); record != nil {
+				hits = append(hits, newMemoryHit(record, 0))
+			}
+		}
+		ws.documents.touch(hitIDs(hits))
+		return hits, nil
+	}
+
+	embedding, err := m.embeddings.Generate(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	hits, err := m.searchVectors(ctx, ws, embedding, filter, topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search vectors: %w", err)
+	}
+	ws.documents.touch(hitIDs(hits))
+	return hits, nil
+}
+
+func hitIDs(hits []MemoryHit) []string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+// searchVectors ranks documents passing filter by similarity to embedding,
+// adjusted by their feedback reward
+func (m *LongTermMemory) searchVectors(ctx context.Context, ws *workspaceStores, embedding []float64, filter MemoryFilter, topK int) ([]MemoryHit, error) {
+	limit := topK
+	if m.rewardWeight > 0 {
+		// Over-fetch so well-rewarded documents just outside topK can move up
+		limit *= 2
+	}
+
+	hits, err := m.nearestVectors(ctx, ws, embedding, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		if record := ws.documents.get(hits[i].ID); record != nil {
+			hits[i].Score = m.rewardScore(record, hits[i].Score)
+		}
+	}
+	sortHitsByScore(hits)
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+
+	return hits, nil
+}
+
+// nearestVectors returns the k documents passing filter nearest to embedding,
+// scored by raw cosine similarity. Exact-match fields are pushed down to the
+// vector store; prefix and time constraints are applied to an over-fetched
+// candidate set.
+func (m *LongTermMemory) nearestVectors(ctx context.Context, ws *workspaceStores, embedding []float64, filter MemoryFilter, k int) ([]MemoryHit, error) {
+	where, exact := filter.vectorWhere()
+	limit := k
+	if !exact {
+		limit = k * 4
+	}
+
+	matches, err := ws.vectors.Query(ctx, embedding, limit, where)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]MemoryHit, 0, k)
+	for _, match := range matches {
+		record := ws.documents.get(match.ID)
+		if record == nil || !filter.matches(record) {
+			continue
+		}
+		hits = append(hits, newMemoryHit(record, match.Score))
+		if len(hits) == k {
+			break
+		}
+	}
+
+	return hits, nil
+}
+
+// vectorWhere returns the filter's exact-match constraints and whether they
+// express the whole filter
+func (f MemoryFilter) vectorWhere() (map[string]string, bool) {
+	where := make(map[string]string)
+	exact := f.FilepathPrefix == "" && f.Since.IsZero() && f.Until.IsZero()
+
+	types, _ := f.types()
+	switch len(types) {
+	case 0:
+	case 1:
+		where["type"] = types[0]
+	default:
+		exact = false
+	}
+	if f.TaskID != "" {
+		where["task_id"] = f.TaskID
+	}
+
+	return where, exact
+}
+
+func newMemoryHit(record *documentRecord, score float64) MemoryHit {
+	return MemoryHit{
+		ID:       record.Key,
+		Type:     record.Type,
+		Kind:     KindOf(record.Type),
+		Content:  record.Content,
+		Score:    score,
+		Version:  record.Version,
+		Metadata: record.Metadata,
+		StoredAt: record.StoredAt,
+	}
+}
+
+// writeDocumentNode mirrors a document's filterable metadata onto a Document
+// node labelled with its memory kind and workspace
+func (m *LongTermMemory) writeDocumentNode(ctx context.Context, ws *workspaceStores, record *documentRecord) error {
+	filepath, _ := record.Metadata["filepath"].(string)
+	taskID, _ := record.Metadata["task_id"].(string)
+	kind := KindOf(record.Type)
+
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		// Labels can't be parameters; kind.label() only returns fixed names and
+		// workspace names are validated
+		_, err := tx.Run(ctx, fmt.Sprintf(`
+			MERGE (d:Document:%s {id: $id})
+			REMOVE d:Episodic:Semantic:Procedural
+			SET d:%s, d.type = $type, d.kind = $kind, d.filepath = $filepath, d.task_id = $task_id,
+				d.version = $version, d.stored_at = $stored_at`, workspaceLabel(ws.name), kind.label()),
+			map[string]interface{}{
+				"id":        record.Key,
+				"type":      record.Type,
+				"kind":      string(kind),
+				"filepath":  filepath,
+				"task_id":   taskID,
+				"version":   record.Version,
+				"stored_at": record.StoredAt,
+			})
+		return nil, err
+	})
+
+	return err
+}
+
+// filterDocumentNodes returns IDs of the newest Document nodes in a workspace matching filter
+func (m *LongTermMemory) filterDocumentNodes(ctx context.Context, ws *workspaceStores, filter MemoryFilter, limit int) ([]string, error) {
+	var since, until interface{}
+	if !filter.Since.IsZero() {
+		since = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		until = filter.Until
+	}
+	// Kinds are matched through their types so nodes written before kinds existed still match
+	types, _ := filter.types()
+	if types == nil {
+		types = []string{}
+	}
+
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		records, err := tx.Run(ctx, fmt.Sprintf(`
+			MATCH (d:Document:%s)
+			WHERE (size($types) = 0 OR d.type IN $types)
+				AND ($filepath_prefix = '' OR d.filepath STARTS WITH $filepath_prefix)
+				AND ($task_id = '' OR d.task_id = $task_id)
+				AND ($since IS NULL OR d.stored_at >= $since)
+				AND ($until IS NULL OR d.stored_at <= $until)
+			RETURN d.id AS id
+			ORDER BY d.stored_at DESC
+			LIMIT $limit`, workspaceLabel(ws.name)),
+			map[string]interface{}{
+				"types":           types,
+				"filepath_prefix": filter.FilepathPrefix,
+				"task_id":         filter.TaskID,
+				"since":           since,
+				"until":           until,
+				"limit":           limit,
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make([]string, 0, limit)
+		for records.Next(ctx) {
+			if id, ok := records.Record().Values[0].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids, records.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]string), nil
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// Reranker re-scores first-stage retrieval hits against the query
+type Reranker interface {
+	Rerank(ctx context.Context, query string, hits []MemoryHit) ([]MemoryHit, error)
+}
+
+// LLMReranker scores each (query, document) pair with a short LLM prompt,
+// judging the pair jointly the way a cross-encoder would
+type LLMReranker struct {
+	llm      llm.Provider
+	maxChars int // per-document excerpt length sent to the LLM
+}
+
+// NewLLMReranker creates an LLM-backed reranker
+func NewLLMReranker(llm llm.Provider) *LLMReranker {
+	return &LLMReranker{
+		llm:      llm,
+		maxChars: getEnvInt("MEMORY_RERANK_EXCERPT_CHARS", 800),
+	}
+}
+
+// Rerank orders hits by LLM relevance score, highest first. Scores are
+// normalized to [0, 1] and replace the vector similarity; ties keep the
+// first-stage order.
+func (r *LLMReranker) Rerank(ctx context.Context, query string, hits []MemoryHit) ([]MemoryHit, error) {
+	if len(hits) < 2 {
+		return hits, nil
+	}
+
+	var docs strings.Builder
+	for i, hit := range hits {
+		excerpt := hit.Content
+		if len(excerpt) > r.maxChars {
+			excerpt = excerpt[:r.maxChars] + "..."
+		}
+		fmt.Fprintf(&docs, "[%d] %s\n\n", i, excerpt)
+	}
+
+	prompt := fmt.Sprintf(`Rate how useful each document is for answering the query, judging each document on its own.
+
+Query: %s
+
+Documents:
+%s
+Respond with only a JSON array of %d integers from 0 (irrelevant) to 10 (directly answers the query), one per document in order.`,
+		query, docs.String(), len(hits))
+
+	resp, err := r.llm.ChatCompletion(ctx, llm.Request{
+		Messages: []ollama.ChatMessage{{Role: "user", Content: prompt}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("failed to rerank: empty response")
+	}
+
+	scores, err := parseRerankScores(resp.Choices[0].Message.Content, len(hits))
+	if err != nil {
+		return nil, err
+	}
+
+	reranked := make([]MemoryHit, len(hits))
+	copy(reranked, hits)
+	for i := range reranked {
+		reranked[i].Score = scores[i] / 10
+	}
+
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].Score > reranked[j].Score
+	})
+
+	return reranked, nil
+}
+
+// parseRerankScores extracts the JSON score array, tolerating surrounding prose
+func parseRerankScores(text string, want int) ([]float64, error) {
+	start := strings.Index(text, "[")
+	end := strings.LastIndex(text, "]")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no score array in rerank response")
+	}
+
+	var scores []float64
+	if err := json.Unmarshal([]byte(text[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("failed to parse rerank scores: %w", err)
+	}
+	if len(scores) != want {
+		return nil, fmt.Errorf("rerank returned %d scores for %d documents", len(scores), want)
+	}
+
+	for i, score := range scores {
+		scores[i] = clamp(score, 0, 10)
+	}
+
+	return scores, nil
+}
+
+func clamp(value, lo, hi float64) float64 {
+	if value < lo {
+		return lo
+	}
+	if value > hi {
+		return hi
+	}
+	return value
+}
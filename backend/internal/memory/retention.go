@@ -0,0 +1,385 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrDocumentNotFound is returned when a long-term document ID is unknown
+var ErrDocumentNotFound = errors.New("document not found")
+
+// neutralReward is the reward a document starts with before any feedback
+const neutralReward = 0.5
+
+// RetentionConfig controls how long-term documents are forgotten
+type RetentionConfig struct {
+	Interval       time.Duration
+	TTL            map[string]time.Duration // per-type maximum age; types not listed never expire
+	MinImportance  float64                  // documents scoring below this are pruned
+	HalfLife       time.Duration            // recency half-life used by importance scoring
+	ProtectedTypes map[string]bool          // exempt from importance pruning (TTL still applies)
+}
+
+// RetentionConfigFromEnv reads retention settings from the environment.
+// MEMORY_TTL is a comma-separated list of type=duration pairs, e.g. "conversation=168h,action=72h".
+func RetentionConfigFromEnv() RetentionConfig {
+	config := RetentionConfig{
+		Interval:       time.Duration(getEnvInt("MEMORY_RETENTION_INTERVAL_MINUTES", 60)) * time.Minute,
+		TTL:            make(map[string]time.Duration),
+		MinImportance:  0.05,
+		HalfLife:       time.Duration(getEnvInt("MEMORY_IMPORTANCE_HALF_LIFE_HOURS", 14*24)) * time.Hour,
+		ProtectedTypes: make(map[string]bool),
+	}
+
+	for _, pair := range strings.Split(getEnv("MEMORY_TTL", "conversation=168h,action=72h"), ",") {
+		docType, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			slog.Warn("ignoring invalid MEMORY_TTL entry", "entry", pair)
+			continue
+		}
+		config.TTL[docType] = ttl
+	}
+
+	if value, err := strconv.ParseFloat(getEnv("MEMORY_MIN_IMPORTANCE", "0.05"), 64); err == nil {
+		config.MinImportance = value
+	}
+
+	for _, docType := range strings.Split(getEnv("MEMORY_RETENTION_PROTECTED_TYPES", "concept,code,documentation,task_summary,procedure"), ",") {
+		if docType = strings.TrimSpace(docType); docType != "" {
+			config.ProtectedTypes[docType] = true
+		}
+	}
+
+	return config
+}
+
+// StartRetention applies the retention policy every interval until Cleanup
+func (m *LongTermMemory) StartRetention(config RetentionConfig) {
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+			}
+
+			if !m.IsReady() {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(WithCaller(context.Background(), "retention"), 5*time.Minute)
+			expired, pruned, err := m.ApplyRetention(ctx, config)
+			cancel()
+			if err != nil {
+				slog.Warn("long-term retention pass failed", "error", err)
+				continue
+			}
+			if expired+pruned > 0 {
+				slog.Info("forgot expired and low-importance documents", "expired", expired, "pruned", pruned)
+			}
+		}
+	}()
+}
+
+// ApplyRetention deletes documents past their type's TTL and unprotected
+// documents whose importance has decayed below MinImportance
+func (m *LongTermMemory) ApplyRetention(ctx context.Context, config RetentionConfig) (int, int, error) {
+	ctx, finish := m.beginAudit(ctx, "delete", "retention", "")
+	expired, pruned, err := m.applyRetention(ctx, config)
+	finish(expired+pruned, "", err)
+	return expired, pruned, err
+}
+
+func (m *LongTermMemory) applyRetention(ctx context.Context, config RetentionConfig) (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.initialized {
+		return 0, 0, ErrMemoryUnavailable
+	}
+
+	workspaces, err := m.workspaceNames()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	expired, pruned := 0, 0
+	for _, workspace := range workspaces {
+		ws, err := m.openWorkspace(ctx, workspace)
+		if err != nil {
+			return expired, pruned, err
+		}
+
+		e, p, err := m.applyWorkspaceRetention(ctx, ws, config)
+		expired += e
+		pruned += p
+		if err != nil {
+			return expired, pruned, fmt.Errorf("workspace %s: %w", workspace, err)
+		}
+	}
+
+	return expired, pruned, nil
+}
+
+// applyWorkspaceRetention applies retention to one workspace's documents
+func (m *LongTermMemory) applyWorkspaceRetention(ctx context.Context, ws *workspaceStores, config RetentionConfig) (int, int, error) {
+	now := time.Now()
+	var expired, pruned []string
+
+	ws.documents.mu.RLock()
+	for key, record := range ws.documents.records {
+		if ttl, ok := config.TTL[record.Type]; ok && now.Sub(record.StoredAt) > ttl {
+			expired = append(expired, key)
+			continue
+		}
+		if config.ProtectedTypes[record.Type] {
+			continue
+		}
+		if record.importance(now, config.HalfLife) < config.MinImportance {
+			pruned = append(pruned, key)
+		}
+	}
+	ws.documents.mu.RUnlock()
+
+	if err := m.deleteDocuments(ctx, ws, append(expired, pruned...)); err != nil {
+		return 0, 0, err
+	}
+
+	// Persist access counts gathered since the last pass
+	if err := ws.documents.flush(); err != nil {
+		return len(expired), len(pruned), err
+	}
+
+	return len(expired), len(pruned), nil
+}
+
+// DeleteByFilter forgets every document matching filter and returns how many
+// were removed. An empty filter is rejected rather than wiping memory.
+func (m *LongTermMemory) DeleteByFilter(ctx context.Context, filter MemoryFilter) (int, error) {
+	ctx, finish := m.beginAudit(ctx, "delete", "delete_by_filter", auditFilter(filter))
+	deleted, err := m.deleteByFilter(ctx, filter)
+	finish(deleted, "", err)
+	return deleted, err
+}
+
+func (m *LongTermMemory) deleteByFilter(ctx context.Context, filter MemoryFilter) (int, error) {
+	if filter.empty() {
+		return 0, fmt.Errorf("refusing to delete with an empty filter")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.initialized {
+		return 0, ErrMemoryUnavailable
+	}
+
+	ws, err := m.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0)
+	ws.documents.mu.RLock()
+	for key, record := range ws.documents.records {
+		if filter.matches(record) {
+			keys = append(keys, key)
+		}
+	}
+	ws.documents.mu.RUnlock()
+
+	if err := m.deleteDocuments(ctx, ws, keys); err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// RecordReward folds task feedback in [0, 1] into a document's reward,
+// weighting recent feedback more heavily
+func (m *LongTermMemory) RecordReward(ctx context.Context, docID string, reward float64) error {
+	if reward < 0 || reward > 1 {
+		return fmt.Errorf("reward must be between 0 and 1")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return ErrMemoryUnavailable
+	}
+
+	ws, err := m.scope(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ws.documents.update(docID, func(record *documentRecord) {
+		record.Reward = 0.7*record.reward() + 0.3*reward
+		record.Feedback++
+	})
+}
+
+// deleteDocuments removes a workspace's documents from the graph, vector store
+// and index. Chunks already extracted by LightRAG are not removed.
+func (m *LongTermMemory) deleteDocuments(ctx context.Context, ws *workspaceStores, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	session := m.neo4jStorage.Client.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		_, err := tx.Run(ctx, fmt.Sprintf(`
+			MATCH (d:Document:%s)
+			WHERE d.id IN $ids
+			DETACH DELETE d`, workspaceLabel(ws.name)),
+			map[string]interface{}{"ids": keys})
+		return nil, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete document nodes: %w", err)
+	}
+
+	if err := ws.vectors.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	return ws.documents.delete(keys)
+}
+
+// importance scores a document as access frequency × recency × reward
+func (r *documentRecord) importance(now time.Time, halfLife time.Duration) float64 {
+	lastUsed := r.StoredAt
+	if r.LastAccessed.After(lastUsed) {
+		lastUsed = r.LastAccessed
+	}
+
+	frequency := 1 + math.Log1p(float64(r.AccessCount))
+	recency := 1.0
+	if halfLife > 0 {
+		recency = math.Exp2(-now.Sub(lastUsed).Hours() / halfLife.Hours())
+	}
+
+	return frequency * recency * r.reward()
+}
+
+// reward returns the document's reward, neutral until feedback arrives
+func (r *documentRecord) reward() float64 {
+	if r.Feedback == 0 {
+		return neutralReward
+	}
+	return r.Reward
+}
+
+// empty reports whether the filter would match every document
+func (f MemoryFilter) empty() bool {
+	return len(f.Types) == 0 && len(f.Kinds) == 0 && f.FilepathPrefix == "" && f.TaskID == "" && f.Since.IsZero() && f.Until.IsZero()
+}
+
+// touch records an access for each key; changes are persisted by flush
+func (i *documentIndex) touch(keys []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if record, ok := i.records[key]; ok {
+			record.AccessCount++
+			record.LastAccessed = now
+			i.dirty[key] = true
+		}
+	}
+}
+
+// update applies fn to a record and writes it through to disk
+func (i *documentIndex) update(key string, fn func(*documentRecord)) error {
+	i.mu.Lock()
+	record, ok := i.records[key]
+	if !ok {
+		i.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, key)
+	}
+	fn(record)
+	i.dirty[key] = true
+	i.mu.Unlock()
+
+	return i.flush()
+}
+
+// flush writes records changed by touch or update
+func (i *documentIndex) flush() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.dirty) == 0 {
+		return nil
+	}
+
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(i.bucket)
+		for key := range i.dirty {
+			record, ok := i.records[key]
+			if !ok {
+				continue
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				return fmt.Errorf("failed to encode document %s: %w", key, err)
+			}
+			if err := bucket.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to flush document index: %w", err)
+	}
+
+	i.dirty = make(map[string]bool)
+	return nil
+}
+
+// delete removes records from disk and the cache
+func (i *documentIndex) delete(keys []string) error {
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(i.bucket)
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete documents: %w", err)
+	}
+
+	i.mu.Lock()
+	for _, key := range keys {
+		delete(i.records, key)
+		delete(i.dirty, key)
+	}
+	i.mu.Unlock()
+
+	return nil
+}
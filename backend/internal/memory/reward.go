@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/logging"
+)
+
+// ProposalOutcome is a rewarded evolution proposal and what produced it
+type ProposalOutcome struct {
+	ProposalID  string
+	Component   string
+	Description string
+	Strategy    string   // the approach that generated the proposal, e.g. "refactor"
+	MemoryIDs   []string // long-term documents the proposal was derived from
+	Reward      float64  // 0 (useless) to 1 (essential)
+	Feedback    string
+}
+
+// RecordProposalReward closes the loop between the evolution reward signal and
+// recall: the reward is folded into every document that produced the proposal,
+// and the outcome itself is stored as an episodic precedent whose reward
+// biases later searches (see MEMORY_REWARD_WEIGHT). Source documents that no
+// longer exist are skipped.
+func (m *LongTermMemory) RecordProposalReward(ctx context.Context, outcome ProposalOutcome) (*StoreResult, error) {
+	if outcome.ProposalID == "" {
+		return nil, fmt.Errorf("%w: proposal id is required", ErrInvalidMemoryRequest)
+	}
+	if outcome.Reward < 0 || outcome.Reward > 1 {
+		return nil, fmt.Errorf("%w: reward must be between 0 and 1", ErrInvalidMemoryRequest)
+	}
+
+	for _, id := range outcome.MemoryIDs {
+		if err := m.RecordReward(ctx, id, outcome.Reward); err != nil {
+			if errors.Is(err, ErrDocumentNotFound) {
+				logging.FromContext(ctx).Warn("proposal source no longer in memory", "proposal_id", outcome.ProposalID, "document_id", id)
+				continue
+			}
+			return nil, fmt.Errorf("failed to reward source %s: %w", id, err)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Proposal: %s\nComponent: %s\n", outcome.ProposalID, outcome.Component)
+	if outcome.Strategy != "" {
+		fmt.Fprintf(&b, "Strategy: %s\n", outcome.Strategy)
+	}
+	fmt.Fprintf(&b, "Description: %s\nReward: %.2f\n", outcome.Description, outcome.Reward)
+	if outcome.Feedback != "" {
+		fmt.Fprintf(&b, "Feedback: %s\n", outcome.Feedback)
+	}
+
+	// Re-rewarding a proposal replaces its precedent rather than adding another
+	result, err := m.Upsert(ctx, b.String(), map[string]interface{}{
+		"type":         "proposal_reward",
+		"doc_id":       "proposal_reward:" + outcome.ProposalID,
+		"merge_policy": string(MergeReplace),
+		"proposal_id":  outcome.ProposalID,
+		"component":    outcome.Component,
+		"strategy":     outcome.Strategy,
+		"reward":       outcome.Reward,
+		"memory_ids":   outcome.MemoryIDs,
+		"timestamp":    time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store proposal reward: %w", err)
+	}
+
+	if err := m.RecordReward(ctx, result.DocumentID, outcome.Reward); err != nil {
+		return nil, fmt.Errorf("failed to reward proposal precedent: %w", err)
+	}
+
+	return result, nil
+}
+
+// rewardScore shifts a similarity score by the document's reward relative to
+// neutral, so precedents with good outcomes outrank equally similar ones with
+// bad outcomes. Documents without feedback are unchanged.
+func (m *LongTermMemory) rewardScore(record *documentRecord, score float64) float64 {
+	if m.rewardWeight == 0 || record.Feedback == 0 {
+		return score
+	}
+	return score + m.rewardWeight*(record.Reward-neutralReward)
+}
+
+// sortHitsByScore orders hits by score, highest first, keeping ties in order
+func sortHitsByScore(hits []MemoryHit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+}
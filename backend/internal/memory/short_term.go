@@ -1,29 +1,62 @@
 package memory
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// ErrTaskNotFound is returned when a task has no short-term memory
+var ErrTaskNotFound = errors.New("task not found")
+
 // ShortTermMemory manages task-specific short-term memory
 type ShortTermMemory struct {
-	tasks map[string]*TaskMemory
-	mu    sync.RWMutex
+	tasks        map[string]*TaskMemory
+	blobs        BlobStore
+	embedder     TextEmbedder
+	store        *SnapshotStore
+	stopCh       chan struct{}
+	doneCh       chan struct{}
+	janitorStop  chan struct{}
+	janitorStats JanitorStats
+	mu           sync.RWMutex
 }
 
+// Task execution states recorded in TaskMemory.Status
+const (
+	TaskStatusRunning     = "running"
+	TaskStatusCompleted   = "completed"
+	TaskStatusFailed      = "failed"
+	TaskStatusInterrupted = "interrupted"
+	TaskStatusCancelled   = "cancelled"
+)
+
 // TaskMemory stores memory for a specific task
 type TaskMemory struct {
-	TaskID       string
-	Perceptions  []Perception
-	Reasoning    []ReasoningBranch
-	Actions      []Action
-	Reflections  []Reflection
-	Screenshots  []Screenshot
-	Context      map[string]interface{}
-	CreatedAt    time.Time
-	LastAccessed time.Time
-	mu           sync.RWMutex
+	TaskID          string
+	Workspace       string // the workspace the task's memory is scoped to
+	Status          string
+	Goal            string
+	Plan            json.RawMessage // serialized plan, used to resume after a crash
+	CompletedSteps  int
+	ConsolidatedAt  time.Time // zero until promoted to long-term memory
+	Perceptions     []Perception
+	Reasoning       []ReasoningBranch
+	Actions         []Action
+	Reflections     []Reflection
+	Screenshots     []Screenshot
+	Context         map[string]interface{}
+	CreatedAt       time.Time
+	LastAccessed    time.Time
+	blobs           BlobStore
+	embedder        TextEmbedder
+	embeddings      map[string][]float64 // unit-length, lazily computed by Search, keyed by entry ID
+	contextVersion  uint64               // bumped on every context write
+	contextVersions map[string]uint64    // version of each key's last write
+	subscribers     map[*contextSubscriber]bool
+	mu              sync.RWMutex
 }
 
 // Perception represents a perception event
@@ -72,7 +105,8 @@ type Reflection struct {
 type Screenshot struct {
 	ID          string
 	Timestamp   time.Time
-	Data        []byte
+	BlobID      string // content hash of the image in the blob store
+	Size        int
 	Elements    []interface{}
 	Analysis    map[string]interface{}
 }
@@ -81,16 +115,46 @@ type Screenshot struct {
 func NewShortTermMemory() *ShortTermMemory {
 	return &ShortTermMemory{
 		tasks: make(map[string]*TaskMemory),
+		blobs: NewMemoryBlobStore(),
+	}
+}
+
+// SetBlobStore sets where screenshot bytes are stored; call before tasks are created
+func (m *ShortTermMemory) SetBlobStore(store BlobStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.blobs = store
+	for _, task := range m.tasks {
+		task.mu.Lock()
+		task.blobs = store
+		task.mu.Unlock()
 	}
 }
 
-// CreateTask creates a new task memory
+// LoadScreenshot returns the image bytes for a screenshot blob ID
+func (m *ShortTermMemory) LoadScreenshot(blobID string) ([]byte, error) {
+	m.mu.RLock()
+	store := m.blobs
+	m.mu.RUnlock()
+
+	return store.Get(blobID)
+}
+
+// CreateTask creates a new task memory in the default workspace
 func (m *ShortTermMemory) CreateTask(taskID string) *TaskMemory {
+	return m.CreateTaskIn(DefaultWorkspace, taskID)
+}
+
+// CreateTaskIn creates a new task memory in a workspace
+func (m *ShortTermMemory) CreateTaskIn(workspace, taskID string) *TaskMemory {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	task := &TaskMemory{
 		TaskID:       taskID,
+		Workspace:    workspace,
+		Status:       TaskStatusRunning,
 		Perceptions:  make([]Perception, 0),
 		Reasoning:    make([]ReasoningBranch, 0),
 		Actions:      make([]Action, 0),
@@ -99,6 +163,8 @@ func (m *ShortTermMemory) CreateTask(taskID string) *TaskMemory {
 		Context:      make(map[string]interface{}),
 		CreatedAt:    time.Now(),
 		LastAccessed: time.Now(),
+		blobs:        m.blobs,
+		embedder:     m.embedder,
 	}
 
 	m.tasks[taskID] = task
@@ -112,7 +178,7 @@ func (m *ShortTermMemory) GetTask(taskID string) (*TaskMemory, error) {
 
 	task, exists := m.tasks[taskID]
 	if !exists {
-		return nil, fmt.Errorf("task %s not found", taskID)
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
 	}
 
 	task.LastAccessed = time.Now()
@@ -129,6 +195,37 @@ func (m *ShortTermMemory) GetOrCreateTask(taskID string) *TaskMemory {
 	return m.CreateTask(taskID)
 }
 
+// GetTaskIn retrieves a task memory if it belongs to workspace; tasks of other
+// workspaces are reported as not found
+func (m *ShortTermMemory) GetTaskIn(workspace, taskID string) (*TaskMemory, error) {
+	task, err := m.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Workspace != workspace {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+
+	return task, nil
+}
+
+// GetOrCreateTaskIn gets or creates a task memory in workspace. Task IDs are
+// unique across workspaces, so an ID taken by another workspace is an error.
+func (m *ShortTermMemory) GetOrCreateTaskIn(workspace, taskID string) (*TaskMemory, error) {
+	m.mu.RLock()
+	task, exists := m.tasks[taskID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return m.CreateTaskIn(workspace, taskID), nil
+	}
+	if task.Workspace != workspace {
+		return nil, fmt.Errorf("%w: %s", ErrTaskExists, taskID)
+	}
+
+	return m.GetTask(taskID)
+}
+
 // DeleteTask deletes a task memory
 func (m *ShortTermMemory) DeleteTask(taskID string) error {
 	m.mu.Lock()
@@ -138,7 +235,11 @@ func (m *ShortTermMemory) DeleteTask(taskID string) error {
 		return fmt.Errorf("task %s not found", taskID)
 	}
 
+	removed := m.tasks[taskID]
 	delete(m.tasks, taskID)
+	m.deleteSnapshots(taskID)
+	m.releaseBlobs(removed)
+	closeTaskSubscriptions(removed)
 	return nil
 }
 
@@ -179,21 +280,149 @@ func (m *ShortTermMemory) CleanupOldTasks(maxAge time.Duration) int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	count := 0
 	cutoff := time.Now().Add(-maxAge)
+	removed := make([]string, 0)
+	removedTasks := make([]*TaskMemory, 0)
 
 	for id, task := range m.tasks {
 		if task.LastAccessed.Before(cutoff) {
 			delete(m.tasks, id)
-			count++
+			removed = append(removed, id)
+			removedTasks = append(removedTasks, task)
+		}
+	}
+
+	m.deleteSnapshots(removed...)
+	m.releaseBlobs(removedTasks...)
+	closeTaskSubscriptions(removedTasks...)
+	return len(removed)
+}
+
+// Tasks returns all task memories without updating their access time
+func (m *ShortTermMemory) Tasks() []*TaskMemory {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tasks := make([]*TaskMemory, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		tasks = append(tasks, task)
+	}
+
+	return tasks
+}
+
+// InterruptedTasks returns the IDs of tasks restored mid-execution
+func (m *ShortTermMemory) InterruptedTasks() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0)
+	for id, task := range m.tasks {
+		if task.GetStatus() == TaskStatusInterrupted {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// releaseBlobs deletes screenshot blobs of removed tasks that no remaining
+// task references; callers must hold m.mu
+func (m *ShortTermMemory) releaseBlobs(removed ...*TaskMemory) {
+	candidates := make(map[string]bool)
+	for _, task := range removed {
+		for _, screenshot := range task.GetScreenshots() {
+			candidates[screenshot.BlobID] = true
 		}
 	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	for _, task := range m.tasks {
+		for _, screenshot := range task.GetScreenshots() {
+			delete(candidates, screenshot.BlobID)
+		}
+	}
+
+	for id := range candidates {
+		if err := m.blobs.Delete(id); err != nil {
+			fmt.Printf("Warning: failed to delete screenshot blob %s: %v\n", id, err)
+		}
+	}
+}
+
+// deleteSnapshots removes persisted snapshots; callers must hold m.mu
+func (m *ShortTermMemory) deleteSnapshots(taskIDs ...string) {
+	if m.store == nil || len(taskIDs) == 0 {
+		return
+	}
 
-	return count
+	if err := m.store.Delete(taskIDs...); err != nil {
+		fmt.Printf("Warning: failed to delete task snapshots: %v\n", err)
+	}
 }
 
 // TaskMemory methods
 
+// SetStatus sets the task's execution status
+func (t *TaskMemory) SetStatus(status string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Status = status
+}
+
+// GetStatus returns the task's execution status
+func (t *TaskMemory) GetStatus() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.Status
+}
+
+// SetPlan records the goal and serialized plan being executed
+func (t *TaskMemory) SetPlan(goal string, plan json.RawMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Goal = goal
+	t.Plan = plan
+	t.CompletedSteps = 0
+}
+
+// GetPlan returns the goal, serialized plan and number of completed steps
+func (t *TaskMemory) GetPlan() (string, json.RawMessage, int) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.Goal, t.Plan, t.CompletedSteps
+}
+
+// MarkConsolidated records that the task was promoted to long-term memory
+func (t *TaskMemory) MarkConsolidated() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.ConsolidatedAt = time.Now()
+}
+
+// IsConsolidated reports whether the task was promoted to long-term memory
+func (t *TaskMemory) IsConsolidated() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return !t.ConsolidatedAt.IsZero()
+}
+
+// MarkStepCompleted advances the resume point past one plan step
+func (t *TaskMemory) MarkStepCompleted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.CompletedSteps++
+}
+
 // AddPerception adds a perception to task memory
 func (t *TaskMemory) AddPerception(perceptionType string, content interface{}, analysis map[string]interface{}) string {
 	t.mu.Lock()
@@ -276,23 +505,38 @@ func (t *TaskMemory) AddReflection(actionID, critique string, lessons, nextSteps
 	return id
 }
 
-// AddScreenshot adds a screenshot
-func (t *TaskMemory) AddScreenshot(data []byte, elements []interface{}, analysis map[string]interface{}) string {
+// AddScreenshot writes the image to the blob store and records a reference to it
+func (t *TaskMemory) AddScreenshot(data []byte, elements []interface{}, analysis map[string]interface{}) (string, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	blobID, err := t.blobs.Put(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to store screenshot: %w", err)
+	}
+
 	id := fmt.Sprintf("screenshot_%d", time.Now().UnixNano())
-	
+
 	screenshot := Screenshot{
 		ID:        id,
 		Timestamp: time.Now(),
-		Data:      data,
+		BlobID:    blobID,
+		Size:      len(data),
 		Elements:  elements,
 		Analysis:  analysis,
 	}
 
 	t.Screenshots = append(t.Screenshots, screenshot)
-	return id
+	return id, nil
+}
+
+// LoadScreenshot returns the image bytes of a screenshot recorded on this task
+func (t *TaskMemory) LoadScreenshot(screenshot *Screenshot) ([]byte, error) {
+	t.mu.RLock()
+	store := t.blobs
+	t.mu.RUnlock()
+
+	return store.Get(screenshot.BlobID)
 }
 
 // GetPerceptions returns all perceptions
@@ -358,12 +602,12 @@ func (t *TaskMemory) GetLatestScreenshot() (*Screenshot, error) {
 	return &screenshot, nil
 }
 
-// SetContext sets a context value
+// SetContext sets a context value and notifies subscribers
 func (t *TaskMemory) SetContext(key string, value interface{}) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.Context[key] = value
+	t.setContextLocked(key, value)
 }
 
 // GetContext gets a context value
@@ -382,6 +626,9 @@ func (t *TaskMemory) GetSummary() map[string]interface{} {
 
 	return map[string]interface{}{
 		"task_id":          t.TaskID,
+		"workspace":        t.Workspace,
+		"status":           t.Status,
+		"completed_steps":  t.CompletedSteps,
 		"perceptions":      len(t.Perceptions),
 		"reasoning":        len(t.Reasoning),
 		"actions":          len(t.Actions),
@@ -404,6 +651,7 @@ func (t *TaskMemory) ExportTrace() map[string]interface{} {
 		"reasoning":   t.Reasoning,
 		"actions":     t.Actions,
 		"reflections": t.Reflections,
+		"screenshots": t.Screenshots,
 		"context":     t.Context,
 		"created_at":  t.CreatedAt.Format(time.RFC3339),
 		"duration":    time.Since(t.CreatedAt).Seconds(),
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+)
+
+// SimilarityMatch is a candidate index scored by cosine similarity
+type SimilarityMatch struct {
+	Index int
+	Score float64
+}
+
+// Normalize returns a unit-length copy of v, so cosine similarity against
+// other unit vectors is a plain dot product. A zero vector stays zero.
+func Normalize(v []float64) []float64 {
+	unit := make([]float64, len(v))
+	norm := math.Sqrt(dot(v, v))
+	if norm == 0 {
+		return unit
+	}
+
+	inv := 1 / norm
+	for i, x := range v {
+		unit[i] = x * inv
+	}
+	return unit
+}
+
+// dot computes the dot product of equal-length vectors. Four independent
+// accumulators break the add dependency chain so the loop pipelines well.
+func dot(a, b []float64) float64 {
+	b = b[:len(a)] // one bounds check for the whole loop
+
+	var s0, s1, s2, s3 float64
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+
+	return (s0 + s1) + (s2 + s3)
+}
+
+// BatchCosineSimilarity scores every candidate against query, writing into
+// dst when it has room so repeated scans don't allocate. The query norm is
+// computed once; candidates of the wrong length score 0.
+func BatchCosineSimilarity(query []float64, candidates [][]float64, dst []float64) []float64 {
+	if cap(dst) < len(candidates) {
+		dst = make([]float64, len(candidates))
+	}
+	dst = dst[:len(candidates)]
+
+	queryNorm := math.Sqrt(dot(query, query))
+	for i, candidate := range candidates {
+		dst[i] = 0
+		if queryNorm == 0 || len(candidate) != len(query) {
+			continue
+		}
+		if norm := math.Sqrt(dot(candidate, candidate)); norm != 0 {
+			dst[i] = dot(query, candidate) / (queryNorm * norm)
+		}
+	}
+
+	return dst
+}
+
+// BatchDot scores unit-length candidates against a unit-length query, as
+// cached by Normalize; candidates of the wrong length score 0
+func BatchDot(query []float64, candidates [][]float64, dst []float64) []float64 {
+	if cap(dst) < len(candidates) {
+		dst = make([]float64, len(candidates))
+	}
+	dst = dst[:len(candidates)]
+
+	for i, candidate := range candidates {
+		dst[i] = 0
+		if len(candidate) == len(query) {
+			dst[i] = dot(query, candidate)
+		}
+	}
+
+	return dst
+}
+
+// TopK returns the k highest scores, best first, keeping a k-sized min-heap
+// instead of sorting every candidate. Equal scores keep the lower index first.
+func TopK(scores []float64, k int) []SimilarityMatch {
+	if k <= 0 || len(scores) == 0 {
+		return []SimilarityMatch{}
+	}
+	if k > len(scores) {
+		k = len(scores)
+	}
+
+	h := make(matchHeap, 0, k)
+	for i, score := range scores {
+		if len(h) < k {
+			heap.Push(&h, SimilarityMatch{Index: i, Score: score})
+		} else if score > h[0].Score {
+			h[0] = SimilarityMatch{Index: i, Score: score}
+			heap.Fix(&h, 0)
+		}
+	}
+
+	matches := make([]SimilarityMatch, len(h))
+	for i := len(matches) - 1; i >= 0; i-- {
+		matches[i] = heap.Pop(&h).(SimilarityMatch)
+	}
+	return matches
+}
+
+// FindTopKSimilar returns the k candidates most similar to query, best first
+func FindTopKSimilar(query []float64, candidates [][]float64, k int) ([]SimilarityMatch, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates provided")
+	}
+
+	return TopK(BatchCosineSimilarity(query, candidates, nil), k), nil
+}
+
+// matchHeap is a min-heap on score; on ties the higher index is evicted first
+type matchHeap []SimilarityMatch
+
+func (h matchHeap) Len() int { return len(h) }
+func (h matchHeap) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score < h[j].Score
+	}
+	return h[i].Index > h[j].Index
+}
+func (h matchHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(SimilarityMatch)) }
+
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,318 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// snapshotBucket holds one JSON-encoded TaskMemory per task ID
+var snapshotBucket = []byte("task_snapshots")
+
+// SnapshotStore persists TaskMemory snapshots in BoltDB
+type SnapshotStore struct {
+	db *bolt.DB
+}
+
+// taskSnapshot is the serialized form of a TaskMemory
+type taskSnapshot struct {
+	TaskID          string                 `json:"task_id"`
+	Workspace       string                 `json:"workspace,omitempty"`
+	Status          string                 `json:"status"`
+	Goal            string                 `json:"goal"`
+	Plan            json.RawMessage        `json:"plan,omitempty"`
+	CompletedSteps  int                    `json:"completed_steps"`
+	ConsolidatedAt  time.Time              `json:"consolidated_at"`
+	Perceptions     []Perception           `json:"perceptions"`
+	Reasoning       []ReasoningBranch      `json:"reasoning"`
+	Actions         []Action               `json:"actions"`
+	Reflections     []Reflection           `json:"reflections"`
+	Screenshots     []Screenshot           `json:"screenshots"`
+	Context         map[string]interface{} `json:"context"`
+	ContextVersions map[string]uint64      `json:"context_versions,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	LastAccessed    time.Time              `json:"last_accessed"`
+	SnapshotAt      time.Time              `json:"snapshot_at"`
+}
+
+// NewSnapshotStore opens (or creates) the snapshot database at path
+func NewSnapshotStore(path string) (*SnapshotStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(snapshotBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create snapshot bucket: %w", err)
+	}
+
+	return &SnapshotStore{db: db}, nil
+}
+
+// NewSnapshotStoreFromEnv opens the store at SHORT_TERM_SNAPSHOT_PATH
+func NewSnapshotStoreFromEnv() (*SnapshotStore, error) {
+	return NewSnapshotStore(getEnv("SHORT_TERM_SNAPSHOT_PATH", "./data/short_term.db"))
+}
+
+// SnapshotIntervalFromEnv returns SHORT_TERM_SNAPSHOT_INTERVAL_SECONDS (default 15s)
+func SnapshotIntervalFromEnv() time.Duration {
+	return time.Duration(getEnvInt("SHORT_TERM_SNAPSHOT_INTERVAL_SECONDS", 15)) * time.Second
+}
+
+// Save writes encoded snapshots, keyed by task ID, in a single transaction
+func (s *SnapshotStore) Save(snapshots map[string][]byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotBucket)
+		for id, data := range snapshots {
+			if err := bucket.Put([]byte(id), data); err != nil {
+				return fmt.Errorf("failed to store task %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes the snapshots for the given task IDs
+func (s *SnapshotStore) Delete(taskIDs ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotBucket)
+		for _, id := range taskIDs {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return fmt.Errorf("failed to delete task %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Load reads every stored snapshot, skipping entries that fail to decode
+func (s *SnapshotStore) Load() ([]*taskSnapshot, error) {
+	snapshots := make([]*taskSnapshot, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotBucket).ForEach(func(k, v []byte) error {
+			var snapshot taskSnapshot
+			if err := json.Unmarshal(v, &snapshot); err != nil {
+				slog.Warn("skipping corrupt snapshot", "task_id", string(k), "error", err)
+				return nil
+			}
+			snapshots = append(snapshots, &snapshot)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// Close closes the snapshot database
+func (s *SnapshotStore) Close() error {
+	return s.db.Close()
+}
+
+// EnableSnapshots restores persisted tasks and snapshots all tasks every interval.
+// Tasks that were still running when the process stopped are marked "interrupted".
+func (m *ShortTermMemory) EnableSnapshots(store *SnapshotStore, interval time.Duration) (int, error) {
+	restored, err := m.restore(store)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	m.store = store
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+	m.mu.Unlock()
+
+	go m.snapshotLoop(interval)
+
+	return restored, nil
+}
+
+// StopSnapshots stops the snapshot loop, writes a final snapshot and closes the store
+func (m *ShortTermMemory) StopSnapshots() error {
+	m.mu.Lock()
+	store := m.store
+	stopCh, doneCh := m.stopCh, m.doneCh
+	m.store = nil
+	m.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	close(stopCh)
+	<-doneCh
+
+	if err := m.snapshotTo(store); err != nil {
+		store.Close()
+		return err
+	}
+
+	return store.Close()
+}
+
+// Snapshot persists every task immediately
+func (m *ShortTermMemory) Snapshot() error {
+	m.mu.RLock()
+	store := m.store
+	m.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	return m.snapshotTo(store)
+}
+
+func (m *ShortTermMemory) snapshotTo(store *SnapshotStore) error {
+	m.mu.RLock()
+	snapshots := make(map[string][]byte, len(m.tasks))
+	for id, task := range m.tasks {
+		data, err := task.snapshot()
+		if err != nil {
+			m.mu.RUnlock()
+			return fmt.Errorf("failed to marshal task %s: %w", id, err)
+		}
+		snapshots[id] = data
+	}
+	m.mu.RUnlock()
+
+	return store.Save(snapshots)
+}
+
+func (m *ShortTermMemory) snapshotLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(m.doneCh)
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			if err := m.Snapshot(); err != nil {
+				slog.Warn("failed to snapshot short-term memory", "error", err)
+			}
+		}
+	}
+}
+
+// restore loads persisted tasks into memory
+func (m *ShortTermMemory) restore(store *SnapshotStore) (int, error) {
+	snapshots, err := store.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, snapshot := range snapshots {
+		task := taskFromSnapshot(snapshot)
+		task.blobs = m.blobs
+		task.embedder = m.embedder
+		if task.Status == TaskStatusRunning {
+			task.Status = TaskStatusInterrupted
+		}
+		m.tasks[task.TaskID] = task
+	}
+
+	return len(snapshots), nil
+}
+
+// snapshot encodes the task's current state; encoding happens under the
+// task lock because Context and result maps are shared with writers
+func (t *TaskMemory) snapshot() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return json.Marshal(&taskSnapshot{
+		TaskID:          t.TaskID,
+		Workspace:       t.Workspace,
+		Status:          t.Status,
+		Goal:            t.Goal,
+		Plan:            t.Plan,
+		CompletedSteps:  t.CompletedSteps,
+		ConsolidatedAt:  t.ConsolidatedAt,
+		Perceptions:     t.Perceptions,
+		Reasoning:       t.Reasoning,
+		Actions:         t.Actions,
+		Reflections:     t.Reflections,
+		Screenshots:     t.Screenshots,
+		Context:         t.Context,
+		ContextVersions: t.contextVersions,
+		CreatedAt:       t.CreatedAt,
+		LastAccessed:    t.LastAccessed,
+		SnapshotAt:      time.Now(),
+	})
+}
+
+func taskFromSnapshot(s *taskSnapshot) *TaskMemory {
+	task := &TaskMemory{
+		TaskID:          s.TaskID,
+		Workspace:       s.Workspace,
+		Status:          s.Status,
+		Goal:            s.Goal,
+		Plan:            s.Plan,
+		CompletedSteps:  s.CompletedSteps,
+		ConsolidatedAt:  s.ConsolidatedAt,
+		Perceptions:     s.Perceptions,
+		Reasoning:       s.Reasoning,
+		Actions:         s.Actions,
+		Reflections:     s.Reflections,
+		Screenshots:     s.Screenshots,
+		Context:         s.Context,
+		CreatedAt:       s.CreatedAt,
+		LastAccessed:    s.LastAccessed,
+		contextVersions: s.ContextVersions,
+	}
+
+	// Tasks snapshotted before workspaces existed belong to the default one
+	if task.Workspace == "" {
+		task.Workspace = DefaultWorkspace
+	}
+
+	// Resume versioning past the newest restored write
+	for _, version := range task.contextVersions {
+		task.contextVersion = max(task.contextVersion, version)
+	}
+
+	// Snapshots of never-populated fields decode as nil
+	if task.Perceptions == nil {
+		task.Perceptions = make([]Perception, 0)
+	}
+	if task.Reasoning == nil {
+		task.Reasoning = make([]ReasoningBranch, 0)
+	}
+	if task.Actions == nil {
+		task.Actions = make([]Action, 0)
+	}
+	if task.Reflections == nil {
+		task.Reflections = make([]Reflection, 0)
+	}
+	if task.Screenshots == nil {
+		task.Screenshots = make([]Screenshot, 0)
+	}
+	if task.Context == nil {
+		task.Context = make(map[string]interface{})
+	}
+
+	return task
+}
@@ -0,0 +1,495 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+// ErrInvalidMemoryRequest is returned for malformed store and query requests
+var ErrInvalidMemoryRequest = errors.New("invalid memory request")
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// longTermTypes are stored in LightRAG; shortTermTypes are appended to a task
+var (
+	longTermTypes  = map[string]bool{"conversation": true, "code": true, "concept": true, "action": true, "task_archive": true, "procedure": true, "documentation": true}
+	shortTermTypes = map[string]bool{"perception": true, "reflection": true}
+)
+
+// System combines long-term and short-term memory behind one API
+type System struct {
+	LongTerm  *LongTermMemory
+	ShortTerm *ShortTermMemory
+}
+
+// NewSystem creates a combined memory system
+func NewSystem(longTerm *LongTermMemory, shortTerm *ShortTermMemory) *System {
+	return &System{
+		LongTerm:  longTerm,
+		ShortTerm: shortTerm,
+	}
+}
+
+// Store routes a store request to short-term (task-scoped types) or long-term memory
+func (s *System) Store(ctx context.Context, req models.MemoryStoreRequest) (map[string]interface{}, error) {
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidMemoryRequest)
+	}
+
+	metadata := make(map[string]interface{}, len(req.Metadata)+2)
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	metadata["type"] = req.Type
+
+	switch {
+	case shortTermTypes[req.Type]:
+		if req.TaskID == "" {
+			return nil, fmt.Errorf("%w: %s requires task_id", ErrInvalidMemoryRequest, req.Type)
+		}
+
+		workspace, err := workspaceOf(ctx)
+		if err != nil {
+			return nil, err
+		}
+		task, err := s.ShortTerm.GetOrCreateTaskIn(workspace, req.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		var id string
+		if req.Type == "perception" {
+			id = task.AddPerception("text", req.Content, metadata)
+		} else {
+			actionID, _ := metadata["action_id"].(string)
+			id = task.AddReflection(actionID, req.Content, []string{}, []string{})
+		}
+
+		return map[string]interface{}{
+			"success": true,
+			"stored":  "short_term",
+			"task_id": req.TaskID,
+			"id":      id,
+		}, nil
+
+	case longTermTypes[req.Type]:
+		if req.TaskID != "" {
+			metadata["task_id"] = req.TaskID
+		}
+		metadata["timestamp"] = time.Now().Format(time.RFC3339)
+
+		if req.MergePolicy != "" {
+			if _, err := ParseMergePolicy(req.MergePolicy); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidMemoryRequest, err)
+			}
+			metadata["merge_policy"] = req.MergePolicy
+		}
+
+		result, err := s.LongTerm.Upsert(ctx, req.Content, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{
+			"success":     true,
+			"stored":      "long_term",
+			"action":      result.Action,
+			"document_id": result.DocumentID,
+			"version":     result.Version,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidMemoryRequest, req.Type)
+	}
+}
+
+// Query searches one task's short-term memory when TaskID is set, otherwise
+// long-term documents of the kinds selected by Mode, narrowed by the optional
+// metadata filter
+func (s *System) Query(ctx context.Context, req models.MemoryQueryRequest) (*models.MemoryQueryResponse, error) {
+	offset, limit := normalizePage(req.Offset, req.Limit)
+
+	ragMode, kinds, err := ParseQueryMode(req.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMemoryRequest, err)
+	}
+
+	if req.TaskID != "" {
+		// A task's trace is episodic memory by definition
+		if len(kinds) > 0 && !containsKind(kinds, KindEpisodic) {
+			return nil, fmt.Errorf("%w: task_id searches episodic memory", ErrInvalidMemoryRequest)
+		}
+
+		task, err := s.taskOf(ctx, req.TaskID)
+		if err != nil {
+			return nil, err
+		}
+
+		results, err := searchTask(ctx, task, req.Query, req.Kinds)
+		if err != nil {
+			return nil, err
+		}
+		return &models.MemoryQueryResponse{
+			Results: paginate(results, offset, limit),
+			Total:   len(results),
+			Offset:  offset,
+			Limit:   limit,
+			HasMore: offset+limit < len(results),
+		}, nil
+	}
+
+	if strings.TrimSpace(req.Query) == "" && req.Filter == nil {
+		return nil, fmt.Errorf("%w: query or filter is required", ErrInvalidMemoryRequest)
+	}
+
+	filter := memoryFilter(req.Filter)
+	filter.Kinds = kinds
+
+	// Fetch one extra hit to know whether another page exists
+	search := s.LongTerm.Search
+	if req.IncludeCode {
+		search = s.LongTerm.FederatedSearch
+	}
+	hits, err := search(ctx, req.Query, filter, offset+limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.MemoryResult, len(hits))
+	for i, hit := range hits {
+		source := "long_term"
+		if hit.Source != "" {
+			source = hit.Source
+		}
+
+		var timestamp *time.Time
+		if !hit.StoredAt.IsZero() {
+			storedAt := hit.StoredAt
+			timestamp = &storedAt
+		}
+
+		results[i] = models.MemoryResult{
+			Source:    source,
+			Kind:      string(hit.Kind),
+			ID:        hit.ID,
+			Content:   hit.Content,
+			Timestamp: timestamp,
+			Score:     hit.Score,
+			Metadata:  hit.Metadata,
+		}
+	}
+
+	resp := &models.MemoryQueryResponse{
+		Results: paginate(results, offset, limit),
+		Offset:  offset,
+		Limit:   limit,
+		HasMore: len(results) > offset+limit,
+	}
+
+	// LightRAG's graph spans every kind, so the answer is not kind-restricted
+	if ragMode != "" && strings.TrimSpace(req.Query) != "" {
+		answer, err := s.LongTerm.QueryWithMode(ctx, req.Query, ragMode)
+		if err != nil {
+			return nil, err
+		}
+		resp.Answer = answer
+	}
+
+	return resp, nil
+}
+
+// Delete forgets the long-term documents matching a non-empty filter
+func (s *System) Delete(ctx context.Context, req models.MemoryDeleteRequest) (map[string]interface{}, error) {
+	filter := memoryFilter(&req.Filter)
+	if filter.empty() {
+		return nil, fmt.Errorf("%w: filter is required", ErrInvalidMemoryRequest)
+	}
+
+	deleted, err := s.LongTerm.DeleteByFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"deleted": deleted,
+	}, nil
+}
+
+// Feedback records how useful a long-term document was, raising or lowering its retention importance
+func (s *System) Feedback(ctx context.Context, req models.MemoryFeedbackRequest) (map[string]interface{}, error) {
+	if req.DocumentID == "" {
+		return nil, fmt.Errorf("%w: document_id is required", ErrInvalidMemoryRequest)
+	}
+	if req.Reward < 0 || req.Reward > 1 {
+		return nil, fmt.Errorf("%w: reward must be between 0 and 1", ErrInvalidMemoryRequest)
+	}
+
+	if err := s.LongTerm.RecordReward(ctx, req.DocumentID, req.Reward); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"success": true,
+	}, nil
+}
+
+// Graph exports the knowledge graph neighborhood around a node or query
+func (s *System) Graph(ctx context.Context, req models.MemoryGraphRequest) (*GraphNeighborhood, error) {
+	node := strings.TrimSpace(req.Node)
+	query := strings.TrimSpace(req.Query)
+	if node == "" && query == "" {
+		return nil, fmt.Errorf("%w: node or query is required", ErrInvalidMemoryRequest)
+	}
+	if req.Depth < 0 || req.Limit < 0 {
+		return nil, fmt.Errorf("%w: depth and limit must not be negative", ErrInvalidMemoryRequest)
+	}
+
+	return s.LongTerm.Neighborhood(ctx, node, query, req.Depth, req.Limit)
+}
+
+// ListTasks returns the workspace's task summaries, newest first, optionally
+// filtered by status
+func (s *System) ListTasks(ctx context.Context, req models.MemoryTaskListRequest) (*models.MemoryTaskListResponse, error) {
+	workspace, err := workspaceOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	offset, limit := normalizePage(req.Offset, req.Limit)
+
+	tasks := s.ShortTerm.Tasks()
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.After(tasks[j].CreatedAt)
+	})
+
+	summaries := make([]map[string]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		if task.Workspace != workspace {
+			continue
+		}
+		if req.Status != "" && task.GetStatus() != req.Status {
+			continue
+		}
+		summaries = append(summaries, task.GetSummary())
+	}
+
+	return &models.MemoryTaskListResponse{
+		Tasks:  paginate(summaries, offset, limit),
+		Total:  len(summaries),
+		Offset: offset,
+		Limit:  limit,
+	}, nil
+}
+
+// GetTask returns a task's summary and full trace
+func (s *System) GetTask(ctx context.Context, taskID string) (map[string]interface{}, error) {
+	task, err := s.taskOf(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"summary": task.GetSummary(),
+		"trace":   task.ExportTrace(),
+	}, nil
+}
+
+// VectorSearch runs a raw k-nearest-neighbour search over long-term documents
+func (s *System) VectorSearch(ctx context.Context, req models.VectorSearchRequest) (*models.VectorSearchResponse, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, fmt.Errorf("%w: query is required", ErrInvalidMemoryRequest)
+	}
+	offset, topK := normalizePage(req.Offset, req.TopK)
+
+	// Fetch one extra hit to know whether another page exists
+	hits, err := s.LongTerm.VectorSearch(ctx, req.Query, memoryFilter(req.Filter), topK+1, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.VectorSearchResult, 0, min(len(hits), topK))
+	for _, hit := range paginate(hits, 0, topK) {
+		results = append(results, models.VectorSearchResult{
+			ID:       hit.ID,
+			Content:  hit.Content,
+			Score:    hit.Score,
+			Metadata: hit.Metadata,
+		})
+	}
+
+	return &models.VectorSearchResponse{
+		Query:   req.Query,
+		Results: results,
+		Offset:  offset,
+		TopK:    topK,
+		HasMore: len(hits) > topK,
+	}, nil
+}
+
+// ExportTask writes a task's trace bundle, screenshots included, to w
+func (s *System) ExportTask(ctx context.Context, taskID string, w io.Writer) error {
+	task, err := s.taskOf(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	return task.WriteTrace(w)
+}
+
+// ImportTask reconstitutes a task in the workspace from a trace bundle,
+// optionally under a new ID, and returns its summary
+func (s *System) ImportTask(ctx context.Context, r io.Reader, taskID string) (map[string]interface{}, error) {
+	workspace, err := workspaceOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := s.ShortTerm.ImportTrace(r, workspace, taskID, TraceImportMaxBytesFromEnv())
+	if err != nil {
+		return nil, err
+	}
+
+	return task.GetSummary(), nil
+}
+
+// Workspaces lists every workspace holding long-term documents or tasks
+func (s *System) Workspaces() ([]string, error) {
+	names, err := s.LongTerm.Workspaces()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, task := range s.ShortTerm.Tasks() {
+		if !seen[task.Workspace] {
+			seen[task.Workspace] = true
+			names = append(names, task.Workspace)
+		}
+	}
+
+	// Keep the default workspace first
+	sort.Strings(names[1:])
+	return names, nil
+}
+
+// taskOf returns a task of ctx's workspace
+func (s *System) taskOf(ctx context.Context, taskID string) (*TaskMemory, error) {
+	workspace, err := workspaceOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.ShortTerm.GetTaskIn(workspace, taskID)
+}
+
+// Screenshot returns image bytes for a screenshot blob ID
+func (s *System) Screenshot(blobID string) ([]byte, error) {
+	return s.ShortTerm.LoadScreenshot(blobID)
+}
+
+func containsKind(kinds []MemoryKind, kind MemoryKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryFilter converts an API filter to a MemoryFilter
+func memoryFilter(f *models.MemoryQueryFilter) MemoryFilter {
+	if f == nil {
+		return MemoryFilter{}
+	}
+
+	filter := MemoryFilter{
+		Types:          f.Types,
+		FilepathPrefix: f.FilepathPrefix,
+		TaskID:         f.TaskID,
+	}
+	if f.Since != nil {
+		filter.Since = *f.Since
+	}
+	if f.Until != nil {
+		filter.Until = *f.Until
+	}
+
+	return filter
+}
+
+// searchTask ranks a task's entries by relevance to query; an empty query
+// lists every entry in chronological order
+func searchTask(ctx context.Context, task *TaskMemory, query string, kinds []string) ([]models.MemoryResult, error) {
+	var found []TaskSearchResult
+
+	if strings.TrimSpace(query) == "" {
+		for _, entry := range task.entries(kinds) {
+			found = append(found, TaskSearchResult{
+				Kind:      entry.Kind,
+				ID:        entry.ID,
+				Content:   entry.Content,
+				Timestamp: entry.Timestamp,
+			})
+		}
+	} else {
+		var err error
+		found, err = task.Search(ctx, query, kinds, maxPageLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]models.MemoryResult, len(found))
+	for i, r := range found {
+		ts := r.Timestamp
+		results[i] = models.MemoryResult{
+			Source:    "short_term",
+			Kind:      r.Kind,
+			ID:        r.ID,
+			Content:   r.Content,
+			Timestamp: &ts,
+			Score:     r.Score,
+		}
+	}
+
+	return results, nil
+}
+
+// normalizePage applies default and maximum page sizes
+func normalizePage(offset, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return offset, limit
+}
+
+// paginate returns items[offset:offset+limit], clamped to the slice
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[offset:end]
+}
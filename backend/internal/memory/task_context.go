@@ -0,0 +1,213 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// contextSubscriberBuffer is how many changes a slow subscriber may fall behind
+// before the oldest pending ones are dropped
+const contextSubscriberBuffer = 16
+
+var (
+	// ErrContextKeyNotFound is returned when a task context variable is unset
+	ErrContextKeyNotFound = errors.New("context key not found")
+
+	// ErrContextConflict is returned when a context variable changed since the
+	// version a compare-and-set expected
+	ErrContextConflict = errors.New("context version conflict")
+)
+
+// ContextChange is a context variable update delivered to subscribers
+type ContextChange struct {
+	Key       string
+	Value     interface{}
+	Version   uint64
+	Timestamp time.Time
+}
+
+// contextSubscriber receives changes to keys, or to every key when keys is nil
+type contextSubscriber struct {
+	keys map[string]bool
+	ch   chan ContextChange
+}
+
+// GetString returns a context variable as a string
+func (t *TaskMemory) GetString(key string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	value, ok := t.Context[key].(string)
+	return value, ok
+}
+
+// GetInt returns a context variable as an int. Whole floats are accepted since
+// numbers restored from a snapshot decode as float64.
+func (t *TaskMemory) GetInt(key string) (int, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	switch v := t.Context[key].(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt32 {
+			return 0, false
+		}
+		return int(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	default:
+		return 0, false
+	}
+}
+
+// GetJSON decodes a context variable into dst, whatever type it was stored as
+func (t *TaskMemory) GetJSON(key string, dst interface{}) error {
+	// Encode under the lock; stored maps and slices are shared with writers
+	t.mu.RLock()
+	value, exists := t.Context[key]
+	var data []byte
+	var err error
+	if exists {
+		if raw, ok := value.(json.RawMessage); ok {
+			data = raw
+		} else {
+			data, err = json.Marshal(value)
+		}
+	}
+	t.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrContextKeyNotFound, key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode context %s: %w", key, err)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("failed to decode context %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// GetContextVersioned returns a context variable with the version of its last
+// write, for a later CompareAndSetContext. Unset keys are version 0.
+func (t *TaskMemory) GetContextVersioned(key string) (interface{}, uint64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	value, exists := t.Context[key]
+	return value, t.contextVersions[key], exists
+}
+
+// CompareAndSetContext sets a context variable only if it is still at version,
+// returning the new version. Version 0 expects the key to be unset. A stale
+// version fails with ErrContextConflict.
+func (t *TaskMemory) CompareAndSetContext(key string, value interface{}, version uint64) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if current := t.contextVersions[key]; current != version {
+		return current, fmt.Errorf("%w: %s is at version %d, not %d", ErrContextConflict, key, current, version)
+	}
+
+	return t.setContextLocked(key, value), nil
+}
+
+// SubscribeContext delivers changes to the given keys, or to every key when
+// none are given. A subscriber that falls behind loses its oldest pending
+// changes rather than blocking writers; GetContextVersioned has the current
+// value. The channel is closed by cancel or when the task is removed.
+func (t *TaskMemory) SubscribeContext(keys ...string) (<-chan ContextChange, func()) {
+	sub := &contextSubscriber{ch: make(chan ContextChange, contextSubscriberBuffer)}
+	if len(keys) > 0 {
+		sub.keys = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			sub.keys[key] = true
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.subscribers == nil {
+		t.subscribers = make(map[*contextSubscriber]bool)
+	}
+	t.subscribers[sub] = true
+
+	return sub.ch, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.subscribers[sub] {
+			delete(t.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// setContextLocked writes a context variable, bumps its version and notifies
+// subscribers; callers must hold t.mu
+func (t *TaskMemory) setContextLocked(key string, value interface{}) uint64 {
+	if t.contextVersions == nil {
+		t.contextVersions = make(map[string]uint64)
+	}
+	t.contextVersion++
+	t.Context[key] = value
+	t.contextVersions[key] = t.contextVersion
+
+	change := ContextChange{
+		Key:       key,
+		Value:     value,
+		Version:   t.contextVersion,
+		Timestamp: time.Now(),
+	}
+	for sub := range t.subscribers {
+		if sub.keys != nil && !sub.keys[key] {
+			continue
+		}
+		select {
+		case sub.ch <- change:
+			continue
+		default:
+		}
+		// Full: drop the oldest pending change so the newest gets through
+		select {
+		case <-sub.ch:
+		default:
+		}
+		select {
+		case sub.ch <- change:
+		default:
+		}
+	}
+
+	return t.contextVersion
+}
+
+// closeSubscriptions ends every context subscription of a removed task
+func (t *TaskMemory) closeSubscriptions() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for sub := range t.subscribers {
+		close(sub.ch)
+	}
+	t.subscribers = nil
+}
+
+// closeTaskSubscriptions ends the context subscriptions of removed tasks
+func closeTaskSubscriptions(removed ...*TaskMemory) {
+	for _, task := range removed {
+		task.closeSubscriptions()
+	}
+}
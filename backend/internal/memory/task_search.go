@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TextEmbedder turns texts into embeddings; EmbeddingGenerator implements it
+type TextEmbedder interface {
+	GenerateBatch(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// taskEntry is a searchable perception, reasoning, action or reflection
+type taskEntry struct {
+	Kind      string
+	ID        string
+	Content   string
+	Timestamp time.Time
+}
+
+// TaskSearchResult is a task entry ranked by relevance to a query
+type TaskSearchResult struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Score     float64   `json:"score"`
+}
+
+// SetEmbedder sets the embedder used by TaskMemory.Search
+func (m *ShortTermMemory) SetEmbedder(embedder TextEmbedder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.embedder = embedder
+	for _, task := range m.tasks {
+		task.mu.Lock()
+		task.embedder = embedder
+		task.mu.Unlock()
+	}
+}
+
+// Search returns the topK entries most relevant to query. kinds restricts the
+// entry types ("perception", "reasoning", "action", "reflection"); empty means all.
+// Entries are embedded lazily on first search and cached; without an embedder,
+// or if embedding fails, entries are ranked by query term overlap instead.
+func (t *TaskMemory) Search(ctx context.Context, query string, kinds []string, topK int) ([]TaskSearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if topK <= 0 {
+		topK = 5
+	}
+
+	entries := t.entries(kinds)
+	if len(entries) == 0 {
+		return []TaskSearchResult{}, nil
+	}
+
+	scores, err := t.semanticScores(ctx, query, entries)
+	if err != nil {
+		scores = lexicalScores(query, entries)
+	}
+
+	results := make([]TaskSearchResult, len(entries))
+	for i, entry := range entries {
+		results[i] = TaskSearchResult{
+			Kind:      entry.Kind,
+			ID:        entry.ID,
+			Content:   entry.Content,
+			Timestamp: entry.Timestamp,
+			Score:     scores[i],
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results, nil
+}
+
+// FormatSearchResults renders results as prompt-ready lines
+func FormatSearchResults(results []TaskSearchResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&b, "- [%s %s] %s\n", r.Kind, r.Timestamp.Format(time.Kitchen), r.Content)
+	}
+	return b.String()
+}
+
+// semanticScores embeds any uncached entries plus the query and returns cosine similarities
+func (t *TaskMemory) semanticScores(ctx context.Context, query string, entries []taskEntry) ([]float64, error) {
+	t.mu.RLock()
+	embedder := t.embedder
+	missing := make([]taskEntry, 0)
+	for _, entry := range entries {
+		if _, cached := t.embeddings[entry.ID]; !cached {
+			missing = append(missing, entry)
+		}
+	}
+	t.mu.RUnlock()
+
+	if embedder == nil {
+		return nil, fmt.Errorf("no embedder configured")
+	}
+
+	texts := make([]string, 0, len(missing)+1)
+	texts = append(texts, query)
+	for _, entry := range missing {
+		texts = append(texts, entry.Content)
+	}
+
+	// Embed outside the lock; entries are immutable once recorded
+	vectors, err := embedder.GenerateBatch(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed task entries: %w", err)
+	}
+	queryVector := Normalize(vectors[0])
+
+	t.mu.Lock()
+	if t.embeddings == nil {
+		t.embeddings = make(map[string][]float64)
+	}
+	for i, entry := range missing {
+		t.embeddings[entry.ID] = Normalize(vectors[i+1])
+	}
+
+	candidates := make([][]float64, len(entries))
+	for i, entry := range entries {
+		candidates[i] = t.embeddings[entry.ID]
+	}
+	t.mu.Unlock()
+
+	// Cached vectors are unit length, so cosine similarity is a dot product
+	return BatchDot(queryVector, candidates, nil), nil
+}
+
+// lexicalScores scores entries by the fraction of query terms they contain
+func lexicalScores(query string, entries []taskEntry) []float64 {
+	terms := strings.Fields(strings.ToLower(query))
+	scores := make([]float64, len(entries))
+
+	for i, entry := range entries {
+		content := strings.ToLower(entry.Content)
+		matched := 0
+		for _, term := range terms {
+			if strings.Contains(content, term) {
+				matched++
+			}
+		}
+		scores[i] = float64(matched) / float64(len(terms))
+	}
+
+	return scores
+}
+
+// entries returns the task's searchable entries in chronological order
+func (t *TaskMemory) entries(kinds []string) []taskEntry {
+	include := func(kind string) bool {
+		if len(kinds) == 0 {
+			return true
+		}
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	entries := make([]taskEntry, 0)
+
+	if include("perception") {
+		for _, p := range t.Perceptions {
+			entries = append(entries, taskEntry{"perception", p.ID, fmt.Sprintf("%v", p.Content), p.Timestamp})
+		}
+	}
+	if include("reasoning") {
+		for _, r := range t.Reasoning {
+			entries = append(entries, taskEntry{"reasoning", r.ID, r.Response, r.Timestamp})
+		}
+	}
+	if include("action") {
+		for _, a := range t.Actions {
+			content := fmt.Sprintf("%s %s (success: %v)", a.Type, a.Command, a.Success)
+			if a.Error != "" {
+				content += " error: " + a.Error
+			}
+			entries = append(entries, taskEntry{"action", a.ID, content, a.Timestamp})
+		}
+	}
+	if include("reflection") {
+		for _, r := range t.Reflections {
+			content := r.Critique
+			if len(r.Lessons) > 0 {
+				content += " Lessons: " + strings.Join(r.Lessons, "; ")
+			}
+			entries = append(entries, taskEntry{"reflection", r.ID, content, r.Timestamp})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	return entries
+}
@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrTaskExists is returned when an imported trace's task ID is already in use
+var ErrTaskExists = errors.New("task already exists")
+
+// traceBundleVersion is bumped when the bundle layout changes incompatibly
+const traceBundleVersion = 1
+
+// traceBundle is a task's full trace plus the screenshots it references,
+// written as gzip-compressed JSON so it can be attached to a bug report
+type traceBundle struct {
+	Version     int               `json:"version"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	Task        json.RawMessage   `json:"task"`        // a taskSnapshot
+	Attachments map[string][]byte `json:"attachments"` // screenshot bytes by blob ID
+}
+
+// TraceImportMaxBytesFromEnv returns TRACE_IMPORT_MAX_MB (default 64) in bytes,
+// the most an imported bundle may decompress to
+func TraceImportMaxBytesFromEnv() int64 {
+	return int64(getEnvInt("TRACE_IMPORT_MAX_MB", 64)) << 20
+}
+
+// WriteTrace writes the task's trace bundle to w. Screenshots whose blobs are
+// missing are left out; the trace still references them.
+func (t *TaskMemory) WriteTrace(w io.Writer) error {
+	task, err := t.snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	// Read screenshots after the snapshot so every one it references is attached
+	bundle := traceBundle{
+		Version:     traceBundleVersion,
+		ExportedAt:  time.Now(),
+		Task:        task,
+		Attachments: make(map[string][]byte),
+	}
+	for _, screenshot := range t.GetScreenshots() {
+		if _, done := bundle.Attachments[screenshot.BlobID]; done {
+			continue
+		}
+		data, err := t.LoadScreenshot(&screenshot)
+		if err != nil {
+			slog.Warn("exporting task without screenshot", "task_id", t.TaskID, "screenshot_id", screenshot.ID, "error", err)
+			continue
+		}
+		bundle.Attachments[screenshot.BlobID] = data
+	}
+
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(&bundle); err != nil {
+		gz.Close()
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+
+	return nil
+}
+
+// ExportTraceToFile writes the task's trace bundle to path, replacing it atomically
+func (t *TaskMemory) ExportTraceToFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create trace directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create trace file: %w", err)
+	}
+	if err := t.WriteTrace(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write trace file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store trace file: %w", err)
+	}
+
+	return nil
+}
+
+// ImportTrace reconstitutes a task in workspace from a trace bundle, storing
+// its screenshots in the blob store. taskID renames the task; empty keeps the
+// exported ID. Imported tasks that were running are marked interrupted, and
+// an ID already in use fails with ErrTaskExists. At most maxBytes are
+// decompressed; zero means no limit.
+func (m *ShortTermMemory) ImportTrace(r io.Reader, workspace, taskID string, maxBytes int64) (*TaskMemory, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: trace is not gzip-compressed: %v", ErrInvalidMemoryRequest, err)
+	}
+	defer gz.Close()
+
+	var reader io.Reader = gz
+	if maxBytes > 0 {
+		// One byte over the limit tells a truncated decode from an oversized bundle
+		reader = io.LimitReader(gz, maxBytes+1)
+	}
+	counted := &countingReader{r: reader}
+
+	var bundle traceBundle
+	if err := json.NewDecoder(counted).Decode(&bundle); err != nil {
+		if maxBytes > 0 && counted.n > maxBytes {
+			return nil, fmt.Errorf("%w: trace exceeds %d bytes", ErrInvalidMemoryRequest, maxBytes)
+		}
+		return nil, fmt.Errorf("%w: failed to decode trace: %v", ErrInvalidMemoryRequest, err)
+	}
+	if bundle.Version != traceBundleVersion {
+		return nil, fmt.Errorf("%w: unsupported trace version %d", ErrInvalidMemoryRequest, bundle.Version)
+	}
+
+	var snapshot taskSnapshot
+	if err := json.Unmarshal(bundle.Task, &snapshot); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode task: %v", ErrInvalidMemoryRequest, err)
+	}
+	if taskID != "" {
+		snapshot.TaskID = taskID
+	}
+	if snapshot.TaskID == "" {
+		return nil, fmt.Errorf("%w: trace has no task ID", ErrInvalidMemoryRequest)
+	}
+
+	// Attachments are content-addressed; a mismatch means a corrupt or edited bundle
+	for id, data := range bundle.Attachments {
+		if blobID(data) != id {
+			return nil, fmt.Errorf("%w: attachment %s does not match its content", ErrInvalidMemoryRequest, id)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tasks[snapshot.TaskID]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrTaskExists, snapshot.TaskID)
+	}
+
+	for id, data := range bundle.Attachments {
+		if _, err := m.blobs.Put(data); err != nil {
+			return nil, fmt.Errorf("failed to store screenshot %s: %w", id, err)
+		}
+	}
+
+	// The bundle's workspace is where it was exported from, not where it lands
+	snapshot.Workspace = workspace
+
+	task := taskFromSnapshot(&snapshot)
+	task.blobs = m.blobs
+	task.embedder = m.embedder
+	task.LastAccessed = time.Now()
+	if task.Status == TaskStatusRunning {
+		task.Status = TaskStatusInterrupted
+	}
+	m.tasks[task.TaskID] = task
+
+	return task, nil
+}
+
+// ImportTraceFromFile imports a trace bundle written by ExportTraceToFile
+func (m *ShortTermMemory) ImportTraceFromFile(path, workspace, taskID string) (*TaskMemory, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	defer file.Close()
+
+	return m.ImportTrace(file, workspace, taskID, TraceImportMaxBytesFromEnv())
+}
+
+// countingReader counts bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// VectorStore holds document embeddings for similarity search. Metadata
+// values are exact-match filters (type, task_id) that backends push down into
+// the search.
+type VectorStore interface {
+	Upsert(ctx context.Context, id string, vector []float64, metadata map[string]string) error
+	Query(ctx context.Context, vector []float64, topK int, where map[string]string) ([]VectorMatch, error)
+	Delete(ctx context.Context, ids ...string) error
+	// Workspace opens the store's counterpart for a non-default workspace,
+	// sharing this store's connection
+	Workspace(ctx context.Context, name string) (VectorStore, error)
+	Close() error
+}
+
+// VectorMatch is a document ID scored by cosine similarity
+type VectorMatch struct {
+	ID    string
+	Score float64
+}
+
+// NewVectorStoreFromEnv opens the backend named by VECTOR_STORE: "chromem"
+// (default, embedded), "qdrant" or "pgvector"
+func NewVectorStoreFromEnv(ctx context.Context, dimension int) (VectorStore, error) {
+	switch backend := strings.ToLower(getEnv("VECTOR_STORE", "chromem")); backend {
+	case "chromem":
+		return NewChromemVectorStore(getEnv("VECTOR_STORE_PATH", "./data/documents_vec"))
+	case "qdrant":
+		return NewQdrantVectorStore(ctx, QdrantConfig{
+			URL:        getEnv("QDRANT_URL", "http://localhost:6333"),
+			APIKey:     getEnv("QDRANT_API_KEY", ""),
+			Collection: getEnv("QDRANT_COLLECTION", "agent_memory"),
+			Dimension:  dimension,
+		})
+	case "pgvector":
+		return NewPgVectorStore(ctx, getEnv("PGVECTOR_DSN", "postgres://localhost:5432/agent"),
+			getEnv("PGVECTOR_TABLE", "memory_vectors"), dimension)
+	default:
+		return nil, fmt.Errorf("unknown vector store %q", backend)
+	}
+}
+
+// ChromemVectorStore is an embedded vector store persisted to a local directory
+type ChromemVectorStore struct {
+	db         *chromem.DB
+	collection *chromem.Collection
+}
+
+// NewChromemVectorStore opens (or creates) a chromem database at path
+func NewChromemVectorStore(path string) (*ChromemVectorStore, error) {
+	db, err := chromem.NewPersistentDB(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chromem database: %w", err)
+	}
+
+	collection, err := db.GetOrCreateCollection("documents", nil, noEmbed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chromem collection: %w", err)
+	}
+
+	return &ChromemVectorStore{db: db, collection: collection}, nil
+}
+
+// noEmbed is the collections' embedding function; embeddings are always
+// supplied by the caller
+func noEmbed(context.Context, string) ([]float32, error) {
+	return nil, fmt.Errorf("chromem vector store requires precomputed embeddings")
+}
+
+// Workspace opens the workspace's collection in the same database
+func (s *ChromemVectorStore) Workspace(ctx context.Context, name string) (VectorStore, error) {
+	collection, err := s.db.GetOrCreateCollection("documents_"+name, nil, noEmbed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chromem collection: %w", err)
+	}
+
+	return &ChromemVectorStore{db: s.db, collection: collection}, nil
+}
+
+// Upsert stores or replaces a document's embedding
+func (s *ChromemVectorStore) Upsert(ctx context.Context, id string, vector []float64, metadata map[string]string) error {
+	err := s.collection.AddDocument(ctx, chromem.Document{
+		ID:        id,
+		Metadata:  metadata,
+		Embedding: toFloat32(vector),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upsert vector: %w", err)
+	}
+	return nil
+}
+
+// Query returns the topK documents most similar to vector
+func (s *ChromemVectorStore) Query(ctx context.Context, vector []float64, topK int, where map[string]string) ([]VectorMatch, error) {
+	// chromem rejects requests for more results than it holds
+	if count := s.collection.Count(); topK > count {
+		topK = count
+	}
+	if topK == 0 {
+		return []VectorMatch{}, nil
+	}
+
+	results, err := s.collection.QueryEmbedding(ctx, toFloat32(vector), topK, where, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vectors: %w", err)
+	}
+
+	matches := make([]VectorMatch, len(results))
+	for i, r := range results {
+		matches[i] = VectorMatch{ID: r.ID, Score: float64(r.Similarity)}
+	}
+	return matches, nil
+}
+
+// Delete removes embeddings by document ID
+func (s *ChromemVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := s.collection.Delete(ctx, nil, nil, ids...); err != nil {
+		return fmt.Errorf("failed to delete vectors: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op; chromem persists every write immediately
+func (s *ChromemVectorStore) Close() error {
+	return nil
+}
+
+func toFloat32(vector []float64) []float32 {
+	out := make([]float32, len(vector))
+	for i, v := range vector {
+		out[i] = float32(v)
+	}
+	return out
+}
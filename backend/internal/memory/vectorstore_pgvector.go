@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgVectorStore stores embeddings in a Postgres table using the pgvector extension
+type PgVectorStore struct {
+	pool      *pgxpool.Pool
+	name      string // unsanitized table name
+	table     string // sanitized identifier
+	dimension int
+	shared    bool // a workspace's table on another store's pool
+}
+
+// NewPgVectorStore connects to Postgres and creates the vector table and index if missing
+func NewPgVectorStore(ctx context.Context, dsn, table string, dimension int) (*PgVectorStore, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+
+	s := &PgVectorStore{
+		pool:      pool,
+		name:      table,
+		table:     pgx.Identifier{table}.Sanitize(),
+		dimension: dimension,
+	}
+	if err := s.prepare(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Workspace opens the workspace's table, named after the default one, on the same pool
+func (s *PgVectorStore) Workspace(ctx context.Context, name string) (VectorStore, error) {
+	table := s.name + "_" + name
+	ws := &PgVectorStore{
+		pool:      s.pool,
+		name:      table,
+		table:     pgx.Identifier{table}.Sanitize(),
+		dimension: s.dimension,
+		shared:    true,
+	}
+	if err := ws.prepare(ctx); err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// prepare creates the extension, table and index if missing
+func (s *PgVectorStore) prepare(ctx context.Context) error {
+	index := pgx.Identifier{s.name + "_embedding_idx"}.Sanitize()
+
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id TEXT PRIMARY KEY,
+			embedding vector(%d) NOT NULL,
+			metadata JSONB NOT NULL DEFAULT '{}'
+		)`, s.table, s.dimension),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s USING hnsw (embedding vector_cosine_ops)`, index, s.table),
+	}
+	for _, stmt := range statements {
+		if _, err := s.pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to prepare pgvector table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Upsert stores or replaces a document's embedding
+func (s *PgVectorStore) Upsert(ctx context.Context, id string, vector []float64, metadata map[string]string) error {
+	meta, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	_, err = s.pool.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (id, embedding, metadata) VALUES ($1, $2::vector, $3)
+		ON CONFLICT (id) DO UPDATE SET embedding = EXCLUDED.embedding, metadata = EXCLUDED.metadata`, s.table),
+		id, vectorLiteral(vector), meta)
+	if err != nil {
+		return fmt.Errorf("failed to upsert vector: %w", err)
+	}
+	return nil
+}
+
+// Query returns the topK documents most similar to vector
+func (s *PgVectorStore) Query(ctx context.Context, vector []float64, topK int, where map[string]string) ([]VectorMatch, error) {
+	if where == nil {
+		where = map[string]string{}
+	}
+	filter, err := json.Marshal(where)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode filter: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(`
+		SELECT id, 1 - (embedding <=> $1::vector) AS score
+		FROM %s
+		WHERE metadata @> $2
+		ORDER BY embedding <=> $1::vector
+		LIMIT $3`, s.table),
+		vectorLiteral(vector), filter, topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vectors: %w", err)
+	}
+	defer rows.Close()
+
+	matches := make([]VectorMatch, 0, topK)
+	for rows.Next() {
+		var match VectorMatch
+		if err := rows.Scan(&match.ID, &match.Score); err != nil {
+			return nil, fmt.Errorf("failed to read vector match: %w", err)
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+// Delete removes embeddings by document ID
+func (s *PgVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := s.pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ANY($1)`, s.table), ids)
+	if err != nil {
+		return fmt.Errorf("failed to delete vectors: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection pool unless it belongs to another store
+func (s *PgVectorStore) Close() error {
+	if !s.shared {
+		s.pool.Close()
+	}
+	return nil
+}
+
+// vectorLiteral formats a vector in pgvector's text input format, e.g. "[1,2,3]"
+func vectorLiteral(vector []float64) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, v := range vector {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
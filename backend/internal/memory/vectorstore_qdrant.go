@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QdrantConfig configures the Qdrant vector store
+type QdrantConfig struct {
+	URL        string
+	APIKey     string
+	Collection string
+	Dimension  int
+}
+
+// QdrantVectorStore stores embeddings in a Qdrant collection over its REST API
+type QdrantVectorStore struct {
+	config QdrantConfig
+	client *http.Client
+}
+
+// NewQdrantVectorStore connects to Qdrant and creates the collection if missing
+func NewQdrantVectorStore(ctx context.Context, config QdrantConfig) (*QdrantVectorStore, error) {
+	s := &QdrantVectorStore{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	s.config.URL = strings.TrimRight(config.URL, "/")
+
+	status, err := s.do(ctx, http.MethodGet, "/collections/"+config.Collection, nil, nil)
+	if err != nil && status != http.StatusNotFound {
+		return nil, fmt.Errorf("failed to reach Qdrant: %w", err)
+	}
+
+	if status == http.StatusNotFound {
+		body := map[string]interface{}{
+			"vectors": map[string]interface{}{
+				"size":     config.Dimension,
+				"distance": "Cosine",
+			},
+		}
+		if _, err := s.do(ctx, http.MethodPut, "/collections/"+config.Collection, body, nil); err != nil {
+			return nil, fmt.Errorf("failed to create Qdrant collection: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// Workspace opens the workspace's collection, named after the default one
+func (s *QdrantVectorStore) Workspace(ctx context.Context, name string) (VectorStore, error) {
+	config := s.config
+	config.Collection = s.config.Collection + "_" + name
+	return NewQdrantVectorStore(ctx, config)
+}
+
+// pointID maps a document ID onto the UUIDs Qdrant requires
+func pointID(id string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(id)).String()
+}
+
+// Upsert stores or replaces a document's embedding
+func (s *QdrantVectorStore) Upsert(ctx context.Context, id string, vector []float64, metadata map[string]string) error {
+	payload := map[string]interface{}{"doc_id": id}
+	for k, v := range metadata {
+		payload[k] = v
+	}
+
+	body := map[string]interface{}{
+		"points": []map[string]interface{}{{
+			"id":      pointID(id),
+			"vector":  vector,
+			"payload": payload,
+		}},
+	}
+	if _, err := s.do(ctx, http.MethodPut, "/collections/"+s.config.Collection+"/points?wait=true", body, nil); err != nil {
+		return fmt.Errorf("failed to upsert vector: %w", err)
+	}
+	return nil
+}
+
+// Query returns the topK documents most similar to vector
+func (s *QdrantVectorStore) Query(ctx context.Context, vector []float64, topK int, where map[string]string) ([]VectorMatch, error) {
+	body := map[string]interface{}{
+		"vector":       vector,
+		"limit":        topK,
+		"with_payload": []string{"doc_id"},
+	}
+	if len(where) > 0 {
+		must := make([]map[string]interface{}, 0, len(where))
+		for k, v := range where {
+			must = append(must, map[string]interface{}{
+				"key":   k,
+				"match": map[string]interface{}{"value": v},
+			})
+		}
+		body["filter"] = map[string]interface{}{"must": must}
+	}
+
+	var resp struct {
+		Result []struct {
+			Score   float64           `json:"score"`
+			Payload map[string]string `json:"payload"`
+		} `json:"result"`
+	}
+	if _, err := s.do(ctx, http.MethodPost, "/collections/"+s.config.Collection+"/points/search", body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to query vectors: %w", err)
+	}
+
+	matches := make([]VectorMatch, 0, len(resp.Result))
+	for _, r := range resp.Result {
+		matches = append(matches, VectorMatch{ID: r.Payload["doc_id"], Score: r.Score})
+	}
+	return matches, nil
+}
+
+// Delete removes embeddings by document ID
+func (s *QdrantVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = pointID(id)
+	}
+
+	body := map[string]interface{}{"points": points}
+	if _, err := s.do(ctx, http.MethodPost, "/collections/"+s.config.Collection+"/points/delete?wait=true", body, nil); err != nil {
+		return fmt.Errorf("failed to delete vectors: %w", err)
+	}
+	return nil
+}
+
+// Close releases idle HTTP connections
+func (s *QdrantVectorStore) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// do sends a JSON request and decodes the response into out when non-nil.
+// It returns the HTTP status so callers can distinguish missing resources.
+func (s *QdrantVectorStore) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.config.URL+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.APIKey != "" {
+		req.Header.Set("api-key", s.config.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("qdrant returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
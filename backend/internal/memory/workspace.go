@@ -0,0 +1,266 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	lightrag "github.com/MegaGrindStone/go-light-rag"
+	"github.com/MegaGrindStone/go-light-rag/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultWorkspace is the workspace of requests that don't name one. It uses
+// the stores from before workspaces existed, so existing memory stays visible.
+const DefaultWorkspace = "default"
+
+// workspaceBucketPrefix prefixes the document index bucket of each non-default workspace
+const workspaceBucketPrefix = "documents/"
+
+// workspaceNamePattern keeps names safe as bucket, collection, table and label suffixes
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,47}$`)
+
+// workspaceStores are the long-term stores of one workspace. Documents, their
+// vectors and LightRAG's chunks are separate per workspace; the Neo4j
+// connection is shared, with Document nodes labelled by workspace.
+//
+// LightRAG's entity graph, consolidation entities and the code graph live in
+// the shared Neo4j database and are not scoped.
+type workspaceStores struct {
+	name      string
+	documents *documentIndex
+	vectors   VectorStore
+	rag       *lightrag.LightRAG
+	chromem   *storage.Chromem // nil for the default workspace
+	bolt      *storage.Bolt    // nil for the default workspace
+}
+
+type workspaceContextKey struct{}
+
+// WithWorkspace scopes memory operations made with ctx to a workspace
+func WithWorkspace(ctx context.Context, workspace string) context.Context {
+	return context.WithValue(ctx, workspaceContextKey{}, workspace)
+}
+
+// WorkspaceFrom returns the workspace set by WithWorkspace, or DefaultWorkspace
+func WorkspaceFrom(ctx context.Context) string {
+	if workspace, ok := ctx.Value(workspaceContextKey{}).(string); ok && workspace != "" {
+		return workspace
+	}
+	return DefaultWorkspace
+}
+
+// ValidateWorkspace checks that a workspace name is 1-48 lowercase letters,
+// digits, '-' or '_', starting with a letter or digit
+func ValidateWorkspace(workspace string) error {
+	if !workspaceNamePattern.MatchString(workspace) {
+		return fmt.Errorf("%w: invalid workspace %q", ErrInvalidMemoryRequest, workspace)
+	}
+	return nil
+}
+
+// workspaceOf returns the validated workspace of ctx
+func workspaceOf(ctx context.Context) (string, error) {
+	workspace := WorkspaceFrom(ctx)
+	if err := ValidateWorkspace(workspace); err != nil {
+		return "", err
+	}
+	return workspace, nil
+}
+
+// workspaceLabel is the Neo4j label of a workspace's Document nodes, quoted
+// since names may contain '-'
+func workspaceLabel(workspace string) string {
+	return "`Workspace_" + workspace + "`"
+}
+
+// scope returns the stores of ctx's workspace, opening them on first use;
+// callers must hold m.mu
+func (m *LongTermMemory) scope(ctx context.Context) (*workspaceStores, error) {
+	workspace, err := workspaceOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.openWorkspace(ctx, workspace)
+}
+
+// openWorkspace returns a workspace's stores, opening them on first use;
+// callers must hold m.mu
+func (m *LongTermMemory) openWorkspace(ctx context.Context, workspace string) (*workspaceStores, error) {
+	if workspace == DefaultWorkspace {
+		return &workspaceStores{
+			name:      DefaultWorkspace,
+			documents: m.documents,
+			vectors:   m.vectors,
+			rag:       m.rag,
+		}, nil
+	}
+
+	m.workspacesMu.Lock()
+	defer m.workspacesMu.Unlock()
+
+	if ws, ok := m.workspaces[workspace]; ok {
+		return ws, nil
+	}
+
+	ws := &workspaceStores{name: workspace}
+	if err := m.initWorkspace(ctx, ws); err != nil {
+		ws.close(ctx)
+		return nil, fmt.Errorf("failed to open workspace %s: %w", workspace, err)
+	}
+
+	if m.workspaces == nil {
+		m.workspaces = make(map[string]*workspaceStores)
+	}
+	m.workspaces[workspace] = ws
+	return ws, nil
+}
+
+// initWorkspace opens a workspace's document bucket, vector collection and
+// LightRAG stores, kept under a per-workspace directory beside the defaults
+func (m *LongTermMemory) initWorkspace(ctx context.Context, ws *workspaceStores) error {
+	documents, err := m.documents.workspace(ws.name)
+	if err != nil {
+		return err
+	}
+	ws.documents = documents
+
+	vectors, err := m.vectors.Workspace(ctx, ws.name)
+	if err != nil {
+		return fmt.Errorf("failed to open vector store: %w", err)
+	}
+	ws.vectors = vectors
+
+	chromemPath, err := workspacePath(getEnv("CHROMEM_DB_PATH", "./data/chromem.db"), ws.name)
+	if err != nil {
+		return err
+	}
+	chromem, err := storage.NewChromem(chromemPath, 5, m.embeddings.EmbeddingFunc())
+	if err != nil {
+		return fmt.Errorf("failed to initialize ChromeM: %w", err)
+	}
+	ws.chromem = chromem
+
+	boltPath, err := workspacePath(getEnv("BOLT_DB_PATH", "./data/bolt.db"), ws.name)
+	if err != nil {
+		return err
+	}
+	bolt, err := storage.NewBolt(boltPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize Bolt: %w", err)
+	}
+	ws.bolt = bolt
+
+	rag, err := m.newRAG(ws.chromem, ws.bolt)
+	if err != nil {
+		return err
+	}
+	ws.rag = rag
+
+	return nil
+}
+
+// workspacePath places a workspace's copy of a store file in a workspaces
+// directory next to the default one, e.g. ./data/workspaces/acme/bolt.db
+func workspacePath(defaultPath, workspace string) (string, error) {
+	dir := filepath.Join(filepath.Dir(defaultPath), "workspaces", workspace)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+	return filepath.Join(dir, filepath.Base(defaultPath)), nil
+}
+
+// reconnectWorkspaces rebuilds open workspaces' LightRAG instances around a
+// re-dialed Neo4j connection; callers must hold m.mu
+func (m *LongTermMemory) reconnectWorkspaces() error {
+	m.workspacesMu.Lock()
+	defer m.workspacesMu.Unlock()
+
+	for name, ws := range m.workspaces {
+		rag, err := m.newRAG(ws.chromem, ws.bolt)
+		if err != nil {
+			return fmt.Errorf("failed to reconnect workspace %s: %w", name, err)
+		}
+		ws.rag = rag
+	}
+	return nil
+}
+
+// closeWorkspaces closes every open workspace's stores; callers must hold m.mu
+func (m *LongTermMemory) closeWorkspaces(ctx context.Context) []error {
+	m.workspacesMu.Lock()
+	defer m.workspacesMu.Unlock()
+
+	var errs []error
+	for _, ws := range m.workspaces {
+		errs = append(errs, ws.close(ctx)...)
+	}
+	m.workspaces = nil
+	return errs
+}
+
+// close releases what a non-default workspace opened
+func (ws *workspaceStores) close(ctx context.Context) []error {
+	var errs []error
+
+	if ws.documents != nil {
+		if err := ws.documents.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close workspace %s document index: %w", ws.name, err))
+		}
+	}
+	if ws.vectors != nil {
+		if err := ws.vectors.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close workspace %s vector store: %w", ws.name, err))
+		}
+	}
+	if ws.chromem != nil {
+		if err := closeStorage(ctx, ws.chromem); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close workspace %s ChromeM: %w", ws.name, err))
+		}
+	}
+	if ws.bolt != nil {
+		if err := closeStorage(ctx, ws.bolt); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close workspace %s Bolt: %w", ws.name, err))
+		}
+	}
+
+	return errs
+}
+
+// Workspaces returns the names of every workspace holding long-term documents,
+// DefaultWorkspace first
+func (m *LongTermMemory) Workspaces() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.initialized {
+		return nil, ErrMemoryUnavailable
+	}
+
+	return m.workspaceNames()
+}
+
+// workspaceNames lists the default workspace and those with a document
+// bucket; callers must hold m.mu
+func (m *LongTermMemory) workspaceNames() ([]string, error) {
+	names := make([]string, 0)
+
+	err := m.documents.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if workspace, ok := strings.CutPrefix(string(name), workspaceBucketPrefix); ok {
+				names = append(names, workspace)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+
+	sort.Strings(names)
+	return append([]string{DefaultWorkspace}, names...), nil
+}
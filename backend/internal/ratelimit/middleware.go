@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/pkg/apierror"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Middleware limits each client's API requests: every request against
+// config.REST, and non-GET requests to config.HeavyRoutes against
+// config.Heavy too. Clients are told apart by the principal they
+// authenticated as, or their address. Requests over a limit get a 429 with
+// a Retry-After header.
+func Middleware(config Config) fiber.Handler {
+	rest := NewLimiter("rest", config.REST)
+	heavy := NewLimiter("heavy", config.Heavy)
+
+	return func(c fiber.Ctx) error {
+		client := ClientKey(c)
+
+		if ok, wait := rest.Allow(client); !ok {
+			return deny(c, wait)
+		}
+		if c.Method() != fiber.MethodGet && isHeavy(config.HeavyRoutes, c.Path()) {
+			if ok, wait := heavy.Allow(client); !ok {
+				return deny(c, wait)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// ClientKey names the client a request comes from: its principal, or its
+// address when authentication is disabled or the request is anonymous
+func ClientKey(c fiber.Ctx) string {
+	if principal := auth.FromContext(c); principal != nil && principal.Via != auth.ViaDisabled {
+		return "principal:" + principal.Name
+	}
+	return "ip:" + c.IP()
+}
+
+// isHeavy reports whether a path falls under one of the heavy route
+// prefixes, compared as the auth rules compare them
+func isHeavy(prefixes []string, path string) bool {
+	for _, prefix := range prefixes {
+		if auth.HasPathPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// deny answers a request over its limit
+func deny(c fiber.Ctx, wait time.Duration) error {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	return apierror.SendDetails(c, 429, "rate limit exceeded", map[string]interface{}{"retry_after_ms": wait.Milliseconds()})
+}
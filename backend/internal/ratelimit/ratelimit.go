@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+)
+
+// rejected counts requests and messages turned away by a limit
+var rejected = metrics.NewCounterVec("rate_limit_rejected_total",
+	"Requests and WebSocket messages rejected by a rate limit", "limit")
+
+// sweepInterval is how often a Limiter drops the buckets of idle clients
+const sweepInterval = time.Minute
+
+// Rate is a token bucket: Burst requests at once, refilled at PerSecond.
+// A rate with PerSecond <= 0 allows everything.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Enabled reports whether the rate limits anything
+func (r Rate) Enabled() bool {
+	return r.PerSecond > 0
+}
+
+// String formats the rate for logs
+func (r Rate) String() string {
+	if !r.Enabled() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g/s, burst %d", r.PerSecond, r.burst())
+}
+
+// burst is the bucket size, at least one request
+func (r Rate) burst() int {
+	return max(r.Burst, 1)
+}
+
+// Bucket limits one client or connection
+type Bucket struct {
+	name string // the limit's metric label
+	rate Rate
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket; name labels its rejections in metrics
+func NewBucket(name string, rate Rate) *Bucket {
+	return &Bucket{name: name, rate: rate, tokens: float64(rate.burst()), last: time.Now()}
+}
+
+// Allow takes a token, or returns false and how long until one is free
+func (b *Bucket) Allow() (bool, time.Duration) {
+	if !b.rate.Enabled() {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	rejected.Inc(b.name)
+	wait := time.Duration((1 - b.tokens) / b.rate.PerSecond * float64(time.Second))
+	return false, wait
+}
+
+// refill adds the tokens earned since the last call; callers must hold b.mu
+func (b *Bucket) refill(now time.Time) {
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate.PerSecond, float64(b.rate.burst()))
+	b.last = now
+}
+
+// full reports whether the bucket has refilled, so dropping it loses nothing
+func (b *Bucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens >= float64(b.rate.burst())
+}
+
+// Limiter keeps a bucket per client key
+type Limiter struct {
+	name string
+	rate Rate
+
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter giving each key its own bucket of rate
+func NewLimiter(name string, rate Rate) *Limiter {
+	return &Limiter{name: name, rate: rate, buckets: make(map[string]*Bucket), lastSweep: time.Now()}
+}
+
+// Allow takes a token from key's bucket, or returns false and how long
+// until one is free
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.rate.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		for k, bucket := range l.buckets {
+			if bucket.full(now) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(l.name, l.rate)
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.Allow()
+}
+
+// Config sets the rates clients are held to
+type Config struct {
+	REST        Rate     // every API request, per client
+	Heavy       Rate     // non-GET requests to HeavyRoutes, per client, on top of REST
+	HeavyRoutes []string // path prefixes of routes that reach Ollama or Chrome
+	WebSocket   Rate     // messages per WebSocket connection
+}
+
+// DefaultConfig allows 20 API requests a second with bursts of 40, one
+// heavy request a second with bursts of 5, and 10 WebSocket messages a
+// second with bursts of 20
+func DefaultConfig() Config {
+	return Config{
+		REST:  Rate{PerSecond: 20, Burst: 40},
+		Heavy: Rate{PerSecond: 1, Burst: 5},
+		HeavyRoutes: []string{
+			"/api/agent/",
+			"/api/tasks",
+			"/api/memory/query",
+			"/api/memory/index",
+			"/api/watchdog/scan",
+			"/api/models/",
+		},
+		WebSocket: Rate{PerSecond: 10, Burst: 20},
+	}
+}
+
+// ConfigFromEnv reads RATE_LIMIT_REST, RATE_LIMIT_HEAVY and RATE_LIMIT_WS,
+// each "rate/s" or "rate/s,burst" such as "20,40" ("0" disables the limit),
+// and RATE_LIMIT_HEAVY_ROUTES, a comma-separated list of path prefixes
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+
+	for env, rate := range map[string]*Rate{
+		"RATE_LIMIT_REST":  &config.REST,
+		"RATE_LIMIT_HEAVY": &config.Heavy,
+		"RATE_LIMIT_WS":    &config.WebSocket,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseRate(value)
+		if err != nil {
+			return DefaultConfig(), fmt.Errorf("invalid %s: %w", env, err)
+		}
+		*rate = parsed
+	}
+
+	if value, ok := os.LookupEnv("RATE_LIMIT_HEAVY_ROUTES"); ok {
+		config.HeavyRoutes = make([]string, 0)
+		for _, prefix := range strings.Split(value, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				config.HeavyRoutes = append(config.HeavyRoutes, prefix)
+			}
+		}
+	}
+	return config, nil
+}
+
+// parseRate parses "rate" or "rate,burst"; the burst defaults to twice the
+// rate, rounded up
+func parseRate(value string) (Rate, error) {
+	perSecond, burst, hasBurst := strings.Cut(value, ",")
+	rate, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(perSecond), "/s"), 64)
+	if err != nil || rate < 0 {
+		return Rate{}, fmt.Errorf("rate %q must be a non-negative number", perSecond)
+	}
+	if !hasBurst {
+		return Rate{PerSecond: rate, Burst: int(rate*2 + 0.999)}, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(burst))
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("burst %q must be a positive integer", burst)
+	}
+	return Rate{PerSecond: rate, Burst: n}, nil
+}
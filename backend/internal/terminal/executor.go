@@ -6,6 +6,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"agent-workspace/backend/pkg/logging"
 )
 
 // Executor executes commands with history tracking
@@ -14,10 +16,15 @@ type Executor struct {
 	history *CommandHistory
 }
 
+// commandSubscriberBuffer is how many commands a slow subscriber may fall
+// behind before the oldest pending ones are dropped
+const commandSubscriberBuffer = 64
+
 // CommandHistory tracks command execution history
 type CommandHistory struct {
-	entries []CommandEntry
-	mu      sync.RWMutex
+	entries     []CommandEntry
+	subscribers map[chan CommandEntry]bool
+	mu          sync.RWMutex
 }
 
 // CommandEntry represents a command execution
@@ -31,16 +38,22 @@ type CommandEntry struct {
 	EndTime     time.Time
 	Duration    time.Duration
 	SessionID   string
+	RequestID   string // the API request or agent task that ran the command
 	Error       string
 }
 
-// NewExecutor creates a new command executor
+// NewExecutor creates a command executor that records into the manager's history
 func NewExecutor(manager *Manager) *Executor {
 	return &Executor{
 		manager: manager,
-		history: &CommandHistory{
-			entries: make([]CommandEntry, 0),
-		},
+		history: manager.History(),
+	}
+}
+
+// NewCommandHistory creates an empty command history
+func NewCommandHistory() *CommandHistory {
+	return &CommandHistory{
+		entries: make([]CommandEntry, 0),
 	}
 }
 
@@ -62,6 +75,7 @@ func (e *Executor) ExecuteInSessionWithContext(ctx context.Context, sessionID, c
 		Source:    source,
 		StartTime: time.Now(),
 		SessionID: sessionID,
+		RequestID: logging.RequestID(ctx),
 	}
 
 	// Execute command
@@ -106,8 +120,7 @@ func (e *Executor) ExecuteScript(script, source string) (*CommandEntry, error) {
 	scriptFile := fmt.Sprintf("/tmp/script_%s.sh", generateID())
 	
 	// Write script to session
-	session, err := e.manager.GetOrCreateSession("default")
-	if err != nil {
+	if _, err := e.manager.GetOrCreateSession("default"); err != nil {
 		return nil, err
 	}
 
@@ -146,8 +159,12 @@ func (e *Executor) ClearHistory() {
 
 // CommandHistory methods
 
-// Add adds a command entry to history
+// Add adds a command entry to history and delivers it to subscribers
 func (h *CommandHistory) Add(entry CommandEntry) {
+	if entry.ID == "" {
+		entry.ID = generateID()
+	}
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -157,6 +174,48 @@ func (h *CommandHistory) Add(entry CommandEntry) {
 	if len(h.entries) > 1000 {
 		h.entries = h.entries[len(h.entries)-1000:]
 	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- entry:
+			continue
+		default:
+		}
+		// Full: drop the oldest pending entry so the newest gets through
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// Subscribe delivers every entry added from now on. A subscriber that falls
+// behind loses its oldest pending entries rather than blocking commands. The
+// channel is closed by cancel.
+func (h *CommandHistory) Subscribe() (<-chan CommandEntry, func()) {
+	ch := make(chan CommandEntry, commandSubscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan CommandEntry]bool)
+	}
+	h.subscribers[ch] = true
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if h.subscribers[ch] {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
 }
 
 // GetAll returns all entries
@@ -10,12 +10,21 @@ import (
 	"sync"
 	"time"
 
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/metrics"
+	"agent-workspace/backend/pkg/tracing"
+
 	"github.com/creack/pty"
 )
 
+// commandsTotal counts commands run in terminal sessions by outcome
+var commandsTotal = metrics.NewCounterVec("terminal_commands_total",
+	"Commands run in terminal sessions", "status")
+
 // Manager manages terminal sessions
 type Manager struct {
 	sessions map[string]*Session
+	history  *CommandHistory // shared by the executors created for the manager
 	mu       sync.RWMutex
 }
 
@@ -39,9 +48,15 @@ type OutputBuffer struct {
 func NewManager() *Manager {
 	return &Manager{
 		sessions: make(map[string]*Session),
+		history:  NewCommandHistory(),
 	}
 }
 
+// History returns the history commands run through executors are recorded in
+func (m *Manager) History() *CommandHistory {
+	return m.history
+}
+
 // CreateSession creates a new terminal session
 func (m *Manager) CreateSession(id string) (*Session, error) {
 	m.mu.Lock()
@@ -58,6 +73,32 @@ func (m *Manager) CreateSession(id string) (*Session, error) {
 		"PS1=$ ",
 	)
 
+	return m.startSessionLocked(id, cmd)
+}
+
+// CreateSandboxSession creates a session for running untrusted code: the
+// shell starts in dir without rc files and sees only env, so server
+// secrets don't leak into it
+func (m *Manager) CreateSandboxSession(id, dir string, env []string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sessions[id]; exists {
+		return nil, fmt.Errorf("session %s already exists", id)
+	}
+
+	cmd := exec.Command("/bin/bash", "--noprofile", "--norc")
+	cmd.Dir = dir
+	cmd.Env = append(append([]string{}, env...),
+		"TERM=dumb",
+		"PS1=$ ",
+	)
+
+	return m.startSessionLocked(id, cmd)
+}
+
+// startSessionLocked starts cmd on a PTY; callers must hold m.mu
+func (m *Manager) startSessionLocked(id string, cmd *exec.Cmd) (*Session, error) {
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start PTY: %w", err)
@@ -157,7 +198,20 @@ func (m *Manager) ExecuteInSessionWithContext(ctx context.Context, sessionID, co
 		return "", err
 	}
 
-	return session.ExecuteWithContext(ctx, command)
+	ctx, span := tracing.Start(ctx, "terminal.command", "terminal.session", sessionID, "terminal.command", command)
+	defer span.End()
+
+	start := time.Now()
+	output, err := session.ExecuteWithContext(ctx, command)
+	span.RecordError(err)
+	logger := logging.FromContext(ctx).With("session_id", sessionID, "command", command,
+		"duration_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		logger.Warn("terminal command failed", "error", err)
+	} else {
+		logger.Debug("terminal command finished")
+	}
+	return output, err
 }
 
 // GetOutput returns the output buffer for a session
@@ -200,6 +254,7 @@ func (s *Session) ExecuteWithContext(ctx context.Context, command string) (strin
 	// Write command with markers
 	fullCommand := fmt.Sprintf("echo '%s' && %s && echo '%s'\n", marker, command, endMarker)
 	if _, err := s.PTY.Write([]byte(fullCommand)); err != nil {
+		commandsTotal.Inc("error")
 		return "", fmt.Errorf("failed to write command: %w", err)
 	}
 
@@ -223,10 +278,13 @@ func (s *Session) ExecuteWithContext(ctx context.Context, command string) (strin
 
 	select {
 	case output := <-outputChan:
+		commandsTotal.Inc("ok")
 		return output, nil
 	case err := <-errorChan:
+		commandsTotal.Inc("error")
 		return "", err
 	case <-ctx.Done():
+		commandsTotal.Inc("canceled")
 		return "", ctx.Err()
 	}
 }
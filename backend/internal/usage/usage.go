@@ -0,0 +1,275 @@
+// Package usage totals the tokens model requests use by day, by model and
+// by agent task, keeping the totals in Bolt so they survive restarts.
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/ollama"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// dayBucket holds one JSON-encoded Day per UTC date, as YYYY-MM-DD
+	dayBucket = []byte("days")
+	// taskBucket holds one JSON-encoded Task per task ID
+	taskBucket = []byte("tasks")
+)
+
+const (
+	defaultDays  = 7
+	defaultTasks = 20
+	maxTasks     = 500
+)
+
+// Config sets where usage is kept and for how long
+type Config struct {
+	DBPath        string
+	RetentionDays int // days, and tasks last active on them, kept
+}
+
+// DefaultConfig keeps 90 days of usage in ./data/usage.db
+func DefaultConfig() Config {
+	return Config{DBPath: "./data/usage.db", RetentionDays: 90}
+}
+
+// ConfigFromEnv reads USAGE_DB_PATH and USAGE_RETENTION_DAYS
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	if value := os.Getenv("USAGE_DB_PATH"); value != "" {
+		config.DBPath = value
+	}
+	if value := os.Getenv("USAGE_RETENTION_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return DefaultConfig(), fmt.Errorf("invalid USAGE_RETENTION_DAYS %q, expected a positive number", value)
+		}
+		config.RetentionDays = parsed
+	}
+	return config, nil
+}
+
+// Day is the usage of one UTC day, in total and by model
+type Day struct {
+	Date string `json:"date"`
+	models.TokenUsage
+	Models map[string]models.TokenUsage `json:"models,omitempty"` // by provider/model
+}
+
+// Task is the usage of one agent task
+type Task struct {
+	TaskID string `json:"task_id"`
+	models.TokenUsage
+	StartedAt time.Time `json:"started_at"` // its first request
+	UpdatedAt time.Time `json:"updated_at"` // its latest request
+}
+
+// Report is the usage of recent days and tasks
+type Report struct {
+	Today Day    `json:"today"`
+	Days  []Day  `json:"days"`  // newest first, including days without requests
+	Tasks []Task `json:"tasks"` // most recently active first
+}
+
+// Ledger records the tokens each request uses. Set it as the llm
+// Recorder to count every provider's requests.
+type Ledger struct {
+	db        *bolt.DB
+	retention int
+	pruned    string // the date old usage was last pruned on
+}
+
+// Open opens (or creates) the ledger config describes
+func Open(config Config) (*Ledger, error) {
+	if err := os.MkdirAll(filepath.Dir(config.DBPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create usage database directory: %w", err)
+	}
+
+	db, err := bolt.Open(config.DBPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{dayBucket, taskBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create usage buckets: %w", err)
+	}
+
+	return &Ledger{db: db, retention: config.RetentionDays}, nil
+}
+
+// Close closes the usage database
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
+
+// Record adds a request's tokens to today's usage and, when ctx is a
+// task's, to the task's
+func (l *Ledger) Record(ctx context.Context, provider, model string, tokens ollama.Usage) {
+	now := time.Now().UTC()
+	date := now.Format(time.DateOnly)
+
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		if l.pruned != date {
+			if err := l.prune(tx, now); err != nil {
+				return err
+			}
+			l.pruned = date
+		}
+
+		days := tx.Bucket(dayBucket)
+		day := Day{Date: date, Models: make(map[string]models.TokenUsage)}
+		if err := get(days, date, &day); err != nil {
+			return err
+		}
+		add(&day.TokenUsage, tokens)
+		byModel := day.Models[provider+"/"+model]
+		add(&byModel, tokens)
+		day.Models[provider+"/"+model] = byModel
+		if err := put(days, date, day); err != nil {
+			return err
+		}
+
+		meter := llm.MeterFrom(ctx)
+		if meter == nil {
+			return nil
+		}
+		tasks := tx.Bucket(taskBucket)
+		task := Task{TaskID: meter.ID(), StartedAt: now}
+		if err := get(tasks, meter.ID(), &task); err != nil {
+			return err
+		}
+		add(&task.TokenUsage, tokens)
+		task.UpdatedAt = now
+		return put(tasks, meter.ID(), task)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to record token usage", "error", err)
+	}
+}
+
+// Report returns the usage of the last days days, today included, and of
+// the tasks most recently active
+func (l *Ledger) Report(req models.UsageRequest) (Report, error) {
+	days := req.Days
+	if days <= 0 {
+		days = defaultDays
+	}
+	days = min(days, l.retention)
+	limit := req.Tasks
+	if limit <= 0 {
+		limit = defaultTasks
+	}
+	limit = min(limit, maxTasks)
+
+	report := Report{Days: make([]Day, 0, days), Tasks: make([]Task, 0)}
+	err := l.db.View(func(tx *bolt.Tx) error {
+		today := time.Now().UTC()
+		for i := 0; i < days; i++ {
+			date := today.AddDate(0, 0, -i).Format(time.DateOnly)
+			day := Day{Date: date}
+			if err := get(tx.Bucket(dayBucket), date, &day); err != nil {
+				return err
+			}
+			report.Days = append(report.Days, day)
+		}
+
+		return tx.Bucket(taskBucket).ForEach(func(_, data []byte) error {
+			var task Task
+			if err := json.Unmarshal(data, &task); err != nil {
+				return err
+			}
+			report.Tasks = append(report.Tasks, task)
+			return nil
+		})
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	report.Today = report.Days[0]
+	sort.Slice(report.Tasks, func(i, j int) bool { return report.Tasks[i].UpdatedAt.After(report.Tasks[j].UpdatedAt) })
+	if len(report.Tasks) > limit {
+		report.Tasks = report.Tasks[:limit]
+	}
+	return report, nil
+}
+
+// prune deletes the days, and tasks last active on them, older than the
+// retention period
+func (l *Ledger) prune(tx *bolt.Tx, now time.Time) error {
+	cutoff := now.AddDate(0, 0, -l.retention)
+	days := tx.Bucket(dayBucket).Cursor()
+	for key, _ := days.First(); key != nil && string(key) < cutoff.Format(time.DateOnly); key, _ = days.First() {
+		if err := days.Delete(); err != nil {
+			return err
+		}
+	}
+
+	var stale [][]byte
+	err := tx.Bucket(taskBucket).ForEach(func(key, data []byte) error {
+		var task Task
+		if err := json.Unmarshal(data, &task); err != nil {
+			return err
+		}
+		if task.UpdatedAt.Before(cutoff) {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := tx.Bucket(taskBucket).Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add counts a request and its tokens in total
+func add(total *models.TokenUsage, tokens ollama.Usage) {
+	total.Requests++
+	total.PromptTokens += tokens.PromptTokens
+	total.CompletionTokens += tokens.CompletionTokens
+	total.TotalTokens += tokens.PromptTokens + tokens.CompletionTokens
+}
+
+// get decodes the value stored under key into v, leaving v as it is when
+// there is none
+func get(bucket *bolt.Bucket, key string, v interface{}) error {
+	data := bucket.Get([]byte(key))
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// put stores v as JSON under key
+func put(bucket *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
@@ -14,6 +14,8 @@ const (
 	AlertTypeConceptDrift  = "concept_drift"
 	AlertTypePerformance   = "performance"
 	AlertTypeProposal      = "proposal"
+	AlertTypeCommand       = "command"
+	AlertTypeCommit        = "commit"
 )
 
 // AlertSeverity constants
@@ -54,6 +56,18 @@ func (g *AlertGenerator) GenerateConceptDriftAlert(title, message string, contex
 func (g *AlertGenerator) AnalyzeCode(code, filename string) []Alert {
 	alerts := make([]Alert, 0)
 
+	// User-defined rules
+	alerts = append(alerts, g.checkRules(code, filename)...)
+
+	// Go files are checked on their syntax tree; the compiler already
+	// rejects unused imports
+	if strings.HasSuffix(filename, ".go") {
+		alerts = append(alerts, g.analyzeGo(code, filename)...)
+		alerts = append(alerts, g.checkHardcodedSecrets(code, filename)...)
+		alerts = append(alerts, g.checkXSS(code, filename)...)
+		return alerts
+	}
+
 	// Security checks
 	alerts = append(alerts, g.checkSQLInjection(code, filename)...)
 	alerts = append(alerts, g.checkHardcodedSecrets(code, filename)...)
@@ -69,6 +83,29 @@ func (g *AlertGenerator) AnalyzeCode(code, filename string) []Alert {
 	return alerts
 }
 
+// checkRules runs the watchdog's user-defined rules
+func (g *AlertGenerator) checkRules(code, filename string) []Alert {
+	alerts := make([]Alert, 0)
+
+	engine := g.watchdog.rulesEngine()
+	if engine == nil {
+		return alerts
+	}
+
+	for _, match := range engine.Evaluate(code, filename) {
+		alert := g.watchdog.createAlert(match.Type, match.Severity, match.Title, match.Message,
+			map[string]interface{}{
+				"file":  filename,
+				"line":  match.Line,
+				"rule":  match.Rule,
+				"match": match.Match[:min(len(match.Match), 100)],
+			})
+		alerts = append(alerts, alert)
+	}
+
+	return alerts
+}
+
 // checkSQLInjection checks for SQL injection vulnerabilities
 func (g *AlertGenerator) checkSQLInjection(code, filename string) []Alert {
 	alerts := make([]Alert, 0)
@@ -102,27 +139,20 @@ func (g *AlertGenerator) checkSQLInjection(code, filename string) []Alert {
 func (g *AlertGenerator) checkHardcodedSecrets(code, filename string) []Alert {
 	alerts := make([]Alert, 0)
 
-	patterns := []string{
-		"password",
-		"api_key",
-		"secret",
-		"token",
-		"private_key",
-	}
-
-	for _, pattern := range patterns {
-		if strings.Contains(strings.ToLower(code), pattern) && strings.Contains(code, "=") {
-			alert := g.GenerateSecurityAlert(
-				"Potential Hardcoded Secret",
-				fmt.Sprintf("Possible hardcoded secret detected in %s", filename),
-				map[string]interface{}{
-					"file":    filename,
-					"pattern": pattern,
-					"recommendation": "Use environment variables or secure vaults",
-				},
-			)
-			alerts = append(alerts, alert)
-		}
+	for _, finding := range g.watchdog.secretScanner().Scan(code, filename) {
+		alert := g.GenerateSecurityAlert(
+			"Potential Hardcoded Secret",
+			fmt.Sprintf("%s (%s) detected in %s", finding.Description, finding.Redacted, filename),
+			map[string]interface{}{
+				"file":           filename,
+				"line":           finding.Line,
+				"rule":           finding.Rule,
+				"match":          finding.Redacted,
+				"fingerprint":    finding.Fingerprint,
+				"recommendation": "Use environment variables or secure vaults; acknowledge the alert if this is not a secret",
+			},
+		)
+		alerts = append(alerts, alert)
 	}
 
 	return alerts
@@ -0,0 +1,597 @@
+package watchdog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"agent-workspace/backend/internal/terminal"
+)
+
+// Output formats understood by CommandAnalyzer
+const (
+	FormatGosec       = "gosec"       // gosec -fmt=json
+	FormatStaticcheck = "staticcheck" // staticcheck -f json, one object per line
+	FormatESLint      = "eslint"      // eslint -f json
+	FormatText        = "text"        // file:line[:column]: message, as go vet and most compilers print
+)
+
+const (
+	// maxAnalyzerOutput bounds how much of a tool's report is parsed
+	maxAnalyzerOutput = 8 * 1024 * 1024
+	// analyzerErrorTail is how much of a failing tool's stderr is reported
+	analyzerErrorTail = 2048
+	// maxAnalyzerFindings caps the findings kept from one run
+	maxAnalyzerFindings = 500
+	// analyzerWatchTimeout bounds the analyzers run for one changed file
+	analyzerWatchTimeout = 5 * time.Minute
+)
+
+// analyzerSeq keeps sandbox session IDs unique across concurrent runs
+var analyzerSeq atomic.Uint64
+
+// textFindingPattern matches "file:line[:column]: message"
+var textFindingPattern = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?:\s*(.+)$`)
+
+// Finding is one issue an analyzer reports
+type Finding struct {
+	Rule     string // tool-specific rule or check ID
+	Type     string // alert type; AlertTypePattern when empty
+	Severity string // AlertSeverityInfo, AlertSeverityWarning or AlertSeverityError
+	Message  string
+	File     string // relative to the workspace, with forward slashes
+	Line     int
+	Column   int
+	Snippet  string // offending code, when the tool reports it
+}
+
+// Analyzer is a static analysis tool the watchdog runs over workspace files
+// alongside its built-in checks
+type Analyzer interface {
+	Name() string
+	// Analyze checks files, given relative to root; files it doesn't handle
+	// are skipped
+	Analyze(ctx context.Context, root string, files []string) ([]Finding, error)
+}
+
+// RegisterAnalyzer adds an analyzer to on-demand scans and the file watcher
+func (w *Watchdog) RegisterAnalyzer(analyzer Analyzer) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, registered := range w.analyzers {
+		if registered.analyzer.Name() == analyzer.Name() {
+			return fmt.Errorf("analyzer %s already registered", analyzer.Name())
+		}
+	}
+	w.analyzers = append(w.analyzers, &analyzerEntry{analyzer: analyzer})
+	return nil
+}
+
+// analyzerEntry is a registered analyzer and how its runs went
+type analyzerEntry struct {
+	analyzer Analyzer
+
+	mu        sync.Mutex
+	runs      int
+	failures  int
+	findings  int
+	lastError string
+	lastRun   time.Time
+}
+
+func (e *analyzerEntry) record(findings int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.runs++
+	e.findings += findings
+	e.lastRun = time.Now()
+	e.lastError = ""
+	if err != nil {
+		e.failures++
+		e.lastError = err.Error()
+	}
+}
+
+func (e *analyzerEntry) stats() map[string]interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stats := map[string]interface{}{
+		"runs":     e.runs,
+		"failures": e.failures,
+		"findings": e.findings,
+	}
+	if !e.lastRun.IsZero() {
+		stats["last_run"] = e.lastRun
+	}
+	if e.lastError != "" {
+		stats["last_error"] = e.lastError
+	}
+	return stats
+}
+
+// runAnalyzers runs every registered analyzer over files and turns their
+// findings into alerts. It returns the error of each analyzer that failed.
+func (w *Watchdog) runAnalyzers(ctx context.Context, root string, files []string) ([]Alert, map[string]string) {
+	w.mu.RLock()
+	entries := append([]*analyzerEntry(nil), w.analyzers...)
+	w.mu.RUnlock()
+
+	alerts := make([]Alert, 0)
+	failed := make(map[string]string)
+	if len(files) == 0 {
+		return alerts, failed
+	}
+
+	for _, entry := range entries {
+		name := entry.analyzer.Name()
+		findings, err := entry.analyzer.Analyze(ctx, root, files)
+		entry.record(len(findings), err)
+		if err != nil {
+			failed[name] = err.Error()
+			continue
+		}
+		for _, finding := range findings {
+			alerts = append(alerts, w.findingAlert(name, finding))
+		}
+	}
+	return alerts, failed
+}
+
+// findingAlert normalizes an analyzer's finding into an alert
+func (w *Watchdog) findingAlert(analyzer string, finding Finding) Alert {
+	alertType := finding.Type
+	if alertType == "" {
+		alertType = AlertTypePattern
+	}
+	severity := finding.Severity
+	if _, ok := severityRank[severity]; !ok {
+		severity = AlertSeverityWarning
+	}
+	rule := analyzer
+	if finding.Rule != "" {
+		rule += "/" + finding.Rule
+	}
+
+	context := map[string]interface{}{
+		"analyzer": analyzer,
+		"rule":     rule,
+		"file":     finding.File,
+	}
+	if finding.Line > 0 {
+		context["line"] = finding.Line
+	}
+	if finding.Column > 0 {
+		context["column"] = finding.Column
+	}
+	if finding.Snippet != "" {
+		context["match"] = finding.Snippet[:min(len(finding.Snippet), 100)]
+	}
+
+	position := finding.File
+	if finding.Line > 0 {
+		position = fmt.Sprintf("%s:%d", finding.File, finding.Line)
+	}
+	return w.createAlert(alertType, severity, rule, fmt.Sprintf("%s (%s)", finding.Message, position), context)
+}
+
+// analyzerStats reports each registered analyzer's runs
+func (w *Watchdog) analyzerStats() map[string]interface{} {
+	stats := make(map[string]interface{}, len(w.analyzers))
+	for _, entry := range w.analyzers {
+		stats[entry.analyzer.Name()] = entry.stats()
+	}
+	return stats
+}
+
+// CommandAnalyzerConfig configures a linter run through the terminal manager
+type CommandAnalyzerConfig struct {
+	Name       string
+	Command    string   // shell command; {files} and {dirs} expand to the quoted files and their directories as ./dir
+	Format     string   // FormatGosec, FormatStaticcheck, FormatESLint or FormatText
+	Extensions []string // file extensions it checks, e.g. ".go"; empty checks every file
+	Severity   string   // severity of text findings; warning by default
+	Type       string   // alert type of its findings; gosec's are security, the rest pattern
+	Timeout    time.Duration
+}
+
+// analyzerPresets are the linters WATCHDOG_ANALYZERS can name without a command
+var analyzerPresets = map[string]CommandAnalyzerConfig{
+	"gosec": {
+		Command:    "gosec -fmt=json -quiet -no-fail {dirs}",
+		Format:     FormatGosec,
+		Extensions: []string{".go"},
+		Type:       AlertTypeSecurity,
+	},
+	"staticcheck": {
+		Command:    "staticcheck -f json {dirs}",
+		Format:     FormatStaticcheck,
+		Extensions: []string{".go"},
+	},
+	"eslint": {
+		Command:    "npx --no-install eslint -f json --no-error-on-unmatched-pattern {files}",
+		Format:     FormatESLint,
+		Extensions: []string{".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs"},
+	},
+}
+
+// AnalyzersFromEnv creates the analyzers named in WATCHDOG_ANALYZERS, e.g.
+// "gosec,staticcheck,eslint". gosec, staticcheck and eslint have presets;
+// any analyzer's WATCHDOG_ANALYZER_<NAME>_COMMAND, _FORMAT and _EXTENSIONS
+// override them, and other names need at least a command. Each run is
+// bounded by WATCHDOG_ANALYZER_TIMEOUT_SECONDS.
+func AnalyzersFromEnv(terminals *terminal.Manager) ([]*CommandAnalyzer, error) {
+	timeout := time.Duration(getEnvInt("WATCHDOG_ANALYZER_TIMEOUT_SECONDS", 120)) * time.Second
+
+	analyzers := make([]*CommandAnalyzer, 0)
+	for _, name := range splitList(getEnv("WATCHDOG_ANALYZERS", "")) {
+		prefix := "WATCHDOG_ANALYZER_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_"
+
+		config := analyzerPresets[name]
+		config.Name = name
+		config.Timeout = timeout
+		config.Command = getEnv(prefix+"COMMAND", config.Command)
+		config.Format = getEnv(prefix+"FORMAT", config.Format)
+		if extensions := getEnv(prefix+"EXTENSIONS", ""); extensions != "" {
+			config.Extensions = splitList(extensions)
+		}
+		config.Severity = getEnv(prefix+"SEVERITY", config.Severity)
+
+		analyzer, err := NewCommandAnalyzer(config, terminals)
+		if err != nil {
+			return analyzers, err
+		}
+		analyzers = append(analyzers, analyzer)
+	}
+	return analyzers, nil
+}
+
+// CommandAnalyzer runs an external linter in a sandboxed terminal session
+// in the workspace and parses its report
+type CommandAnalyzer struct {
+	config    CommandAnalyzerConfig
+	terminals *terminal.Manager
+}
+
+// NewCommandAnalyzer creates an analyzer running config.Command in terminals
+func NewCommandAnalyzer(config CommandAnalyzerConfig, terminals *terminal.Manager) (*CommandAnalyzer, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("analyzer name is required")
+	}
+	if strings.TrimSpace(config.Command) == "" {
+		return nil, fmt.Errorf("analyzer %s has no command", config.Name)
+	}
+	if config.Format == "" {
+		config.Format = FormatText
+	}
+	switch config.Format {
+	case FormatGosec, FormatStaticcheck, FormatESLint, FormatText:
+	default:
+		return nil, fmt.Errorf("analyzer %s has unknown format %q", config.Name, config.Format)
+	}
+	if config.Severity == "" {
+		config.Severity = AlertSeverityWarning
+	}
+	if _, ok := severityRank[config.Severity]; !ok {
+		return nil, fmt.Errorf("analyzer %s has unknown severity %q", config.Name, config.Severity)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Minute
+	}
+	if terminals == nil {
+		return nil, fmt.Errorf("analyzer %s needs a terminal manager", config.Name)
+	}
+
+	return &CommandAnalyzer{config: config, terminals: terminals}, nil
+}
+
+// Name returns the analyzer's name
+func (a *CommandAnalyzer) Name() string {
+	return a.config.Name
+}
+
+// Analyze runs the command over the files it handles. Linters exit with a
+// failure status when they find something, so the status only matters
+// when the report can't be parsed.
+func (a *CommandAnalyzer) Analyze(ctx context.Context, root string, files []string) ([]Finding, error) {
+	files = a.handled(files)
+	if len(files) == 0 {
+		return nil, nil
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace: %w", err)
+	}
+
+	outDir, err := os.MkdirTemp("", "watchdog-analyzer-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+	stdout, stderr := filepath.Join(outDir, "stdout"), filepath.Join(outDir, "stderr")
+
+	sessionID := fmt.Sprintf("analyzer-%s-%d", a.config.Name, analyzerSeq.Add(1))
+	session, err := a.terminals.CreateSandboxSession(sessionID, root, sandboxEnv())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	defer a.terminals.CloseSession(sessionID)
+
+	ctx, cancel := context.WithTimeout(ctx, a.config.Timeout)
+	defer cancel()
+
+	output, err := session.ExecuteWithContext(ctx, fmt.Sprintf(`(%s) > %s 2> %s; echo "%s$?"`,
+		a.command(files), shellQuote(stdout), shellQuote(stderr), exitMarker))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", a.config.Name, err)
+	}
+	status := -1
+	if match := exitStatusPattern.FindStringSubmatch(output); match != nil {
+		status, _ = strconv.Atoi(match[1])
+	}
+
+	report := []byte(readTail(stdout, maxAnalyzerOutput))
+	findings, err := a.parse(report)
+	if err != nil || len(findings) == 0 && status != 0 && len(bytes.TrimSpace(report)) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no report")
+		}
+		return nil, fmt.Errorf("%s exited with status %d: %w: %s", a.config.Name, status, err,
+			strings.TrimSpace(readTail(stderr, analyzerErrorTail)))
+	}
+
+	// Tools report absolute paths or paths relative to the workspace; keep
+	// the findings in the files asked about
+	wanted := make(map[string]bool, len(files))
+	for _, file := range files {
+		wanted[file] = true
+	}
+	kept := make([]Finding, 0, len(findings))
+	for _, finding := range findings {
+		finding.File = workspaceRelative(root, finding.File)
+		if finding.Type == "" {
+			finding.Type = a.config.Type
+		}
+		if wanted[finding.File] && len(kept) < maxAnalyzerFindings {
+			kept = append(kept, finding)
+		}
+	}
+	return kept, nil
+}
+
+// handled returns the files with one of the analyzer's extensions
+func (a *CommandAnalyzer) handled(files []string) []string {
+	if len(a.config.Extensions) == 0 {
+		return files
+	}
+	handled := make([]string, 0, len(files))
+	for _, file := range files {
+		for _, ext := range a.config.Extensions {
+			if strings.HasSuffix(file, ext) {
+				handled = append(handled, file)
+				break
+			}
+		}
+	}
+	return handled
+}
+
+// command expands {files} and {dirs} in the configured command
+func (a *CommandAnalyzer) command(files []string) string {
+	quoted := make([]string, len(files))
+	dirSet := make(map[string]bool)
+	for i, file := range files {
+		quoted[i] = shellQuote(file)
+		dir := path.Dir(file)
+		if dir != "." {
+			dir = "./" + dir
+		}
+		dirSet[shellQuote(dir)] = true
+	}
+	dirs := make([]string, 0, len(dirSet))
+	for dir := range dirSet {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	return strings.NewReplacer("{files}", strings.Join(quoted, " "), "{dirs}", strings.Join(dirs, " ")).Replace(a.config.Command)
+}
+
+// parse reads a report in the analyzer's format
+func (a *CommandAnalyzer) parse(report []byte) ([]Finding, error) {
+	switch a.config.Format {
+	case FormatGosec:
+		return parseGosec(report)
+	case FormatStaticcheck:
+		return parseStaticcheck(report)
+	case FormatESLint:
+		return parseESLint(report)
+	default:
+		return parseTextFindings(report, a.config.Severity), nil
+	}
+}
+
+// parseGosec reads gosec's JSON report
+func parseGosec(report []byte) ([]Finding, error) {
+	var parsed struct {
+		Issues []struct {
+			Severity string `json:"severity"`
+			RuleID   string `json:"rule_id"`
+			Details  string `json:"details"`
+			File     string `json:"file"`
+			Code     string `json:"code"`
+			Line     string `json:"line"` // "12" or a range, "12-14"
+			Column   string `json:"column"`
+		} `json:"Issues"`
+	}
+	if err := json.Unmarshal(report, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse gosec report: %w", err)
+	}
+
+	findings := make([]Finding, 0, len(parsed.Issues))
+	for _, issue := range parsed.Issues {
+		line, _, _ := strings.Cut(issue.Line, "-")
+		severity := AlertSeverityWarning
+		switch strings.ToUpper(issue.Severity) {
+		case "HIGH":
+			severity = AlertSeverityError
+		case "LOW":
+			severity = AlertSeverityInfo
+		}
+		findings = append(findings, Finding{
+			Rule:     issue.RuleID,
+			Severity: severity,
+			Message:  issue.Details,
+			File:     issue.File,
+			Line:     atoiOr(line, 0),
+			Column:   atoiOr(issue.Column, 0),
+			Snippet:  strings.TrimSpace(issue.Code),
+		})
+	}
+	return findings, nil
+}
+
+// parseStaticcheck reads staticcheck's JSON lines. Bugs (SA checks) are
+// errors, simplifications and quick fixes informational, the rest warnings.
+func parseStaticcheck(report []byte) ([]Finding, error) {
+	findings := make([]Finding, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(report))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var problem struct {
+			Code     string `json:"code"`
+			Location struct {
+				File   string `json:"file"`
+				Line   int    `json:"line"`
+				Column int    `json:"column"`
+			} `json:"location"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(line, &problem); err != nil {
+			return nil, fmt.Errorf("failed to parse staticcheck report: %w", err)
+		}
+
+		severity := AlertSeverityWarning
+		switch {
+		case strings.HasPrefix(problem.Code, "SA"), problem.Code == "compile":
+			severity = AlertSeverityError
+		case strings.HasPrefix(problem.Code, "S1"), strings.HasPrefix(problem.Code, "QF"):
+			severity = AlertSeverityInfo
+		}
+		findings = append(findings, Finding{
+			Rule:     problem.Code,
+			Severity: severity,
+			Message:  problem.Message,
+			File:     problem.Location.File,
+			Line:     problem.Location.Line,
+			Column:   problem.Location.Column,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read staticcheck report: %w", err)
+	}
+	return findings, nil
+}
+
+// parseESLint reads eslint's JSON report; severity 2 is an error
+func parseESLint(report []byte) ([]Finding, error) {
+	var results []struct {
+		FilePath string `json:"filePath"`
+		Messages []struct {
+			RuleID   string `json:"ruleId"`
+			Severity int    `json:"severity"`
+			Message  string `json:"message"`
+			Line     int    `json:"line"`
+			Column   int    `json:"column"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(report, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse eslint report: %w", err)
+	}
+
+	findings := make([]Finding, 0)
+	for _, result := range results {
+		for _, message := range result.Messages {
+			severity := AlertSeverityWarning
+			if message.Severity >= 2 {
+				severity = AlertSeverityError
+			}
+			rule := message.RuleID
+			if rule == "" {
+				rule = "parse" // eslint couldn't parse the file
+			}
+			findings = append(findings, Finding{
+				Rule:     rule,
+				Severity: severity,
+				Message:  message.Message,
+				File:     result.FilePath,
+				Line:     message.Line,
+				Column:   message.Column,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// parseTextFindings reads "file:line[:column]: message" lines, skipping
+// anything else the tool prints
+func parseTextFindings(report []byte, severity string) []Finding {
+	findings := make([]Finding, 0)
+	for _, line := range strings.Split(string(report), "\n") {
+		match := textFindingPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		findings = append(findings, Finding{
+			Severity: severity,
+			Message:  match[4],
+			File:     match[1],
+			Line:     atoiOr(match[2], 0),
+			Column:   atoiOr(match[3], 0),
+		})
+	}
+	return findings
+}
+
+// workspaceRelative turns a reported path into a slash-separated path
+// relative to root
+func workspaceRelative(root, file string) string {
+	if filepath.IsAbs(file) {
+		if rel, err := filepath.Rel(root, file); err == nil {
+			file = rel
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(file)), "./")
+}
+
+// analyzeChanged runs the analyzers over a file the watcher saw change
+func (w *Watchdog) analyzeChanged(root, rel string) []Alert {
+	ctx, cancel := w.checkContext(analyzerWatchTimeout)
+	defer cancel()
+
+	alerts, failed := w.runAnalyzers(ctx, root, []string{rel})
+	for name, err := range failed {
+		slog.Warn("analyzer failed", "analyzer", name, "file", rel, "error", err)
+	}
+	return alerts
+}
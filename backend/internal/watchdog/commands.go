@@ -0,0 +1,375 @@
+package watchdog
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"agent-workspace/backend/internal/terminal"
+)
+
+const (
+	// maxSeenCommands caps the commands remembered as seen; later ones are
+	// treated as new each time they touch a sensitive path
+	maxSeenCommands = 10000
+	// maxCommandOutput is how much of a command's output an alert quotes
+	maxCommandOutput = 500
+)
+
+// defaultSensitivePaths are path fragments (containing "/") and file name
+// globs that make a command sensitive
+const defaultSensitivePaths = "/etc/,.ssh/,.aws/,.kube/,.gnupg/,/boot/,/var/lib/,.ssh,.env,.env.*,*.pem,*.key,id_rsa*,id_ed25519*,shadow,sudoers,.git-credentials,.netrc"
+
+// defaultDestructiveCommands match commands that destroy data or the machine
+var defaultDestructiveCommands = []string{
+	`\brm\s+(-\w*\s+)*-\w*[rRfF]`,
+	`\bmkfs(\.\w+)?\b`,
+	`\bdd\b.*\bof=/dev/`,
+	`>\s*/dev/(sd|hd|nvme|disk)`,
+	`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`,
+	`\bchmod\s+(-R\s+)?0?777\b`,
+	`\bgit\s+push\b.*(--force\b|\s-f\b)`,
+	`\bgit\s+(reset\s+--hard|clean\s+-\w*f)`,
+	`(?i)\b(drop\s+(table|database|schema)|truncate\s+table)\b`,
+	`\b(shutdown|reboot|halt|poweroff)\b`,
+	`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z)?sh\b`,
+	`\bkill\s+-9\s+-1\b`,
+}
+
+// CommandMonitorConfig configures terminal command anomaly detection
+type CommandMonitorConfig struct {
+	SensitivePaths []string         // path fragments and file name globs; a new command touching one is flagged
+	Destructive    []*regexp.Regexp // AI-sourced commands matching one are flagged
+	FailureWindow  int              // recent commands the failure rate is measured over
+	FailureRate    float64          // recent failure rate that is a spike when it's also double the earlier rate
+}
+
+// DefaultCommandMonitorConfig flags sensitive paths, the built-in
+// destructive patterns and half of the last 20 commands failing
+func DefaultCommandMonitorConfig() CommandMonitorConfig {
+	config := CommandMonitorConfig{
+		SensitivePaths: splitList(defaultSensitivePaths),
+		FailureWindow:  20,
+		FailureRate:    0.5,
+	}
+	for _, expr := range defaultDestructiveCommands {
+		config.Destructive = append(config.Destructive, regexp.MustCompile(expr))
+	}
+	return config
+}
+
+// CommandMonitorConfigFromEnv reads WATCHDOG_SENSITIVE_PATHS,
+// WATCHDOG_DESTRUCTIVE_COMMANDS (added to the built-in patterns),
+// WATCHDOG_COMMAND_FAILURE_WINDOW and WATCHDOG_COMMAND_FAILURE_RATE
+func CommandMonitorConfigFromEnv() (CommandMonitorConfig, error) {
+	config := DefaultCommandMonitorConfig()
+	config.SensitivePaths = splitList(getEnv("WATCHDOG_SENSITIVE_PATHS", defaultSensitivePaths))
+	config.FailureWindow = getEnvInt("WATCHDOG_COMMAND_FAILURE_WINDOW", config.FailureWindow)
+
+	for _, expr := range splitList(getEnv("WATCHDOG_DESTRUCTIVE_COMMANDS", "")) {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return config, fmt.Errorf("invalid destructive command pattern %q: %w", expr, err)
+		}
+		config.Destructive = append(config.Destructive, pattern)
+	}
+
+	if value := getEnv("WATCHDOG_COMMAND_FAILURE_RATE", ""); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid WATCHDOG_COMMAND_FAILURE_RATE %q: %w", value, err)
+		}
+		config.FailureRate = rate
+	}
+
+	return config, nil
+}
+
+// CommandAnomaly is a terminal command the monitor flagged
+type CommandAnomaly struct {
+	Rule    string // "new_sensitive_command", "destructive_ai_command" or "command_failure_spike"
+	Title   string
+	Message string
+	Entry   terminal.CommandEntry
+	Context map[string]interface{} // rule-specific details
+}
+
+// CommandMonitor flags anomalies in the terminal command history: commands
+// never seen before that touch sensitive paths, AI-sourced commands matching
+// destructive patterns, and the failure rate spiking above its earlier level.
+// A spike is reported once and again only after the rate has recovered.
+type CommandMonitor struct {
+	config CommandMonitorConfig
+
+	mu       sync.Mutex
+	seen     map[string]bool // normalized commands already run
+	outcomes []bool          // whether each of the last FailureWindow commands failed, oldest first
+	earlier  int             // commands before the window
+	failed   int             // failed commands before the window
+	spiking  bool
+	checked  int
+	flagged  int
+}
+
+// NewCommandMonitor creates a command monitor
+func NewCommandMonitor(config CommandMonitorConfig) (*CommandMonitor, error) {
+	if config.FailureWindow < 2 {
+		return nil, fmt.Errorf("failure window must be at least 2, got %d", config.FailureWindow)
+	}
+	if config.FailureRate <= 0 || config.FailureRate > 1 {
+		return nil, fmt.Errorf("failure rate must be in (0, 1], got %g", config.FailureRate)
+	}
+
+	return &CommandMonitor{
+		config:   config,
+		seen:     make(map[string]bool),
+		outcomes: make([]bool, 0, config.FailureWindow),
+	}, nil
+}
+
+// Stats reports how many commands were checked and flagged
+func (m *CommandMonitor) Stats() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return map[string]interface{}{
+		"checked":      m.checked,
+		"flagged":      m.flagged,
+		"known":        len(m.seen),
+		"failure_rate": failureRate(m.outcomes),
+		"spiking":      m.spiking,
+	}
+}
+
+// Learn records commands as seen without checking them, e.g. the history
+// from before the monitor started
+func (m *CommandMonitor) Learn(entries []terminal.CommandEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range entries {
+		m.rememberLocked(normalizeCommand(entry.Command))
+		m.recordOutcomeLocked(entry.ExitCode != 0)
+	}
+	m.spiking = m.spikeLocked()
+}
+
+// Check records a command and returns the anomalies it shows
+func (m *CommandMonitor) Check(entry terminal.CommandEntry) []CommandAnomaly {
+	command := normalizeCommand(entry.Command)
+	anomalies := make([]CommandAnomaly, 0)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checked++
+	if !m.seen[command] {
+		if paths := m.sensitivePaths(entry.Command); len(paths) > 0 {
+			anomalies = append(anomalies, CommandAnomaly{
+				Rule:    "new_sensitive_command",
+				Title:   "New Command Touching Sensitive Paths",
+				Message: fmt.Sprintf("A %s command never run before touched %s: %s", sourceName(entry.Source), strings.Join(paths, ", "), firstLine(entry.Command)),
+				Entry:   entry,
+				Context: map[string]interface{}{"paths": paths},
+			})
+		}
+		m.rememberLocked(command)
+	}
+
+	if entry.Source == "ai" {
+		for _, pattern := range m.config.Destructive {
+			if match := pattern.FindString(entry.Command); match != "" {
+				anomalies = append(anomalies, CommandAnomaly{
+					Rule:    "destructive_ai_command",
+					Title:   "Destructive AI Command",
+					Message: fmt.Sprintf("An AI-sourced command matches a destructive pattern (%s): %s", strings.TrimSpace(match), firstLine(entry.Command)),
+					Entry:   entry,
+					Context: map[string]interface{}{"destructive_pattern": pattern.String(), "matched": match},
+				})
+				break
+			}
+		}
+	}
+
+	m.recordOutcomeLocked(entry.ExitCode != 0)
+	spiking := m.spikeLocked()
+	if spiking && !m.spiking {
+		rate, earlier := failureRate(m.outcomes), m.earlierRateLocked()
+		anomalies = append(anomalies, CommandAnomaly{
+			Rule:    "command_failure_spike",
+			Title:   "Command Failure Spike",
+			Message: fmt.Sprintf("%.0f%% of the last %d commands failed, up from %.0f%% before", rate*100, len(m.outcomes), earlier*100),
+			Entry:   entry,
+			Context: map[string]interface{}{
+				"failure_rate":         rate,
+				"earlier_failure_rate": earlier,
+				"window":               len(m.outcomes),
+			},
+		})
+	}
+	m.spiking = spiking
+
+	m.flagged += len(anomalies)
+	return anomalies
+}
+
+// rememberLocked marks a command as seen; callers must hold m.mu
+func (m *CommandMonitor) rememberLocked(command string) {
+	if len(m.seen) < maxSeenCommands {
+		m.seen[command] = true
+	}
+}
+
+// recordOutcomeLocked slides the failure window; callers must hold m.mu
+func (m *CommandMonitor) recordOutcomeLocked(failed bool) {
+	if len(m.outcomes) == m.config.FailureWindow {
+		m.earlier++
+		if m.outcomes[0] {
+			m.failed++
+		}
+		m.outcomes = append(m.outcomes[:0], m.outcomes[1:]...)
+	}
+	m.outcomes = append(m.outcomes, failed)
+}
+
+// spikeLocked reports whether the full window's failure rate reaches the
+// threshold and is at least double the earlier rate; callers must hold m.mu
+func (m *CommandMonitor) spikeLocked() bool {
+	if len(m.outcomes) < m.config.FailureWindow {
+		return false
+	}
+	rate := failureRate(m.outcomes)
+	return rate >= m.config.FailureRate && rate >= 2*m.earlierRateLocked()
+}
+
+// earlierRateLocked is the failure rate before the window; callers must hold m.mu
+func (m *CommandMonitor) earlierRateLocked() float64 {
+	if m.earlier == 0 {
+		return 0
+	}
+	return float64(m.failed) / float64(m.earlier)
+}
+
+// sensitivePaths returns the arguments of command that touch sensitive paths
+func (m *CommandMonitor) sensitivePaths(command string) []string {
+	paths := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, arg := range strings.FieldsFunc(command, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == ';' || r == '|' || r == '&' || r == '<' || r == '>' || r == '(' || r == ')'
+	}) {
+		arg = strings.Trim(arg, `"'`)
+		if _, value, ok := strings.Cut(arg, "="); ok && !strings.HasPrefix(arg, "-") {
+			arg = value // VAR=/path and key=/path arguments
+		}
+		if arg == "" || seen[arg] {
+			continue
+		}
+
+		for _, sensitive := range m.config.SensitivePaths {
+			matched := false
+			if strings.Contains(sensitive, "/") {
+				matched = strings.Contains(arg, sensitive) || strings.TrimSuffix(arg, "/")+"/" == sensitive
+			} else {
+				matched, _ = path.Match(sensitive, path.Base(arg))
+			}
+			if matched {
+				seen[arg] = true
+				paths = append(paths, arg)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// normalizeCommand collapses whitespace so trivially different spellings of
+// a command count as the same
+func normalizeCommand(command string) string {
+	return strings.Join(strings.Fields(command), " ")
+}
+
+// failureRate is the fraction of outcomes that failed
+func failureRate(outcomes []bool) float64 {
+	if len(outcomes) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, outcome := range outcomes {
+		if outcome {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(outcomes))
+}
+
+func sourceName(source string) string {
+	if source == "ai" {
+		return "AI-sourced"
+	}
+	if source == "" {
+		return "terminal"
+	}
+	return source
+}
+
+// WatchCommands checks every command added to history for anomalies until
+// the watchdog is stopped. Commands already in the history are learned as
+// seen rather than checked.
+func (w *Watchdog) WatchCommands(monitor *CommandMonitor, history *terminal.CommandHistory) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.config.Enabled {
+		return fmt.Errorf("watchdog disabled")
+	}
+	if w.commands != nil {
+		return fmt.Errorf("watchdog already watching terminal commands")
+	}
+
+	entries, cancel := history.Subscribe()
+	monitor.Learn(history.GetAll())
+	w.commands = monitor
+	w.stopCommands = cancel
+
+	go func() {
+		for entry := range entries {
+			alerts := make([]Alert, 0)
+			for _, anomaly := range monitor.Check(entry) {
+				alerts = append(alerts, w.commandAlert(anomaly))
+			}
+			w.recordAlerts(alerts...)
+		}
+	}()
+
+	return nil
+}
+
+// commandAlert raises the error alert for an anomalous command
+func (w *Watchdog) commandAlert(anomaly CommandAnomaly) Alert {
+	entry := anomaly.Entry
+	output := strings.TrimSpace(entry.Output)
+	if len(output) > maxCommandOutput {
+		output = output[len(output)-maxCommandOutput:] // the end usually says what went wrong
+	}
+
+	context := map[string]interface{}{
+		"rule":       anomaly.Rule,
+		"command":    entry.Command,
+		"command_id": entry.ID,
+		"source":     entry.Source,
+		"session_id": entry.SessionID,
+		"exit_code":  entry.ExitCode,
+		"error":      entry.Error,
+		"output":     output,
+		"started_at": entry.StartTime,
+		"duration":   entry.Duration.String(),
+	}
+	for key, value := range anomaly.Context {
+		context[key] = value
+	}
+
+	return w.createAlert(AlertTypeCommand, AlertSeverityError, anomaly.Title, anomaly.Message, context)
+}
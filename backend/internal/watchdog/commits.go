@@ -0,0 +1,447 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+const (
+	// commitContext asks git for enough context that a hunk is the whole
+	// file, so Go files still parse when only their hunks are analyzed
+	commitContext = "-U1000000"
+	// maxCommitReports is how many analyzed commits are kept for the API
+	maxCommitReports = 100
+	// commitPollTimeout bounds one poll for new commits
+	commitPollTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrInvalidCommit is returned for malformed commit checks
+	ErrInvalidCommit = errors.New("invalid commit check")
+	// ErrCommitsDisabled is returned when commits aren't being monitored
+	ErrCommitsDisabled = errors.New("commit monitoring disabled")
+)
+
+// CommitMonitorConfig configures commit monitoring
+type CommitMonitorConfig struct {
+	Workspace        string
+	Interval         time.Duration
+	MaxPerPoll       int // newer commits first; older ones in a burst are skipped
+	MaxFileBytes     int64
+	AgentAuthors     []string // patterns matched against author names and emails
+	BlockAgentErrors bool     // refuse agent commits that introduce error findings
+}
+
+// DefaultCommitMonitorConfig treats the pipeline's identity and bots as agents
+func DefaultCommitMonitorConfig() CommitMonitorConfig {
+	return CommitMonitorConfig{
+		Workspace:        ".",
+		Interval:         30 * time.Second,
+		MaxPerPoll:       50,
+		MaxFileBytes:     512 * 1024,
+		AgentAuthors:     splitList("watchdog@localhost,*[[]bot]"),
+		BlockAgentErrors: true,
+	}
+}
+
+// CommitMonitorConfigFromEnv reads WORKSPACE_ROOT, WATCHDOG_MAX_FILE_KB and
+// the WATCHDOG_COMMIT_* and WATCHDOG_AGENT_AUTHORS variables
+func CommitMonitorConfigFromEnv() CommitMonitorConfig {
+	config := DefaultCommitMonitorConfig()
+	config.Workspace = getEnv("WORKSPACE_ROOT", config.Workspace)
+	config.Interval = time.Duration(getEnvInt("WATCHDOG_COMMIT_POLL_SECONDS", 30)) * time.Second
+	config.MaxPerPoll = getEnvInt("WATCHDOG_COMMIT_MAX_PER_POLL", config.MaxPerPoll)
+	config.MaxFileBytes = int64(getEnvInt("WATCHDOG_MAX_FILE_KB", 512)) * 1024
+	if authors := getEnv("WATCHDOG_AGENT_AUTHORS", ""); authors != "" {
+		config.AgentAuthors = splitList(authors)
+	}
+	config.BlockAgentErrors = getEnv("WATCHDOG_BLOCK_AGENT_COMMITS", "true") != "false"
+	return config
+}
+
+// CommitReport is what the analyzers found in one commit's changes
+type CommitReport struct {
+	SHA      string         `json:"sha,omitempty"` // empty for a commit checked before it's made
+	Author   string         `json:"author"`
+	Email    string         `json:"email"`
+	Agent    bool           `json:"agent"` // authored by an agent rather than a human
+	Subject  string         `json:"subject,omitempty"`
+	Time     time.Time      `json:"time"`
+	Files    []string       `json:"files"`
+	Findings []Alert        `json:"findings"`
+	Counts   map[string]int `json:"counts"` // findings by severity
+	Blocked  bool           `json:"blocked"`
+}
+
+// CommitMonitor analyzes new commits in the workspace's repository
+type CommitMonitor struct {
+	config CommitMonitorConfig
+
+	mu       sync.Mutex
+	head     string // the last commit polled; "" until the first poll
+	analyzed int
+	reports  []CommitReport
+}
+
+// NewCommitMonitor creates a commit monitor
+func NewCommitMonitor(config CommitMonitorConfig) *CommitMonitor {
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.MaxPerPoll <= 0 {
+		config.MaxPerPoll = 50
+	}
+	return &CommitMonitor{config: config, reports: make([]CommitReport, 0)}
+}
+
+// Stats returns commit monitoring counters
+func (m *CommitMonitor) Stats() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return map[string]interface{}{
+		"head":     m.head,
+		"analyzed": m.analyzed,
+		"blocking": m.config.BlockAgentErrors,
+	}
+}
+
+// Reports returns the most recently analyzed commits, newest first
+func (m *CommitMonitor) Reports() []CommitReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reports := make([]CommitReport, len(m.reports))
+	for i, report := range m.reports {
+		reports[len(m.reports)-1-i] = report
+	}
+	return reports
+}
+
+// IsAgent reports whether an author name or email belongs to an agent
+func (m *CommitMonitor) IsAgent(name, email string) bool {
+	return matchAny(m.config.AgentAuthors, strings.ToLower(name)) || matchAny(m.config.AgentAuthors, strings.ToLower(email))
+}
+
+// blocks reports whether a commit with report's findings is refused
+func (m *CommitMonitor) blocks(report *CommitReport) bool {
+	return m.config.BlockAgentErrors && report.Agent && report.Counts[AlertSeverityError] > 0
+}
+
+// WatchCommits polls the workspace's repository for new commits and
+// analyzes them until the watchdog is stopped. Commits made before the
+// first poll are left alone.
+func (w *Watchdog) WatchCommits(monitor *CommitMonitor) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.config.Enabled {
+		return fmt.Errorf("watchdog disabled")
+	}
+	if !w.running {
+		return fmt.Errorf("watchdog not running")
+	}
+	if w.commits != nil {
+		return fmt.Errorf("watchdog already watching commits")
+	}
+	w.commits = monitor
+
+	stopCh := w.stopCh
+	go func() {
+		ticker := time.NewTicker(monitor.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			w.pollCommits(monitor)
+
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// CommitReports returns the most recently analyzed commits
+func (w *Watchdog) CommitReports() ([]CommitReport, error) {
+	monitor := w.commitMonitor()
+	if monitor == nil {
+		return nil, ErrCommitsDisabled
+	}
+	return monitor.Reports(), nil
+}
+
+// CheckCommit analyzes a commit before it's made, e.g. from a pre-commit
+// hook, and reports whether it's blocked. Blocked commits raise an alert.
+func (w *Watchdog) CheckCommit(req models.CommitCheckRequest) (*CommitReport, error) {
+	monitor := w.commitMonitor()
+	if monitor == nil {
+		return nil, ErrCommitsDisabled
+	}
+	if strings.TrimSpace(req.Diff) == "" {
+		return nil, fmt.Errorf("%w: diff is required", ErrInvalidCommit)
+	}
+	if req.Author == "" && req.Email == "" {
+		return nil, fmt.Errorf("%w: author or email is required", ErrInvalidCommit)
+	}
+
+	diffs, err := parseUnifiedDiff(req.Diff)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCommit, err)
+	}
+
+	report := &CommitReport{
+		Author: req.Author,
+		Email:  req.Email,
+		Agent:  monitor.IsAgent(req.Author, req.Email),
+		Time:   time.Now(),
+	}
+	monitor.analyzeDiffs(w, report, diffs)
+	report.Blocked = monitor.blocks(report)
+
+	if report.Blocked {
+		w.recordAlerts(w.createAlert(AlertTypeCommit, AlertSeverityError, "Agent Commit Blocked",
+			fmt.Sprintf("Blocked a commit by %s that introduces %d error findings", authorName(report), report.Counts[AlertSeverityError]),
+			map[string]interface{}{
+				"rule":         "agent_commit_blocked",
+				"author":       report.Author,
+				"author_email": report.Email,
+				"files":        report.Files,
+				"findings":     findingTitles(report.Findings, AlertSeverityError),
+			}))
+	}
+
+	return report, nil
+}
+
+// commitMonitor returns the commit monitor, or nil when commits aren't watched
+func (w *Watchdog) commitMonitor() *CommitMonitor {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.commits
+}
+
+// pollCommits analyzes the commits made since the last poll
+func (w *Watchdog) pollCommits(monitor *CommitMonitor) {
+	ctx, cancel := w.checkContext(commitPollTimeout)
+	defer cancel()
+
+	head, err := git(ctx, monitor.config.Workspace, "rev-parse", "HEAD")
+	if err != nil {
+		slog.Warn("commit monitoring failed", "error", err)
+		return
+	}
+
+	monitor.mu.Lock()
+	last := monitor.head
+	monitor.mu.Unlock()
+	if last == "" || last == head {
+		monitor.mu.Lock()
+		monitor.head = head
+		monitor.mu.Unlock()
+		return
+	}
+
+	// Merges are skipped; the commits they bring in are analyzed on their own
+	output, err := git(ctx, monitor.config.Workspace, "rev-list", "--no-merges", "--reverse",
+		fmt.Sprintf("--max-count=%d", monitor.config.MaxPerPoll), head, "^"+last)
+	if err != nil {
+		// The last commit may be gone after a rebase; start again from here
+		slog.Warn("commit monitoring restarting from HEAD", "error", err)
+		monitor.mu.Lock()
+		monitor.head = head
+		monitor.mu.Unlock()
+		return
+	}
+
+	commits := strings.Fields(output)
+	for i, sha := range commits {
+		if ctx.Err() != nil {
+			slog.Warn("commit monitoring timed out", "skipped", len(commits)-i)
+			break
+		}
+
+		report, err := monitor.analyze(ctx, w, monitor.config.Workspace, sha)
+		if err != nil {
+			slog.Warn("failed to analyze commit", "commit", sha, "error", err)
+			continue
+		}
+		w.recordAlerts(report.Findings...)
+		if report.Agent && report.Counts[AlertSeverityError] > 0 {
+			w.recordAlerts(w.createAlert(AlertTypeCommit, AlertSeverityError, "Agent Commit Introduced Errors",
+				fmt.Sprintf("Commit %s by %s introduces %d error findings", shortSHA(sha), authorName(report), report.Counts[AlertSeverityError]),
+				map[string]interface{}{
+					"rule":         "agent_commit_errors",
+					"match":        sha,
+					"commit":       sha,
+					"author":       report.Author,
+					"author_email": report.Email,
+					"subject":      report.Subject,
+					"findings":     findingTitles(report.Findings, AlertSeverityError),
+				}))
+		}
+	}
+
+	monitor.mu.Lock()
+	monitor.head = head
+	monitor.mu.Unlock()
+}
+
+// analyze reads a commit from the repository in dir and runs the analyzers
+// over the lines it adds. Findings carry the commit and its author.
+func (m *CommitMonitor) analyze(ctx context.Context, w *Watchdog, dir, sha string) (*CommitReport, error) {
+	meta, err := git(ctx, dir, "log", "-1", "--format=%an%x00%ae%x00%aI%x00%s", sha)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(meta, "\x00", 4)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("unexpected commit metadata for %s", sha)
+	}
+	authored, _ := time.Parse(time.RFC3339, fields[2])
+
+	// --relative keeps paths relative to the workspace like the watcher's
+	cmd := exec.CommandContext(ctx, "git", "diff-tree", "-p", "--root", "--no-commit-id", "--relative",
+		"--no-color", "--no-ext-diff", commitContext, sha)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commit %s: %w", sha, err)
+	}
+	diffs, err := parseUnifiedDiff(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse commit %s: %w", sha, err)
+	}
+
+	report := &CommitReport{
+		SHA:     sha,
+		Author:  fields[0],
+		Email:   fields[1],
+		Agent:   m.IsAgent(fields[0], fields[1]),
+		Subject: fields[3],
+		Time:    authored,
+	}
+	m.analyzeDiffs(w, report, diffs)
+
+	m.mu.Lock()
+	m.analyzed++
+	m.reports = append(m.reports, *report)
+	if len(m.reports) > maxCommitReports {
+		m.reports = m.reports[len(m.reports)-maxCommitReports:]
+	}
+	m.mu.Unlock()
+
+	return report, nil
+}
+
+// analyzeDiffs fills in a report's files and findings
+func (m *CommitMonitor) analyzeDiffs(w *Watchdog, report *CommitReport, diffs []FileDiff) {
+	report.Files = make([]string, 0, len(diffs))
+	for _, diff := range diffs {
+		report.Files = append(report.Files, diff.Path)
+	}
+	report.Findings = analyzeHunks(NewAlertGenerator(w), diffs, m.config.MaxFileBytes)
+	report.Counts = make(map[string]int)
+
+	for _, alert := range report.Findings {
+		report.Counts[alert.Severity]++
+		if report.SHA != "" {
+			alert.Context["commit"] = report.SHA
+		}
+		alert.Context["author"] = report.Author
+		alert.Context["author_email"] = report.Email
+		alert.Context["agent_authored"] = report.Agent
+	}
+}
+
+// analyzeHunks runs the analyzers over each hunk's new side and keeps the
+// findings on lines the hunk adds. A finding without a line is kept when
+// the hunk's old side doesn't have it too.
+func analyzeHunks(generator *AlertGenerator, diffs []FileDiff, maxBytes int64) []Alert {
+	alerts := make([]Alert, 0)
+
+	for _, diff := range diffs {
+		if diff.Binary || diff.Status == FileDeleted || diff.Additions == 0 {
+			continue
+		}
+
+		for _, hunk := range diff.Hunks {
+			var before, after strings.Builder
+			added := make(map[int]bool) // lines of after that the hunk adds
+			lines := 0
+			for _, line := range hunk.Lines {
+				if line.Type != DiffAdd {
+					before.WriteString(line.Content + "\n")
+				}
+				if line.Type != DiffDelete {
+					lines++
+					after.WriteString(line.Content + "\n")
+					if line.Type == DiffAdd {
+						added[lines] = true
+					}
+				}
+			}
+			if len(added) == 0 || int64(after.Len()) > maxBytes {
+				continue
+			}
+
+			var existing map[string]bool
+			for _, alert := range generator.AnalyzeCode(after.String(), diff.Path) {
+				if line := contextLine(alert.Context); line > 0 {
+					if !added[line] {
+						continue
+					}
+					alert.Context["line"] = hunk.NewStart + line - 1
+				} else {
+					if existing == nil {
+						existing = make(map[string]bool)
+						for _, old := range generator.AnalyzeCode(before.String(), diff.Path) {
+							existing[old.Fingerprint] = true
+						}
+					}
+					if existing[alert.Fingerprint] {
+						continue
+					}
+				}
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+
+	return alerts
+}
+
+// findingTitles lists the titles of findings of one severity
+func findingTitles(findings []Alert, severity string) []string {
+	titles := make([]string, 0)
+	for _, finding := range findings {
+		if finding.Severity == severity {
+			titles = append(titles, finding.Title)
+		}
+	}
+	return titles
+}
+
+// authorName names a commit's author in text
+func authorName(report *CommitReport) string {
+	if report.Email == "" {
+		return report.Author
+	}
+	return fmt.Sprintf("%s <%s>", report.Author, report.Email)
+}
+
+func shortSHA(sha string) string {
+	return sha[:min(len(sha), 12)]
+}
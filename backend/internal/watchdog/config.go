@@ -0,0 +1,79 @@
+package watchdog
+
+import (
+	"log/slog"
+	"time"
+
+	"agent-workspace/backend/internal/memory"
+)
+
+// Severity thresholds for Config.AlertThreshold
+const (
+	SeverityInfo    = AlertSeverityInfo
+	SeverityWarning = AlertSeverityWarning
+	SeverityError   = AlertSeverityError
+)
+
+const (
+	defaultScanInterval  = 30 * time.Second
+	defaultAlertCooldown = time.Hour
+)
+
+// severityRank orders severities so alerts can be compared to a threshold
+var severityRank = map[string]int{
+	AlertSeverityInfo:    0,
+	AlertSeverityWarning: 1,
+	AlertSeverityError:   2,
+}
+
+// Config configures the watchdog
+type Config struct {
+	Enabled        bool          // a disabled watchdog refuses to start or watch files
+	ScanInterval   time.Duration // how often the monitoring checks run
+	MinConfidence  float64       // detections less certain than this don't raise alerts
+	AlertThreshold string        // alerts below this severity are discarded
+	AlertCooldown  time.Duration // repeats of an open alert within this window only bump its occurrence count
+	Memory         *memory.System
+}
+
+// DefaultConfig returns an enabled watchdog that keeps every alert and has no memory
+func DefaultConfig() *Config {
+	return &Config{
+		Enabled:        true,
+		ScanInterval:   defaultScanInterval,
+		MinConfidence:  0,
+		AlertThreshold: SeverityInfo,
+		AlertCooldown:  defaultAlertCooldown,
+	}
+}
+
+// normalize fills in defaults for unset or invalid fields
+func (c Config) normalize() Config {
+	if c.ScanInterval <= 0 {
+		c.ScanInterval = defaultScanInterval
+	}
+	if c.AlertCooldown <= 0 {
+		c.AlertCooldown = defaultAlertCooldown
+	}
+	if c.AlertThreshold == "" {
+		c.AlertThreshold = SeverityInfo
+	}
+	if _, ok := severityRank[c.AlertThreshold]; !ok {
+		slog.Warn("unknown watchdog alert threshold, keeping all alerts", "threshold", c.AlertThreshold)
+		c.AlertThreshold = SeverityInfo
+	}
+	return c
+}
+
+// longTerm returns the long-term memory, or nil when there is none
+func (c Config) longTerm() *memory.LongTermMemory {
+	if c.Memory == nil {
+		return nil
+	}
+	return c.Memory.LongTerm
+}
+
+// meetsThreshold reports whether an alert is severe enough to keep
+func (c Config) meetsThreshold(alert Alert) bool {
+	return severityRank[alert.Severity] >= severityRank[c.AlertThreshold]
+}
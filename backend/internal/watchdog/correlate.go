@@ -0,0 +1,435 @@
+package watchdog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+const (
+	// maxGroupSamples is how many example alerts a group keeps for drafting
+	maxGroupSamples = 5
+	// maxGroupFiles caps the files listed on a group
+	maxGroupFiles = 20
+	// excerptContext is how many lines around an alert go into the prompt
+	excerptContext = 3
+)
+
+// CorrelationConfig configures drafting proposals from recurring alerts
+type CorrelationConfig struct {
+	Threshold int           // alerts in one group within Window that draft a proposal; zero disables drafting
+	Window    time.Duration // how far back alerts count towards the threshold
+	Workspace string        // alert file paths are relative to it
+}
+
+// CorrelationConfigFromEnv reads WATCHDOG_CORRELATION_THRESHOLD,
+// WATCHDOG_CORRELATION_WINDOW_HOURS and WORKSPACE_ROOT
+func CorrelationConfigFromEnv() CorrelationConfig {
+	return CorrelationConfig{
+		Threshold: getEnvInt("WATCHDOG_CORRELATION_THRESHOLD", 5),
+		Window:    time.Duration(getEnvInt("WATCHDOG_CORRELATION_WINDOW_HOURS", 24)) * time.Hour,
+		Workspace: getEnv("WORKSPACE_ROOT", "."),
+	}
+}
+
+// AlertGroup collects alerts raised by the same rule in the same package
+type AlertGroup struct {
+	Key        string    `json:"key"`
+	Type       string    `json:"type"`
+	Rule       string    `json:"rule"`
+	Package    string    `json:"package"` // directory of the alerts' files; empty for the workspace root
+	Files      []string  `json:"files"`
+	Recent     int       `json:"recent"` // alerts within the window
+	Total      int       `json:"total"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	ProposalID string    `json:"proposal_id,omitempty"` // the latest proposal drafted for the group
+
+	seen     []time.Time
+	samples  []Alert
+	drafting bool
+}
+
+// Correlator groups recurring alerts and drafts a proposal when a group
+// crosses the threshold. Its state is guarded by the watchdog's mu.
+type Correlator struct {
+	config CorrelationConfig
+	llm    llm.Provider // nil drafts proposals without an LLM
+	groups map[string]*AlertGroup
+}
+
+// NewCorrelator creates a correlator; llm may be nil
+func NewCorrelator(config CorrelationConfig, llm llm.Provider) *Correlator {
+	if config.Window <= 0 {
+		config.Window = 24 * time.Hour
+	}
+	return &Correlator{
+		config: config,
+		llm:    llm,
+		groups: make(map[string]*AlertGroup),
+	}
+}
+
+// SetCorrelator drafts proposals from recurring alerts from now on
+func (w *Watchdog) SetCorrelator(correlator *Correlator) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.correlator = correlator
+}
+
+// AlertGroups returns the recurring alert groups, most recent first
+func (w *Watchdog) AlertGroups() []AlertGroup {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	groups := make([]AlertGroup, 0)
+	if w.correlator == nil {
+		return groups
+	}
+
+	cutoff := time.Now().Add(-w.correlator.config.Window)
+	for _, group := range w.correlator.groups {
+		snapshot := group.snapshot()
+		snapshot.Recent = countSince(group.seen, cutoff)
+		groups = append(groups, snapshot)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].LastSeen.After(groups[j].LastSeen)
+	})
+	return groups
+}
+
+// observeLocked adds alerts to their groups and starts drafting for groups
+// that crossed the threshold; callers must hold w.mu
+func (w *Watchdog) observeLocked(alerts ...Alert) {
+	c := w.correlator
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-c.config.Window)
+
+	for _, alert := range alerts {
+		key, rule, pkg, file, ok := correlationKey(alert)
+		if !ok {
+			continue
+		}
+
+		group, exists := c.groups[key]
+		if !exists {
+			group = &AlertGroup{Key: key, Type: alert.Type, Rule: rule, Package: pkg, Files: make([]string, 0), FirstSeen: alert.Timestamp}
+			c.groups[key] = group
+		}
+
+		group.seen = append(pruneBefore(group.seen, cutoff), alert.Timestamp)
+		group.Total++
+		group.LastSeen = alert.Timestamp
+		if file != "" && len(group.Files) < maxGroupFiles && !containsString(group.Files, file) {
+			group.Files = append(group.Files, file)
+		}
+		group.samples = append(group.samples, alert)
+		if len(group.samples) > maxGroupSamples {
+			group.samples = group.samples[len(group.samples)-maxGroupSamples:]
+		}
+
+		if c.config.Threshold > 0 && len(group.seen) >= c.config.Threshold && !group.drafting && !w.proposalOpenLocked(group.ProposalID) {
+			group.drafting = true
+			snapshot := group.snapshot()
+			snapshot.Recent = len(group.seen)
+			go w.draftProposal(c, snapshot)
+		}
+	}
+
+	// Forget quiet groups unless a proposal is still being worked on
+	for key, group := range c.groups {
+		if group.LastSeen.Before(cutoff) && !group.drafting && !w.proposalOpenLocked(group.ProposalID) {
+			delete(c.groups, key)
+		}
+	}
+}
+
+// proposalOpenLocked reports whether a proposal still awaits a decision or
+// an outcome; callers must hold w.mu
+func (w *Watchdog) proposalOpenLocked(id string) bool {
+	proposal, exists := w.proposals[id]
+	if !exists {
+		return false
+	}
+
+	switch proposal.Status {
+	case ProposalDraft, ProposalReview:
+		return true
+	case ProposalApproved:
+		return proposal.Execution == nil || proposal.Execution.Status != ExecutionRolledBack && proposal.Execution.Status != ExecutionApplied
+	default:
+		return false
+	}
+}
+
+// draftProposal submits a proposal for a group that crossed the threshold
+func (w *Watchdog) draftProposal(c *Correlator, group AlertGroup) {
+	description, changes := c.draft(group)
+
+	component := group.Package
+	if component == "" {
+		component = "workspace"
+	}
+	id, err := w.SubmitProposal(models.ProposalRequest{
+		Component:   component,
+		Description: description,
+		Changes:     changes,
+		Strategy:    "alert_correlation",
+		Author:      "watchdog",
+	})
+
+	w.mu.Lock()
+	if current, exists := c.groups[group.Key]; exists {
+		current.drafting = false
+		if err == nil {
+			current.ProposalID = id
+			current.seen = nil
+		}
+	}
+	w.mu.Unlock()
+
+	if err != nil {
+		slog.Warn("failed to draft proposal for recurring alerts", "rule", group.Rule, "error", err)
+		return
+	}
+	slog.Info("drafted proposal for recurring alerts", "proposal_id", id, "alerts", group.Recent, "rule", group.Rule, "component", component)
+}
+
+// draft describes a fix for a group, asking the LLM when there is one and
+// falling back to the alerts' own recommendations
+func (c *Correlator) draft(group AlertGroup) (string, map[string]interface{}) {
+	changes := map[string]interface{}{
+		"source": "alert_correlation",
+		"group": map[string]interface{}{
+			"type":    group.Type,
+			"rule":    group.Rule,
+			"package": group.Package,
+			"files":   group.Files,
+			"count":   group.Recent,
+		},
+	}
+
+	fallback := fmt.Sprintf("Recurring %s alert %q: raised %d times in %s within %s",
+		group.Type, group.Rule, group.Recent, packageName(group.Package), c.config.Window)
+	suggestions := make([]string, 0)
+	for _, alert := range group.samples {
+		if recommendation, ok := alert.Context["recommendation"].(string); ok && !containsString(suggestions, recommendation) {
+			suggestions = append(suggestions, recommendation)
+		}
+	}
+	changes["suggestions"] = suggestions
+
+	if c.llm == nil {
+		return fallback, changes
+	}
+
+	drafted, err := c.ask(group)
+	if err != nil {
+		slog.Warn("drafting proposal without the LLM", "error", err)
+		return fallback, changes
+	}
+
+	if len(drafted.Suggestions) > 0 {
+		changes["suggestions"] = drafted.Suggestions
+	}
+	if strings.TrimSpace(drafted.Patch) != "" {
+		// A malformed patch would get the whole proposal refused
+		if _, err := parseUnifiedDiff(drafted.Patch); err != nil {
+			slog.Warn("dropping the LLM's patch", "error", err)
+		} else {
+			changes["patch"] = drafted.Patch
+		}
+	}
+	return drafted.Description, changes
+}
+
+// draftedProposal is the LLM's answer
+type draftedProposal struct {
+	Description string   `json:"description"`
+	Suggestions []string `json:"suggestions"`
+	Patch       string   `json:"patch"`
+}
+
+// ask has the LLM explain the recurring alerts and suggest a fix
+func (c *Correlator) ask(group AlertGroup) (*draftedProposal, error) {
+	var examples strings.Builder
+	for _, alert := range group.samples {
+		file, _ := alert.Context["file"].(string)
+		fmt.Fprintf(&examples, "- %s: %s\n", alert.Title, alert.Message)
+		if excerpt := c.excerpt(file, contextLine(alert.Context)); excerpt != "" {
+			fmt.Fprintf(&examples, "  %s:\n%s", file, excerpt)
+		}
+	}
+
+	prompt := fmt.Sprintf(`The same code watchdog alert keeps recurring. Propose a fix for the root cause.
+
+Alert type: %s
+Rule: %s
+Package: %s
+Raised %d times in the last %s, in: %s
+
+Examples:
+%s
+Respond with only a JSON object:
+{"description": "1-3 sentences on the root cause and the fix", "suggestions": ["concrete change"], "patch": "unified diff with paths relative to the workspace root, or empty if unsure"}`,
+		group.Type, group.Rule, packageName(group.Package), group.Recent, c.config.Window,
+		strings.Join(group.Files, ", "), examples.String())
+
+	resp, err := c.llm.ChatCompletion(llm.WithPriority(context.Background(), llm.PriorityBackground), llm.Request{
+		Messages:    []ollama.ChatMessage{{Role: "user", Content: prompt}},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to draft proposal: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("failed to draft proposal: empty response")
+	}
+
+	return parseDraftedProposal(resp.Choices[0].Message.Content)
+}
+
+// parseDraftedProposal decodes the LLM's JSON, tolerating surrounding prose or code fences
+func parseDraftedProposal(text string) (*draftedProposal, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON object in proposal response")
+	}
+
+	var drafted draftedProposal
+	if err := json.Unmarshal([]byte(text[start:end+1]), &drafted); err != nil {
+		return nil, fmt.Errorf("failed to parse proposal: %w", err)
+	}
+	if strings.TrimSpace(drafted.Description) == "" {
+		return nil, fmt.Errorf("proposal response has no description")
+	}
+
+	return &drafted, nil
+}
+
+// excerpt returns the numbered lines around line in a workspace file
+func (c *Correlator) excerpt(file string, line int) string {
+	if file == "" || line <= 0 || !filepath.IsLocal(file) {
+		return ""
+	}
+
+	f, err := os.Open(filepath.Join(c.config.Workspace, file))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var excerpt strings.Builder
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan() && n <= line+excerptContext; n++ {
+		if n >= line-excerptContext {
+			fmt.Fprintf(&excerpt, "  %4d | %s\n", n, scanner.Text())
+		}
+	}
+	return excerpt.String()
+}
+
+// snapshot copies a group's exported fields
+func (g *AlertGroup) snapshot() AlertGroup {
+	return AlertGroup{
+		Key:        g.Key,
+		Type:       g.Type,
+		Rule:       g.Rule,
+		Package:    g.Package,
+		Files:      append([]string(nil), g.Files...),
+		Recent:     len(g.seen),
+		Total:      g.Total,
+		FirstSeen:  g.FirstSeen,
+		LastSeen:   g.LastSeen,
+		ProposalID: g.ProposalID,
+		samples:    append([]Alert(nil), g.samples...),
+	}
+}
+
+// correlationKey groups an alert by type, rule and package. Proposal alerts
+// aren't grouped, so drafted proposals can't feed back into drafting.
+func correlationKey(alert Alert) (key, rule, pkg, file string, ok bool) {
+	if alert.Type == AlertTypeProposal {
+		return "", "", "", "", false
+	}
+
+	rule, _ = alert.Context["rule"].(string)
+	if rule == "" {
+		rule, _ = alert.Context["pattern"].(string)
+	}
+	if rule == "" {
+		rule = alert.Title
+	}
+
+	file, _ = alert.Context["file"].(string)
+	if file != "" {
+		if pkg = path.Dir(filepath.ToSlash(file)); pkg == "." {
+			pkg = ""
+		}
+	}
+
+	return alert.Type + "\x00" + rule + "\x00" + pkg, rule, pkg, file, true
+}
+
+// contextLine reads an alert's line number, which is a float64 once the
+// alert has been through JSON
+func contextLine(context map[string]interface{}) int {
+	switch line := context["line"].(type) {
+	case int:
+		return line
+	case float64:
+		return int(line)
+	default:
+		return 0
+	}
+}
+
+// packageName names a group's package in text
+func packageName(pkg string) string {
+	if pkg == "" {
+		return "the workspace"
+	}
+	return pkg
+}
+
+// pruneBefore drops times before cutoff from a sorted slice
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// countSince counts times at or after cutoff
+func countSince(times []time.Time, cutoff time.Time) int {
+	return len(times) - len(pruneBefore(times, cutoff))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
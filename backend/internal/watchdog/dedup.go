@@ -0,0 +1,120 @@
+package watchdog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// alertFingerprint identifies the issue an alert reports so repeats can be
+// merged: the rule that raised it, the file and a hash of the offending
+// snippet. Line numbers are left out so an issue keeps its fingerprint when
+// code above it moves. Proposal alerts report events rather than issues and
+// get no fingerprint.
+func alertFingerprint(alertType, title, message string, context map[string]interface{}) string {
+	if alertType == AlertTypeProposal {
+		return ""
+	}
+
+	rule, _ := context["rule"].(string)
+	if rule == "" {
+		rule, _ = context["pattern"].(string)
+	}
+	if rule == "" {
+		rule = title
+	}
+	file, _ := context["file"].(string)
+
+	snippet, _ := context["match"].(string)
+	if snippet == "" {
+		snippet, _ = context["code"].(string)
+	}
+	if snippet == "" {
+		// Concept drift is about a strategy rather than a snippet
+		snippet, _ = context["strategy"].(string)
+	}
+	if snippet == "" {
+		snippet = message
+	}
+	snippetHash := sha256.Sum256([]byte(snippet))
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%x", alertType, rule, file, snippetHash)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// mergeLocked records alert, folding it into the alert already raised for
+// the same fingerprint. A repeat of a resolved alert reopens it; a repeat of
+// an ignored alert, or of an open or acknowledged one within the cooldown,
+// only counts the occurrence. It returns the alert as recorded and whether
+// it should be raised again. Callers must hold w.mu.
+func (w *Watchdog) mergeLocked(alert Alert) (Alert, bool) {
+	i := -1
+	if alert.Fingerprint != "" {
+		i = w.alertIndexLocked(w.dedup[alert.Fingerprint])
+	}
+	if i < 0 {
+		alert.Deadline = w.sla.deadline(alert.Severity, alert.openedAt())
+		w.alerts = append(w.alerts, alert)
+		if alert.Fingerprint != "" {
+			w.dedup[alert.Fingerprint] = alert.ID
+		}
+		return alert, true
+	}
+
+	existing := &w.alerts[i]
+	existing.Occurrences = max(existing.Occurrences, 1) + 1
+	existing.LastSeen = alert.Timestamp
+	existing.Severity = alert.Severity
+	existing.Message = alert.Message
+	existing.Context = alert.Context // the latest occurrence's line and snippet
+
+	switch existing.state() {
+	case AlertIgnored:
+		return *existing, false
+	case AlertResolved:
+		w.openLocked(existing, alert.Timestamp)
+		existing.Reopened++
+	default:
+		if alert.Timestamp.Sub(existing.LastRaised) < w.config.AlertCooldown {
+			return *existing, false
+		}
+	}
+	existing.LastRaised = alert.Timestamp
+
+	return *existing, true
+}
+
+// alertIndexLocked returns the position of the alert with id, or -1;
+// callers must hold w.mu
+func (w *Watchdog) alertIndexLocked(id string) int {
+	if id == "" {
+		return -1
+	}
+	for i := len(w.alerts) - 1; i >= 0; i-- {
+		if w.alerts[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// reindexLocked rebuilds the fingerprint index after alerts are restored
+// or removed; callers must hold w.mu
+func (w *Watchdog) reindexLocked() {
+	w.dedup = make(map[string]string, len(w.alerts))
+	for _, alert := range w.alerts {
+		if alert.Fingerprint != "" {
+			w.dedup[alert.Fingerprint] = alert.ID
+		}
+	}
+}
+
+// lastSeen returns when an alert last occurred; alerts stored before
+// deduplication only have their timestamp
+func lastSeen(alert Alert) time.Time {
+	if alert.LastSeen.IsZero() {
+		return alert.Timestamp
+	}
+	return alert.LastSeen
+}
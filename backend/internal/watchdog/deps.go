@@ -0,0 +1,835 @@
+package watchdog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/logging"
+)
+
+const (
+	// osvBatchSize is the most queries the OSV batch endpoint accepts at once
+	osvBatchSize = 1000
+	// dependencyScanTimeout bounds one scan, including every OSV request
+	dependencyScanTimeout = 2 * time.Minute
+)
+
+// Ecosystems as OSV names them
+const (
+	EcosystemGo  = "Go"
+	EcosystemNPM = "npm"
+)
+
+// DependencyScannerConfig configures dependency vulnerability scanning
+type DependencyScannerConfig struct {
+	Workspace string
+	Ignore    []string      // directory names that aren't searched for manifests
+	Interval  time.Duration // how often unchanged manifests are checked again
+	APIURL    string        // OSV API base URL
+	CachePath string        // OSV responses are kept here; empty keeps them in memory only
+	CacheTTL  time.Duration // cached responses older than this are fetched again
+	Offline   bool          // only use cached responses, however old
+}
+
+// DependencyScannerConfigFromEnv reads WORKSPACE_ROOT, WATCHDOG_IGNORE,
+// WATCHDOG_DEPENDENCY_SCAN_HOURS, WATCHDOG_OSV_URL, WATCHDOG_OSV_CACHE,
+// WATCHDOG_OSV_CACHE_HOURS and WATCHDOG_OSV_OFFLINE
+func DependencyScannerConfigFromEnv() DependencyScannerConfig {
+	return DependencyScannerConfig{
+		Workspace: getEnv("WORKSPACE_ROOT", "."),
+		Ignore:    splitList(getEnv("WATCHDOG_IGNORE", defaultIgnore)),
+		Interval:  time.Duration(getEnvInt("WATCHDOG_DEPENDENCY_SCAN_HOURS", 6)) * time.Hour,
+		APIURL:    getEnv("WATCHDOG_OSV_URL", "https://api.osv.dev"),
+		CachePath: getEnv("WATCHDOG_OSV_CACHE", "./data/osv_cache.json"),
+		CacheTTL:  time.Duration(getEnvInt("WATCHDOG_OSV_CACHE_HOURS", 24)) * time.Hour,
+		Offline:   getEnv("WATCHDOG_OSV_OFFLINE", "false") == "true",
+	}
+}
+
+// Dependency is a package version pinned by a manifest
+type Dependency struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"` // as written in the manifest
+	Ecosystem string `json:"ecosystem"`
+	Manifest  string `json:"manifest"` // relative to the workspace
+}
+
+// DependencyFinding is a dependency affected by a known vulnerability
+type DependencyFinding struct {
+	Dependency
+	VulnID       string   `json:"vuln_id"`
+	Aliases      []string `json:"aliases,omitempty"`
+	Summary      string   `json:"summary"`
+	Severity     string   `json:"severity"`
+	Affected     []string `json:"affected"`                // affected version ranges, e.g. ">= 1.0.0, < 1.2.3"
+	FixedVersion string   `json:"fixed_version,omitempty"` // lowest fixed version above the current one
+}
+
+// key identifies a finding across scans
+func (f DependencyFinding) key() string {
+	return f.Manifest + "|" + f.Ecosystem + "|" + f.Name + "|" + f.Version + "|" + f.VulnID
+}
+
+// osvVuln is the subset of an OSV vulnerability record the scanner reads
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Aliases  []string `json:"aliases"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced   string `json:"introduced,omitempty"`
+				Fixed        string `json:"fixed,omitempty"`
+				LastAffected string `json:"last_affected,omitempty"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific,omitempty"`
+}
+
+// osvCache keeps OSV responses so scans work offline and don't repeat requests
+type osvCache struct {
+	Queries map[string]osvCachedQuery `json:"queries"` // keyed by ecosystem/name@version
+	Vulns   map[string]osvCachedVuln  `json:"vulns"`   // keyed by vulnerability ID
+}
+
+type osvCachedQuery struct {
+	VulnIDs   []string  `json:"vuln_ids"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+type osvCachedVuln struct {
+	Vuln      osvVuln   `json:"vuln"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// DependencyScanner checks the workspace's go.mod, go.sum and
+// package-lock.json files against the OSV vulnerability database. A
+// package.json without a lock file is skipped since it doesn't pin versions.
+type DependencyScanner struct {
+	config DependencyScannerConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	cache     osvCache
+	manifests map[string]time.Time // manifest path -> modification time when last scanned
+	reported  map[string]bool      // findings that already raised an alert
+	lastScan  time.Time
+	packages  int
+	findings  int
+}
+
+// NewDependencyScanner creates a scanner and loads its OSV cache
+func NewDependencyScanner(config DependencyScannerConfig) (*DependencyScanner, error) {
+	if config.Interval <= 0 {
+		config.Interval = 6 * time.Hour
+	}
+	if config.APIURL == "" {
+		config.APIURL = "https://api.osv.dev"
+	}
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+
+	s := &DependencyScanner{
+		config:    config,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		cache:     osvCache{Queries: make(map[string]osvCachedQuery), Vulns: make(map[string]osvCachedVuln)},
+		manifests: make(map[string]time.Time),
+		reported:  make(map[string]bool),
+	}
+
+	if config.CachePath == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(config.CachePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OSV cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.cache); err != nil {
+		return nil, fmt.Errorf("failed to decode OSV cache: %w", err)
+	}
+	if s.cache.Queries == nil {
+		s.cache.Queries = make(map[string]osvCachedQuery)
+	}
+	if s.cache.Vulns == nil {
+		s.cache.Vulns = make(map[string]osvCachedVuln)
+	}
+
+	return s, nil
+}
+
+// SetDependencyScanner enables dependency vulnerability scanning in the monitoring loop
+func (w *Watchdog) SetDependencyScanner(scanner *DependencyScanner) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.deps = scanner
+}
+
+// Stats returns the scanner's state for the watchdog status
+func (s *DependencyScanner) Stats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return map[string]interface{}{
+		"manifests":  len(s.manifests),
+		"packages":   s.packages,
+		"vulnerable": s.findings,
+		"last_scan":  s.lastScan,
+		"offline":    s.config.Offline,
+	}
+}
+
+// due reports whether the interval has passed or a manifest changed since the last scan
+func (s *DependencyScanner) due(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastScan.IsZero() || now.Sub(s.lastScan) >= s.config.Interval {
+		return true
+	}
+	for path, modTime := range s.manifests {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan checks every manifest in the workspace and returns the findings
+// that haven't been reported before. A failed OSV request falls back to
+// cached responses; the error is returned along with what could be checked.
+func (s *DependencyScanner) Scan(ctx context.Context) ([]DependencyFinding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	manifests, err := s.findManifests()
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make([]Dependency, 0)
+	s.manifests = make(map[string]time.Time, len(manifests))
+	for _, path := range manifests {
+		if info, err := os.Stat(path); err == nil {
+			s.manifests[path] = info.ModTime()
+		}
+		parsed, err := s.parseManifest(path)
+		if err != nil {
+			logging.FromContext(ctx).Warn("skipping dependency manifest", "error", err)
+			continue
+		}
+		deps = append(deps, parsed...)
+	}
+	s.lastScan = time.Now()
+	s.packages = len(deps)
+
+	vulnIDs, queryErr := s.queryVulnIDs(ctx, deps)
+	findings, vulnErr := s.buildFindings(ctx, deps, vulnIDs)
+	if queryErr == nil {
+		queryErr = vulnErr
+	}
+	if err := s.saveCache(); err != nil {
+		logging.FromContext(ctx).Warn("failed to save vulnerability cache", "error", err)
+	}
+	s.findings = len(findings)
+
+	// Findings no longer present are forgotten so they alert again if they
+	// come back, but only when every dependency could be checked
+	fresh := make([]DependencyFinding, 0)
+	current := make(map[string]bool, len(findings))
+	for _, finding := range findings {
+		current[finding.key()] = true
+		if !s.reported[finding.key()] {
+			fresh = append(fresh, finding)
+		}
+	}
+	if queryErr == nil {
+		s.reported = current
+	} else {
+		for key := range current {
+			s.reported[key] = true
+		}
+	}
+
+	return fresh, queryErr
+}
+
+// findManifests walks the workspace for dependency manifests
+func (s *DependencyScanner) findManifests() ([]string, error) {
+	manifests := make([]string, 0)
+	err := filepath.WalkDir(s.config.Workspace, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != s.config.Workspace && matchAny(s.config.Ignore, entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch entry.Name() {
+		case "go.mod", "go.sum", "package-lock.json":
+			manifests = append(manifests, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find dependency manifests: %w", err)
+	}
+	return manifests, nil
+}
+
+// parseManifest reads the dependencies pinned by one manifest
+func (s *DependencyScanner) parseManifest(path string) ([]Dependency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	rel, err := filepath.Rel(s.config.Workspace, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+
+	switch filepath.Base(path) {
+	case "go.mod":
+		return parseGoMod(data, rel), nil
+	case "go.sum":
+		// go.sum lists versions go.mod doesn't, e.g. for modules older
+		// than Go 1.17 that don't record indirect requirements
+		required := make(map[string]bool)
+		if gomod, err := os.ReadFile(filepath.Join(filepath.Dir(path), "go.mod")); err == nil {
+			for _, dep := range parseGoMod(gomod, rel) {
+				required[dep.Name] = true
+			}
+		}
+		deps := make([]Dependency, 0)
+		for _, dep := range parseGoSum(data, rel) {
+			if !required[dep.Name] {
+				deps = append(deps, dep)
+			}
+		}
+		return deps, nil
+	default:
+		deps, err := parsePackageLock(data, rel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return deps, nil
+	}
+}
+
+// parseGoMod reads the require directives of a go.mod; replace directives
+// aren't applied
+func parseGoMod(data []byte, manifest string) []Dependency {
+	deps := make([]Dependency, 0)
+	inBlock := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) == 0:
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		case !inBlock:
+			continue
+		}
+
+		if len(fields) >= 2 {
+			deps = append(deps, Dependency{
+				Name:      strings.Trim(fields[0], `"`),
+				Version:   fields[1],
+				Ecosystem: EcosystemGo,
+				Manifest:  manifest,
+			})
+		}
+	}
+
+	return deps
+}
+
+// parseGoSum returns the highest version of each module in a go.sum,
+// which is the one minimal version selection picks. Lines that only
+// checksum a go.mod file don't put the module's code in the build.
+func parseGoSum(data []byte, manifest string) []Dependency {
+	versions := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		if current, ok := versions[fields[0]]; !ok || compareVersions(fields[1], current) > 0 {
+			versions[fields[0]] = fields[1]
+		}
+	}
+
+	deps := make([]Dependency, 0, len(versions))
+	for name, version := range versions {
+		deps = append(deps, Dependency{Name: name, Version: version, Ecosystem: EcosystemGo, Manifest: manifest})
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Name < deps[j].Name })
+	return deps
+}
+
+// packageLock covers lockfileVersion 1 ("dependencies") and 2/3 ("packages")
+type packageLock struct {
+	Packages map[string]struct {
+		Version string `json:"version"`
+		Link    bool   `json:"link"`
+	} `json:"packages"`
+	Dependencies map[string]lockDependency `json:"dependencies"`
+}
+
+type lockDependency struct {
+	Version      string                    `json:"version"`
+	Dependencies map[string]lockDependency `json:"dependencies"`
+}
+
+// parsePackageLock reads every installed package from a package-lock.json
+func parsePackageLock(data []byte, manifest string) ([]Dependency, error) {
+	var lock packageLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	deps := make([]Dependency, 0)
+	add := func(name, version string) {
+		// Links, git URLs and file: paths have no registry version to look up
+		if name == "" || version == "" || version[0] < '0' || version[0] > '9' || seen[name+"@"+version] {
+			return
+		}
+		seen[name+"@"+version] = true
+		deps = append(deps, Dependency{Name: name, Version: version, Ecosystem: EcosystemNPM, Manifest: manifest})
+	}
+
+	if len(lock.Packages) > 0 {
+		for path, pkg := range lock.Packages {
+			i := strings.LastIndex(path, "node_modules/")
+			if path == "" || pkg.Link || i < 0 {
+				continue
+			}
+			add(path[i+len("node_modules/"):], pkg.Version)
+		}
+	} else {
+		var walk func(map[string]lockDependency)
+		walk = func(dependencies map[string]lockDependency) {
+			for name, dep := range dependencies {
+				add(name, dep.Version)
+				walk(dep.Dependencies)
+			}
+		}
+		walk(lock.Dependencies)
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		return deps[i].Version < deps[j].Version
+	})
+	return deps, nil
+}
+
+// osvVersion converts a manifest version to the form OSV records; Go
+// versions drop their "v" prefix
+func osvVersion(dep Dependency) string {
+	if dep.Ecosystem == EcosystemGo {
+		return strings.TrimPrefix(dep.Version, "v")
+	}
+	return dep.Version
+}
+
+func osvQueryKey(dep Dependency) string {
+	return dep.Ecosystem + "/" + dep.Name + "@" + osvVersion(dep)
+}
+
+// queryVulnIDs looks up the vulnerabilities affecting each dependency,
+// batching the ones that aren't cached or whose cache entry is stale.
+// Callers must hold s.mu.
+func (s *DependencyScanner) queryVulnIDs(ctx context.Context, deps []Dependency) (map[string][]string, error) {
+	results := make(map[string][]string)
+	pending := make([]Dependency, 0)
+	queued := make(map[string]bool)
+
+	for _, dep := range deps {
+		key := osvQueryKey(dep)
+		cached, ok := s.cache.Queries[key]
+		if ok {
+			results[key] = cached.VulnIDs
+		}
+		if !s.config.Offline && (!ok || time.Since(cached.FetchedAt) > s.config.CacheTTL) && !queued[key] {
+			queued[key] = true
+			pending = append(pending, dep)
+		}
+	}
+
+	for start := 0; start < len(pending); start += osvBatchSize {
+		batch := pending[start:min(len(pending), start+osvBatchSize)]
+
+		type query struct {
+			Package struct {
+				Name      string `json:"name"`
+				Ecosystem string `json:"ecosystem"`
+			} `json:"package"`
+			Version string `json:"version"`
+		}
+		request := struct {
+			Queries []query `json:"queries"`
+		}{Queries: make([]query, len(batch))}
+		for i, dep := range batch {
+			request.Queries[i].Package.Name = dep.Name
+			request.Queries[i].Package.Ecosystem = dep.Ecosystem
+			request.Queries[i].Version = osvVersion(dep)
+		}
+
+		var response struct {
+			Results []struct {
+				Vulns []struct {
+					ID string `json:"id"`
+				} `json:"vulns"`
+			} `json:"results"`
+		}
+		if err := s.osvRequest(ctx, http.MethodPost, "/v1/querybatch", request, &response); err != nil {
+			return results, err
+		}
+		if len(response.Results) != len(batch) {
+			return results, fmt.Errorf("OSV returned %d results for %d queries", len(response.Results), len(batch))
+		}
+
+		for i, dep := range batch {
+			ids := make([]string, 0, len(response.Results[i].Vulns))
+			for _, vuln := range response.Results[i].Vulns {
+				ids = append(ids, vuln.ID)
+			}
+			key := osvQueryKey(dep)
+			results[key] = ids
+			s.cache.Queries[key] = osvCachedQuery{VulnIDs: ids, FetchedAt: time.Now()}
+		}
+	}
+
+	return results, nil
+}
+
+// vuln returns a vulnerability record, fetching it when it isn't cached or
+// is stale. Callers must hold s.mu.
+func (s *DependencyScanner) vuln(ctx context.Context, id string) (osvVuln, error) {
+	cached, ok := s.cache.Vulns[id]
+	if ok && (s.config.Offline || time.Since(cached.FetchedAt) <= s.config.CacheTTL) {
+		return cached.Vuln, nil
+	}
+	if s.config.Offline {
+		return osvVuln{}, fmt.Errorf("vulnerability %s isn't cached", id)
+	}
+
+	var vuln osvVuln
+	if err := s.osvRequest(ctx, http.MethodGet, "/v1/vulns/"+url.PathEscape(id), nil, &vuln); err != nil {
+		if ok {
+			return cached.Vuln, err
+		}
+		return osvVuln{}, err
+	}
+	s.cache.Vulns[id] = osvCachedVuln{Vuln: vuln, FetchedAt: time.Now()}
+	return vuln, nil
+}
+
+// buildFindings turns vulnerability IDs into findings with affected ranges
+// and fixed versions. Callers must hold s.mu.
+func (s *DependencyScanner) buildFindings(ctx context.Context, deps []Dependency, vulnIDs map[string][]string) ([]DependencyFinding, error) {
+	findings := make([]DependencyFinding, 0)
+	var firstErr error
+
+	for _, dep := range deps {
+		for _, id := range vulnIDs[osvQueryKey(dep)] {
+			vuln, err := s.vuln(ctx, id)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+
+			finding := DependencyFinding{
+				Dependency: dep,
+				VulnID:     id,
+				Aliases:    vuln.Aliases,
+				Summary:    vuln.Summary,
+				Severity:   osvSeverity(vuln),
+				Affected:   make([]string, 0),
+			}
+			if finding.Summary == "" {
+				finding.Summary = firstLine(vuln.Details)
+			}
+			if vuln.ID != "" {
+				finding.Affected, finding.FixedVersion = affectedRanges(vuln, dep)
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings, firstErr
+}
+
+// osvRequest sends a request to the OSV API and decodes its JSON response
+func (s *DependencyScanner) osvRequest(ctx context.Context, method, path string, payload, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode OSV request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.config.APIURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create OSV request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query OSV: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OSV returned %s for %s", resp.Status, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode OSV response: %w", err)
+	}
+	return nil
+}
+
+// saveCache writes the OSV cache through a temporary file; callers must hold s.mu
+func (s *DependencyScanner) saveCache() error {
+	if s.config.CachePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.cache)
+	if err != nil {
+		return fmt.Errorf("failed to encode OSV cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.config.CachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create OSV cache directory: %w", err)
+	}
+	tmp := s.config.CachePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write OSV cache: %w", err)
+	}
+	if err := os.Rename(tmp, s.config.CachePath); err != nil {
+		return fmt.Errorf("failed to write OSV cache: %w", err)
+	}
+
+	return nil
+}
+
+// affectedRanges describes the ranges of vuln that cover dep's package and
+// picks the lowest fixed version above dep's version
+func affectedRanges(vuln osvVuln, dep Dependency) ([]string, string) {
+	current := osvVersion(dep)
+	ranges := make([]string, 0)
+	fixed := ""
+
+	for _, affected := range vuln.Affected {
+		if affected.Package.Name != dep.Name || affected.Package.Ecosystem != dep.Ecosystem {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			if r.Type == "GIT" {
+				continue
+			}
+			introduced := ""
+			for _, event := range r.Events {
+				switch {
+				case event.Introduced != "":
+					introduced = event.Introduced
+				case event.Fixed != "":
+					ranges = append(ranges, describeRange(introduced, "< "+event.Fixed))
+					if compareVersions(event.Fixed, current) > 0 && (fixed == "" || compareVersions(event.Fixed, fixed) < 0) {
+						fixed = event.Fixed
+					}
+					introduced = ""
+				case event.LastAffected != "":
+					ranges = append(ranges, describeRange(introduced, "<= "+event.LastAffected))
+					introduced = ""
+				}
+			}
+			if introduced != "" {
+				ranges = append(ranges, describeRange(introduced, ""))
+			}
+		}
+	}
+
+	if fixed != "" && dep.Ecosystem == EcosystemGo {
+		fixed = "v" + fixed
+	}
+	return ranges, fixed
+}
+
+// describeRange formats a range; an introduced version of "0" means every
+// earlier version is affected
+func describeRange(introduced, upper string) string {
+	if introduced == "" || introduced == "0" {
+		if upper == "" {
+			return "all versions"
+		}
+		return upper
+	}
+	if upper == "" {
+		return ">= " + introduced
+	}
+	return ">= " + introduced + ", " + upper
+}
+
+// osvSeverity maps the GitHub advisory severity OSV carries to an alert
+// severity; advisories without one, like the Go database's, are warnings
+func osvSeverity(vuln osvVuln) string {
+	severity, _ := vuln.DatabaseSpecific["severity"].(string)
+	switch strings.ToUpper(severity) {
+	case "CRITICAL", "HIGH":
+		return AlertSeverityError
+	default:
+		return AlertSeverityWarning
+	}
+}
+
+// compareVersions compares semantic versions, with or without a "v"
+// prefix, returning -1, 0 or 1. Non-numeric parts compare as strings.
+func compareVersions(a, b string) int {
+	splitVersion := func(v string) (string, string) {
+		v = strings.TrimPrefix(v, "v")
+		if i := strings.Index(v, "+"); i >= 0 {
+			v = v[:i]
+		}
+		if i := strings.Index(v, "-"); i >= 0 {
+			return v[:i], v[i+1:]
+		}
+		return v, ""
+	}
+
+	coreA, preA := splitVersion(a)
+	coreB, preB := splitVersion(b)
+	if c := compareIdentifiers(strings.Split(coreA, "."), strings.Split(coreB, ".")); c != 0 {
+		return c
+	}
+
+	// A pre-release sorts before the release it precedes
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareIdentifiers(strings.Split(preA, "."), strings.Split(preB, "."))
+}
+
+// compareIdentifiers compares dot-separated identifiers; missing ones sort first
+func compareIdentifiers(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i >= len(a) {
+			return -1
+		}
+		if i >= len(b) {
+			return 1
+		}
+		numA, errA := strconv.Atoi(a[i])
+		numB, errB := strconv.Atoi(b[i])
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// dependencyAlert raises the alert for a vulnerable dependency
+func (w *Watchdog) dependencyAlert(finding DependencyFinding) Alert {
+	advice := "No fixed version has been published yet"
+	if finding.FixedVersion != "" {
+		advice = "Upgrade to " + finding.FixedVersion + " or later"
+	}
+	summary := finding.Summary
+	if summary == "" {
+		summary = "see " + finding.VulnID
+	}
+
+	return w.createAlert(AlertTypeDependency, finding.Severity, "Vulnerable Dependency",
+		fmt.Sprintf("%s %s in %s is affected by %s: %s. %s", finding.Name, finding.Version, finding.Manifest, finding.VulnID, summary, advice),
+		map[string]interface{}{
+			"rule":          "vulnerable_dependency",
+			"file":          finding.Manifest,
+			"package":       finding.Name,
+			"version":       finding.Version,
+			"ecosystem":     finding.Ecosystem,
+			"vulnerability": finding.VulnID,
+			"aliases":       finding.Aliases,
+			"affected":      finding.Affected,
+			"fixed_version": finding.FixedVersion,
+			"url":           "https://osv.dev/vulnerability/" + finding.VulnID,
+		})
+}
@@ -0,0 +1,358 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Diff line types
+const (
+	DiffContext = "context"
+	DiffAdd     = "add"
+	DiffDelete  = "delete"
+)
+
+// File diff statuses
+const (
+	FileAdded    = "added"
+	FileModified = "modified"
+	FileDeleted  = "deleted"
+	FileRenamed  = "renamed"
+)
+
+// diffTimeout bounds rendering one proposal's changes
+const diffTimeout = 30 * time.Second
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+// FileDiff is one file's changes in a proposal, ready for rendering
+type FileDiff struct {
+	Path      string     `json:"path"`
+	OldPath   string     `json:"old_path,omitempty"` // set when the file was renamed
+	Status    string     `json:"status"`             // "added", "modified", "deleted" or "renamed"
+	Binary    bool       `json:"binary,omitempty"`
+	Additions int        `json:"additions"`
+	Deletions int        `json:"deletions"`
+	Hunks     []DiffHunk `json:"hunks"`
+}
+
+// DiffHunk is a run of changed lines with their context
+type DiffHunk struct {
+	Header   string     `json:"header"` // the text after the line ranges, usually the enclosing function
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// DiffLine is a line of a hunk with its numbers in the old and new file
+type DiffLine struct {
+	Type    string `json:"type"` // "context", "add" or "delete"
+	Content string `json:"content"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// renderChanges turns a proposal's changes into file diffs: a patch is
+// parsed as is and whole-file contents are compared with the workspace
+func renderChanges(ctx context.Context, workspace string, changes map[string]interface{}) ([]FileDiff, error) {
+	diffs := make([]FileDiff, 0)
+
+	if patch, _ := changes["patch"].(string); strings.TrimSpace(patch) != "" {
+		parsed, err := parseUnifiedDiff(patch)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProposal, err)
+		}
+		diffs = append(diffs, parsed...)
+	}
+
+	files, _ := changes["files"].(map[string]interface{})
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		diff, err := diffFile(ctx, workspace, path, files[path])
+		if err != nil {
+			return nil, err
+		}
+		if diff != nil {
+			diffs = append(diffs, *diff)
+		}
+	}
+
+	return diffs, nil
+}
+
+// diffFile compares a file in the workspace with its proposed content; nil
+// content deletes the file. It returns nil when nothing changes.
+func diffFile(ctx context.Context, workspace, path string, content interface{}) (*FileDiff, error) {
+	dir, err := os.MkdirTemp("", "proposal-diff-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create diff directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldPath, newPath := os.DevNull, os.DevNull
+	current, err := os.ReadFile(filepath.Join(workspace, path))
+	switch {
+	case err == nil:
+		oldPath = filepath.Join(dir, "old")
+		if err := os.WriteFile(oldPath, current, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write diff input: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if proposed, ok := content.(string); ok {
+		newPath = filepath.Join(dir, "new")
+		if err := os.WriteFile(newPath, []byte(proposed), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write diff input: %w", err)
+		}
+	}
+	if oldPath == os.DevNull && newPath == os.DevNull {
+		return nil, nil // deleting a file that doesn't exist
+	}
+
+	// git diff exits 1 when the files differ
+	cmd := exec.CommandContext(ctx, "git", "diff", "--no-index", "--no-color", "--no-ext-diff", "-U3", "--", oldPath, newPath)
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return nil, fmt.Errorf("failed to diff %s: %w", path, err)
+	}
+	if len(output) == 0 {
+		return nil, nil
+	}
+
+	parsed, err := parseUnifiedDiff(string(output))
+	if err != nil || len(parsed) != 1 {
+		return nil, fmt.Errorf("failed to parse diff of %s: %v", path, err)
+	}
+	diff := parsed[0]
+	diff.Path = filepath.ToSlash(path) // git reports the temporary files' names
+	diff.OldPath = ""
+	switch {
+	case oldPath == os.DevNull:
+		diff.Status = FileAdded
+	case newPath == os.DevNull:
+		diff.Status = FileDeleted
+	default:
+		diff.Status = FileModified
+	}
+	return &diff, nil
+}
+
+// parseUnifiedDiff parses git or plain unified diff output
+func parseUnifiedDiff(patch string) ([]FileDiff, error) {
+	diffs := make([]FileDiff, 0)
+	var file *FileDiff
+	var hunk *DiffHunk
+	oldLeft, newLeft, oldLine, newLine := 0, 0, 0, 0
+
+	flush := func() {
+		if file != nil {
+			if hunk != nil {
+				file.Hunks = append(file.Hunks, *hunk)
+				hunk = nil
+			}
+			diffs = append(diffs, *file)
+			file = nil
+		}
+	}
+	start := func() {
+		flush()
+		file = &FileDiff{Status: FileModified, Hunks: make([]DiffHunk, 0)}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		// Inside a hunk every line belongs to it until its ranges are used up
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				hunk.Lines = append(hunk.Lines, DiffLine{Type: DiffAdd, Content: line[1:], NewLine: newLine})
+				file.Additions++
+				newLine++
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				hunk.Lines = append(hunk.Lines, DiffLine{Type: DiffDelete, Content: line[1:], OldLine: oldLine})
+				file.Deletions++
+				oldLine++
+				oldLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				content := strings.TrimPrefix(line, " ")
+				hunk.Lines = append(hunk.Lines, DiffLine{Type: DiffContext, Content: content, OldLine: oldLine, NewLine: newLine})
+				oldLine++
+				newLine++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			start()
+			if _, b, ok := strings.Cut(line, " b/"); ok {
+				file.Path = b
+			}
+		case strings.HasPrefix(line, "--- "):
+			if file == nil || len(file.Hunks) > 0 || hunk != nil {
+				start()
+			}
+			if path := diffPath(line[4:]); path == "" {
+				file.Status = FileAdded
+			} else {
+				file.OldPath = path
+			}
+		case strings.HasPrefix(line, "+++ ") && file != nil:
+			if path := diffPath(line[4:]); path == "" {
+				file.Status = FileDeleted
+				file.Path = file.OldPath
+			} else {
+				file.Path = path
+			}
+		case strings.HasPrefix(line, "new file mode") && file != nil:
+			file.Status = FileAdded
+		case strings.HasPrefix(line, "deleted file mode") && file != nil:
+			file.Status = FileDeleted
+		case strings.HasPrefix(line, "rename from ") && file != nil:
+			file.OldPath = strings.TrimPrefix(line, "rename from ")
+			file.Status = FileRenamed
+		case strings.HasPrefix(line, "rename to ") && file != nil:
+			file.Path = strings.TrimPrefix(line, "rename to ")
+			file.Status = FileRenamed
+		case (strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch") && file != nil:
+			file.Binary = true
+		case strings.HasPrefix(line, "@@"):
+			if file == nil {
+				return nil, fmt.Errorf("hunk before any file header: %s", line)
+			}
+			match := hunkHeaderPattern.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("malformed hunk header: %s", line)
+			}
+			if hunk != nil {
+				file.Hunks = append(file.Hunks, *hunk)
+			}
+			hunk = &DiffHunk{
+				Header:   strings.TrimSpace(match[5]),
+				OldStart: atoiOr(match[1], 0),
+				OldLines: atoiOr(match[2], 1),
+				NewStart: atoiOr(match[3], 0),
+				NewLines: atoiOr(match[4], 1),
+				Lines:    make([]DiffLine, 0),
+			}
+			oldLeft, newLeft = hunk.OldLines, hunk.NewLines
+			oldLine, newLine = hunk.OldStart, hunk.NewStart
+		}
+	}
+	if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+		return nil, fmt.Errorf("patch ends inside a hunk of %s", file.Path)
+	}
+	flush()
+
+	for i := range diffs {
+		if diffs[i].Status != FileRenamed && diffs[i].OldPath == diffs[i].Path {
+			diffs[i].OldPath = ""
+		}
+		if diffs[i].Status == FileModified && diffs[i].OldPath != "" {
+			diffs[i].Status = FileRenamed
+		}
+	}
+	return diffs, nil
+}
+
+// diffPath strips the a/ or b/ prefix and any timestamp from a ---/+++
+// path; /dev/null becomes ""
+func diffPath(path string) string {
+	if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+		path = path[:tab]
+	}
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+func atoiOr(s string, fallback int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return fallback
+}
+
+// reversePatch renders diffs as a git patch that undoes them. It returns ""
+// when a diff can't be reversed, e.g. a binary file.
+func reversePatch(diffs []FileDiff) string {
+	var b strings.Builder
+	for _, diff := range diffs {
+		if diff.Binary {
+			return ""
+		}
+
+		// Reversed, the new path is where the change starts from
+		from, to := diff.Path, diff.Path
+		if diff.OldPath != "" {
+			to = diff.OldPath
+		}
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\n", from, to)
+		switch {
+		case diff.Status == FileAdded:
+			b.WriteString("deleted file mode 100644\n")
+			to = ""
+		case diff.Status == FileDeleted:
+			b.WriteString("new file mode 100644\n")
+			from = ""
+		case from != to:
+			fmt.Fprintf(&b, "rename from %s\nrename to %s\n", from, to)
+		}
+		if len(diff.Hunks) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", patchPath("a/", from), patchPath("b/", to))
+		for _, hunk := range diff.Hunks {
+			fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", hunk.NewStart, hunk.NewLines, hunk.OldStart, hunk.OldLines)
+			for _, line := range hunk.Lines {
+				switch line.Type {
+				case DiffAdd:
+					b.WriteString("-")
+				case DiffDelete:
+					b.WriteString("+")
+				default:
+					b.WriteString(" ")
+				}
+				b.WriteString(line.Content + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// patchPath prefixes a path for a ---/+++ line; "" is /dev/null
+func patchPath(prefix, path string) string {
+	if path == "" {
+		return "/dev/null"
+	}
+	return prefix + path
+}
@@ -0,0 +1,422 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/internal/memory"
+)
+
+const (
+	// defaultDriftStrategy groups tasks that don't name a strategy
+	defaultDriftStrategy = "default"
+	// driftCheckTimeout bounds the embedding requests made by one check
+	driftCheckTimeout = 2 * time.Minute
+	// maxDriftExamples is how many recent texts a drift alert quotes
+	maxDriftExamples = 3
+)
+
+// DriftConfig configures concept drift detection
+type DriftConfig struct {
+	Window      int     // texts per sliding window; the latest window is compared with the one before it
+	Threshold   float64 // cosine distance between window centroids that raises an alert
+	MaxPerCheck int     // texts embedded per check; the rest wait for the next one
+}
+
+// DriftConfigFromEnv reads WATCHDOG_DRIFT_WINDOW, WATCHDOG_DRIFT_THRESHOLD
+// and WATCHDOG_DRIFT_MAX_PER_CHECK
+func DriftConfigFromEnv() (DriftConfig, error) {
+	config := DriftConfig{
+		Window:      getEnvInt("WATCHDOG_DRIFT_WINDOW", 20),
+		Threshold:   0.15,
+		MaxPerCheck: getEnvInt("WATCHDOG_DRIFT_MAX_PER_CHECK", 100),
+	}
+
+	if value := getEnv("WATCHDOG_DRIFT_THRESHOLD", ""); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid WATCHDOG_DRIFT_THRESHOLD %q: %w", value, err)
+		}
+		config.Threshold = threshold
+	}
+
+	return config, nil
+}
+
+// DriftText is a reasoning or reflection text an agent produced
+type DriftText struct {
+	Strategy  string
+	TaskID    string
+	Kind      string // "reasoning" or "reflection"
+	Text      string
+	Timestamp time.Time
+}
+
+// DriftShift is a strategy whose recent behavior moved away from the window before it
+type DriftShift struct {
+	Strategy     string    `json:"strategy"`
+	Drift        float64   `json:"drift"` // cosine distance between the two windows' centroids
+	Window       int       `json:"window"`
+	BaselineFrom time.Time `json:"baseline_from"`
+	CurrentFrom  time.Time `json:"current_from"`
+	CurrentTo    time.Time `json:"current_to"`
+	Tasks        []string  `json:"tasks"`    // tasks in the current window
+	Examples     []string  `json:"examples"` // the latest texts, first lines only
+}
+
+// driftSample is an embedded text
+type driftSample struct {
+	vector []float64 // unit length
+	text   DriftText
+}
+
+// DriftDetector embeds the reasoning and reflections agents record in
+// short-term memory and tracks, per strategy, how far the centroid of the
+// latest window of texts has moved from the window before it. A strategy
+// whose behavior shifts beyond the threshold is reported once, and again
+// only after its drift has settled back below the threshold.
+type DriftDetector struct {
+	config   DriftConfig
+	embedder memory.TextEmbedder
+
+	mu       sync.Mutex
+	cursors  map[string]time.Time     // task ID -> timestamp of the latest text observed
+	history  map[string][]driftSample // strategy -> the latest two windows, oldest first
+	drift    map[string]float64       // strategy -> latest drift
+	shifted  map[string]bool          // strategies reported and still above the threshold
+	observed int
+	lastRun  time.Time
+}
+
+// NewDriftDetector creates a drift detector
+func NewDriftDetector(config DriftConfig, embedder memory.TextEmbedder) (*DriftDetector, error) {
+	if embedder == nil {
+		return nil, fmt.Errorf("an embedder is required")
+	}
+	if config.Window < 2 {
+		return nil, fmt.Errorf("window must be at least 2, got %d", config.Window)
+	}
+	if config.Threshold <= 0 || config.Threshold > 2 {
+		return nil, fmt.Errorf("threshold must be in (0, 2], got %g", config.Threshold)
+	}
+	if config.MaxPerCheck <= 0 {
+		config.MaxPerCheck = 100
+	}
+
+	return &DriftDetector{
+		config:   config,
+		embedder: embedder,
+		cursors:  make(map[string]time.Time),
+		history:  make(map[string][]driftSample),
+		drift:    make(map[string]float64),
+		shifted:  make(map[string]bool),
+	}, nil
+}
+
+// SetDriftDetector enables concept drift detection over short-term memory
+func (w *Watchdog) SetDriftDetector(detector *DriftDetector) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.drift = detector
+}
+
+// Stats reports the latest drift of each strategy
+func (d *DriftDetector) Stats() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	strategies := make(map[string]interface{}, len(d.history))
+	for strategy, samples := range d.history {
+		entry := map[string]interface{}{
+			"samples": len(samples),
+			"shifted": d.shifted[strategy],
+		}
+		if drift, ok := d.drift[strategy]; ok {
+			entry["drift"] = drift
+		}
+		strategies[strategy] = entry
+	}
+
+	return map[string]interface{}{
+		"strategies": strategies,
+		"observed":   d.observed,
+		"window":     d.config.Window,
+		"threshold":  d.config.Threshold,
+		"last_run":   d.lastRun,
+	}
+}
+
+// Pending returns the texts recorded since the last observation, oldest
+// first and at most MaxPerCheck of them
+func (d *DriftDetector) Pending(tasks []*memory.TaskMemory) []DriftText {
+	live := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		live[task.TaskID] = true
+	}
+
+	d.mu.Lock()
+	cursors := make(map[string]time.Time, len(d.cursors))
+	for id, cursor := range d.cursors {
+		if !live[id] {
+			delete(d.cursors, id) // the task was evicted
+			continue
+		}
+		cursors[id] = cursor
+	}
+	d.mu.Unlock()
+
+	texts := make([]DriftText, 0)
+	for _, task := range tasks {
+		cursor := cursors[task.TaskID]
+		strategy, _ := task.GetString("strategy")
+		if strategy == "" {
+			strategy = defaultDriftStrategy
+		}
+
+		for _, branch := range task.GetReasoning() {
+			text := branch.Reasoning
+			if strings.TrimSpace(text) == "" {
+				text = branch.Response
+			}
+			if branch.Timestamp.After(cursor) && strings.TrimSpace(text) != "" {
+				texts = append(texts, DriftText{Strategy: strategy, TaskID: task.TaskID, Kind: "reasoning", Text: text, Timestamp: branch.Timestamp})
+			}
+		}
+		for _, reflection := range task.GetReflections() {
+			text := strings.TrimSpace(strings.Join(append([]string{reflection.Critique}, reflection.Lessons...), "\n"))
+			if reflection.Timestamp.After(cursor) && text != "" {
+				texts = append(texts, DriftText{Strategy: strategy, TaskID: task.TaskID, Kind: "reflection", Text: text, Timestamp: reflection.Timestamp})
+			}
+		}
+	}
+
+	sort.SliceStable(texts, func(i, j int) bool {
+		return texts[i].Timestamp.Before(texts[j].Timestamp)
+	})
+	if len(texts) > d.config.MaxPerCheck {
+		// Texts sharing the first left-out timestamp wait too, so the
+		// cursor doesn't pass over them
+		cut := d.config.MaxPerCheck
+		for cut > 0 && texts[cut-1].Timestamp.Equal(texts[d.config.MaxPerCheck].Timestamp) {
+			cut--
+		}
+		texts = texts[:cut]
+	}
+	return texts
+}
+
+// Observe embeds texts, slides each strategy's windows forward and returns
+// the strategies that have newly shifted beyond the threshold
+func (d *DriftDetector) Observe(ctx context.Context, texts []DriftText) ([]DriftShift, error) {
+	if len(texts) == 0 {
+		d.mu.Lock()
+		d.lastRun = time.Now()
+		d.mu.Unlock()
+		return nil, nil
+	}
+
+	contents := make([]string, len(texts))
+	for i, text := range texts {
+		contents[i] = text.Text
+	}
+	vectors, err := d.embedder.GenerateBatch(ctx, contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed agent texts: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("failed to embed agent texts: got %d embeddings for %d texts", len(vectors), len(texts))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	touched := make(map[string]bool)
+	for i, text := range texts {
+		if text.Timestamp.After(d.cursors[text.TaskID]) {
+			d.cursors[text.TaskID] = text.Timestamp
+		}
+		vector := unitVector(vectors[i])
+		if vector == nil {
+			continue
+		}
+
+		samples := d.history[text.Strategy]
+		if len(samples) > 0 && len(samples[0].vector) != len(vector) {
+			// The embedding model changed; earlier texts can't be compared
+			samples = nil
+			delete(d.drift, text.Strategy)
+			delete(d.shifted, text.Strategy)
+		}
+		samples = append(samples, driftSample{vector: vector, text: text})
+		if excess := len(samples) - 2*d.config.Window; excess > 0 {
+			samples = append([]driftSample(nil), samples[excess:]...)
+		}
+		d.history[text.Strategy] = samples
+		touched[text.Strategy] = true
+		d.observed++
+	}
+	d.lastRun = time.Now()
+
+	shifts := make([]DriftShift, 0)
+	for strategy := range touched {
+		samples := d.history[strategy]
+		if len(samples) < 2*d.config.Window {
+			continue
+		}
+		baseline, current := samples[:d.config.Window], samples[d.config.Window:]
+		drift := cosineDistance(centroid(baseline), centroid(current))
+		d.drift[strategy] = drift
+
+		if drift < d.config.Threshold {
+			d.shifted[strategy] = false
+			continue
+		}
+		if d.shifted[strategy] {
+			continue
+		}
+		d.shifted[strategy] = true
+		shifts = append(shifts, newDriftShift(strategy, drift, baseline, current))
+	}
+
+	sort.Slice(shifts, func(i, j int) bool {
+		return shifts[i].Strategy < shifts[j].Strategy
+	})
+	return shifts, nil
+}
+
+// newDriftShift describes a shift between two windows
+func newDriftShift(strategy string, drift float64, baseline, current []driftSample) DriftShift {
+	shift := DriftShift{
+		Strategy:     strategy,
+		Drift:        drift,
+		Window:       len(current),
+		BaselineFrom: baseline[0].text.Timestamp,
+		CurrentFrom:  current[0].text.Timestamp,
+		CurrentTo:    current[len(current)-1].text.Timestamp,
+		Tasks:        make([]string, 0),
+		Examples:     make([]string, 0, maxDriftExamples),
+	}
+
+	seen := make(map[string]bool)
+	for _, sample := range current {
+		if !seen[sample.text.TaskID] {
+			seen[sample.text.TaskID] = true
+			shift.Tasks = append(shift.Tasks, sample.text.TaskID)
+		}
+	}
+	for i := len(current) - 1; i >= 0 && len(shift.Examples) < maxDriftExamples; i-- {
+		example := firstLine(current[i].text.Text)
+		if len(example) > 200 {
+			example = example[:200] + "..."
+		}
+		shift.Examples = append(shift.Examples, example)
+	}
+
+	return shift
+}
+
+// unitVector returns v scaled to unit length, or nil for a zero vector
+func unitVector(v []float64) []float64 {
+	norm := 0.0
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+
+	unit := make([]float64, len(v))
+	for i, x := range v {
+		unit[i] = x / norm
+	}
+	return unit
+}
+
+// centroid averages unit vectors
+func centroid(samples []driftSample) []float64 {
+	sum := make([]float64, len(samples[0].vector))
+	for _, sample := range samples {
+		for i, x := range sample.vector {
+			sum[i] += x
+		}
+	}
+	for i := range sum {
+		sum[i] /= float64(len(samples))
+	}
+	return sum
+}
+
+// cosineDistance is 1 minus the cosine similarity of a and b
+func cosineDistance(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+}
+
+// checkConceptDrift embeds the reasoning and reflections recorded since the
+// last check and raises an alert for each strategy that has shifted
+func (w *Watchdog) checkConceptDrift() {
+	w.mu.RLock()
+	detector := w.drift
+	w.mu.RUnlock()
+
+	if detector == nil || w.config.Memory == nil || w.config.Memory.ShortTerm == nil {
+		return
+	}
+	texts := detector.Pending(w.config.Memory.ShortTerm.Tasks())
+
+	ctx, cancel := w.checkContext(driftCheckTimeout)
+	defer cancel()
+
+	shifts, err := detector.Observe(ctx, texts)
+	if err != nil {
+		slog.Warn("concept drift check skipped", "error", err)
+		return
+	}
+
+	alerts := make([]Alert, 0, len(shifts))
+	for _, shift := range shifts {
+		alerts = append(alerts, w.driftAlert(shift, detector.config.Threshold))
+	}
+	w.recordAlerts(alerts...)
+}
+
+// driftAlert raises the alert for a strategy whose behavior shifted; a
+// shift of twice the threshold or more is an error
+func (w *Watchdog) driftAlert(shift DriftShift, threshold float64) Alert {
+	severity := AlertSeverityWarning
+	if shift.Drift >= 2*threshold {
+		severity = AlertSeverityError
+	}
+
+	return w.createAlert(AlertTypeConceptDrift, severity, "Concept Drift Detected",
+		fmt.Sprintf("Strategy %q drifted %.3f (threshold %.3f) over its last %d reasoning and reflection texts; review recent proposals before approving more", shift.Strategy, shift.Drift, threshold, shift.Window),
+		map[string]interface{}{
+			"rule":          "concept_drift",
+			"strategy":      shift.Strategy,
+			"drift":         shift.Drift,
+			"threshold":     threshold,
+			"window":        shift.Window,
+			"baseline_from": shift.BaselineFrom.Format(time.RFC3339),
+			"current_from":  shift.CurrentFrom.Format(time.RFC3339),
+			"current_to":    shift.CurrentTo.Format(time.RFC3339),
+			"tasks":         shift.Tasks,
+			"examples":      shift.Examples,
+		})
+}
@@ -0,0 +1,132 @@
+package watchdog
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published on the watchdog's event bus
+const (
+	EventAlertCreated      = "alert_created"      // a new alert, or a repeat raised again
+	EventAlertUpdated      = "alert_updated"      // acknowledged, assigned, closed, reopened or escalated
+	EventProposalCreated   = "proposal_created"   // submitted, as a draft or for review
+	EventProposalStatus    = "proposal_status"    // a proposal moved through review
+	EventProposalExecution = "proposal_execution" // the pipeline started or finished a proposal
+	EventScanFinished      = "scan_finished"
+)
+
+const (
+	// eventSubscriberBuffer is how many events a slow subscriber may fall
+	// behind before the oldest pending ones are dropped
+	eventSubscriberBuffer = 64
+	// eventBacklog is how many recent events a reconnecting subscriber can replay
+	eventBacklog = 256
+)
+
+// Event is something that happened in the watchdog. IDs increase, so a
+// subscriber that reconnects can ask for what it missed.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Payload   interface{} `json:"payload"`
+}
+
+// EventBus fans watchdog events out to subscribers. Publishing never blocks:
+// a subscriber that falls behind loses its oldest pending events.
+type EventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	backlog     []Event
+	subscribers map[chan Event]map[string]bool // channel -> event types; nil is every type
+}
+
+// NewEventBus creates an event bus
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]map[string]bool)}
+}
+
+// Events returns the bus the watchdog publishes to
+func (w *Watchdog) Events() *EventBus {
+	return w.events
+}
+
+// Publish delivers an event to the subscribers of its type
+func (b *EventBus) Publish(eventType string, payload interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event := Event{ID: b.nextID, Type: eventType, Timestamp: time.Now(), Payload: payload}
+	b.backlog = append(b.backlog, event)
+	if len(b.backlog) > eventBacklog {
+		b.backlog = b.backlog[len(b.backlog)-eventBacklog:]
+	}
+
+	for ch, types := range b.subscribers {
+		if types != nil && !types[eventType] {
+			continue
+		}
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		// Full: drop the oldest pending event so the newest gets through
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe delivers events of the given types, or of every type when none
+// are given, published from now on. Events after since that are still in
+// the backlog are delivered first. The channel is closed by cancel.
+func (b *EventBus) Subscribe(since uint64, types ...string) (<-chan Event, func()) {
+	var filter map[string]bool
+	if len(types) > 0 {
+		filter = make(map[string]bool, len(types))
+		for _, eventType := range types {
+			filter[eventType] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, eventSubscriberBuffer+len(b.backlog))
+	if since > 0 {
+		for _, event := range b.backlog {
+			if event.ID > since && (filter == nil || filter[event.Type]) {
+				ch <- event
+			}
+		}
+	}
+	b.subscribers[ch] = filter
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Stats reports the bus's subscribers and the last event ID
+func (b *EventBus) Stats() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return map[string]interface{}{
+		"subscribers":   len(b.subscribers),
+		"last_event_id": b.nextID,
+	}
+}
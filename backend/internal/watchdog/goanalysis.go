@@ -0,0 +1,450 @@
+package watchdog
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxNestingDepth is how deeply control statements may nest in a function
+// before it's reported
+const maxNestingDepth = 4
+
+// sqlStatementPattern matches a string that starts a SQL statement
+var sqlStatementPattern = regexp.MustCompile(`(?is)^\s*(select\s.+\sfrom|insert\s+into|update\s+\S+\s+set|delete\s+from)\b`)
+
+// uncheckedErrorExclusions are calls whose error is safe to ignore
+var uncheckedErrorExclusions = map[string]bool{
+	"fmt.Print":                      true,
+	"fmt.Printf":                     true,
+	"fmt.Println":                    true,
+	"(*bytes.Buffer).Write":          true,
+	"(*bytes.Buffer).WriteByte":      true,
+	"(*bytes.Buffer).WriteRune":      true,
+	"(*bytes.Buffer).WriteString":    true,
+	"(*strings.Builder).Write":       true,
+	"(*strings.Builder).WriteByte":   true,
+	"(*strings.Builder).WriteRune":   true,
+	"(*strings.Builder).WriteString": true,
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// goImporter resolves imports while type-checking files for analysis
+var goImporter = &stdlibImporter{
+	source:   importer.ForCompiler(token.NewFileSet(), "source", nil),
+	packages: make(map[string]*types.Package),
+}
+
+// stdlibImporter type-checks standard library packages from GOROOT source,
+// caching them for the life of the process. Other imports resolve to empty
+// packages, which leaves calls into them untyped rather than failing.
+type stdlibImporter struct {
+	mu       sync.Mutex
+	source   types.Importer
+	packages map[string]*types.Package
+}
+
+// Import returns the package at importPath; it never fails
+func (i *stdlibImporter) Import(importPath string) (*types.Package, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if pkg, ok := i.packages[importPath]; ok {
+		return pkg, nil
+	}
+
+	var pkg *types.Package
+	if isStdlib(importPath) {
+		if imported, err := i.source.Import(importPath); err == nil {
+			pkg = imported
+		}
+	}
+	if pkg == nil {
+		pkg = types.NewPackage(importPath, path.Base(importPath))
+		pkg.MarkComplete()
+	}
+
+	i.packages[importPath] = pkg
+	return pkg, nil
+}
+
+// isStdlib reports whether importPath is a package in GOROOT
+func isStdlib(importPath string) bool {
+	if importPath == "C" || build.IsLocalImport(importPath) {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(build.Default.GOROOT, "src", filepath.FromSlash(importPath)))
+	return err == nil && info.IsDir()
+}
+
+// goAnalysis collects alerts for one parsed Go file
+type goAnalysis struct {
+	generator *AlertGenerator
+	fset      *token.FileSet
+	info      *types.Info
+	filename  string
+	alerts    []Alert
+}
+
+// analyzeGo checks a Go file's syntax tree for unchecked errors, SQL built by
+// concatenation, dropped contexts and deep nesting. Type information covers
+// the standard library and the file's own declarations. Files that don't
+// parse, usually because they're mid-edit, get no alerts until they do.
+func (g *AlertGenerator) analyzeGo(code, filename string) []Alert {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, code, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	// Errors are expected (other files of the package, third-party imports)
+	// and leave the affected expressions untyped
+	config := types.Config{Importer: goImporter, FakeImportC: true, Error: func(error) {}}
+	config.Check(file.Name.Name, fset, []*ast.File{file}, info)
+
+	a := &goAnalysis{generator: g, fset: fset, info: info, filename: filename}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+
+		name := funcName(fn)
+		a.checkUncheckedErrors(fn.Body, name)
+		a.checkSQLConcatenation(fn.Body, name)
+		if hasContextParam(fn.Type) {
+			a.checkContextPropagation(fn.Body, name)
+		}
+		a.checkNesting(fn.Body, name)
+	}
+
+	return a.alerts
+}
+
+// checkUncheckedErrors reports calls made as statements whose error result
+// is dropped
+func (a *goAnalysis) checkUncheckedErrors(body *ast.BlockStmt, function string) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		stmt, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		call, ok := ast.Unparen(stmt.X).(*ast.CallExpr)
+		if !ok || !returnsError(a.info.Types[call].Type) {
+			return true
+		}
+
+		_, callee := a.callee(call)
+		if uncheckedErrorExclusions[callee] {
+			return true
+		}
+
+		a.alerts = append(a.alerts, a.generator.watchdog.createAlert(
+			AlertTypePattern,
+			AlertSeverityWarning,
+			"Unchecked Error",
+			fmt.Sprintf("Error returned by %s is not checked in %s (%s)", callee, function, a.filename),
+			a.context(call, function, map[string]interface{}{
+				"call":           callee,
+				"recommendation": "Handle the error, or assign it to _ if ignoring it is intended",
+			}),
+		))
+		return true
+	})
+}
+
+// checkSQLConcatenation reports SQL statements built by concatenating or
+// formatting non-constant strings
+func (a *goAnalysis) checkSQLConcatenation(body *ast.BlockStmt, function string) {
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BinaryExpr:
+			if n.Op != token.ADD {
+				return true
+			}
+
+			// Handle the whole chain once, then look inside its operands
+			operands := flattenConcatenation(n)
+			if a.info.Types[n].Value == nil {
+				var query strings.Builder
+				dynamic := false
+				for _, operand := range operands {
+					if s, ok := a.stringValue(operand); ok {
+						query.WriteString(s)
+					} else {
+						query.WriteString("?")
+						dynamic = true
+					}
+				}
+				if dynamic && sqlStatementPattern.MatchString(query.String()) {
+					a.reportSQL(n, function, "concatenation")
+				}
+			}
+			for _, operand := range operands {
+				ast.Inspect(operand, visit)
+			}
+			return false
+
+		case *ast.CallExpr:
+			if _, callee := a.callee(n); callee != "fmt.Sprintf" || len(n.Args) < 2 {
+				return true
+			}
+			format, ok := a.stringValue(n.Args[0])
+			if !ok || !sqlStatementPattern.MatchString(format) {
+				return true
+			}
+			// Numeric verbs can't inject anything
+			if !strings.Contains(format, "%s") && !strings.Contains(format, "%v") {
+				return true
+			}
+			for _, arg := range n.Args[1:] {
+				if a.info.Types[arg].Value == nil {
+					a.reportSQL(n, function, "fmt.Sprintf")
+					break
+				}
+			}
+		}
+		return true
+	}
+	ast.Inspect(body, visit)
+}
+
+func (a *goAnalysis) reportSQL(node ast.Node, function, construction string) {
+	a.alerts = append(a.alerts, a.generator.GenerateSecurityAlert(
+		"Potential SQL Injection",
+		fmt.Sprintf("SQL query built with %s of non-constant strings in %s (%s)", construction, function, a.filename),
+		a.context(node, function, map[string]interface{}{
+			"recommendation": "Use parameterized queries or prepared statements",
+		}),
+	))
+}
+
+// checkContextPropagation reports calls in a function taking a context that
+// start a new root context, or that have a context-accepting variant.
+// Function literals are skipped; they may deliberately outlive the call.
+func (a *goAnalysis) checkContextPropagation(body *ast.BlockStmt, function string) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			fn, callee := a.callee(n)
+
+			var message string
+			switch {
+			case callee == "context.Background" || callee == "context.TODO":
+				message = fmt.Sprintf("%s starts a new context with %s instead of passing its own (%s)", function, callee, a.filename)
+			case fn != nil:
+				if variant := a.contextVariant(n, fn); variant != "" {
+					message = fmt.Sprintf("%s calls %s instead of %s with its context (%s)", function, fn.Name(), variant, a.filename)
+				}
+			}
+			if message == "" {
+				return true
+			}
+
+			a.alerts = append(a.alerts, a.generator.watchdog.createAlert(
+				AlertTypePattern,
+				AlertSeverityWarning,
+				"Missing Context Propagation",
+				message,
+				a.context(n, function, map[string]interface{}{
+					"call":           callee,
+					"recommendation": "Pass the caller's context so cancellation and deadlines reach this call",
+				}),
+			))
+		}
+		return true
+	})
+}
+
+// contextVariant returns the name of fn's context-accepting counterpart,
+// e.g. QueryContext for Query or NewRequestWithContext for NewRequest
+func (a *goAnalysis) contextVariant(call *ast.CallExpr, fn *types.Func) string {
+	if fn.Pkg() == nil {
+		return ""
+	}
+
+	for _, suffix := range []string{"Context", "WithContext"} {
+		name := fn.Name() + suffix
+
+		if sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr); ok {
+			if selection, ok := a.info.Selections[sel]; ok {
+				if obj, _, _ := types.LookupFieldOrMethod(selection.Recv(), true, fn.Pkg(), name); obj != nil {
+					if _, ok := obj.(*types.Func); ok {
+						return name
+					}
+				}
+				continue
+			}
+		}
+
+		if _, ok := fn.Pkg().Scope().Lookup(name).(*types.Func); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// checkNesting reports a function whose control statements nest more than
+// maxNestingDepth deep
+func (a *goAnalysis) checkNesting(body *ast.BlockStmt, function string) {
+	deepest := 0
+	ast.Walk(nestingVisitor{deepest: &deepest}, body)
+	if deepest <= maxNestingDepth {
+		return
+	}
+
+	a.alerts = append(a.alerts, a.generator.GeneratePerformanceAlert(
+		"High Code Complexity",
+		fmt.Sprintf("%s nests control flow %d levels deep in %s", function, deepest, a.filename),
+		a.context(body, function, map[string]interface{}{
+			"nesting_level":  deepest,
+			"recommendation": "Consider early returns or extracting helpers to reduce nesting",
+		}),
+	))
+}
+
+// nestingVisitor tracks how deeply control statements nest; else-if chains
+// count as one level
+type nestingVisitor struct {
+	depth   int
+	deepest *int
+}
+
+func (v nestingVisitor) enter() nestingVisitor {
+	inner := nestingVisitor{depth: v.depth + 1, deepest: v.deepest}
+	if inner.depth > *v.deepest {
+		*v.deepest = inner.depth
+	}
+	return inner
+}
+
+func (v nestingVisitor) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.IfStmt:
+		inner := v.enter()
+		ast.Walk(inner, n.Body)
+		if elseIf, ok := n.Else.(*ast.IfStmt); ok {
+			ast.Walk(v, elseIf)
+		} else if n.Else != nil {
+			ast.Walk(inner, n.Else)
+		}
+		return nil
+	case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return v.enter()
+	}
+	return v
+}
+
+// callee returns the called function when it's typed, and its name either way
+func (a *goAnalysis) callee(call *ast.CallExpr) (*types.Func, string) {
+	var ident *ast.Ident
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	}
+
+	if ident != nil {
+		if fn, ok := a.info.Uses[ident].(*types.Func); ok {
+			return fn, fn.FullName()
+		}
+	}
+	return nil, types.ExprString(call.Fun)
+}
+
+// stringValue returns the value of a constant string expression
+func (a *goAnalysis) stringValue(expr ast.Expr) (string, bool) {
+	if tv := a.info.Types[expr]; tv.Value != nil && tv.Value.Kind() == constant.String {
+		return constant.StringVal(tv.Value), true
+	}
+	if lit, ok := ast.Unparen(expr).(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		if s, err := strconv.Unquote(lit.Value); err == nil {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// context builds an alert context locating node in the file
+func (a *goAnalysis) context(node ast.Node, function string, extra map[string]interface{}) map[string]interface{} {
+	context := map[string]interface{}{
+		"file":     a.filename,
+		"line":     a.fset.Position(node.Pos()).Line,
+		"function": function,
+	}
+	for k, v := range extra {
+		context[k] = v
+	}
+	return context
+}
+
+// flattenConcatenation returns the operands of a chain of + expressions
+func flattenConcatenation(expr ast.Expr) []ast.Expr {
+	if binary, ok := ast.Unparen(expr).(*ast.BinaryExpr); ok && binary.Op == token.ADD {
+		return append(flattenConcatenation(binary.X), flattenConcatenation(binary.Y)...)
+	}
+	return []ast.Expr{expr}
+}
+
+// returnsError reports whether a call's result type includes an error
+func returnsError(t types.Type) bool {
+	if tuple, ok := t.(*types.Tuple); ok {
+		for i := 0; i < tuple.Len(); i++ {
+			if types.Identical(tuple.At(i).Type(), errorType) {
+				return true
+			}
+		}
+		return false
+	}
+	return t != nil && types.Identical(t, errorType)
+}
+
+// hasContextParam reports whether a function takes a named context.Context
+func hasContextParam(fn *ast.FuncType) bool {
+	for _, field := range fn.Params.List {
+		sel, ok := field.Type.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Context" {
+			continue
+		}
+		if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "context" {
+			continue
+		}
+		for _, name := range field.Names {
+			if name.Name != "_" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// funcName names a function declaration, with its receiver type for methods
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := strings.TrimPrefix(types.ExprString(fn.Recv.List[0].Type), "*")
+	return recv + "." + fn.Name.Name
+}
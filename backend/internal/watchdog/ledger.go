@@ -0,0 +1,331 @@
+package watchdog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+const defaultRollingWindow = 10
+
+// ErrInvalidAnalyticsQuery is returned for malformed analytics filters
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+// RewardEntry records one reward given to a proposal
+type RewardEntry struct {
+	Time       time.Time `json:"time"`
+	ProposalID string    `json:"proposal_id"`
+	Component  string    `json:"component"`
+	Strategy   string    `json:"strategy,omitempty"`
+	Reviewer   string    `json:"reviewer"`
+	Reward     float64   `json:"reward"`
+	Feedback   string    `json:"feedback,omitempty"`
+}
+
+// RewardStats summarizes a run of rewards, oldest to newest
+type RewardStats struct {
+	Count       int       `json:"count"`
+	Mean        float64   `json:"mean"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	RollingMean float64   `json:"rolling_mean"` // mean of the last Window rewards
+	Trend       float64   `json:"trend"`        // rolling mean minus the mean of the Window rewards before them; positive is improving
+	LastAt      time.Time `json:"last_at"`
+}
+
+// RewardBucket is the rewards given in one period of a time series
+type RewardBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	Mean  float64   `json:"mean"`
+}
+
+// EvolutionAnalytics shows whether proposals are earning better rewards over time
+type EvolutionAnalytics struct {
+	Overall          RewardStats               `json:"overall"`
+	ByComponent      map[string]RewardStats    `json:"by_component"`
+	ByStrategy       map[string]RewardStats    `json:"by_strategy"`
+	Series           []RewardBucket            `json:"series"`
+	SeriesByStrategy map[string][]RewardBucket `json:"series_by_strategy"`
+	Bucket           string                    `json:"bucket"`
+	Window           int                       `json:"window"`
+}
+
+// RewardLedger appends rewards to a JSON-lines file and keeps them in memory
+// for analytics. Entries are never rewritten, so a proposal's rewards keep
+// their history when it's rewarded again.
+type RewardLedger struct {
+	mu      sync.RWMutex
+	path    string
+	file    *os.File // nil keeps the ledger in memory only
+	entries []RewardEntry
+}
+
+// NewRewardLedger opens (or creates) the ledger at path and loads its entries
+func NewRewardLedger(path string) (*RewardLedger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create reward ledger directory: %w", err)
+	}
+
+	entries, err := loadRewardEntries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reward ledger: %w", err)
+	}
+
+	return &RewardLedger{path: path, file: file, entries: entries}, nil
+}
+
+// NewRewardLedgerFromEnv opens the ledger at WATCHDOG_REWARD_LEDGER_PATH
+func NewRewardLedgerFromEnv() (*RewardLedger, error) {
+	return NewRewardLedger(getEnv("WATCHDOG_REWARD_LEDGER_PATH", "./data/reward_ledger.jsonl"))
+}
+
+// newMemoryRewardLedger creates a ledger that isn't saved anywhere
+func newMemoryRewardLedger() *RewardLedger {
+	return &RewardLedger{entries: make([]RewardEntry, 0)}
+}
+
+// loadRewardEntries reads a ledger file, skipping undecodable lines
+func loadRewardEntries(path string) ([]RewardEntry, error) {
+	entries := make([]RewardEntry, 0)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reward ledger: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry RewardEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			slog.Warn("skipping undecodable reward entry", "error", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reward ledger: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SetRewardLedger records rewards in ledger from now on
+func (w *Watchdog) SetRewardLedger(ledger *RewardLedger) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.ledger = ledger
+}
+
+// EvolutionAnalytics summarizes the reward ledger
+func (w *Watchdog) EvolutionAnalytics(req models.EvolveAnalyticsQuery) (*EvolutionAnalytics, error) {
+	w.mu.RLock()
+	ledger := w.ledger
+	w.mu.RUnlock()
+
+	return ledger.Analytics(req)
+}
+
+// Record appends an entry
+func (l *RewardLedger) Record(entry RewardEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode reward entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		if _, err := l.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write reward entry: %w", err)
+		}
+	}
+	l.entries = append(l.entries, entry)
+
+	return nil
+}
+
+// Close closes the ledger file
+func (l *RewardLedger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close reward ledger: %w", err)
+	}
+	return nil
+}
+
+// Analytics computes reward statistics over the matching entries
+func (l *RewardLedger) Analytics(req models.EvolveAnalyticsQuery) (*EvolutionAnalytics, error) {
+	bucket := req.Bucket
+	if bucket == "" {
+		bucket = "day"
+	}
+	if bucket != "hour" && bucket != "day" && bucket != "week" {
+		return nil, fmt.Errorf("%w: bucket must be hour, day or week", ErrInvalidAnalyticsQuery)
+	}
+	window := req.Window
+	if window <= 0 {
+		window = defaultRollingWindow
+	}
+
+	var since, until time.Time
+	var err error
+	if req.Since != "" {
+		if since, err = time.Parse(time.RFC3339, req.Since); err != nil {
+			return nil, fmt.Errorf("%w: since must be an RFC 3339 time", ErrInvalidAnalyticsQuery)
+		}
+	}
+	if req.Until != "" {
+		if until, err = time.Parse(time.RFC3339, req.Until); err != nil {
+			return nil, fmt.Errorf("%w: until must be an RFC 3339 time", ErrInvalidAnalyticsQuery)
+		}
+	}
+
+	l.mu.RLock()
+	entries := make([]RewardEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		switch {
+		case req.Component != "" && entry.Component != req.Component:
+		case req.Strategy != "" && entry.Strategy != req.Strategy:
+		case !since.IsZero() && entry.Time.Before(since):
+		case !until.IsZero() && entry.Time.After(until):
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	l.mu.RUnlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	byComponent := make(map[string][]RewardEntry)
+	byStrategy := make(map[string][]RewardEntry)
+	for _, entry := range entries {
+		byComponent[entry.Component] = append(byComponent[entry.Component], entry)
+		if entry.Strategy != "" {
+			byStrategy[entry.Strategy] = append(byStrategy[entry.Strategy], entry)
+		}
+	}
+
+	analytics := &EvolutionAnalytics{
+		Overall:          rewardStats(entries, window),
+		ByComponent:      make(map[string]RewardStats, len(byComponent)),
+		ByStrategy:       make(map[string]RewardStats, len(byStrategy)),
+		Series:           rewardSeries(entries, bucket),
+		SeriesByStrategy: make(map[string][]RewardBucket, len(byStrategy)),
+		Bucket:           bucket,
+		Window:           window,
+	}
+	for component, group := range byComponent {
+		analytics.ByComponent[component] = rewardStats(group, window)
+	}
+	for strategy, group := range byStrategy {
+		analytics.ByStrategy[strategy] = rewardStats(group, window)
+		analytics.SeriesByStrategy[strategy] = rewardSeries(group, bucket)
+	}
+
+	return analytics, nil
+}
+
+// rewardStats summarizes entries sorted oldest first
+func rewardStats(entries []RewardEntry, window int) RewardStats {
+	stats := RewardStats{Count: len(entries)}
+	if len(entries) == 0 {
+		return stats
+	}
+
+	stats.Min, stats.Max = entries[0].Reward, entries[0].Reward
+	for _, entry := range entries {
+		stats.Min = math.Min(stats.Min, entry.Reward)
+		stats.Max = math.Max(stats.Max, entry.Reward)
+	}
+	stats.Mean = meanReward(entries)
+	stats.LastAt = entries[len(entries)-1].Time
+
+	recent := entries[max(0, len(entries)-window):]
+	stats.RollingMean = meanReward(recent)
+	if previous := entries[max(0, len(entries)-2*window) : len(entries)-len(recent)]; len(previous) > 0 {
+		stats.Trend = stats.RollingMean - meanReward(previous)
+	}
+
+	return stats
+}
+
+// rewardSeries buckets entries sorted oldest first by hour, day or week (UTC)
+func rewardSeries(entries []RewardEntry, bucket string) []RewardBucket {
+	series := make([]RewardBucket, 0)
+	total := 0.0
+
+	for _, entry := range entries {
+		start := bucketStart(entry.Time, bucket)
+		if len(series) == 0 || !series[len(series)-1].Start.Equal(start) {
+			if len(series) > 0 {
+				series[len(series)-1].Mean = total / float64(series[len(series)-1].Count)
+			}
+			series = append(series, RewardBucket{Start: start})
+			total = 0
+		}
+		series[len(series)-1].Count++
+		total += entry.Reward
+	}
+	if len(series) > 0 {
+		series[len(series)-1].Mean = total / float64(series[len(series)-1].Count)
+	}
+
+	return series
+}
+
+// bucketStart truncates t to the start of its hour, day or week (Monday)
+func bucketStart(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	switch bucket {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func meanReward(entries []RewardEntry) float64 {
+	if len(entries) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, entry := range entries {
+		total += entry.Reward
+	}
+	return total / float64(len(entries))
+}
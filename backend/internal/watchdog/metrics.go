@@ -0,0 +1,76 @@
+package watchdog
+
+import (
+	"strconv"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+)
+
+var (
+	// alertsRaised counts alerts kept by the watchdog
+	alertsRaised = metrics.NewCounterVec("watchdog_alerts_raised_total",
+		"Alerts raised by the watchdog", "severity", "type")
+	// alertsSuppressed counts repeats folded into an open alert during its cooldown
+	alertsSuppressed = metrics.NewCounterVec("watchdog_alerts_suppressed_total",
+		"Repeated alerts merged into an open alert without being raised again", "severity", "type")
+	// alertsEscalated counts open alerts escalated past their SLA deadline
+	alertsEscalated = metrics.NewCounterVec("watchdog_alerts_escalated_total",
+		"Open alerts escalated after missing their acknowledgement deadline", "severity", "type")
+	// proposalEvents counts proposals submitted, decided and finished by the pipeline
+	proposalEvents = metrics.NewCounterVec("watchdog_proposal_events_total",
+		"Proposal submissions, decisions and pipeline outcomes", "event")
+)
+
+// RegisterMetrics adds gauges reading the watchdog's alerts and proposals to registry
+func (w *Watchdog) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("watchdog_alerts", "Alerts currently held by the watchdog",
+		[]string{"severity", "acknowledged"}, func() []metrics.Sample {
+			w.mu.RLock()
+			defer w.mu.RUnlock()
+
+			counts := make(map[[2]string]int)
+			for _, alert := range w.alerts {
+				counts[[2]string{alert.Severity, strconv.FormatBool(alert.Acknowledged)}]++
+			}
+			samples := make([]metrics.Sample, 0, len(counts))
+			for labels, count := range counts {
+				samples = append(samples, metrics.Sample{Labels: labels[:], Value: float64(count)})
+			}
+			return samples
+		})
+
+	registry.NewGaugeFunc("watchdog_proposals", "Proposals by status",
+		[]string{"status"}, func() []metrics.Sample {
+			w.mu.RLock()
+			defer w.mu.RUnlock()
+
+			counts := make(map[string]int)
+			for _, proposal := range w.proposals {
+				counts[proposal.Status]++
+			}
+			samples := make([]metrics.Sample, 0, len(counts))
+			for status, count := range counts {
+				samples = append(samples, metrics.Sample{Labels: []string{status}, Value: float64(count)})
+			}
+			return samples
+		})
+
+	registry.NewGaugeFunc("watchdog_oldest_open_proposal_age_seconds",
+		"Age of the oldest draft or proposal in review", nil, func() []metrics.Sample {
+			w.mu.RLock()
+			defer w.mu.RUnlock()
+
+			var oldest time.Time
+			for _, proposal := range w.proposals {
+				open := proposal.Status == ProposalDraft || proposal.Status == ProposalReview
+				if open && (oldest.IsZero() || proposal.CreatedAt.Before(oldest)) {
+					oldest = proposal.CreatedAt
+				}
+			}
+			if oldest.IsZero() {
+				return []metrics.Sample{{Value: 0}}
+			}
+			return []metrics.Sample{{Value: time.Since(oldest).Seconds()}}
+		})
+}
@@ -0,0 +1,467 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification modes for a severity
+const (
+	NotifyOff       = "off"
+	NotifyImmediate = "immediate"
+	NotifyDigest    = "digest"
+)
+
+const (
+	// notifyQueueSize bounds alerts waiting for delivery; more are dropped
+	notifyQueueSize = 256
+	// maxNotifiedAlerts caps how many alerts one message lists
+	maxNotifiedAlerts = 20
+	notifySendTimeout = 15 * time.Second
+)
+
+// NotificationSink delivers alerts to people outside the UI
+type NotificationSink interface {
+	Name() string
+	Send(ctx context.Context, alerts []Alert, digest bool) error
+}
+
+// SinkConfig routes each alert severity to a sink immediately, in the
+// periodic digest, or not at all
+type SinkConfig struct {
+	Sink   NotificationSink
+	Routes map[string]string // severity → NotifyImmediate, NotifyDigest or NotifyOff
+}
+
+// NotifierConfig configures alert notifications
+type NotifierConfig struct {
+	Sinks    []SinkConfig
+	Throttle time.Duration // an alert isn't sent to a sink again within this window
+	Digest   time.Duration // how often digests are sent
+}
+
+// NotifierConfigFromEnv configures a sink for each of WATCHDOG_NOTIFY_WEBHOOK_URL,
+// WATCHDOG_NOTIFY_SLACK_URL and WATCHDOG_NOTIFY_SMTP_ADDR that is set. Each
+// sink's routes come from WATCHDOG_NOTIFY_<SINK>_ROUTES, e.g.
+// "error=immediate,warning=digest"; by default only errors are sent, immediately.
+func NotifierConfigFromEnv() (NotifierConfig, error) {
+	config := NotifierConfig{
+		Throttle: time.Duration(getEnvInt("WATCHDOG_NOTIFY_THROTTLE_SECONDS", 300)) * time.Second,
+		Digest:   time.Duration(getEnvInt("WATCHDOG_NOTIFY_DIGEST_MINUTES", 60)) * time.Minute,
+	}
+
+	add := func(sink NotificationSink, routesKey string) error {
+		routes, err := parseNotifyRoutes(getEnv(routesKey, "error=immediate"))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", routesKey, err)
+		}
+		config.Sinks = append(config.Sinks, SinkConfig{Sink: sink, Routes: routes})
+		return nil
+	}
+
+	if url := getEnv("WATCHDOG_NOTIFY_WEBHOOK_URL", ""); url != "" {
+		if err := add(NewWebhookSink(url), "WATCHDOG_NOTIFY_WEBHOOK_ROUTES"); err != nil {
+			return config, err
+		}
+	}
+	if url := getEnv("WATCHDOG_NOTIFY_SLACK_URL", ""); url != "" {
+		if err := add(NewSlackSink(url), "WATCHDOG_NOTIFY_SLACK_ROUTES"); err != nil {
+			return config, err
+		}
+	}
+	if addr := getEnv("WATCHDOG_NOTIFY_SMTP_ADDR", ""); addr != "" {
+		to := splitList(getEnv("WATCHDOG_NOTIFY_EMAIL_TO", ""))
+		if len(to) == 0 {
+			return config, fmt.Errorf("WATCHDOG_NOTIFY_EMAIL_TO is required with WATCHDOG_NOTIFY_SMTP_ADDR")
+		}
+		sink := NewEmailSink(EmailConfig{
+			Addr:     addr,
+			Username: getEnv("WATCHDOG_NOTIFY_SMTP_USER", ""),
+			Password: getEnv("WATCHDOG_NOTIFY_SMTP_PASSWORD", ""),
+			From:     getEnv("WATCHDOG_NOTIFY_EMAIL_FROM", "watchdog@localhost"),
+			To:       to,
+		})
+		if err := add(sink, "WATCHDOG_NOTIFY_EMAIL_ROUTES"); err != nil {
+			return config, err
+		}
+	}
+
+	return config, nil
+}
+
+// parseNotifyRoutes parses "severity=mode" pairs
+func parseNotifyRoutes(value string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, pair := range splitList(value) {
+		severity, mode, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected severity=mode, got %q", pair)
+		}
+		severity, mode = strings.TrimSpace(severity), strings.TrimSpace(mode)
+
+		switch severity {
+		case AlertSeverityInfo, AlertSeverityWarning, AlertSeverityError:
+		default:
+			return nil, fmt.Errorf("unknown severity %q", severity)
+		}
+		switch mode {
+		case NotifyOff, NotifyImmediate, NotifyDigest:
+		default:
+			return nil, fmt.Errorf("unknown mode %q", mode)
+		}
+		routes[severity] = mode
+	}
+	return routes, nil
+}
+
+// Notifier delivers alerts to sinks in the background, so raising an alert
+// never waits on the network
+type Notifier struct {
+	config NotifierConfig
+	queue  chan []Alert
+
+	mu        sync.Mutex
+	lastSent  map[string]time.Time // sink and alert key → last delivery
+	digests   map[string][]Alert   // sink → alerts waiting for the digest
+	sent      int
+	failed    int
+	throttled int
+	dropped   int
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewNotifier starts delivering to the configured sinks
+func NewNotifier(config NotifierConfig) *Notifier {
+	n := &Notifier{
+		config:   config,
+		queue:    make(chan []Alert, notifyQueueSize),
+		lastSent: make(map[string]time.Time),
+		digests:  make(map[string][]Alert),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Notify queues alerts for delivery
+func (n *Notifier) Notify(alerts ...Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+
+	select {
+	case n.queue <- alerts:
+	default:
+		n.mu.Lock()
+		n.dropped += len(alerts)
+		n.mu.Unlock()
+		slog.Warn("notification queue full, alerts dropped", "alerts", len(alerts))
+	}
+}
+
+// Stop delivers what's queued, sends pending digests and stops
+func (n *Notifier) Stop() {
+	n.stopOnce.Do(func() { close(n.stopCh) })
+	<-n.doneCh
+}
+
+// Stats reports delivery counts
+func (n *Notifier) Stats() map[string]interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	sinks := make([]string, len(n.config.Sinks))
+	for i, sink := range n.config.Sinks {
+		sinks[i] = sink.Sink.Name()
+	}
+	pending := 0
+	for _, alerts := range n.digests {
+		pending += len(alerts)
+	}
+
+	return map[string]interface{}{
+		"sinks":          sinks,
+		"sent":           n.sent,
+		"failed":         n.failed,
+		"throttled":      n.throttled,
+		"dropped":        n.dropped,
+		"pending_digest": pending,
+	}
+}
+
+func (n *Notifier) run() {
+	defer close(n.doneCh)
+
+	digest := n.config.Digest
+	if digest <= 0 {
+		digest = time.Hour
+	}
+	ticker := time.NewTicker(digest)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case alerts := <-n.queue:
+			n.dispatch(alerts)
+		case <-ticker.C:
+			n.flushDigests()
+			n.pruneThrottle()
+		case <-n.stopCh:
+			for {
+				select {
+				case alerts := <-n.queue:
+					n.dispatch(alerts)
+				default:
+					n.flushDigests()
+					return
+				}
+			}
+		}
+	}
+}
+
+// dispatch sends each sink its immediate alerts and holds back its digest ones
+func (n *Notifier) dispatch(alerts []Alert) {
+	now := time.Now()
+
+	for _, sink := range n.config.Sinks {
+		name := sink.Sink.Name()
+		immediate := make([]Alert, 0)
+
+		n.mu.Lock()
+		for _, alert := range alerts {
+			mode := sink.Routes[alert.Severity]
+			if mode != NotifyImmediate && mode != NotifyDigest {
+				continue
+			}
+
+			key := name + "\x00" + alert.Type + "\x00" + alert.Title + "\x00" + alert.Message
+			if last, ok := n.lastSent[key]; ok && now.Sub(last) < n.config.Throttle {
+				n.throttled++
+				continue
+			}
+			n.lastSent[key] = now
+
+			if mode == NotifyDigest {
+				n.digests[name] = append(n.digests[name], alert)
+			} else {
+				immediate = append(immediate, alert)
+			}
+		}
+		n.mu.Unlock()
+
+		if len(immediate) > 0 {
+			n.send(sink.Sink, immediate, false)
+		}
+	}
+}
+
+// flushDigests sends every sink its pending digest
+func (n *Notifier) flushDigests() {
+	for _, sink := range n.config.Sinks {
+		name := sink.Sink.Name()
+
+		n.mu.Lock()
+		alerts := n.digests[name]
+		delete(n.digests, name)
+		n.mu.Unlock()
+
+		if len(alerts) > 0 {
+			n.send(sink.Sink, alerts, true)
+		}
+	}
+}
+
+// pruneThrottle forgets deliveries older than the throttle window
+func (n *Notifier) pruneThrottle() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	for key, last := range n.lastSent {
+		if now.Sub(last) >= n.config.Throttle {
+			delete(n.lastSent, key)
+		}
+	}
+}
+
+func (n *Notifier) send(sink NotificationSink, alerts []Alert, digest bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifySendTimeout)
+	defer cancel()
+
+	err := sink.Send(ctx, alerts, digest)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		n.failed += len(alerts)
+		slog.Warn("failed to send notification", "sink", sink.Name(), "alerts", len(alerts), "error", err)
+		return
+	}
+	n.sent += len(alerts)
+}
+
+// WebhookSink posts alerts as JSON: {"digest": bool, "alerts": [...]}
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting to url
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: notifySendTimeout}}
+}
+
+// Name identifies the sink
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+// Send posts the alerts
+func (s *WebhookSink) Send(ctx context.Context, alerts []Alert, digest bool) error {
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{
+		"digest": digest,
+		"alerts": alerts,
+	})
+}
+
+// SlackSink posts alerts to a Slack-compatible incoming webhook
+type SlackSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackSink creates a sink posting to a Slack incoming webhook URL
+func NewSlackSink(url string) *SlackSink {
+	return &SlackSink{url: url, client: &http.Client{Timeout: notifySendTimeout}}
+}
+
+// Name identifies the sink
+func (s *SlackSink) Name() string {
+	return "slack"
+}
+
+// Send posts the alerts as one message
+func (s *SlackSink) Send(ctx context.Context, alerts []Alert, digest bool) error {
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{
+		"text": "*" + notificationSubject(alerts, digest) + "*\n" + notificationBody(alerts),
+	})
+}
+
+// EmailConfig configures the SMTP sink
+type EmailConfig struct {
+	Addr     string // host:port
+	Username string // empty sends without authentication
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailSink mails alerts through an SMTP server
+type EmailSink struct {
+	config EmailConfig
+}
+
+// NewEmailSink creates an SMTP sink
+func NewEmailSink(config EmailConfig) *EmailSink {
+	return &EmailSink{config: config}
+}
+
+// Name identifies the sink
+func (s *EmailSink) Name() string {
+	return "email"
+}
+
+// Send mails the alerts as one message. net/smtp can't be cancelled, so ctx
+// only bounds how long the caller waits.
+func (s *EmailSink) Send(ctx context.Context, alerts []Alert, digest bool) error {
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		host, _, _ := strings.Cut(s.config.Addr, ":")
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", notificationSubject(alerts, digest))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(notificationBody(alerts), "\n", "\r\n"))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.config.Addr, auth, s.config.From, s.config.To, msg.Bytes())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to send email: %w", ctx.Err())
+	}
+}
+
+// postJSON posts payload and treats any non-2xx response as a failure
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// notificationSubject summarizes a message's alerts in one line
+func notificationSubject(alerts []Alert, digest bool) string {
+	if digest {
+		return fmt.Sprintf("Watchdog digest: %d alerts", len(alerts))
+	}
+	if len(alerts) == 1 {
+		return fmt.Sprintf("Watchdog %s: %s", alerts[0].Severity, alerts[0].Title)
+	}
+	return fmt.Sprintf("Watchdog: %d alerts", len(alerts))
+}
+
+// notificationBody lists up to maxNotifiedAlerts alerts, one per line
+func notificationBody(alerts []Alert) string {
+	var body strings.Builder
+	for i, alert := range alerts {
+		if i == maxNotifiedAlerts {
+			fmt.Fprintf(&body, "…and %d more\n", len(alerts)-maxNotifiedAlerts)
+			break
+		}
+		fmt.Fprintf(&body, "[%s] %s: %s (%s)\n",
+			strings.ToUpper(alert.Severity), alert.Title, alert.Message, alert.Timestamp.Format(time.RFC3339))
+	}
+	return body.String()
+}
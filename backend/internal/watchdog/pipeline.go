@@ -0,0 +1,565 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/internal/terminal"
+)
+
+// Execution statuses
+const (
+	ExecutionRunning    = "running"
+	ExecutionPassed     = "passed" // checks passed; the branch waits for a manual merge
+	ExecutionFailed     = "failed"
+	ExecutionApplied    = "applied"
+	ExecutionRolledBack = "rolled_back"
+)
+
+const (
+	// maxStepOutput is how much of a step's output is kept on the proposal
+	maxStepOutput = 8 * 1024
+	exitMarker    = "__PIPELINE_EXIT__"
+)
+
+var (
+	// ErrProposalNotFound is returned for unknown proposal IDs
+	ErrProposalNotFound = errors.New("proposal not found")
+	// ErrInvalidProposal is returned for changes the pipeline can't apply
+	ErrInvalidProposal = errors.New("invalid proposal")
+	// ErrProposalConflict is returned when a proposal's execution state doesn't allow the action
+	ErrProposalConflict = errors.New("proposal conflict")
+)
+
+var exitStatusPattern = regexp.MustCompile(exitMarker + `(\d+)`)
+
+// sandboxEnvKeys are the only variables sandboxed builds see
+var sandboxEnvKeys = []string{
+	"PATH", "HOME", "USER", "LANG", "TMPDIR",
+	"GOROOT", "GOPATH", "GOMODCACHE", "GOCACHE", "GOPROXY", "GOFLAGS", "GOTOOLCHAIN",
+}
+
+// gitIdentity commits as the watchdog whatever the repository's user config
+var gitIdentity = []string{"-c", "user.name=Watchdog", "-c", "user.email=watchdog@localhost"}
+
+// Execution records a proposal's trip through the pipeline
+type Execution struct {
+	Status       string          `json:"status"`
+	Branch       string          `json:"branch"`
+	BaseCommit   string          `json:"base_commit,omitempty"`
+	Commit       string          `json:"commit,omitempty"`
+	MergeCommit  string          `json:"merge_commit,omitempty"`
+	RevertCommit string          `json:"revert_commit,omitempty"`
+	Steps        []ExecutionStep `json:"steps"`
+	Error        string          `json:"error,omitempty"`
+	StartedAt    time.Time       `json:"started_at"`
+	FinishedAt   time.Time       `json:"finished_at,omitempty"`
+}
+
+// ExecutionStep is one sandboxed command's result
+type ExecutionStep struct {
+	Name       string `json:"name"`
+	Command    string `json:"command"`
+	Passed     bool   `json:"passed"`
+	Output     string `json:"output,omitempty"` // the end of the command's output
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// PipelineConfig configures proposal execution
+type PipelineConfig struct {
+	Workspace string        // directory inside the git repository proposals change; change paths are relative to it
+	WorkDir   string        // scratch worktrees and step logs
+	Build     string        // run in the sandbox first; empty skips it
+	Test      string        // run after a successful build; empty skips it
+	Timeout   time.Duration // per step
+	Apply     bool          // merge proposals whose checks pass into the workspace
+}
+
+// PipelineConfigFromEnv reads WORKSPACE_ROOT and the WATCHDOG_PIPELINE_* variables
+func PipelineConfigFromEnv() PipelineConfig {
+	return PipelineConfig{
+		Workspace: getEnv("WORKSPACE_ROOT", "."),
+		WorkDir:   getEnv("WATCHDOG_PIPELINE_DIR", "./data/proposals"),
+		Build:     getEnv("WATCHDOG_PIPELINE_BUILD", "go build ./..."),
+		Test:      getEnv("WATCHDOG_PIPELINE_TEST", "go test ./..."),
+		Timeout:   time.Duration(getEnvInt("WATCHDOG_PIPELINE_TIMEOUT_MINUTES", 10)) * time.Minute,
+		Apply:     getEnv("WATCHDOG_PIPELINE_APPLY", "true") != "false",
+	}
+}
+
+// Pipeline tries approved proposals on a scratch branch, builds and tests
+// them in a sandboxed terminal session and merges the ones that pass
+type Pipeline struct {
+	config    PipelineConfig
+	terminals *terminal.Manager
+	mu        sync.Mutex // one proposal touches the repository at a time
+}
+
+// NewPipeline creates a proposal pipeline running checks in terminals
+func NewPipeline(config PipelineConfig, terminals *terminal.Manager) *Pipeline {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Minute
+	}
+	return &Pipeline{config: config, terminals: terminals}
+}
+
+// SetPipeline makes approving a proposal execute it
+func (w *Watchdog) SetPipeline(pipeline *Pipeline) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pipeline = pipeline
+}
+
+// startExecutionLocked starts the pipeline for an approved proposal; callers
+// must hold w.mu
+func (w *Watchdog) startExecutionLocked(proposal *Proposal) error {
+	if proposal.Execution != nil && proposal.Execution.Status != ExecutionRolledBack {
+		return fmt.Errorf("%w: proposal %s is %s; roll it back first", ErrProposalConflict, proposal.ID, proposal.Execution.Status)
+	}
+	if err := validateChanges(proposal.Changes); err != nil {
+		return err
+	}
+
+	proposal.Execution = &Execution{
+		Status:    ExecutionRunning,
+		Branch:    "evolve/" + proposal.ID,
+		Steps:     make([]ExecutionStep, 0),
+		StartedAt: time.Now(),
+	}
+	w.publishExecutionLocked(proposal)
+
+	go w.pipeline.execute(w, proposal.ID, proposal.Description, proposal.Changes)
+	return nil
+}
+
+// RollbackProposal undoes a proposal's execution: an applied proposal is
+// reverted in the workspace and its branch is deleted either way
+func (w *Watchdog) RollbackProposal(id string) error {
+	w.mu.RLock()
+	pipeline := w.pipeline
+	w.mu.RUnlock()
+
+	if pipeline == nil {
+		return fmt.Errorf("%w: proposal execution is disabled", ErrProposalConflict)
+	}
+	return pipeline.rollback(w, id)
+}
+
+// publishExecutionLocked publishes a proposal's execution status; callers
+// must hold w.mu
+func (w *Watchdog) publishExecutionLocked(proposal *Proposal) {
+	w.events.Publish(EventProposalExecution, map[string]interface{}{
+		"proposal_id": proposal.ID,
+		"status":      proposal.Execution.Status,
+		"branch":      proposal.Execution.Branch,
+		"error":       proposal.Execution.Error,
+	})
+}
+
+// updateExecution changes a proposal's execution under w.mu
+func (w *Watchdog) updateExecution(id string, update func(*Execution)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if proposal, exists := w.proposals[id]; exists && proposal.Execution != nil {
+		previous := proposal.Execution.Status
+		update(proposal.Execution)
+		proposal.UpdatedAt = time.Now()
+		if proposal.Execution.Status != previous {
+			w.publishExecutionLocked(proposal)
+		}
+	}
+}
+
+// execute runs a proposal through the pipeline and records the outcome
+func (p *Pipeline) execute(w *Watchdog, id, description string, changes map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status, err := p.executeLocked(w, id, description, changes)
+
+	var failure string
+	if err != nil {
+		failure = err.Error()
+		slog.Warn("proposal failed", "proposal_id", id, "error", err)
+	}
+	w.updateExecution(id, func(e *Execution) {
+		e.Status = status
+		e.Error = failure
+		e.FinishedAt = time.Now()
+	})
+	proposalEvents.Inc(status)
+	if status == ExecutionApplied {
+		w.updateProposal(id, func(p *Proposal) {
+			w.transitionLocked(p, ProposalApplied, "pipeline", "merged after passing its checks")
+			w.noteEvolutionLocked(p)
+		})
+	}
+
+	context := map[string]interface{}{"proposal_id": id, "branch": "evolve/" + id}
+	var alert Alert
+	switch status {
+	case ExecutionApplied:
+		alert = w.createAlert(AlertTypeProposal, AlertSeverityInfo, "Proposal Applied",
+			fmt.Sprintf("Proposal %s passed its checks and was merged", id), context)
+	case ExecutionPassed:
+		alert = w.createAlert(AlertTypeProposal, AlertSeverityInfo, "Proposal Ready to Merge",
+			fmt.Sprintf("Proposal %s passed its checks on branch evolve/%s", id, id), context)
+	default:
+		context["error"] = failure
+		alert = w.createAlert(AlertTypeProposal, AlertSeverityWarning, "Proposal Failed Checks",
+			fmt.Sprintf("Proposal %s was not applied", id), context)
+	}
+	w.recordAlerts(alert)
+}
+
+// executeLocked commits the changes on the proposal's branch, checks them
+// and merges them; callers must hold p.mu
+func (p *Pipeline) executeLocked(w *Watchdog, id, description string, changes map[string]interface{}) (string, error) {
+	ctx := context.Background()
+	branch := "evolve/" + id
+
+	top, prefix, err := p.repository(ctx)
+	if err != nil {
+		return ExecutionFailed, err
+	}
+	base, err := git(ctx, top, "rev-parse", "HEAD")
+	if err != nil {
+		return ExecutionFailed, err
+	}
+	w.updateExecution(id, func(e *Execution) { e.BaseCommit = base })
+
+	dir, err := filepath.Abs(filepath.Join(p.config.WorkDir, id))
+	if err != nil {
+		return ExecutionFailed, fmt.Errorf("failed to resolve pipeline directory: %w", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return ExecutionFailed, fmt.Errorf("failed to clear pipeline directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ExecutionFailed, fmt.Errorf("failed to create pipeline directory: %w", err)
+	}
+
+	worktree := filepath.Join(dir, "worktree")
+	if _, err := git(ctx, top, "worktree", "add", "-b", branch, worktree, base); err != nil {
+		return ExecutionFailed, err
+	}
+	defer func() {
+		if _, err := git(ctx, top, "worktree", "remove", "--force", worktree); err != nil {
+			slog.Warn("failed to remove proposal worktree", "proposal_id", id, "error", err)
+		}
+	}()
+
+	// Materialize the changes as a commit on the proposal's branch
+	if err := materializeChanges(ctx, worktree, prefix, changes); err != nil {
+		return ExecutionFailed, err
+	}
+	if _, err := git(ctx, worktree, "add", "-A"); err != nil {
+		return ExecutionFailed, err
+	}
+	if _, err := git(ctx, worktree, "diff", "--cached", "--quiet"); err == nil {
+		return ExecutionFailed, fmt.Errorf("%w: changes leave the workspace unchanged", ErrInvalidProposal)
+	}
+	message := fmt.Sprintf("Proposal %s: %s", id, description)
+	if _, err := git(ctx, worktree, append(gitIdentity, "commit", "-q", "-m", message)...); err != nil {
+		return ExecutionFailed, err
+	}
+	commit, err := git(ctx, worktree, "rev-parse", "HEAD")
+	if err != nil {
+		return ExecutionFailed, err
+	}
+	w.updateExecution(id, func(e *Execution) { e.Commit = commit })
+
+	// The pipeline commits as an agent, so error findings keep it from merging
+	if monitor := w.commitMonitor(); monitor != nil {
+		report, err := monitor.analyze(ctx, w, filepath.Join(worktree, prefix), commit)
+		if err != nil {
+			return ExecutionFailed, err
+		}
+		if monitor.blocks(report) {
+			return ExecutionFailed, fmt.Errorf("%w: commit introduces error findings: %s", ErrInvalidProposal,
+				strings.Join(findingTitles(report.Findings, AlertSeverityError), ", "))
+		}
+	}
+
+	// Build and test where the proposal can't see the server's secrets
+	if err := p.check(w, id, filepath.Join(worktree, prefix), dir); err != nil {
+		return ExecutionFailed, err
+	}
+	if !p.config.Apply {
+		return ExecutionPassed, nil
+	}
+
+	merge := fmt.Sprintf("Apply proposal %s", id)
+	if _, err := git(ctx, top, append(gitIdentity, "merge", "--no-ff", "-q", "-m", merge, branch)...); err != nil {
+		git(ctx, top, "merge", "--abort")
+		return ExecutionFailed, err
+	}
+	mergeCommit, err := git(ctx, top, "rev-parse", "HEAD")
+	if err != nil {
+		return ExecutionApplied, err
+	}
+	w.updateExecution(id, func(e *Execution) { e.MergeCommit = mergeCommit })
+
+	slog.Info("applied proposal", "proposal_id", id, "commit", mergeCommit[:min(len(mergeCommit), 12)])
+	return ExecutionApplied, nil
+}
+
+// check runs the build and test steps in a sandboxed terminal session,
+// stopping at the first failure
+func (p *Pipeline) check(w *Watchdog, id, root, logDir string) error {
+	if p.terminals == nil {
+		return fmt.Errorf("no terminal manager for sandboxed checks")
+	}
+
+	sessionID := "proposal-" + id
+	session, err := p.terminals.CreateSandboxSession(sessionID, root, sandboxEnv())
+	if err != nil {
+		return fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	defer p.terminals.CloseSession(sessionID)
+
+	steps := []struct{ name, command string }{
+		{"build", p.config.Build},
+		{"test", p.config.Test},
+	}
+	for _, step := range steps {
+		if step.command == "" {
+			continue
+		}
+
+		result := p.runStep(session, step.name, step.command, filepath.Join(logDir, step.name+".log"))
+		w.updateExecution(id, func(e *Execution) { e.Steps = append(e.Steps, result) })
+		if !result.Passed {
+			return fmt.Errorf("%s step failed", step.name)
+		}
+	}
+
+	return nil
+}
+
+// runStep runs one command with its output sent to a log file, since the
+// terminal only keeps its most recent lines
+func (p *Pipeline) runStep(session *terminal.Session, name, command, logPath string) ExecutionStep {
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	output, err := session.ExecuteWithContext(ctx,
+		fmt.Sprintf(`(%s) > %s 2>&1; echo "%s$?"`, command, shellQuote(logPath), exitMarker))
+
+	step := ExecutionStep{
+		Name:       name,
+		Command:    command,
+		Output:     readTail(logPath, maxStepOutput),
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		step.Output = strings.TrimSpace(step.Output + "\n" + err.Error())
+		return step
+	}
+
+	match := exitStatusPattern.FindStringSubmatch(output)
+	step.Passed = match != nil && match[1] == "0"
+	return step
+}
+
+// rollback reverts an applied proposal and deletes its branch
+func (p *Pipeline) rollback(w *Watchdog, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w.mu.RLock()
+	proposal, exists := w.proposals[id]
+	var execution Execution
+	if exists && proposal.Execution != nil {
+		execution = *proposal.Execution
+	}
+	w.mu.RUnlock()
+
+	switch {
+	case !exists:
+		return fmt.Errorf("%w: %s", ErrProposalNotFound, id)
+	case execution.Status == "":
+		return fmt.Errorf("%w: proposal %s has not been executed", ErrProposalConflict, id)
+	case execution.Status == ExecutionRunning, execution.Status == ExecutionRolledBack:
+		return fmt.Errorf("%w: proposal %s is %s", ErrProposalConflict, id, execution.Status)
+	}
+
+	ctx := context.Background()
+	top, _, err := p.repository(ctx)
+	if err != nil {
+		return err
+	}
+
+	var revert string
+	if execution.Status == ExecutionApplied && execution.MergeCommit != "" {
+		if _, err := git(ctx, top, append(gitIdentity, "revert", "--no-edit", "-m", "1", execution.MergeCommit)...); err != nil {
+			git(ctx, top, "revert", "--abort")
+			return err
+		}
+		if revert, err = git(ctx, top, "rev-parse", "HEAD"); err != nil {
+			return err
+		}
+	}
+
+	// The branch may already be gone if someone cleaned up by hand
+	if _, err := git(ctx, top, "branch", "-D", execution.Branch); err != nil {
+		slog.Warn("failed to delete proposal branch", "proposal_id", id, "error", err)
+	}
+
+	w.updateExecution(id, func(e *Execution) {
+		e.Status = ExecutionRolledBack
+		e.RevertCommit = revert
+	})
+	// A rolled back proposal goes back to review and needs approving again
+	w.updateProposal(id, func(p *Proposal) {
+		if p.Status != ProposalRejected {
+			p.Approvals = make([]Approval, 0)
+			w.transitionLocked(p, ProposalReview, "pipeline", "rolled back")
+		}
+	})
+	proposalEvents.Inc(ExecutionRolledBack)
+	w.recordAlerts(w.createAlert(AlertTypeProposal, AlertSeverityInfo, "Proposal Rolled Back",
+		fmt.Sprintf("Proposal %s was rolled back", id),
+		map[string]interface{}{"proposal_id": id, "revert_commit": revert}))
+
+	slog.Info("rolled back proposal", "proposal_id", id)
+	return nil
+}
+
+// repository returns the top level of the workspace's git repository and
+// the workspace's path within it ("" or ending in "/")
+func (p *Pipeline) repository(ctx context.Context) (string, string, error) {
+	top, err := git(ctx, p.config.Workspace, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", fmt.Errorf("workspace is not in a git repository: %w", err)
+	}
+	prefix, err := git(ctx, p.config.Workspace, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", "", err
+	}
+	return top, prefix, nil
+}
+
+// validateChanges checks a proposal's changes before anything is run.
+// Changes hold "files", a map of workspace-relative paths to their new
+// contents (null deletes the file), and/or "patch", a unified diff.
+func validateChanges(changes map[string]interface{}) error {
+	files, _ := changes["files"].(map[string]interface{})
+	patch, _ := changes["patch"].(string)
+	if len(files) == 0 && strings.TrimSpace(patch) == "" {
+		return fmt.Errorf("%w: changes need files or a patch", ErrInvalidProposal)
+	}
+
+	for path, content := range files {
+		if !filepath.IsLocal(path) || strings.SplitN(filepath.ToSlash(filepath.Clean(path)), "/", 2)[0] == ".git" {
+			return fmt.Errorf("%w: %q is not a path inside the workspace", ErrInvalidProposal, path)
+		}
+		if _, ok := content.(string); content != nil && !ok {
+			return fmt.Errorf("%w: contents of %s must be a string or null", ErrInvalidProposal, path)
+		}
+	}
+	return nil
+}
+
+// materializeChanges writes validated changes into a worktree
+func materializeChanges(ctx context.Context, worktree, prefix string, changes map[string]interface{}) error {
+	if err := validateChanges(changes); err != nil {
+		return err
+	}
+
+	if patch, _ := changes["patch"].(string); strings.TrimSpace(patch) != "" {
+		args := []string{"apply", "--whitespace=nowarn"}
+		if prefix != "" {
+			args = append(args, "--directory="+strings.TrimSuffix(prefix, "/"))
+		}
+		if _, err := gitInput(ctx, worktree, patch, args...); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProposal, err)
+		}
+	}
+
+	files, _ := changes["files"].(map[string]interface{})
+	root := filepath.Join(worktree, prefix)
+	for path, content := range files {
+		target := filepath.Join(root, path)
+
+		if content == nil {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete %s: %w", path, err)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", path, err)
+		}
+		if err := os.WriteFile(target, []byte(content.(string)), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// git runs a git command in dir and returns its trimmed output
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	return gitInput(ctx, dir, "", args...)
+}
+
+// gitInput runs a git command with input on stdin
+func gitInput(ctx context.Context, dir, input string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// sandboxEnv returns the environment for sandboxed checks
+func sandboxEnv() []string {
+	env := make([]string, 0, len(sandboxEnvKeys))
+	for _, key := range sandboxEnvKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// readTail returns up to the last n bytes of a file
+func readTail(path string, n int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.Size() > n {
+		f.Seek(info.Size()-n, io.SeekStart)
+	}
+	data, _ := io.ReadAll(f)
+	return string(data)
+}
+
+// shellQuote quotes s for bash
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
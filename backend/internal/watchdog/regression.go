@@ -0,0 +1,604 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/pkg/models"
+)
+
+const (
+	// maxRegressionSamples is how many samples are kept per strategy
+	maxRegressionSamples = 1000
+	// maxEvolutions is how many evolutions are kept for testing
+	maxEvolutions = 50
+	// maxSeenTasks is how many task IDs are remembered to skip repeats
+	maxSeenTasks = 10000
+)
+
+// Task metrics compared across an evolution
+const (
+	MetricDuration = "duration_seconds"
+	MetricRetries  = "retries"
+	MetricTokens   = "tokens"
+)
+
+var (
+	// ErrInvalidTaskMetrics is returned for malformed task metrics
+	ErrInvalidTaskMetrics = errors.New("invalid task metrics")
+	// ErrRegressionsDisabled is returned when regressions aren't being detected
+	ErrRegressionsDisabled = errors.New("regression detection disabled")
+)
+
+var regressionMetrics = []string{MetricDuration, MetricRetries, MetricTokens}
+
+// RegressionConfig configures performance regression detection
+type RegressionConfig struct {
+	Window      int     // samples compared on each side of an evolution
+	MinSamples  int     // fewest samples on each side for a test, when a later evolution cuts the window short
+	Alpha       float64 // significance level of the one-sided Mann-Whitney test
+	MinIncrease float64 // smallest relative increase of a metric's mean that counts
+	AutoRevert  bool    // propose reverting the proposal behind a regression
+}
+
+// RegressionConfigFromEnv reads WATCHDOG_REGRESSION_WINDOW,
+// WATCHDOG_REGRESSION_MIN_SAMPLES, WATCHDOG_REGRESSION_ALPHA,
+// WATCHDOG_REGRESSION_MIN_INCREASE and WATCHDOG_REGRESSION_AUTO_REVERT
+func RegressionConfigFromEnv() (RegressionConfig, error) {
+	config := RegressionConfig{
+		Window:      getEnvInt("WATCHDOG_REGRESSION_WINDOW", 20),
+		MinSamples:  getEnvInt("WATCHDOG_REGRESSION_MIN_SAMPLES", 8),
+		Alpha:       0.05,
+		MinIncrease: 0.2,
+		AutoRevert:  getEnv("WATCHDOG_REGRESSION_AUTO_REVERT", "true") != "false",
+	}
+
+	for key, target := range map[string]*float64{
+		"WATCHDOG_REGRESSION_ALPHA":        &config.Alpha,
+		"WATCHDOG_REGRESSION_MIN_INCREASE": &config.MinIncrease,
+	} {
+		if value := getEnv(key, ""); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s %q: %w", key, value, err)
+			}
+			*target = parsed
+		}
+	}
+
+	return config, nil
+}
+
+// TaskSample is one finished task's cost
+type TaskSample struct {
+	TaskID        string    `json:"task_id"`
+	Strategy      string    `json:"strategy"`
+	PromptVersion string    `json:"prompt_version,omitempty"`
+	Duration      float64   `json:"duration_seconds"`
+	Retries       int       `json:"retries"`
+	Tokens        int       `json:"tokens"`
+	Success       bool      `json:"success"`
+	FinishedAt    time.Time `json:"finished_at"`
+}
+
+// metric returns one of the sample's metrics
+func (s TaskSample) metric(name string) float64 {
+	switch name {
+	case MetricRetries:
+		return float64(s.Retries)
+	case MetricTokens:
+		return float64(s.Tokens)
+	default:
+		return s.Duration
+	}
+}
+
+// Evolution is a change to how agents work: an applied proposal, or a new
+// prompt version for a strategy
+type Evolution struct {
+	ID          string    `json:"id"`
+	ProposalID  string    `json:"proposal_id,omitempty"`
+	Strategy    string    `json:"strategy,omitempty"` // "" affects every strategy
+	Description string    `json:"description"`
+	At          time.Time `json:"at"`
+
+	tested map[string]bool // strategies whose windows have been compared
+}
+
+// Regression is a metric that got significantly worse after an evolution
+type Regression struct {
+	Evolution Evolution `json:"evolution"`
+	Strategy  string    `json:"strategy"`
+	Metric    string    `json:"metric"`
+	Before    float64   `json:"before"`   // mean over the window before the evolution
+	After     float64   `json:"after"`    // mean over the window after it
+	Increase  float64   `json:"increase"` // relative; 1 when the metric was zero before
+	PValue    float64   `json:"p_value"`
+	Samples   [2]int    `json:"samples"` // before, after
+}
+
+// RegressionDetector collects task durations, retries and token usage per
+// strategy and, once enough tasks have finished after an evolution, tests
+// whether each metric got worse than in the tasks before it. Each
+// evolution is tested once per strategy.
+type RegressionDetector struct {
+	config RegressionConfig
+
+	mu         sync.Mutex
+	samples    map[string][]TaskSample // strategy -> samples in finishing order
+	versions   map[string]string       // strategy -> latest prompt version
+	evolutions []*Evolution
+	seen       map[string]bool
+	seenOrder  []string
+	reverted   map[string]bool // proposals a revert was proposed for
+	found      int
+}
+
+// NewRegressionDetector creates a regression detector
+func NewRegressionDetector(config RegressionConfig) (*RegressionDetector, error) {
+	if config.Window < 2 {
+		return nil, fmt.Errorf("window must be at least 2, got %d", config.Window)
+	}
+	if config.MinSamples < 2 || config.MinSamples > config.Window {
+		return nil, fmt.Errorf("min samples must be in [2, window], got %d", config.MinSamples)
+	}
+	if config.Alpha <= 0 || config.Alpha >= 1 {
+		return nil, fmt.Errorf("alpha must be in (0, 1), got %g", config.Alpha)
+	}
+	if config.MinIncrease < 0 {
+		return nil, fmt.Errorf("min increase can't be negative, got %g", config.MinIncrease)
+	}
+
+	return &RegressionDetector{
+		config:   config,
+		samples:  make(map[string][]TaskSample),
+		versions: make(map[string]string),
+		seen:     make(map[string]bool),
+		reverted: make(map[string]bool),
+	}, nil
+}
+
+// SetRegressionDetector enables performance regression detection
+func (w *Watchdog) SetRegressionDetector(detector *RegressionDetector) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.regressions = detector
+}
+
+// Stats returns regression detection counters
+func (d *RegressionDetector) Stats() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	samples := make(map[string]int, len(d.samples))
+	for strategy, list := range d.samples {
+		samples[strategy] = len(list)
+	}
+	return map[string]interface{}{
+		"samples":     samples,
+		"evolutions":  len(d.evolutions),
+		"regressions": d.found,
+	}
+}
+
+// Add records a finished task's sample. A sample whose prompt version
+// differs from the strategy's last one marks a prompt evolution. It
+// returns false for tasks already recorded.
+func (d *RegressionDetector) Add(sample TaskSample) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if sample.TaskID != "" {
+		if d.seen[sample.TaskID] {
+			return false
+		}
+		d.seen[sample.TaskID] = true
+		d.seenOrder = append(d.seenOrder, sample.TaskID)
+		if len(d.seenOrder) > maxSeenTasks {
+			delete(d.seen, d.seenOrder[0])
+			d.seenOrder = d.seenOrder[1:]
+		}
+	}
+	if sample.Strategy == "" {
+		sample.Strategy = defaultDriftStrategy
+	}
+	if sample.FinishedAt.IsZero() {
+		sample.FinishedAt = time.Now()
+	}
+
+	if version := sample.PromptVersion; version != "" {
+		if previous, ok := d.versions[sample.Strategy]; ok && previous != version {
+			d.addEvolutionLocked(&Evolution{
+				ID:          fmt.Sprintf("prompt:%s:%s", sample.Strategy, version),
+				Strategy:    sample.Strategy,
+				Description: fmt.Sprintf("prompt of strategy %q changed from %s to %s", sample.Strategy, previous, version),
+				At:          sample.FinishedAt,
+			})
+		}
+		d.versions[sample.Strategy] = version
+	}
+
+	// Samples usually arrive in order; keep them sorted when they don't
+	list := append(d.samples[sample.Strategy], sample)
+	for i := len(list) - 1; i > 0 && list[i].FinishedAt.Before(list[i-1].FinishedAt); i-- {
+		list[i], list[i-1] = list[i-1], list[i]
+	}
+	if len(list) > maxRegressionSamples {
+		list = list[len(list)-maxRegressionSamples:]
+	}
+	d.samples[sample.Strategy] = list
+	return true
+}
+
+// MarkEvolution records an evolution; tasks finishing after it are
+// compared with the ones before
+func (d *RegressionDetector) MarkEvolution(evolution Evolution) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if evolution.At.IsZero() {
+		evolution.At = time.Now()
+	}
+	d.addEvolutionLocked(&evolution)
+}
+
+func (d *RegressionDetector) addEvolutionLocked(evolution *Evolution) {
+	evolution.tested = make(map[string]bool)
+	d.evolutions = append(d.evolutions, evolution)
+	sort.SliceStable(d.evolutions, func(i, j int) bool { return d.evolutions[i].At.Before(d.evolutions[j].At) })
+	if len(d.evolutions) > maxEvolutions {
+		d.evolutions = d.evolutions[len(d.evolutions)-maxEvolutions:]
+	}
+}
+
+// Pending turns tasks that finished since the last call into samples.
+// Tasks name their strategy and prompt version in the "strategy" and
+// "prompt_version" context keys and may report "retries" and "tokens";
+// otherwise failed actions count as retries.
+func (d *RegressionDetector) Pending(tasks []*memory.TaskMemory) []TaskSample {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	samples := make([]TaskSample, 0)
+	for _, task := range tasks {
+		status := task.GetStatus()
+		if d.seen[task.TaskID] || status != memory.TaskStatusCompleted && status != memory.TaskStatusFailed {
+			continue
+		}
+
+		sample := TaskSample{TaskID: task.TaskID, Success: status == memory.TaskStatusCompleted}
+		sample.Strategy, _ = task.GetString("strategy")
+		sample.PromptVersion, _ = task.GetString("prompt_version")
+
+		failed := 0
+		for _, action := range task.GetActions() {
+			if action.Timestamp.After(sample.FinishedAt) {
+				sample.FinishedAt = action.Timestamp
+			}
+			if !action.Success {
+				failed++
+			}
+		}
+		for _, reflection := range task.GetReflections() {
+			if reflection.Timestamp.After(sample.FinishedAt) {
+				sample.FinishedAt = reflection.Timestamp
+			}
+		}
+		if sample.FinishedAt.IsZero() {
+			continue // nothing ran
+		}
+		sample.Duration = sample.FinishedAt.Sub(task.CreatedAt).Seconds()
+		if retries, ok := task.GetInt("retries"); ok {
+			failed = retries
+		}
+		sample.Retries = failed
+		sample.Tokens, _ = task.GetInt("tokens")
+
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Check compares the windows around each evolution that has enough tasks
+// on both sides and returns the metrics that got significantly worse
+func (d *RegressionDetector) Check() []Regression {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	regressions := make([]Regression, 0)
+	for i, evolution := range d.evolutions {
+		for strategy, samples := range d.samples {
+			if evolution.tested[strategy] || evolution.Strategy != "" && evolution.Strategy != strategy {
+				continue
+			}
+
+			// The window after ends at the next evolution of the same strategy
+			end := time.Time{}
+			for _, next := range d.evolutions[i+1:] {
+				if next.Strategy == "" || next.Strategy == strategy {
+					end = next.At
+					break
+				}
+			}
+
+			before, after := splitWindows(samples, evolution.At, end, d.config.Window)
+			complete := len(after) >= d.config.Window || !end.IsZero()
+			if !complete {
+				continue
+			}
+			evolution.tested[strategy] = true
+			if len(before) < d.config.MinSamples || len(after) < d.config.MinSamples {
+				continue
+			}
+
+			for _, metric := range regressionMetrics {
+				if regression, ok := d.compare(before, after, metric); ok {
+					regression.Evolution = *evolution
+					regression.Strategy = strategy
+					regressions = append(regressions, regression)
+				}
+			}
+		}
+	}
+	d.found += len(regressions)
+	return regressions
+}
+
+// compare tests whether a metric is higher after than before
+func (d *RegressionDetector) compare(before, after []TaskSample, metric string) (Regression, bool) {
+	x := make([]float64, len(before))
+	for i, sample := range before {
+		x[i] = sample.metric(metric)
+	}
+	y := make([]float64, len(after))
+	for i, sample := range after {
+		y[i] = sample.metric(metric)
+	}
+
+	meanBefore, meanAfter := mean(x), mean(y)
+	increase := 0.0
+	switch {
+	case meanBefore > 0:
+		increase = (meanAfter - meanBefore) / meanBefore
+	case meanAfter > 0:
+		increase = 1
+	}
+	if increase < d.config.MinIncrease || increase <= 0 {
+		return Regression{}, false
+	}
+
+	p := mannWhitneyGreater(x, y)
+	if p >= d.config.Alpha {
+		return Regression{}, false
+	}
+
+	return Regression{
+		Metric:   metric,
+		Before:   meanBefore,
+		After:    meanAfter,
+		Increase: increase,
+		PValue:   p,
+		Samples:  [2]int{len(x), len(y)},
+	}, true
+}
+
+// markReverted records that a revert was proposed for a proposal and
+// reports whether it already had been
+func (d *RegressionDetector) markReverted(proposalID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.reverted[proposalID] {
+		return true
+	}
+	d.reverted[proposalID] = true
+	return false
+}
+
+// splitWindows returns up to window samples finishing before at and up to
+// window samples finishing from at until end (a zero end is open)
+func splitWindows(samples []TaskSample, at, end time.Time, window int) ([]TaskSample, []TaskSample) {
+	split := sort.Search(len(samples), func(i int) bool { return !samples[i].FinishedAt.Before(at) })
+	before := samples[max(0, split-window):split]
+
+	after := make([]TaskSample, 0, window)
+	for _, sample := range samples[split:] {
+		if len(after) == window || !end.IsZero() && !sample.FinishedAt.Before(end) {
+			break
+		}
+		after = append(after, sample)
+	}
+	return before, after
+}
+
+// mannWhitneyGreater returns the one-sided p-value of the Mann-Whitney U
+// test that y tends to be larger than x, using the normal approximation
+// with tie and continuity corrections. It returns 1 when every value ties.
+func mannWhitneyGreater(x, y []float64) float64 {
+	type ranked struct {
+		value float64
+		fromY bool
+	}
+	all := make([]ranked, 0, len(x)+len(y))
+	for _, v := range x {
+		all = append(all, ranked{value: v})
+	}
+	for _, v := range y {
+		all = append(all, ranked{value: v, fromY: true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	n1, n2 := float64(len(x)), float64(len(y))
+	n := n1 + n2
+	rankSumY, tieTerm := 0.0, 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // average of ranks i+1..j
+		for k := i; k < j; k++ {
+			if all[k].fromY {
+				rankSumY += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	u := rankSumY - n2*(n2+1)/2
+	variance := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (u - n1*n2/2 - 0.5) / math.Sqrt(variance)
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// RecordTaskMetrics feeds a finished task's metrics to regression detection
+func (w *Watchdog) RecordTaskMetrics(req models.TaskMetricsRequest) error {
+	w.mu.RLock()
+	detector := w.regressions
+	w.mu.RUnlock()
+
+	if detector == nil {
+		return ErrRegressionsDisabled
+	}
+	if req.DurationMs < 0 || req.Retries < 0 || req.Tokens < 0 {
+		return fmt.Errorf("%w: metrics can't be negative", ErrInvalidTaskMetrics)
+	}
+
+	finished := time.Now()
+	if req.FinishedAt != "" {
+		parsed, err := time.Parse(time.RFC3339, req.FinishedAt)
+		if err != nil {
+			return fmt.Errorf("%w: finished_at must be RFC 3339", ErrInvalidTaskMetrics)
+		}
+		finished = parsed
+	}
+
+	detector.Add(TaskSample{
+		TaskID:        req.TaskID,
+		Strategy:      req.Strategy,
+		PromptVersion: req.PromptVersion,
+		Duration:      float64(req.DurationMs) / 1000,
+		Retries:       req.Retries,
+		Tokens:        req.Tokens,
+		Success:       req.Success,
+		FinishedAt:    finished,
+	})
+	return nil
+}
+
+// noteEvolutionLocked tells regression detection that a proposal was
+// applied; callers must hold w.mu
+func (w *Watchdog) noteEvolutionLocked(proposal *Proposal) {
+	if w.regressions == nil {
+		return
+	}
+	w.regressions.MarkEvolution(Evolution{
+		ID:          proposal.ID,
+		ProposalID:  proposal.ID,
+		Description: proposal.Description,
+		At:          proposal.UpdatedAt,
+	})
+}
+
+// checkRegressions samples finished tasks and raises an alert for each
+// regression, proposing to revert the proposal behind it
+func (w *Watchdog) checkRegressions() {
+	w.mu.RLock()
+	detector := w.regressions
+	w.mu.RUnlock()
+
+	if detector == nil {
+		return
+	}
+	if w.config.Memory != nil && w.config.Memory.ShortTerm != nil {
+		for _, sample := range detector.Pending(w.config.Memory.ShortTerm.Tasks()) {
+			detector.Add(sample)
+		}
+	}
+
+	alerts := make([]Alert, 0)
+	for _, regression := range detector.Check() {
+		context := map[string]interface{}{
+			"rule":         "performance_regression",
+			"match":        regression.Evolution.ID + "\x00" + regression.Strategy + "\x00" + regression.Metric,
+			"strategy":     regression.Strategy,
+			"metric":       regression.Metric,
+			"before":       regression.Before,
+			"after":        regression.After,
+			"increase":     regression.Increase,
+			"p_value":      regression.PValue,
+			"samples":      regression.Samples,
+			"evolution_id": regression.Evolution.ID,
+		}
+
+		if id := regression.Evolution.ProposalID; id != "" {
+			context["proposal_id"] = id
+			if detector.config.AutoRevert && !detector.markReverted(id) {
+				revertID, err := w.proposeRevert(id, regression)
+				if err != nil {
+					slog.Warn("failed to propose reverting proposal", "proposal_id", id, "error", err)
+				} else {
+					context["revert_proposal_id"] = revertID
+				}
+			}
+		}
+
+		severity := AlertSeverityWarning
+		if regression.PValue < detector.config.Alpha/10 {
+			severity = AlertSeverityError
+		}
+		alerts = append(alerts, w.createAlert(AlertTypePerformance, severity, "Performance Regression",
+			fmt.Sprintf("%s of strategy %q rose %.0f%% (%.2f → %.2f, p=%.3f) after %s",
+				regression.Metric, regression.Strategy, regression.Increase*100, regression.Before, regression.After, regression.PValue, regression.Evolution.Description),
+			context))
+	}
+	w.recordAlerts(alerts...)
+}
+
+// proposeRevert submits a proposal undoing an applied proposal's changes
+func (w *Watchdog) proposeRevert(id string, regression Regression) (string, error) {
+	proposal, err := w.GetProposal(id)
+	if err != nil {
+		return "", err
+	}
+	patch := reversePatch(proposal.Diffs)
+	if patch == "" {
+		return "", fmt.Errorf("proposal %s has no reversible diff; roll it back instead", id)
+	}
+
+	return w.SubmitProposal(models.ProposalRequest{
+		Component: proposal.Component,
+		Description: fmt.Sprintf("Revert proposal %s: %s of strategy %q rose %.0f%% after it was applied",
+			id, regression.Metric, regression.Strategy, regression.Increase*100),
+		Changes: map[string]interface{}{
+			"patch":     patch,
+			"revert_of": id,
+		},
+		Strategy: "regression_revert",
+		Author:   "watchdog",
+	})
+}
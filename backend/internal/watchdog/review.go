@@ -0,0 +1,277 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+// Proposal statuses. A proposal is drafted, reviewed until it has its
+// required approvals, applied by the pipeline or by hand and finally
+// verified; it can be rejected until it is applied.
+const (
+	ProposalDraft    = "draft"
+	ProposalReview   = "review"
+	ProposalApproved = "approved"
+	ProposalApplied  = "applied"
+	ProposalVerified = "verified"
+	ProposalRejected = "rejected"
+)
+
+// ErrCommentNotFound is returned for unknown review comment IDs
+var ErrCommentNotFound = errors.New("comment not found")
+
+// commentSeq keeps comment IDs unique within a second
+var commentSeq atomic.Uint64
+
+// ReviewConfig configures proposal review
+type ReviewConfig struct {
+	Workspace         string // proposal diffs are rendered against it
+	RequiredApprovals int    // approvals a proposal needs unless it asks for more
+}
+
+// DefaultReviewConfig renders diffs against the working directory and
+// needs one approval
+func DefaultReviewConfig() ReviewConfig {
+	return ReviewConfig{Workspace: ".", RequiredApprovals: 1}
+}
+
+// ReviewConfigFromEnv reads WORKSPACE_ROOT and WATCHDOG_REQUIRED_APPROVALS
+func ReviewConfigFromEnv() ReviewConfig {
+	return ReviewConfig{
+		Workspace:         getEnv("WORKSPACE_ROOT", "."),
+		RequiredApprovals: max(getEnvInt("WATCHDOG_REQUIRED_APPROVALS", 1), 1),
+	}
+}
+
+// ReviewComment is a reviewer's note on a proposal, optionally anchored to
+// a line of its diff
+type ReviewComment struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	File      string    `json:"file,omitempty"`
+	Line      int       `json:"line,omitempty"`
+	Side      string    `json:"side,omitempty"`     // "old" or "new" side of the diff; "new" by default
+	ReplyTo   string    `json:"reply_to,omitempty"` // the comment this answers
+	Resolved  bool      `json:"resolved"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Approval is a reviewer's sign-off
+type Approval struct {
+	Reviewer   string    `json:"reviewer"`
+	Comment    string    `json:"comment,omitempty"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// ProposalEvent is a status change in a proposal's timeline
+type ProposalEvent struct {
+	Status string    `json:"status"`
+	Actor  string    `json:"actor"`
+	Note   string    `json:"note,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// SetReviewConfig configures proposal review
+func (w *Watchdog) SetReviewConfig(config ReviewConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.review = config
+}
+
+// transitionLocked moves a proposal to status, records it in the timeline
+// and publishes it; callers must hold w.mu
+func (w *Watchdog) transitionLocked(p *Proposal, status, actor, note string) {
+	now := time.Now()
+	p.Status = status
+	p.UpdatedAt = now
+	p.Timeline = append(p.Timeline, ProposalEvent{Status: status, Actor: actor, Note: note, At: now})
+
+	w.events.Publish(EventProposalStatus, map[string]interface{}{
+		"proposal_id": p.ID,
+		"component":   p.Component,
+		"status":      status,
+		"actor":       actor,
+		"note":        note,
+	})
+}
+
+// updateProposal changes a proposal under w.mu
+func (w *Watchdog) updateProposal(id string, update func(*Proposal)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if proposal, exists := w.proposals[id]; exists {
+		update(proposal)
+	}
+}
+
+// proposalLocked returns the proposal with id; callers must hold w.mu
+func (w *Watchdog) proposalLocked(id string) (*Proposal, error) {
+	proposal, exists := w.proposals[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrProposalNotFound, id)
+	}
+	return proposal, nil
+}
+
+// SubmitForReview moves a draft proposal into review
+func (w *Watchdog) SubmitForReview(id string, req models.ProposalReviewRequest) (*Proposal, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	proposal, err := w.proposalLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != ProposalDraft {
+		return nil, fmt.Errorf("%w: proposal %s is %s, not a draft", ErrProposalConflict, id, proposal.Status)
+	}
+
+	w.transitionLocked(proposal, ProposalReview, req.Reviewer, req.Comment)
+	proposalEvents.Inc(ProposalReview)
+	return proposal.clone(), nil
+}
+
+// AddComment adds a review comment. A comment anchored to a file must name
+// a file the proposal changes.
+func (w *Watchdog) AddComment(id string, req models.ProposalCommentRequest) (*ReviewComment, error) {
+	if strings.TrimSpace(req.Body) == "" {
+		return nil, fmt.Errorf("%w: comment body is required", ErrInvalidProposal)
+	}
+	if req.Side != "" && req.Side != "old" && req.Side != "new" {
+		return nil, fmt.Errorf("%w: side must be old or new", ErrInvalidProposal)
+	}
+	if req.Line < 0 || req.Line > 0 && req.File == "" {
+		return nil, fmt.Errorf("%w: a line comment needs a file and a positive line", ErrInvalidProposal)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	proposal, err := w.proposalLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.File != "" && !proposal.changesFile(req.File) {
+		return nil, fmt.Errorf("%w: proposal %s doesn't change %s", ErrInvalidProposal, id, req.File)
+	}
+	if req.ReplyTo != "" && proposal.commentIndex(req.ReplyTo) < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCommentNotFound, req.ReplyTo)
+	}
+
+	side := req.Side
+	if req.Line > 0 && side == "" {
+		side = "new"
+	}
+	comment := ReviewComment{
+		ID:        fmt.Sprintf("comment_%d_%d", time.Now().Unix(), commentSeq.Add(1)),
+		Author:    req.Author,
+		Body:      req.Body,
+		File:      req.File,
+		Line:      req.Line,
+		Side:      side,
+		ReplyTo:   req.ReplyTo,
+		CreatedAt: time.Now(),
+	}
+	proposal.Comments = append(proposal.Comments, comment)
+	proposal.UpdatedAt = comment.CreatedAt
+
+	return &comment, nil
+}
+
+// ResolveComment marks a comment thread as resolved or reopens it
+func (w *Watchdog) ResolveComment(id, commentID string, resolved bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	proposal, err := w.proposalLocked(id)
+	if err != nil {
+		return err
+	}
+	i := proposal.commentIndex(commentID)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrCommentNotFound, commentID)
+	}
+
+	proposal.Comments[i].Resolved = resolved
+	proposal.UpdatedAt = time.Now()
+	return nil
+}
+
+// MarkApplied records that an approved proposal was merged by hand, e.g.
+// after its checks passed with automatic merging turned off
+func (w *Watchdog) MarkApplied(id string, req models.ProposalReviewRequest) (*Proposal, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	proposal, err := w.proposalLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != ProposalApproved {
+		return nil, fmt.Errorf("%w: proposal %s is %s, not approved", ErrProposalConflict, id, proposal.Status)
+	}
+	if execution := proposal.Execution; execution != nil && execution.Status != ExecutionPassed {
+		return nil, fmt.Errorf("%w: proposal %s execution is %s", ErrProposalConflict, id, execution.Status)
+	}
+
+	w.transitionLocked(proposal, ProposalApplied, req.Reviewer, req.Comment)
+	proposalEvents.Inc(ProposalApplied)
+	w.noteEvolutionLocked(proposal)
+	return proposal.clone(), nil
+}
+
+// VerifyProposal records that an applied proposal works as intended
+func (w *Watchdog) VerifyProposal(id string, req models.ProposalReviewRequest) (*Proposal, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	proposal, err := w.proposalLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != ProposalApplied {
+		return nil, fmt.Errorf("%w: proposal %s is %s, not applied", ErrProposalConflict, id, proposal.Status)
+	}
+
+	w.transitionLocked(proposal, ProposalVerified, req.Reviewer, req.Comment)
+	proposalEvents.Inc(ProposalVerified)
+	return proposal.clone(), nil
+}
+
+// changesFile reports whether a proposal's diff touches path
+func (p *Proposal) changesFile(path string) bool {
+	for _, diff := range p.Diffs {
+		if diff.Path == path || diff.OldPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// commentIndex returns the position of the comment with id, or -1
+func (p *Proposal) commentIndex(id string) int {
+	for i, comment := range p.Comments {
+		if comment.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// approvedBy reports whether reviewer already approved the proposal
+func (p *Proposal) approvedBy(reviewer string) bool {
+	for _, approval := range p.Approvals {
+		if approval.Reviewer == reviewer {
+			return true
+		}
+	}
+	return false
+}
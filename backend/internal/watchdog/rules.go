@@ -0,0 +1,448 @@
+package watchdog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxRuleMatches caps how many lines of one file a rule reports
+const maxRuleMatches = 20
+
+// ruleIgnoreMarker on a line, or the line above it, suppresses rules there:
+// "watchdog:ignore" suppresses every rule, "watchdog:ignore a,b" only rules a and b
+var ruleIgnoreMarker = regexp.MustCompile(`watchdog:ignore(?:[ \t]+([\w.,-]+))?`)
+
+// Rule is a user-defined check: a regular expression matched line by line
+// against the files in its scope
+type Rule struct {
+	ID       string   `yaml:"id"`
+	Pattern  string   `yaml:"pattern"`
+	Scope    []string `yaml:"scope"`    // globs a file must match; empty matches every file
+	Suppress []string `yaml:"suppress"` // globs of files the rule doesn't apply to
+	Severity string   `yaml:"severity"` // info, warning (default) or error
+	Type     string   `yaml:"type"`     // alert type, pattern by default
+	Title    string   `yaml:"title"`    // defaults to the ID
+	Message  string   `yaml:"message"`  // template over .Rule, .File, .Line and .Match
+	Enabled  *bool    `yaml:"enabled"`  // defaults to true
+
+	matcher    *regexp.Regexp
+	scopes     []*regexp.Regexp
+	suppressed []*regexp.Regexp
+	template   *template.Template
+}
+
+// rulesFile is the format of watchdog-rules.yaml
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// RuleMatch is a line a rule matched
+type RuleMatch struct {
+	Rule     string
+	Type     string
+	Severity string
+	Title    string
+	Message  string
+	File     string
+	Line     int
+	Match    string
+}
+
+// RulesEngine evaluates the rules in a YAML file, reloading them when the
+// file changes. A file that fails to load leaves the previous rules in place.
+type RulesEngine struct {
+	path string
+
+	mu       sync.RWMutex
+	rules    []*Rule
+	modTime  time.Time
+	size     int64
+	loadedAt time.Time
+	loadErr  error
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRulesEngineFromEnv loads WATCHDOG_RULES and checks it for changes every
+// WATCHDOG_RULES_RELOAD_MS. A file that fails to load is still watched, so
+// fixing it takes effect without a restart.
+func NewRulesEngineFromEnv() *RulesEngine {
+	engine := newRulesEngine(getEnv("WATCHDOG_RULES", "../config/watchdog-rules.yaml"))
+	if err := engine.Reload(); err != nil {
+		slog.Warn("watchdog rules not loaded", "error", err)
+	}
+	engine.StartReloading(time.Duration(getEnvInt("WATCHDOG_RULES_RELOAD_MS", 2000)) * time.Millisecond)
+	return engine
+}
+
+// NewRulesEngine loads the rules at path. A missing file is not an error;
+// the engine has no rules until it's created.
+func NewRulesEngine(path string) (*RulesEngine, error) {
+	engine := newRulesEngine(path)
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+func newRulesEngine(path string) *RulesEngine {
+	return &RulesEngine{
+		path:   path,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Reload reads and compiles the rules file, replacing the current rules
+// only if every rule is valid
+func (e *RulesEngine) Reload() error {
+	info, err := os.Stat(e.path)
+	if os.IsNotExist(err) {
+		e.mu.Lock()
+		e.rules, e.modTime, e.size, e.loadErr = nil, time.Time{}, 0, nil
+		e.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return e.failLoad(nil, fmt.Errorf("failed to read watchdog rules: %w", err))
+	}
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return e.failLoad(info, fmt.Errorf("failed to read watchdog rules: %w", err))
+	}
+	rules, err := parseRules(data)
+	if err != nil {
+		return e.failLoad(info, fmt.Errorf("failed to load watchdog rules from %s: %w", e.path, err))
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.modTime, e.size = info.ModTime(), info.Size()
+	e.loadedAt = time.Now()
+	e.loadErr = nil
+	e.mu.Unlock()
+
+	slog.Info("loaded watchdog rules", "rules", len(rules), "path", e.path)
+	return nil
+}
+
+// failLoad records a failed load; the previous rules stay active. The file
+// isn't retried until it changes again.
+func (e *RulesEngine) failLoad(info os.FileInfo, err error) error {
+	e.mu.Lock()
+	e.loadErr = err
+	if info != nil {
+		e.modTime, e.size = info.ModTime(), info.Size()
+	}
+	e.mu.Unlock()
+	return err
+}
+
+// parseRules decodes and compiles a rules file, rejecting unknown fields so
+// typos don't silently disable a setting
+func parseRules(data []byte) ([]*Rule, error) {
+	var file rulesFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	rules := make([]*Rule, 0, len(file.Rules))
+	ids := make(map[string]bool)
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		if rule.ID == "" {
+			return nil, fmt.Errorf("rule %d has no id", i+1)
+		}
+		if ids[rule.ID] {
+			return nil, fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// compile validates a rule and fills in its defaults
+func (r *Rule) compile() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	matcher, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	r.matcher = matcher
+
+	switch r.Severity {
+	case "":
+		r.Severity = AlertSeverityWarning
+	case AlertSeverityInfo, AlertSeverityWarning, AlertSeverityError:
+	default:
+		return fmt.Errorf("unknown severity %q", r.Severity)
+	}
+	if r.Type == "" {
+		r.Type = AlertTypePattern
+	}
+	if r.Title == "" {
+		r.Title = r.ID
+	}
+	if r.Message == "" {
+		r.Message = "{{.Rule}} matched in {{.File}}"
+	}
+	tmpl, err := template.New(r.ID).Option("missingkey=error").Parse(r.Message)
+	if err == nil {
+		// Catches fields the template names that don't exist
+		err = tmpl.Execute(io.Discard, templateData(RuleMatch{}))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid message template: %w", err)
+	}
+	r.template = tmpl
+
+	for _, glob := range r.Scope {
+		re, err := globRegexp(glob)
+		if err != nil {
+			return fmt.Errorf("invalid scope %q: %w", glob, err)
+		}
+		r.scopes = append(r.scopes, re)
+	}
+	for _, glob := range r.Suppress {
+		re, err := globRegexp(glob)
+		if err != nil {
+			return fmt.Errorf("invalid suppress glob %q: %w", glob, err)
+		}
+		r.suppressed = append(r.suppressed, re)
+	}
+
+	return nil
+}
+
+// StartReloading checks the rules file for changes every interval until Stop
+func (e *RulesEngine) StartReloading(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.stopCh:
+				return
+			case <-ticker.C:
+				if !e.changed() {
+					continue
+				}
+				if err := e.Reload(); err != nil {
+					slog.Warn("keeping previous watchdog rules", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops reloading
+func (e *RulesEngine) Stop() {
+	e.stopOnce.Do(func() { close(e.stopCh) })
+}
+
+// changed reports whether the rules file differs from the last load attempt
+func (e *RulesEngine) changed() bool {
+	info, err := os.Stat(e.path)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if err != nil {
+		// Deleted since the last load
+		return !e.modTime.IsZero()
+	}
+	return !info.ModTime().Equal(e.modTime) || info.Size() != e.size
+}
+
+// Status reports what the engine has loaded
+func (e *RulesEngine) Status() map[string]interface{} {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	enabled := 0
+	for _, rule := range e.rules {
+		if rule.enabled() {
+			enabled++
+		}
+	}
+
+	status := map[string]interface{}{
+		"path":    e.path,
+		"rules":   len(e.rules),
+		"enabled": enabled,
+	}
+	if !e.loadedAt.IsZero() {
+		status["loaded_at"] = e.loadedAt
+	}
+	if e.loadErr != nil {
+		status["error"] = e.loadErr.Error()
+	}
+	return status
+}
+
+// Evaluate runs every enabled rule whose scope covers filename
+func (e *RulesEngine) Evaluate(code, filename string) []RuleMatch {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	matches := make([]RuleMatch, 0)
+	if len(rules) == 0 {
+		return matches
+	}
+
+	file := filepath.ToSlash(filename)
+	lines := strings.Split(code, "\n")
+
+	for _, rule := range rules {
+		if !rule.enabled() || !rule.applies(file) {
+			continue
+		}
+
+		count := 0
+		for i, line := range lines {
+			loc := rule.matcher.FindStringIndex(line)
+			if loc == nil || inlineSuppressed(lines, i, rule.ID) {
+				continue
+			}
+
+			match := RuleMatch{
+				Rule:     rule.ID,
+				Type:     rule.Type,
+				Severity: rule.Severity,
+				Title:    rule.Title,
+				File:     filename,
+				Line:     i + 1,
+				Match:    line[loc[0]:loc[1]],
+			}
+			match.Message = rule.render(match)
+			matches = append(matches, match)
+
+			if count++; count >= maxRuleMatches {
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+func (r *Rule) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// applies reports whether file is in the rule's scope and not suppressed
+func (r *Rule) applies(file string) bool {
+	for _, re := range r.suppressed {
+		if re.MatchString(file) {
+			return false
+		}
+	}
+	if len(r.scopes) == 0 {
+		return true
+	}
+	for _, re := range r.scopes {
+		if re.MatchString(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// render fills in the rule's message template
+func (r *Rule) render(match RuleMatch) string {
+	var message strings.Builder
+	if err := r.template.Execute(&message, templateData(match)); err != nil {
+		return fmt.Sprintf("%s matched in %s", match.Rule, match.File)
+	}
+	return message.String()
+}
+
+// templateData is what message templates can refer to
+func templateData(match RuleMatch) map[string]interface{} {
+	return map[string]interface{}{
+		"Rule":  match.Rule,
+		"File":  match.File,
+		"Line":  match.Line,
+		"Match": match.Match,
+	}
+}
+
+// inlineSuppressed reports whether an ignore marker on line i, or on the
+// line above it, covers the rule
+func inlineSuppressed(lines []string, i int, id string) bool {
+	for _, line := range lines[max(i-1, 0) : i+1] {
+		marker := ruleIgnoreMarker.FindStringSubmatch(line)
+		if marker == nil {
+			continue
+		}
+		if marker[1] == "" {
+			return true
+		}
+		for _, ignored := range strings.Split(marker[1], ",") {
+			if ignored == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globRegexp compiles a glob over slash-separated paths: '*' and '?' stay
+// within a path element and '**' spans elements. Globs without a '/' match
+// the file name in any directory.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		expr.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					expr.WriteString("(?:.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,390 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+// ErrInvalidScan is returned for malformed scan requests
+var ErrInvalidScan = errors.New("invalid scan request")
+
+// ScanConfig configures on-demand scans
+type ScanConfig struct {
+	Workspace    string
+	Ignore       []string // names of files and directories skipped when a path or range is scanned
+	MaxFileBytes int64
+	MaxFiles     int           // scans covering more files are refused
+	Timeout      time.Duration // the default, and the most a request may ask for
+}
+
+// DefaultScanConfig scans the working directory for up to a minute
+func DefaultScanConfig() ScanConfig {
+	return ScanConfig{
+		Workspace:    ".",
+		Ignore:       splitList(defaultIgnore),
+		MaxFileBytes: 512 * 1024,
+		MaxFiles:     1000,
+		Timeout:      time.Minute,
+	}
+}
+
+// ScanConfigFromEnv reads WORKSPACE_ROOT, WATCHDOG_IGNORE,
+// WATCHDOG_MAX_FILE_KB, WATCHDOG_SCAN_MAX_FILES and WATCHDOG_SCAN_TIMEOUT_SECONDS
+func ScanConfigFromEnv() ScanConfig {
+	return ScanConfig{
+		Workspace:    getEnv("WORKSPACE_ROOT", "."),
+		Ignore:       splitList(getEnv("WATCHDOG_IGNORE", defaultIgnore)),
+		MaxFileBytes: int64(getEnvInt("WATCHDOG_MAX_FILE_KB", 512)) * 1024,
+		MaxFiles:     getEnvInt("WATCHDOG_SCAN_MAX_FILES", 1000),
+		Timeout:      time.Duration(getEnvInt("WATCHDOG_SCAN_TIMEOUT_SECONDS", 60)) * time.Second,
+	}
+}
+
+// ScanResult is what an on-demand scan found
+type ScanResult struct {
+	Files    []string          `json:"files"`             // analyzed, relative to the workspace
+	Skipped  map[string]string `json:"skipped,omitempty"` // file -> why it wasn't analyzed
+	Findings []Alert           `json:"findings"`
+	Counts   map[string]int    `json:"counts"`           // findings by severity
+	TimedOut bool              `json:"timed_out"`        // the files after the timeout weren't analyzed
+	Failed   map[string]string `json:"failed,omitempty"` // analyzer -> why it failed
+	Duration string            `json:"duration"`
+}
+
+// scanTarget is a file to analyze and where its content comes from
+type scanTarget struct {
+	rel      string
+	revision string // "" reads the working tree
+	base     string // revision the file is compared with; "" compares with nothing
+}
+
+// SetScanConfig configures on-demand scans
+func (w *Watchdog) SetScanConfig(config ScanConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.scan = config
+}
+
+// Scan runs the analyzers over a path, a list of files or the files changed
+// in a git revision range and returns the findings, without raising them as
+// alerts unless asked to. Files left when the timeout expires are not
+// analyzed and the result is marked as timed out.
+func (w *Watchdog) Scan(ctx context.Context, req models.WatchdogScanRequest) (*ScanResult, error) {
+	w.mu.RLock()
+	config := w.scan
+	w.mu.RUnlock()
+
+	if req.Path == "" && len(req.Files) == 0 && req.Range == "" {
+		return nil, fmt.Errorf("%w: path, files or range is required", ErrInvalidScan)
+	}
+	if _, ok := severityRank[req.Severity]; req.Severity != "" && !ok {
+		return nil, fmt.Errorf("%w: severity must be info, warning or error", ErrInvalidScan)
+	}
+	timeout := config.Timeout
+	if requested := time.Duration(req.TimeoutSeconds) * time.Second; requested > 0 && requested < timeout {
+		timeout = requested
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	targets, err := scanTargets(ctx, config, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) > config.MaxFiles {
+		return nil, fmt.Errorf("%w: %d files to scan, the limit is %d", ErrInvalidScan, len(targets), config.MaxFiles)
+	}
+
+	result := &ScanResult{
+		Files:    make([]string, 0, len(targets)),
+		Skipped:  make(map[string]string),
+		Findings: make([]Alert, 0),
+		Counts:   make(map[string]int),
+	}
+	generator := NewAlertGenerator(w)
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			result.TimedOut = true
+			break
+		}
+
+		content, err := readScanTarget(ctx, config, target.rel, target.revision)
+		if err != nil {
+			result.Skipped[target.rel] = err.Error()
+			continue
+		}
+		previous := content
+		if target.base != "" {
+			// A file added in the range has nothing to compare with
+			previous, _ = readScanTarget(ctx, config, target.rel, target.base)
+		}
+
+		result.Files = append(result.Files, target.rel)
+		for _, alert := range generator.MonitorFileChanges(target.rel, previous, content) {
+			if severityRank[alert.Severity] >= severityRank[req.Severity] {
+				result.Findings = append(result.Findings, alert)
+				result.Counts[alert.Severity]++
+			}
+		}
+	}
+
+	// Registered analyzers read files from disk, so they only check the
+	// working tree
+	if req.Range == "" && !result.TimedOut {
+		alerts, failed := w.runAnalyzers(ctx, config.Workspace, result.Files)
+		for _, alert := range alerts {
+			if severityRank[alert.Severity] >= severityRank[req.Severity] {
+				result.Findings = append(result.Findings, alert)
+				result.Counts[alert.Severity]++
+			}
+		}
+		if len(failed) > 0 {
+			result.Failed = failed
+		}
+	}
+	result.Duration = time.Since(start).String()
+
+	w.events.Publish(EventScanFinished, map[string]interface{}{
+		"path":      req.Path,
+		"range":     req.Range,
+		"files":     len(result.Files),
+		"findings":  len(result.Findings),
+		"counts":    result.Counts,
+		"failed":    result.Failed,
+		"timed_out": result.TimedOut,
+		"duration":  result.Duration,
+	})
+
+	if req.Record {
+		w.recordAlerts(result.Findings...)
+	}
+
+	return result, nil
+}
+
+// scanTargets resolves a request to the files it covers, in order and
+// without duplicates
+func scanTargets(ctx context.Context, config ScanConfig, req models.WatchdogScanRequest) ([]scanTarget, error) {
+	targets := make([]scanTarget, 0)
+	seen := make(map[string]bool)
+	add := func(target scanTarget) {
+		if !seen[target.rel] {
+			seen[target.rel] = true
+			targets = append(targets, target)
+		}
+	}
+
+	if req.Path != "" {
+		rel, abs, err := scanPath(config.Workspace, req.Path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s doesn't exist", ErrInvalidScan, req.Path)
+		}
+		if !info.IsDir() {
+			add(scanTarget{rel: rel})
+		} else {
+			err := filepath.WalkDir(abs, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if path != abs && matchAny(config.Ignore, entry.Name()) {
+					if entry.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if entry.Type().IsRegular() {
+					fileRel, _, err := scanPath(config.Workspace, path)
+					if err == nil {
+						add(scanTarget{rel: fileRel})
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", req.Path, err)
+			}
+		}
+	}
+
+	for _, file := range req.Files {
+		rel, _, err := scanPath(config.Workspace, file)
+		if err != nil {
+			return nil, err
+		}
+		add(scanTarget{rel: rel})
+	}
+
+	if req.Range != "" {
+		changed, err := rangeTargets(ctx, config.Workspace, req.Range)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range changed {
+			if !ignoredPath(config.Ignore, target.rel) {
+				add(target)
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// rangeTargets lists the files changed in a revision range. "a..b" reads
+// the files at b and compares them with a, "a...b" compares with the merge
+// base, and a single revision compares the working tree with it. Deleted
+// files are left out. Each revision is resolved to a commit first, so only
+// commit IDs reach git's other commands.
+func rangeTargets(ctx context.Context, workspace, revisions string) ([]scanTarget, error) {
+	if strings.ContainsAny(revisions, " \t\n:") {
+		return nil, fmt.Errorf("%w: range %q isn't a revision range", ErrInvalidScan, revisions)
+	}
+
+	var base, head string
+	var err error
+	switch {
+	case strings.Contains(revisions, "..."):
+		from, to, _ := strings.Cut(revisions, "...")
+		if from, err = resolveRevision(ctx, workspace, from); err != nil {
+			return nil, err
+		}
+		if head, err = resolveRevision(ctx, workspace, to); err != nil {
+			return nil, err
+		}
+		if base, err = git(ctx, workspace, "merge-base", from, head); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidScan, err)
+		}
+	case strings.Contains(revisions, ".."):
+		from, to, _ := strings.Cut(revisions, "..")
+		if base, err = resolveRevision(ctx, workspace, from); err != nil {
+			return nil, err
+		}
+		if head, err = resolveRevision(ctx, workspace, to); err != nil {
+			return nil, err
+		}
+	default:
+		if base, err = resolveRevision(ctx, workspace, revisions); err != nil {
+			return nil, err
+		}
+	}
+
+	args := []string{"diff", "--name-only", "--relative", "--diff-filter=d", base}
+	if head != "" {
+		args = append(args, head)
+	}
+	output, err := git(ctx, workspace, append(args, "--")...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidScan, err)
+	}
+
+	targets := make([]scanTarget, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			targets = append(targets, scanTarget{rel: line, revision: head, base: base})
+		}
+	}
+	return targets, nil
+}
+
+// ignoredPath reports whether any element of a slash-separated path is ignored
+func ignoredPath(ignore []string, rel string) bool {
+	for _, element := range strings.Split(rel, "/") {
+		if matchAny(ignore, element) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRevision returns the ID of the commit a revision names, HEAD when
+// it's empty. Revisions starting with "-" are refused so none can be taken
+// for an option.
+func resolveRevision(ctx context.Context, workspace, revision string) (string, error) {
+	if revision == "" {
+		revision = "HEAD"
+	}
+	if strings.HasPrefix(revision, "-") {
+		return "", fmt.Errorf("%w: %q isn't a revision", ErrInvalidScan, revision)
+	}
+	id, err := git(ctx, workspace, "rev-parse", "--verify", "--quiet", "--end-of-options", revision+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: unknown revision %q", ErrInvalidScan, revision)
+	}
+	return id, nil
+}
+
+// scanPath resolves a path given relative to the workspace, or absolute
+// inside it, refusing paths outside the workspace
+func scanPath(workspace, path string) (string, string, error) {
+	root, err := filepath.Abs(workspace)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve workspace: %w", err)
+	}
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(root, path)
+	}
+	rel, err := filepath.Rel(root, filepath.Clean(abs))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("%w: %s is outside the workspace", ErrInvalidScan, path)
+	}
+	return filepath.ToSlash(rel), filepath.Join(root, rel), nil
+}
+
+// readScanTarget reads a workspace file from the working tree or a
+// revision, refusing binary and oversized files
+func readScanTarget(ctx context.Context, config ScanConfig, rel, revision string) (string, error) {
+	var data []byte
+	if revision == "" {
+		_, abs, err := scanPath(config.Workspace, rel)
+		if err != nil {
+			return "", err
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		if !info.Mode().IsRegular() {
+			return "", fmt.Errorf("not a regular file")
+		}
+		if info.Size() > config.MaxFileBytes {
+			return "", fmt.Errorf("larger than %d bytes", config.MaxFileBytes)
+		}
+		if data, err = os.ReadFile(abs); err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+	} else {
+		// "./" makes the path relative to the workspace rather than the repository root
+		cmd := exec.CommandContext(ctx, "git", "show", revision+":./"+rel)
+		cmd.Dir = config.Workspace
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s at %s: %w", rel, revision, err)
+		}
+		if int64(len(output)) > config.MaxFileBytes {
+			return "", fmt.Errorf("larger than %d bytes", config.MaxFileBytes)
+		}
+		data = output
+	}
+
+	if bytes.IndexByte(data, 0) != -1 {
+		return "", fmt.Errorf("binary file")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,353 @@
+package watchdog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretAllowMarker on a line stops it from being reported
+const secretAllowMarker = "watchdog:allow-secret"
+
+// secretRule is a known credential format
+type secretRule struct {
+	id          string
+	description string
+	pattern     *regexp.Regexp // the secret is the first group when there is one
+}
+
+// providerSecretRules match credentials by their issuer's format, whatever
+// they're assigned to
+var providerSecretRules = []secretRule{
+	{"aws-access-key-id", "AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-access-key", "AWS secret access key", regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}?['"]([A-Za-z0-9/+=]{40})['"]`)},
+	{"github-token", "GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{"slack-token", "Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"slack-webhook", "Slack webhook URL", regexp.MustCompile(`https://hooks\.slack\.com/services/T[A-Z0-9]+/B[A-Z0-9]+/[A-Za-z0-9]+`)},
+	{"private-key", "Private key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY-----`)},
+}
+
+var (
+	// keywordQuotedPattern matches a quoted value assigned to a secret-like name
+	keywordQuotedPattern = regexp.MustCompile("(?i)([\\w.-]*(?:password|passwd|secret|token|api_?key|private_?key|credential)[\\w.-]*)[\"']?\\s*(?::=|=|:)\\s*[\"'`]([^\"'`\\s]+)[\"'`]")
+	// keywordBarePattern also accepts unquoted values, for config files
+	keywordBarePattern = regexp.MustCompile(`(?i)([\w.-]*(?:password|passwd|secret|token|api_?key|private_?key|credential)[\w.-]*)["']?\s*(?:=|:)\s*["']?([^"'\s#]+)`)
+	// quotedStringPattern matches long quoted strings of token characters
+	quotedStringPattern = regexp.MustCompile("[\"'`]([A-Za-z0-9+/=_-]{20,})[\"'`]")
+)
+
+// secretPlaceholders mark values that stand in for a secret rather than being one
+var secretPlaceholders = []string{"example", "changeme", "change_me", "placeholder", "password", "your_", "your-", "xxxx", "dummy", "redacted", "${", "{{", "<"}
+
+// configFileExtensions are files whose values are usually unquoted
+var configFileExtensions = map[string]bool{".env": true, ".ini": true, ".properties": true, ".toml": true, ".yaml": true, ".yml": true, ".conf": true, ".cfg": true}
+
+// SecretScannerConfig tunes secret detection
+type SecretScannerConfig struct {
+	Allowlist      []*regexp.Regexp // values matching any pattern are never reported
+	AllowPaths     []string         // glob patterns for files that aren't scanned
+	BaselinePath   string           // where accepted findings are kept; empty keeps them in memory
+	KeywordEntropy float64          // minimum entropy of a value assigned to a secret-like name
+	GenericEntropy float64          // minimum entropy of any other long quoted string
+}
+
+// DefaultSecretScannerConfig skips example, test and lock files (whose
+// integrity hashes look random) and uses entropy thresholds that pass
+// ordinary words but catch random tokens
+func DefaultSecretScannerConfig() SecretScannerConfig {
+	return SecretScannerConfig{
+		AllowPaths:     []string{"*.example", "*.sample", "*_test.go", "go.sum", "*.lock", "package-lock.json", "pnpm-lock.yaml"},
+		KeywordEntropy: 2.5,
+		GenericEntropy: 4.5,
+	}
+}
+
+// SecretScannerConfigFromEnv reads WATCHDOG_SECRET_ALLOWLIST (comma-separated
+// regular expressions), WATCHDOG_SECRET_ALLOW_PATHS, WATCHDOG_SECRET_BASELINE
+// and WATCHDOG_SECRET_ENTROPY (the generic threshold)
+func SecretScannerConfigFromEnv() (SecretScannerConfig, error) {
+	config := DefaultSecretScannerConfig()
+	config.BaselinePath = getEnv("WATCHDOG_SECRET_BASELINE", "./data/watchdog-secrets-baseline.json")
+
+	for _, expr := range splitList(getEnv("WATCHDOG_SECRET_ALLOWLIST", "")) {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return config, fmt.Errorf("invalid secret allowlist pattern %q: %w", expr, err)
+		}
+		config.Allowlist = append(config.Allowlist, pattern)
+	}
+
+	if paths := splitList(getEnv("WATCHDOG_SECRET_ALLOW_PATHS", "")); len(paths) > 0 {
+		config.AllowPaths = paths
+	}
+
+	if value := getEnv("WATCHDOG_SECRET_ENTROPY", ""); value != "" {
+		entropy, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid WATCHDOG_SECRET_ENTROPY %q: %w", value, err)
+		}
+		config.GenericEntropy = entropy
+	}
+
+	return config, nil
+}
+
+// SecretFinding is a suspected secret. The secret itself is only kept
+// redacted; the fingerprint identifies it in the baseline.
+type SecretFinding struct {
+	Rule        string
+	Description string
+	File        string
+	Line        int
+	Redacted    string
+	Fingerprint string
+}
+
+// BaselineEntry is an accepted finding that is no longer reported
+type BaselineEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Rule        string    `json:"rule"`
+	File        string    `json:"file"`
+	AcceptedAt  time.Time `json:"accepted_at"`
+}
+
+// secretBaseline is the baseline file's format
+type secretBaseline struct {
+	Findings []BaselineEntry `json:"findings"`
+}
+
+// SecretScanner finds credentials in source text
+type SecretScanner struct {
+	config   SecretScannerConfig
+	mu       sync.Mutex
+	baseline map[string]BaselineEntry
+}
+
+// NewSecretScanner creates a scanner, loading the baseline if it exists
+func NewSecretScanner(config SecretScannerConfig) (*SecretScanner, error) {
+	s := &SecretScanner{
+		config:   config,
+		baseline: make(map[string]BaselineEntry),
+	}
+	if config.BaselinePath == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(config.BaselinePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret baseline: %w", err)
+	}
+
+	var baseline secretBaseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse secret baseline: %w", err)
+	}
+	for _, entry := range baseline.Findings {
+		s.baseline[entry.Fingerprint] = entry
+	}
+
+	return s, nil
+}
+
+// Scan returns the secrets in code that aren't allowlisted or baselined
+func (s *SecretScanner) Scan(code, filename string) []SecretFinding {
+	findings := make([]SecretFinding, 0)
+	if s.allowedPath(filename) {
+		return findings
+	}
+
+	config := configFileExtensions[strings.ToLower(filepath.Ext(filename))] || strings.HasPrefix(path.Base(filepath.ToSlash(filename)), ".env")
+
+	for i, line := range strings.Split(code, "\n") {
+		if strings.Contains(line, secretAllowMarker) {
+			continue
+		}
+
+		// A value is reported once, by the most specific rule that matches it
+		seen := make(map[string]bool)
+		report := func(rule, description, value string) {
+			if seen[value] || s.allowedValue(value) {
+				return
+			}
+			seen[value] = true
+
+			finding := SecretFinding{
+				Rule:        rule,
+				Description: description,
+				File:        filename,
+				Line:        i + 1,
+				Redacted:    redactSecret(value),
+				Fingerprint: secretFingerprint(rule, filename, value),
+			}
+			if !s.baselined(finding.Fingerprint) {
+				findings = append(findings, finding)
+			}
+		}
+
+		for _, rule := range providerSecretRules {
+			for _, match := range rule.pattern.FindAllStringSubmatch(line, -1) {
+				report(rule.id, rule.description, match[len(match)-1])
+			}
+		}
+
+		keywordPattern := keywordQuotedPattern
+		if config {
+			keywordPattern = keywordBarePattern
+		}
+		for _, match := range keywordPattern.FindAllStringSubmatch(line, -1) {
+			name, value := match[1], match[2]
+			if len(value) >= 8 && !isSecretPlaceholder(value) && shannonEntropy(value) >= s.config.KeywordEntropy {
+				report("keyword-entropy", fmt.Sprintf("High-entropy value assigned to %s", name), value)
+			}
+		}
+
+		for _, match := range quotedStringPattern.FindAllStringSubmatch(line, -1) {
+			if value := match[1]; shannonEntropy(value) >= s.config.GenericEntropy {
+				report("generic-entropy", "High-entropy string", value)
+			}
+		}
+	}
+
+	return findings
+}
+
+// Accept adds a finding to the baseline and saves it
+func (s *SecretScanner) Accept(fingerprint, rule, file string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.baseline[fingerprint]; ok {
+		return nil
+	}
+	s.baseline[fingerprint] = BaselineEntry{
+		Fingerprint: fingerprint,
+		Rule:        rule,
+		File:        file,
+		AcceptedAt:  time.Now(),
+	}
+
+	return s.saveBaseline()
+}
+
+// saveBaseline writes the baseline through a temporary file so a crash
+// can't leave it half written; callers must hold s.mu
+func (s *SecretScanner) saveBaseline() error {
+	if s.config.BaselinePath == "" {
+		return nil
+	}
+
+	baseline := secretBaseline{Findings: make([]BaselineEntry, 0, len(s.baseline))}
+	for _, entry := range s.baseline {
+		baseline.Findings = append(baseline.Findings, entry)
+	}
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secret baseline: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.config.BaselinePath), 0755); err != nil {
+		return fmt.Errorf("failed to create secret baseline directory: %w", err)
+	}
+	tmp := s.config.BaselinePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write secret baseline: %w", err)
+	}
+	if err := os.Rename(tmp, s.config.BaselinePath); err != nil {
+		return fmt.Errorf("failed to write secret baseline: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SecretScanner) baselined(fingerprint string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.baseline[fingerprint]
+	return ok
+}
+
+func (s *SecretScanner) allowedPath(filename string) bool {
+	slashed := filepath.ToSlash(filename)
+	return matchAny(s.config.AllowPaths, slashed) || matchAny(s.config.AllowPaths, path.Base(slashed))
+}
+
+func (s *SecretScanner) allowedValue(value string) bool {
+	for _, pattern := range s.config.Allowlist {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// shannonEntropy returns the bits of entropy per character of s
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	entropy := 0.0
+	length := float64(len([]rune(s)))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func isSecretPlaceholder(value string) bool {
+	lower := strings.ToLower(value)
+	if strings.HasPrefix(lower, "$") {
+		return true
+	}
+	for _, placeholder := range secretPlaceholders {
+		if strings.Contains(lower, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecret keeps only enough of a secret to recognize it
+func redactSecret(value string) string {
+	if len(value) <= 8 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:4] + strings.Repeat("*", len(value)-4)
+}
+
+// secretFingerprint identifies a finding across scans without storing the secret
+func secretFingerprint(rule, file, value string) string {
+	sum := sha256.Sum256([]byte(rule + "\x00" + filepath.ToSlash(file) + "\x00" + value))
+	return hex.EncodeToString(sum[:16])
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,327 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+)
+
+// Alert states. An open alert waits for someone to acknowledge it before
+// its SLA deadline; acknowledging takes ownership, resolving closes it
+// until it reappears and ignoring closes it for good.
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+	AlertIgnored      = "ignored"
+)
+
+var (
+	// ErrInvalidAlertAction is returned for malformed alert workflow requests
+	ErrInvalidAlertAction = errors.New("invalid alert action")
+	// ErrAlertConflict is returned for state changes an alert's state doesn't allow
+	ErrAlertConflict = errors.New("alert conflict")
+)
+
+// SLAConfig sets how long an open alert may wait for acknowledgement
+type SLAConfig struct {
+	Deadlines map[string]time.Duration // severity -> time to acknowledge; 0 means no deadline
+	Escalate  string                   // open alerts of this severity or above escalate past their deadline
+}
+
+// DefaultSLAConfig gives errors an hour and warnings a day, and escalates errors
+func DefaultSLAConfig() SLAConfig {
+	return SLAConfig{
+		Deadlines: map[string]time.Duration{
+			AlertSeverityError:   time.Hour,
+			AlertSeverityWarning: 24 * time.Hour,
+		},
+		Escalate: AlertSeverityError,
+	}
+}
+
+// SLAConfigFromEnv reads WATCHDOG_SLA_ERROR_MINUTES, WATCHDOG_SLA_WARNING_MINUTES,
+// WATCHDOG_SLA_INFO_MINUTES and WATCHDOG_SLA_ESCALATE_SEVERITY
+func SLAConfigFromEnv() SLAConfig {
+	config := SLAConfig{
+		Deadlines: map[string]time.Duration{
+			AlertSeverityError:   time.Duration(getEnvInt("WATCHDOG_SLA_ERROR_MINUTES", 60)) * time.Minute,
+			AlertSeverityWarning: time.Duration(getEnvInt("WATCHDOG_SLA_WARNING_MINUTES", 1440)) * time.Minute,
+			AlertSeverityInfo:    time.Duration(getEnvInt("WATCHDOG_SLA_INFO_MINUTES", 0)) * time.Minute,
+		},
+		Escalate: getEnv("WATCHDOG_SLA_ESCALATE_SEVERITY", AlertSeverityError),
+	}
+	if _, ok := severityRank[config.Escalate]; !ok {
+		slog.Warn("unknown SLA escalation severity, escalating errors", "severity", config.Escalate)
+		config.Escalate = AlertSeverityError
+	}
+	return config
+}
+
+// deadline returns when an alert of severity opened at opened must be
+// acknowledged, or nil when its severity has no deadline
+func (c SLAConfig) deadline(severity string, opened time.Time) *time.Time {
+	if d := c.Deadlines[severity]; d > 0 {
+		deadline := opened.Add(d)
+		return &deadline
+	}
+	return nil
+}
+
+// SetSLAConfig sets acknowledgement deadlines for alerts raised from now on
+func (w *Watchdog) SetSLAConfig(config SLAConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sla = config
+}
+
+// state returns an alert's state; alerts stored before states existed only
+// have the acknowledged flag, which used to mean resolved
+func (a Alert) state() string {
+	switch {
+	case a.State != "":
+		return a.State
+	case a.Acknowledged:
+		return AlertResolved
+	default:
+		return AlertOpen
+	}
+}
+
+// breached reports whether an open alert is past its deadline at now
+func (a Alert) breached(now time.Time) bool {
+	return a.state() == AlertOpen && a.Deadline != nil && now.After(*a.Deadline)
+}
+
+// openedAt returns when an alert's SLA timer started
+func (a Alert) openedAt() time.Time {
+	if a.OpenedAt.IsZero() {
+		return a.Timestamp
+	}
+	return a.OpenedAt
+}
+
+// openLocked starts an alert's SLA timer; callers must hold w.mu
+func (w *Watchdog) openLocked(alert *Alert, at time.Time) {
+	alert.State = AlertOpen
+	alert.OpenedAt = at
+	alert.Acknowledged = false
+	alert.AcknowledgedBy, alert.Note = "", ""
+	alert.AcknowledgedAt, alert.ClosedAt, alert.EscalatedAt = nil, nil, nil
+	alert.Deadline = w.sla.deadline(alert.Severity, at)
+}
+
+// AcknowledgeAlert takes ownership of an open alert, stopping its SLA
+// timer; the acknowledger becomes its assignee unless it has one.
+// Acknowledged secrets are added to the secret baseline so they aren't
+// raised again.
+func (w *Watchdog) AcknowledgeAlert(id string, req models.AlertActionRequest) (*Alert, error) {
+	alert, err := w.updateAlert(id, func(alert *Alert, now time.Time) error {
+		if state := alert.state(); state != AlertOpen {
+			return fmt.Errorf("%w: alert %s is %s", ErrAlertConflict, id, state)
+		}
+		alert.State = AlertAcknowledged
+		alert.Acknowledged = true
+		alert.AcknowledgedBy = req.Actor
+		alert.AcknowledgedAt = &now
+		alert.Note = req.Note
+		if req.Assignee != "" {
+			alert.Assignee = req.Assignee
+		} else if alert.Assignee == "" {
+			alert.Assignee = req.Actor
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.baselineSecret(alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// AssignAlert hands an alert to someone without acknowledging it
+func (w *Watchdog) AssignAlert(id string, req models.AlertActionRequest) (*Alert, error) {
+	if req.Assignee == "" {
+		return nil, fmt.Errorf("%w: assignee is required", ErrInvalidAlertAction)
+	}
+
+	return w.updateAlert(id, func(alert *Alert, now time.Time) error {
+		alert.Assignee = req.Assignee
+		if req.Note != "" {
+			alert.Note = req.Note
+		}
+		return nil
+	})
+}
+
+// ResolveAlert closes an alert until it reappears
+func (w *Watchdog) ResolveAlert(id string, req models.AlertActionRequest) (*Alert, error) {
+	return w.closeAlert(id, AlertResolved, req)
+}
+
+// IgnoreAlert closes an alert for good; its repeats are counted but not
+// raised. Ignored secrets are added to the secret baseline.
+func (w *Watchdog) IgnoreAlert(id string, req models.AlertActionRequest) (*Alert, error) {
+	alert, err := w.closeAlert(id, AlertIgnored, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.baselineSecret(alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// ReopenAlert opens a closed or acknowledged alert again with a new deadline
+func (w *Watchdog) ReopenAlert(id string, req models.AlertActionRequest) (*Alert, error) {
+	return w.updateAlert(id, func(alert *Alert, now time.Time) error {
+		if alert.state() == AlertOpen {
+			return fmt.Errorf("%w: alert %s is already open", ErrAlertConflict, id)
+		}
+		w.openLocked(alert, now)
+		alert.Note = req.Note
+		alert.Reopened++
+		return nil
+	})
+}
+
+// closeAlert moves an open or acknowledged alert to a closed state
+func (w *Watchdog) closeAlert(id, state string, req models.AlertActionRequest) (*Alert, error) {
+	return w.updateAlert(id, func(alert *Alert, now time.Time) error {
+		if current := alert.state(); current != AlertOpen && current != AlertAcknowledged {
+			return fmt.Errorf("%w: alert %s is already %s", ErrAlertConflict, id, current)
+		}
+		if alert.AcknowledgedAt == nil {
+			alert.AcknowledgedBy = req.Actor
+			alert.AcknowledgedAt = &now
+		}
+		alert.State = state
+		alert.Acknowledged = true
+		alert.ClosedAt = &now
+		if req.Note != "" {
+			alert.Note = req.Note
+		}
+		return nil
+	})
+}
+
+// updateAlert changes an alert under w.mu, persists it and returns a copy
+func (w *Watchdog) updateAlert(id string, update func(*Alert, time.Time) error) (*Alert, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	i := w.alertIndexLocked(id)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrAlertNotFound, id)
+	}
+	if err := update(&w.alerts[i], time.Now()); err != nil {
+		return nil, err
+	}
+	w.persistLocked(w.alerts[i])
+
+	alert := w.alerts[i]
+	w.events.Publish(EventAlertUpdated, alert)
+	return &alert, nil
+}
+
+// baselineSecret accepts the secret a closed alert reported
+func (w *Watchdog) baselineSecret(alert *Alert) error {
+	fingerprint, ok := alert.Context["fingerprint"].(string)
+	if !ok {
+		return nil
+	}
+
+	w.mu.RLock()
+	secrets := w.secrets
+	w.mu.RUnlock()
+
+	rule, _ := alert.Context["rule"].(string)
+	file, _ := alert.Context["file"].(string)
+	if err := secrets.Accept(fingerprint, rule, file); err != nil {
+		return fmt.Errorf("failed to baseline secret: %w", err)
+	}
+	return nil
+}
+
+// checkSLAs escalates open alerts that are past their deadline through the
+// notification sinks, once per time they're opened
+func (w *Watchdog) checkSLAs() {
+	now := time.Now()
+
+	w.mu.Lock()
+	escalated := make([]Alert, 0)
+	for i := range w.alerts {
+		alert := &w.alerts[i]
+		if !alert.breached(now) || alert.EscalatedAt != nil || severityRank[alert.Severity] < severityRank[w.sla.Escalate] {
+			continue
+		}
+		alert.EscalatedAt = &now
+		alert.Escalations++
+		w.persistLocked(*alert)
+		w.events.Publish(EventAlertUpdated, *alert)
+		alertsEscalated.Inc(alert.Severity, alert.Type)
+
+		// A distinct title keeps the escalation clear of the notifier's throttle
+		escalation := *alert
+		escalation.Title = "SLA Breached: " + alert.Title
+		escalation.Message = fmt.Sprintf("Unacknowledged %s since %s (deadline %s): %s",
+			alert.Severity, alert.openedAt().Format(time.RFC3339), alert.Deadline.Format(time.RFC3339), alert.Message)
+		escalated = append(escalated, escalation)
+	}
+	notifier := w.notifier
+	w.mu.Unlock()
+
+	if len(escalated) == 0 {
+		return
+	}
+	slog.Warn("watchdog alerts breached their SLA", "alerts", len(escalated))
+	if notifier != nil {
+		notifier.Notify(escalated...)
+	}
+}
+
+// slaMetricsLocked summarizes alert states and SLA compliance for
+// GetMetrics; callers must hold w.mu
+func (w *Watchdog) slaMetricsLocked(now time.Time) map[string]interface{} {
+	byState := make(map[string]int)
+	breached := make(map[string]int)
+	escalated, unassigned, acknowledged := 0, 0, 0
+	var ackSeconds float64
+	for _, alert := range w.alerts {
+		state := alert.state()
+		byState[state]++
+		if alert.breached(now) {
+			breached[alert.Severity]++
+		}
+		if state == AlertOpen && alert.EscalatedAt != nil {
+			escalated++
+		}
+		if state == AlertOpen && alert.Assignee == "" {
+			unassigned++
+		}
+		if alert.AcknowledgedAt != nil {
+			acknowledged++
+			ackSeconds += alert.AcknowledgedAt.Sub(alert.openedAt()).Seconds()
+		}
+	}
+
+	meanAck := 0.0
+	if acknowledged > 0 {
+		meanAck = ackSeconds / float64(acknowledged)
+	}
+	return map[string]interface{}{
+		"alerts_by_state":              byState,
+		"sla_breached_by_severity":     breached,
+		"escalated_alerts":             escalated,
+		"unassigned_open_alerts":       unassigned,
+		"mean_time_to_acknowledge_sec": meanAck,
+	}
+}
@@ -0,0 +1,390 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// alertBucket holds persisted alerts keyed by ID
+var alertBucket = []byte("alerts")
+
+const (
+	defaultAlertPageLimit = 50
+	maxAlertPageLimit     = 500
+	defaultInfoAlertTTL   = 24 * time.Hour
+)
+
+var (
+	// ErrInvalidAlertQuery is returned for malformed alert filters
+	ErrInvalidAlertQuery = errors.New("invalid alert query")
+	// ErrAlertNotFound is returned for unknown alert IDs
+	ErrAlertNotFound = errors.New("alert not found")
+)
+
+// AlertStoreConfig configures alert persistence
+type AlertStoreConfig struct {
+	Path    string
+	InfoTTL time.Duration // informational alerts not seen for this long are deleted; zero keeps them
+}
+
+// AlertStoreConfigFromEnv reads WATCHDOG_ALERTS_PATH and WATCHDOG_INFO_ALERT_TTL_HOURS
+func AlertStoreConfigFromEnv() AlertStoreConfig {
+	return AlertStoreConfig{
+		Path:    getEnv("WATCHDOG_ALERTS_PATH", "./data/watchdog.db"),
+		InfoTTL: time.Duration(getEnvInt("WATCHDOG_INFO_ALERT_TTL_HOURS", 24)) * time.Hour,
+	}
+}
+
+// AlertPage is one page of alerts matching a query, newest first
+type AlertPage struct {
+	Alerts []Alert `json:"alerts"`
+	Total  int     `json:"total"`
+	Offset int     `json:"offset"`
+	Limit  int     `json:"limit"`
+}
+
+// alertStore persists alerts in a Bolt database
+type alertStore struct {
+	db *bolt.DB
+}
+
+func openAlertStore(path string) (*alertStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create alert store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open alert store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(alertBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create alert bucket: %w", err)
+	}
+
+	return &alertStore{db: db}, nil
+}
+
+// load returns every stored alert, oldest first. Undecodable records are
+// skipped rather than failing startup.
+func (s *alertStore) load() ([]Alert, error) {
+	alerts := make([]Alert, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(alertBucket).ForEach(func(k, v []byte) error {
+			var alert Alert
+			if err := json.Unmarshal(v, &alert); err != nil {
+				slog.Warn("skipping undecodable alert", "alert_id", string(k), "error", err)
+				return nil
+			}
+			alerts = append(alerts, alert)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alerts: %w", err)
+	}
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Timestamp.Before(alerts[j].Timestamp)
+	})
+	return alerts, nil
+}
+
+// put stores or replaces alerts
+func (s *alertStore) put(alerts ...Alert) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(alertBucket)
+		for _, alert := range alerts {
+			data, err := json.Marshal(alert)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(alert.ID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store alerts: %w", err)
+	}
+	return nil
+}
+
+// delete removes alerts by ID
+func (s *alertStore) delete(ids ...string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(alertBucket)
+		for _, id := range ids {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete alerts: %w", err)
+	}
+	return nil
+}
+
+// clear removes every alert
+func (s *alertStore) clear() error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(alertBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(alertBucket)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear alerts: %w", err)
+	}
+	return nil
+}
+
+// OpenAlertStore persists alerts to Bolt from now on, restoring those saved
+// by earlier runs. Alerts raised before the store opened are saved too.
+func (w *Watchdog) OpenAlertStore(config AlertStoreConfig) error {
+	store, err := openAlertStore(config.Path)
+	if err != nil {
+		return err
+	}
+
+	stored, err := store.load()
+	if err != nil {
+		store.db.Close()
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.store != nil {
+		store.db.Close()
+		return fmt.Errorf("alert store already open")
+	}
+
+	if len(w.alerts) > 0 {
+		if err := store.put(w.alerts...); err != nil {
+			store.db.Close()
+			return err
+		}
+	}
+
+	w.store = store
+	w.infoAlertTTL = config.InfoTTL
+	w.alerts = append(stored, w.alerts...)
+	w.expireAlertsLocked(time.Now())
+	w.reindexLocked()
+
+	slog.Info("restored watchdog alerts", "alerts", len(stored), "path", config.Path)
+	return nil
+}
+
+// Close stops the watchdog if it's running, sends pending notifications and
+// closes the reward ledger and alert store
+func (w *Watchdog) Close() error {
+	w.mu.RLock()
+	running := w.running
+	w.mu.RUnlock()
+
+	if running {
+		if err := w.Stop(); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	notifier := w.notifier
+	w.notifier = nil
+	ledger := w.ledger
+	w.mu.Unlock()
+
+	if notifier != nil {
+		notifier.Stop()
+	}
+	if err := ledger.Close(); err != nil {
+		slog.Warn("failed to close reward ledger", "error", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.store == nil {
+		return nil
+	}
+	err := w.store.db.Close()
+	w.store = nil
+	if err != nil {
+		return fmt.Errorf("failed to close alert store: %w", err)
+	}
+	return nil
+}
+
+// addAlertsLocked records the alerts that meet the configured threshold,
+// merging repeats into the alert already raised for the same issue, and
+// persists them. Alerts that are new, reopened or past their cooldown are
+// queued for notification, published and correlated. It returns the alerts as
+// recorded; callers must hold w.mu.
+func (w *Watchdog) addAlertsLocked(alerts ...Alert) []Alert {
+	recorded := make([]Alert, 0, len(alerts))
+	raised := make([]Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		if !w.config.meetsThreshold(alert) {
+			continue
+		}
+		merged, raise := w.mergeLocked(alert)
+		recorded = append(recorded, merged)
+		if raise {
+			raised = append(raised, merged)
+			alertsRaised.Inc(merged.Severity, merged.Type)
+		} else {
+			alertsSuppressed.Inc(merged.Severity, merged.Type)
+		}
+	}
+
+	w.persistLocked(recorded...)
+	if w.notifier != nil {
+		w.notifier.Notify(raised...)
+	}
+	for _, alert := range raised {
+		w.events.Publish(EventAlertCreated, alert)
+	}
+	w.observeLocked(raised...)
+	return recorded
+}
+
+// persistLocked saves alerts when a store is open; a failed write only costs
+// the alerts their survival across restarts. Callers must hold w.mu.
+func (w *Watchdog) persistLocked(alerts ...Alert) {
+	if w.store == nil || len(alerts) == 0 {
+		return
+	}
+	if err := w.store.put(alerts...); err != nil {
+		slog.Warn("failed to store alerts", "error", err)
+	}
+}
+
+// expireAlerts deletes informational alerts not seen within the TTL
+func (w *Watchdog) expireAlerts() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.expireAlertsLocked(time.Now())
+}
+
+// expireAlertsLocked drops expired informational alerts; callers must hold w.mu
+func (w *Watchdog) expireAlertsLocked(now time.Time) {
+	if w.infoAlertTTL <= 0 {
+		return
+	}
+
+	kept := w.alerts[:0]
+	expired := make([]string, 0)
+	for _, alert := range w.alerts {
+		if alert.Severity == AlertSeverityInfo && now.Sub(lastSeen(alert)) > w.infoAlertTTL {
+			expired = append(expired, alert.ID)
+			continue
+		}
+		kept = append(kept, alert)
+	}
+	if len(expired) == 0 {
+		return
+	}
+	w.alerts = kept
+	w.reindexLocked()
+
+	if w.store != nil {
+		if err := w.store.delete(expired...); err != nil {
+			slog.Warn("failed to delete expired alerts", "error", err)
+		}
+	}
+	slog.Info("expired informational watchdog alerts", "alerts", len(expired))
+}
+
+// QueryAlerts returns alerts matching the filters, newest first
+func (w *Watchdog) QueryAlerts(req models.WatchdogAlertQuery) (*AlertPage, error) {
+	var acknowledged *bool
+	if req.Acknowledged != "" {
+		value, err := strconv.ParseBool(req.Acknowledged)
+		if err != nil {
+			return nil, fmt.Errorf("%w: acknowledged must be true or false", ErrInvalidAlertQuery)
+		}
+		acknowledged = &value
+	}
+	since, err := parseAlertTime(req.Since, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseAlertTime(req.Until, "until")
+	if err != nil {
+		return nil, err
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		return nil, fmt.Errorf("%w: until is before since", ErrInvalidAlertQuery)
+	}
+
+	offset, limit := req.Offset, req.Limit
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultAlertPageLimit
+	}
+	if limit > maxAlertPageLimit {
+		limit = maxAlertPageLimit
+	}
+
+	w.mu.RLock()
+	matched := make([]Alert, 0)
+	for i := len(w.alerts) - 1; i >= 0; i-- {
+		alert := w.alerts[i]
+		switch {
+		case req.Type != "" && alert.Type != req.Type:
+		case req.Severity != "" && alert.Severity != req.Severity:
+		case acknowledged != nil && alert.Acknowledged != *acknowledged:
+		case req.State != "" && alert.state() != req.State:
+		case req.Assignee != "" && alert.Assignee != req.Assignee:
+		case !since.IsZero() && alert.Timestamp.Before(since):
+		case !until.IsZero() && alert.Timestamp.After(until):
+		default:
+			matched = append(matched, alert)
+		}
+	}
+	w.mu.RUnlock()
+
+	page := &AlertPage{Alerts: []Alert{}, Total: len(matched), Offset: offset, Limit: limit}
+	if offset < len(matched) {
+		page.Alerts = matched[offset:min(offset+limit, len(matched))]
+	}
+	return page, nil
+}
+
+// parseAlertTime parses an RFC 3339 time filter; empty means unbounded
+func parseAlertTime(value, name string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be an RFC 3339 time", ErrInvalidAlertQuery, name)
+	}
+	return t, nil
+}
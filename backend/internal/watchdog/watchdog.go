@@ -1,48 +1,123 @@
 package watchdog
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/pkg/llm"
 	"agent-workspace/backend/pkg/models"
 )
 
 // Watchdog monitors code and detects patterns
 type Watchdog struct {
-	longTermMem *memory.LongTermMemory
+	config      Config
 	alerts      []Alert
 	proposals   map[string]*Proposal
 	patterns    []Pattern
 	mu          sync.RWMutex
 	running     bool
+	stopCh      chan struct{} // closed by Stop to end monitorLoop
+	watcher     *Watcher
+	secrets     *SecretScanner
+	rules       *RulesEngine
+	notifier    *Notifier
+	pipeline    *Pipeline
+	correlator  *Correlator
+	ledger      *RewardLedger
+	deps        *DependencyScanner
+	drift       *DriftDetector
+	commands    *CommandMonitor
+	commits     *CommitMonitor
+	regressions *RegressionDetector
+	analyzers   []*analyzerEntry
+	events      *EventBus
+	dedup       map[string]string // alert fingerprint -> ID of the alert it was merged into
+	scan        ScanConfig
+	review      ReviewConfig
+	sla         SLAConfig
+
+	stopCommands func() // ends the terminal history subscription; nil until WatchCommands
+
+	store        *alertStore // nil until OpenAlertStore
+	infoAlertTTL time.Duration
 }
 
 // Alert represents a watchdog alert
 type Alert struct {
-	ID          string
-	Type        string // "pattern", "security", "dependency", "concept_drift"
-	Severity    string // "info", "warning", "error"
-	Title       string
-	Message     string
-	Context     map[string]interface{}
-	Timestamp   time.Time
-	Acknowledged bool
+	ID             string                 `json:"id"`
+	Type           string                 `json:"type"`     // "pattern", "security", "dependency", "concept_drift", "command", "commit"
+	Severity       string                 `json:"severity"` // "info", "warning", "error"
+	Title          string                 `json:"title"`
+	Message        string                 `json:"message"`
+	Context        map[string]interface{} `json:"context,omitempty"`
+	Timestamp      time.Time              `json:"timestamp"`
+	Acknowledged   bool                   `json:"acknowledged"` // no longer open: acknowledged, resolved or ignored
+	State          string                 `json:"state"`        // AlertOpen, AlertAcknowledged, AlertResolved or AlertIgnored
+	Assignee       string                 `json:"assignee,omitempty"`
+	Note           string                 `json:"note,omitempty"` // left when acknowledging, resolving or ignoring
+	OpenedAt       time.Time              `json:"opened_at"`      // when the SLA timer last started
+	Deadline       *time.Time             `json:"deadline,omitempty"`
+	EscalatedAt    *time.Time             `json:"escalated_at,omitempty"`
+	Escalations    int                    `json:"escalations,omitempty"`
+	AcknowledgedBy string                 `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time             `json:"acknowledged_at,omitempty"`
+	ClosedAt       *time.Time             `json:"closed_at,omitempty"`
+	Fingerprint    string                 `json:"fingerprint,omitempty"`
+	Occurrences    int                    `json:"occurrences"`
+	LastSeen       time.Time              `json:"last_seen"`
+	LastRaised     time.Time              `json:"last_raised"` // when it was last notified and correlated
+	Reopened       int                    `json:"reopened,omitempty"`
 }
 
+// alertSeq keeps alert IDs unique when the clock doesn't advance between alerts
+var alertSeq atomic.Uint64
+
+// proposalSeq keeps proposal IDs unique when several are submitted in a second
+var proposalSeq atomic.Uint64
+
 // Proposal represents an evolution proposal
 type Proposal struct {
-	ID          string
-	Component   string
-	Description string
-	Changes     map[string]interface{}
-	Status      string // "pending", "approved", "rejected"
-	Reward      float64
-	Feedback    string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID                string                 `json:"id"`
+	Component         string                 `json:"component"`
+	Description       string                 `json:"description"`
+	Changes           map[string]interface{} `json:"changes"`
+	Strategy          string                 `json:"strategy,omitempty"`
+	MemoryIDs         []string               `json:"memory_ids,omitempty"` // memory documents the proposal was derived from
+	Status            string                 `json:"status"`               // "draft", "review", "approved", "applied", "verified" or "rejected"
+	Diffs             []FileDiff             `json:"diffs"`                // the changes rendered against the workspace at submission
+	Comments          []ReviewComment        `json:"comments"`
+	Approvals         []Approval             `json:"approvals"`
+	RequiredApprovals int                    `json:"required_approvals"`
+	Timeline          []ProposalEvent        `json:"timeline"`
+	Reward            float64                `json:"reward"`
+	Feedback          string                 `json:"feedback,omitempty"`
+	Execution         *Execution             `json:"execution,omitempty"` // set once an approved proposal enters the pipeline
+	CreatedAt         time.Time              `json:"created_at"`
+	UpdatedAt         time.Time              `json:"updated_at"`
+}
+
+// clone copies a proposal so it can be read without holding w.mu
+func (p *Proposal) clone() *Proposal {
+	c := *p
+	c.MemoryIDs = append([]string(nil), p.MemoryIDs...)
+	c.Diffs = append([]FileDiff(nil), p.Diffs...) // diffs aren't modified after submission
+	c.Comments = append([]ReviewComment(nil), p.Comments...)
+	c.Approvals = append([]Approval(nil), p.Approvals...)
+	c.Timeline = append([]ProposalEvent(nil), p.Timeline...)
+	if p.Execution != nil {
+		execution := *p.Execution
+		execution.Steps = append([]ExecutionStep(nil), p.Execution.Steps...)
+		c.Execution = &execution
+	}
+	return &c
 }
 
 // Pattern represents a detected pattern
@@ -56,30 +131,89 @@ type Pattern struct {
 	Context     map[string]interface{}
 }
 
-// NewWatchdog creates a new watchdog
-func NewWatchdog(longTermMem *memory.LongTermMemory) *Watchdog {
+// NewWatchdog creates a new watchdog; a nil config uses DefaultConfig
+func NewWatchdog(config *Config) *Watchdog {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
 	return &Watchdog{
-		longTermMem: longTermMem,
-		alerts:      make([]Alert, 0),
-		proposals:   make(map[string]*Proposal),
-		patterns:    make([]Pattern, 0),
-		running:     false,
+		config:       config.normalize(),
+		alerts:       make([]Alert, 0),
+		proposals:    make(map[string]*Proposal),
+		patterns:     make([]Pattern, 0),
+		running:      false,
+		secrets:      &SecretScanner{config: DefaultSecretScannerConfig(), baseline: make(map[string]BaselineEntry)},
+		ledger:       newMemoryRewardLedger(),
+		dedup:        make(map[string]string),
+		scan:         DefaultScanConfig(),
+		sla:          DefaultSLAConfig(),
+		review:       DefaultReviewConfig(),
+		infoAlertTTL: defaultInfoAlertTTL,
+		events:       NewEventBus(),
 	}
 }
 
+// SetSecretScanner replaces the default secret scanner, e.g. with one that
+// keeps a baseline file
+func (w *Watchdog) SetSecretScanner(scanner *SecretScanner) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.secrets = scanner
+}
+
+// secretScanner returns the current secret scanner
+func (w *Watchdog) secretScanner() *SecretScanner {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.secrets
+}
+
+// SetRules adds user-defined rules to code analysis; the watchdog stops the
+// engine's reloading when it stops
+func (w *Watchdog) SetRules(engine *RulesEngine) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.rules = engine
+}
+
+// rulesEngine returns the user rules, or nil when there are none
+func (w *Watchdog) rulesEngine() *RulesEngine {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.rules
+}
+
+// SetNotifier sends new alerts to people outside the UI; the notifier is
+// flushed and stopped when the watchdog is closed
+func (w *Watchdog) SetNotifier(notifier *Notifier) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.notifier = notifier
+}
+
 // Start starts the watchdog monitoring
 func (w *Watchdog) Start() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if !w.config.Enabled {
+		return fmt.Errorf("watchdog disabled")
+	}
 	if w.running {
 		return fmt.Errorf("watchdog already running")
 	}
 
 	w.running = true
+	w.stopCh = make(chan struct{})
 
 	// Start monitoring goroutine
-	go w.monitorLoop()
+	go w.monitorLoop(w.config.ScanInterval, w.stopCh)
 
 	return nil
 }
@@ -87,36 +221,98 @@ func (w *Watchdog) Start() error {
 // Stop stops the watchdog monitoring
 func (w *Watchdog) Stop() error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
 	if !w.running {
+		w.mu.Unlock()
 		return fmt.Errorf("watchdog not running")
 	}
 
 	w.running = false
+	close(w.stopCh)
+	watcher := w.watcher
+	w.watcher = nil
+	rules := w.rules
+	stopCommands := w.stopCommands
+	w.commands, w.stopCommands = nil, nil
+	w.commits = nil // its poller ends with stopCh
+	w.mu.Unlock()
+
+	if stopCommands != nil {
+		stopCommands()
+	}
+
+	if rules != nil {
+		rules.Stop()
+	}
+
+	// The watcher records alerts under w.mu, so it's stopped without holding it
+	if watcher != nil {
+		watcher.Stop()
+	}
+
 	return nil
 }
 
-// monitorLoop continuously monitors for patterns
-func (w *Watchdog) monitorLoop() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// IsRunning reports whether the watchdog is monitoring
+func (w *Watchdog) IsRunning() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 
-	for {
-		w.mu.RLock()
-		running := w.running
-		w.mu.RUnlock()
+	return w.running
+}
 
-		if !running {
-			break
-		}
+// Watch starts streaming workspace file changes into the alert generator
+// until the watchdog is stopped
+func (w *Watchdog) Watch(config WatcherConfig) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.config.Enabled {
+		return fmt.Errorf("watchdog disabled")
+	}
+	if w.watcher != nil {
+		return fmt.Errorf("watchdog already watching %s", w.watcher.config.Root)
+	}
 
+	watcher := NewWatcher(w, config)
+	if err := watcher.Start(); err != nil {
+		return err
+	}
+	w.watcher = watcher
+
+	return nil
+}
+
+// recordAlerts stores alerts raised outside DetectPattern
+func (w *Watchdog) recordAlerts(alerts ...Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	w.addAlertsLocked(alerts...)
+	w.mu.Unlock()
+}
+
+// monitorLoop runs the monitoring checks every interval until stopCh closes
+func (w *Watchdog) monitorLoop(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
 		// Perform monitoring checks
+		w.expireAlerts()
 		w.checkPatterns()
 		w.checkSecurity()
 		w.checkDependencies()
-
-		<-ticker.C
+		w.checkConceptDrift()
+		w.checkRegressions()
+		w.checkSLAs()
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
 	}
 }
 
@@ -129,8 +325,9 @@ func (w *Watchdog) DetectPattern(code string) ([]Alert, error) {
 		alert := w.createAlert("pattern", "info", "Authentication Pattern",
 			"Authentication pattern detected in code",
 			map[string]interface{}{
-				"pattern": "authentication",
-				"code":    code[:min(len(code), 100)],
+				"pattern":    "authentication",
+				"code":       code[:min(len(code), 100)],
+				"confidence": 0.6,
 			})
 		alerts = append(alerts, alert)
 	}
@@ -140,8 +337,9 @@ func (w *Watchdog) DetectPattern(code string) ([]Alert, error) {
 		alert := w.createAlert("pattern", "warning", "SQL Query Detected",
 			"Direct SQL query detected - consider using parameterized queries",
 			map[string]interface{}{
-				"pattern": "sql_query",
-				"code":    code[:min(len(code), 100)],
+				"pattern":    "sql_query",
+				"code":       code[:min(len(code), 100)],
+				"confidence": 0.8,
 			})
 		alerts = append(alerts, alert)
 	}
@@ -151,8 +349,9 @@ func (w *Watchdog) DetectPattern(code string) ([]Alert, error) {
 		alert := w.createAlert("pattern", "info", "API Call Pattern",
 			"API call pattern detected",
 			map[string]interface{}{
-				"pattern": "api_call",
-				"code":    code[:min(len(code), 100)],
+				"pattern":    "api_call",
+				"code":       code[:min(len(code), 100)],
+				"confidence": 0.7,
 			})
 		alerts = append(alerts, alert)
 	}
@@ -163,19 +362,28 @@ func (w *Watchdog) DetectPattern(code string) ([]Alert, error) {
 			alert := w.createAlert("pattern", "warning", "Missing Error Handling",
 				"Function may lack proper error handling",
 				map[string]interface{}{
-					"pattern": "missing_error_handling",
-					"code":    code[:min(len(code), 100)],
+					"pattern":    "missing_error_handling",
+					"code":       code[:min(len(code), 100)],
+					"confidence": 0.5,
 				})
 			alerts = append(alerts, alert)
 		}
 	}
 
+	// Keyword heuristics less certain than MinConfidence don't raise alerts
+	confident := make([]Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		if confidence, _ := alert.Context["confidence"].(float64); confidence >= w.config.MinConfidence {
+			confident = append(confident, alert)
+		}
+	}
+
 	// Store alerts
 	w.mu.Lock()
-	w.alerts = append(w.alerts, alerts...)
+	confident = w.addAlertsLocked(confident...)
 	w.mu.Unlock()
 
-	return alerts, nil
+	return confident, nil
 }
 
 // checkPatterns checks for emerging patterns
@@ -193,33 +401,120 @@ func (w *Watchdog) checkSecurity() {
 	// - Insecure dependencies
 }
 
-// checkDependencies checks for dependency issues
+// checkDependencies checks the workspace's dependencies for known
+// vulnerabilities when the scan interval has passed or a manifest changed
 func (w *Watchdog) checkDependencies() {
-	// TODO: Implement dependency checks
-	// - Circular dependencies
-	// - Outdated packages
-	// - Unused dependencies
+	w.mu.RLock()
+	scanner := w.deps
+	w.mu.RUnlock()
+
+	if scanner == nil || !scanner.due(time.Now()) {
+		return
+	}
+
+	// Stopping the watchdog cancels a scan waiting on OSV
+	ctx, cancel := w.checkContext(dependencyScanTimeout)
+	defer cancel()
+
+	findings, err := scanner.Scan(ctx)
+	if err != nil {
+		slog.Warn("dependency scan incomplete", "error", err)
+	}
+
+	alerts := make([]Alert, 0, len(findings))
+	for _, finding := range findings {
+		alerts = append(alerts, w.dependencyAlert(finding))
+	}
+	w.recordAlerts(alerts...)
 }
 
-// SubmitProposal submits an evolution proposal
+// checkContext returns a context for a periodic check that is cancelled
+// when the watchdog stops; its model requests wait behind others
+func (w *Watchdog) checkContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	w.mu.RLock()
+	stopCh := w.stopCh
+	w.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(llm.WithPriority(context.Background(), llm.PriorityBackground), timeout)
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// SubmitProposal submits an evolution proposal, rendering its file changes
+// as diffs against the workspace. It goes straight into review unless it is
+// submitted as a draft.
 func (w *Watchdog) SubmitProposal(req models.ProposalRequest) (string, error) {
+	if req.RequiredApprovals < 0 {
+		return "", fmt.Errorf("%w: required_approvals can't be negative", ErrInvalidProposal)
+	}
+
+	w.mu.RLock()
+	config := w.review
+	w.mu.RUnlock()
+
+	// Proposals without file changes, e.g. suggestions only, have no diff
+	diffs := make([]FileDiff, 0)
+	if _, hasFiles := req.Changes["files"]; hasFiles || req.Changes["patch"] != nil {
+		if err := validateChanges(req.Changes); err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), diffTimeout)
+		rendered, err := renderChanges(ctx, config.Workspace, req.Changes)
+		cancel()
+		switch {
+		case errors.Is(err, ErrInvalidProposal):
+			return "", err
+		case err != nil:
+			slog.Warn("failed to render proposal diff", "error", err)
+		default:
+			diffs = rendered
+		}
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	id := fmt.Sprintf("proposal_%d", time.Now().Unix())
+	id := fmt.Sprintf("proposal_%d_%d", time.Now().Unix(), proposalSeq.Add(1))
 
+	status := ProposalReview
+	if req.Draft {
+		status = ProposalDraft
+	}
 	proposal := &Proposal{
-		ID:          id,
-		Component:   req.Component,
-		Description: req.Description,
-		Changes:     req.Changes,
-		Status:      "pending",
-		Reward:      0,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:                id,
+		Component:         req.Component,
+		Description:       req.Description,
+		Changes:           req.Changes,
+		Strategy:          req.Strategy,
+		MemoryIDs:         req.MemoryIDs,
+		Diffs:             diffs,
+		Comments:          make([]ReviewComment, 0),
+		Approvals:         make([]Approval, 0),
+		RequiredApprovals: max(req.RequiredApprovals, config.RequiredApprovals, 1),
+		Timeline:          make([]ProposalEvent, 0),
+		Reward:            0,
+		CreatedAt:         time.Now(),
 	}
+	w.transitionLocked(proposal, status, req.Author, "")
 
 	w.proposals[id] = proposal
+	proposalEvents.Inc("submitted")
+	w.events.Publish(EventProposalCreated, map[string]interface{}{
+		"proposal_id":        id,
+		"component":          req.Component,
+		"description":        req.Description,
+		"strategy":           req.Strategy,
+		"status":             status,
+		"author":             req.Author,
+		"required_approvals": proposal.RequiredApprovals,
+		"files":              len(diffs),
+	})
 
 	// Create alert for new proposal
 	alert := w.createAlert("proposal", "info", "New Proposal",
@@ -229,52 +524,84 @@ func (w *Watchdog) SubmitProposal(req models.ProposalRequest) (string, error) {
 			"component":   req.Component,
 		})
 
-	w.alerts = append(w.alerts, alert)
+	w.addAlertsLocked(alert)
 
 	return id, nil
 }
 
-// ApproveProposal approves a proposal
-func (w *Watchdog) ApproveProposal(id string) error {
+// ApproveProposal records a reviewer's approval of a proposal in review.
+// Once it has its required approvals the proposal is approved and, when
+// there is a pipeline, starts being applied.
+func (w *Watchdog) ApproveProposal(id string, req models.ProposalReviewRequest) (*Proposal, error) {
+	if strings.TrimSpace(req.Reviewer) == "" {
+		return nil, fmt.Errorf("%w: reviewer is required", ErrInvalidProposal)
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	proposal, exists := w.proposals[id]
-	if !exists {
-		return fmt.Errorf("proposal %s not found", id)
+	proposal, err := w.proposalLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != ProposalReview {
+		return nil, fmt.Errorf("%w: proposal %s is %s, not in review", ErrProposalConflict, id, proposal.Status)
+	}
+	if proposal.approvedBy(req.Reviewer) {
+		return nil, fmt.Errorf("%w: %s already approved proposal %s", ErrProposalConflict, req.Reviewer, id)
 	}
 
-	proposal.Status = "approved"
-	proposal.UpdatedAt = time.Now()
+	approval := Approval{Reviewer: req.Reviewer, Comment: req.Comment, ApprovedAt: time.Now()}
+	if len(proposal.Approvals)+1 < proposal.RequiredApprovals {
+		proposal.Approvals = append(proposal.Approvals, approval)
+		proposal.UpdatedAt = approval.ApprovedAt
+		return proposal.clone(), nil
+	}
 
-	return nil
+	if w.pipeline != nil {
+		if err := w.startExecutionLocked(proposal); err != nil {
+			return nil, err
+		}
+	}
+	proposal.Approvals = append(proposal.Approvals, approval)
+	w.transitionLocked(proposal, ProposalApproved, req.Reviewer, req.Comment)
+	proposalEvents.Inc(ProposalApproved)
+
+	return proposal.clone(), nil
 }
 
-// RejectProposal rejects a proposal
-func (w *Watchdog) RejectProposal(id string, reason string) error {
+// RejectProposal rejects a proposal that hasn't been applied
+func (w *Watchdog) RejectProposal(id, reviewer, reason string) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	proposal, exists := w.proposals[id]
-	if !exists {
-		return fmt.Errorf("proposal %s not found", id)
+	proposal, err := w.proposalLocked(id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case proposal.Status == ProposalRejected, proposal.Status == ProposalApplied, proposal.Status == ProposalVerified:
+		return fmt.Errorf("%w: proposal %s is %s", ErrProposalConflict, id, proposal.Status)
+	case proposal.Execution != nil && proposal.Execution.Status == ExecutionRunning:
+		return fmt.Errorf("%w: proposal %s is being executed", ErrProposalConflict, id)
 	}
 
-	proposal.Status = "rejected"
 	proposal.Feedback = reason
-	proposal.UpdatedAt = time.Now()
+	w.transitionLocked(proposal, ProposalRejected, reviewer, reason)
+	proposalEvents.Inc(ProposalRejected)
 
 	return nil
 }
 
-// SetReward sets reward for a proposal
+// SetReward sets reward for a proposal, appends it to the reward ledger and
+// records it in long-term memory against the documents that produced the
+// proposal
 func (w *Watchdog) SetReward(req models.RewardRequest) error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
 	proposal, exists := w.proposals[req.ProposalID]
 	if !exists {
-		return fmt.Errorf("proposal %s not found", req.ProposalID)
+		w.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrProposalNotFound, req.ProposalID)
 	}
 
 	proposal.Reward = req.Reward
@@ -283,6 +610,44 @@ func (w *Watchdog) SetReward(req models.RewardRequest) error {
 	}
 	proposal.UpdatedAt = time.Now()
 
+	outcome := memory.ProposalOutcome{
+		ProposalID:  proposal.ID,
+		Component:   proposal.Component,
+		Description: proposal.Description,
+		Strategy:    proposal.Strategy,
+		MemoryIDs:   append([]string(nil), proposal.MemoryIDs...),
+		Reward:      math.Max(0, math.Min(1, req.Reward)), // memory rewards are in [0, 1]
+		Feedback:    proposal.Feedback,
+	}
+
+	reviewer := req.Reviewer
+	if reviewer == "" {
+		reviewer = "anonymous"
+	}
+	entry := RewardEntry{
+		Time:       proposal.UpdatedAt,
+		ProposalID: proposal.ID,
+		Component:  proposal.Component,
+		Strategy:   proposal.Strategy,
+		Reviewer:   reviewer,
+		Reward:     req.Reward,
+		Feedback:   req.Feedback,
+	}
+	ledger := w.ledger
+	w.mu.Unlock()
+
+	if err := ledger.Record(entry); err != nil {
+		slog.Warn("failed to record reward", "proposal_id", proposal.ID, "error", err)
+	}
+
+	// The reward is kept even if memory is unavailable
+	if longTerm := w.config.longTerm(); longTerm != nil {
+		ctx := memory.WithCaller(context.Background(), "watchdog")
+		if _, err := longTerm.RecordProposalReward(ctx, outcome); err != nil {
+			slog.Warn("failed to record reward in memory", "proposal_id", proposal.ID, "error", err)
+		}
+	}
+
 	return nil
 }
 
@@ -291,13 +656,49 @@ func (w *Watchdog) GetStatus() interface{} {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	return map[string]interface{}{
+	status := map[string]interface{}{
 		"running":         w.running,
+		"enabled":         w.config.Enabled,
+		"scan_interval":   w.config.ScanInterval.String(),
+		"alert_threshold": w.config.AlertThreshold,
 		"alerts_count":    len(w.alerts),
 		"proposals_count": len(w.proposals),
 		"patterns_count":  len(w.patterns),
 		"recent_alerts":   w.getRecentAlerts(5),
 	}
+	if w.watcher != nil {
+		status["watcher"] = w.watcher.Stats()
+	}
+	if w.rules != nil {
+		status["rules"] = w.rules.Status()
+	}
+	if w.notifier != nil {
+		status["notifications"] = w.notifier.Stats()
+	}
+	if w.correlator != nil {
+		status["alert_groups"] = len(w.correlator.groups)
+	}
+	if w.deps != nil {
+		status["dependencies"] = w.deps.Stats()
+	}
+	if w.drift != nil {
+		status["concept_drift"] = w.drift.Stats()
+	}
+	if w.commands != nil {
+		status["commands"] = w.commands.Stats()
+	}
+	if w.commits != nil {
+		status["commits"] = w.commits.Stats()
+	}
+	if w.regressions != nil {
+		status["regressions"] = w.regressions.Stats()
+	}
+	if len(w.analyzers) > 0 {
+		status["analyzers"] = w.analyzerStats()
+	}
+	status["events"] = w.events.Stats()
+
+	return status
 }
 
 // GetAlerts returns all alerts
@@ -317,7 +718,7 @@ func (w *Watchdog) GetProposals() []*Proposal {
 
 	proposals := make([]*Proposal, 0, len(w.proposals))
 	for _, p := range w.proposals {
-		proposals = append(proposals, p)
+		proposals = append(proposals, p.clone())
 	}
 
 	return proposals
@@ -330,25 +731,10 @@ func (w *Watchdog) GetProposal(id string) (*Proposal, error) {
 
 	proposal, exists := w.proposals[id]
 	if !exists {
-		return nil, fmt.Errorf("proposal %s not found", id)
-	}
-
-	return proposal, nil
-}
-
-// AcknowledgeAlert acknowledges an alert
-func (w *Watchdog) AcknowledgeAlert(id string) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	for i := range w.alerts {
-		if w.alerts[i].ID == id {
-			w.alerts[i].Acknowledged = true
-			return nil
-		}
+		return nil, fmt.Errorf("%w: %s", ErrProposalNotFound, id)
 	}
 
-	return fmt.Errorf("alert %s not found", id)
+	return proposal.clone(), nil
 }
 
 // ClearAlerts clears all alerts
@@ -357,19 +743,32 @@ func (w *Watchdog) ClearAlerts() {
 	defer w.mu.Unlock()
 
 	w.alerts = make([]Alert, 0)
+	w.dedup = make(map[string]string)
+	if w.store != nil {
+		if err := w.store.clear(); err != nil {
+			slog.Warn("failed to clear stored alerts", "error", err)
+		}
+	}
 }
 
 // createAlert creates a new alert
 func (w *Watchdog) createAlert(alertType, severity, title, message string, context map[string]interface{}) Alert {
+	now := time.Now()
 	return Alert{
-		ID:           fmt.Sprintf("alert_%d", time.Now().UnixNano()),
+		ID:           fmt.Sprintf("alert_%d_%d", now.UnixNano(), alertSeq.Add(1)),
 		Type:         alertType,
 		Severity:     severity,
 		Title:        title,
 		Message:      message,
 		Context:      context,
-		Timestamp:    time.Now(),
+		Timestamp:    now,
 		Acknowledged: false,
+		State:        AlertOpen,
+		OpenedAt:     now,
+		Fingerprint:  alertFingerprint(alertType, title, message, context),
+		Occurrences:  1,
+		LastSeen:     now,
+		LastRaised:   now,
 	}
 }
 
@@ -408,13 +807,25 @@ func (w *Watchdog) GetMetrics() map[string]interface{} {
 
 	proposalsByStatus := make(map[string]int)
 	totalReward := 0.0
+	strategyRewards := make(map[string]float64)
+	strategyCounts := make(map[string]int)
 
 	for _, proposal := range w.proposals {
 		proposalsByStatus[proposal.Status]++
 		totalReward += proposal.Reward
+		if proposal.Strategy != "" {
+			strategyRewards[proposal.Strategy] += proposal.Reward
+			strategyCounts[proposal.Strategy]++
+		}
+	}
+
+	// Mean reward per strategy shows which approaches are worth repeating
+	rewardByStrategy := make(map[string]float64, len(strategyRewards))
+	for strategy, total := range strategyRewards {
+		rewardByStrategy[strategy] = total / float64(strategyCounts[strategy])
 	}
 
-	return map[string]interface{}{
+	metrics := map[string]interface{}{
 		"total_alerts":        totalAlerts,
 		"acknowledged_alerts": acknowledgedAlerts,
 		"alerts_by_type":      alertsByType,
@@ -422,8 +833,13 @@ func (w *Watchdog) GetMetrics() map[string]interface{} {
 		"total_proposals":     len(w.proposals),
 		"proposals_by_status": proposalsByStatus,
 		"total_reward":        totalReward,
+		"reward_by_strategy":  rewardByStrategy,
 		"patterns_detected":   len(w.patterns),
 	}
+	for key, value := range w.slaMetricsLocked(time.Now()) {
+		metrics[key] = value
+	}
+	return metrics
 }
 
 // Helper functions
@@ -0,0 +1,426 @@
+package watchdog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultIgnore is the WATCHDOG_IGNORE default: directories that hold
+// dependencies, data or build output rather than workspace code
+const defaultIgnore = ".git,node_modules,vendor,data,dist,build"
+
+// WatcherConfig configures the workspace file watcher
+type WatcherConfig struct {
+	Root         string
+	Ignore       []string // glob patterns matched against every element of a relative path
+	Debounce     time.Duration
+	MaxFileBytes int64
+
+	// Directories overrides settings below workspace-relative directories;
+	// the longest matching directory applies
+	Directories map[string]DirectoryConfig
+}
+
+// DirectoryConfig overrides watcher settings for a directory and everything below it
+type DirectoryConfig struct {
+	Disabled   bool     `json:"disabled"`
+	Ignore     []string `json:"ignore"`      // added to the global patterns
+	DebounceMs int      `json:"debounce_ms"` // zero keeps the global debounce
+}
+
+// WatcherConfigFromEnv reads WORKSPACE_ROOT, WATCHDOG_IGNORE,
+// WATCHDOG_DEBOUNCE_MS, WATCHDOG_MAX_FILE_KB and the per-directory JSON file
+// at WATCHDOG_WATCH_CONFIG, e.g. {"docs": {"disabled": true}}
+func WatcherConfigFromEnv() (WatcherConfig, error) {
+	config := WatcherConfig{
+		Root:         getEnv("WORKSPACE_ROOT", "."),
+		Debounce:     time.Duration(getEnvInt("WATCHDOG_DEBOUNCE_MS", 500)) * time.Millisecond,
+		MaxFileBytes: int64(getEnvInt("WATCHDOG_MAX_FILE_KB", 512)) * 1024,
+		Directories:  make(map[string]DirectoryConfig),
+	}
+
+	for _, pattern := range strings.Split(getEnv("WATCHDOG_IGNORE", defaultIgnore), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			config.Ignore = append(config.Ignore, pattern)
+		}
+	}
+
+	if path := getEnv("WATCHDOG_WATCH_CONFIG", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read watcher config: %w", err)
+		}
+		if err := json.Unmarshal(data, &config.Directories); err != nil {
+			return config, fmt.Errorf("failed to parse watcher config: %w", err)
+		}
+	}
+
+	return config, nil
+}
+
+// Watcher streams workspace file changes into the alert generator. Changes
+// are debounced per file, and an alert already raised for a file isn't
+// raised again until it stops appearing in that file's analysis.
+type Watcher struct {
+	config    WatcherConfig
+	watchdog  *Watchdog
+	generator *AlertGenerator
+	fs        *fsnotify.Watcher
+
+	mu       sync.Mutex
+	contents map[string]string          // last analyzed content by relative path
+	reported map[string]map[string]bool // alert keys last raised by relative path
+	pending  map[string]*pendingChange
+	dirs     int
+	events   int64
+	analyzed int64
+	stopped  bool
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// pendingChange is a file change waiting out its debounce
+type pendingChange struct {
+	created bool
+	timer   *time.Timer
+	gen     int
+}
+
+// NewWatcher creates a watcher that records alerts on w
+func NewWatcher(w *Watchdog, config WatcherConfig) *Watcher {
+	return &Watcher{
+		config:    config,
+		watchdog:  w,
+		generator: NewAlertGenerator(w),
+		contents:  make(map[string]string),
+		reported:  make(map[string]map[string]bool),
+		pending:   make(map[string]*pendingChange),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+}
+
+// Start watches every directory under the root that isn't ignored or disabled
+func (fw *Watcher) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	fw.fs = watcher
+
+	if err := fw.addTree(fw.config.Root); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go fw.loop()
+
+	slog.Info("watching files", "dirs", fw.dirs, "root", fw.config.Root)
+	return nil
+}
+
+// Stop stops watching and drops changes still being debounced
+func (fw *Watcher) Stop() {
+	fw.mu.Lock()
+	if fw.stopped {
+		fw.mu.Unlock()
+		return
+	}
+	fw.stopped = true
+	for _, change := range fw.pending {
+		change.timer.Stop()
+	}
+	fw.pending = make(map[string]*pendingChange)
+	fw.mu.Unlock()
+
+	close(fw.stopCh)
+	<-fw.doneCh
+	fw.fs.Close()
+}
+
+// Stats returns what the watcher has seen so far
+func (fw *Watcher) Stats() map[string]interface{} {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	return map[string]interface{}{
+		"root":        fw.config.Root,
+		"directories": fw.dirs,
+		"events":      fw.events,
+		"analyzed":    fw.analyzed,
+		"pending":     len(fw.pending),
+	}
+}
+
+func (fw *Watcher) loop() {
+	defer close(fw.doneCh)
+
+	for {
+		select {
+		case <-fw.stopCh:
+			return
+		case event, ok := <-fw.fs.Events:
+			if !ok {
+				return
+			}
+			fw.handle(event)
+		case err, ok := <-fw.fs.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("file watcher error", "error", err)
+		}
+	}
+}
+
+// handle routes one file system event
+func (fw *Watcher) handle(event fsnotify.Event) {
+	rel, ok := fw.relative(event.Name)
+	if !ok {
+		return
+	}
+	dir, ignored := fw.settings(rel)
+	if ignored {
+		return
+	}
+
+	fw.mu.Lock()
+	fw.events++
+	fw.mu.Unlock()
+
+	switch {
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		fw.forget(rel)
+	case event.Has(fsnotify.Create):
+		// New directories aren't covered by existing watches
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := fw.addTree(event.Name); err != nil {
+				slog.Warn("failed to watch directory", "dir", rel, "error", err)
+			}
+			return
+		}
+		fw.schedule(rel, true, fw.debounce(dir))
+	case event.Has(fsnotify.Write):
+		fw.schedule(rel, false, fw.debounce(dir))
+	}
+}
+
+// addTree watches dir and every directory below it that isn't ignored or disabled
+func (fw *Watcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A directory removed mid-walk isn't worth failing over
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		if rel, ok := fw.relative(p); ok && rel != "." {
+			if _, ignored := fw.settings(rel); ignored {
+				return filepath.SkipDir
+			}
+		}
+
+		if err := fw.fs.Add(p); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", p, err)
+		}
+		fw.mu.Lock()
+		fw.dirs++
+		fw.mu.Unlock()
+		return nil
+	})
+}
+
+// schedule (re)starts a file's debounce timer
+func (fw *Watcher) schedule(rel string, created bool, debounce time.Duration) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.stopped {
+		return
+	}
+
+	change := fw.pending[rel]
+	if change == nil {
+		change = &pendingChange{}
+		fw.pending[rel] = change
+	} else {
+		change.timer.Stop()
+	}
+	change.created = change.created || created
+	change.gen++
+
+	gen := change.gen
+	change.timer = time.AfterFunc(debounce, func() {
+		fw.mu.Lock()
+		// A later event restarted the timer after this one fired
+		if current := fw.pending[rel]; current != change || current.gen != gen {
+			fw.mu.Unlock()
+			return
+		}
+		delete(fw.pending, rel)
+		fw.mu.Unlock()
+
+		fw.process(rel, change.created)
+	})
+}
+
+// process analyzes a changed file and records alerts not already raised for it
+func (fw *Watcher) process(rel string, created bool) {
+	path := filepath.Join(fw.config.Root, filepath.FromSlash(rel))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fw.forget(rel)
+		return
+	}
+	if !info.Mode().IsRegular() || info.Size() > fw.config.MaxFileBytes {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Warn("failed to read changed file", "file", rel, "error", err)
+		return
+	}
+	if bytes.IndexByte(data, 0) != -1 {
+		return // binary
+	}
+	content := string(data)
+
+	fw.mu.Lock()
+	previous, seen := fw.contents[rel]
+	fw.contents[rel] = content
+	fw.analyzed++
+	fw.mu.Unlock()
+
+	if seen && previous == content {
+		return
+	}
+	// Without a baseline only the new content is analyzed, not the size of the change
+	if !seen && !created {
+		previous = content
+	}
+
+	alerts := fw.generator.MonitorFileChanges(rel, previous, content)
+	alerts = append(alerts, fw.watchdog.analyzeChanged(fw.config.Root, rel)...)
+	fw.watchdog.recordAlerts(fw.fresh(rel, alerts)...)
+}
+
+// fresh returns the alerts not raised by the file's previous analysis
+func (fw *Watcher) fresh(rel string, alerts []Alert) []Alert {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	previous := fw.reported[rel]
+	current := make(map[string]bool, len(alerts))
+	fresh := make([]Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		key := alert.Type + "\x00" + alert.Title + "\x00" + alert.Message
+		if current[key] {
+			continue
+		}
+		current[key] = true
+		if !previous[key] {
+			fresh = append(fresh, alert)
+		}
+	}
+	fw.reported[rel] = current
+
+	return fresh
+}
+
+// forget drops what the watcher knows about a removed file
+func (fw *Watcher) forget(rel string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if change, ok := fw.pending[rel]; ok {
+		change.timer.Stop()
+		delete(fw.pending, rel)
+	}
+	delete(fw.contents, rel)
+	delete(fw.reported, rel)
+}
+
+// relative returns a path relative to the root with forward slashes
+func (fw *Watcher) relative(p string) (string, bool) {
+	rel, err := filepath.Rel(fw.config.Root, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// settings returns the directory configuration for a relative path and
+// whether the path is ignored or in a disabled directory
+func (fw *Watcher) settings(rel string) (DirectoryConfig, bool) {
+	var dir DirectoryConfig
+	longest := -1
+	for prefix, config := range fw.config.Directories {
+		prefix = strings.Trim(prefix, "/")
+		if (rel == prefix || strings.HasPrefix(rel, prefix+"/")) && len(prefix) > longest {
+			dir, longest = config, len(prefix)
+		}
+	}
+	if dir.Disabled {
+		return dir, true
+	}
+
+	for _, element := range strings.Split(rel, "/") {
+		if matchAny(fw.config.Ignore, element) || matchAny(dir.Ignore, element) {
+			return dir, true
+		}
+	}
+	return dir, false
+}
+
+// debounce returns the debounce delay for files in dir
+func (fw *Watcher) debounce(dir DirectoryConfig) time.Duration {
+	if dir.DebounceMs > 0 {
+		return time.Duration(dir.DebounceMs) * time.Millisecond
+	}
+	return fw.config.Debounce
+}
+
+// matchAny reports whether name matches any glob pattern
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,402 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Request headers each delivery carries. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// workers bounds the deliveries attempted at once
+	workers = 4
+	// maxBackoff caps the wait between attempts
+	maxBackoff = time.Hour
+	// responseSnippet is how much of a response body an attempt keeps
+	responseSnippet = 512
+)
+
+// deliveriesTotal counts delivery attempts by event and outcome
+var deliveriesTotal = metrics.NewCounterVec("webhook_deliveries_total",
+	"Webhook delivery attempts", "event", "status")
+
+// Dispatcher keeps webhooks and delivers events to them from the outbox,
+// retrying failed attempts with exponential backoff
+type Dispatcher struct {
+	config   Config
+	db       *bolt.DB
+	client   *http.Client
+	ctx      context.Context // cancelled by Close, abandoning attempts in flight
+	cancel   context.CancelFunc
+	wake     chan struct{}
+	inflight map[string]bool // deliveries being attempted
+	mu       sync.Mutex      // guards inflight and orders webhook updates
+	wg       sync.WaitGroup
+}
+
+// Open opens the outbox; Start begins delivering
+func Open(config Config) (*Dispatcher, error) {
+	db, err := openDB(config.DBPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		config:   config,
+		db:       db,
+		client:   &http.Client{Timeout: config.Timeout},
+		ctx:      ctx,
+		cancel:   cancel,
+		wake:     make(chan struct{}, 1),
+		inflight: make(map[string]bool),
+	}, nil
+}
+
+// Start delivers pending deliveries, including those left from before a
+// restart, until Close
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go d.run()
+}
+
+// Close stops delivering and closes the outbox. Attempts in flight are
+// abandoned and tried again after the next start.
+func (d *Dispatcher) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	return d.db.Close()
+}
+
+// Emit queues event for every enabled webhook subscribed to it; data is
+// posted as the body's data field
+func (d *Dispatcher) Emit(event string, data interface{}) {
+	webhooks, err := d.subscribers(event)
+	if err != nil {
+		slog.Warn("failed to queue webhook event", "event", event, "error", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	if _, err := d.enqueue(event, data, webhooks); err != nil {
+		slog.Warn("failed to queue webhook event", "event", event, "error", err)
+	}
+}
+
+// Test queues a ping to a webhook, whatever its events and even when it's
+// disabled, returning the delivery to follow in the log
+func (d *Dispatcher) Test(id string) (Delivery, error) {
+	webhook, err := d.webhook(id)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	deliveries, err := d.enqueue(EventPing, map[string]interface{}{"webhook_id": webhook.ID}, []Webhook{webhook})
+	if err != nil {
+		return Delivery{}, err
+	}
+	return deliveries[0], nil
+}
+
+// subscribers lists the enabled webhooks taking event
+func (d *Dispatcher) subscribers(event string) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookBucket).ForEach(func(_, v []byte) error {
+			var webhook Webhook
+			if err := json.Unmarshal(v, &webhook); err != nil {
+				return err
+			}
+			if webhook.Enabled && webhook.subscribes(event) {
+				webhooks = append(webhooks, webhook)
+			}
+			return nil
+		})
+	})
+	return webhooks, err
+}
+
+// enqueue writes a pending delivery of event per webhook and wakes the worker
+func (d *Dispatcher) enqueue(event string, data interface{}, webhooks []Webhook) ([]Delivery, error) {
+	now := time.Now().UTC()
+	deliveries := make([]Delivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		id := uuid.New().String()
+		payload, err := json.Marshal(envelope{ID: id, Event: event, CreatedAt: now, Data: data})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode event: %w", err)
+		}
+		deliveries = append(deliveries, Delivery{
+			ID:            id,
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Status:        DeliveryPending,
+			Payload:       payload,
+			Attempts:      make([]Attempt, 0),
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+		})
+	}
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, delivery := range deliveries {
+			if err := putDelivery(tx, delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue deliveries: %w", err)
+	}
+
+	d.poke()
+	return deliveries, nil
+}
+
+// poke wakes the worker without blocking
+func (d *Dispatcher) poke() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run starts due deliveries, then sleeps until the next is due or a new
+// one is queued
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+		timer.Reset(d.dispatchDue())
+	}
+}
+
+// dispatchDue starts attempts for the due pending deliveries, as many as
+// there are free workers, oldest first, and returns how long until the
+// next one is due
+func (d *Dispatcher) dispatchDue() time.Duration {
+	now := time.Now()
+	var pending []Delivery
+	if err := d.eachDelivery(func(delivery Delivery) {
+		if delivery.Status == DeliveryPending {
+			pending = append(pending, delivery)
+		}
+	}); err != nil {
+		slog.Warn("failed to read pending webhook deliveries", "error", err)
+		return d.config.RetryBackoff
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].NextAttemptAt.Before(*pending[j].NextAttemptAt)
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wait := time.Minute
+	for _, delivery := range pending {
+		if d.inflight[delivery.ID] {
+			continue
+		}
+		if due := delivery.NextAttemptAt.Sub(now); due > 0 {
+			wait = min(wait, due)
+			break
+		}
+		if len(d.inflight) >= workers {
+			break
+		}
+
+		d.inflight[delivery.ID] = true
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.attempt(delivery)
+
+			d.mu.Lock()
+			delete(d.inflight, delivery.ID)
+			d.mu.Unlock()
+			d.poke()
+		}()
+	}
+	return wait
+}
+
+// attempt posts a delivery once and records how it went
+func (d *Dispatcher) attempt(delivery Delivery) {
+	webhook, err := d.webhook(delivery.WebhookID)
+	if err != nil || (!webhook.Enabled && delivery.Event != EventPing) {
+		reason := "webhook deleted"
+		if err == nil {
+			reason = "webhook disabled"
+		}
+		d.finish(delivery, Attempt{At: time.Now().UTC(), Error: reason}, DeliveryFailed)
+		return
+	}
+
+	result, retryable := d.post(webhook, delivery)
+	if d.ctx.Err() != nil {
+		// Shutting down; the attempt doesn't count and is tried after a restart
+		return
+	}
+
+	switch {
+	case result.Error == "":
+		deliveriesTotal.Inc(delivery.Event, DeliveryDelivered)
+		d.finish(delivery, result, DeliveryDelivered)
+	case !retryable || len(delivery.Attempts)+1 >= d.config.MaxAttempts:
+		deliveriesTotal.Inc(delivery.Event, DeliveryFailed)
+		slog.Warn("webhook delivery failed", "delivery_id", delivery.ID, "event", delivery.Event, "url", webhook.URL, "error", result.Error)
+		d.finish(delivery, result, DeliveryFailed)
+	default:
+		deliveriesTotal.Inc(delivery.Event, "retry")
+		d.finish(delivery, result, DeliveryPending)
+	}
+}
+
+// post sends a delivery, reporting whether a failure is worth retrying:
+// network errors, timeouts, 408, 429 and 5xx are
+func (d *Dispatcher) post(webhook Webhook, delivery Delivery) (result Attempt, retryable bool) {
+	start := time.Now()
+	result.At = start.UTC()
+	defer func() {
+		result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "agent-workspace-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result, true
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, responseSnippet))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	result.StatusCode = resp.StatusCode
+	result.Response = string(snippet)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return result, false
+	}
+
+	result.Error = fmt.Sprintf("endpoint answered %s", resp.Status)
+	retryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return result, retryable
+}
+
+// finish records an attempt and the delivery's new status, scheduling the
+// next attempt of a pending one, then prunes the log
+func (d *Dispatcher) finish(delivery Delivery, result Attempt, status string) {
+	delivery.Attempts = append(delivery.Attempts, result)
+	delivery.Status = status
+	delivery.NextAttemptAt = nil
+	switch status {
+	case DeliveryDelivered:
+		delivery.DeliveredAt = &result.At
+	case DeliveryPending:
+		next := time.Now().UTC().Add(backoff(d.config.RetryBackoff, len(delivery.Attempts)))
+		delivery.NextAttemptAt = &next
+	}
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		return putDelivery(tx, delivery)
+	})
+	if err != nil {
+		slog.Warn("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err)
+		return
+	}
+	if status != DeliveryPending {
+		d.prune()
+	}
+}
+
+// prune drops the oldest finished deliveries beyond the log size
+func (d *Dispatcher) prune() {
+	var finished []Delivery
+	if err := d.eachDelivery(func(delivery Delivery) {
+		if delivery.Status != DeliveryPending {
+			finished = append(finished, delivery)
+		}
+	}); err != nil || len(finished) <= d.config.LogSize {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CreatedAt.Before(finished[j].CreatedAt)
+	})
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, delivery := range finished[:len(finished)-d.config.LogSize] {
+			if err := tx.Bucket(deliveryBucket).Delete([]byte(delivery.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("failed to prune webhook deliveries", "error", err)
+	}
+}
+
+// backoff is how long to wait after the given number of attempts
+func backoff(base time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+// Sign computes the signature header for a body sent at timestamp, which
+// receivers recompute with the webhook's secret to check a delivery
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
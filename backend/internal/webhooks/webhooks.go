@@ -0,0 +1,482 @@
+// Package webhooks notifies external services of task, proposal and alert
+// events. Each event becomes a delivery per matching webhook, kept in an
+// outbox in Bolt until it's delivered or runs out of attempts, so pending
+// deliveries survive a restart.
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/models"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Events a webhook can subscribe to
+const (
+	EventTaskCompleted   = "task.completed"
+	EventTaskFailed      = "task.failed"
+	EventTaskCancelled   = "task.cancelled"
+	EventProposalCreated = "proposal.created"
+	EventAlertError      = "alert.error"  // a watchdog alert of error severity
+	EventPing            = "webhook.ping" // sent by a test, whatever the webhook's events
+)
+
+// events lists the events webhooks can subscribe to
+var events = []string{EventTaskCompleted, EventTaskFailed, EventTaskCancelled, EventProposalCreated, EventAlertError}
+
+var (
+	webhookBucket  = []byte("webhooks")
+	deliveryBucket = []byte("deliveries")
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+var (
+	// ErrWebhookNotFound is returned for unknown webhook IDs
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhook is returned for malformed webhooks and queries
+	ErrInvalidWebhook = errors.New("invalid webhook")
+)
+
+// Config sets where the outbox is kept and how deliveries are retried
+type Config struct {
+	DBPath       string
+	MaxAttempts  int
+	Timeout      time.Duration // per attempt
+	RetryBackoff time.Duration // before the first retry, doubling after each
+	LogSize      int           // finished deliveries kept in the log
+}
+
+// DefaultConfig tries each delivery 6 times over about five minutes
+func DefaultConfig() Config {
+	return Config{
+		DBPath:       "./data/webhooks.db",
+		MaxAttempts:  6,
+		Timeout:      10 * time.Second,
+		RetryBackoff: 10 * time.Second,
+		LogSize:      1000,
+	}
+}
+
+// ConfigFromEnv reads WEBHOOKS_DB_PATH, WEBHOOKS_MAX_ATTEMPTS,
+// WEBHOOKS_TIMEOUT, WEBHOOKS_RETRY_BACKOFF and WEBHOOKS_LOG_SIZE
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	if value := os.Getenv("WEBHOOKS_DB_PATH"); value != "" {
+		config.DBPath = value
+	}
+
+	for env, n := range map[string]*int{
+		"WEBHOOKS_MAX_ATTEMPTS": &config.MaxAttempts,
+		"WEBHOOKS_LOG_SIZE":     &config.LogSize,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return DefaultConfig(), fmt.Errorf("invalid %s %q, expected a positive number", env, value)
+		}
+		*n = parsed
+	}
+
+	for env, duration := range map[string]*time.Duration{
+		"WEBHOOKS_TIMEOUT":       &config.Timeout,
+		"WEBHOOKS_RETRY_BACKOFF": &config.RetryBackoff,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return DefaultConfig(), fmt.Errorf("invalid %s %q, expected a duration such as 10s", env, value)
+		}
+		*duration = parsed
+	}
+	return config, nil
+}
+
+// Webhook is an endpoint events are posted to. Its secret signs each
+// request and is only returned when it's set.
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	Events      []string  `json:"events"` // empty is every event
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// public leaves the secret out
+func (w Webhook) public() Webhook {
+	w.Secret = ""
+	return w
+}
+
+// subscribes reports whether the webhook takes event: named exactly, by a
+// "task.*" style prefix, or by "*" or no events at all
+func (w Webhook) subscribes(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, pattern := range w.Events {
+		if pattern == "*" || pattern == event {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Attempt is one try at a delivery
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"` // the start of the response body
+	DurationMs float64   `json:"duration_ms"`
+}
+
+// Delivery is an event on its way to one webhook
+type Delivery struct {
+	ID            string          `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Status        string          `json:"status"` // pending, delivered or failed
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      []Attempt       `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// DeliveryPage is one page of deliveries matching a query, newest first
+type DeliveryPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+	Total      int        `json:"total"`
+	Offset     int        `json:"offset"`
+	Limit      int        `json:"limit"`
+}
+
+// envelope is the body posted for each delivery
+type envelope struct {
+	ID        string      `json:"id"` // the delivery's; retries repeat it
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// openDB opens (or creates) the outbox database
+func openDB(path string) (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create webhook store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhook store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{webhookBucket, deliveryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create webhook buckets: %w", err)
+	}
+	return db, nil
+}
+
+// Create adds a webhook. Without a secret one is generated; either way the
+// returned webhook carries it, the only time it's returned.
+func (d *Dispatcher) Create(req models.WebhookCreateRequest) (Webhook, error) {
+	now := time.Now().UTC()
+	webhook := Webhook{
+		ID:          uuid.New().String(),
+		URL:         strings.TrimSpace(req.URL),
+		Secret:      req.Secret,
+		Events:      req.Events,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if webhook.Events == nil {
+		webhook.Events = make([]string, 0)
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = newSecret()
+	}
+	if err := validate(webhook); err != nil {
+		return Webhook{}, err
+	}
+
+	if err := d.saveWebhook(webhook); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// List returns every webhook, oldest first, without secrets
+func (d *Dispatcher) List() ([]Webhook, error) {
+	webhooks := make([]Webhook, 0)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookBucket).ForEach(func(_, v []byte) error {
+			var webhook Webhook
+			if err := json.Unmarshal(v, &webhook); err != nil {
+				return err
+			}
+			webhooks = append(webhooks, webhook.public())
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+// Get returns a webhook without its secret
+func (d *Dispatcher) Get(id string) (Webhook, error) {
+	webhook, err := d.webhook(id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return webhook.public(), nil
+}
+
+// Update changes the fields req sets. A new secret is returned once;
+// otherwise the secret is left out.
+func (d *Dispatcher) Update(id string, req models.WebhookUpdateRequest) (Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	webhook, err := d.webhook(id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if req.URL != nil {
+		webhook.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Secret != nil {
+		webhook.Secret = *req.Secret
+		if webhook.Secret == "" {
+			webhook.Secret = newSecret()
+		}
+	}
+	if req.Events != nil {
+		webhook.Events = req.Events
+	}
+	if req.Description != nil {
+		webhook.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	if err := validate(webhook); err != nil {
+		return Webhook{}, err
+	}
+
+	webhook.UpdatedAt = time.Now().UTC()
+	if err := d.saveWebhook(webhook); err != nil {
+		return Webhook{}, err
+	}
+	if req.Secret == nil {
+		webhook = webhook.public()
+	}
+	return webhook, nil
+}
+
+// Delete removes a webhook; its pending deliveries fail when next tried
+func (d *Dispatcher) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.webhook(id); err != nil {
+		return err
+	}
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookBucket).Delete([]byte(id))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// Deliveries returns a page of the delivery log, newest first
+func (d *Dispatcher) Deliveries(req models.WebhookDeliveryListRequest) (*DeliveryPage, error) {
+	switch req.Status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryFailed:
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, delivered or failed", ErrInvalidWebhook)
+	}
+
+	offset, limit := req.Offset, req.Limit
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	matched := make([]Delivery, 0)
+	err := d.eachDelivery(func(delivery Delivery) {
+		switch {
+		case req.WebhookID != "" && delivery.WebhookID != req.WebhookID:
+		case req.Event != "" && delivery.Event != req.Event:
+		case req.Status != "" && delivery.Status != req.Status:
+		default:
+			matched = append(matched, delivery)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	page := &DeliveryPage{Deliveries: make([]Delivery, 0), Total: len(matched), Offset: offset, Limit: limit}
+	if offset < len(matched) {
+		page.Deliveries = matched[offset:min(offset+limit, len(matched))]
+	}
+	return page, nil
+}
+
+// webhook reads a webhook, secret included
+func (d *Dispatcher) webhook(id string) (Webhook, error) {
+	var webhook Webhook
+	err := d.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(webhookBucket).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrWebhookNotFound, id)
+		}
+		return json.Unmarshal(data, &webhook)
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func (d *Dispatcher) saveWebhook(webhook Webhook) error {
+	data, err := json.Marshal(webhook)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook: %w", err)
+	}
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookBucket).Put([]byte(webhook.ID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save webhook: %w", err)
+	}
+	return nil
+}
+
+// eachDelivery calls fn with every delivery in the log
+func (d *Dispatcher) eachDelivery(fn func(Delivery)) error {
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveryBucket).ForEach(func(_, v []byte) error {
+			var delivery Delivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			fn(delivery)
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// putDelivery writes a delivery in tx
+func putDelivery(tx *bolt.Tx, delivery Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to encode delivery: %w", err)
+	}
+	return tx.Bucket(deliveryBucket).Put([]byte(delivery.ID), data)
+}
+
+// validate checks a webhook's URL and events
+func validate(webhook Webhook) error {
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: url must be an http or https URL", ErrInvalidWebhook)
+	}
+	for _, pattern := range webhook.Events {
+		if !validEvent(pattern) {
+			return fmt.Errorf("%w: unknown event %q, expected one of %s, a prefix such as task.* or *",
+				ErrInvalidWebhook, pattern, strings.Join(events, ", "))
+		}
+	}
+	return nil
+}
+
+// validEvent reports whether pattern names an event or a group of them
+func validEvent(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	for _, event := range events {
+		if event == pattern || (wildcard && prefix != "" && strings.HasPrefix(event, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSecret generates a signing secret
+func newSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate webhook secret: %v", err))
+	}
+	return "whsec_" + hex.EncodeToString(secret)
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
+	"agent-workspace/backend/internal/auth"
 	"agent-workspace/backend/internal/browser"
 	"agent-workspace/backend/internal/mcp"
+	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/internal/ratelimit"
 	"agent-workspace/backend/internal/terminal"
+	"agent-workspace/backend/pkg/apierror"
 	"agent-workspace/backend/pkg/jsonrpc"
+	"agent-workspace/backend/pkg/logging"
 
 	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v3"
@@ -21,111 +28,222 @@ import (
 
 // A2AHandler handles A2A protocol WebSocket connections with JSON-RPC 2.0
 type A2AHandler struct {
-	clients      map[*websocket.Conn]bool
+	clients      map[*a2aClient]bool
 	broadcast    chan *jsonrpc.Response
-	register     chan *websocket.Conn
-	unregister   chan *websocket.Conn
+	unregister   chan *a2aClient
 	mu           sync.RWMutex
-	router       *jsonrpc.Router
 	mcpClient    *mcp.Client
 	browserMgr   *browser.Manager
 	terminalMgr  *terminal.Manager
+	memorySys    *memory.System
+	sessions     map[string]*a2aSession
+	sessionsMu   sync.Mutex
+	config       A2AConfig
+	tasks        A2ATaskRunner  // nil disables the tasks/* methods
+	rate         ratelimit.Rate // requests per connection
+	replay       *replayBuffer[*jsonrpc.Request] // recent notifications, for clients that reconnect
+	life         *hubLifecycle
+}
+
+// a2aClient is an A2A connection. Requests are answered from several
+// goroutines, so writes are serialized.
+type a2aClient struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	session *a2aSession
+	cardURL string // the URL the agent card advertises
+
+	topicsMu sync.Mutex
+	topics   map[string]bool       // topics the client subscribed to
+	outbox   chan *jsonrpc.Request // notifications waiting to be sent
+}
+
+// writeJSON sends v as a text message
+func (c *a2aClient) writeJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+// writeMessage sends a message of messageType
+func (c *a2aClient) writeMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(messageType, data)
 }
 
 // NewA2AHandler creates a new A2A WebSocket handler
-func NewA2AHandler(mcpClient *mcp.Client, browserMgr *browser.Manager, terminalMgr *terminal.Manager) *A2AHandler {
+func NewA2AHandler(mcpClient *mcp.Client, browserMgr *browser.Manager, terminalMgr *terminal.Manager, memorySys *memory.System) *A2AHandler {
 	h := &A2AHandler{
-		clients:      make(map[*websocket.Conn]bool),
+		clients:      make(map[*a2aClient]bool),
 		broadcast:    make(chan *jsonrpc.Response, 256),
-		register:     make(chan *websocket.Conn),
-		unregister:   make(chan *websocket.Conn),
-		router:       jsonrpc.NewRouter(),
+		unregister:   make(chan *a2aClient),
 		mcpClient:    mcpClient,
 		browserMgr:   browserMgr,
 		terminalMgr:  terminalMgr,
+		memorySys:    memorySys,
+		sessions:     make(map[string]*a2aSession),
+		config:       A2AConfigFromEnv(),
+		replay:       newReplayBuffer[*jsonrpc.Request](ReplayBufferFromEnv()),
+		life:         newHubLifecycle(),
 	}
 
-	// Register JSON-RPC methods
-	h.registerMethods()
-
 	// Start the hub
 	go h.run()
 
 	return h
 }
 
-// run handles the A2A WebSocket hub
+// run handles the A2A WebSocket hub until Stop
 func (h *A2AHandler) run() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
+	defer close(h.life.done)
 
 	for {
 		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			log.Printf("A2A client connected. Total clients: %d", len(h.clients))
+		case <-h.life.stop:
+			h.closeAll()
+			return
 
 		case client := <-h.unregister:
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				client.Close()
+				client.conn.Close()
 			}
 			h.mu.Unlock()
-			log.Printf("A2A client disconnected. Total clients: %d", len(h.clients))
+			slog.Info("A2A client disconnected", "clients", len(h.clients))
 
 		case response := <-h.broadcast:
-			h.mu.RLock()
+			h.mu.Lock()
 			for client := range h.clients {
-				if err := client.WriteJSON(response); err != nil {
-					log.Printf("Error broadcasting to A2A client: %v", err)
-					client.Close()
+				if err := client.writeJSON(response); err != nil {
+					slog.Warn("failed to broadcast to A2A client", "error", err)
+					client.conn.Close()
 					delete(h.clients, client)
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
 
 		case <-ticker.C:
 			// Send heartbeat
-			h.mu.RLock()
+			h.mu.Lock()
 			for client := range h.clients {
-				if err := client.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-					log.Printf("Error sending A2A heartbeat: %v", err)
-					client.Close()
+				if err := client.writeMessage(websocket.PingMessage, []byte{}); err != nil {
+					slog.Warn("failed to send A2A heartbeat", "error", err)
+					client.conn.Close()
 					delete(h.clients, client)
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
+		}
+	}
+}
+
+// closeAll tells every client the server is going away and stops reading
+// from them after drainTimeout; each connection closes once its running
+// requests finish
+func (h *A2AHandler) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notice := websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownReason)
+	for client := range h.clients {
+		client.conn.WriteControl(websocket.CloseMessage, notice, time.Now().Add(closeWriteTimeout))
+		client.conn.SetReadDeadline(time.Now().Add(drainTimeout))
+		delete(h.clients, client)
+	}
+}
+
+// Stop closes every connection, waits until ctx is done for their running
+// requests to finish, then closes the sessions' tabs
+func (h *A2AHandler) Stop(ctx context.Context) error {
+	err := h.life.shutdown(ctx)
+
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	for id, session := range h.sessions {
+		session.mu.Lock()
+		if session.idle != nil {
+			session.idle.Stop()
 		}
+		session.mu.Unlock()
+		session.close()
+		delete(h.sessions, id)
+	}
+	return err
+}
+
+// newRouter builds the JSON-RPC methods of one connection, bound to its session
+func (h *A2AHandler) newRouter(client *a2aClient) *jsonrpc.Router {
+	router := jsonrpc.NewRouter()
+	h.registerMethods(router, client)
+	h.registerSubscriptionMethods(router, client)
+	if h.memorySys != nil {
+		h.registerMemoryMethods(router, client.session)
 	}
+	if runner := h.taskRunner(); runner != nil {
+		h.registerTaskMethods(router, client.session, runner)
+	}
+	return router
 }
 
-// registerMethods registers JSON-RPC methods for browser automation
-func (h *A2AHandler) registerMethods() {
+// registerMethods registers JSON-RPC methods for browser automation and
+// terminal commands, run in the session's tab and working directory.
+// Screenshot methods take "binary": true to get the image as a binary
+// frame instead of base64.
+func (h *A2AHandler) registerMethods(router *jsonrpc.Router, client *a2aClient) {
+	session := client.session
+
+	// Session info - clients call "session/info" to learn their session ID
+	router.Register("session/info", func(params map[string]interface{}) (interface{}, error) {
+		return session.info(), nil
+	})
+
+	// Agent card - the same card /.well-known/agent.json serves
+	router.Register("agent/getAuthenticatedExtendedCard", func(params map[string]interface{}) (interface{}, error) {
+		return h.AgentCard(client.cardURL), nil
+	})
+
 	// Browser navigation - frontend calls "browser/navigate"
-	h.router.Register("browser/navigate", func(params map[string]interface{}) (interface{}, error) {
+	router.Register("browser/navigate", func(params map[string]interface{}) (interface{}, error) {
 		url, ok := params["url"].(string)
 		if !ok {
 			return nil, fmt.Errorf("url parameter required")
 		}
-		if err := h.browserMgr.Navigate(url); err != nil {
+		tab, err := session.browserTab(h.browserMgr)
+		if err != nil {
+			return nil, err
+		}
+		err = tab.Navigate(url)
+		session.record("browser", "navigate", params, nil, err)
+		if err != nil {
 			return nil, fmt.Errorf("navigation failed: %w", err)
 		}
+		h.notifySession(session, TopicBrowserNavigated, map[string]interface{}{
+			"session_id":  session.ID,
+			"url":         url,
+			"current_url": tab.GetCurrentURL(),
+		})
 		return map[string]interface{}{"success": true, "url": url}, nil
 	})
 
 	// Get DOM - frontend calls "browser/getDOM"
-	h.router.Register("browser/getDOM", func(params map[string]interface{}) (interface{}, error) {
+	router.Register("browser/getDOM", func(params map[string]interface{}) (interface{}, error) {
+		tab, err := session.browserTab(h.browserMgr)
+		if err != nil {
+			return nil, err
+		}
+
 		// Get page info
-		title, _ := h.browserMgr.GetPageTitle()
-		html, _ := h.browserMgr.GetPageHTML()
+		title, _ := tab.GetPageTitle()
+		html, _ := tab.GetPageHTML()
 		if len(html) > 5000 {
 			html = html[:5000]
 		}
-		elements := h.browserMgr.GetElements()
-		
+		elements := tab.GetElements()
+
 		// Convert elements to interface format
 		interfaceElements := make([]map[string]interface{}, 0, len(elements))
 		for _, elem := range elements {
@@ -135,44 +253,59 @@ func (h *A2AHandler) registerMethods() {
 				"text": elem.Text,
 			})
 		}
-		
+
+		result := map[string]interface{}{
+			"title":                title,
+			"current_url":          tab.GetCurrentURL(),
+			"html":                 html,
+			"interactive_elements": interfaceElements,
+			"element_count":        len(interfaceElements),
+			"screenshot":           "",
+		}
+
 		// Capture screenshot with numbered overlays
-		screenshot, err := h.browserMgr.GetScreenshotWithOverlays("")
-		var screenshotDataURL string
+		screenshot, err := tab.GetScreenshotWithOverlays("")
 		if err != nil {
-			log.Printf("[Browser] Screenshot error: %v", err)
+			slog.Warn("failed to capture screenshot", "session_id", session.ID, "error", err)
 		} else if len(screenshot) > 0 {
-			// Format as data URL for img src
-			screenshotDataURL = "data:image/png;base64," + base64.StdEncoding.EncodeToString(screenshot)
-			log.Printf("[Browser] Screenshot captured: %d bytes", len(screenshot))
+			slog.Debug("screenshot captured", "session_id", session.ID, "bytes", len(screenshot))
+			if binaryParam(params) {
+				attachment, err := client.attach("image/png", screenshot)
+				if err != nil {
+					return nil, err
+				}
+				result["screenshot_attachment"] = attachment
+			} else {
+				// Format as data URL for img src
+				result["screenshot"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(screenshot)
+			}
 		} else {
-			log.Printf("[Browser] Screenshot empty")
+			slog.Warn("screenshot empty", "session_id", session.ID)
 		}
-		
-		return map[string]interface{}{
-			"title":               title,
-			"current_url":         h.browserMgr.GetCurrentURL(),
-			"html":                html,
-			"interactive_elements": interfaceElements,
-			"element_count":       len(interfaceElements),
-			"screenshot":          screenshotDataURL,
-		}, nil
+
+		return result, nil
 	})
 
 	// Click element - frontend calls "browser/click"
-	h.router.Register("browser/click", func(params map[string]interface{}) (interface{}, error) {
+	router.Register("browser/click", func(params map[string]interface{}) (interface{}, error) {
 		selector, ok := params["selector"].(string)
 		if !ok {
 			return nil, fmt.Errorf("selector parameter required")
 		}
-		if err := h.browserMgr.ClickBySelector(selector); err != nil {
+		tab, err := session.browserTab(h.browserMgr)
+		if err != nil {
+			return nil, err
+		}
+		err = tab.ClickBySelector(selector)
+		session.record("browser", "click", params, nil, err)
+		if err != nil {
 			return nil, fmt.Errorf("click failed: %w", err)
 		}
 		return map[string]interface{}{"success": true, "selector": selector}, nil
 	})
 
 	// Type text - frontend calls "browser/type"
-	h.router.Register("browser/type", func(params map[string]interface{}) (interface{}, error) {
+	router.Register("browser/type", func(params map[string]interface{}) (interface{}, error) {
 		selector, ok := params["selector"].(string)
 		if !ok {
 			return nil, fmt.Errorf("selector parameter required")
@@ -181,19 +314,30 @@ func (h *A2AHandler) registerMethods() {
 		if !ok {
 			return nil, fmt.Errorf("text parameter required")
 		}
-		if err := h.browserMgr.TypeBySelector(selector, text); err != nil {
+		tab, err := session.browserTab(h.browserMgr)
+		if err != nil {
+			return nil, err
+		}
+		err = tab.TypeBySelector(selector, text)
+		session.record("browser", "type", params, nil, err)
+		if err != nil {
 			return nil, fmt.Errorf("type failed: %w", err)
 		}
 		return map[string]interface{}{"success": true}, nil
 	})
 
 	// Execute script - frontend calls "browser/executeScript"
-	h.router.Register("browser/executeScript", func(params map[string]interface{}) (interface{}, error) {
+	router.Register("browser/executeScript", func(params map[string]interface{}) (interface{}, error) {
 		script, ok := params["script"].(string)
 		if !ok {
 			return nil, fmt.Errorf("script parameter required")
 		}
-		result, err := h.browserMgr.ExecuteScript(script)
+		tab, err := session.browserTab(h.browserMgr)
+		if err != nil {
+			return nil, err
+		}
+		result, err := tab.ExecuteScript(script)
+		session.record("browser", "execute_script", params, result, err)
 		if err != nil {
 			return nil, fmt.Errorf("script execution failed: %w", err)
 		}
@@ -201,17 +345,32 @@ func (h *A2AHandler) registerMethods() {
 	})
 
 	// Take screenshot - frontend calls "browser/screenshot"
-	h.router.Register("browser/screenshot", func(params map[string]interface{}) (interface{}, error) {
-		screenshot, err := h.browserMgr.CaptureScreenshot("")
+	router.Register("browser/screenshot", func(params map[string]interface{}) (interface{}, error) {
+		tab, err := session.browserTab(h.browserMgr)
+		if err != nil {
+			return nil, err
+		}
+		screenshot, err := tab.CaptureScreenshot(session.TaskID)
 		if err != nil {
 			return nil, fmt.Errorf("screenshot failed: %w", err)
 		}
+		if binaryParam(params) {
+			attachment, err := client.attach("image/png", screenshot)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"success": true, "screenshot_attachment": attachment}, nil
+		}
 		return map[string]interface{}{"success": true, "screenshot": screenshot}, nil
 	})
 
 	// Get accessibility tree - frontend calls "browser/getAccessibilityTree"
-	h.router.Register("browser/getAccessibilityTree", func(params map[string]interface{}) (interface{}, error) {
-		elements := h.browserMgr.GetElements()
+	router.Register("browser/getAccessibilityTree", func(params map[string]interface{}) (interface{}, error) {
+		tab, err := session.browserTab(h.browserMgr)
+		if err != nil {
+			return nil, err
+		}
+		elements := tab.GetElements()
 		interfaceElements := make([]map[string]interface{}, 0, len(elements))
 		for _, elem := range elements {
 			interfaceElements = append(interfaceElements, map[string]interface{}{
@@ -224,39 +383,100 @@ func (h *A2AHandler) registerMethods() {
 	})
 
 	// Terminal methods - agent calls via A2A
-	
+
 	// Execute command - agent calls "terminal/execute"
-	h.router.Register("terminal/execute", func(params map[string]interface{}) (interface{}, error) {
+	router.Register("terminal/execute", func(params map[string]interface{}) (interface{}, error) {
 		command, ok := params["command"].(string)
 		if !ok {
 			return nil, fmt.Errorf("command parameter required")
 		}
-		
-		// Execute command directly with timeout
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		
-		cmd := exec.CommandContext(ctx, "bash", "-c", command)
-		output, err := cmd.CombinedOutput()
-		
-		exitCode := 0
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				exitCode = exitErr.ExitCode()
-			} else {
-				return nil, fmt.Errorf("command execution failed: %w", err)
-			}
-		}
-		
-		return map[string]interface{}{
-			"success":   exitCode == 0,
-			"output":    string(output),
-			"exit_code": exitCode,
-			"command":   command,
-		}, nil
+
+		result, err := h.executeCommand(session, command)
+		session.record("terminal", command, params, result, err)
+		return result, err
 	})
 }
 
+// executeCommand runs command in the session's working directory. The shell
+// writes the directory it ends in to a file, so a cd carries over to the
+// session's next command.
+func (h *A2AHandler) executeCommand(session *a2aSession, command string) (map[string]interface{}, error) {
+	dirFile, err := os.CreateTemp("", "a2a-cwd-*")
+	if err != nil {
+		return nil, fmt.Errorf("command execution failed: %w", err)
+	}
+	dirFile.Close()
+	defer os.Remove(dirFile.Name())
+
+	dir := session.workDir()
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir, _ = os.Getwd() // the directory was removed under the session
+	}
+
+	// Execute command directly with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, "bash", "-c", command+"\n__a2a_status=$?; pwd > \"$A2A_CWD_FILE\"; exit $__a2a_status")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "A2A_CWD_FILE="+dirFile.Name())
+
+	// Stream output to subscribers while the command runs
+	stream := &outputNotifier{publish: func(chunk string) {
+		h.notifySession(session, TopicTerminalOutput, map[string]interface{}{
+			"session_id": session.ID,
+			"command":    command,
+			"output":     chunk,
+		})
+	}}
+	cmd.Stdout = stream
+	cmd.Stderr = stream
+	err = cmd.Run()
+	output := stream.Bytes()
+
+	if cwd, readErr := os.ReadFile(dirFile.Name()); readErr == nil && len(cwd) > 0 {
+		dir = strings.TrimSpace(string(cwd))
+	}
+	session.setWorkDir(dir)
+
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	// Record the command so the watchdog sees what agents run
+	entry := terminal.CommandEntry{
+		Command:   command,
+		Output:    string(output),
+		ExitCode:  exitCode,
+		Source:    "ai",
+		StartTime: start,
+		EndTime:   time.Now(),
+		SessionID: "a2a:" + session.ID,
+	}
+	entry.Duration = entry.EndTime.Sub(start)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	h.terminalMgr.History().Add(entry)
+
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, fmt.Errorf("command execution failed: %w", err)
+	}
+
+	return map[string]interface{}{
+		"success":   exitCode == 0,
+		"output":    string(output),
+		"exit_code": exitCode,
+		"command":   command,
+		"cwd":       dir,
+	}, nil
+}
+
 var a2aUpgrader = websocket.FastHTTPUpgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -265,46 +485,177 @@ var a2aUpgrader = websocket.FastHTTPUpgrader{
 	},
 }
 
-// HandleWebSocket handles A2A WebSocket upgrade and messages
+// a2aMethodScope returns the scope a JSON-RPC method needs
+func a2aMethodScope(method string) string {
+	switch {
+	case method == "browser/executeScript":
+		return auth.ScopeExecute
+	case strings.HasPrefix(method, "browser/"):
+		return auth.ScopeBrowse
+	case strings.HasPrefix(method, "session/"), strings.HasPrefix(method, "agent/"), method == "subscribe", method == "unsubscribe", method == "resume",
+		method == "memory/query", method == "memory/tasks", method == "memory/task", method == "tasks/get":
+		return auth.ScopeRead
+	default:
+		return auth.ScopeExecute
+	}
+}
+
+// HandleWebSocket handles A2A WebSocket upgrade and messages. Each method
+// is checked against the scope the connection authenticated with. Clients
+// pass ?session_id= to resume their session and ?workspace= to scope its
+// memory; without a session ID they get a new session. Clients call
+// subscribe to be notified of task progress, navigation and terminal output.
 func (h *A2AHandler) HandleWebSocket(c fiber.Ctx) error {
-	return a2aUpgrader.Upgrade(c.RequestCtx(), func(conn *websocket.Conn) {
+	if !h.life.join() {
+		return apierror.Send(c, 503, shutdownReason)
+	}
+
+	principal := auth.FromContext(c)
+	owner := ""
+	if principal != nil {
+		owner = principal.Name
+	}
+
+	session, err := h.acquireSession(c.Query("session_id"), owner, c.Query("workspace"))
+	if err != nil {
+		h.life.leave()
+		return apierror.Send(c, 400, err.Error())
+	}
+	client := &a2aClient{
+		session: session,
+		cardURL: WebSocketURL(c, c.Path()),
+		topics:  make(map[string]bool),
+		outbox:  make(chan *jsonrpc.Request, a2aOutboxSize),
+	}
+	router := h.newRouter(client)
+	limit := ratelimit.NewBucket("a2a", h.rateLimit())
+
+	err = a2aUpgrader.Upgrade(c.RequestCtx(), func(conn *websocket.Conn) {
+		client.conn = conn
+		dispatcher := newA2ADispatcher(h.dispatchConfig())
+		done := make(chan struct{})
 		defer func() {
-			h.unregister <- conn
+			select {
+			case h.unregister <- client:
+			case <-h.life.done:
+			}
 			conn.Close()
+			// Requests still running finish before the session is let go
+			dispatcher.wait()
+			close(done)
+			h.releaseSession(session)
+			h.life.leave()
 		}()
 
 		// Register client
-		h.register <- conn
+		if !h.addClient(client) {
+			return
+		}
+		go client.writeNotifications(done)
+
+		// Tell the client which session it's in, so it can reconnect to it
+		// and resume its notifications
+		opened := session.info()
+		opened["epoch"] = h.replay.epoch
+		if err := client.writeJSON(jsonrpc.NewNotification("session/opened", opened)); err != nil {
+			return
+		}
+
+		// respond sends a response; a failed write closes the connection,
+		// which ends the read loop
+		respond := func(response *jsonrpc.Response) {
+			// Don't send response for notifications
+			if response == nil {
+				return
+			}
+			if err := client.writeJSON(response); err != nil {
+				// The server closing during shutdown isn't an error
+				if err != websocket.ErrCloseSent {
+					slog.Warn("failed to send A2A response", "session_id", session.ID, "error", err)
+				}
+				conn.Close()
+			}
+		}
 
-		// Handle messages
+		// Handle messages. Requests run concurrently, so responses can
+		// arrive out of order; clients match them up by ID.
 		for {
 			var req jsonrpc.Request
 			if err := conn.ReadJSON(&req); err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("A2A WebSocket error: %v", err)
+					slog.Warn("A2A WebSocket error", "session_id", session.ID, "error", err)
 				}
 				break
 			}
 
-			// Handle JSON-RPC request using router
-			response := h.router.Handle(&req)
-			
-			// Don't send response for notifications
-			if response == nil {
+			if ok, wait := limit.Allow(); !ok {
+				if !req.IsNotification() {
+					respond(jsonrpc.NewErrorResponse(req.ID, jsonrpc.RateLimited, "rate limit exceeded", map[string]interface{}{"retry_after_ms": wait.Milliseconds()}))
+				}
 				continue
 			}
 
-			// Send response
-			if err := conn.WriteJSON(response); err != nil {
-				log.Printf("Error sending A2A response: %v", err)
-				break
+			if scope := a2aMethodScope(req.Method); !principal.Allows(scope) {
+				respond(jsonrpc.NewErrorResponse(req.ID, jsonrpc.Forbidden, fmt.Sprintf("%s needs the %s scope", req.Method, scope), nil))
+				continue
+			}
+
+			// Handle JSON-RPC request using router, logging each under a
+			// request ID of its own
+			accepted := dispatcher.dispatch(req.Method, func() {
+				start := time.Now()
+				response := router.Handle(&req)
+				logA2ARequest(session.ID, &req, response, time.Since(start))
+				respond(response)
+			})
+			if !accepted && !req.IsNotification() {
+				respond(jsonrpc.NewErrorResponse(req.ID, jsonrpc.ServerBusy, "server busy: too many requests in flight on this connection", nil))
 			}
 		}
 	})
+	if err != nil {
+		// The handshake failed, so the connection never started
+		h.releaseSession(session)
+		h.life.leave()
+	}
+	return err
+}
+
+// addClient registers a connection, or reports false once the hub is
+// stopping. It's added under the lock notify holds, so resume sees every
+// notification either as missed or as queued for it.
+func (h *A2AHandler) addClient(client *a2aClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.life.stop:
+		return false
+	default:
+	}
+	h.clients[client] = true
+	slog.Info("A2A client connected", "clients", len(h.clients))
+	return true
+}
+
+// logA2ARequest logs a handled JSON-RPC request, at warn when it failed
+func logA2ARequest(sessionID string, req *jsonrpc.Request, response *jsonrpc.Response, duration time.Duration) {
+	level := slog.LevelDebug
+	attrs := []slog.Attr{
+		slog.String("request_id", logging.NewRequestID()),
+		slog.String("session_id", sessionID),
+		slog.String("method", req.Method),
+		slog.Int64("duration_ms", duration.Milliseconds()),
+	}
+	if response != nil && response.Error != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Int("code", response.Error.Code), slog.String("error", response.Error.Message))
+	}
+	slog.Default().LogAttrs(context.Background(), level, "a2a request", attrs...)
 }
 
 // HandleA2AWebSocket creates and returns an A2A WebSocket handler
-func HandleA2AWebSocket(mcpClient *mcp.Client, browserMgr *browser.Manager, terminalMgr *terminal.Manager) fiber.Handler {
-	handler := NewA2AHandler(mcpClient, browserMgr, terminalMgr)
+func HandleA2AWebSocket(mcpClient *mcp.Client, browserMgr *browser.Manager, terminalMgr *terminal.Manager, memorySys *memory.System) fiber.Handler {
+	handler := NewA2AHandler(mcpClient, browserMgr, terminalMgr, memorySys)
 	return handler.HandleWebSocket
 }
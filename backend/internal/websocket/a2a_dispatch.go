@@ -0,0 +1,169 @@
+package websocket
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"agent-workspace/backend/internal/ratelimit"
+	"agent-workspace/backend/pkg/metrics"
+)
+
+// a2aRequestsRejected counts A2A requests turned away because a
+// connection's queue was full
+var a2aRequestsRejected = metrics.NewCounterVec("a2a_requests_rejected_total",
+	"A2A requests rejected because the connection's queue was full", "method")
+
+// A2AConfig bounds how much work one A2A connection can have in flight
+type A2AConfig struct {
+	Workers      int            // requests a connection runs at once
+	QueueSize    int            // requests waiting for a worker before new ones are rejected as busy
+	MethodLimits map[string]int // method or "prefix/" -> requests of it a connection runs at once
+}
+
+// DefaultA2AConfig runs four requests per connection with 32 more queued.
+// A tab does one thing at a time, so browser methods run one at a time.
+func DefaultA2AConfig() A2AConfig {
+	return A2AConfig{
+		Workers:   4,
+		QueueSize: 32,
+		MethodLimits: map[string]int{
+			"browser/":  1,
+			"terminal/": 2,
+		},
+	}
+}
+
+// A2AConfigFromEnv reads A2A_WORKERS, A2A_QUEUE_SIZE and A2A_METHOD_LIMITS,
+// a comma-separated list of method=limit pairs such as "browser/=1,memory/query=4"
+func A2AConfigFromEnv() A2AConfig {
+	config := DefaultA2AConfig()
+	if workers, err := strconv.Atoi(os.Getenv("A2A_WORKERS")); err == nil && workers > 0 {
+		config.Workers = workers
+	}
+	if size, err := strconv.Atoi(os.Getenv("A2A_QUEUE_SIZE")); err == nil && size >= 0 {
+		config.QueueSize = size
+	}
+
+	if value := os.Getenv("A2A_METHOD_LIMITS"); value != "" {
+		config.MethodLimits = make(map[string]int)
+		for _, pair := range strings.Split(value, ",") {
+			method, limit, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			n, err := strconv.Atoi(strings.TrimSpace(limit))
+			if !ok || err != nil || n <= 0 || strings.TrimSpace(method) == "" {
+				slog.Warn("ignoring invalid A2A method limit", "limit", pair)
+				continue
+			}
+			config.MethodLimits[strings.TrimSpace(method)] = n
+		}
+	}
+	return config
+}
+
+// SetConfig sets how connections opened after it run their requests
+func (h *A2AHandler) SetConfig(config A2AConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.config = config
+}
+
+// dispatchConfig returns how connections run their requests
+func (h *A2AHandler) dispatchConfig() A2AConfig {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.config
+}
+
+// SetRateLimit limits the requests each connection opened after it can send
+func (h *A2AHandler) SetRateLimit(rate ratelimit.Rate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rate = rate
+}
+
+// rateLimit returns the per-connection request rate
+func (h *A2AHandler) rateLimit() ratelimit.Rate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.rate
+}
+
+// a2aDispatcher runs one connection's requests concurrently. A request is
+// admitted while fewer than Workers+QueueSize are in flight, waits for its
+// method's limit, then for a worker; admission never blocks the read loop.
+type a2aDispatcher struct {
+	admitted chan struct{}
+	workers  chan struct{}
+	limits   map[string]chan struct{}
+	prefixes []string // keys of limits, longest first
+	wg       sync.WaitGroup
+}
+
+func newA2ADispatcher(config A2AConfig) *a2aDispatcher {
+	workers := max(config.Workers, 1)
+	d := &a2aDispatcher{
+		admitted: make(chan struct{}, workers+max(config.QueueSize, 0)),
+		workers:  make(chan struct{}, workers),
+		limits:   make(map[string]chan struct{}, len(config.MethodLimits)),
+	}
+	for method, limit := range config.MethodLimits {
+		d.limits[method] = make(chan struct{}, limit)
+		d.prefixes = append(d.prefixes, method)
+	}
+	sort.Slice(d.prefixes, func(i, j int) bool {
+		return len(d.prefixes[i]) > len(d.prefixes[j])
+	})
+	return d
+}
+
+// limit returns the semaphore of the most specific limit covering method,
+// or nil when it has none
+func (d *a2aDispatcher) limit(method string) chan struct{} {
+	for _, prefix := range d.prefixes {
+		if method == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(method, prefix)) {
+			return d.limits[prefix]
+		}
+	}
+	return nil
+}
+
+// dispatch runs handle in the background, or reports false when the
+// connection already has as many requests as it may queue
+func (d *a2aDispatcher) dispatch(method string, handle func()) bool {
+	select {
+	case d.admitted <- struct{}{}:
+	default:
+		a2aRequestsRejected.Inc(method)
+		return false
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer func() { <-d.admitted }()
+
+		// Wait for the method's limit first so a queued browser call
+		// doesn't hold a worker other methods could use
+		if sem := d.limit(method); sem != nil {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+		}
+		d.workers <- struct{}{}
+		defer func() { <-d.workers }()
+
+		handle()
+	}()
+	return true
+}
+
+// wait blocks until every dispatched request has finished
+func (d *a2aDispatcher) wait() {
+	d.wg.Wait()
+}
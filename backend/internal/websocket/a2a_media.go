@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"fmt"
+
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+)
+
+// binaryParam reports whether a request asked for attachments as binary
+// frames rather than base64 inside the JSON result
+func binaryParam(params map[string]interface{}) bool {
+	binary, _ := params["binary"].(bool)
+	return binary
+}
+
+// attach sends data to the client as a binary frame and returns the
+// metadata a result refers to it by. The frame is the attachment ID, a
+// newline, then the data; it's sent before the response that refers to
+// it, so clients can hold frames by ID until the response arrives.
+func (c *a2aClient) attach(contentType string, data []byte) (map[string]interface{}, error) {
+	id := uuid.New().String()
+	frame := make([]byte, 0, len(id)+1+len(data))
+	frame = append(frame, id...)
+	frame = append(frame, '\n')
+	frame = append(frame, data...)
+
+	if err := c.writeMessage(websocket.BinaryMessage, frame); err != nil {
+		return nil, fmt.Errorf("failed to send attachment: %w", err)
+	}
+	return map[string]interface{}{
+		"attachment_id": id,
+		"content_type":  contentType,
+		"size":          len(data),
+	}, nil
+}
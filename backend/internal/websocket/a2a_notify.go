@@ -0,0 +1,273 @@
+package websocket
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"agent-workspace/backend/pkg/jsonrpc"
+	"agent-workspace/backend/pkg/metrics"
+)
+
+// Notification topics clients can subscribe to
+const (
+	TopicTaskProgress     = "task/progress"     // an action was added to a session's task
+	TopicBrowserNavigated = "browser/navigated" // a session's tab loaded a new page
+	TopicTerminalOutput   = "terminal/output"   // output of a running terminal/execute
+)
+
+// a2aTopics are the topics subscribe accepts
+var a2aTopics = []string{TopicTaskProgress, TopicBrowserNavigated, TopicTerminalOutput}
+
+// a2aOutboxSize is how many notifications a connection buffers before
+// dropping them; responses are never dropped
+const a2aOutboxSize = 64
+
+// a2aNotificationsDropped counts notifications a slow client missed
+var a2aNotificationsDropped = metrics.NewCounterVec("a2a_notifications_dropped_total",
+	"A2A notifications dropped because the client's outbox was full", "topic")
+
+// subscribed reports whether the client wants notifications on topic
+func (c *a2aClient) subscribed(topic string) bool {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+	return c.topics[topic]
+}
+
+// subscriptions returns the client's topics, sorted
+func (c *a2aClient) subscriptions() []string {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// notify queues a notification without waiting on the connection, so a
+// slow client can't hold up the code publishing it
+func (c *a2aClient) notify(notification *jsonrpc.Request) {
+	select {
+	case c.outbox <- notification:
+	default:
+		a2aNotificationsDropped.Inc(notification.Method)
+	}
+}
+
+// writeNotifications sends queued notifications until done is closed
+func (c *a2aClient) writeNotifications(done <-chan struct{}) {
+	for {
+		select {
+		case notification := <-c.outbox:
+			if err := c.writeJSON(notification); err != nil {
+				slog.Warn("failed to send A2A notification", "error", err)
+				c.conn.Close()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Notify pushes a notification on topic to every client subscribed to it
+func (h *A2AHandler) Notify(topic string, params map[string]interface{}) {
+	h.notify("", topic, params)
+}
+
+// notifySession pushes a notification on topic to the subscribed clients
+// connected to a session
+func (h *A2AHandler) notifySession(session *a2aSession, topic string, params map[string]interface{}) {
+	h.notify(session.ID, topic, params)
+}
+
+// notify pushes a notification to subscribed clients, all of them when
+// sessionID is empty. Each topic numbers its notifications with a seq
+// param, and the last few are kept for resume.
+func (h *A2AHandler) notify(sessionID, topic string, params map[string]interface{}) {
+	// Numbered under the write lock, so resume sees each notification
+	// either as missed or as queued for the client, never both
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notification := h.replay.add(topic, sessionID, func(seq uint64) *jsonrpc.Request {
+		numbered := make(map[string]interface{}, len(params)+1)
+		for key, value := range params {
+			numbered[key] = value
+		}
+		numbered["seq"] = seq
+		return jsonrpc.NewNotification(topic, numbered)
+	})
+	for client := range h.clients {
+		if sessionID != "" && client.session.ID != sessionID {
+			continue
+		}
+		if client.subscribed(topic) {
+			client.notify(notification)
+		}
+	}
+}
+
+// lastSeqs returns the last notification's seq on each topic
+func (h *A2AHandler) lastSeqs(topics []string) map[string]uint64 {
+	seqs := make(map[string]uint64, len(topics))
+	for _, topic := range topics {
+		seqs[topic] = h.replay.last(topic)
+	}
+	return seqs
+}
+
+// resume subscribes a reconnecting client to the topics in lastSeqs and
+// returns the notifications for its session it missed on each, those
+// numbered after the seq it last saw. Later ones are queued as usual.
+func (h *A2AHandler) resume(client *a2aClient, lastSeqs map[string]uint64, epoch string) map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Seqs from before a restart mean nothing now
+	restarted := epoch != "" && epoch != h.replay.epoch
+	topics := make([]string, 0, len(lastSeqs))
+	for topic := range lastSeqs {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	missed := make([]*jsonrpc.Request, 0)
+	complete := !restarted
+	client.topicsMu.Lock()
+	for _, topic := range topics {
+		after := lastSeqs[topic]
+		if restarted {
+			after = 0
+		}
+		notifications, kept := h.replay.since(topic, client.session.ID, after, h.replay.last(topic))
+		missed = append(missed, notifications...)
+		complete = complete && kept
+		client.topics[topic] = true
+	}
+	client.topicsMu.Unlock()
+
+	return map[string]interface{}{
+		"topics":        client.subscriptions(),
+		"notifications": missed,
+		"complete":      complete,
+		"seq":           h.lastSeqs(topics),
+		"epoch":         h.replay.epoch,
+	}
+}
+
+// registerSubscriptionMethods registers subscribe and unsubscribe, which
+// manage the topics a connection is notified on
+func (h *A2AHandler) registerSubscriptionMethods(router *jsonrpc.Router, client *a2aClient) {
+	// Subscribe - clients call "subscribe" with {"topics": [...]}
+	router.Register("subscribe", func(params map[string]interface{}) (interface{}, error) {
+		topics, err := topicsParam(params)
+		if err != nil {
+			return nil, err
+		}
+		client.topicsMu.Lock()
+		for _, topic := range topics {
+			client.topics[topic] = true
+		}
+		client.topicsMu.Unlock()
+		// A client resumes from the seq it last saw, starting here
+		return map[string]interface{}{"topics": client.subscriptions(), "seq": h.lastSeqs(topics)}, nil
+	})
+
+	// Resume - a reconnecting client calls "resume" with
+	// {"last_seq": {topic: seq, ...}, "epoch": "..."} to subscribe again and
+	// get the notifications it missed
+	router.Register("resume", func(params map[string]interface{}) (interface{}, error) {
+		raw, ok := params["last_seq"].(map[string]interface{})
+		if !ok || len(raw) == 0 {
+			return nil, fmt.Errorf("last_seq parameter required, a map of topic to seq")
+		}
+		topicList := make([]interface{}, 0, len(raw))
+		for topic := range raw {
+			topicList = append(topicList, topic)
+		}
+		topics, err := topicsParam(map[string]interface{}{"topics": topicList})
+		if err != nil {
+			return nil, err
+		}
+		lastSeqs := make(map[string]uint64, len(topics))
+		for _, topic := range topics {
+			seq, ok := seqParam(raw[topic])
+			if !ok {
+				return nil, fmt.Errorf("last_seq for %s must be a non-negative integer", topic)
+			}
+			lastSeqs[topic] = seq
+		}
+		epoch, _ := params["epoch"].(string)
+		return h.resume(client, lastSeqs, epoch), nil
+	})
+
+	// Unsubscribe - clients call "unsubscribe" with {"topics": [...]}
+	router.Register("unsubscribe", func(params map[string]interface{}) (interface{}, error) {
+		topics, err := topicsParam(params)
+		if err != nil {
+			return nil, err
+		}
+		client.topicsMu.Lock()
+		for _, topic := range topics {
+			delete(client.topics, topic)
+		}
+		client.topicsMu.Unlock()
+		return map[string]interface{}{"topics": client.subscriptions()}, nil
+	})
+}
+
+// topicsParam reads the "topics" param, rejecting unknown topics
+func topicsParam(params map[string]interface{}) ([]string, error) {
+	raw, ok := params["topics"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, fmt.Errorf("topics parameter required, any of %v", a2aTopics)
+	}
+
+	topics := make([]string, 0, len(raw))
+	for _, value := range raw {
+		topic, _ := value.(string)
+		known := false
+		for _, t := range a2aTopics {
+			if t == topic {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown topic %v, expected any of %v", value, a2aTopics)
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
+
+// outputNotifier collects a command's output and publishes each chunk as
+// it's written as terminal/output
+type outputNotifier struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	publish func(chunk string)
+}
+
+// Write records p and publishes it
+func (w *outputNotifier) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	w.publish(string(p))
+	return len(p), nil
+}
+
+// Bytes returns everything written so far
+func (w *outputNotifier) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Bytes()
+}
@@ -0,0 +1,226 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/internal/browser"
+	"agent-workspace/backend/internal/memory"
+
+	"github.com/google/uuid"
+)
+
+// a2aSessionIdle is how long a session outlives its last connection, so a
+// client that reconnects with its session ID resumes its tab and directory
+const a2aSessionIdle = 5 * time.Minute
+
+// a2aSessionIDPattern keeps client-chosen session IDs short and printable
+var a2aSessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// a2aSession is the state one A2A client owns: a browser tab, the working
+// directory its terminal commands run in and a task memory recording what
+// it did. Two windows or agents with different sessions don't see each
+// other's navigation; connections that share a session ID share its state.
+type a2aSession struct {
+	ID        string
+	Owner     string // the principal that opened it; others can't join
+	Workspace string
+	TaskID    string
+	CreatedAt time.Time
+
+	task   *memory.TaskMemory // nil without a memory system
+	notify func(topic string, params map[string]interface{})
+	mu     sync.Mutex
+	tab    *browser.Manager // opened by the first browser method
+	dir    string
+	conns  int
+	idle   *time.Timer
+}
+
+// browserTab returns the session's tab, opening it in browserMgr's browser
+// the first time
+func (s *a2aSession) browserTab(browserMgr *browser.Manager) (*browser.Manager, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tab == nil {
+		tab, err := browserMgr.NewTab()
+		if err != nil {
+			return nil, err
+		}
+		tab.SetTask(s.TaskID)
+		s.tab = tab
+	}
+	return s.tab, nil
+}
+
+// workDir returns the directory the session's next command runs in
+func (s *a2aSession) workDir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dir
+}
+
+// setWorkDir moves the session to dir, where a command left its shell
+func (s *a2aSession) setWorkDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+}
+
+// record adds an action to the session's task memory and notifies the
+// session's clients of the task's progress
+func (s *a2aSession) record(actionType, command string, params map[string]interface{}, result interface{}, err error) {
+	errText := ""
+	if err != nil {
+		errText = err.Error()
+	}
+
+	progress := map[string]interface{}{
+		"session_id": s.ID,
+		"task_id":    s.TaskID,
+		"type":       actionType,
+		"command":    command,
+		"success":    err == nil,
+		"error":      errText,
+	}
+	if s.task != nil {
+		progress["action_id"] = s.task.AddAction(actionType, command, params, result, err == nil, errText)
+		progress["actions"] = len(s.task.GetActions())
+	}
+	if s.notify != nil {
+		s.notify(TopicTaskProgress, progress)
+	}
+}
+
+// memoryContext scopes a memory call to the workspace named by the
+// "workspace" param, or the session's
+func (s *a2aSession) memoryContext(params map[string]interface{}) context.Context {
+	if workspace, ok := params["workspace"].(string); ok && workspace != "" {
+		return memory.WithWorkspace(context.Background(), workspace)
+	}
+	return memory.WithWorkspace(context.Background(), s.Workspace)
+}
+
+// info describes the session to its client
+func (s *a2aSession) info() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	currentURL := ""
+	if s.tab != nil {
+		currentURL = s.tab.GetCurrentURL()
+	}
+	return map[string]interface{}{
+		"session_id":  s.ID,
+		"workspace":   s.Workspace,
+		"task_id":     s.TaskID,
+		"cwd":         s.dir,
+		"current_url": currentURL,
+		"connections": s.conns,
+		"created_at":  s.CreatedAt,
+	}
+}
+
+// close closes the session's tab
+func (s *a2aSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tab != nil {
+		s.tab.Cleanup()
+		s.tab = nil
+	}
+}
+
+// acquireSession joins the session with id, creating it when it doesn't
+// exist; an empty id creates a fresh session
+func (h *A2AHandler) acquireSession(id, owner, workspace string) (*a2aSession, error) {
+	if id == "" {
+		id = uuid.New().String()
+	} else if !a2aSessionIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid session ID %q", id)
+	}
+	if workspace == "" {
+		workspace = memory.DefaultWorkspace
+	} else if err := memory.ValidateWorkspace(workspace); err != nil {
+		return nil, err
+	}
+
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	session, ok := h.sessions[id]
+	if ok {
+		if session.Owner != owner {
+			return nil, fmt.Errorf("session %s belongs to another client", id)
+		}
+		if session.Workspace != workspace {
+			return nil, fmt.Errorf("session %s is in workspace %s", id, session.Workspace)
+		}
+	} else {
+		dir, _ := os.Getwd()
+		session = &a2aSession{
+			ID:        id,
+			Owner:     owner,
+			Workspace: workspace,
+			TaskID:    "a2a_" + id,
+			CreatedAt: time.Now(),
+			dir:       dir,
+		}
+		session.notify = func(topic string, params map[string]interface{}) {
+			h.notifySession(session, topic, params)
+		}
+		if h.memorySys != nil {
+			task, err := h.memorySys.ShortTerm.GetOrCreateTaskIn(workspace, session.TaskID)
+			if err != nil {
+				return nil, err
+			}
+			session.task = task
+		}
+		h.sessions[id] = session
+		slog.Info("A2A session opened", "session_id", id, "workspace", workspace)
+	}
+
+	session.mu.Lock()
+	session.conns++
+	if session.idle != nil {
+		session.idle.Stop()
+		session.idle = nil
+	}
+	session.mu.Unlock()
+	return session, nil
+}
+
+// releaseSession leaves a session; the last connection to leave starts its
+// idle timer
+func (h *A2AHandler) releaseSession(session *a2aSession) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.conns--
+	if session.conns > 0 {
+		return
+	}
+	session.idle = time.AfterFunc(a2aSessionIdle, func() {
+		h.sessionsMu.Lock()
+		defer h.sessionsMu.Unlock()
+
+		// A client may have rejoined while the timer fired
+		session.mu.Lock()
+		active := session.conns > 0
+		session.mu.Unlock()
+		if active || h.sessions[session.ID] != session {
+			return
+		}
+
+		delete(h.sessions, session.ID)
+		session.close()
+		slog.Info("A2A session closed", "session_id", session.ID, "idle", a2aSessionIdle)
+	})
+}
@@ -0,0 +1,212 @@
+package websocket
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/jsonrpc"
+	"agent-workspace/backend/pkg/models"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Agent card details served at /.well-known/agent.json
+const (
+	a2aAgentName        = "Agentic Self-Evolving Command Center"
+	a2aAgentDescription = "Browser, terminal and memory automation with a planning agent that runs delegated tasks"
+	a2aAgentVersion     = "1.0.0"
+)
+
+// A2A task states, as the protocol names them
+const (
+	a2aTaskWorking   = "working"
+	a2aTaskCompleted = "completed"
+	a2aTaskCanceled  = "canceled"
+	a2aTaskFailed    = "failed"
+	a2aTaskUnknown   = "unknown"
+)
+
+// A2ATaskRunner runs tasks other agents delegate; the agent controller is one
+type A2ATaskRunner interface {
+	ExecuteCommand(req models.CommandRequest) (string, error)
+	GetTask(taskID string) (*models.Task, error)
+	CancelTask(taskID string) (string, error)
+}
+
+// SetTaskRunner enables the tasks/* methods on connections opened after it
+func (h *A2AHandler) SetTaskRunner(runner A2ATaskRunner) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tasks = runner
+}
+
+// taskRunner returns the task runner, or nil when tasks are disabled
+func (h *A2AHandler) taskRunner() A2ATaskRunner {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.tasks
+}
+
+// AgentCard describes this server to A2A clients connecting at url
+func (h *A2AHandler) AgentCard(url string) models.AgentCard {
+	skills := []models.Skill{
+		{Name: "browser", Description: "Navigate, read, click, type and take screenshots in a session's browser tab (browser/*)"},
+		{Name: "terminal", Description: "Run shell commands in a session's working directory (terminal/execute)"},
+	}
+	if h.memorySys != nil {
+		skills = append(skills, models.Skill{Name: "memory", Description: "Store, query and rate long-term memory (memory/*)"})
+	}
+	if h.taskRunner() != nil {
+		skills = append(skills, models.Skill{Name: "tasks", Description: "Delegate a goal for the agent to plan and run, then follow or cancel it (tasks/send, tasks/get, tasks/cancel)"})
+	}
+
+	return models.AgentCard{
+		Name:        a2aAgentName,
+		Description: a2aAgentDescription,
+		Version:     a2aAgentVersion,
+		Capabilities: map[string]bool{
+			"streaming":              true, // subscribe pushes notifications
+			"pushNotifications":      false,
+			"stateTransitionHistory": false,
+			"binaryAttachments":      true,
+		},
+		Skills:    skills,
+		URL:       url,
+		Transport: "jsonrpc-websocket",
+	}
+}
+
+// WebSocketURL returns the ws:// or wss:// URL of path on the server a
+// request reached
+func WebSocketURL(c fiber.Ctx, path string) string {
+	scheme := "ws"
+	if c.Scheme() == "https" {
+		scheme = "wss"
+	}
+	return scheme + "://" + c.Host() + path
+}
+
+// registerTaskMethods exposes the agent's tasks as A2A tasks/send, tasks/get
+// and tasks/cancel. The server assigns task IDs; tasks/send returns it.
+func (h *A2AHandler) registerTaskMethods(router *jsonrpc.Router, session *a2aSession, runner A2ATaskRunner) {
+	// Delegate a task - agent calls "tasks/send" with an A2A message
+	router.Register("tasks/send", func(params map[string]interface{}) (interface{}, error) {
+		goal := messageText(params["message"])
+		if goal == "" {
+			return nil, fmt.Errorf("message with a text part required")
+		}
+		metadata, _ := params["metadata"].(map[string]interface{})
+
+		taskID, err := runner.ExecuteCommand(models.CommandRequest{SessionID: session.ID, Command: goal, Context: metadata})
+		if err != nil {
+			return nil, err
+		}
+		task, err := runner.GetTask(taskID)
+		if err != nil {
+			return nil, err
+		}
+		return a2aTask(task, session.ID), nil
+	})
+
+	// Task status - agent calls "tasks/get"
+	router.Register("tasks/get", func(params map[string]interface{}) (interface{}, error) {
+		taskID, ok := params["id"].(string)
+		if !ok {
+			return nil, fmt.Errorf("id parameter required")
+		}
+		task, err := runner.GetTask(taskID)
+		if err != nil {
+			return nil, err
+		}
+		return a2aTask(task, session.ID), nil
+	})
+
+	// Cancel a task - agent calls "tasks/cancel"
+	router.Register("tasks/cancel", func(params map[string]interface{}) (interface{}, error) {
+		taskID, ok := params["id"].(string)
+		if !ok {
+			return nil, fmt.Errorf("id parameter required")
+		}
+		if _, err := runner.CancelTask(taskID); err != nil {
+			return nil, err
+		}
+		task, err := runner.GetTask(taskID)
+		if err != nil {
+			return nil, err
+		}
+		return a2aTask(task, session.ID), nil
+	})
+}
+
+// a2aTask renders a task the way A2A clients expect it. A task being
+// cancelled reports working until its current step returns.
+func a2aTask(task *models.Task, sessionID string) map[string]interface{} {
+	timestamp := task.CreatedAt
+	if task.CompletedAt != nil {
+		timestamp = *task.CompletedAt
+	}
+	status := map[string]interface{}{
+		"state":     a2aTaskState(task.Status),
+		"timestamp": timestamp.Format(time.RFC3339),
+	}
+	if task.Error != "" {
+		status["message"] = a2aMessage("agent", task.Error)
+	}
+
+	return map[string]interface{}{
+		"id":        task.ID,
+		"sessionId": sessionID,
+		"status":    status,
+		"history":   []interface{}{a2aMessage("user", task.Goal)},
+		"metadata": map[string]interface{}{
+			"steps":  task.Steps,
+			"resume": task.Resume,
+		},
+	}
+}
+
+// a2aTaskState maps a task's status to its A2A state
+func a2aTaskState(status string) string {
+	switch status {
+	case "running":
+		return a2aTaskWorking
+	case "completed":
+		return a2aTaskCompleted
+	case "cancelled":
+		return a2aTaskCanceled
+	case "failed":
+		return a2aTaskFailed
+	default:
+		return a2aTaskUnknown // e.g. interrupted by a restart
+	}
+}
+
+// a2aMessage is an A2A message with one text part
+func a2aMessage(role, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"role":  role,
+		"parts": []interface{}{map[string]interface{}{"type": "text", "text": text}},
+	}
+}
+
+// messageText joins the text parts of an A2A message
+func messageText(message interface{}) string {
+	m, _ := message.(map[string]interface{})
+	parts, _ := m["parts"].([]interface{})
+
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		p, _ := part.(map[string]interface{})
+		kind, _ := p["type"].(string)
+		if kind == "" {
+			kind, _ = p["kind"].(string) // newer protocol versions
+		}
+		if text, ok := p["text"].(string); ok && kind == "text" && strings.TrimSpace(text) != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
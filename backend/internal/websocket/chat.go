@@ -1,39 +1,119 @@
 package websocket
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/internal/ratelimit"
+	"agent-workspace/backend/pkg/apierror"
+	"agent-workspace/backend/pkg/llm"
+	"agent-workspace/backend/pkg/logging"
 	"agent-workspace/backend/pkg/models"
 	"agent-workspace/backend/pkg/ollama"
+	"agent-workspace/backend/pkg/tracing"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/websocket/v3"
 	"github.com/google/uuid"
 )
 
+// errClientGone cancels the commands of a WebSocket that has disconnected
+var errClientGone = errors.New("chat client disconnected")
+
+// Reasons a resume_session message is refused
+var (
+	errSessionRequired = errors.New("session_id required")
+	errHistoryDisabled = errors.New("conversation history is disabled")
+)
+
 // Handler handles WebSocket chat connections
 type Handler struct {
-	clients         map[*websocket.Conn]bool
-	broadcast       chan models.Message
-	register        chan *websocket.Conn
-	unregister      chan *websocket.Conn
-	mu              sync.RWMutex
-	ollama          *ollama.Client
-	agentController interface{} // Will be *agent.Controller when implemented
+	clients       map[*chatConn]*chatPeer
+	broadcast     chan chatBroadcast
+	unregister    chan *chatConn
+	replay        *replayBuffer[models.Message] // recent broadcasts, for clients that reconnect
+	mu            sync.RWMutex
+	provider      llm.Provider              // the reasoner's
+	tools         *ChatTools                // nil leaves the model without tools
+	conversations *memory.ConversationStore // nil keeps chat stateless
+	rate          ratelimit.Rate            // messages per connection
+	streams       map[string]*sseStream     // SSE connections by ID
+	life          *hubLifecycle
+}
+
+// chatClient is where a connection's replies go: a WebSocket, or an SSE
+// stream for clients that can't open one
+type chatClient interface {
+	WriteJSON(v interface{}) error
+	conversationOwner() string
+}
+
+// chatConn is a chat WebSocket. Replies are written from the connection's
+// goroutine while the hub writes broadcasts and heartbeats, so every write
+// goes through writeMu.
+type chatConn struct {
+	*websocket.Conn
+	writeMu sync.Mutex
+	owner   string // the principal its conversations belong to, if auth is on
+}
+
+// conversationOwner is the principal the connection's conversations belong to
+func (c *chatConn) conversationOwner() string {
+	return c.owner
+}
+
+// WriteJSON sends v as a text message
+func (c *chatConn) WriteJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+// WriteMessage sends a message of messageType
+func (c *chatConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// WriteControl sends a control message
+func (c *chatConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteControl(messageType, data, deadline)
+}
+
+// chatBroadcast is a message for every client, or only those viewing task
+type chatBroadcast struct {
+	msg  models.Message
+	task string
 }
 
+// chatReplayTopic numbers chat broadcasts, whichever task they're scoped to
+const chatReplayTopic = "chat"
+
+// chatSystemPrompt opens every chat completion
+const chatSystemPrompt = "You are an AI agent assistant with access to browser automation, terminal control, and file operations. Help the user accomplish their tasks efficiently."
+
 // NewHandler creates a new WebSocket handler
-func NewHandler(agentController interface{}) *Handler {
+func NewHandler(tools *ChatTools, conversations *memory.ConversationStore) *Handler {
 	h := &Handler{
-		clients:         make(map[*websocket.Conn]bool),
-		broadcast:       make(chan models.Message, 256),
-		register:        make(chan *websocket.Conn),
-		unregister:      make(chan *websocket.Conn),
-		ollama:          ollama.NewClient(),
-		agentController: agentController,
+		clients:       make(map[*chatConn]*chatPeer),
+		streams:       make(map[string]*sseStream),
+		broadcast:     make(chan chatBroadcast, 256),
+		unregister:    make(chan *chatConn),
+		replay:        newReplayBuffer[models.Message](ReplayBufferFromEnv()),
+		provider:      llm.ProviderFor(llm.RoleReasoner),
+		tools:         tools,
+		conversations: conversations,
+		life:          newHubLifecycle(),
 	}
 
 	// Start the hub
@@ -42,97 +122,304 @@ func NewHandler(agentController interface{}) *Handler {
 	return h
 }
 
-// run handles the WebSocket hub
+// SetRateLimit limits the messages each connection opened after it can send
+func (h *Handler) SetRateLimit(rate ratelimit.Rate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rate = rate
+}
+
+// rateLimit returns the per-connection message rate
+func (h *Handler) rateLimit() ratelimit.Rate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.rate
+}
+
+// run handles the WebSocket hub until Stop
 func (h *Handler) run() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
+	defer close(h.life.done)
 
 	for {
 		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			log.Printf("Client connected. Total clients: %d", len(h.clients))
+		case <-h.life.stop:
+			h.closeAll()
+			return
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
+			if peer, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				client.Close()
+				slog.Info("chat client disconnected", "user", peer.user, "clients", len(h.clients)+len(h.streams))
+				h.announce("left", peer, nil)
 			}
 			h.mu.Unlock()
-			log.Printf("Client disconnected. Total clients: %d", len(h.clients))
 
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				if err := client.WriteJSON(message); err != nil {
-					log.Printf("Error broadcasting to client: %v", err)
-					client.Close()
-					delete(h.clients, client)
-				}
-			}
-			h.mu.RUnlock()
+		case b := <-h.broadcast:
+			h.mu.Lock()
+			// Numbered under the lock, so a client that joins gets each
+			// broadcast either live or by replay, never both
+			message := h.replay.add(chatReplayTopic, b.task, func(seq uint64) models.Message {
+				b.msg.Seq = seq
+				return b.msg
+			})
+			h.deliver(message, b.task, nil)
+			h.mu.Unlock()
 
 		case <-ticker.C:
-			// Send heartbeat
-			h.mu.RLock()
+			// Send heartbeat; a client that fails is closed, so its read
+			// loop ends and unregisters it
+			h.mu.Lock()
 			for client := range h.clients {
 				if err := client.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-					log.Printf("Error sending heartbeat: %v", err)
+					slog.Warn("failed to send heartbeat", "error", err)
 					client.Close()
-					delete(h.clients, client)
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
 		}
 	}
 }
 
+// deliver sends a message to every client but except that sees task;
+// callers hold h.mu. A client that fails is closed, so its read loop ends
+// and unregisters it.
+func (h *Handler) deliver(message models.Message, task string, except *chatPeer) {
+	for client, peer := range h.clients {
+		if peer == except || !peer.sees(task) {
+			continue
+		}
+		if err := client.WriteJSON(message); err != nil {
+			slog.Warn("failed to broadcast to chat client", "user", peer.user, "error", err)
+			client.Close()
+		}
+	}
+	for _, stream := range h.streams {
+		if stream.peer != except && stream.peer.sees(task) {
+			stream.offer(message)
+		}
+	}
+}
+
+// closeAll tells every client the server is going away and stops reading
+// from them after drainTimeout; commands already running finish first
+func (h *Handler) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notice := websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownReason)
+	for client := range h.clients {
+		client.WriteControl(websocket.CloseMessage, notice, time.Now().Add(closeWriteTimeout))
+		client.SetReadDeadline(time.Now().Add(drainTimeout))
+		delete(h.clients, client)
+	}
+	for id, stream := range h.streams {
+		stream.close()
+		delete(h.streams, id)
+	}
+}
+
+// Stop closes every connection and waits until ctx is done for the
+// commands they're running to finish
+func (h *Handler) Stop(ctx context.Context) error {
+	return h.life.shutdown(ctx)
+}
+
 // HandleWebSocket handles WebSocket upgrade and messages
 func (h *Handler) HandleWebSocket(c fiber.Ctx) error {
-	return websocket.New(func(conn *websocket.Conn) {
+	if !h.life.join() {
+		return apierror.Send(c, 503, shutdownReason)
+	}
+
+	// Clients reconnect with ?session_id= to resume a conversation
+	owner := auth.OwnerOf(c)
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		sessionID = uuid.New().String()
+	} else if err := h.claimSession(sessionID, owner); err != nil {
+		h.life.leave()
+		return apierror.Send(c, sessionErrorStatus(err), err.Error())
+	}
+	peer := newChatPeer(c, transportWebSocket, c.Query("user"), c.Query("task_id"))
+
+	// Tools run commands, so only callers allowed to execute get them
+	tools := h.tools
+	if !auth.FromContext(c).Allows(auth.ScopeExecute) {
+		tools = nil
+	}
+
+	err := websocket.New(func(ws *websocket.Conn) {
+		defer h.life.leave()
+		conn := &chatConn{Conn: ws, owner: owner}
+
 		// Register client
-		h.register <- conn
+		if !h.addClient(conn, peer) {
+			conn.Close()
+			return
+		}
 		defer func() {
-			h.unregister <- conn
+			select {
+			case h.unregister <- conn:
+			case <-h.life.done:
+				conn.Close()
+			}
 		}()
 
+		// Commands still running when the client leaves are cancelled
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(errClientGone)
+
 		// Send welcome message
-		welcomeMsg := models.Message{
-			ID:        uuid.New().String(),
-			Type:      "system_event",
-			Timestamp: time.Now().Format(time.RFC3339),
-			Source:    "system",
-			Payload: map[string]interface{}{
-				"event":   "connected",
-				"message": "Connected to Agent Workspace",
-			},
-		}
-		conn.WriteJSON(welcomeMsg)
+		conn.WriteJSON(h.welcomeMessage(sessionID, peer))
 
-		// Handle messages
+		// Handle messages; heartbeats don't count against the rate limit
+		limit := ratelimit.NewBucket("chat", h.rateLimit())
 		for {
 			var msg models.Message
 			if err := conn.ReadJSON(&msg); err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("WebSocket error: %v", err)
+					slog.Warn("chat WebSocket error", "user", peer.user, "error", err)
 				}
 				break
 			}
 
+			if msg.Type != "heartbeat" {
+				if ok, wait := limit.Allow(); !ok {
+					h.sendError(conn, fmt.Sprintf("rate limit exceeded, retry in %s", wait.Round(time.Millisecond)))
+					continue
+				}
+			}
+
+			// Switch sessions before handling later messages, so they
+			// continue the resumed conversation
+			if msg.Type == "resume_session" {
+				if resumed, err := h.resumeSession(conn, msg); err == nil {
+					sessionID = resumed
+				}
+				continue
+			}
+
+			// Replay the broadcasts missed while disconnected
+			if msg.Type == "resume" {
+				h.replayTo(conn, peer, msg)
+				continue
+			}
+
+			// Later broadcasts for the task viewed reach the connection
+			if msg.Type == "view_task" {
+				h.viewTask(peer, msg)
+				continue
+			}
+
 			// Handle different message types
-			go h.handleMessage(conn, msg)
+			h.life.conns.Add(1)
+			go func(sessionID string, msg models.Message) {
+				defer h.life.leave()
+				h.handleMessage(ctx, conn, sessionID, tools, msg)
+			}(sessionID, msg)
 		}
 	})(c)
+	if err != nil {
+		// The handshake failed, so the connection never started
+		h.life.leave()
+	}
+	return err
+}
+
+// addClient registers a connection, noting the last broadcast sent before
+// it joined, and announces it to the others; false once the hub is stopping
+func (h *Handler) addClient(conn *chatConn, peer *chatPeer) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.life.stop:
+		return false
+	default:
+	}
+	peer.joined = h.replay.last(chatReplayTopic)
+	h.clients[conn] = peer
+	slog.Info("chat client connected", "user", peer.user, "clients", len(h.clients)+len(h.streams))
+	h.announce("joined", peer, peer)
+	return true
 }
 
-// handleMessage processes incoming messages
-func (h *Handler) handleMessage(conn *websocket.Conn, msg models.Message) {
+// welcomeMessage greets a new connection with its session, who it is and
+// who else is connected, and the last broadcast before it joined, which a
+// reconnecting client resumes up to
+func (h *Handler) welcomeMessage(sessionID string, peer *chatPeer) models.Message {
+	return models.Message{
+		ID:        uuid.New().String(),
+		Type:      "system_event",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "system",
+		Payload: map[string]interface{}{
+			"event":         "connected",
+			"message":       "Connected to Agent Workspace",
+			"session_id":    sessionID,
+			"connection_id": peer.id,
+			"user":          peer.user,
+			"task_id":       peer.task,
+			"users":         h.Presence(),
+			"seq":           peer.joined,
+			"epoch":         h.replay.epoch,
+		},
+	}
+}
+
+// replayTo resends the broadcasts a reconnecting client missed: those
+// after payload.last_seq up to when this connection joined, later ones
+// having reached it live, that were for everyone or the task it views. A
+// client from before a restart, whose epoch differs, gets every broadcast
+// kept.
+func (h *Handler) replayTo(conn chatClient, peer *chatPeer, msg models.Message) {
+	lastSeq, ok := seqParam(msg.Payload["last_seq"])
+	if !ok {
+		h.sendError(conn, "last_seq required")
+		return
+	}
+	restarted := false
+	if epoch, _ := msg.Payload["epoch"].(string); epoch != "" && epoch != h.replay.epoch {
+		lastSeq, restarted = 0, true
+	}
+
+	h.mu.RLock()
+	task := peer.task
+	h.mu.RUnlock()
+
+	missed, complete := h.replay.since(chatReplayTopic, task, lastSeq, peer.joined)
+	for _, missedMsg := range missed {
+		if err := h.sendToClient(conn, missedMsg); err != nil {
+			return
+		}
+	}
+	h.sendToClient(conn, models.Message{
+		ID:        uuid.New().String(),
+		Type:      "system_event",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "system",
+		Payload: map[string]interface{}{
+			"event":    "resumed",
+			"last_seq": lastSeq,
+			"seq":      peer.joined,
+			"replayed": len(missed),
+			"complete": complete && !restarted,
+			"epoch":    h.replay.epoch,
+		},
+	})
+}
+
+// handleMessage processes incoming messages; cancelling ctx stops the
+// command they start
+func (h *Handler) handleMessage(ctx context.Context, conn chatClient, sessionID string, tools *ChatTools, msg models.Message) {
 	switch msg.Type {
 	case "user_command":
-		h.handleUserCommand(conn, msg)
+		h.handleUserCommand(ctx, conn, sessionID, tools, msg)
 	case "heartbeat":
 		// Respond to heartbeat
 		h.sendToClient(conn, models.Message{
@@ -142,18 +429,91 @@ func (h *Handler) handleMessage(conn *websocket.Conn, msg models.Message) {
 			Source:    "system",
 		})
 	default:
-		log.Printf("Unknown message type: %s", msg.Type)
+		logging.FromContext(ctx).Warn("unknown message type", "type", msg.Type)
 	}
 }
 
-// handleUserCommand processes user commands
-func (h *Handler) handleUserCommand(conn *websocket.Conn, msg models.Message) {
+// claimSession checks a session named on connect is free or the caller's
+// own, so nobody can continue another principal's conversation
+func (h *Handler) claimSession(sessionID, owner string) error {
+	if h.conversations == nil {
+		return nil
+	}
+	_, err := h.conversations.Get(sessionID, owner)
+	return err
+}
+
+// sessionErrorStatus is the HTTP status for a session that can't be joined
+func sessionErrorStatus(err error) int {
+	if errors.Is(err, memory.ErrConversationNotFound) {
+		return 404
+	}
+	if errors.Is(err, errSessionRequired) || errors.Is(err, errHistoryDisabled) {
+		return 400
+	}
+	return 500
+}
+
+// resumeSession switches a connection to one of its owner's stored
+// conversations and sends it back to the client; the next command replays
+// it to the model
+func (h *Handler) resumeSession(conn chatClient, msg models.Message) (string, error) {
+	sessionID, _ := msg.Payload["session_id"].(string)
+	if sessionID == "" {
+		h.sendError(conn, errSessionRequired.Error())
+		return "", errSessionRequired
+	}
+	if h.conversations == nil {
+		h.sendError(conn, errHistoryDisabled.Error())
+		return "", errHistoryDisabled
+	}
+
+	conv, err := h.conversations.Find(sessionID, conn.conversationOwner())
+	if err != nil {
+		slog.Warn("failed to resume conversation", "session_id", sessionID, "error", err)
+		h.sendError(conn, err.Error())
+		return "", err
+	}
+
+	h.sendToClient(conn, models.Message{
+		ID:        uuid.New().String(),
+		Type:      "system_event",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "system",
+		Payload: map[string]interface{}{
+			"event":       "session_resumed",
+			"session_id":  sessionID,
+			"title":       conv.Title,
+			"summary":     conv.Summary,
+			"summarized":  conv.Summarized,
+			"messages":    conv.Messages,
+			"tool_events": conv.ToolEvents,
+		},
+	})
+	return sessionID, nil
+}
+
+// handleUserCommand processes user commands, running the tools the model
+// calls when tools isn't nil
+func (h *Handler) handleUserCommand(ctx context.Context, conn chatClient, sessionID string, tools *ChatTools, msg models.Message) {
 	command, ok := msg.Payload["command"].(string)
 	if !ok {
 		h.sendError(conn, "Invalid command format")
 		return
 	}
 
+	// Correlate the command's model calls and tool runs in the logs, by the
+	// message's ID when the client set a usable one
+	requestID := msg.ID
+	if !logging.ValidRequestID(requestID) {
+		requestID = logging.NewRequestID()
+	}
+	ctx = logging.With(logging.WithRequestID(ctx, requestID), "session_id", sessionID)
+	ctx, span := tracing.Start(ctx, "chat.command", "session.id", sessionID)
+	defer span.End()
+	logger := logging.FromContext(ctx)
+	logger.Info("chat command received", "length", len(command))
+
 	// Send thinking status
 	h.sendToClient(conn, models.Message{
 		ID:        uuid.New().String(),
@@ -161,29 +521,159 @@ func (h *Handler) handleUserCommand(conn *websocket.Conn, msg models.Message) {
 		Timestamp: time.Now().Format(time.RFC3339),
 		Source:    "agent",
 		Payload: map[string]interface{}{
-			"state":   "thinking",
-			"message": "Processing your request...",
+			"state":      "thinking",
+			"message":    "Processing your request...",
+			"request_id": requestID,
 		},
 	})
 
-	// Build conversation history
+	// Build conversation history, offering tools through function calling
+	// when the model supports it and describing them in the prompt otherwise
+	systemPrompt := chatSystemPrompt
+	var definitions []ollama.Tool
+	if tools != nil {
+		if h.provider.SupportsTools() {
+			definitions = tools.Definitions()
+		} else {
+			systemPrompt += chatToolPrompt(tools.List())
+		}
+	}
 	messages := []ollama.ChatMessage{
-		{
-			Role:    "system",
-			Content: "You are an AI agent assistant with access to browser automation, terminal control, and file operations. Help the user accomplish their tasks efficiently.",
-		},
-		{
-			Role:    "user",
-			Content: command,
-		},
+		{Role: "system", Content: systemPrompt},
 	}
+	if h.conversations != nil {
+		history, err := h.conversations.History(sessionID, conn.conversationOwner())
+		if err != nil {
+			logger.Warn("failed to load conversation", "error", err)
+		} else {
+			messages = append(messages, history...)
+		}
+	}
+	userMessage := ollama.ChatMessage{Role: "user", Content: command}
+	messages = append(messages, userMessage)
+	turn := []ollama.ChatMessage{userMessage}
+
+	// Stream a reply, run the tools it calls and go back to the model
+	// with their results until it answers without calling any
+	var usage ollama.Usage
+	for round := 0; ; round++ {
+		responseID := uuid.New().String()
+		_, llmSpan := tracing.Start(ctx, "llm.chat", "gen_ai.system", h.provider.Name(),
+			"gen_ai.request.model", h.provider.Model(), "llm.messages", len(messages), "chat.round", round)
+		llmSpan.SetKind(tracing.KindClient)
+		fullResponse, result, err := h.streamReply(ctx, conn, responseID, messages, definitions)
+		if errors.Is(err, ollama.ErrToolsUnsupported) {
+			logger.Warn("model does not support tools, describing them in the prompt instead", "model", h.provider.Model())
+			definitions = nil
+			messages[0].Content += chatToolPrompt(tools.List())
+			fullResponse, result, err = h.streamReply(ctx, conn, responseID, messages, nil)
+		}
+		llmSpan.RecordError(err)
+		if err == nil {
+			llmSpan.SetAttributes("gen_ai.usage.input_tokens", result.Usage.PromptTokens,
+				"gen_ai.usage.output_tokens", result.Usage.CompletionTokens,
+				"gen_ai.response.finish_reasons", result.FinishReason,
+				"gen_ai.response.model", result.Model)
+		}
+		llmSpan.End()
+		if ctx.Err() != nil {
+			// The client has gone, so there's no one to tell
+			logger.Info("chat command cancelled", "reason", context.Cause(ctx))
+			return
+		}
+		if err != nil {
+			span.RecordError(err)
+			logger.Error("failed to stream from Ollama", "error", err)
+			h.sendError(conn, "Failed to generate response")
+			return
+		}
+		usage.PromptTokens += result.Usage.PromptTokens
+		usage.CompletionTokens += result.Usage.CompletionTokens
+		usage.TotalTokens += result.Usage.TotalTokens
+		if result.FinishReason == "length" {
+			logger.Warn("reply cut off at the token limit", "round", round)
+		}
+
+		toolCalls := result.ToolCalls
+		reply := ollama.ChatMessage{Role: "assistant", Content: fullResponse, ToolCalls: toolCalls}
+		messages = append(messages, reply)
+		turn = append(turn, reply)
 
-	// Stream response from Ollama
-	responseID := uuid.New().String()
-	fullResponse := ""
+		var calls []ChatToolCall
+		if len(toolCalls) > 0 {
+			calls = nativeToolCalls(toolCalls)
+		} else if tools != nil {
+			calls = parseToolCalls(fullResponse)
+		}
+		if len(calls) == 0 || round == maxChatToolRounds {
+			if len(calls) > 0 {
+				logger.Warn("chat stopped at the tool round limit", "rounds", maxChatToolRounds)
+			}
+			// Send completion
+			h.sendToClient(conn, models.Message{
+				ID:        responseID,
+				Type:      "agent_response_complete",
+				Timestamp: time.Now().Format(time.RFC3339),
+				Source:    "agent",
+				Payload: map[string]interface{}{
+					"response":      fullResponse,
+					"complete":      true,
+					"finish_reason": result.FinishReason,
+					"model":         result.Model,
+					"usage":         usage,
+				},
+			})
+			break
+		}
 
-	err := h.ollama.ChatCompletionStream(messages, 0.7, func(chunk string) error {
-		fullResponse += chunk
+		// Native calls are each answered by a tool message; calls written
+		// in the reply are answered together as the next user message
+		results := make([]string, 0, len(calls))
+		for _, call := range calls {
+			result := h.runTool(ctx, conn, sessionID, tools, call)
+			if call.ID != "" {
+				toolMessage := ollama.ChatMessage{Role: "tool", Content: result, ToolCallID: call.ID}
+				messages = append(messages, toolMessage)
+				turn = append(turn, toolMessage)
+				continue
+			}
+			results = append(results, result)
+		}
+		if len(results) > 0 {
+			toolMessage := ollama.ChatMessage{Role: "user", Content: strings.Join(results, "\n")}
+			messages = append(messages, toolMessage)
+			turn = append(turn, toolMessage)
+		}
+	}
+
+	// Record the exchange before reporting idle so the next command sees it
+	if h.conversations != nil {
+		if err := h.conversations.Append(sessionID, conn.conversationOwner(), turn...); err != nil {
+			logger.Warn("failed to save conversation", "error", err)
+		}
+	}
+
+	// Send idle status
+	h.sendToClient(conn, models.Message{
+		ID:        uuid.New().String(),
+		Type:      "agent_status",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "agent",
+		Payload: map[string]interface{}{
+			"state": "idle",
+		},
+	})
+}
+
+// streamReply streams a completion of messages offering tools to the client
+// as chunks of responseID, until it ends or ctx is cancelled, and returns
+// the whole reply and how the stream ended
+func (h *Handler) streamReply(ctx context.Context, conn chatClient, responseID string, messages []ollama.ChatMessage, tools []ollama.Tool) (string, *ollama.StreamResult, error) {
+	var fullResponse strings.Builder
+	// A user is waiting on the reply, so it goes ahead of background work
+	ctx = llm.WithPriority(ctx, llm.PriorityInteractive)
+	result, err := h.provider.Stream(ctx, llm.Request{Messages: messages, Tools: tools, Temperature: 0.7}, func(chunk string) error {
+		fullResponse.WriteString(chunk)
 
 		// Send chunk to client
 		return h.sendToClient(conn, models.Message{
@@ -197,44 +687,72 @@ func (h *Handler) handleUserCommand(conn *websocket.Conn, msg models.Message) {
 			},
 		})
 	})
+	return fullResponse.String(), result, err
+}
 
-	if err != nil {
-		log.Printf("Error streaming from Ollama: %v", err)
-		h.sendError(conn, "Failed to generate response")
-		return
-	}
-
-	// Send completion
+// runTool runs a tool call, tells the client about it as tool_call and
+// tool_result events, and returns the result to feed back to the model
+func (h *Handler) runTool(ctx context.Context, conn chatClient, sessionID string, tools *ChatTools, call ChatToolCall) string {
+	callID := uuid.New().String()
 	h.sendToClient(conn, models.Message{
-		ID:        responseID,
-		Type:      "agent_response_complete",
+		ID:        callID,
+		Type:      "tool_call",
 		Timestamp: time.Now().Format(time.RFC3339),
 		Source:    "agent",
 		Payload: map[string]interface{}{
-			"response": fullResponse,
-			"complete": true,
+			"tool":      call.Name,
+			"arguments": call.Arguments,
 		},
 	})
 
-	// Send idle status
+	var result interface{}
+	var err error
+	if call.Name == "" {
+		err = fmt.Errorf("tool call must be JSON with a name and arguments")
+	} else {
+		result, err = tools.Execute(ctx, sessionID, call)
+	}
+
+	event := memory.ToolEvent{
+		ID:        callID,
+		Tool:      call.Name,
+		Arguments: call.Arguments,
+		Success:   err == nil,
+		Result:    result,
+		Timestamp: time.Now(),
+	}
+	payload := map[string]interface{}{
+		"tool":    call.Name,
+		"success": err == nil,
+		"result":  result,
+	}
+	if err != nil {
+		event.Error = err.Error()
+		payload["error"] = err.Error()
+	}
+	if h.conversations != nil {
+		if err := h.conversations.RecordToolEvent(sessionID, conn.conversationOwner(), event); err != nil {
+			logging.FromContext(ctx).Warn("failed to record tool call in conversation", "tool", call.Name, "error", err)
+		}
+	}
 	h.sendToClient(conn, models.Message{
-		ID:        uuid.New().String(),
-		Type:      "agent_status",
+		ID:        callID,
+		Type:      "tool_result",
 		Timestamp: time.Now().Format(time.RFC3339),
-		Source:    "agent",
-		Payload: map[string]interface{}{
-			"state": "idle",
-		},
+		Source:    call.Name,
+		Payload:   payload,
 	})
+
+	return formatToolResult(call, result, err)
 }
 
 // sendToClient sends a message to a specific client
-func (h *Handler) sendToClient(conn *websocket.Conn, msg models.Message) error {
+func (h *Handler) sendToClient(conn chatClient, msg models.Message) error {
 	return conn.WriteJSON(msg)
 }
 
 // sendError sends an error message to a client
-func (h *Handler) sendError(conn *websocket.Conn, errMsg string) {
+func (h *Handler) sendError(conn chatClient, errMsg string) {
 	h.sendToClient(conn, models.Message{
 		ID:        uuid.New().String(),
 		Type:      "error",
@@ -246,38 +764,51 @@ func (h *Handler) sendError(conn *websocket.Conn, errMsg string) {
 	})
 }
 
+// publish queues a message for the clients viewing task, or for every
+// client when task is empty, dropping it once the hub has stopped
+func (h *Handler) publish(task string, msg models.Message) {
+	select {
+	case h.broadcast <- chatBroadcast{msg: msg, task: task}:
+	case <-h.life.done:
+	}
+}
+
 // BroadcastMessage broadcasts a message to all connected clients
 func (h *Handler) BroadcastMessage(msg models.Message) {
-	h.broadcast <- msg
+	h.publish("", msg)
 }
 
-// BroadcastTerminalOutput broadcasts terminal output
-func (h *Handler) BroadcastTerminalOutput(output string) {
+// BroadcastTerminalOutput sends a task's terminal output to the clients
+// viewing it, or to every client when taskID is empty
+func (h *Handler) BroadcastTerminalOutput(taskID, output string) {
 	msg := models.Message{
 		ID:        uuid.New().String(),
 		Type:      "terminal_output",
 		Timestamp: time.Now().Format(time.RFC3339),
 		Source:    "terminal",
 		Payload: map[string]interface{}{
-			"output": output,
+			"task_id": taskID,
+			"output":  output,
 		},
 	}
-	h.broadcast <- msg
+	h.publish(taskID, msg)
 }
 
-// BroadcastBrowserUpdate broadcasts browser state update
-func (h *Handler) BroadcastBrowserUpdate(screenshot string, elements []models.BrowserElement) {
+// BroadcastBrowserUpdate sends a task's browser state to the clients
+// viewing it, or to every client when taskID is empty
+func (h *Handler) BroadcastBrowserUpdate(taskID, screenshot string, elements []models.BrowserElement) {
 	msg := models.Message{
 		ID:        uuid.New().String(),
 		Type:      "browser_update",
 		Timestamp: time.Now().Format(time.RFC3339),
 		Source:    "browser",
 		Payload: map[string]interface{}{
+			"task_id":    taskID,
 			"screenshot": screenshot,
 			"elements":   elements,
 		},
 	}
-	h.broadcast <- msg
+	h.publish(taskID, msg)
 }
 
 // BroadcastWatchdogAlert broadcasts a watchdog alert
@@ -293,13 +824,64 @@ func (h *Handler) BroadcastWatchdogAlert(alertType, title, message string) {
 			"message":    message,
 		},
 	}
-	h.broadcast <- msg
+	h.publish("", msg)
 }
 
-// GetClientCount returns the number of connected clients
+// BroadcastAgentState broadcasts an agent state transition
+func (h *Handler) BroadcastAgentState(state, taskID string) {
+	msg := models.Message{
+		ID:        uuid.New().String(),
+		Type:      "agent_state",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "agent",
+		Payload: map[string]interface{}{
+			"state":   state,
+			"task_id": taskID,
+		},
+	}
+	h.publish("", msg)
+}
+
+// BroadcastTaskStep broadcasts a task step starting, completing or failing
+func (h *Handler) BroadcastTaskStep(taskID, event string, step models.TaskStep) {
+	msg := models.Message{
+		ID:        uuid.New().String(),
+		Type:      "task_step",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "agent",
+		Payload: map[string]interface{}{
+			"task_id": taskID,
+			"event":   event,
+			"step":    step,
+		},
+	}
+	h.publish("", msg)
+}
+
+// BroadcastModelPull broadcasts the progress of a model download
+func (h *Handler) BroadcastModelPull(pull ollama.PullStatus) {
+	msg := models.Message{
+		ID:        uuid.New().String(),
+		Type:      "model_pull",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "ollama",
+		Payload: map[string]interface{}{
+			"pull": pull,
+		},
+	}
+	h.publish("", msg)
+}
+
+// GetClientCount returns the number of connected clients, over WebSocket
+// or SSE
 func (h *Handler) GetClientCount() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return len(h.clients)
+	return len(h.clients) + len(h.streams)
 }
 
+// HandleChatWebSocket creates and returns a chat WebSocket handler
+func HandleChatWebSocket(tools *ChatTools, conversations *memory.ConversationStore) fiber.Handler {
+	handler := NewHandler(tools, conversations)
+	return handler.HandleWebSocket
+}
@@ -0,0 +1,313 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/internal/ratelimit"
+	"agent-workspace/backend/pkg/apierror"
+	"agent-workspace/backend/pkg/models"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+)
+
+const (
+	sseBufferSize   = 256              // messages queued for a slow stream
+	sseSendTimeout  = 10 * time.Second // how long a reply waits for room in the queue
+	sseKeepAlive    = 15 * time.Second // comment sent to keep proxies from closing an idle stream
+	sseRetryMillis  = 3000             // how soon the browser reconnects a dropped stream
+	sseStreamHeader = "X-Chat-Stream"  // names the stream a POST was sent for
+)
+
+// errStreamClosed is returned when writing to a stream that has ended
+var errStreamClosed = errors.New("chat stream closed")
+
+// sseStream is a chat connection over Server-Sent Events, for clients
+// whose network blocks WebSockets. Replies and broadcasts flow down the
+// stream; the client sends its messages with HandleStreamMessage.
+type sseStream struct {
+	id     string
+	owner  string     // the principal that opened the stream, if auth is on
+	tools  *ChatTools // nil leaves the model without tools
+	limit  *ratelimit.Bucket
+	events chan models.Message
+	peer   *chatPeer
+
+	closeOnce sync.Once
+	done      chan struct{}
+	ctx       context.Context // cancelled when the stream ends, stopping its commands
+	cancel    context.CancelCauseFunc
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+// conversationOwner is the principal the stream's conversations belong to
+func (s *sseStream) conversationOwner() string {
+	return s.owner
+}
+
+// WriteJSON queues a reply, waiting a while for room so streamed chunks
+// aren't lost to a slow reader
+func (s *sseStream) WriteJSON(v interface{}) error {
+	msg, ok := v.(models.Message)
+	if !ok {
+		return fmt.Errorf("failed to send %T over chat stream", v)
+	}
+
+	timer := time.NewTimer(sseSendTimeout)
+	defer timer.Stop()
+	select {
+	case s.events <- msg:
+		return nil
+	case <-s.done:
+		return errStreamClosed
+	case <-timer.C:
+		return fmt.Errorf("chat stream %s is not reading", s.id)
+	}
+}
+
+// offer queues a broadcast, dropping it when the stream is behind
+func (s *sseStream) offer(msg models.Message) {
+	select {
+	case s.events <- msg:
+	default:
+	}
+}
+
+// close ends the stream; later calls do nothing
+func (s *sseStream) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.cancel(errStreamClosed)
+	})
+}
+
+func (s *sseStream) session() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionID
+}
+
+func (s *sseStream) setSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessionID = sessionID
+}
+
+// HandleStream opens a Server-Sent Events chat stream, the fallback for
+// /ws/chat. It sends the same messages a WebSocket gets, each as an event
+// named after its type; the connected event carries the stream_id to post
+// messages with.
+func (h *Handler) HandleStream(c fiber.Ctx) error {
+	if !h.life.join() {
+		return apierror.Send(c, 503, shutdownReason)
+	}
+
+	// Clients reconnect with ?session_id= to resume a conversation
+	var req models.ChatStreamRequest
+	if err := c.Bind().Query(&req); err != nil {
+		h.life.leave()
+		return apierror.Send(c, 400, "invalid query parameters")
+	}
+	owner := auth.OwnerOf(c)
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = uuid.New().String()
+	} else if err := h.claimSession(sessionID, owner); err != nil {
+		h.life.leave()
+		return apierror.Send(c, sessionErrorStatus(err), err.Error())
+	}
+
+	principal := auth.FromContext(c)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stream := &sseStream{
+		ctx:       ctx,
+		cancel:    cancel,
+		id:        uuid.New().String(),
+		owner:     owner,
+		tools:     h.tools,
+		limit:     ratelimit.NewBucket("chat", h.rateLimit()),
+		events:    make(chan models.Message, sseBufferSize),
+		done:      make(chan struct{}),
+		sessionID: sessionID,
+		peer:      newChatPeer(c, transportSSE, req.User, req.TaskID),
+	}
+	// Tools run commands, so only callers allowed to execute get them
+	if !principal.Allows(auth.ScopeExecute) {
+		stream.tools = nil
+	}
+
+	h.mu.Lock()
+	stream.peer.joined = h.replay.last(chatReplayTopic)
+	h.streams[stream.id] = stream
+	h.announce("joined", stream.peer, stream.peer)
+	h.mu.Unlock()
+	slog.Info("chat stream connected", "user", stream.peer.user, "clients", h.GetClientCount())
+
+	welcome := h.welcomeMessage(sessionID, stream.peer)
+	welcome.Payload["stream_id"] = stream.id
+	stream.events <- welcome
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // keep nginx from buffering events
+	c.Set(sseStreamHeader, stream.id)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.life.leave()
+		defer h.removeStream(stream)
+
+		fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case msg := <-stream.events:
+				if err := writeEvent(w, msg); err != nil {
+					slog.Warn("failed to write to chat stream", "user", stream.peer.user, "error", err)
+					return
+				}
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-stream.done:
+				return
+			}
+			// A failed flush means the client has gone
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// writeEvent writes a message as an SSE event
+func writeEvent(w *bufio.Writer, msg models.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, data)
+	return err
+}
+
+// removeStream forgets a stream once its client has gone
+func (h *Handler) removeStream(stream *sseStream) {
+	stream.close()
+
+	h.mu.Lock()
+	_, ok := h.streams[stream.id]
+	delete(h.streams, stream.id)
+	if ok {
+		h.announce("left", stream.peer, nil)
+	}
+	h.mu.Unlock()
+	slog.Info("chat stream disconnected", "user", stream.peer.user, "clients", h.GetClientCount())
+}
+
+// callerName returns the authenticated principal's name, or ""
+func callerName(c fiber.Ctx) string {
+	if principal := auth.FromContext(c); principal != nil {
+		return principal.Name
+	}
+	return ""
+}
+
+// HandleStreamMessage takes a message for a chat stream, as /ws/chat would
+// read it from the socket. Replies arrive on the stream; the response only
+// says the message was accepted.
+func (h *Handler) HandleStreamMessage(c fiber.Ctx) error {
+	var req models.ChatStreamMessageRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return apierror.Send(c, 400, "invalid request body")
+	}
+	if req.StreamID == "" {
+		req.StreamID = c.Get(sseStreamHeader)
+	}
+	if req.StreamID == "" || req.Type == "" {
+		return apierror.Send(c, 400, "stream_id and type are required")
+	}
+
+	h.mu.RLock()
+	stream, ok := h.streams[req.StreamID]
+	h.mu.RUnlock()
+	// Another caller's stream is reported missing, not forbidden
+	if !ok || (stream.owner != "" && callerName(c) != stream.owner) {
+		return apierror.Send(c, 404, "chat stream not found")
+	}
+
+	// Heartbeats don't count against the rate limit
+	if req.Type != "heartbeat" {
+		if ok, wait := stream.limit.Allow(); !ok {
+			c.Set("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+			return apierror.SendDetails(c, 429, "rate limit exceeded", map[string]interface{}{"retry_after_ms": wait.Milliseconds()})
+		}
+	}
+
+	msg := models.Message{
+		ID:        req.ID,
+		Type:      req.Type,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "user",
+		Payload:   req.Payload,
+	}
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+	if msg.Payload == nil {
+		msg.Payload = map[string]interface{}{}
+	}
+
+	// Switch sessions before answering, so later messages continue the
+	// resumed conversation
+	if msg.Type == "resume_session" {
+		resumed, err := h.resumeSession(stream, msg)
+		if err != nil {
+			return apierror.Send(c, sessionErrorStatus(err), "failed to resume session, see the stream for details")
+		}
+		stream.setSession(resumed)
+		return c.JSON(models.ChatStreamMessageResponse{ID: msg.ID, SessionID: resumed})
+	}
+
+	// Missed broadcasts are queued on the stream before answering
+	if msg.Type == "resume" {
+		if _, ok := seqParam(msg.Payload["last_seq"]); !ok {
+			return apierror.Send(c, 400, "last_seq required")
+		}
+		h.replayTo(stream, stream.peer, msg)
+		return c.JSON(models.ChatStreamMessageResponse{ID: msg.ID, SessionID: stream.session()})
+	}
+
+	// The switch is announced on the stream before answering
+	if msg.Type == "view_task" {
+		h.viewTask(stream.peer, msg)
+		return c.JSON(models.ChatStreamMessageResponse{ID: msg.ID, SessionID: stream.session()})
+	}
+
+	if !h.life.join() {
+		return apierror.Send(c, 503, shutdownReason)
+	}
+	sessionID := stream.session()
+	go func() {
+		defer h.life.leave()
+		h.handleMessage(stream.ctx, stream, sessionID, stream.tools, msg)
+	}()
+
+	return c.Status(202).JSON(models.ChatStreamMessageResponse{ID: msg.ID, SessionID: sessionID, Accepted: true})
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/internal/memory"
+	"agent-workspace/backend/pkg/ollama"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestChatSessionsCantBeJoinedByAnotherPrincipal(t *testing.T) {
+	dir := t.TempDir()
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		Enabled:   true,
+		AdminKey:  "an-admin-key-that-is-at-least-32-characters",
+		JWTSecret: []byte("a-jwt-secret-that-is-at-least-32-characters"),
+		KeysPath:  filepath.Join(dir, "auth.db"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	defer authenticator.Close()
+	_, bob, err := authenticator.Keys().Create("bob", auth.ScopeExecute, 0, "test")
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+
+	conversations, err := memory.NewConversationStore(filepath.Join(dir, "conversations.db"), nil, 10)
+	if err != nil {
+		t.Fatalf("failed to open conversation store: %v", err)
+	}
+	defer conversations.Close()
+	if err := conversations.Append("alice-chat", "alice", ollama.ChatMessage{Role: "user", Content: "hello"}); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	h := NewHandler(nil, conversations)
+	defer h.Stop(context.Background())
+
+	app := fiber.New()
+	app.Use(authenticator.Middleware([]auth.Rule{{Prefix: "/", Scope: auth.ScopeBrowse}}))
+	app.Get("/ws/chat", h.HandleWebSocket)
+	app.Get("/api/chat/stream", h.HandleStream)
+
+	for _, path := range []string{"/ws/chat", "/api/chat/stream"} {
+		req := httptest.NewRequest("GET", path+"?session_id=alice-chat", nil)
+		req.Header.Set("X-API-Key", bob)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", path, err)
+		}
+		if resp.StatusCode != 404 {
+			t.Errorf("%s: another principal's session got %d, want 404", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/internal/browser"
+	"agent-workspace/backend/internal/mcp"
+	"agent-workspace/backend/internal/terminal"
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/ollama"
+	"agent-workspace/backend/pkg/tracing"
+)
+
+const (
+	// maxChatToolRounds bounds how many times one command can go back to
+	// the model with tool results
+	maxChatToolRounds = 8
+	// chatToolTimeout bounds a single tool call
+	chatToolTimeout = 60 * time.Second
+	// maxChatToolOutput is how much of a tool's output is fed back to the model
+	maxChatToolOutput = 4000
+)
+
+// chatToolCallPattern matches a tool call the model wrote into its reply
+var chatToolCallPattern = regexp.MustCompile(`(?s)<tool_call>\s*(.*?)\s*</tool_call>`)
+
+// ChatTool describes a tool the chat model can call
+type ChatTool struct {
+	Name        string
+	Description string
+	Parameters  map[string]string // name -> description
+	Types       map[string]string // name -> JSON Schema type, string when unset
+	Optional    []string          // parameters that may be left out
+}
+
+// ChatToolCall is a tool invocation parsed from a model reply
+type ChatToolCall struct {
+	ID        string                 `json:"-"` // the native call it answers, if any
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// ChatTools runs the browser, terminal and MCP tools chat models call
+type ChatTools struct {
+	browserMgr  *browser.Manager
+	terminalMgr *terminal.Manager
+	mcpClient   *mcp.Client
+}
+
+// NewChatTools creates the tools chat models can call
+func NewChatTools(browserMgr *browser.Manager, terminalMgr *terminal.Manager, mcpClient *mcp.Client) *ChatTools {
+	return &ChatTools{
+		browserMgr:  browserMgr,
+		terminalMgr: terminalMgr,
+		mcpClient:   mcpClient,
+	}
+}
+
+// List returns the tools available
+func (t *ChatTools) List() []ChatTool {
+	return []ChatTool{
+		{Name: "browser_navigate", Description: "Open a URL in the browser", Parameters: map[string]string{"url": "the URL to open"}},
+		{Name: "browser_read", Description: "Get the current page's title, URL and text", Parameters: map[string]string{}},
+		{Name: "browser_click", Description: "Click an element", Parameters: map[string]string{"selector": "CSS selector of the element"}},
+		{Name: "browser_type", Description: "Type text into an element", Parameters: map[string]string{"selector": "CSS selector of the element", "text": "the text to type"}},
+		{Name: "terminal_execute", Description: "Run a shell command and return its output", Parameters: map[string]string{"command": "the command to run"}},
+		{Name: "mcp_list_tools", Description: "List the tools of an MCP server", Parameters: map[string]string{"server": "the server name; omit to list servers"}, Optional: []string{"server"}},
+		{Name: "mcp_call", Description: "Call a tool on an MCP server", Parameters: map[string]string{"server": "the server name", "tool": "the tool name", "arguments": "an object of tool arguments"}, Types: map[string]string{"arguments": "object"}, Optional: []string{"arguments"}},
+	}
+}
+
+// Definitions returns the tools as function definitions for native tool calling
+func (t *ChatTools) Definitions() []ollama.Tool {
+	tools := t.List()
+	definitions := make([]ollama.Tool, 0, len(tools))
+	for _, tool := range tools {
+		properties := make(map[string]interface{}, len(tool.Parameters))
+		required := []string{}
+		for name, description := range tool.Parameters {
+			kind := tool.Types[name]
+			if kind == "" {
+				kind = "string"
+			}
+			properties[name] = map[string]interface{}{"type": kind, "description": description}
+			if !slices.Contains(tool.Optional, name) {
+				required = append(required, name)
+			}
+		}
+		sort.Strings(required)
+		definitions = append(definitions, ollama.NewTool(tool.Name, tool.Description, map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}))
+	}
+	return definitions
+}
+
+// Execute runs a tool and logs the call with ctx's logger. Terminal
+// commands run in a shell of their own per chat session, so a cd carries
+// over within a conversation.
+func (t *ChatTools) Execute(ctx context.Context, sessionID string, call ChatToolCall) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, chatToolTimeout)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "chat.tool", "tool.name", call.Name)
+	defer span.End()
+
+	start := time.Now()
+	result, err := t.execute(ctx, sessionID, call)
+	span.RecordError(err)
+	logger := logging.FromContext(ctx).With("tool", call.Name, "duration_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		logger.Warn("tool call failed", "error", err)
+	} else {
+		logger.Info("tool call finished")
+	}
+	return result, err
+}
+
+// execute dispatches a tool call
+func (t *ChatTools) execute(ctx context.Context, sessionID string, call ChatToolCall) (interface{}, error) {
+
+	args := call.Arguments
+	switch call.Name {
+	case "browser_navigate":
+		url, ok := args["url"].(string)
+		if !ok {
+			return nil, fmt.Errorf("url argument required")
+		}
+		if err := t.browserMgr.Navigate(url); err != nil {
+			return nil, fmt.Errorf("navigation failed: %w", err)
+		}
+		return map[string]interface{}{"success": true, "url": t.browserMgr.GetCurrentURL()}, nil
+
+	case "browser_read":
+		title, _ := t.browserMgr.GetPageTitle()
+		text, err := t.browserMgr.ExecuteScript("document.body ? document.body.innerText : ''")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page: %w", err)
+		}
+		return map[string]interface{}{"title": title, "url": t.browserMgr.GetCurrentURL(), "text": text}, nil
+
+	case "browser_click":
+		selector, ok := args["selector"].(string)
+		if !ok {
+			return nil, fmt.Errorf("selector argument required")
+		}
+		if err := t.browserMgr.ClickBySelector(selector); err != nil {
+			return nil, fmt.Errorf("click failed: %w", err)
+		}
+		return map[string]interface{}{"success": true}, nil
+
+	case "browser_type":
+		selector, ok := args["selector"].(string)
+		if !ok {
+			return nil, fmt.Errorf("selector argument required")
+		}
+		text, ok := args["text"].(string)
+		if !ok {
+			return nil, fmt.Errorf("text argument required")
+		}
+		if err := t.browserMgr.TypeBySelector(selector, text); err != nil {
+			return nil, fmt.Errorf("type failed: %w", err)
+		}
+		return map[string]interface{}{"success": true}, nil
+
+	case "terminal_execute":
+		command, ok := args["command"].(string)
+		if !ok {
+			return nil, fmt.Errorf("command argument required")
+		}
+		output, err := t.terminalMgr.ExecuteInSessionWithContext(ctx, "chat-"+sessionID, command)
+		if err != nil {
+			return nil, fmt.Errorf("command execution failed: %w", err)
+		}
+		return map[string]interface{}{"output": output}, nil
+
+	case "mcp_list_tools":
+		server, _ := args["server"].(string)
+		if server == "" {
+			return map[string]interface{}{"servers": t.mcpClient.ListServers()}, nil
+		}
+		tools, err := t.mcpClient.ListTools(server)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"server": server, "tools": tools}, nil
+
+	case "mcp_call":
+		server, _ := args["server"].(string)
+		tool, _ := args["tool"].(string)
+		if server == "" || tool == "" {
+			return nil, fmt.Errorf("server and tool arguments required")
+		}
+		toolArgs, _ := args["arguments"].(map[string]interface{})
+		result, err := t.mcpClient.CallTool(server, tool, toolArgs)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Success {
+			return nil, fmt.Errorf("%s", result.Error)
+		}
+		return result.Result, nil
+
+	default:
+		return nil, fmt.Errorf("unknown tool: %s", call.Name)
+	}
+}
+
+// chatToolPrompt tells the model which tools it has and how to call them
+func chatToolPrompt(tools []ChatTool) string {
+	var b strings.Builder
+	b.WriteString("\n\nYou can use these tools:\n")
+	for _, tool := range tools {
+		names := make([]string, 0, len(tool.Parameters))
+		for name := range tool.Parameters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(&b, "- %s: %s", tool.Name, tool.Description)
+		for i, name := range names {
+			if i == 0 {
+				b.WriteString(" (")
+			} else {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s: %s", name, tool.Parameters[name])
+		}
+		if len(names) > 0 {
+			b.WriteString(")")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\nTo call a tool, write a line like:\n")
+	b.WriteString(`<tool_call>{"name": "terminal_execute", "arguments": {"command": "ls"}}</tool_call>`)
+	b.WriteString("\nthen stop and wait; the results come back in the next message. ")
+	b.WriteString("Answer without tool calls once you have what you need.")
+	return b.String()
+}
+
+// parseToolCalls returns the tool calls in a model reply. Calls that aren't
+// valid JSON are returned with an empty name so the model is told.
+func parseToolCalls(reply string) []ChatToolCall {
+	matches := chatToolCallPattern.FindAllStringSubmatch(reply, -1)
+	calls := make([]ChatToolCall, 0, len(matches))
+	for _, match := range matches {
+		var call ChatToolCall
+		if err := json.Unmarshal([]byte(match[1]), &call); err != nil {
+			call = ChatToolCall{}
+		}
+		if call.Arguments == nil {
+			call.Arguments = map[string]interface{}{}
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// nativeToolCalls converts the tool calls a model made through the API.
+// Calls with arguments that aren't a JSON object get none, so the tool
+// reports what's missing.
+func nativeToolCalls(calls []ollama.ToolCall) []ChatToolCall {
+	converted := make([]ChatToolCall, 0, len(calls))
+	for _, call := range calls {
+		args, _ := call.Args()
+		converted = append(converted, ChatToolCall{ID: call.ID, Name: call.Function.Name, Arguments: args})
+	}
+	return converted
+}
+
+// formatToolResult renders a tool's result for the model, wrapped in a
+// tool_result tag when it was called in the reply's text
+func formatToolResult(call ChatToolCall, result interface{}, err error) string {
+	body := toolResultBody(result, err)
+	if call.ID != "" {
+		return body
+	}
+	return fmt.Sprintf("<tool_result name=%q>%s</tool_result>", call.Name, body)
+}
+
+// toolResultBody renders a tool's result or error, truncated to
+// maxChatToolOutput
+func toolResultBody(result interface{}, err error) string {
+	var body string
+	if err != nil {
+		body = "error: " + err.Error()
+	} else if data, marshalErr := json.Marshal(result); marshalErr != nil {
+		body = fmt.Sprintf("%v", result)
+	} else {
+		body = string(data)
+	}
+	if len(body) > maxChatToolOutput {
+		body = body[:maxChatToolOutput] + "... (truncated)"
+	}
+	return body
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// closeWriteTimeout bounds sending a close notice to a client
+	closeWriteTimeout = time.Second
+	// drainTimeout is how long a client has to answer a close notice before
+	// the server stops reading from it
+	drainTimeout = 5 * time.Second
+	// shutdownReason is the close reason clients get when the server stops
+	shutdownReason = "server shutting down"
+)
+
+// hubLifecycle tracks a hub's run loop and connections so the hub can be
+// stopped and its connections drained
+type hubLifecycle struct {
+	mu       sync.Mutex
+	stopped  bool
+	conns    sync.WaitGroup // connections and the work they started
+	stop     chan struct{}  // closed to stop the run loop
+	done     chan struct{}  // closed once the run loop has exited
+	stopOnce sync.Once
+}
+
+func newHubLifecycle() *hubLifecycle {
+	return &hubLifecycle{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// join counts a new connection, or reports false once the hub is stopping
+func (l *hubLifecycle) join() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopped {
+		return false
+	}
+	l.conns.Add(1)
+	return true
+}
+
+// leave uncounts a connection or piece of work
+func (l *hubLifecycle) leave() {
+	l.conns.Done()
+}
+
+// shutdown stops the run loop, then waits for connections to finish until
+// ctx is done
+func (l *hubLifecycle) shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.stopped = true
+	l.mu.Unlock()
+	l.stopOnce.Do(func() { close(l.stop) })
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return fmt.Errorf("hub didn't stop: %w", ctx.Err())
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		l.conns.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("connections didn't drain: %w", ctx.Err())
+	}
+}
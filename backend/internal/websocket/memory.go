@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"agent-workspace/backend/pkg/jsonrpc"
+	"agent-workspace/backend/pkg/models"
+)
+
+// registerMemoryMethods exposes the memory REST API over JSON-RPC, scoped to
+// the session's workspace unless a call names another
+func (h *A2AHandler) registerMemoryMethods(router *jsonrpc.Router, session *a2aSession) {
+	// Store memory - agent calls "memory/store"
+	router.Register("memory/store", func(params map[string]interface{}) (interface{}, error) {
+		var req models.MemoryStoreRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+		if req.TaskID == "" {
+			req.TaskID = session.TaskID
+		}
+
+		ctx, cancel := context.WithTimeout(session.memoryContext(params), 60*time.Second)
+		defer cancel()
+
+		return h.memorySys.Store(ctx, req)
+	})
+
+	// Query memory - agent calls "memory/query"
+	router.Register("memory/query", func(params map[string]interface{}) (interface{}, error) {
+		var req models.MemoryQueryRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(session.memoryContext(params), 60*time.Second)
+		defer cancel()
+
+		return h.memorySys.Query(ctx, req)
+	})
+
+	// Delete memory - agent calls "memory/delete"
+	router.Register("memory/delete", func(params map[string]interface{}) (interface{}, error) {
+		var req models.MemoryDeleteRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(session.memoryContext(params), 60*time.Second)
+		defer cancel()
+
+		return h.memorySys.Delete(ctx, req)
+	})
+
+	// Rate a document - agent calls "memory/feedback"
+	router.Register("memory/feedback", func(params map[string]interface{}) (interface{}, error) {
+		var req models.MemoryFeedbackRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+
+		return h.memorySys.Feedback(session.memoryContext(params), req)
+	})
+
+	// List tasks - frontend calls "memory/tasks"
+	router.Register("memory/tasks", func(params map[string]interface{}) (interface{}, error) {
+		var req models.MemoryTaskListRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+
+		return h.memorySys.ListTasks(session.memoryContext(params), req)
+	})
+
+	// Get task - frontend calls "memory/task"
+	router.Register("memory/task", func(params map[string]interface{}) (interface{}, error) {
+		taskID, ok := params["task_id"].(string)
+		if !ok {
+			taskID = session.TaskID
+		}
+
+		return h.memorySys.GetTask(session.memoryContext(params), taskID)
+	})
+}
+
+// decodeParams converts JSON-RPC params into a typed request
+func decodeParams(params map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/internal/auth"
+	"agent-workspace/backend/pkg/models"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+)
+
+// maxUserName bounds the name a client picks for itself
+const maxUserName = 64
+
+// Chat transports, as presence reports them
+const (
+	transportWebSocket = "websocket"
+	transportSSE       = "sse"
+)
+
+// chatPeer is who a chat connection belongs to, the last broadcast before
+// it joined and the task it's viewing. The hub's lock guards task.
+type chatPeer struct {
+	id        string
+	user      string
+	transport string
+	since     time.Time
+	joined    uint64
+	task      string // broadcasts scoped to this task reach the connection
+}
+
+// newChatPeer names a connection after the caller's principal, or when
+// auth is off the user it asks to be, or a guest name
+func newChatPeer(c fiber.Ctx, transport, user, task string) *chatPeer {
+	peer := &chatPeer{
+		id:        uuid.New().String(),
+		transport: transport,
+		since:     time.Now().UTC(),
+		task:      task,
+	}
+	if principal := auth.FromContext(c); principal != nil && principal.Via != auth.ViaDisabled {
+		peer.user = principal.Name
+	} else if user = strings.TrimSpace(user); user != "" && len(user) <= maxUserName {
+		peer.user = user
+	} else {
+		peer.user = "guest-" + peer.id[:8]
+	}
+	return peer
+}
+
+// sees reports whether a broadcast scoped to task, or to everyone when
+// task is empty, reaches the peer
+func (p *chatPeer) sees(task string) bool {
+	return task == "" || task == p.task
+}
+
+func (p *chatPeer) presence() models.Presence {
+	return models.Presence{
+		ConnectionID: p.id,
+		User:         p.user,
+		TaskID:       p.task,
+		Transport:    p.transport,
+		Since:        p.since,
+	}
+}
+
+// Presence lists everyone connected to chat and the task each is viewing,
+// longest connected first
+func (h *Handler) Presence() []models.Presence {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.roster()
+}
+
+// roster lists the connected peers; callers hold h.mu
+func (h *Handler) roster() []models.Presence {
+	users := make([]models.Presence, 0, len(h.clients)+len(h.streams))
+	for _, peer := range h.clients {
+		users = append(users, peer.presence())
+	}
+	for _, stream := range h.streams {
+		users = append(users, stream.peer.presence())
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].Since.Equal(users[j].Since) {
+			return users[i].Since.Before(users[j].Since)
+		}
+		return users[i].ConnectionID < users[j].ConnectionID
+	})
+	return users
+}
+
+// announce tells every client but except about peer joining, leaving or
+// switching tasks, with the whole roster; callers hold h.mu. Presence isn't
+// numbered or replayed, since each announcement and welcome carries the
+// roster.
+func (h *Handler) announce(event string, peer, except *chatPeer) {
+	h.deliver(models.Message{
+		ID:        uuid.New().String(),
+		Type:      "presence",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Source:    "system",
+		Payload: map[string]interface{}{
+			"event":         event,
+			"connection_id": peer.id,
+			"user":          peer.user,
+			"task_id":       peer.task,
+			"users":         h.roster(),
+		},
+	}, "", except)
+}
+
+// viewTask switches the task a connection is viewing to payload.task_id,
+// or to none when it's empty, and announces the switch
+func (h *Handler) viewTask(peer *chatPeer, msg models.Message) {
+	taskID, _ := msg.Payload["task_id"].(string)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if peer.task == taskID {
+		return
+	}
+	peer.task = taskID
+	h.announce("viewing", peer, nil)
+}
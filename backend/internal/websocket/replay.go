@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// defaultReplayBuffer is how many messages each topic keeps for clients
+// that reconnect
+const defaultReplayBuffer = 256
+
+// ReplayBufferFromEnv reads WS_REPLAY_BUFFER, how many messages each topic
+// keeps for clients that reconnect; 0 keeps none
+func ReplayBufferFromEnv() int {
+	value := os.Getenv("WS_REPLAY_BUFFER")
+	if value == "" {
+		return defaultReplayBuffer
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		slog.Warn("ignoring invalid WS_REPLAY_BUFFER", "value", value)
+		return defaultReplayBuffer
+	}
+	return size
+}
+
+// replayed is a message a replay buffer kept
+type replayed[T any] struct {
+	seq   uint64
+	scope string // the session it was published to, or "" for everyone
+	msg   T
+}
+
+// replayBuffer numbers the messages published on each topic and keeps the
+// last few, so a client that reconnects can catch up on the ones it
+// missed. Sequence numbers start over when the server restarts; the epoch
+// tells one run from the next.
+type replayBuffer[T any] struct {
+	mu    sync.Mutex
+	size  int
+	epoch string
+	seqs  map[string]uint64
+	kept  map[string][]replayed[T]
+}
+
+func newReplayBuffer[T any](size int) *replayBuffer[T] {
+	return &replayBuffer[T]{
+		size:  size,
+		epoch: uuid.New().String(),
+		seqs:  make(map[string]uint64),
+		kept:  make(map[string][]replayed[T]),
+	}
+}
+
+// add numbers the next message on topic, has stamp build it with its
+// sequence number and keeps it for scope
+func (b *replayBuffer[T]) add(topic, scope string, stamp func(seq uint64) T) T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seqs[topic]++
+	msg := stamp(b.seqs[topic])
+	if b.size == 0 {
+		return msg
+	}
+
+	kept := append(b.kept[topic], replayed[T]{seq: b.seqs[topic], scope: scope, msg: msg})
+	if len(kept) > b.size {
+		kept = kept[len(kept)-b.size:]
+	}
+	b.kept[topic] = kept
+	return msg
+}
+
+// last returns the sequence number of the last message on topic
+func (b *replayBuffer[T]) last(topic string) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seqs[topic]
+}
+
+// since returns the kept messages on topic numbered after after and up to
+// until that were published to scope or everyone, and whether any in that
+// range were dropped before they could be replayed
+func (b *replayBuffer[T]) since(topic, scope string, after, until uint64) ([]T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if after >= until {
+		return nil, true
+	}
+	kept := b.kept[topic]
+	complete := len(kept) > 0 && kept[0].seq <= after+1
+
+	var msgs []T
+	for _, entry := range kept {
+		if entry.seq <= after || entry.seq > until {
+			continue
+		}
+		if entry.scope == "" || entry.scope == scope {
+			msgs = append(msgs, entry.msg)
+		}
+	}
+	return msgs, complete
+}
+
+// seqParam reads a sequence number a client sent as a JSON number
+func seqParam(value interface{}) (uint64, bool) {
+	n, ok := value.(float64)
+	if !ok || n < 0 || n != float64(uint64(n)) {
+		return 0, false
+	}
+	return uint64(n), true
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/internal/watchdog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/websocket/v3"
+)
+
+// HandleWatchdogWebSocket streams watchdog events to the UI. Clients may
+// filter with ?types=alert_created,scan_finished and resume after a
+// reconnect with ?since=<last event id>.
+func HandleWatchdogWebSocket(bus *watchdog.EventBus) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var types []string
+		for _, eventType := range strings.Split(c.Query("types"), ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				types = append(types, eventType)
+			}
+		}
+		since, _ := strconv.ParseUint(c.Query("since"), 10, 64)
+
+		return websocket.New(func(conn *websocket.Conn) {
+			events, cancel := bus.Subscribe(since, types...)
+			defer cancel()
+
+			// The client only talks to close the connection
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+							slog.Warn("watchdog WebSocket error", "error", err)
+						}
+						return
+					}
+				}
+			}()
+
+			ticker := time.NewTicker(30 * time.Second)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case event := <-events:
+					if err := conn.WriteJSON(event); err != nil {
+						return
+					}
+				case <-ticker.C:
+					if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		})(c)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build embedui
+
+package webui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// dist is frontend/dist, copied here before building; see scripts/build-binary.sh
+//
+//go:embed all:dist
+var dist embed.FS
+
+func init() {
+	assets, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	embedded = assets
+}
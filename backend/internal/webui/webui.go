@@ -0,0 +1,127 @@
+// Package webui serves the built frontend from the API server, so a single
+// binary can serve both. A binary built with -tags embedui carries the build
+// copied to internal/webui/dist; WEBUI_DIR serves one from disk instead.
+package webui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// ErrNoAssets is returned by Assets when there's no build to serve
+var ErrNoAssets = errors.New("no frontend build: build with -tags embedui or set WEBUI_DIR")
+
+// embedded is the build compiled into the binary, or nil
+var embedded fs.FS
+
+// Config sets whether and from where the frontend is served
+type Config struct {
+	Enabled bool   // WEBUI_ENABLED, true by default; nothing is served without a build
+	Dir     string // WEBUI_DIR: a build on disk, served instead of the embedded one
+}
+
+// ConfigFromEnv reads WEBUI_ENABLED and WEBUI_DIR
+func ConfigFromEnv() (Config, error) {
+	config := Config{Enabled: true, Dir: os.Getenv("WEBUI_DIR")}
+	if value := os.Getenv("WEBUI_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid WEBUI_ENABLED %q, expected true or false", value)
+		}
+		config.Enabled = enabled
+	}
+	return config, nil
+}
+
+// Embedded reports whether the binary carries a frontend build
+func Embedded() bool {
+	return embedded != nil
+}
+
+// Assets returns the build to serve and where it comes from: WEBUI_DIR's,
+// or the embedded one
+func Assets(config Config) (fs.FS, string, error) {
+	if config.Dir != "" {
+		assets := os.DirFS(config.Dir)
+		if _, err := fs.Stat(assets, "index.html"); err != nil {
+			return nil, "", fmt.Errorf("failed to read WEBUI_DIR %s: %w", config.Dir, err)
+		}
+		return assets, config.Dir, nil
+	}
+	if embedded == nil {
+		return nil, "", ErrNoAssets
+	}
+	if _, err := fs.Stat(embedded, "index.html"); err != nil {
+		return nil, "", fmt.Errorf("embedded frontend build has no index.html: %w", err)
+	}
+	return embedded, "embedded build", nil
+}
+
+// Handler serves assets to GET and HEAD requests outside the reserved path
+// prefixes. Paths that aren't files get index.html, so the app's own
+// routes survive a reload; missing files with an extension fall through to
+// the next handler. Vite's hashed files under assets/ are cached for good,
+// everything else is revalidated.
+func Handler(assets fs.FS, reserved ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		method := c.Method()
+		if method != fiber.MethodGet && method != fiber.MethodHead {
+			return c.Next()
+		}
+		// Fiber routes paths whatever their case, so /API/... is reserved too
+		requested := strings.ToLower(c.Path())
+		for _, prefix := range reserved {
+			prefix = strings.ToLower(prefix)
+			if requested == prefix || strings.HasPrefix(requested, prefix+"/") {
+				return c.Next()
+			}
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+c.Path()), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		data, err := readFile(assets, name)
+		if err != nil {
+			if path.Ext(name) != "" {
+				return c.Next()
+			}
+			name = "index.html"
+			if data, err = readFile(assets, name); err != nil {
+				return c.Next()
+			}
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = fiber.MIMEOctetStream
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		if strings.HasPrefix(name, "assets/") {
+			c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+		} else {
+			c.Set(fiber.HeaderCacheControl, "no-cache")
+		}
+		return c.Send(data)
+	}
+}
+
+// readFile reads a regular file, failing for directories
+func readFile(assets fs.FS, name string) ([]byte, error) {
+	info, err := fs.Stat(assets, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fs.ErrNotExist
+	}
+	return fs.ReadFile(assets, name)
+}
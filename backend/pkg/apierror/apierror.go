@@ -0,0 +1,94 @@
+package apierror
+
+import (
+	"errors"
+
+	"agent-workspace/backend/pkg/logging"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Error codes, one per HTTP status the API fails with
+const (
+	InvalidRequest       = "invalid_request"
+	Unauthorized         = "unauthorized"
+	Forbidden            = "forbidden"
+	NotFound             = "not_found"
+	MethodNotAllowed     = "method_not_allowed"
+	Conflict             = "conflict"
+	PayloadTooLarge      = "payload_too_large"
+	UnsupportedMediaType = "unsupported_media_type"
+	Unprocessable        = "unprocessable"
+	UpgradeRequired      = "upgrade_required"
+	RateLimited          = "rate_limited"
+	Internal             = "internal"
+	Unavailable          = "unavailable"
+)
+
+// codes names each status's error code
+var codes = map[int]string{
+	400: InvalidRequest,
+	401: Unauthorized,
+	403: Forbidden,
+	404: NotFound,
+	405: MethodNotAllowed,
+	409: Conflict,
+	413: PayloadTooLarge,
+	415: UnsupportedMediaType,
+	422: Unprocessable,
+	426: UpgradeRequired,
+	429: RateLimited,
+	500: Internal,
+	503: Unavailable,
+}
+
+// Error describes why a request failed
+type Error struct {
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// Envelope is the body of every failed API response
+type Envelope struct {
+	Error Error `json:"error"`
+}
+
+// Code returns the error code for an HTTP status
+func Code(status int) string {
+	if code, ok := codes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return InvalidRequest
+}
+
+// Send fails a request with status and message
+func Send(c fiber.Ctx, status int, message string) error {
+	return SendDetails(c, status, message, nil)
+}
+
+// SendDetails fails a request with status and message, and details a client
+// can act on, such as a conflicting file's merge result
+func SendDetails(c fiber.Ctx, status int, message string, details map[string]interface{}) error {
+	return c.Status(status).JSON(Envelope{Error: Error{
+		Code:      Code(status),
+		Message:   message,
+		Details:   details,
+		RequestID: logging.RequestIDFrom(c),
+	}})
+}
+
+// Handler is the app's error handler: errors handlers return instead of
+// responding, like unknown routes, get the envelope too
+func Handler(c fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	}
+	return Send(c, status, err.Error())
+}
@@ -37,6 +37,13 @@ const (
 	MethodNotFound = -32601
 	InvalidParams  = -32602
 	InternalError  = -32603
+
+	// Forbidden is a server error: the caller's scope doesn't cover the method
+	Forbidden = -32003
+	// ServerBusy is a server error: the connection has too many requests queued
+	ServerBusy = -32004
+	// RateLimited is a server error: the connection sent requests faster than its rate limit
+	RateLimited = -32005
 )
 
 // NewRequest creates a new JSON-RPC 2.0 request
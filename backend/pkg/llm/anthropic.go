@@ -0,0 +1,443 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/ollama"
+)
+
+const (
+	// anthropicBaseURL is where Anthropic's API is
+	anthropicBaseURL = "https://api.anthropic.com"
+	// anthropicVersion is the API version requests are written for
+	anthropicVersion = "2023-06-01"
+	// anthropicMaxTokens limits replies when the role sets no limit; the
+	// API requires one
+	anthropicMaxTokens = 4096
+)
+
+// anthropicProvider serves a role through Anthropic's Messages API
+type anthropicProvider struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	maxTokens  int
+	httpClient *http.Client
+}
+
+// newAnthropic creates a provider for Anthropic's Messages API
+func newAnthropic(config RoleConfig) *anthropicProvider {
+	provider := &anthropicProvider{
+		baseURL:   strings.TrimSuffix(config.BaseURL, "/v1"),
+		apiKey:    config.APIKey,
+		model:     config.Model,
+		maxTokens: config.MaxTokens,
+		// Requests are timed out by the role's Policy
+		httpClient: &http.Client{},
+	}
+	if provider.baseURL == "" {
+		provider.baseURL = anthropicBaseURL
+	}
+	if provider.maxTokens == 0 {
+		provider.maxTokens = anthropicMaxTokens
+	}
+	return provider
+}
+
+// anthropicRequest is a Messages API request
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	System      string               `json:"system,omitempty"`
+	Messages    []anthropicMessage   `json:"messages"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature *float64             `json:"temperature,omitempty"`
+	TopP        float64              `json:"top_p,omitempty"`
+	TopK        int                  `json:"top_k,omitempty"`
+	Stop        []string             `json:"stop_sequences,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"` // user or assistant
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a piece of a message: text, image, tool_use or tool_result
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *anthropicImage `json:"source,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicImage struct {
+	Type      string `json:"type"` // always base64
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"` // auto, any, tool or none
+	Name string `json:"name,omitempty"`
+}
+
+// anthropicResponse is a Messages API response
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicEvent is one event of a streamed response
+type anthropicEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *anthropicResponse `json:"message,omitempty"`       // message_start
+	ContentBlock *anthropicBlock    `json:"content_block,omitempty"` // content_block_start
+	Delta        struct {
+		Type        string `json:"type"` // text_delta or input_json_delta
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"` // message_delta
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage,omitempty"` // message_delta
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (p *anthropicProvider) Name() string        { return ProviderAnthropic }
+func (p *anthropicProvider) Model() string       { return p.model }
+func (p *anthropicProvider) EmbedModel() string  { return "" }
+func (p *anthropicProvider) VisionModel() string { return p.model }
+func (p *anthropicProvider) SupportsTools() bool { return true }
+
+func (p *anthropicProvider) ChatCompletion(ctx context.Context, req Request) (*ollama.ChatCompletionResponse, error) {
+	resp, err := p.send(ctx, p.request(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var answer anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	message := ollama.ChatMessage{Role: "assistant"}
+	var text []string
+	for _, block := range answer.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, toolCall(len(message.ToolCalls), block.ID, block.Name, string(block.Input)))
+		}
+	}
+	message.Content = strings.Join(text, "")
+
+	return &ollama.ChatCompletionResponse{
+		ID:      answer.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   answer.Model,
+		Choices: []ollama.Choice{{Message: message, FinishReason: finishReason(answer.StopReason)}},
+		Usage:   usage(answer.Usage),
+	}, nil
+}
+
+func (p *anthropicProvider) Stream(ctx context.Context, req Request, callback func(string) error) (*ollama.StreamResult, error) {
+	resp, err := p.send(ctx, p.request(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Events are server-sent: message_start carries the prompt's usage,
+	// content blocks then start, grow by deltas and stop, message_delta
+	// carries why the reply stopped and message_stop ends it
+	result := &ollama.StreamResult{}
+	var tokens anthropicUsage
+	calls := map[int]*ollama.ToolCall{}
+	var order []int
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+		switch event.Type {
+		case "error":
+			if event.Error != nil {
+				return nil, fmt.Errorf("anthropic stream error: %s", event.Error.Message)
+			}
+			return nil, fmt.Errorf("anthropic stream error")
+		case "message_start":
+			if event.Message != nil {
+				tokens.InputTokens = event.Message.Usage.InputTokens
+			}
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				call := toolCall(len(order), event.ContentBlock.ID, event.ContentBlock.Name, "")
+				calls[event.Index] = &call
+				order = append(order, event.Index)
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				if event.Delta.Text != "" {
+					if err := callback(event.Delta.Text); err != nil {
+						return nil, err
+					}
+				}
+			case "input_json_delta":
+				if call, ok := calls[event.Index]; ok {
+					call.Function.Arguments += event.Delta.PartialJSON
+				}
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				result.FinishReason = finishReason(event.Delta.StopReason)
+			}
+			if event.Usage != nil {
+				tokens.OutputTokens = event.Usage.OutputTokens
+			}
+		}
+		if event.Type == "message_stop" {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("stream cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	for _, index := range order {
+		call := calls[index]
+		if call.Function.Arguments == "" {
+			call.Function.Arguments = "{}"
+		}
+		result.ToolCalls = append(result.ToolCalls, *call)
+	}
+	result.Usage = usage(tokens)
+	return result, nil
+}
+
+func (p *anthropicProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	return nil, fmt.Errorf("%w: anthropic has no embeddings API", ErrUnsupported)
+}
+
+func (p *anthropicProvider) Vision(ctx context.Context, prompt string, images [][]byte, temperature float64) (*ollama.ChatCompletionResponse, error) {
+	message := ollama.ChatMessage{Role: "user", Content: prompt}
+	for _, image := range images {
+		message.Images = append(message.Images, ollama.EncodeImage(image))
+	}
+	return p.ChatCompletion(ctx, Request{Messages: []ollama.ChatMessage{message}, Temperature: temperature})
+}
+
+// request converts a Request to the Messages API's. System messages
+// become the system prompt, tool results user messages and tool calls
+// tool_use blocks; messages in a row from the same role are merged, as
+// the API expects them to alternate.
+func (p *anthropicProvider) request(req Request, stream bool) anthropicRequest {
+	// The API takes temperatures up to 1
+	temperature := min(req.Temperature, 1)
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = p.maxTokens
+	}
+	converted := anthropicRequest{
+		Model:       p.model,
+		MaxTokens:   maxTokens,
+		Temperature: &temperature,
+		TopP:        req.Options.TopP,
+		TopK:        req.Options.TopK,
+		Stop:        req.Options.Stop,
+		Stream:      stream,
+	}
+
+	var system []string
+	for _, msg := range req.Messages {
+		role, blocks := "user", []anthropicBlock(nil)
+		switch msg.Role {
+		case "system":
+			system = append(system, msg.Content)
+			continue
+		case "tool":
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		case "assistant":
+			role = "assistant"
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+		default:
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, image := range msg.Images {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: imageSource(image)})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if last := len(converted.Messages) - 1; last >= 0 && converted.Messages[last].Role == role {
+			converted.Messages[last].Content = append(converted.Messages[last].Content, blocks...)
+			continue
+		}
+		converted.Messages = append(converted.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	converted.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		converted.Tools = append(converted.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: tool.Function.Parameters,
+		})
+	}
+	if len(converted.Tools) > 0 {
+		converted.ToolChoice = toolChoice(req.ToolChoice)
+	}
+	return converted
+}
+
+// send posts a request to the Messages API, returning the response when
+// it succeeded
+func (p *anthropicProvider) send(ctx context.Context, req anthropicRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("request cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &ollama.APIError{API: ProviderAnthropic, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return resp, nil
+}
+
+// toolChoice converts a v1 tool_choice to the Messages API's
+func toolChoice(choice interface{}) *anthropicToolChoice {
+	switch choice := choice.(type) {
+	case string:
+		switch choice {
+		case "required":
+			return &anthropicToolChoice{Type: "any"}
+		case "none":
+			return &anthropicToolChoice{Type: "none"}
+		}
+	case map[string]interface{}:
+		if function, ok := choice["function"].(map[string]interface{}); ok {
+			if name, ok := function["name"].(string); ok {
+				return &anthropicToolChoice{Type: "tool", Name: name}
+			}
+		}
+	}
+	return &anthropicToolChoice{Type: "auto"}
+}
+
+// toolCall makes a v1 tool call of a tool_use block
+func toolCall(index int, id, name, arguments string) ollama.ToolCall {
+	return ollama.ToolCall{
+		Index:    index,
+		ID:       id,
+		Type:     "function",
+		Function: ollama.ToolCallFunction{Name: name, Arguments: arguments},
+	}
+}
+
+// finishReason converts a stop reason to the v1 API's finish reason
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "":
+		return ""
+	default: // end_turn, stop_sequence
+		return "stop"
+	}
+}
+
+// usage converts token counts to the v1 API's
+func usage(tokens anthropicUsage) ollama.Usage {
+	return ollama.Usage{
+		PromptTokens:     tokens.InputTokens,
+		CompletionTokens: tokens.OutputTokens,
+		TotalTokens:      tokens.InputTokens + tokens.OutputTokens,
+	}
+}
+
+// imageSource makes an image block's source of a base64 image or data: URL
+func imageSource(image string) *anthropicImage {
+	if rest, ok := strings.CutPrefix(image, "data:"); ok {
+		mediaType, data, _ := strings.Cut(rest, ";base64,")
+		return &anthropicImage{Type: "base64", MediaType: mediaType, Data: data}
+	}
+	// 344 characters decode to the 258 bytes that sniffing looks at
+	head, _ := base64.StdEncoding.DecodeString(image[:min(len(image), 344)])
+	return &anthropicImage{Type: "base64", MediaType: http.DetectContentType(head), Data: image}
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// cacheRequestsTotal counts the completions looked up in the cache, by
+// whether they were found
+var cacheRequestsTotal = metrics.NewCounterVec("llm_cache_requests_total",
+	"LLM chat completions looked up in the response cache", "provider", "result")
+
+// CacheConfig sets which chat completions are cached and for how long
+type CacheConfig struct {
+	TTL time.Duration // how long a reply is reused; nothing is cached when 0
+	// MaxTemperature is the highest temperature a request may have to be
+	// cached; replies above it are meant to vary
+	MaxTemperature float64
+	MaxEntries     int // replies kept, the least recently used dropped first
+}
+
+// DefaultCacheConfig caches nothing; set a TTL to turn the cache on
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{MaxTemperature: 0.3, MaxEntries: 1000}
+}
+
+// cached answers the same low-temperature chat completion from the cache
+// until it expires, instead of asking the model again
+type cached struct {
+	Provider
+	config CacheConfig
+}
+
+func (c cached) ChatCompletion(ctx context.Context, req Request) (*ollama.ChatCompletionResponse, error) {
+	// Samples are asked for to differ
+	if req.Temperature > c.config.MaxTemperature || req.N > 0 {
+		return c.Provider.ChatCompletion(ctx, req)
+	}
+	key, err := cacheKey(c.Name(), c.Model(), req)
+	if err != nil {
+		return c.Provider.ChatCompletion(ctx, req)
+	}
+
+	if resp, ok := responses.get(key); ok {
+		cacheRequestsTotal.Inc(c.Name(), "hit")
+		// The reply used no tokens this time
+		resp.Usage = ollama.Usage{}
+		return resp, nil
+	}
+	cacheRequestsTotal.Inc(c.Name(), "miss")
+
+	resp, err := c.Provider.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// A reply cut short by the token limit isn't worth repeating
+	if len(resp.Choices) > 0 && resp.Choices[0].FinishReason != "length" {
+		responses.put(key, resp, c.config)
+	}
+	return resp, nil
+}
+
+// cacheKey hashes what a reply depends on: the API, the model and the
+// whole request
+func cacheKey(provider, model string, req Request) (string, error) {
+	data, err := json.Marshal(struct {
+		Provider string
+		Model    string
+		Request  Request
+	}{provider, model, req})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cacheEntry is a reply kept as JSON, so each hit decodes its own copy
+type cacheEntry struct {
+	key     string
+	reply   []byte
+	expires time.Time
+}
+
+// responseCache keeps replies by key, least recently used at the back
+type responseCache struct {
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// responses is the cache every role shares; its keys name the model
+var responses = &responseCache{order: list.New(), entries: make(map[string]*list.Element)}
+
+// get returns the reply under key unless it has expired
+func (c *responseCache) get(key string) (*ollama.ChatCompletionResponse, bool) {
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	reply := entry.reply
+	c.mu.Unlock()
+
+	var resp ollama.ChatCompletionResponse
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return nil, false
+	}
+	return &resp, true
+}
+
+// put keeps a reply for config's TTL, dropping the least recently used
+// replies past config's limit
+func (c *responseCache) put(key string, resp *ollama.ChatCompletionResponse, config CacheConfig) {
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	entry := &cacheEntry{key: key, reply: reply, expires: time.Now().Add(config.TTL)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[key] = c.order.PushFront(entry)
+	}
+	for c.order.Len() > max(config.MaxEntries, 1) {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider names
+const (
+	ProviderOllama    = "ollama"
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+)
+
+// RoleConfig sets the API and model a role uses
+type RoleConfig struct {
+	Provider string // ollama, openai or anthropic
+	// BaseURL is the Ollama host, the OpenAI-compatible API's URL ending
+	// in /v1, or Anthropic's API URL; the provider's own when empty
+	BaseURL string
+	APIKey  string
+	// Model is the model the role uses; Ollama roles use the OLLAMA_*
+	// models when empty
+	Model     string
+	MaxTokens int // longest reply; Anthropic requires one
+	// ContextWindow is the tokens the model takes, prompts longer than it
+	// being compressed to fit. Ollama roles send it as num_ctx and take
+	// OLLAMA_NUM_CTX or the Modelfile's num_ctx when 0; other roles'
+	// prompts are unchecked when 0.
+	ContextWindow int
+	// FallbackModels take the role's requests in turn, through the same
+	// API, while the model's circuit is open or it can't serve them;
+	// requests fail fast when empty
+	FallbackModels []string
+	// Policy times out, retries and breaks the role's requests
+	Policy Policy
+	// Cache reuses the replies of the role's low-temperature completions
+	Cache CacheConfig
+}
+
+// Config sets the provider of each role and the policy they share
+type Config struct {
+	Planner  RoleConfig
+	Reasoner RoleConfig
+	Embedder RoleConfig
+	Policy   Policy
+	Cache    CacheConfig
+}
+
+// DefaultConfig gives every role to Ollama with the default policy
+func DefaultConfig() Config {
+	policy, cache := DefaultPolicy(), DefaultCacheConfig()
+	return Config{
+		Planner:  RoleConfig{Provider: ProviderOllama, Policy: policy, Cache: cache},
+		Reasoner: RoleConfig{Provider: ProviderOllama, Policy: policy, Cache: cache},
+		Embedder: RoleConfig{Provider: ProviderOllama, Policy: policy, Cache: cache},
+		Policy:   policy,
+		Cache:    cache,
+	}
+}
+
+// Role returns the configuration of role
+func (c Config) Role(role Role) RoleConfig {
+	switch role {
+	case RolePlanner:
+		return c.Planner
+	case RoleReasoner:
+		return c.Reasoner
+	default:
+		return c.Embedder
+	}
+}
+
+// ConfigFromEnv reads LLM_<ROLE>_PROVIDER (ollama, openai or anthropic;
+// default ollama), LLM_<ROLE>_BASE_URL, LLM_<ROLE>_API_KEY, LLM_<ROLE>_MODEL,
+// LLM_<ROLE>_MAX_TOKENS, LLM_<ROLE>_CONTEXT_WINDOW and
+// LLM_<ROLE>_FALLBACK_MODEL for the PLANNER, REASONER and EMBEDDER roles,
+// where either model setting may list models to fall back to in turn, and
+// the policy they share from LLM_TIMEOUT, LLM_EMBED_TIMEOUT,
+// LLM_MAX_RETRIES, LLM_RETRY_BACKOFF, LLM_BREAKER_THRESHOLD and
+// LLM_BREAKER_COOLDOWN, and the response cache
+// from LLM_CACHE_TTL, LLM_CACHE_MAX_TEMPERATURE and LLM_CACHE_MAX_ENTRIES.
+// Keys default to OPENAI_API_KEY or ANTHROPIC_API_KEY. The error lists
+// every problem found.
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	var errs []error
+	policy, err := policyFromEnv()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	config.Policy = policy
+	cache, err := cacheConfigFromEnv()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	config.Cache = cache
+	for _, role := range Roles {
+		roleConfig, err := roleConfigFromEnv(role)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		roleConfig.Policy = policy
+		roleConfig.Cache = cache
+		switch role {
+		case RolePlanner:
+			config.Planner = roleConfig
+		case RoleReasoner:
+			config.Reasoner = roleConfig
+		case RoleEmbedder:
+			config.Embedder = roleConfig
+		}
+	}
+	if len(errs) > 0 {
+		return DefaultConfig(), errors.Join(errs...)
+	}
+	return config, nil
+}
+
+// roleConfigFromEnv reads and checks one role's settings
+func roleConfigFromEnv(role Role) (RoleConfig, error) {
+	prefix := "LLM_" + strings.ToUpper(string(role)) + "_"
+	config := RoleConfig{
+		Provider:       strings.ToLower(strings.TrimSpace(os.Getenv(prefix + "PROVIDER"))),
+		BaseURL:        strings.TrimSuffix(os.Getenv(prefix+"BASE_URL"), "/"),
+		APIKey:         os.Getenv(prefix + "API_KEY"),
+		FallbackModels: splitList(os.Getenv(prefix + "FALLBACK_MODEL")),
+	}
+	// A list of models is a chain, each falling back to the next
+	if models := splitList(os.Getenv(prefix + "MODEL")); len(models) > 0 {
+		config.Model = models[0]
+		config.FallbackModels = append(models[1:], config.FallbackModels...)
+	}
+	if config.Provider == "" {
+		config.Provider = ProviderOllama
+	}
+	if value := os.Getenv(prefix + "MAX_TOKENS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return config, fmt.Errorf("invalid %sMAX_TOKENS %q, expected a positive number", prefix, value)
+		}
+		config.MaxTokens = parsed
+	}
+	if value := os.Getenv(prefix + "CONTEXT_WINDOW"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return config, fmt.Errorf("invalid %sCONTEXT_WINDOW %q, expected a number of tokens", prefix, value)
+		}
+		config.ContextWindow = parsed
+	}
+
+	switch config.Provider {
+	case ProviderOllama:
+	case ProviderOpenAI:
+		if config.APIKey == "" {
+			config.APIKey = os.Getenv("OPENAI_API_KEY")
+		}
+		if config.Model == "" {
+			return config, fmt.Errorf("required setting %sMODEL not set for provider openai", prefix)
+		}
+	case ProviderAnthropic:
+		if role == RoleEmbedder {
+			return config, fmt.Errorf("invalid %sPROVIDER anthropic, Anthropic has no embeddings API", prefix)
+		}
+		if config.APIKey == "" {
+			config.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+		}
+		if config.APIKey == "" {
+			return config, fmt.Errorf("required setting %sAPI_KEY or ANTHROPIC_API_KEY not set for provider anthropic", prefix)
+		}
+		if config.Model == "" {
+			return config, fmt.Errorf("required setting %sMODEL not set for provider anthropic", prefix)
+		}
+	default:
+		return config, fmt.Errorf("invalid %sPROVIDER %q, expected ollama, openai or anthropic", prefix, config.Provider)
+	}
+	return config, nil
+}
+
+// policyFromEnv reads the policy the roles share
+func policyFromEnv() (Policy, error) {
+	policy := DefaultPolicy()
+	for env, n := range map[string]*int{
+		"LLM_MAX_RETRIES":       &policy.MaxRetries,
+		"LLM_BREAKER_THRESHOLD": &policy.BreakerThreshold,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return DefaultPolicy(), fmt.Errorf("invalid %s %q, expected a number, 0 to turn it off", env, value)
+		}
+		*n = parsed
+	}
+
+	for env, duration := range map[string]*time.Duration{
+		"LLM_TIMEOUT":          &policy.Timeout,
+		"LLM_EMBED_TIMEOUT":    &policy.EmbedTimeout,
+		"LLM_RETRY_BACKOFF":    &policy.RetryBackoff,
+		"LLM_BREAKER_COOLDOWN": &policy.BreakerCooldown,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return DefaultPolicy(), fmt.Errorf("invalid %s %q, expected a duration such as 30s", env, value)
+		}
+		*duration = parsed
+	}
+	return policy, nil
+}
+
+// cacheConfigFromEnv reads the response cache's settings
+func cacheConfigFromEnv() (CacheConfig, error) {
+	config := DefaultCacheConfig()
+	if value := os.Getenv("LLM_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return DefaultCacheConfig(), fmt.Errorf("invalid LLM_CACHE_TTL %q, expected a duration such as 10m, 0 to turn it off", value)
+		}
+		config.TTL = parsed
+	}
+	if value := os.Getenv("LLM_CACHE_MAX_TEMPERATURE"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			return DefaultCacheConfig(), fmt.Errorf("invalid LLM_CACHE_MAX_TEMPERATURE %q, expected a temperature such as 0.3", value)
+		}
+		config.MaxTemperature = parsed
+	}
+	if value := os.Getenv("LLM_CACHE_MAX_ENTRIES"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return DefaultCacheConfig(), fmt.Errorf("invalid LLM_CACHE_MAX_ENTRIES %q, expected a positive number", value)
+		}
+		config.MaxEntries = parsed
+	}
+	return config, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,184 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+)
+
+// Priority orders the requests waiting for an Ollama host
+type Priority int
+
+const (
+	// PriorityBackground is for work nobody waits on, such as indexing,
+	// consolidation and watchdog checks
+	PriorityBackground Priority = iota
+	// PriorityNormal is for agent tasks, and requests without a priority
+	PriorityNormal
+	// PriorityInteractive is for chat a user is waiting on
+	PriorityInteractive
+)
+
+var priorityNames = [...]string{"background", "normal", "interactive"}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// queueWait tracks how long requests wait for a free slot on their host
+var queueWait = metrics.NewHistogramVec("ollama_queue_wait_seconds",
+	"Time requests waited for a free Ollama slot", nil, "host", "priority")
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose requests wait for an Ollama host
+// with priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityFrom returns the priority of ctx's requests, normal by default
+func priorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= PriorityBackground && p <= PriorityInteractive {
+		return p
+	}
+	return PriorityNormal
+}
+
+// limiter lets a host take a few requests at a time. The rest wait, the
+// highest priority first and then in the order they came; background
+// requests wait as long as others keep coming.
+type limiter struct {
+	host  string
+	limit int
+
+	mu      sync.Mutex
+	active  int
+	waiting [len(priorityNames)]*list.List // of chan struct{}, closed when the request may go
+}
+
+// limiters holds the limiter of each host, shared by every role using it
+var limiters = struct {
+	sync.Mutex
+	byHost map[string]*limiter
+}{byHost: make(map[string]*limiter)}
+
+// limiterFor returns a host's limiter, creating it with limit slots; nil,
+// which lets every request through, when limit is 0
+func limiterFor(host string, limit int) *limiter {
+	if limit <= 0 {
+		return nil
+	}
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l, ok := limiters.byHost[host]
+	if !ok {
+		l = &limiter{host: host, limit: limit}
+		for i := range l.waiting {
+			l.waiting[i] = list.New()
+		}
+		limiters.byHost[host] = l
+	}
+	return l
+}
+
+// acquire waits for a slot, or until ctx ends, and returns the function
+// that frees it
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	priority := priorityFrom(ctx)
+	start := time.Now()
+
+	l.mu.Lock()
+	if l.active < l.limit && l.queued() == 0 {
+		l.active++
+		l.mu.Unlock()
+		queueWait.Observe(0, l.host, priority.String())
+		return l.release, nil
+	}
+	ready := make(chan struct{})
+	element := l.waiting[priority].PushBack(ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		queueWait.Observe(time.Since(start).Seconds(), l.host, priority.String())
+		return l.release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		select {
+		case <-ready:
+			// The slot came as ctx ended; pass it on
+			l.mu.Unlock()
+			l.release()
+		default:
+			l.waiting[priority].Remove(element)
+			l.mu.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// release hands the slot to the next request waiting, or frees it
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for p := len(l.waiting) - 1; p >= 0; p-- {
+		if next := l.waiting[p].Front(); next != nil {
+			l.waiting[p].Remove(next)
+			close(next.Value.(chan struct{}))
+			return
+		}
+	}
+	l.active--
+}
+
+// queued counts the requests waiting; callers must hold l.mu
+func (l *limiter) queued() int {
+	count := 0
+	for _, waiting := range l.waiting {
+		count += waiting.Len()
+	}
+	return count
+}
+
+// registerLimiterMetrics adds gauges of each host's queue and slots in use
+// to registry
+func registerLimiterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ollama_queue_depth", "Requests waiting for a free Ollama slot",
+		[]string{"host", "priority"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			forEachLimiter(func(l *limiter) {
+				for p, waiting := range l.waiting {
+					samples = append(samples, metrics.Sample{Labels: []string{l.host, Priority(p).String()}, Value: float64(waiting.Len())})
+				}
+			})
+			return samples
+		})
+	registry.NewGaugeFunc("ollama_requests_active", "Requests using an Ollama slot",
+		[]string{"host"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			forEachLimiter(func(l *limiter) {
+				samples = append(samples, metrics.Sample{Labels: []string{l.host}, Value: float64(l.active)})
+			})
+			return samples
+		})
+}
+
+// forEachLimiter calls f with each limiter locked
+func forEachLimiter(f func(*limiter)) {
+	limiters.Lock()
+	defer limiters.Unlock()
+	for _, l := range limiters.byHost {
+		l.mu.Lock()
+		f(l)
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"context"
+	"strings"
+
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// openAIBaseURL is where OpenAI's own v1 API is
+const openAIBaseURL = "https://api.openai.com/v1"
+
+// clientProvider serves a role through an ollama.Client, which speaks
+// Ollama's chat API to Ollama and the OpenAI-compatible v1 API to other
+// servers
+type clientProvider struct {
+	name      string
+	client    *ollama.Client
+	maxTokens int
+}
+
+// newOpenAI creates a provider for an OpenAI-compatible API, such as
+// OpenAI's, vLLM's or LM Studio's
+func newOpenAI(config RoleConfig) *clientProvider {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = openAIBaseURL
+	}
+	// The client adds /v1 to each path itself
+	client := ollama.NewClientWithConfig(ollama.Config{
+		Host:        strings.TrimSuffix(baseURL, "/v1"),
+		Model:       config.Model,
+		EmbedModel:  config.Model,
+		VisionModel: config.Model,
+		NativeTools: true,
+		APIKey:      config.APIKey,
+		Pinned:      true,
+
+		OpenAICompatible: true,
+	})
+	return &clientProvider{name: ProviderOpenAI, client: client, maxTokens: config.MaxTokens}
+}
+
+func (p *clientProvider) Name() string        { return p.name }
+func (p *clientProvider) Model() string       { return p.client.GetModel() }
+func (p *clientProvider) EmbedModel() string  { return p.client.GetEmbedModel() }
+func (p *clientProvider) VisionModel() string { return p.client.GetVisionModel() }
+func (p *clientProvider) SupportsTools() bool { return p.client.SupportsTools() }
+
+func (p *clientProvider) ChatCompletion(ctx context.Context, req Request) (*ollama.ChatCompletionResponse, error) {
+	return p.client.Complete(ctx, p.request(req))
+}
+
+func (p *clientProvider) Stream(ctx context.Context, req Request, callback func(string) error) (*ollama.StreamResult, error) {
+	return p.client.CompleteStream(ctx, p.request(req), callback)
+}
+
+func (p *clientProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	return p.client.Embed(ctx, texts)
+}
+
+func (p *clientProvider) Vision(ctx context.Context, prompt string, images [][]byte, temperature float64) (*ollama.ChatCompletionResponse, error) {
+	return p.client.VisionCompletion(ctx, prompt, images, temperature)
+}
+
+// request converts a Request to the v1 API's
+func (p *clientProvider) request(req Request) ollama.ChatCompletionRequest {
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = p.maxTokens
+	}
+	converted := ollama.ChatCompletionRequest{
+		Messages:       req.Messages,
+		Temperature:    req.Temperature,
+		MaxTokens:      maxTokens,
+		Tools:          req.Tools,
+		ToolChoice:     req.ToolChoice,
+		ResponseFormat: req.ResponseFormat,
+		N:              req.N,
+		Logprobs:       req.Logprobs || req.TopLogprobs > 0,
+		TopLogprobs:    req.TopLogprobs,
+	}
+	req.Options.Apply(&converted)
+	// Other APIs turn down Ollama's own settings
+	if p.name != ProviderOllama {
+		converted.Options = nil
+		converted.KeepAlive = ""
+	}
+	return converted
+}
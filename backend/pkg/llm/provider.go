@@ -0,0 +1,292 @@
+// Package llm puts the model APIs the agent can use behind one interface.
+// Ollama, OpenAI-compatible servers and Anthropic each implement Provider,
+// and each role (planner, reasoner, embedder) is given the one its
+// configuration names. Messages, tools and results use the OpenAI-style
+// types of package ollama, which Ollama's v1 API shares.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// requestDuration tracks how long providers take to answer, by provider,
+// operation and outcome
+var requestDuration = metrics.NewHistogramVec("llm_request_duration_seconds",
+	"Time taken by LLM provider requests", nil, "provider", "operation", "status")
+
+// tokensTotal counts the tokens completions used, by provider and by
+// prompt or completion
+var tokensTotal = metrics.NewCounterVec("llm_tokens_total",
+	"Tokens used by LLM provider completions", "provider", "type")
+
+// ErrUnsupported is returned for an operation the provider's API lacks,
+// such as embeddings from Anthropic
+var ErrUnsupported = errors.New("not supported by provider")
+
+// Role is a job a model does for the agent
+type Role string
+
+const (
+	// RolePlanner plans tasks, picks actions and reads screenshots
+	RolePlanner Role = "planner"
+	// RoleReasoner answers chat and summarizes, reranks and drafts fixes
+	RoleReasoner Role = "reasoner"
+	// RoleEmbedder embeds memories for vector search
+	RoleEmbedder Role = "embedder"
+)
+
+// Roles lists every role
+var Roles = []Role{RolePlanner, RoleReasoner, RoleEmbedder}
+
+// Request is a chat completion request
+type Request struct {
+	Messages    []ollama.ChatMessage
+	Tools       []ollama.Tool
+	ToolChoice  interface{} // "auto", "none", "required" or a specific function
+	Temperature float64
+	MaxTokens   int // the provider's limit when 0
+	// ResponseFormat asks for JSON where the provider supports it
+	ResponseFormat *ollama.ResponseFormat
+	// Options override the provider's other generation settings; those it
+	// has no use for are left out
+	Options ollama.Options
+	// N is how many choices to sample; providers without it return one,
+	// and streams always do. See Sample.
+	N int
+	// Logprobs asks for each choice's token log probabilities, and
+	// TopLogprobs for as many alternatives to each token, where the
+	// provider has them
+	Logprobs    bool
+	TopLogprobs int
+}
+
+// Provider is a model API
+type Provider interface {
+	// Name is the kind of API: ollama, openai or anthropic
+	Name() string
+	// Model is the chat model completions go to
+	Model() string
+	// EmbedModel is the model Embed uses
+	EmbedModel() string
+	// VisionModel is the model Vision uses
+	VisionModel() string
+	// SupportsTools reports whether requests may offer tools
+	SupportsTools() bool
+
+	// ChatCompletion answers a request; the tool calls the model made are
+	// in the choice's Message.ToolCalls
+	ChatCompletion(ctx context.Context, req Request) (*ollama.ChatCompletionResponse, error)
+	// Stream answers a request, passing text to callback as it arrives,
+	// and returns the tool calls, finish reason and usage once it ends
+	Stream(ctx context.Context, req Request, callback func(string) error) (*ollama.StreamResult, error)
+	// Embed returns an embedding for each text
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+	// Vision asks the vision model about images; its answer is the first
+	// choice's message
+	Vision(ctx context.Context, prompt string, images [][]byte, temperature float64) (*ollama.ChatCompletionResponse, error)
+}
+
+// New creates the provider config names, timing out, retrying and
+// breaking its requests by config's policy and compressing prompts too
+// long for its context window. Ollama roles start from
+// ollamaConfig, taking the role's host and model when it sets them.
+func New(config RoleConfig, ollamaConfig ollama.Config) (Provider, error) {
+	if config.Policy == (Policy{}) {
+		config.Policy = DefaultPolicy()
+	}
+	provider, err := newProvider(config, ollamaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbacks := make([]Provider, 0, len(config.FallbackModels))
+	for _, model := range config.FallbackModels {
+		fallbackConfig := config
+		fallbackConfig.Model = model
+		fallback, err := newProvider(fallbackConfig, ollamaConfig)
+		if err != nil {
+			return nil, err
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	provider = resilient{Provider: provider, fallbacks: fallbacks, policy: config.Policy, limiter: roleLimiter(config, ollamaConfig)}
+	if window := contextWindow(config, ollamaConfig); window > 0 {
+		compressor := compressing{Provider: provider, window: window}
+		// Without a configured window, Ollama loads a model with its
+		// Modelfile's num_ctx or the server's default
+		if isOllama(config) && config.ContextWindow == 0 && ollamaConfig.Options.NumCtx == 0 {
+			compressor.modelWindows = newModelWindows(ollama.NewClientWithConfig(ollamaRoleConfig(config, ollamaConfig)))
+		}
+		provider = compressor
+	}
+	if config.Cache.TTL > 0 {
+		provider = cached{Provider: provider, config: config.Cache}
+	}
+	return provider, nil
+}
+
+// contextWindow returns the tokens a role's model takes, or 0 when
+// prompts aren't checked against it
+func contextWindow(config RoleConfig, ollamaConfig ollama.Config) int {
+	switch {
+	case config.ContextWindow > 0:
+		return config.ContextWindow
+	case !isOllama(config):
+		return 0
+	case ollamaConfig.Options.NumCtx > 0:
+		return ollamaConfig.Options.NumCtx
+	default:
+		return ollamaDefaultContext
+	}
+}
+
+// roleLimiter returns the limiter of the Ollama host a role uses, or nil
+// when it uses another API
+func roleLimiter(config RoleConfig, ollamaConfig ollama.Config) *limiter {
+	if !isOllama(config) {
+		return nil
+	}
+	host := ollamaConfig.Host
+	if config.BaseURL != "" {
+		host = config.BaseURL
+	}
+	return limiterFor(strings.TrimSuffix(host, "/"), ollamaConfig.MaxConcurrency)
+}
+
+// newProvider creates the provider config names, recording its requests
+func newProvider(config RoleConfig, ollamaConfig ollama.Config) (Provider, error) {
+	var provider Provider
+	switch config.Provider {
+	case "", ProviderOllama:
+		provider = &clientProvider{name: ProviderOllama, client: ollama.NewClientWithConfig(ollamaRoleConfig(config, ollamaConfig)), maxTokens: config.MaxTokens}
+	case ProviderOpenAI:
+		provider = newOpenAI(config)
+	case ProviderAnthropic:
+		provider = newAnthropic(config)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q, expected ollama, openai or anthropic", config.Provider)
+	}
+	return observed{provider}, nil
+}
+
+// isOllama reports whether a role uses Ollama
+func isOllama(config RoleConfig) bool {
+	return config.Provider == "" || config.Provider == ProviderOllama
+}
+
+// ollamaRoleConfig is the client configuration of an Ollama role: the
+// role's host, key and model where it sets them
+func ollamaRoleConfig(config RoleConfig, ollamaConfig ollama.Config) ollama.Config {
+	// The policy times requests out instead
+	ollamaConfig.Timeout = 0
+	if config.BaseURL != "" {
+		ollamaConfig.Host = config.BaseURL
+	}
+	if config.APIKey != "" {
+		ollamaConfig.APIKey = config.APIKey
+	}
+	// A role given its own model keeps it when models are switched
+	if config.Model != "" {
+		ollamaConfig.Model = config.Model
+		ollamaConfig.EmbedModel = config.Model
+		ollamaConfig.VisionModel = config.Model
+		ollamaConfig.Pinned = true
+	}
+	return ollamaConfig
+}
+
+// ProviderFor creates the provider configured for role from the
+// environment, falling back to Ollama when the configuration is invalid
+func ProviderFor(role Role) Provider {
+	ollamaConfig := ollama.ConfigFromEnv()
+	config, err := ConfigFromEnv()
+	if err != nil {
+		slog.Warn("using Ollama", "role", role, "error", err)
+		config = DefaultConfig()
+	}
+
+	provider, err := New(config.Role(role), ollamaConfig)
+	if err != nil {
+		slog.Warn("using Ollama", "role", role, "error", err)
+		provider, _ = New(RoleConfig{Provider: ProviderOllama}, ollamaConfig)
+	}
+	return provider
+}
+
+// observed records the latency and token use of a provider's requests
+type observed struct {
+	Provider
+}
+
+func (o observed) ChatCompletion(ctx context.Context, req Request) (*ollama.ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := o.Provider.ChatCompletion(ctx, req)
+	o.observe("chat", start, err)
+	if err == nil {
+		o.countTokens(ctx, o.Model(), resp.Usage)
+	}
+	return resp, err
+}
+
+func (o observed) Stream(ctx context.Context, req Request, callback func(string) error) (*ollama.StreamResult, error) {
+	start := time.Now()
+	result, err := o.Provider.Stream(ctx, req, callback)
+	o.observe("chat_stream", start, err)
+	if err == nil {
+		o.countTokens(ctx, o.Model(), result.Usage)
+	}
+	return result, err
+}
+
+func (o observed) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	start := time.Now()
+	embeddings, err := o.Provider.Embed(ctx, texts)
+	o.observe("embedding", start, err)
+	return embeddings, err
+}
+
+func (o observed) Vision(ctx context.Context, prompt string, images [][]byte, temperature float64) (*ollama.ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := o.Provider.Vision(ctx, prompt, images, temperature)
+	o.observe("vision", start, err)
+	if err == nil {
+		o.countTokens(ctx, o.VisionModel(), resp.Usage)
+	}
+	return resp, err
+}
+
+// observe records a request's latency
+func (o observed) observe(operation string, start time.Time, err error) {
+	status := "ok"
+	if errors.Is(err, context.Canceled) {
+		status = "cancelled"
+	} else if err != nil {
+		status = "error"
+	}
+	requestDuration.Observe(time.Since(start).Seconds(), o.Name(), operation, status)
+}
+
+// countTokens records the tokens a completion used, charging them to the
+// meter of ctx and passing them to the recorder
+func (o observed) countTokens(ctx context.Context, model string, usage ollama.Usage) {
+	if usage.PromptTokens > 0 {
+		tokensTotal.Add(float64(usage.PromptTokens), o.Name(), "prompt")
+	}
+	if usage.CompletionTokens > 0 {
+		tokensTotal.Add(float64(usage.CompletionTokens), o.Name(), "completion")
+	}
+	if meter := MeterFrom(ctx); meter != nil {
+		meter.add(usage)
+	}
+	if recorder := usageRecorder(); recorder != nil {
+		recorder.Record(ctx, o.Name(), model, usage)
+	}
+}
@@ -0,0 +1,418 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/metrics"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// maxRetryBackoff caps the wait between attempts
+const maxRetryBackoff = 30 * time.Second
+
+var (
+	// ErrTimeout is returned when a request outlasts the policy's timeout
+	ErrTimeout = errors.New("request timed out")
+	// ErrCircuitOpen is returned while the circuits of a role's model and
+	// of its fallback models are open
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+// retriesTotal counts requests tried again after a transient failure
+var retriesTotal = metrics.NewCounterVec("llm_retries_total",
+	"LLM provider requests retried after a transient failure", "provider", "operation")
+
+// fallbacksTotal counts requests sent to a fallback model
+var fallbacksTotal = metrics.NewCounterVec("llm_fallbacks_total",
+	"LLM requests sent to the fallback model", "provider", "operation")
+
+// Policy sets how a role's requests are timed out, retried and broken
+type Policy struct {
+	Timeout      time.Duration // longest chat, stream or vision request
+	EmbedTimeout time.Duration // longest embedding request
+	MaxRetries   int           // retries after a transient failure
+	RetryBackoff time.Duration // before the first retry, doubling after each
+	// BreakerThreshold is how many requests in a row may fail before the
+	// model's circuit opens; it never opens when 0
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit waits before trying the
+	// model again
+	BreakerCooldown time.Duration
+}
+
+// DefaultPolicy retries twice and opens a model's circuit after 5
+// failures in a row
+func DefaultPolicy() Policy {
+	return Policy{
+		Timeout:          300 * time.Second, // 5 minutes for large models
+		EmbedTimeout:     60 * time.Second,
+		MaxRetries:       2,
+		RetryBackoff:     time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// resilient times out and retries a provider's requests, and sends them
+// down the chain of fallbacks while a model's circuit is open or it can't
+// serve them. Each attempt first waits for a slot on the host when it has
+// a limiter; the wait doesn't count towards the timeout.
+type resilient struct {
+	Provider
+	fallbacks []Provider
+	policy    Policy
+	limiter   *limiter
+}
+
+// ChatCompletion answers req; the response's Model is the model that did
+func (r resilient) ChatCompletion(ctx context.Context, req Request) (*ollama.ChatCompletionResponse, error) {
+	var resp *ollama.ChatCompletionResponse
+	err := r.do(ctx, "chat", Provider.Model, r.policy.Timeout, func(ctx context.Context, provider Provider) error {
+		var err error
+		resp, err = provider.ChatCompletion(ctx, req)
+		if err == nil {
+			resp.Model = provider.Model()
+		}
+		return err
+	})
+	return resp, err
+}
+
+func (r resilient) Stream(ctx context.Context, req Request, callback func(string) error) (*ollama.StreamResult, error) {
+	var result *ollama.StreamResult
+	err := r.do(ctx, "chat_stream", Provider.Model, r.policy.Timeout, func(ctx context.Context, provider Provider) error {
+		streamed := false
+		var err error
+		result, err = provider.Stream(ctx, req, func(text string) error {
+			streamed = true
+			return callback(text)
+		})
+		if err != nil && streamed {
+			return streamedError{err}
+		}
+		if err == nil {
+			result.Model = provider.Model()
+		}
+		return err
+	})
+	return result, err
+}
+
+func (r resilient) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	var embeddings [][]float64
+	err := r.do(ctx, "embedding", Provider.EmbedModel, r.policy.EmbedTimeout, func(ctx context.Context, provider Provider) error {
+		var err error
+		embeddings, err = provider.Embed(ctx, texts)
+		return err
+	})
+	return embeddings, err
+}
+
+// Vision asks only the primary: fallbacks change the chat model but share
+// its vision model, so a vision request fails fast while that circuit is open
+func (r resilient) Vision(ctx context.Context, prompt string, images [][]byte, temperature float64) (*ollama.ChatCompletionResponse, error) {
+	primary := r
+	primary.fallbacks = nil
+	var resp *ollama.ChatCompletionResponse
+	err := primary.do(ctx, "vision", Provider.VisionModel, r.policy.Timeout, func(ctx context.Context, provider Provider) error {
+		var err error
+		resp, err = provider.Vision(ctx, prompt, images, temperature)
+		if err == nil {
+			resp.Model = provider.VisionModel()
+		}
+		return err
+	})
+	return resp, err
+}
+
+// do makes a request of the model the operation uses, moving down the
+// chain of fallbacks past models whose circuit is open and those that
+// fail in a way another model may not
+func (r resilient) do(ctx context.Context, operation string, model func(Provider) string, timeout time.Duration, call func(context.Context, Provider) error) error {
+	chain := append([]Provider{r.Provider}, r.fallbacks...)
+	var failures []string
+	var lastErr error
+	for i, provider := range chain {
+		name := model(provider)
+		circuit := circuitFor(provider.Name(), name)
+		if !circuit.allow() {
+			lastErr = fmt.Errorf("%w for %s model %s", ErrCircuitOpen, provider.Name(), name)
+			failures = append(failures, lastErr.Error())
+			continue
+		}
+		if i > 0 {
+			fallbacksTotal.Inc(r.Name(), operation)
+		}
+
+		err := r.retry(ctx, operation, timeout, provider, call)
+		switch {
+		case err == nil:
+			if circuit.succeed() {
+				logging.FromContext(ctx).Info("circuit closed", "provider", provider.Name(), "model", name)
+			}
+		case ctx.Err() == nil && transient(err):
+			if circuit.fail(r.policy) {
+				logging.FromContext(ctx).Warn("circuit open", "provider", provider.Name(), "model", name, "cooldown", r.policy.BreakerCooldown, "error", err)
+			}
+		default:
+			circuit.release()
+		}
+
+		if err == nil {
+			if i > 0 {
+				logging.FromContext(ctx).Warn("served by fallback model", "provider", provider.Name(), "operation", operation, "model", name, "failures", failures)
+			}
+			return nil
+		}
+		if ctx.Err() != nil || !fallbackable(err) {
+			if i > 0 {
+				return fmt.Errorf("failed with fallback model %s: %w (%s)", name, err, strings.Join(failures, "; "))
+			}
+			return err
+		}
+		failures = append(failures, fmt.Sprintf("model %s: %v", name, err))
+		lastErr = err
+	}
+
+	if len(failures) == 1 {
+		return lastErr
+	}
+	return fmt.Errorf("every model failed: %w (%s)", lastErr, strings.Join(failures[:len(failures)-1], "; "))
+}
+
+// retry makes a request, trying again with growing waits while it fails
+// transiently and retries remain
+func (r resilient) retry(ctx context.Context, operation string, timeout time.Duration, provider Provider, call func(context.Context, Provider) error) error {
+	wait := r.policy.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		release, err := r.limiter.acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("request cancelled while queued: %w", err)
+		}
+		err = attemptWithTimeout(ctx, timeout, provider, call)
+		release()
+		if err == nil || attempt >= r.policy.MaxRetries || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		retriesTotal.Inc(provider.Name(), operation)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("request cancelled: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxRetryBackoff)
+	}
+}
+
+// attemptWithTimeout makes one attempt, ending it after timeout
+func attemptWithTimeout(ctx context.Context, timeout time.Duration, provider Provider, call func(context.Context, Provider) error) error {
+	if timeout <= 0 {
+		return call(ctx, provider)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := call(attemptCtx, provider)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", ErrTimeout, timeout, err)
+	}
+	return err
+}
+
+// streamedError is a stream that failed after passing text on; trying
+// again would pass it on twice
+type streamedError struct {
+	error
+}
+
+func (e streamedError) Unwrap() error { return e.error }
+
+// retryable reports whether a failed request may be made again of the
+// same model
+func retryable(err error) bool {
+	var streamed streamedError
+	return !errors.As(err, &streamed) && transient(err) && !unavailable(err)
+}
+
+// fallbackable reports whether a failed request may go to the next model:
+// the API is unhealthy, the model can't be loaded, or the prompt is longer
+// than its context
+func fallbackable(err error) bool {
+	var streamed streamedError
+	if errors.As(err, &streamed) {
+		return false
+	}
+	return transient(err) || unavailable(err) || contextOverflow(err)
+}
+
+// unavailable reports whether an error says the model isn't installed or
+// won't load, such as for lack of memory
+func unavailable(err error) bool {
+	var apiErr *ollama.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	return containsAny(strings.ToLower(apiErr.Body), "not found", "failed to load", "unable to load", "requires more system memory")
+}
+
+// contextOverflow reports whether an error says the prompt is longer than
+// the model's context. Ollama doesn't say; it cuts the prompt short.
+func contextOverflow(err error) bool {
+	var apiErr *ollama.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode < 400 || apiErr.StatusCode >= 500 {
+		return false
+	}
+	return containsAny(strings.ToLower(apiErr.Body), "context length", "context_length_exceeded", "context window", "maximum context", "prompt is too long", "too many tokens")
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// transient reports whether an error says the API is unhealthy rather
+// than the request wrong: timeouts, connection errors, 5xx, 408 and 429
+func transient(err error) bool {
+	if errors.Is(err, ErrTimeout) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var apiErr *ollama.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode == http.StatusRequestTimeout
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// circuit is a model's breaker. It opens after requests fail too often in
+// a row, and once its cooldown is over lets one request through to see
+// whether the model has recovered.
+type circuit struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time // zero while closed
+	probing   bool
+}
+
+type circuitKey struct {
+	provider string
+	model    string
+}
+
+// circuits holds the circuit of each model, shared by every role using it
+var circuits = struct {
+	sync.Mutex
+	byModel map[circuitKey]*circuit
+}{byModel: make(map[circuitKey]*circuit)}
+
+// circuitFor returns a model's circuit, creating it closed
+func circuitFor(provider, model string) *circuit {
+	circuits.Lock()
+	defer circuits.Unlock()
+
+	key := circuitKey{provider, model}
+	c, ok := circuits.byModel[key]
+	if !ok {
+		c = &circuit{}
+		circuits.byModel[key] = c
+	}
+	return c
+}
+
+// allow reports whether a request may go to the model: the circuit is
+// closed, or its cooldown is over and no other request is trying it
+func (c *circuit) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.openUntil.IsZero() {
+		return true
+	}
+	if c.probing || time.Now().Before(c.openUntil) {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+// succeed closes the circuit, reporting whether it was open
+func (c *circuit) succeed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wasOpen := !c.openUntil.IsZero()
+	c.failures = 0
+	c.openUntil = time.Time{}
+	c.probing = false
+	return wasOpen
+}
+
+// fail counts a failure, reporting whether it opened the circuit. A
+// failed trial keeps it open for another cooldown.
+func (c *circuit) fail(policy Policy) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	c.probing = false
+	if policy.BreakerThreshold == 0 {
+		return false
+	}
+	if !c.openUntil.IsZero() {
+		c.openUntil = time.Now().Add(policy.BreakerCooldown)
+		return false
+	}
+	if c.failures >= policy.BreakerThreshold {
+		c.openUntil = time.Now().Add(policy.BreakerCooldown)
+		return true
+	}
+	return false
+}
+
+// release ends a trial that neither succeeded nor failed, such as one the
+// caller cancelled
+func (c *circuit) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probing = false
+}
+
+// RegisterMetrics adds gauges of which models' circuits are open, and of
+// each Ollama host's queue, to registry
+func RegisterMetrics(registry *metrics.Registry) {
+	registerLimiterMetrics(registry)
+	registry.NewGaugeFunc("llm_circuit_open", "Whether each model's circuit is open",
+		[]string{"provider", "model"}, func() []metrics.Sample {
+			circuits.Lock()
+			defer circuits.Unlock()
+
+			samples := make([]metrics.Sample, 0, len(circuits.byModel))
+			for key, c := range circuits.byModel {
+				c.mu.Lock()
+				open := 0.0
+				if !c.openUntil.IsZero() {
+					open = 1
+				}
+				c.mu.Unlock()
+				samples = append(samples, metrics.Sample{Labels: []string{key.provider, key.model}, Value: open})
+			}
+			return samples
+		})
+}
@@ -0,0 +1,206 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// Sample returns k choices for req. They come from one request where the
+// provider samples several, and otherwise from more requests made at once.
+func Sample(ctx context.Context, provider Provider, req Request, k int) ([]ollama.Choice, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("invalid sample count %d, expected at least 1", k)
+	}
+	req.N = k
+	resp, err := provider.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("model returned no choices")
+	}
+	choices := resp.Choices
+	if len(choices) >= k {
+		return choices[:k], nil
+	}
+
+	// The provider samples one at a time
+	req.N = 1
+	more := make([]ollama.Choice, k-len(choices))
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for i := range more {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := provider.ChatCompletion(ctx, req)
+			if err == nil && len(resp.Choices) == 0 {
+				err = fmt.Errorf("model returned no choices")
+			}
+			if err != nil {
+				once.Do(func() { firstErr = err })
+				return
+			}
+			more[i] = resp.Choices[0]
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return append(choices, more...), nil
+}
+
+// Consensus is the answer self-consistency settled on
+type Consensus[T any] struct {
+	Answer T
+	// Agreement is the share of samples that gave each of the answer's
+	// fields its value, by JSON field name; "" holds it for answers that
+	// aren't objects
+	Agreement map[string]float64
+	Samples   int // the samples that matched T's schema
+}
+
+// SelfConsistency asks for k answers of type T at temperature and merges
+// them. Each field's value is the one most samples gave, ties going to the
+// samples the model was surer of where logprobs are available. The answer
+// is the sample that agrees with the most of those values, so its fields
+// stay consistent with each other; answers that aren't objects are voted
+// on whole. Samples that don't match T's schema are left out.
+func SelfConsistency[T any](ctx context.Context, provider Provider, messages []ollama.ChatMessage, temperature float64, k int) (Consensus[T], error) {
+	var consensus Consensus[T]
+	schema := SchemaOf(reflect.TypeOf(consensus.Answer))
+	req, err := structuredRequest(messages, schema, temperature)
+	if err != nil {
+		return consensus, err
+	}
+	req.Logprobs = true
+
+	choices, err := Sample(ctx, provider, req, k)
+	if err != nil {
+		return consensus, err
+	}
+
+	var samples []vote
+	var problem error
+	for _, choice := range choices {
+		data, err := decodeJSON(choice.Message.Content, schema)
+		if err != nil {
+			problem = err
+			continue
+		}
+		sample, err := newVote(data, choice.Logprobs)
+		if err != nil {
+			problem = err
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	if len(samples) == 0 {
+		return consensus, fmt.Errorf("%w in %d samples: %v", ErrInvalidStructuredOutput, len(choices), problem)
+	}
+
+	winners, agreement := tally(samples)
+	best, bestMatches := 0, -1
+	for i, sample := range samples {
+		matches := 0
+		for field, value := range winners {
+			if bytes.Equal(sample.fields[field], value) {
+				matches++
+			}
+		}
+		if matches > bestMatches {
+			best, bestMatches = i, matches
+		}
+	}
+
+	if err := json.Unmarshal(samples[best].data, &consensus.Answer); err != nil {
+		return consensus, fmt.Errorf("%w: %v", ErrInvalidStructuredOutput, err)
+	}
+	consensus.Agreement = make(map[string]float64, len(winners))
+	for field := range winners {
+		consensus.Agreement[field] = agreement[field][string(samples[best].fields[field])]
+	}
+	consensus.Samples = len(samples)
+	return consensus, nil
+}
+
+// vote is one sample's answer, with each field's value in canonical JSON
+// so equal values compare equal
+type vote struct {
+	data       json.RawMessage
+	fields     map[string][]byte // "" holds the whole answer when it isn't an object
+	confidence float64           // mean token logprob; -Inf when unknown
+}
+
+func newVote(data json.RawMessage, logprobs *ollama.Logprobs) (vote, error) {
+	sample := vote{data: data, fields: make(map[string][]byte), confidence: math.Inf(-1)}
+	if mean, ok := logprobs.Mean(); ok {
+		sample.confidence = mean
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return sample, err
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{"": value}
+	}
+	for field, fieldValue := range object {
+		// Marshalling decoded JSON sorts object keys
+		canonical, err := json.Marshal(fieldValue)
+		if err != nil {
+			return sample, err
+		}
+		sample.fields[field] = canonical
+	}
+	return sample, nil
+}
+
+// tally returns the value most samples gave each field, and the share of
+// samples that gave each value
+func tally(samples []vote) (map[string][]byte, map[string]map[string]float64) {
+	counts := make(map[string]map[string]int)
+	confidence := make(map[string]map[string]float64)
+	for _, sample := range samples {
+		for field, value := range sample.fields {
+			if counts[field] == nil {
+				counts[field] = make(map[string]int)
+				confidence[field] = make(map[string]float64)
+			}
+			if counts[field][string(value)] == 0 {
+				confidence[field][string(value)] = math.Inf(-1)
+			}
+			counts[field][string(value)]++
+			confidence[field][string(value)] = math.Max(confidence[field][string(value)], sample.confidence)
+		}
+	}
+
+	winners := make(map[string][]byte, len(counts))
+	agreement := make(map[string]map[string]float64, len(counts))
+	for field, values := range counts {
+		agreement[field] = make(map[string]float64, len(values))
+		var winner string
+		for value, count := range values {
+			agreement[field][value] = float64(count) / float64(len(samples))
+			best, ok := values[winner]
+			if !ok || count > best || count == best && confidence[field][value] > confidence[field][winner] ||
+				count == best && confidence[field][value] == confidence[field][winner] && value < winner {
+				winner = value
+			}
+		}
+		winners[field] = []byte(winner)
+	}
+	return winners, agreement
+}
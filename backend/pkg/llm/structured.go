@@ -0,0 +1,315 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// structuredAttempts is how many replies GenerateJSON asks for before
+// giving up on one matching the schema
+const structuredAttempts = 3
+
+// ErrInvalidStructuredOutput is returned when none of the model's replies
+// is JSON matching the schema
+var ErrInvalidStructuredOutput = errors.New("model output does not match schema")
+
+// trailingComma matches a comma the model left before a closing bracket
+var trailingComma = regexp.MustCompile(`,\s*([}\]])`)
+
+// GenerateJSON asks the provider's model for JSON matching schema and
+// returns it. The schema goes in the prompt as well as the request, in JSON
+// mode where the provider has one. Replies wrapped in prose or code fences,
+// or with trailing commas, are repaired; replies that still don't match are
+// sent back with the problem, up to structuredAttempts in all.
+func GenerateJSON(ctx context.Context, provider Provider, messages []ollama.ChatMessage, schema map[string]interface{}, temperature float64) (json.RawMessage, error) {
+	req, err := structuredRequest(messages, schema, temperature)
+	if err != nil {
+		return nil, err
+	}
+	conversation := req.Messages
+
+	var problem error
+	for attempt := 1; attempt <= structuredAttempts; attempt++ {
+		req.Messages = conversation
+		resp, err := provider.ChatCompletion(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("model returned no choices")
+		}
+
+		reply := resp.Choices[0].Message.Content
+		var data json.RawMessage
+		data, problem = decodeJSON(reply, schema)
+		if problem == nil {
+			return data, nil
+		}
+		conversation = append(conversation,
+			ollama.ChatMessage{Role: "assistant", Content: reply},
+			ollama.ChatMessage{Role: "user", Content: fmt.Sprintf("That reply is invalid: %v. Respond again with only JSON matching the schema.", problem)},
+		)
+	}
+	return nil, fmt.Errorf("%w after %d attempts: %v", ErrInvalidStructuredOutput, structuredAttempts, problem)
+}
+
+// structuredRequest asks for JSON matching schema, in the prompt as well
+// as the request
+func structuredRequest(messages []ollama.ChatMessage, schema map[string]interface{}, temperature float64) (Request, error) {
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return Request{}, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	format := &ollama.ResponseFormat{Type: "json_object"}
+	if schema != nil {
+		format = &ollama.ResponseFormat{Type: "json_schema", JSONSchema: &ollama.JSONSchema{Name: "response", Schema: schema}}
+	}
+
+	conversation := make([]ollama.ChatMessage, 0, len(messages)+1+2*structuredAttempts)
+	conversation = append(conversation, ollama.ChatMessage{
+		Role:    "system",
+		Content: "Respond with only JSON matching this schema, no other text:\n" + string(schemaJSON),
+	})
+	conversation = append(conversation, messages...)
+	return Request{Messages: conversation, Temperature: temperature, ResponseFormat: format}, nil
+}
+
+// GenerateStructured asks the provider's model for a T, sending the JSON
+// Schema of T and decoding the reply; see GenerateJSON
+func GenerateStructured[T any](ctx context.Context, provider Provider, messages []ollama.ChatMessage, temperature float64) (T, error) {
+	var result T
+	data, err := GenerateJSON(ctx, provider, messages, SchemaOf(reflect.TypeOf(result)), temperature)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalidStructuredOutput, err)
+	}
+	return result, nil
+}
+
+// decodeJSON repairs a reply into JSON and checks it against schema
+func decodeJSON(reply string, schema map[string]interface{}) (json.RawMessage, error) {
+	text := repairJSON(reply, schema["type"] == "array")
+	if text == "" {
+		return nil, fmt.Errorf("no JSON found")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if err := validateJSON(schema, value, "$"); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(text), nil
+}
+
+// repairJSON cuts the JSON out of a reply that wraps it in prose or code
+// fences and drops trailing commas
+func repairJSON(reply string, array bool) string {
+	text := strings.TrimSpace(reply)
+	if start := strings.Index(text, "```"); start >= 0 {
+		inner := text[start+3:]
+		if end := strings.Index(inner, "```"); end >= 0 {
+			inner = inner[:end]
+		}
+		// Drop the fence's language tag
+		if newline := strings.IndexByte(inner, '\n'); newline >= 0 && !strings.ContainsAny(inner[:newline], "{[") {
+			inner = inner[newline+1:]
+		}
+		text = strings.TrimSpace(inner)
+	}
+
+	opening, closing := "{", "}"
+	if array {
+		opening, closing = "[", "]"
+	}
+	start, end := strings.Index(text, opening), strings.LastIndex(text, closing)
+	if start < 0 || end < start {
+		return ""
+	}
+	return trailingComma.ReplaceAllString(text[start:end+1], "$1")
+}
+
+// validateJSON checks a decoded value against the parts of JSON Schema
+// SchemaOf produces: type, properties, required, items,
+// additionalProperties and enum. Nulls pass for any type.
+func validateJSON(schema map[string]interface{}, value interface{}, path string) error {
+	if schema == nil || value == nil {
+		return nil
+	}
+
+	if enum := stringList(schema["enum"]); len(enum) > 0 {
+		text, _ := value.(string)
+		found := false
+		for _, option := range enum {
+			found = found || option == text
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %s", path, strings.Join(enum, ", "))
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for name, field := range object {
+			fieldSchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				fieldSchema = additional
+			}
+			if err := validateJSON(fieldSchema, field, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		for i, item := range items {
+			if err := validateJSON(itemSchema, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if _, err := number.Int64(); !ok || err != nil {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	}
+	return nil
+}
+
+// stringList reads a schema keyword holding names, as built or as decoded
+func stringList(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		names := make([]string, 0, len(list))
+		for _, item := range list {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// SchemaOf returns the JSON Schema of values of type t. Struct fields are
+// named by their json tags and required unless omitempty; a description
+// tag describes a field and an enum tag lists its values, separated by |.
+func SchemaOf(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		addStructFields(t, properties, &required)
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": SchemaOf(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"} // base64
+		}
+		return map[string]interface{}{"type": "array", "items": SchemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{} // any value
+	}
+}
+
+// addStructFields adds a struct's fields to an object schema, flattening
+// embedded structs the way encoding/json does
+func addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := SchemaOf(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			schema["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, "|")
+		}
+		properties[name] = schema
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"agent-workspace/backend/pkg/models"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// ErrBudgetExceeded is the cause a metered context is cancelled with once
+// its requests have used up their tokens
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Recorder keeps the tokens every request used, such as to total them by day
+type Recorder interface {
+	Record(ctx context.Context, provider, model string, usage ollama.Usage)
+}
+
+// recorder is the Recorder every provider passes its usage to
+var recorder struct {
+	sync.RWMutex
+	recorder Recorder
+}
+
+// SetRecorder has every provider pass the tokens its requests use to r
+func SetRecorder(r Recorder) {
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.recorder = r
+}
+
+func usageRecorder() Recorder {
+	recorder.RLock()
+	defer recorder.RUnlock()
+	return recorder.recorder
+}
+
+type meterKey struct{}
+
+// Meter counts the tokens used by the requests made with a context, such
+// as a task's
+type Meter struct {
+	id        string
+	maxTokens int
+	cancel    context.CancelCauseFunc
+
+	mu    sync.Mutex
+	usage models.TokenUsage
+}
+
+// WithMeter returns a context whose requests the returned meter counts.
+// Once they use maxTokens the context is cancelled with ErrBudgetExceeded;
+// 0 is no limit. id names what is metered, such as a task.
+func WithMeter(ctx context.Context, id string, maxTokens int) (context.Context, *Meter) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	meter := &Meter{id: id, maxTokens: maxTokens, cancel: cancel}
+	return context.WithValue(ctx, meterKey{}, meter), meter
+}
+
+// MeterFrom returns the meter counting the requests of ctx, or nil
+func MeterFrom(ctx context.Context) *Meter {
+	meter, _ := ctx.Value(meterKey{}).(*Meter)
+	return meter
+}
+
+// ID names what the meter counts
+func (m *Meter) ID() string {
+	return m.id
+}
+
+// Usage returns the requests counted so far and the tokens they used
+func (m *Meter) Usage() models.TokenUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// add counts a request, cancelling the context once the budget is used up
+func (m *Meter) add(usage ollama.Usage) {
+	m.mu.Lock()
+	m.usage.Requests++
+	m.usage.PromptTokens += usage.PromptTokens
+	m.usage.CompletionTokens += usage.CompletionTokens
+	m.usage.TotalTokens += usage.PromptTokens + usage.CompletionTokens
+	total := m.usage.TotalTokens
+	m.mu.Unlock()
+
+	if m.maxTokens > 0 && total >= m.maxTokens {
+		m.cancel(fmt.Errorf("%w: used %d of %d tokens", ErrBudgetExceeded, total, m.maxTokens))
+	}
+}
@@ -0,0 +1,311 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"agent-workspace/backend/pkg/logging"
+	"agent-workspace/backend/pkg/metrics"
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// ollamaDefaultContext is the context window Ollama gives a model when
+// num_ctx isn't set
+const ollamaDefaultContext = 4096
+
+// Token estimates err on the long side
+const (
+	charsPerToken = 4   // about right for English text and code
+	messageTokens = 4   // a message's role and separators
+	imageTokens   = 256 // about what a vision model spends on an image
+	summaryTokens = 512 // the longest summary compression asks for
+)
+
+// compressionsTotal counts the prompts too long for the model's context
+// window, by whether compression made them fit
+var compressionsTotal = metrics.NewCounterVec("llm_prompt_compressions_total",
+	"LLM prompts too long for the model's context window", "provider", "result")
+
+// EstimateTokens guesses how many tokens messages take, at about four
+// characters a token
+func EstimateTokens(messages []ollama.ChatMessage) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += messageTokens + textTokens(msg.Content) + len(msg.Images)*imageTokens
+		for _, call := range msg.ToolCalls {
+			tokens += textTokens(call.Function.Name) + textTokens(call.Function.Arguments)
+		}
+	}
+	return tokens
+}
+
+func textTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// promptTokens estimates the prompt req makes: its messages, and the tools
+// and schema sent with them
+func promptTokens(req Request) int {
+	tokens := EstimateTokens(req.Messages)
+	if len(req.Tools) > 0 {
+		if data, err := json.Marshal(req.Tools); err == nil {
+			tokens += textTokens(string(data))
+		}
+	}
+	if req.ResponseFormat != nil {
+		if data, err := json.Marshal(req.ResponseFormat); err == nil {
+			tokens += textTokens(string(data))
+		}
+	}
+	return tokens
+}
+
+// compressing fits chat prompts into the model's context window. Ollama
+// cuts a longer prompt short, silently dropping its start and with it the
+// system prompt, so the oldest messages after the system prompt are
+// summarized instead until the prompt fits. The latest user turn and the
+// latest reply or tool results are kept whole. Requests to Ollama are sent
+// the window as num_ctx, so the server uses the one prompts were fit to.
+type compressing struct {
+	Provider
+	window int // tokens, shared by the prompt and the reply
+	// modelWindows, for Ollama roles without a configured window, finds
+	// each model's; window is the fallback
+	modelWindows *modelWindows
+}
+
+// modelWindows finds the context window Ollama gives models when requests
+// don't set num_ctx: their Modelfile's, or the default. It asks /api/show
+// once per model, models being switchable at runtime.
+type modelWindows struct {
+	client *ollama.Client
+	mu     sync.Mutex
+	models map[string]int
+}
+
+func newModelWindows(client *ollama.Client) *modelWindows {
+	return &modelWindows{client: client, models: make(map[string]int)}
+}
+
+// window returns model's context window, or 0 when Ollama can't say
+func (w *modelWindows) window(ctx context.Context, model string) int {
+	w.mu.Lock()
+	window, ok := w.models[model]
+	w.mu.Unlock()
+	if ok {
+		return window
+	}
+
+	info, err := w.client.ShowModel(ctx, model)
+	if err != nil {
+		logging.FromContext(ctx).Warn("couldn't read the model's context window", "model", model, "assumed", ollamaDefaultContext, "error", err)
+		return 0
+	}
+	window = info.NumCtx()
+	if window == 0 {
+		window = ollamaDefaultContext
+	}
+	w.mu.Lock()
+	w.models[model] = window
+	w.mu.Unlock()
+	return window
+}
+
+func (c compressing) ChatCompletion(ctx context.Context, req Request) (*ollama.ChatCompletionResponse, error) {
+	return c.Provider.ChatCompletion(ctx, c.fit(ctx, req))
+}
+
+func (c compressing) Stream(ctx context.Context, req Request, callback func(string) error) (*ollama.StreamResult, error) {
+	return c.Provider.Stream(ctx, c.fit(ctx, req), callback)
+}
+
+// fit returns req with its oldest messages summarized when its prompt
+// leaves the reply too little of the window. A prompt that can't be made
+// to fit is sent as it is.
+func (c compressing) fit(ctx context.Context, req Request) Request {
+	window := c.window
+	if c.Name() == ProviderOllama {
+		if req.Options.NumCtx > 0 {
+			window = req.Options.NumCtx
+		} else {
+			if c.modelWindows != nil {
+				if model := c.modelWindows.window(ctx, c.Model()); model > 0 {
+					window = model
+				}
+			}
+			req.Options.NumCtx = window
+		}
+	}
+	reply := window / 4
+	if req.MaxTokens > 0 {
+		reply = min(req.MaxTokens, window/2)
+	}
+	budget := window - reply
+	tokens := promptTokens(req)
+	if tokens <= budget {
+		return req
+	}
+
+	messages, err := c.compress(ctx, req.Messages, tokens-budget, window)
+	if err != nil {
+		compressionsTotal.Inc(c.Name(), "failed")
+		logging.FromContext(ctx).Warn("prompt overflows the context window and wasn't compressed", "tokens", tokens, "window", window, "model", c.Model(), "error", err)
+		return req
+	}
+	compressed := req
+	compressed.Messages = messages
+	if after := promptTokens(compressed); after > budget {
+		compressionsTotal.Inc(c.Name(), "too_long")
+		logging.FromContext(ctx).Warn("compressed prompt still overflows the context window", "tokens", tokens, "compressed", after, "window", window, "model", c.Model())
+		return compressed
+	}
+	compressionsTotal.Inc(c.Name(), "compressed")
+	return compressed
+}
+
+// compress summarizes enough of the oldest messages to save excess tokens,
+// first those between the system prompt and the latest user turn and then
+// the steps taken since, each section's summary taking its place
+func (c compressing) compress(ctx context.Context, messages []ollama.ChatMessage, excess, window int) ([]ollama.ChatMessage, error) {
+	start := 0
+	if len(messages) > 0 && messages[0].Role == "system" {
+		start = 1
+	}
+	latest := start
+	for i := len(messages) - 1; i > start; i-- {
+		if messages[i].Role == "user" {
+			latest = i
+			break
+		}
+	}
+	// The last message stays with the call its tool results answer
+	last := len(messages) - 1
+	for last > latest+1 && messages[last].Role == "tool" {
+		last--
+	}
+
+	compressed := make([]ollama.ChatMessage, 0, len(messages))
+	next := 0
+	for _, section := range [][2]int{{start, latest}, {latest + 1, last}} {
+		from, to := section[0], section[1]
+		if excess <= 0 || to <= from {
+			continue
+		}
+		n := cut(messages[from:to], excess+summaryTokens)
+		summary, err := c.summarize(ctx, messages[from:from+n], window)
+		if err != nil {
+			return nil, err
+		}
+		message := ollama.ChatMessage{Role: "system", Content: "Summary of the earlier conversation:\n" + summary}
+		excess -= EstimateTokens(messages[from:from+n]) - EstimateTokens([]ollama.ChatMessage{message})
+
+		compressed = append(compressed, messages[next:from]...)
+		compressed = append(compressed, message)
+		next = from + n
+	}
+	if next == 0 {
+		return nil, fmt.Errorf("no messages besides the system prompt and latest turn to summarize")
+	}
+	return append(compressed, messages[next:]...), nil
+}
+
+// cut returns how many of messages, from the first, take up tokens, never
+// leaving a tool result without the call it answers
+func cut(messages []ollama.ChatMessage, tokens int) int {
+	n, saved := 0, 0
+	for n < len(messages) && saved < tokens {
+		saved += EstimateTokens(messages[n : n+1])
+		n++
+	}
+	for n < len(messages) && messages[n].Role == "tool" {
+		n++
+	}
+	return n
+}
+
+// summarize condenses messages, a part at a time when they don't fit the
+// window at once. Messages too long for a part keep their start and end.
+func (c compressing) summarize(ctx context.Context, messages []ollama.ChatMessage, window int) (string, error) {
+	// Each part leaves room for the prompt, the summary so far and the reply
+	limit := max(window/2-2*summaryTokens, summaryTokens) * charsPerToken
+
+	summary := ""
+	var part strings.Builder
+	for i, msg := range messages {
+		part.WriteString(elide(transcriptEntry(msg), limit))
+		if i+1 < len(messages) && part.Len()+len(transcriptEntry(messages[i+1])) <= limit {
+			continue
+		}
+		var err error
+		if summary, err = c.summarizePart(ctx, summary, part.String(), window); err != nil {
+			return "", err
+		}
+		part.Reset()
+	}
+	return summary, nil
+}
+
+// summarizePart merges a part of the transcript into the summary so far,
+// in a request sized for window
+func (c compressing) summarizePart(ctx context.Context, previous, transcript string, window int) (string, error) {
+	if previous == "" {
+		previous = "(none)"
+	}
+	prompt := fmt.Sprintf(`You are condensing the earlier part of a conversation between a user and an AI agent so that it fits the model's context window.
+
+Summary so far:
+%s
+
+Messages:
+%s
+Rewrite the summary to include the messages. Keep the user's goals, decisions, facts, names, file paths, commands, tool results and open questions; drop pleasantries. Respond with only the summary, at most 300 words.`,
+		previous, transcript)
+
+	resp, err := c.Provider.ChatCompletion(ctx, Request{
+		Messages:    []ollama.ChatMessage{{Role: "user", Content: prompt}},
+		Temperature: 0.2,
+		MaxTokens:   summaryTokens,
+		Options:     ollama.Options{NumCtx: window},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize messages: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("failed to summarize messages: empty response")
+	}
+	summary := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if summary == "" {
+		return "", fmt.Errorf("failed to summarize messages: empty summary")
+	}
+	return summary, nil
+}
+
+// transcriptEntry writes a message out for the summarizer
+func transcriptEntry(msg ollama.ChatMessage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", msg.Role, msg.Content)
+	for _, call := range msg.ToolCalls {
+		fmt.Fprintf(&b, "(called %s with %s)\n", call.Function.Name, call.Function.Arguments)
+	}
+	if len(msg.Images) > 0 {
+		fmt.Fprintf(&b, "(%d image(s))\n", len(msg.Images))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// elide shortens text to about limit bytes, keeping its start and end
+func elide(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	keep := limit / 2
+	if len(runes) <= 2*keep {
+		return text
+	}
+	return string(runes[:keep]) + fmt.Sprintf("\n… (%d characters left out) …\n", len(runes)-2*keep) + string(runes[len(runes)-keep:])
+}
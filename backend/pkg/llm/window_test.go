@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agent-workspace/backend/pkg/ollama"
+)
+
+// ollamaServer answers /api/show with parameters and records the num_ctx
+// each /api/chat request sets
+func ollamaServer(t *testing.T, parameters string, numCtx *[]float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			json.NewEncoder(w).Encode(map[string]string{"parameters": parameters})
+		case "/api/chat":
+			var req struct {
+				Options map[string]interface{} `json:"options"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			n, _ := req.Options["num_ctx"].(float64)
+			*numCtx = append(*numCtx, n)
+			w.Write([]byte(`{"message":{"role":"assistant","content":"ok"},"done":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOllamaRequestsCarryTheWindowTheyWereFitTo(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		parameters string
+		config     RoleConfig
+		options    ollama.Options
+		want       float64
+	}{
+		{name: "default", want: ollamaDefaultContext},
+		{name: "Modelfile", parameters: "num_ctx                        8192\nstop \"<end>\"", want: 8192},
+		{name: "OLLAMA_NUM_CTX", parameters: "num_ctx 8192", options: ollama.Options{NumCtx: 16384}, want: 16384},
+		{name: "role window", config: RoleConfig{ContextWindow: 32768}, want: 32768},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var numCtx []float64
+			server := ollamaServer(t, test.parameters, &numCtx)
+			defer server.Close()
+
+			provider, err := New(test.config, ollama.Config{Host: server.URL, Model: "window-" + test.name, Options: test.options})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if _, err := provider.ChatCompletion(context.Background(), Request{
+				Messages: []ollama.ChatMessage{{Role: "user", Content: "hi"}},
+			}); err != nil {
+				t.Fatalf("ChatCompletion() error = %v", err)
+			}
+			if len(numCtx) != 1 || numCtx[0] != test.want {
+				t.Errorf("requests set num_ctx %v, want [%v]", numCtx, test.want)
+			}
+		})
+	}
+}
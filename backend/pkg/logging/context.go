@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries a request's correlation ID in and out
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern matches IDs accepted from clients; others are replaced
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type requestIDKey struct{}
+type loggerKey struct{}
+
+// NewRequestID returns a new correlation ID
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// ValidRequestID reports whether a client-supplied ID can be kept
+func ValidRequestID(id string) bool {
+	return requestIDPattern.MatchString(id)
+}
+
+// WithRequestID tags ctx with a correlation ID, which FromContext's logger
+// and the subsystems ctx reaches record
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return With(ctx, "request_id", id)
+}
+
+// RequestID returns the correlation ID set by WithRequestID, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// With returns ctx carrying a logger that adds args to every record, on
+// top of those ctx's logger already adds
+func With(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(args...))
+}
+
+// FromContext returns the logger ctx carries, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config sets how the server logs
+type Config struct {
+	Level    slog.Level
+	JSON     bool // JSON lines instead of key=value text
+	TailSize int  // records kept for /api/logs; 0 keeps none
+}
+
+// ConfigFromEnv reads LOG_LEVEL (debug, info, warn or error, default info),
+// LOG_FORMAT (text or json, default text) and LOG_TAIL_SIZE (default 2000)
+func ConfigFromEnv() (Config, error) {
+	config := Config{Level: slog.LevelInfo, TailSize: 2000}
+
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		level, err := ParseLevel(value)
+		if err != nil {
+			return config, err
+		}
+		config.Level = level
+	}
+
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+	case "json":
+		config.JSON = true
+	default:
+		return config, fmt.Errorf("invalid LOG_FORMAT %q, expected text or json", format)
+	}
+
+	if value := os.Getenv("LOG_TAIL_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return config, fmt.Errorf("invalid LOG_TAIL_SIZE %q", value)
+		}
+		config.TailSize = size
+	}
+	return config, nil
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// Setup makes slog's default logger write to stderr and to the returned
+// tail. Dependencies' output through the standard log package goes through
+// it too, at info.
+func Setup(config Config) *Tail {
+	options := &slog.HandlerOptions{Level: config.Level}
+	var handler slog.Handler
+	if config.JSON {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+
+	tail := NewTail(config.TailSize, config.Level)
+	if config.TailSize > 0 {
+		handler = fanout{handler, tail}
+	}
+	slog.SetDefault(slog.New(handler))
+	return tail
+}
+
+// fanout sends each record to several handlers
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	var first error
+	for _, h := range f {
+		if h.Enabled(ctx, record.Level) {
+			if err := h.Handle(ctx, record.Clone()); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := make(fanout, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// requestIDLocal is the fiber Locals key holding a request's correlation ID
+const requestIDLocal = "logging.request_id"
+
+// Middleware gives each request a correlation ID, taken from its
+// X-Request-ID header when valid and generated otherwise, echoes it in the
+// response and logs the request once it completes
+func Middleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		id := c.Get(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+		c.Locals(requestIDLocal, id)
+		c.Set(RequestIDHeader, id)
+
+		err := c.Next()
+		if err != nil {
+			// Let the error handler write the response so the status is final
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+			err = nil
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.Default().LogAttrs(context.Background(), level, "request",
+			slog.String("request_id", id),
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+			slog.String("client", c.IP()),
+		)
+		return err
+	}
+}
+
+// RequestIDFrom returns the correlation ID Middleware gave a request, or ""
+func RequestIDFrom(c fiber.Ctx) string {
+	id, _ := c.Locals(requestIDLocal).(string)
+	return id
+}
+
+// RequestContext returns a context for work done on behalf of a request,
+// carrying its correlation ID
+func RequestContext(c fiber.Ctx) context.Context {
+	ctx := c.Context()
+	if id := RequestIDFrom(c); id != "" {
+		return WithRequestID(ctx, id)
+	}
+	return ctx
+}
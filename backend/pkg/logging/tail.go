@@ -0,0 +1,189 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTailLimit is how many records a tail query returns unless asked
+	defaultTailLimit = 200
+	// maxTailLimit caps the records one tail query returns
+	maxTailLimit = 2000
+)
+
+// Entry is one log record kept by a Tail
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// TailQuery filters a tail
+type TailQuery struct {
+	Level     string `query:"level"`      // minimum level: debug, info, warn or error
+	RequestID string `query:"request_id"` // only records of one request or task
+	Contains  string `query:"q"`          // case-insensitive substring of the message
+	Since     string `query:"since"`      // RFC 3339
+	Limit     int    `query:"limit"`      // newest records, default 200, up to 2000
+}
+
+// Tail keeps the most recent log records in memory. It is an slog.Handler;
+// Setup installs it next to the console handler.
+type Tail struct {
+	level slog.Level
+	ring  *ring
+	attrs []slog.Attr
+	group string // prefix of attribute keys added under WithGroup
+}
+
+// ring is the buffer a Tail and the handlers derived from it share
+type ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// NewTail keeps the last size records at or above level
+func NewTail(size int, level slog.Level) *Tail {
+	return &Tail{level: level, ring: &ring{entries: make([]Entry, max(size, 0))}}
+}
+
+func (t *Tail) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= t.level && len(t.ring.entries) > 0
+}
+
+func (t *Tail) Handle(_ context.Context, record slog.Record) error {
+	entry := Entry{Time: record.Time, Level: record.Level.String(), Message: record.Message}
+	if len(t.attrs) > 0 || record.NumAttrs() > 0 {
+		entry.Attrs = make(map[string]interface{}, len(t.attrs)+record.NumAttrs())
+		for _, attr := range t.attrs {
+			addAttr(entry.Attrs, "", attr)
+		}
+		record.Attrs(func(attr slog.Attr) bool {
+			addAttr(entry.Attrs, t.group, attr)
+			return true
+		})
+	}
+
+	r := t.ring
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+	return nil
+}
+
+func (t *Tail) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := *t
+	derived.attrs = append([]slog.Attr(nil), t.attrs...)
+	for _, attr := range attrs {
+		attr.Key = t.group + attr.Key
+		derived.attrs = append(derived.attrs, attr)
+	}
+	return &derived
+}
+
+func (t *Tail) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return t
+	}
+	derived := *t
+	derived.group = t.group + name + "."
+	return &derived
+}
+
+// addAttr flattens an attribute into attrs, joining group keys with dots
+func addAttr(attrs map[string]interface{}, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, member := range value.Group() {
+			addAttr(attrs, prefix+attr.Key+".", member)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	if err, ok := value.Any().(error); ok {
+		attrs[prefix+attr.Key] = err.Error()
+		return
+	}
+	attrs[prefix+attr.Key] = value.Any()
+}
+
+// Query returns the newest records matching q, oldest first
+func (t *Tail) Query(q TailQuery) ([]Entry, error) {
+	level := slog.LevelDebug
+	if q.Level != "" {
+		parsed, err := ParseLevel(q.Level)
+		if err != nil {
+			return nil, err
+		}
+		level = parsed
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultTailLimit
+	}
+	limit = min(limit, maxTailLimit)
+	var since time.Time
+	if q.Since != "" {
+		parsed, err := time.Parse(time.RFC3339, q.Since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since %q, expected RFC 3339", q.Since)
+		}
+		since = parsed
+	}
+	contains := strings.ToLower(q.Contains)
+
+	r := t.ring
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Walk newest to oldest, then put the page back in time order
+	matched := make([]Entry, 0, min(limit, len(r.entries)))
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+	for i := 1; i <= count && len(matched) < limit; i++ {
+		entry := r.entries[(r.next-i+len(r.entries))%len(r.entries)]
+		if !since.IsZero() && entry.Time.Before(since) {
+			break
+		}
+		if levelRank(entry.Level) < level ||
+			(q.RequestID != "" && !matchesRequest(entry, q.RequestID)) ||
+			(contains != "" && !strings.Contains(strings.ToLower(entry.Message), contains)) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched, nil
+}
+
+// matchesRequest reports whether a record belongs to a request or task
+func matchesRequest(entry Entry, id string) bool {
+	return entry.Attrs["request_id"] == id || entry.Attrs["task_id"] == id
+}
+
+// levelRank parses a level name written by slog.Level.String, e.g. "WARN+2"
+func levelRank(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
@@ -0,0 +1,325 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format written by WriteText
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency buckets in seconds suited to LLM requests
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Default is the registry package-level metrics are added to
+var Default = NewRegistry()
+
+// metric is a named metric family that can write itself
+type metric interface {
+	write(w io.Writer) error
+}
+
+// Registry holds metrics and writes them in the Prometheus text format
+type Registry struct {
+	mu      sync.Mutex
+	names   []string
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds m; a metric registered again under the same name replaces
+// the earlier one, so a collector can be re-registered for a new instance
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.metrics[name]; !ok {
+		r.names = append(r.names, name)
+		sort.Strings(r.names)
+	}
+	r.metrics[name] = m
+}
+
+// WriteText writes every metric in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.names))
+	for _, name := range r.names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return fmt.Errorf("failed to write metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec adds a counter to the registry
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*counterSeries)}
+	r.register(name, c)
+	return c
+}
+
+// NewCounterVec adds a counter to the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// Inc adds one to the series with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta, which must not be negative, to the series with the given label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	key := seriesKey(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	series, ok := c.values[key]
+	if !ok {
+		series = &counterSeries{labels: append([]string(nil), values...)}
+		c.values[key] = series
+	}
+	series.value += delta
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	samples := make([]Sample, 0, len(c.values))
+	for _, series := range c.values {
+		samples = append(samples, Sample{Labels: series.labels, Value: series.value})
+	}
+	c.mu.Unlock()
+
+	return writeFamily(w, c.name, c.help, "counter", c.labels, samples)
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec adds a histogram to the registry; nil buckets use DefaultBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramSeries)}
+	r.register(name, h)
+	return h
+}
+
+// NewHistogramVec adds a histogram to the default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// Observe records a value in the series with the given label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	key := seriesKey(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.values[key]
+	if !ok {
+		series = &histogramSeries{labels: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = series
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		series.counts[i]++
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	series := make([]histogramSeries, 0, len(h.values))
+	for _, s := range h.values {
+		series = append(series, histogramSeries{labels: s.labels, counts: append([]uint64(nil), s.counts...), count: s.count, sum: s.sum})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		return seriesKey(series[i].labels) < seriesKey(series[j].labels)
+	})
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, escapeHelp(h.help), h.name); err != nil {
+		return err
+	}
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, s := range series {
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			values := append(append([]string(nil), s.labels...), formatValue(bound))
+			if err := writeSample(w, h.name+"_bucket", bucketLabels, values, float64(cumulative)); err != nil {
+				return err
+			}
+		}
+		values := append(append([]string(nil), s.labels...), "+Inf")
+		if err := writeSample(w, h.name+"_bucket", bucketLabels, values, float64(s.count)); err != nil {
+			return err
+		}
+		if err := writeSample(w, h.name+"_sum", h.labels, s.labels, s.sum); err != nil {
+			return err
+		}
+		if err := writeSample(w, h.name+"_count", h.labels, s.labels, float64(s.count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sample is one gauge reading
+type Sample struct {
+	Labels []string // values for the gauge's labels, in order
+	Value  float64
+}
+
+// gaugeFunc is a gauge whose samples are read when metrics are written
+type gaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func() []Sample
+}
+
+// NewGaugeFunc adds a gauge whose samples are collected on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	r.register(name, &gaugeFunc{name: name, help: help, labels: labels, collect: collect})
+}
+
+// NewGaugeFunc adds a gauge to the default registry
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	Default.NewGaugeFunc(name, help, labels, collect)
+}
+
+func (g *gaugeFunc) write(w io.Writer) error {
+	return writeFamily(w, g.name, g.help, "gauge", g.labels, g.collect())
+}
+
+// writeFamily writes a counter or gauge family sorted by label values
+func writeFamily(w io.Writer, name, help, kind string, labels []string, samples []Sample) error {
+	sort.Slice(samples, func(i, j int) bool {
+		return seriesKey(samples[i].Labels) < seriesKey(samples[j].Labels)
+	})
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind); err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		if err := writeSample(w, name, labels, sample.Labels, sample.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSample(w io.Writer, name string, labels, values []string, value float64) error {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			b.WriteString(label)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(v))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatValue(value))
+	b.WriteByte('\n')
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// seriesKey joins label values with a byte that can't appear in UTF-8 text
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
@@ -26,6 +26,7 @@ type Message struct {
 	Source    string                 `json:"source"`
 	Payload   map[string]interface{} `json:"payload"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Seq       uint64                 `json:"seq,omitempty"` // numbers broadcasts, for replay after a reconnect
 }
 
 // Agent Requests
@@ -38,6 +39,30 @@ type CommandRequest struct {
 	SessionID string                 `json:"session_id"`
 	Command   string                 `json:"command"`
 	Context   map[string]interface{} `json:"context,omitempty"`
+	TaskID    string                 `json:"task_id,omitempty"`
+	Resume    bool                   `json:"resume,omitempty"` // continue interrupted TaskID instead of running Command
+	Budget    *TaskBudget            `json:"budget,omitempty"` // lowers the server's task budget
+}
+
+// TaskBudget limits the tokens and time a task may use; 0 is no limit.
+// A task that runs out fails.
+type TaskBudget struct {
+	MaxTokens  int `json:"max_tokens,omitempty"`
+	MaxSeconds int `json:"max_seconds,omitempty"`
+}
+
+// TokenUsage counts the model requests made and the tokens they used
+type TokenUsage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// UsageRequest selects the days and tasks of the usage report
+type UsageRequest struct {
+	Days  int `query:"days" json:"days,omitempty"`   // including today; default 7
+	Tasks int `query:"tasks" json:"tasks,omitempty"` // most recent; default 20
 }
 
 // Agent Status
@@ -58,8 +83,19 @@ type FileNode struct {
 	Type     string      `json:"type"`
 	Path     string      `json:"path"`
 	Size     int64       `json:"size,omitempty"`
-	Modified time.Time   `json:"modified,omitempty"`
+	Modified time.Time   `json:"modified,omitzero"`
 	Children []*FileNode `json:"children,omitempty"`
+	Lazy     bool        `json:"lazy,omitempty"`    // a directory whose children weren't loaded; ask for its path
+	Omitted  int         `json:"omitted,omitempty"` // children left out by the max_children limit
+}
+
+// FileTreeRequest lists a directory, expanding Depth levels
+type FileTreeRequest struct {
+	Path        string `query:"path" json:"path,omitempty"`
+	Depth       int    `query:"depth" json:"depth,omitempty"`               // default 2, up to 10
+	MaxChildren int    `query:"max_children" json:"max_children,omitempty"` // per directory, default 500
+	Hidden      bool   `query:"hidden" json:"hidden,omitempty"`             // also list dotfiles
+	NoIgnore    bool   `query:"no_ignore" json:"no_ignore,omitempty"`       // don't apply .gitignore and .agentignore
 }
 
 type FileContent struct {
@@ -69,31 +105,184 @@ type FileContent struct {
 	Size     int64  `json:"size"`
 }
 
+// FileReadRequest names a workspace file to read
+type FileReadRequest struct {
+	Path string `query:"path" json:"path"`
+}
+
+// FileDeleteRequest deletes a file, or a directory with Recursive unless
+// it's empty
+type FileDeleteRequest struct {
+	Path      string `query:"path" json:"path"`
+	Recursive bool   `query:"recursive" json:"recursive,omitempty"`
+}
+
 type FileWriteRequest struct {
 	Path    string `json:"path"`
 	Content string `json:"content"`
 }
 
+// FileCreateRequest creates a file, or a directory when Type is "directory"
+type FileCreateRequest struct {
+	Path    string `json:"path"`
+	Content string `json:"content,omitempty"`
+	Type    string `json:"type,omitempty"` // "file" (default) or "directory"
+}
+
+type FileRenameRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// WorkspaceOpenRequest opens a directory as a named workspace
+type WorkspaceOpenRequest struct {
+	Name     string `json:"name"`               // 1-48 lowercase letters, digits, '-' or '_'
+	Root     string `json:"root"`               // an existing directory
+	Activate bool   `json:"activate,omitempty"` // switch to it once open
+}
+
+type WorkspaceSwitchRequest struct {
+	Name string `json:"name"`
+}
+
 type FileDiffRequest struct {
-	Path string `json:"path"`
-	Diff string `json:"diff"`
+	Path   string `json:"path"`
+	Diff   string `json:"diff"`
+	DryRun bool   `json:"dry_run,omitempty"` // preview the result without writing
+}
+
+// FileSearchRequest finds workspace files by name and/or lines by pattern
+type FileSearchRequest struct {
+	Path       string `query:"path" json:"path,omitempty"`       // directory to search, default the root
+	Name       string `query:"name" json:"name,omitempty"`       // glob, or substring without wildcards; matched against names, or paths when it has a slash
+	Pattern    string `query:"q" json:"q,omitempty"`             // regular expression matched against each line
+	Literal    bool   `query:"literal" json:"literal,omitempty"` // treat the pattern as plain text
+	IgnoreCase bool   `query:"ignore_case" json:"ignore_case,omitempty"`
+	Context    int    `query:"context" json:"context,omitempty"`     // lines shown before and after each match, up to 10
+	Limit      int    `query:"limit" json:"limit,omitempty"`         // most matches returned, default 200
+	Hidden     bool   `query:"hidden" json:"hidden,omitempty"`       // also search dotfiles and dot directories
+	NoIgnore   bool   `query:"no_ignore" json:"no_ignore,omitempty"` // don't apply .gitignore files
 }
 
 // Memory System
 type MemoryQueryRequest struct {
-	Query string `json:"query"`
-	Mode  string `json:"mode"` // "naive", "local", "global", "hybrid"
+	Query  string   `json:"query"`
+	Mode   string   `json:"mode"`              // LightRAG mode ("naive", "local", "global", "hybrid") and/or memory kinds ("episodic", "semantic", "procedural"), joined by "+" or ","; no LightRAG mode skips the synthesized answer
+	TaskID string   `json:"task_id,omitempty"` // search one task's short-term memory instead
+	Kinds  []string `json:"kinds,omitempty"`   // task-scoped only: "perception", "reasoning", "action", "reflection"
+	Offset int      `json:"offset,omitempty"`
+	Limit  int      `json:"limit,omitempty"`
+	// IncludeCode also searches the mirrored code graph, merging symbols with documents on one score scale
+	IncludeCode bool `json:"include_code,omitempty"`
+	// Filter restricts long-term results by metadata; with an empty query it lists matching documents
+	Filter *MemoryQueryFilter `json:"filter,omitempty"`
+}
+
+type MemoryQueryFilter struct {
+	Types          []string   `json:"types,omitempty"`
+	FilepathPrefix string     `json:"filepath_prefix,omitempty"`
+	TaskID         string     `json:"task_id,omitempty"` // task that produced the document
+	Since          *time.Time `json:"since,omitempty"`
+	Until          *time.Time `json:"until,omitempty"`
 }
 
 type MemoryStoreRequest struct {
-	Type    string                 `json:"type"` // "message", "file", "concept", etc.
-	Content string                 `json:"content"`
+	Type     string                 `json:"type"` // "conversation", "code", "concept", "action", "task_archive", "procedure", "documentation"; "perception", "reflection" need task_id
+	Content  string                 `json:"content"`
+	TaskID   string                 `json:"task_id,omitempty"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// MergePolicy overrides MEMORY_MERGE_POLICY for long-term types: "skip", "replace", "append_version"
+	MergePolicy string `json:"merge_policy,omitempty"`
+}
+
+type MemoryDeleteRequest struct {
+	Filter MemoryQueryFilter `json:"filter"` // must set at least one field
+}
+
+type MemoryFeedbackRequest struct {
+	DocumentID string  `json:"document_id"`
+	Reward     float64 `json:"reward"` // 0 (useless) to 1 (essential)
+}
+
+type MemoryTaskListRequest struct {
+	Status string `query:"status" json:"status,omitempty"`
+	Offset int    `query:"offset" json:"offset,omitempty"`
+	Limit  int    `query:"limit" json:"limit,omitempty"`
+}
+
+type MemoryResult struct {
+	Source    string                 `json:"source"` // "long_term", "short_term" or "code_graph"
+	Kind      string                 `json:"kind"`   // long-term: "episodic", "semantic", "procedural"; short-term: "perception", "reasoning", "action", "reflection"
+	ID        string                 `json:"id,omitempty"`
+	Content   string                 `json:"content"`
+	Timestamp *time.Time             `json:"timestamp,omitempty"`
+	Score     float64                `json:"score,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type MemoryQueryResponse struct {
+	Results []MemoryResult `json:"results"`
+	Answer  string         `json:"answer,omitempty"`
+	Total   int            `json:"total,omitempty"` // only known for task-scoped queries
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+	HasMore bool           `json:"has_more"`
+}
+
+type MemoryTaskListResponse struct {
+	Tasks  []map[string]interface{} `json:"tasks"`
+	Total  int                      `json:"total"`
+	Offset int                      `json:"offset"`
+	Limit  int                      `json:"limit"`
+}
+
+// MemoryTaskImportRequest imports a task bundle, under a new ID when
+// TaskID is set
+type MemoryTaskImportRequest struct {
+	TaskID string `query:"task_id" json:"task_id,omitempty"`
+}
+
+type MemoryIndexRequest struct {
+	Path  string `json:"path,omitempty"`  // directory relative to WORKSPACE_ROOT; empty indexes everything
+	Force bool   `json:"force,omitempty"` // re-read files even if size and mtime are unchanged
+}
+
+type MemoryGraphRequest struct {
+	Node  string `query:"node" json:"node,omitempty"`   // entity name to center on
+	Query string `query:"query" json:"query,omitempty"` // used when node is empty: start from the best-matching entities
+	Depth int    `query:"depth" json:"depth,omitempty"` // hops to expand, 1-3
+	Limit int    `query:"limit" json:"limit,omitempty"` // maximum nodes returned
+}
+
+type MemoryAuditRequest struct {
+	Operation string `query:"operation" json:"operation,omitempty"` // "store", "query" or "delete"
+	Caller    string `query:"caller" json:"caller,omitempty"`
+	Since     string `query:"since" json:"since,omitempty"` // RFC 3339
+	Until     string `query:"until" json:"until,omitempty"` // RFC 3339
+	Offset    int    `query:"offset" json:"offset,omitempty"`
+	Limit     int    `query:"limit" json:"limit,omitempty"`
 }
 
 type VectorSearchRequest struct {
-	Query string `json:"query"`
-	TopK  int    `json:"top_k"`
+	Query  string             `json:"query"`
+	TopK   int                `json:"top_k"`
+	Offset int                `json:"offset,omitempty"`
+	Filter *MemoryQueryFilter `json:"filter,omitempty"`
+}
+
+type VectorSearchResult struct {
+	ID       string                 `json:"id"`
+	Content  string                 `json:"content"`
+	Score    float64                `json:"score"` // cosine similarity to the query
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type VectorSearchResponse struct {
+	Query   string               `json:"query"`
+	Results []VectorSearchResult `json:"results"`
+	Offset  int                  `json:"offset"`
+	TopK    int                  `json:"top_k"`
+	HasMore bool                 `json:"has_more"`
 }
 
 // Browser
@@ -121,15 +310,204 @@ type BrowserElement struct {
 
 // OpenEvolve
 type ProposalRequest struct {
-	Component   string                 `json:"component"`
-	Description string                 `json:"description"`
-	Changes     map[string]interface{} `json:"changes"`
+	Component         string                 `json:"component"`
+	Description       string                 `json:"description"`
+	Changes           map[string]interface{} `json:"changes"`
+	Strategy          string                 `json:"strategy,omitempty"`   // approach that generated the proposal
+	MemoryIDs         []string               `json:"memory_ids,omitempty"` // memory documents the proposal was derived from
+	Author            string                 `json:"author,omitempty"`
+	Draft             bool                   `json:"draft,omitempty"`              // start as a draft instead of going straight into review
+	RequiredApprovals int                    `json:"required_approvals,omitempty"` // more than the configured minimum
+}
+
+type ProposalRejectRequest struct {
+	Reason   string `json:"reason"`
+	Reviewer string `json:"reviewer,omitempty"`
+}
+
+type ProposalReviewRequest struct {
+	Reviewer string `json:"reviewer,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type ProposalCommentRequest struct {
+	Author  string `json:"author,omitempty"`
+	Body    string `json:"body"`
+	File    string `json:"file,omitempty"`     // a file the proposal changes
+	Line    int    `json:"line,omitempty"`     // line in that file's diff
+	Side    string `json:"side,omitempty"`     // "old" or "new" (default)
+	ReplyTo string `json:"reply_to,omitempty"` // comment ID
+}
+
+type ProposalCommentResolveRequest struct {
+	Resolved *bool `json:"resolved,omitempty"` // false reopens; default true
+}
+
+type CommitCheckRequest struct {
+	Author string `json:"author"`
+	Email  string `json:"email"`
+	Diff   string `json:"diff"` // staged changes as a unified diff; full context lets Go files be parsed
+}
+
+type TaskMetricsRequest struct {
+	TaskID        string `json:"task_id"`
+	Strategy      string `json:"strategy"`
+	PromptVersion string `json:"prompt_version,omitempty"` // a new version marks a prompt evolution
+	DurationMs    int64  `json:"duration_ms"`
+	Retries       int    `json:"retries"`
+	Tokens        int    `json:"tokens"`
+	Success       bool   `json:"success"`
+	FinishedAt    string `json:"finished_at,omitempty"` // RFC 3339; now by default
 }
 
 type RewardRequest struct {
 	ProposalID string  `json:"proposal_id"`
 	Reward     float64 `json:"reward"`
 	Feedback   string  `json:"feedback,omitempty"`
+	Reviewer   string  `json:"reviewer,omitempty"` // who gave the reward; recorded in the reward ledger
+}
+
+type EvolveAnalyticsQuery struct {
+	Component string `query:"component" json:"component,omitempty"`
+	Strategy  string `query:"strategy" json:"strategy,omitempty"`
+	Since     string `query:"since" json:"since,omitempty"`   // RFC 3339
+	Until     string `query:"until" json:"until,omitempty"`   // RFC 3339
+	Bucket    string `query:"bucket" json:"bucket,omitempty"` // "hour", "day" (default) or "week"
+	Window    int    `query:"window" json:"window,omitempty"` // rewards in the rolling mean; default 10
+}
+
+type WatchdogAlertQuery struct {
+	Type         string `query:"type" json:"type,omitempty"`
+	Severity     string `query:"severity" json:"severity,omitempty"`
+	Acknowledged string `query:"acknowledged" json:"acknowledged,omitempty"` // "true", "false" or empty for both
+	State        string `query:"state" json:"state,omitempty"`               // open, acknowledged, resolved or ignored
+	Assignee     string `query:"assignee" json:"assignee,omitempty"`
+	Since        string `query:"since" json:"since,omitempty"` // RFC 3339
+	Until        string `query:"until" json:"until,omitempty"` // RFC 3339
+	Offset       int    `query:"offset" json:"offset,omitempty"`
+	Limit        int    `query:"limit" json:"limit,omitempty"`
+}
+
+type AlertActionRequest struct {
+	Actor    string `json:"actor"`
+	Assignee string `json:"assignee,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+type WatchdogScanRequest struct {
+	Path           string   `json:"path,omitempty"`     // file or directory relative to the workspace
+	Files          []string `json:"files,omitempty"`    // files relative to the workspace
+	Range          string   `json:"range,omitempty"`    // git revisions, e.g. "main..HEAD"; a single revision is compared with the working tree
+	Severity       string   `json:"severity,omitempty"` // lowest severity returned; empty returns every finding
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+	Record         bool     `json:"record,omitempty"` // also raise the findings as alerts
+}
+
+// Authentication
+type APIKeyRequest struct {
+	Name          string `json:"name"`
+	Scope         string `json:"scope"`                     // read, browse, execute or admin
+	ExpiresInDays int    `json:"expires_in_days,omitempty"` // zero never expires
+}
+
+type SessionRequest struct {
+	Scope string `json:"scope,omitempty"` // narrower than the key's; empty keeps the key's scope
+}
+
+// ChatStreamRequest opens a chat stream, resuming SessionID if set. User
+// names the client when auth is off; TaskID starts it viewing a task.
+type ChatStreamRequest struct {
+	SessionID string `query:"session_id" json:"session_id,omitempty"`
+	User      string `query:"user" json:"user,omitempty"`
+	TaskID    string `query:"task_id" json:"task_id,omitempty"`
+}
+
+// ChatStreamMessageRequest is a message sent up a chat stream, as it
+// would be sent over /ws/chat
+type ChatStreamMessageRequest struct {
+	StreamID string                 `json:"stream_id"`
+	ID       string                 `json:"id,omitempty"`
+	Type     string                 `json:"type"`
+	Payload  map[string]interface{} `json:"payload,omitempty"`
+}
+
+// Presence is a user connected to chat and the task they're viewing
+type Presence struct {
+	ConnectionID string    `json:"connection_id"`
+	User         string    `json:"user"`
+	TaskID       string    `json:"task_id,omitempty"`
+	Transport    string    `json:"transport"` // "websocket" or "sse"
+	Since        time.Time `json:"since"`
+}
+
+type ArtifactListRequest struct {
+	TaskID string `query:"task_id" json:"task_id,omitempty"`
+	Kind   string `query:"kind" json:"kind,omitempty"`     // screenshot, download, code, report or file
+	Source string `query:"source" json:"source,omitempty"` // agent, browser or api
+	Offset int    `query:"offset" json:"offset,omitempty"`
+	Limit  int    `query:"limit" json:"limit,omitempty"`
+}
+
+// ArtifactCreateRequest describes an upload; the body is the contents
+type ArtifactCreateRequest struct {
+	Name   string `query:"name" json:"name"`
+	TaskID string `query:"task_id" json:"task_id,omitempty"`
+	Kind   string `query:"kind" json:"kind,omitempty"` // defaults to file
+}
+
+// ArtifactUpdateRequest changes the fields it sets
+type ArtifactUpdateRequest struct {
+	Name     *string           `json:"name,omitempty"`
+	TaskID   *string           `json:"task_id,omitempty"` // "" detaches the artifact from its task
+	Kind     *string           `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type WebhookCreateRequest struct {
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"` // generated when empty
+	Events      []string `json:"events,omitempty"` // e.g. task.completed or task.*; empty is every event
+	Description string   `json:"description,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"` // true by default
+}
+
+// WebhookUpdateRequest changes the fields it sets; an empty secret
+// generates a new one
+type WebhookUpdateRequest struct {
+	URL         *string  `json:"url,omitempty"`
+	Secret      *string  `json:"secret,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"`
+}
+
+type WebhookDeliveryListRequest struct {
+	WebhookID string `query:"webhook_id" json:"webhook_id,omitempty"`
+	Event     string `query:"event" json:"event,omitempty"`
+	Status    string `query:"status" json:"status,omitempty"` // pending, delivered or failed
+	Offset    int    `query:"offset" json:"offset,omitempty"`
+	Limit     int    `query:"limit" json:"limit,omitempty"`
+}
+
+// ModelRequest names an Ollama model, such as gemma3:27b
+type ModelRequest struct {
+	Name string `query:"name" json:"name"`
+}
+
+// ModelSwitchRequest picks the models to use from now on; empty fields
+// keep the current model
+type ModelSwitchRequest struct {
+	Chat      string `json:"chat,omitempty"`
+	Embedding string `json:"embedding,omitempty"` // must make embeddings of EMBEDDING_DIMENSION values
+	Vision    string `json:"vision,omitempty"`
+}
+
+// ChatStreamMessageResponse confirms a message sent up a chat stream;
+// replies arrive on the stream
+type ChatStreamMessageResponse struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	Accepted  bool   `json:"accepted,omitempty"`
 }
 
 // Task Management
@@ -143,6 +521,24 @@ type Task struct {
 	Error       string                 `json:"error,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+	Resume      bool                   `json:"resume,omitempty"`   // interrupted by a restart and can be resumed
+	TraceID     string                 `json:"trace_id,omitempty"` // the task's trace, when tracing is on
+	Budget      *TaskBudget            `json:"budget,omitempty"`
+	Usage       *TokenUsage            `json:"usage,omitempty"` // the tokens the task's model requests used
+}
+
+// TaskCreateRequest starts a task working toward Goal
+type TaskCreateRequest struct {
+	Goal    string                 `json:"goal"`
+	Context map[string]interface{} `json:"context,omitempty"`
+	Budget  *TaskBudget            `json:"budget,omitempty"` // lowers the server's task budget
+}
+
+// TaskListRequest filters the task list
+type TaskListRequest struct {
+	Status string `query:"status" json:"status,omitempty"` // running, completed, failed, cancelled or interrupted
+	Type   string `query:"type" json:"type,omitempty"`
+	Limit  int    `query:"limit" json:"limit,omitempty"`
 }
 
 type TaskStep struct {
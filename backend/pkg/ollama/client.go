@@ -1,27 +1,222 @@
 package ollama
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"agent-workspace/backend/pkg/metrics"
 )
 
-// Client is an Ollama API client
+// requestDuration tracks how long Ollama takes to answer, by operation and outcome
+var requestDuration = metrics.NewHistogramVec("ollama_request_duration_seconds",
+	"Time taken by Ollama requests", nil, "operation", "status")
+
+// tokensTotal counts the tokens chat completions used, by prompt or completion
+var tokensTotal = metrics.NewCounterVec("ollama_tokens_total",
+	"Tokens used by Ollama chat completions", "type")
+
+// ErrToolsUnsupported is returned when the model can't call tools
+var ErrToolsUnsupported = errors.New("model does not support tools")
+
+// APIError is an error status an API answered a request with
+type APIError struct {
+	API        string // ollama, anthropic, ...
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.API, e.StatusCode, e.Body)
+}
+
+// apiError reads a failed response's body into an APIError
+func apiError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return &APIError{API: "ollama", StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// Client is an Ollama API client. It speaks Ollama's OpenAI-compatible v1
+// API, and its native chat API for chat, so with OpenAICompatible set it
+// also serves other OpenAI-compatible servers.
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	model      string
-	embedModel string
+	baseURL     string
+	apiKey      string
+	httpClient  *http.Client
+	model       string
+	embedModel  string
+	visionModel string
+	// nativeTools is unset when OLLAMA_NATIVE_TOOLS is off
+	nativeTools bool
+	// pinned clients keep their models when SwitchModels is called
+	pinned bool
+	// openAICompatible clients send chat to the v1 API instead of /api/chat
+	openAICompatible bool
+	// options are the defaults of requests that don't set their own
+	options Options
 }
 
-// ChatMessage represents a chat message
+// toolless holds the models that have turned down a request with tools
+var toolless sync.Map
+
+// ChatMessage represents a chat message. Assistant messages may carry the
+// tool calls the model made, and role "tool" messages answer one of them.
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Images are shown to vision models with the message, each base64
+	// encoded or a data: URL
+	Images []string `json:"images,omitempty"`
+}
+
+// contentPart is a piece of a message whose content mixes text and images
+type contentPart struct {
+	Type     string        `json:"type"` // text or image_url
+	Text     string        `json:"text,omitempty"`
+	ImageURL *contentImage `json:"image_url,omitempty"`
+}
+
+type contentImage struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON sends a message with images as content parts, the form the
+// v1 API takes them in
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	type plain ChatMessage
+	if len(m.Images) == 0 {
+		return json.Marshal(plain(m))
+	}
+
+	parts := make([]contentPart, 0, len(m.Images)+1)
+	if m.Content != "" {
+		parts = append(parts, contentPart{Type: "text", Text: m.Content})
+	}
+	for _, image := range m.Images {
+		parts = append(parts, contentPart{Type: "image_url", ImageURL: &contentImage{URL: imageURL(image)}})
+	}
+	msg := plain(m)
+	msg.Images = nil
+	return json.Marshal(struct {
+		plain
+		Content []contentPart `json:"content"`
+	}{msg, parts})
+}
+
+// UnmarshalJSON reads content given as text or as content parts
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	type plain ChatMessage
+	var msg struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = ChatMessage(msg.plain)
+
+	content := bytes.TrimSpace(msg.Content)
+	if len(content) == 0 || content[0] != '[' {
+		if len(content) == 0 || string(content) == "null" {
+			return nil
+		}
+		return json.Unmarshal(content, &m.Content)
+	}
+
+	var parts []contentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return err
+	}
+	var text []string
+	for _, part := range parts {
+		switch {
+		case part.Type == "text":
+			text = append(text, part.Text)
+		case part.Type == "image_url" && part.ImageURL != nil:
+			m.Images = append(m.Images, part.ImageURL.URL)
+		}
+	}
+	m.Content = strings.Join(text, "\n")
+	return nil
+}
+
+// EncodeImage encodes an image for ChatMessage.Images
+func EncodeImage(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// imageURL makes a data: URL of a base64 image, detecting its type
+func imageURL(image string) string {
+	if strings.HasPrefix(image, "data:") {
+		return image
+	}
+	// 344 characters decode to the 258 bytes that sniffing looks at
+	head, _ := base64.StdEncoding.DecodeString(image[:min(len(image), 344)])
+	return "data:" + http.DetectContentType(head) + ";base64," + image
+}
+
+// Tool is a function the model may call
+type Tool struct {
+	Type     string       `json:"type"` // always "function"
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction describes a callable function; Parameters is a JSON Schema
+type ToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolCall is a function call the model made
+type ToolCall struct {
+	Index    int              `json:"index,omitempty"` // position in a streamed reply
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction names the function called and its JSON-encoded arguments
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// NewTool creates a function tool taking parameters, a JSON Schema object
+func NewTool(name, description string, parameters map[string]interface{}) Tool {
+	if parameters == nil {
+		parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return Tool{
+		Type:     "function",
+		Function: ToolFunction{Name: name, Description: description, Parameters: parameters},
+	}
+}
+
+// Args decodes the call's arguments, treating none as an empty object
+func (t ToolCall) Args() (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if strings.TrimSpace(t.Function.Arguments) == "" {
+		return args, nil
+	}
+	if err := json.Unmarshal([]byte(t.Function.Arguments), &args); err != nil {
+		return args, fmt.Errorf("invalid arguments for %s: %w", t.Function.Name, err)
+	}
+	return args, nil
 }
 
 // ChatCompletionRequest represents a v1 chat completion request
@@ -31,33 +226,176 @@ type ChatCompletionRequest struct {
 	Stream      bool          `json:"stream"`
 	Temperature float64       `json:"temperature,omitempty"`
 	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Tools       []Tool        `json:"tools,omitempty"`
+	// ToolChoice is "auto", "none", "required" or a specific function
+	ToolChoice     interface{}     `json:"tool_choice,omitempty"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	TopP           float64         `json:"top_p,omitempty"`
+	Seed           *int            `json:"seed,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	// N is how many choices to sample; APIs without it, such as Ollama's,
+	// return one
+	N int `json:"n,omitempty"`
+	// Logprobs asks for the log probability of each token of the choices,
+	// and TopLogprobs for those of the likeliest tokens in its place
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs int  `json:"top_logprobs,omitempty"`
+	// Options and KeepAlive are Ollama's, which only its /api/chat honours:
+	// model options such as top_k and num_ctx, and how long the model
+	// stays loaded after the request
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+}
+
+// Options are generation settings besides temperature; zero values leave
+// the model's defaults
+type Options struct {
+	TopP float64  `json:"top_p,omitempty"`
+	TopK int      `json:"top_k,omitempty"`
+	Seed *int     `json:"seed,omitempty"` // random when nil
+	Stop []string `json:"stop,omitempty"`
+	// NumCtx is the context window in tokens; Ollama cuts longer prompts
+	// short, dropping their start
+	NumCtx int `json:"num_ctx,omitempty"`
+	// KeepAlive is how long the model stays loaded after a request, such
+	// as "30m"; "-1" keeps it loaded
+	KeepAlive string `json:"keep_alive,omitempty"`
+}
+
+// Merge returns o with the settings override sets replaced
+func (o Options) Merge(override Options) Options {
+	if override.TopP != 0 {
+		o.TopP = override.TopP
+	}
+	if override.TopK != 0 {
+		o.TopK = override.TopK
+	}
+	if override.Seed != nil {
+		o.Seed = override.Seed
+	}
+	if override.Stop != nil {
+		o.Stop = override.Stop
+	}
+	if override.NumCtx != 0 {
+		o.NumCtx = override.NumCtx
+	}
+	if override.KeepAlive != "" {
+		o.KeepAlive = override.KeepAlive
+	}
+	return o
+}
+
+// Apply sets the settings of req that o sets and req doesn't
+func (o Options) Apply(req *ChatCompletionRequest) {
+	if req.TopP == 0 {
+		req.TopP = o.TopP
+	}
+	if req.Seed == nil {
+		req.Seed = o.Seed
+	}
+	if req.Stop == nil {
+		req.Stop = o.Stop
+	}
+	if req.KeepAlive == "" {
+		req.KeepAlive = o.KeepAlive
+	}
+	for key, value := range map[string]int{"top_k": o.TopK, "num_ctx": o.NumCtx} {
+		if value == 0 {
+			continue
+		}
+		if req.Options == nil {
+			req.Options = make(map[string]interface{})
+		}
+		if _, set := req.Options[key]; !set {
+			req.Options[key] = value
+		}
+	}
+}
+
+// StreamOptions asks a stream to end with a chunk carrying the usage
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ResponseFormat constrains a reply to JSON, matching a schema when one is set
+type ResponseFormat struct {
+	Type       string      `json:"type"` // json_object or json_schema
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema names the schema a json_schema reply follows
+type JSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict,omitempty"`
+}
+
+// Usage counts the tokens a completion used
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// StreamResult is what a streamed completion ends with, besides its text
+type StreamResult struct {
+	ToolCalls    []ToolCall
+	FinishReason string // stop, length or tool_calls; empty when the stream was cut short
+	Usage        Usage
+	Model        string // the model that answered, which may be a fallback
 }
 
 // ChatCompletionResponse represents a v1 chat completion response
 type ChatCompletionResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index   int `json:"index"`
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"` // only on a stream's last chunk when streaming
 }
 
-// EmbeddingRequest represents an embedding request
+// Choice is one answer of a chat completion
+type Choice struct {
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	Delta        ChatMessage `json:"delta"` // set instead of Message when streaming
+	FinishReason string      `json:"finish_reason"`
+	Logprobs     *Logprobs   `json:"logprobs,omitempty"` // when asked for and the API has them
+}
+
+// Logprobs are the log probabilities of a choice's tokens
+type Logprobs struct {
+	Content []TokenLogprob `json:"content"`
+}
+
+// TokenLogprob is a token's log probability and, when asked for, those of
+// the likeliest tokens in its place
+type TokenLogprob struct {
+	Token       string         `json:"token"`
+	Logprob     float64        `json:"logprob"`
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// Mean returns the average log probability of the tokens, a measure of
+// the model's confidence in the choice; false when there are none
+func (l *Logprobs) Mean() (float64, bool) {
+	if l == nil || len(l.Content) == 0 {
+		return 0, false
+	}
+	total := 0.0
+	for _, token := range l.Content {
+		total += token.Logprob
+	}
+	return total / float64(len(l.Content)), true
+}
+
+// EmbeddingRequest represents an embedding request; Input takes many
+// texts at once
 type EmbeddingRequest struct {
-	Model string `json:"model"`
-	Input string `json:"input"`
+	Model string   `json:"model"`
+	Input []string `json:"input"`
 }
 
 // EmbeddingResponse represents an embedding response
@@ -75,53 +413,171 @@ type EmbeddingResponse struct {
 	} `json:"usage"`
 }
 
-// NewClient creates a new Ollama client
-func NewClient() *Client {
-	baseURL := os.Getenv("OLLAMA_HOST")
-	if baseURL == "" {
-		baseURL = "http://localhost:11434"
-	}
+// Config sets the Ollama server and models a client uses
+type Config struct {
+	Host       string
+	Model      string
+	EmbedModel string
+	// VisionModel answers prompts with images; the chat model when empty
+	VisionModel string
+	// NativeTools offers tools through the API's function calling; when
+	// off, callers describe tools in the prompt instead
+	NativeTools bool
+	// APIKey is sent as a bearer token, for servers that require one
+	APIKey string
+	// OpenAICompatible is set for servers other than Ollama, which are sent
+	// chat through the v1 API instead of Ollama's /api/chat
+	OpenAICompatible bool
+	// Pinned keeps the configured models when SwitchModels switches the
+	// models of other clients
+	Pinned bool
+	// Timeout is the longest a request may take; none when 0, for callers
+	// that time requests out themselves
+	Timeout time.Duration
+	// Options are the defaults of chat requests that don't set their own
+	Options Options
+	// MaxConcurrency is how many requests the llm providers send the host
+	// at once, the rest waiting by priority; no limit when 0
+	MaxConcurrency int
+}
 
-	model := os.Getenv("OLLAMA_MODEL")
-	if model == "" {
-		model = "gemma3:27b"
+// ConfigFromEnv reads OLLAMA_HOST (default http://localhost:11434),
+// OLLAMA_MODEL (default gemma3:27b), OLLAMA_EMBEDDING_MODEL (default
+// nomic-embed-text:v1.5), OLLAMA_VISION_MODEL (default the chat model),
+// OLLAMA_NATIVE_TOOLS (default true), OLLAMA_NUM_CTX and OLLAMA_KEEP_ALIVE
+// (default the server's), and OLLAMA_MAX_CONCURRENCY (default 4, 0 for no
+// limit)
+func ConfigFromEnv() Config {
+	config := Config{
+		Host:           "http://localhost:11434",
+		Model:          "gemma3:27b",
+		EmbedModel:     "nomic-embed-text:v1.5",
+		NativeTools:    true,
+		Timeout:        300 * time.Second, // 5 minutes for large models
+		MaxConcurrency: 4,
 	}
-
-	embedModel := os.Getenv("OLLAMA_EMBEDDING_MODEL")
-	if embedModel == "" {
-		embedModel = "nomic-embed-text:v1.5"
+	if value := os.Getenv("OLLAMA_HOST"); value != "" {
+		config.Host = value
 	}
+	if value := os.Getenv("OLLAMA_MODEL"); value != "" {
+		config.Model = value
+	}
+	if value := os.Getenv("OLLAMA_EMBEDDING_MODEL"); value != "" {
+		config.EmbedModel = value
+	}
+	if value := os.Getenv("OLLAMA_VISION_MODEL"); value != "" {
+		config.VisionModel = value
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv("OLLAMA_NATIVE_TOOLS")); err == nil {
+		config.NativeTools = enabled
+	}
+	if numCtx, err := strconv.Atoi(os.Getenv("OLLAMA_NUM_CTX")); err == nil && numCtx > 0 {
+		config.Options.NumCtx = numCtx
+	}
+	config.Options.KeepAlive = os.Getenv("OLLAMA_KEEP_ALIVE")
+	if limit, err := strconv.Atoi(os.Getenv("OLLAMA_MAX_CONCURRENCY")); err == nil && limit >= 0 {
+		config.MaxConcurrency = limit
+	}
+	return config
+}
 
-	return &Client{
-		baseURL: baseURL,
+// NewClient creates a new Ollama client configured from the environment
+func NewClient() *Client {
+	return NewClientWithConfig(ConfigFromEnv())
+}
+
+// NewClientWithConfig creates an Ollama client for config
+func NewClientWithConfig(config Config) *Client {
+	client := &Client{
+		baseURL: strings.TrimSuffix(config.Host, "/"),
+		apiKey:  config.APIKey,
 		httpClient: &http.Client{
-			Timeout: 300 * time.Second, // 5 minutes for large models
+			Timeout: config.Timeout,
 		},
-		model:      model,
-		embedModel: embedModel,
+		model:       config.Model,
+		embedModel:  config.EmbedModel,
+		visionModel: config.VisionModel,
+		nativeTools: config.NativeTools,
+		pinned:      config.Pinned,
+		options:     config.Options,
+
+		openAICompatible: config.OpenAICompatible,
 	}
+	return client
 }
 
-// ChatCompletion sends a chat completion request using v1 API
+// ChatCompletion sends a chat completion request
 func (c *Client) ChatCompletion(messages []ChatMessage, temperature float64) (*ChatCompletionResponse, error) {
-	req := ChatCompletionRequest{
-		Model:       c.model,
+	return c.ChatCompletionWithTools(messages, nil, nil, temperature)
+}
+
+// ChatCompletionWithTools sends a chat completion request offering tools;
+// the calls the model makes are in the choice's Message.ToolCalls.
+// toolChoice may be nil to let the model decide.
+func (c *Client) ChatCompletionWithTools(messages []ChatMessage, tools []Tool, toolChoice interface{}, temperature float64) (*ChatCompletionResponse, error) {
+	return c.Complete(context.Background(), ChatCompletionRequest{
 		Messages:    messages,
+		Temperature: temperature,
+		Tools:       tools,
+		ToolChoice:  toolChoice,
+	})
+}
+
+// Complete sends a chat completion request as given, to the chat model
+// unless req names another
+func (c *Client) Complete(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if req.Model == "" {
+		req.Model = c.GetModel()
+	}
+	req.Stream = false
+
+	start := time.Now()
+	resp, err := c.chatCompletion(ctx, req)
+	observeRequest("chat", start, err)
+	return resp, err
+}
+
+// VisionCompletion asks the vision model about images; its answer is the
+// first choice's message
+func (c *Client) VisionCompletion(ctx context.Context, prompt string, images [][]byte, temperature float64) (*ChatCompletionResponse, error) {
+	message := ChatMessage{Role: "user", Content: prompt, Images: make([]string, 0, len(images))}
+	for _, image := range images {
+		message.Images = append(message.Images, EncodeImage(image))
+	}
+
+	start := time.Now()
+	resp, err := c.chatCompletion(ctx, ChatCompletionRequest{
+		Model:       c.GetVisionModel(),
+		Messages:    []ChatMessage{message},
 		Stream:      false,
 		Temperature: temperature,
+	})
+	observeRequest("vision", start, err)
+	if err != nil {
+		return nil, err
 	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("model returned no choices")
+	}
+	return resp, nil
+}
 
+func (c *Client) chatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	c.options.Apply(&req)
+	if !c.openAICompatible {
+		return c.nativeChat(ctx, req)
+	}
 	jsonData, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", c.baseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+	c.setHeaders(httpReq)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -130,78 +586,229 @@ func (c *Client) ChatCompletion(messages []ChatMessage, temperature float64) (*C
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, c.chatError(resp, req)
 	}
 
 	var chatResp ChatCompletionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	countTokens(chatResp.Usage)
 
 	return &chatResp, nil
 }
 
-// ChatCompletionStream sends a streaming chat completion request
+// ChatCompletionStream sends a streaming chat completion request; its
+// latency covers the whole stream
 func (c *Client) ChatCompletionStream(messages []ChatMessage, temperature float64, callback func(string) error) error {
-	req := ChatCompletionRequest{
-		Model:       c.model,
+	_, err := c.ChatCompletionStreamContext(context.Background(), messages, nil, nil, temperature, callback)
+	return err
+}
+
+// ChatCompletionStreamContext streams a chat completion offering tools,
+// which may be nil, passing text to callback as it arrives. It returns the
+// tool calls the model made, why it stopped and the tokens it used once
+// the stream ends. Cancelling ctx ends the stream early with ctx's error.
+func (c *Client) ChatCompletionStreamContext(ctx context.Context, messages []ChatMessage, tools []Tool, toolChoice interface{}, temperature float64, callback func(string) error) (*StreamResult, error) {
+	return c.CompleteStream(ctx, ChatCompletionRequest{
 		Messages:    messages,
-		Stream:      true,
 		Temperature: temperature,
+		Tools:       tools,
+		ToolChoice:  toolChoice,
+	}, callback)
+}
+
+// CompleteStream streams a chat completion request as given, to the chat
+// model unless req names another; see ChatCompletionStreamContext
+func (c *Client) CompleteStream(ctx context.Context, req ChatCompletionRequest, callback func(string) error) (*StreamResult, error) {
+	if req.Model == "" {
+		req.Model = c.GetModel()
 	}
+	req.Stream = true
+	req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	// A stream passes on one choice
+	req.N = 0
+
+	start := time.Now()
+	result, err := c.chatCompletionStream(ctx, req, callback)
+	observeRequest("chat_stream", start, err)
+	return result, err
+}
 
+func (c *Client) chatCompletionStream(ctx context.Context, req ChatCompletionRequest, callback func(string) error) (*StreamResult, error) {
+	c.options.Apply(&req)
+	if !c.openAICompatible {
+		return c.nativeChatStream(ctx, req, callback)
+	}
 	jsonData, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", c.baseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+	c.setHeaders(httpReq)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("stream cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, c.chatError(resp, req)
 	}
 
-	decoder := json.NewDecoder(resp.Body)
-	for {
-		var chunk ChatCompletionResponse
-		if err := decoder.Decode(&chunk); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return fmt.Errorf("failed to decode chunk: %w", err)
+	// The stream is server-sent events, each a chunk whose delta carries
+	// the next piece of text or of a tool call. The last choice carries
+	// the finish reason, then a chunk without choices carries the usage,
+	// and [DONE] ends it.
+	result := &StreamResult{}
+	calls := map[int]*ToolCall{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
 		}
 
-		if len(chunk.Choices) > 0 {
-			content := chunk.Choices[0].Message.Content
-			if content != "" {
-				if err := callback(content); err != nil {
-					return err
-				}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("ollama stream error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage.TotalTokens > 0 {
+			result.Usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			result.FinishReason = choice.FinishReason
+		}
+		for _, part := range choice.Delta.ToolCalls {
+			call, ok := calls[part.Index]
+			if !ok {
+				call = &ToolCall{Index: part.Index, Type: "function"}
+				calls[part.Index] = call
 			}
+			if part.ID != "" {
+				call.ID = part.ID
+			}
+			if part.Type != "" {
+				call.Type = part.Type
+			}
+			call.Function.Name += part.Function.Name
+			call.Function.Arguments += part.Function.Arguments
+		}
+		if choice.Delta.Content != "" {
+			if err := callback(choice.Delta.Content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("stream cancelled: %w", ctx.Err())
 		}
+		return nil, fmt.Errorf("failed to read stream: %w", err)
 	}
+	countTokens(result.Usage)
 
-	return nil
+	result.ToolCalls = sortToolCalls(calls)
+	return result, nil
+}
+
+// streamChunk is one event of a streamed completion, which may report an
+// error instead
+type streamChunk struct {
+	ChatCompletionResponse
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// sortToolCalls returns streamed tool calls in the order the model made
+// them, giving any without an ID one so results can answer it
+func sortToolCalls(calls map[int]*ToolCall) []ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	sorted := make([]ToolCall, 0, len(calls))
+	for _, call := range calls {
+		if call.ID == "" {
+			call.ID = fmt.Sprintf("call_%d", call.Index)
+		}
+		sorted = append(sorted, *call)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+	return sorted
+}
+
+// chatError reads a failed chat response, returning ErrToolsUnsupported
+// and remembering it for the model req went to when that model turned
+// down a request with tools
+func (c *Client) chatError(resp *http.Response, req ChatCompletionRequest) error {
+	body, _ := io.ReadAll(resp.Body)
+	if len(req.Tools) > 0 && resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "does not support tools") {
+		toolless.Store(req.Model, true)
+		return fmt.Errorf("%w: %s", ErrToolsUnsupported, req.Model)
+	}
+	return &APIError{API: "ollama", StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// SupportsTools reports whether the model may be offered tools: true unless
+// OLLAMA_NATIVE_TOOLS is off or the model has turned down a request with them
+func (c *Client) SupportsTools() bool {
+	_, refused := toolless.Load(c.GetModel())
+	return c.nativeTools && !refused
 }
 
 // CreateEmbedding creates an embedding for the given text
 func (c *Client) CreateEmbedding(text string) ([]float64, error) {
+	embeddings, err := c.Embed(context.Background(), []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// CreateEmbeddings creates embeddings for multiple texts
+func (c *Client) CreateEmbeddings(texts []string) ([][]float64, error) {
+	return c.Embed(context.Background(), texts)
+}
+
+// Embed creates an embedding for each text, in the texts' order, with one
+// request. Callers embedding many texts send them in batches.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return [][]float64{}, nil
+	}
+	start := time.Now()
+	embeddings, err := c.createEmbeddings(ctx, texts)
+	observeRequest("embedding", start, err)
+	return embeddings, err
+}
+
+func (c *Client) createEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
 	req := EmbeddingRequest{
-		Model: c.embedModel,
-		Input: text,
+		Model: c.GetEmbedModel(),
+		Input: texts,
 	}
 
 	jsonData, err := json.Marshal(req)
@@ -209,12 +816,12 @@ func (c *Client) CreateEmbedding(text string) ([]float64, error) {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", c.baseURL+"/v1/embeddings", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/embeddings", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+	c.setHeaders(httpReq)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -223,8 +830,7 @@ func (c *Client) CreateEmbedding(text string) ([]float64, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, apiError(resp)
 	}
 
 	var embedResp EmbeddingResponse
@@ -232,39 +838,65 @@ func (c *Client) CreateEmbedding(text string) ([]float64, error) {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if len(embedResp.Data) == 0 {
-		return nil, fmt.Errorf("no embeddings returned")
+	if len(embedResp.Data) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(embedResp.Data), len(texts))
 	}
 
-	return embedResp.Data[0].Embedding, nil
-}
-
-// CreateEmbeddings creates embeddings for multiple texts
-func (c *Client) CreateEmbeddings(texts []string) ([][]float64, error) {
+	// The data may come in any order; index says which text each is for
 	embeddings := make([][]float64, len(texts))
-	for i, text := range texts {
-		embedding, err := c.CreateEmbedding(text)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create embedding for text %d: %w", i, err)
+	for _, data := range embedResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("embedding index %d out of range or repeated", data.Index)
 		}
-		embeddings[i] = embedding
+		embeddings[data.Index] = data.Embedding
 	}
+
 	return embeddings, nil
 }
 
-// GetModel returns the configured model name
+// GetModel returns the chat model, the one switched to or the configured one
 func (c *Client) GetModel() string {
+	if model := activeModels().Chat; model != "" && !c.pinned {
+		return model
+	}
 	return c.model
 }
 
-// GetEmbedModel returns the configured embedding model name
+// GetVisionModel returns the model that answers prompts with images; the
+// chat model unless one was configured or switched to
+func (c *Client) GetVisionModel() string {
+	if model := activeModels().Vision; model != "" && !c.pinned {
+		return model
+	}
+	if c.visionModel != "" {
+		return c.visionModel
+	}
+	return c.GetModel()
+}
+
+// GetEmbedModel returns the embedding model, the one switched to or the
+// configured one
 func (c *Client) GetEmbedModel() string {
+	if model := activeModels().Embedding; model != "" && !c.pinned {
+		return model
+	}
 	return c.embedModel
 }
 
 // Health checks if Ollama is accessible
 func (c *Client) Health() error {
-	resp, err := c.httpClient.Get(c.baseURL + "/api/tags")
+	return c.Ping(context.Background())
+}
+
+// Ping lists the installed models, checking Ollama answers before ctx ends
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/tags", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("ollama not accessible: %w", err)
 	}
@@ -277,3 +909,31 @@ func (c *Client) Health() error {
 	return nil
 }
 
+// setHeaders marks a request's body as JSON and adds the API key, if set
+func (c *Client) setHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+}
+
+// countTokens records the tokens a completion used
+func countTokens(usage Usage) {
+	if usage.PromptTokens > 0 {
+		tokensTotal.Add(float64(usage.PromptTokens), "prompt")
+	}
+	if usage.CompletionTokens > 0 {
+		tokensTotal.Add(float64(usage.CompletionTokens), "completion")
+	}
+}
+
+// observeRequest records a request's latency
+func observeRequest(operation string, start time.Time, err error) {
+	status := "ok"
+	if errors.Is(err, context.Canceled) {
+		status = "cancelled"
+	} else if err != nil {
+		status = "error"
+	}
+	requestDuration.Observe(time.Since(start).Seconds(), operation, status)
+}
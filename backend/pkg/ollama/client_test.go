@@ -0,0 +1,140 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestToolRefusalIsKeyedOnTheRequestModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.Model != "refuser:1b" {
+			t.Errorf("request went to %q, want the override refuser:1b", req.Model)
+		}
+		http.Error(w, `{"error":"registry.ollama.ai/library/refuser:1b does not support tools"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	primary := NewClientWithConfig(Config{Host: server.URL, Model: "primary:27b", NativeTools: true, Pinned: true})
+	_, err := primary.Complete(context.Background(), ChatCompletionRequest{
+		Model:    "refuser:1b",
+		Messages: []ChatMessage{{Role: "user", Content: "hi"}},
+		Tools:    []Tool{NewTool("noop", "does nothing", nil)},
+	})
+	if !errors.Is(err, ErrToolsUnsupported) {
+		t.Fatalf("Complete() error = %v, want ErrToolsUnsupported", err)
+	}
+
+	if !primary.SupportsTools() {
+		t.Error("the primary model lost tools when another model refused them")
+	}
+	refuser := NewClientWithConfig(Config{Host: server.URL, Model: "refuser:1b", NativeTools: true, Pinned: true})
+	if refuser.SupportsTools() {
+		t.Error("the model that refused tools is still offered them")
+	}
+}
+
+func TestOllamaOptionsReachTheNativeChatAPI(t *testing.T) {
+	var path string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Write([]byte(`{"model":"gemma3:27b","message":{"role":"assistant","content":"hello"},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":3}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(Config{
+		Host:    server.URL,
+		Model:   "gemma3:27b",
+		Pinned:  true,
+		Options: Options{NumCtx: 16384, TopK: 20, KeepAlive: "30m"},
+	})
+	resp, err := client.Complete(context.Background(), ChatCompletionRequest{
+		Messages:    []ChatMessage{{Role: "user", Content: "hi"}},
+		Temperature: 0.5,
+		MaxTokens:   64,
+	})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	if path != "/api/chat" {
+		t.Errorf("request went to %s, want /api/chat", path)
+	}
+	options, _ := body["options"].(map[string]interface{})
+	for key, want := range map[string]float64{"num_ctx": 16384, "top_k": 20, "temperature": 0.5, "num_predict": 64} {
+		if options[key] != want {
+			t.Errorf("options[%q] = %v, want %v", key, options[key], want)
+		}
+	}
+	if body["keep_alive"] != "30m" {
+		t.Errorf("keep_alive = %v, want 30m", body["keep_alive"])
+	}
+
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "hello" || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("Complete() choices = %+v, want hello, stopped", resp.Choices)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 3 || resp.Usage.TotalTokens != 15 {
+		t.Errorf("Complete() usage = %+v, want 12 + 3", resp.Usage)
+	}
+}
+
+func TestNativeChatStreamReturnsTextAndToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":{"role":"assistant","content":"Hel"},"done":false}
+{"message":{"role":"assistant","content":"lo","tool_calls":[{"function":{"name":"search","arguments":{"query":"go"}}}]},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":2}
+`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(Config{Host: server.URL, Model: "gemma3:27b", Pinned: true})
+	var text string
+	result, err := client.CompleteStream(context.Background(), ChatCompletionRequest{
+		Messages: []ChatMessage{{Role: "user", Content: "hi"}},
+	}, func(piece string) error {
+		text += piece
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+	if text != "Hello" {
+		t.Errorf("streamed %q, want Hello", text)
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Function.Name != "search" || result.ToolCalls[0].Function.Arguments != `{"query":"go"}` {
+		t.Errorf("tool calls = %+v, want search {\"query\":\"go\"}", result.ToolCalls)
+	}
+	if result.FinishReason != "tool_calls" || result.Usage.TotalTokens != 7 {
+		t.Errorf("finish reason %q and usage %+v, want tool_calls and 7 tokens", result.FinishReason, result.Usage)
+	}
+}
+
+func TestOpenAICompatibleServersGetTheV1API(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(Config{Host: server.URL, Model: "gpt-4o", Pinned: true, OpenAICompatible: true})
+	if _, err := client.Complete(context.Background(), ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: "hi"}}}); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if path != "/v1/chat/completions" {
+		t.Errorf("request went to %s, want /v1/chat/completions", path)
+	}
+}
@@ -0,0 +1,359 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrModelNotFound is returned when a model isn't installed or can't be
+	// found in the registry
+	ErrModelNotFound = errors.New("model not found")
+	// ErrModelUnsuited is returned when a model can't do the job it was
+	// chosen for, such as chatting with an embedding model
+	ErrModelUnsuited = errors.New("model unsuited")
+)
+
+// Model is a model installed in Ollama
+type Model struct {
+	Name       string       `json:"name"`
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	ModifiedAt time.Time    `json:"modified_at"`
+	Details    ModelDetails `json:"details"`
+}
+
+// ModelDetails describes a model's format and size
+type ModelDetails struct {
+	Format            string   `json:"format,omitempty"`
+	Family            string   `json:"family,omitempty"`
+	Families          []string `json:"families,omitempty"`
+	ParameterSize     string   `json:"parameter_size,omitempty"`
+	QuantizationLevel string   `json:"quantization_level,omitempty"`
+}
+
+// ModelInfo is what Ollama knows about an installed model
+type ModelInfo struct {
+	Details    ModelDetails `json:"details"`
+	Parameters string       `json:"parameters,omitempty"`
+	Template   string       `json:"template,omitempty"`
+	// Capabilities lists what the model can do: completion, embedding,
+	// vision, tools, ...
+	Capabilities []string               `json:"capabilities,omitempty"`
+	ModelInfo    map[string]interface{} `json:"model_info,omitempty"`
+}
+
+// Can reports whether the model lists capability
+func (m ModelInfo) Can(capability string) bool {
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// EmbeddingLength returns the size of the model's embeddings, or 0 when
+// the model doesn't say
+func (m ModelInfo) EmbeddingLength() int {
+	for key, value := range m.ModelInfo {
+		if !strings.HasSuffix(key, ".embedding_length") {
+			continue
+		}
+		if length, ok := value.(float64); ok {
+			return int(length)
+		}
+	}
+	return 0
+}
+
+// NumCtx returns the context window the model's Modelfile sets, or 0 when
+// it leaves it to the server
+func (m ModelInfo) NumCtx() int {
+	for _, line := range strings.Split(m.Parameters, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "num_ctx" {
+			if numCtx, err := strconv.Atoi(fields[1]); err == nil {
+				return numCtx
+			}
+		}
+	}
+	return 0
+}
+
+// PullProgress is a step of a model download
+type PullProgress struct {
+	Status    string `json:"status"` // e.g. pulling manifest, pulling <digest>, success
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// ActiveModels names the models clients use in place of their configured
+// ones; empty fields keep the configured model
+type ActiveModels struct {
+	Chat      string `json:"chat,omitempty"`
+	Embedding string `json:"embedding,omitempty"`
+	Vision    string `json:"vision,omitempty"`
+}
+
+// active is shared by every client, so a switch reaches the agent, chat
+// and memory at once
+var active struct {
+	sync.RWMutex
+	models ActiveModels
+}
+
+// activeModels returns the models switched to with SwitchModels
+func activeModels() ActiveModels {
+	active.RLock()
+	defer active.RUnlock()
+	return active.models
+}
+
+// ListModels returns the models installed in Ollama
+func (c *Client) ListModels(ctx context.Context) ([]Model, error) {
+	start := time.Now()
+	models, err := c.listModels(ctx)
+	observeRequest("list_models", start, err)
+	return models, err
+}
+
+func (c *Client) listModels(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var tags struct {
+		Models []Model `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return tags.Models, nil
+}
+
+// ShowModel returns what Ollama knows about an installed model
+func (c *Client) ShowModel(ctx context.Context, name string) (*ModelInfo, error) {
+	start := time.Now()
+	info, err := c.showModel(ctx, name)
+	observeRequest("show_model", start, err)
+	return info, err
+}
+
+func (c *Client) showModel(ctx context.Context, name string) (*ModelInfo, error) {
+	resp, err := c.post(ctx, c.httpClient, "/api/show", map[string]interface{}{"model": name})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+
+	var info ModelInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &info, nil
+}
+
+// PullModel downloads a model from the registry, calling progress, when
+// set, with each step. Downloads may take longer than the client's timeout,
+// so only ctx bounds them.
+func (c *Client) PullModel(ctx context.Context, name string, progress func(PullProgress)) error {
+	start := time.Now()
+	err := c.pullModel(ctx, name, progress)
+	observeRequest("pull_model", start, err)
+	return err
+}
+
+func (c *Client) pullModel(ctx context.Context, name string, progress func(PullProgress)) error {
+	resp, err := c.post(ctx, &http.Client{}, "/api/pull", map[string]interface{}{"model": name, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusNotFound || strings.Contains(string(body), "file does not exist") {
+			return fmt.Errorf("%w: %s", ErrModelNotFound, name)
+		}
+		return &APIError{API: "ollama", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// Progress arrives as one JSON object per line
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var step struct {
+			PullProgress
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &step); err != nil {
+			return fmt.Errorf("failed to decode progress: %w", err)
+		}
+		if step.Error != "" {
+			if strings.Contains(step.Error, "file does not exist") {
+				return fmt.Errorf("%w: %s", ErrModelNotFound, name)
+			}
+			return fmt.Errorf("ollama pull error: %s", step.Error)
+		}
+		if progress != nil {
+			progress(step.PullProgress)
+		}
+		if step.Status == "success" {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("pull cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("failed to read progress: %w", err)
+	}
+	return fmt.Errorf("pull of %s ended before it succeeded", name)
+}
+
+// WarmModel loads a model into memory so the first request that needs it
+// doesn't wait for the load
+func (c *Client) WarmModel(ctx context.Context, name string) error {
+	start := time.Now()
+	err := c.warmModel(ctx, name)
+	observeRequest("warm_model", start, err)
+	return err
+}
+
+func (c *Client) warmModel(ctx context.Context, name string) error {
+	info, err := c.showModel(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// A request with nothing to answer only loads the model; embedding
+	// models don't generate, so they embed a word instead
+	path, body := "/api/generate", map[string]interface{}{"model": name}
+	if info.Can("embedding") && !info.Can("completion") {
+		path, body = "/api/embed", map[string]interface{}{"model": name, "input": "warm"}
+	}
+	if c.options.KeepAlive != "" {
+		body["keep_alive"] = c.options.KeepAlive
+	}
+
+	resp, err := c.post(ctx, c.httpClient, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// SwitchModels makes every client use models in place of the configured
+// ones. Each model named must be installed and able to do its job; an
+// embedding model must also make embeddings of embeddingDimension values,
+// the size the vector store holds, unless embeddingDimension is 0. Nothing
+// changes unless every model passes.
+func (c *Client) SwitchModels(ctx context.Context, models ActiveModels, embeddingDimension int) error {
+	checks := []struct {
+		name       string
+		role       string
+		capability string
+	}{
+		{models.Chat, "chat", "completion"},
+		{models.Vision, "vision", "vision"},
+		{models.Embedding, "embedding", "embedding"},
+	}
+	for _, check := range checks {
+		if check.name == "" {
+			continue
+		}
+		info, err := c.ShowModel(ctx, check.name)
+		if err != nil {
+			return err
+		}
+		// Older Ollama versions don't report capabilities
+		if len(info.Capabilities) > 0 && !info.Can(check.capability) {
+			return fmt.Errorf("%w: %s can't be the %s model, it lacks %s", ErrModelUnsuited, check.name, check.role, check.capability)
+		}
+		if check.role == "embedding" && embeddingDimension > 0 {
+			if length := info.EmbeddingLength(); length != 0 && length != embeddingDimension {
+				return fmt.Errorf("%w: %s makes embeddings of %d values, the vector store holds %d",
+					ErrModelUnsuited, check.name, length, embeddingDimension)
+			}
+		}
+	}
+
+	active.Lock()
+	defer active.Unlock()
+	if models.Chat != "" {
+		active.models.Chat = models.Chat
+	}
+	if models.Vision != "" {
+		active.models.Vision = models.Vision
+	}
+	if models.Embedding != "" {
+		active.models.Embedding = models.Embedding
+	}
+	return nil
+}
+
+// Models returns the models the client uses, switched or configured
+func (c *Client) Models() ActiveModels {
+	return ActiveModels{Chat: c.GetModel(), Embedding: c.GetEmbedModel(), Vision: c.GetVisionModel()}
+}
+
+// post sends body as JSON to path with httpClient
+func (c *Client) post(ctx context.Context, httpClient *http.Client, path string, body interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,273 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ollama's v1 API ignores its own options and keep_alive, so chat requests
+// to an Ollama server go to the native /api/chat instead, whose request and
+// reply are converted from and to the v1 API's shapes.
+
+// nativeChatRequest is an /api/chat request
+type nativeChatRequest struct {
+	Model       string                 `json:"model"`
+	Messages    []nativeMessage        `json:"messages"`
+	Stream      bool                   `json:"stream"`
+	Tools       []Tool                 `json:"tools,omitempty"`
+	Format      interface{}            `json:"format,omitempty"` // "json" or a JSON Schema
+	Options     map[string]interface{} `json:"options,omitempty"`
+	KeepAlive   string                 `json:"keep_alive,omitempty"`
+	Logprobs    bool                   `json:"logprobs,omitempty"`
+	TopLogprobs int                    `json:"top_logprobs,omitempty"`
+}
+
+// nativeMessage is a message of /api/chat, whose images are plain base64
+// and whose tool calls take their arguments as an object
+type nativeMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []nativeToolCall `json:"tool_calls,omitempty"`
+}
+
+type nativeToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// nativeChatResponse is an /api/chat reply, or one line of a streamed one
+type nativeChatResponse struct {
+	Model           string         `json:"model"`
+	CreatedAt       time.Time      `json:"created_at"`
+	Message         nativeMessage  `json:"message"`
+	Done            bool           `json:"done"`
+	DoneReason      string         `json:"done_reason"`
+	PromptEvalCount int            `json:"prompt_eval_count"`
+	EvalCount       int            `json:"eval_count"`
+	Logprobs        []TokenLogprob `json:"logprobs,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// nativeRequest converts a v1 request to /api/chat's. Sampling settings
+// and the reply's length limit are model options there, and tool_choice
+// and n have no counterpart.
+func nativeRequest(req ChatCompletionRequest) nativeChatRequest {
+	options := make(map[string]interface{}, len(req.Options)+5)
+	for key, value := range req.Options {
+		options[key] = value
+	}
+	if req.Temperature != 0 {
+		options["temperature"] = req.Temperature
+	}
+	if req.TopP != 0 {
+		options["top_p"] = req.TopP
+	}
+	if req.Seed != nil {
+		options["seed"] = *req.Seed
+	}
+	if req.Stop != nil {
+		options["stop"] = req.Stop
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+
+	native := nativeChatRequest{
+		Model:       req.Model,
+		Messages:    make([]nativeMessage, 0, len(req.Messages)),
+		Stream:      req.Stream,
+		Tools:       req.Tools,
+		KeepAlive:   req.KeepAlive,
+		Logprobs:    req.Logprobs,
+		TopLogprobs: req.TopLogprobs,
+	}
+	if len(options) > 0 {
+		native.Options = options
+	}
+	if format := req.ResponseFormat; format != nil {
+		if format.Type == "json_schema" && format.JSONSchema != nil {
+			native.Format = format.JSONSchema.Schema
+		} else {
+			native.Format = "json"
+		}
+	}
+	for _, msg := range req.Messages {
+		message := nativeMessage{Role: msg.Role, Content: msg.Content}
+		for _, image := range msg.Images {
+			// A data: URL's data is what's sent
+			if _, data, ok := strings.Cut(image, ";base64,"); ok && strings.HasPrefix(image, "data:") {
+				image = data
+			}
+			message.Images = append(message.Images, image)
+		}
+		for _, call := range msg.ToolCalls {
+			var native nativeToolCall
+			native.Function.Name = call.Function.Name
+			native.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if !json.Valid(native.Function.Arguments) {
+				native.Function.Arguments = json.RawMessage("{}")
+			}
+			message.ToolCalls = append(message.ToolCalls, native)
+		}
+		native.Messages = append(native.Messages, message)
+	}
+	return native
+}
+
+// toolCalls converts a reply's tool calls, numbering them from first
+func (m nativeMessage) toolCalls(first int) []ToolCall {
+	if len(m.ToolCalls) == 0 {
+		return nil
+	}
+	calls := make([]ToolCall, 0, len(m.ToolCalls))
+	for i, native := range m.ToolCalls {
+		arguments := string(native.Function.Arguments)
+		if arguments == "" || arguments == "null" {
+			arguments = "{}"
+		}
+		call := ToolCall{Index: first + i, ID: fmt.Sprintf("call_%d", first+i), Type: "function"}
+		call.Function.Name = native.Function.Name
+		call.Function.Arguments = arguments
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// finishReason is the v1 finish reason of a finished reply
+func (r nativeChatResponse) finishReason(toolCalls bool) string {
+	if toolCalls {
+		return "tool_calls"
+	}
+	if r.DoneReason == "" {
+		return "stop"
+	}
+	return r.DoneReason
+}
+
+func (r nativeChatResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// postChat sends req to /api/chat, returning the response when it's a success
+func (c *Client) postChat(ctx context.Context, req ChatCompletionRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(nativeRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/chat", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(httpReq)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if req.Stream && ctx.Err() != nil {
+			return nil, fmt.Errorf("stream cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.chatError(resp, req)
+	}
+	return resp, nil
+}
+
+// nativeChat answers a request through /api/chat
+func (c *Client) nativeChat(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	resp, err := c.postChat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var native nativeChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&native); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if native.Error != "" {
+		return nil, fmt.Errorf("ollama error: %s", native.Error)
+	}
+
+	calls := native.Message.toolCalls(0)
+	choice := Choice{
+		Message:      ChatMessage{Role: native.Message.Role, Content: native.Message.Content, ToolCalls: calls},
+		FinishReason: native.finishReason(len(calls) > 0),
+	}
+	if len(native.Logprobs) > 0 {
+		choice.Logprobs = &Logprobs{Content: native.Logprobs}
+	}
+	chatResp := &ChatCompletionResponse{
+		Object:  "chat.completion",
+		Created: native.CreatedAt.Unix(),
+		Model:   native.Model,
+		Choices: []Choice{choice},
+		Usage:   native.usage(),
+	}
+	countTokens(chatResp.Usage)
+	return chatResp, nil
+}
+
+// nativeChatStream streams a request through /api/chat, whose stream is a
+// reply per line: pieces of text, tool calls whole, and a last line that
+// is done and carries the usage
+func (c *Client) nativeChatStream(ctx context.Context, req ChatCompletionRequest, callback func(string) error) (*StreamResult, error) {
+	resp, err := c.postChat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &StreamResult{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk nativeChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("ollama stream error: %s", chunk.Error)
+		}
+		result.ToolCalls = append(result.ToolCalls, chunk.Message.toolCalls(len(result.ToolCalls))...)
+		if chunk.Message.Content != "" {
+			if err := callback(chunk.Message.Content); err != nil {
+				return nil, err
+			}
+		}
+		if chunk.Done {
+			result.FinishReason = chunk.finishReason(len(result.ToolCalls) > 0)
+			result.Usage = chunk.usage()
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("stream cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	countTokens(result.Usage)
+	return result, nil
+}
@@ -0,0 +1,173 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pullNotifyInterval is the least time between progress notifications
+// for a pull, besides those for a new step or the end
+const pullNotifyInterval = time.Second
+
+// ErrPullRunning is returned when a model is already being pulled
+var ErrPullRunning = errors.New("model pull already running")
+
+// PullStatus is the progress of a model download started with Pulls
+type PullStatus struct {
+	Model      string     `json:"model"`
+	Status     string     `json:"status"` // running, completed, failed or cancelled
+	Step       string     `json:"step,omitempty"`
+	Total      int64      `json:"total,omitempty"`
+	Completed  int64      `json:"completed,omitempty"`
+	Percent    float64    `json:"percent"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Pulls downloads models in the background and remembers how each
+// download went
+type Pulls struct {
+	client *Client
+
+	mu      sync.Mutex
+	pulls   map[string]*PullStatus
+	cancels map[string]context.CancelFunc
+	notify  func(PullStatus)
+	wg      sync.WaitGroup
+}
+
+// NewPulls creates a pull tracker downloading with client
+func NewPulls(client *Client) *Pulls {
+	return &Pulls{
+		client:  client,
+		pulls:   make(map[string]*PullStatus),
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// SetNotify sets a function called as pulls progress, such as to tell
+// connected clients
+func (p *Pulls) SetNotify(notify func(PullStatus)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notify = notify
+}
+
+// Start begins pulling a model in the background
+func (p *Pulls) Start(name string) (PullStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if status, ok := p.pulls[name]; ok && status.Status == "running" {
+		return *status, ErrPullRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	status := &PullStatus{Model: name, Status: "running", StartedAt: time.Now()}
+	p.pulls[name] = status
+	p.cancels[name] = cancel
+
+	p.wg.Add(1)
+	go p.run(ctx, cancel, name)
+
+	return *status, nil
+}
+
+// List returns every pull since startup, newest first
+func (p *Pulls) List() []PullStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]PullStatus, 0, len(p.pulls))
+	for _, status := range p.pulls {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].StartedAt.After(statuses[j].StartedAt) })
+	return statuses
+}
+
+// Close cancels running pulls and waits for them to stop
+func (p *Pulls) Close() {
+	p.mu.Lock()
+	for _, cancel := range p.cancels {
+		cancel()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *Pulls) run(ctx context.Context, cancel context.CancelFunc, name string) {
+	defer p.wg.Done()
+	defer cancel()
+
+	var notified time.Time
+	err := p.client.PullModel(ctx, name, func(progress PullProgress) {
+		status, changed := p.update(name, func(s *PullStatus) {
+			s.Step = progress.Status
+			s.Total = progress.Total
+			s.Completed = progress.Completed
+			if progress.Total > 0 {
+				s.Percent = float64(progress.Completed) * 100 / float64(progress.Total)
+			}
+		})
+		if changed || time.Since(notified) >= pullNotifyInterval {
+			notified = time.Now()
+			p.send(status)
+		}
+	})
+
+	// Finish and forget the cancel together, so a pull started next can't
+	// be cancelled by this one
+	status, _ := p.update(name, func(s *PullStatus) {
+		delete(p.cancels, name)
+		now := time.Now()
+		s.FinishedAt = &now
+		switch {
+		case errors.Is(err, context.Canceled):
+			s.Status = "cancelled"
+		case err != nil:
+			s.Status = "failed"
+			s.Error = err.Error()
+		default:
+			s.Status = "completed"
+			s.Percent = 100
+		}
+	})
+	p.send(status)
+
+	switch status.Status {
+	case "failed":
+		slog.Warn("failed to pull model", "model", name, "error", err)
+	case "completed":
+		slog.Info("pulled model", "model", name)
+	}
+}
+
+// update applies fn to a pull's status under the lock, reporting whether
+// the pull moved to a new step
+func (p *Pulls) update(name string, fn func(s *PullStatus)) (PullStatus, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := p.pulls[name]
+	step := status.Step
+	fn(status)
+	return *status, status.Step != step
+}
+
+// send passes a status to the notify function, if one is set
+func (p *Pulls) send(status PullStatus) {
+	p.mu.Lock()
+	notify := p.notify
+	p.mu.Unlock()
+
+	if notify != nil {
+		notify(status)
+	}
+}
@@ -0,0 +1,195 @@
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Content types for non-JSON bodies
+const (
+	JSON        = "application/json"
+	Binary      = "application/octet-stream"
+	EventStream = "text/event-stream"
+	Text        = "text/plain"
+)
+
+// Operation documents one route
+type Operation struct {
+	Method       string
+	Path         string // in fiber's syntax, e.g. /api/tasks/:id
+	Tag          string
+	Summary      string
+	Description  string
+	Query        interface{} // a struct whose query-tagged fields are the parameters
+	Body         interface{} // the request body's type; nil for none
+	BodyType     string      // the request content type, JSON by default
+	OptionalBody bool        // the body may be left out
+	Responses    []Response
+	Errors       []int // statuses the route fails with, each answered with the error body
+}
+
+// Response documents one successful outcome of an operation
+type Response struct {
+	Status      int
+	Description string
+	Body        interface{} // the body's type; nil for none
+	ContentType string      // JSON by default
+}
+
+// Spec describes an API to render as an OpenAPI 3 document
+type Spec struct {
+	Title       string
+	Version     string
+	Description string
+	Operations  []Operation
+	ErrorBody   interface{} // the body every error response shares
+	// Scope returns the scope a route needs, or "" for a public route;
+	// scoped routes can also fail with 401 and 403
+	Scope func(method, path string) string
+}
+
+// pathParam matches fiber's :name path parameters
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// Document renders the spec. Schemas are derived from the Go types given
+// for bodies and parameters.
+func (s Spec) Document() map[string]interface{} {
+	schemas := newSchemas()
+	errorSchema := schemas.of(s.ErrorBody)
+
+	paths := make(map[string]interface{})
+	for _, op := range s.Operations {
+		path := pathParam.ReplaceAllString(op.Path, "{$1}")
+		operation := map[string]interface{}{
+			"operationId": operationID(op.Method, path),
+			"summary":     op.Summary,
+			"responses":   map[string]interface{}{},
+		}
+		if op.Tag != "" {
+			operation["tags"] = []string{op.Tag}
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+
+		var params []map[string]interface{}
+		for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		params = append(params, schemas.parameters(op.Query)...)
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if op.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": !op.OptionalBody,
+				"content":  content(schemas, op.Body, op.BodyType),
+			}
+		}
+
+		responses := operation["responses"].(map[string]interface{})
+		for _, r := range op.Responses {
+			response := map[string]interface{}{"description": r.Description}
+			if r.Description == "" {
+				response["description"] = http.StatusText(r.Status)
+			}
+			if r.Body != nil || r.ContentType != "" {
+				response["content"] = content(schemas, r.Body, r.ContentType)
+			}
+			responses[strconv.Itoa(r.Status)] = response
+		}
+
+		errors := append([]int(nil), op.Errors...)
+		scope := ""
+		if s.Scope != nil {
+			scope = s.Scope(op.Method, op.Path)
+		}
+		if scope != "" {
+			operation["x-required-scope"] = scope
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}}
+			errors = append(errors, 401, 403)
+		} else {
+			operation["security"] = []map[string][]string{}
+		}
+		for _, status := range errors {
+			if _, ok := responses[strconv.Itoa(status)]; ok {
+				continue
+			}
+			responses[strconv.Itoa(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     map[string]interface{}{JSON: map[string]interface{}{"schema": errorSchema}},
+			}
+		}
+
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       s.Title,
+			"version":     s.Version,
+			"description": s.Description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "An API key or session token"},
+				"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+// Paths lists the documented routes as "METHOD path", in fiber's syntax
+func (s Spec) Paths() []string {
+	paths := make([]string, 0, len(s.Operations))
+	for _, op := range s.Operations {
+		paths = append(paths, op.Method+" "+op.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// content describes a body of the given type; non-JSON bodies are strings
+func content(schemas *schemas, body interface{}, contentType string) map[string]interface{} {
+	if contentType == "" {
+		contentType = JSON
+	}
+	schema := map[string]interface{}{"type": "string"}
+	switch {
+	case contentType == JSON:
+		schema = schemas.of(body)
+	case contentType != Text && contentType != EventStream:
+		schema["format"] = "binary"
+	}
+	return map[string]interface{}{contentType: map[string]interface{}{"schema": schema}}
+}
+
+// operationID names an operation after its method and path, e.g.
+// getApiTasksId for GET /api/tasks/{id}
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
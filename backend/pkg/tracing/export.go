@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent-workspace/backend/pkg/metrics"
+)
+
+// exportedSpans counts spans by what became of them
+var exportedSpans = metrics.NewCounterVec("tracing_spans_total",
+	"Finished spans by outcome: exported, dropped from a full queue or failed to export", "status")
+
+// exportTimeout bounds one export request
+const exportTimeout = 10 * time.Second
+
+// exporter batches finished spans and posts them as OTLP/HTTP JSON
+type exporter struct {
+	config Config
+	client *http.Client
+	queue  chan *Span
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newExporter(config Config) *exporter {
+	e := &exporter{
+		config: config,
+		client: &http.Client{Timeout: exportTimeout},
+		queue:  make(chan *Span, config.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// enqueue queues a span, dropping it when the queue is full rather than
+// slowing the traced work down
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		exportedSpans.Inc("dropped")
+	}
+}
+
+// run exports a batch when it fills or the flush interval passes, and the
+// rest of the queue on shutdown
+func (e *exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.config.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= e.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) >= e.config.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown stops the exporter once the queued spans are sent
+func (e *exporter) shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush spans: %w", ctx.Err())
+	}
+}
+
+// export posts a batch; a batch that fails is dropped
+func (e *exporter) export(batch []*Span) {
+	if err := e.post(batch); err != nil {
+		exportedSpans.Add(float64(len(batch)), "failed")
+		slog.Warn("failed to export spans", "spans", len(batch), "error", err)
+		return
+	}
+	exportedSpans.Add(float64(len(batch)), "exported")
+}
+
+func (e *exporter) post(batch []*Span) error {
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", e.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// request renders a batch as an OTLP ExportTraceServiceRequest
+func (e *exporter) request(batch []*Span) map[string]interface{} {
+	spans := make([]map[string]interface{}, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, span.otlp())
+	}
+	return map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes([]attribute{{"service.name", e.config.ServiceName}}),
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": "agent-workspace/backend"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// otlp renders an ended span in OTLP JSON, where IDs are hex and 64-bit
+// integers are strings
+func (s *Span) otlp() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := map[string]interface{}{
+		"traceId":           hex.EncodeToString(s.traceID[:]),
+		"spanId":            hex.EncodeToString(s.spanID[:]),
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attrs),
+	}
+	if s.parentID != [8]byte{} {
+		span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+	}
+	if len(s.events) > 0 {
+		events := make([]map[string]interface{}, 0, len(s.events))
+		for _, ev := range s.events {
+			events = append(events, map[string]interface{}{
+				"name":         ev.name,
+				"timeUnixNano": strconv.FormatInt(ev.time.UnixNano(), 10),
+				"attributes":   otlpAttributes(ev.attrs),
+			})
+		}
+		span["events"] = events
+	}
+	if s.failed {
+		span["status"] = map[string]interface{}{"code": 2, "message": s.statusMessage}
+	}
+	return span
+}
+
+// otlpAttributes renders attributes as OTLP key-values
+func otlpAttributes(attrs []attribute) []map[string]interface{} {
+	rendered := make([]map[string]interface{}, 0, len(attrs))
+	for _, attr := range attrs {
+		rendered = append(rendered, map[string]interface{}{"key": attr.key, "value": otlpValue(attr.value)})
+	}
+	return rendered
+}
+
+// otlpValue renders a value as an OTLP AnyValue; other types become strings
+func otlpValue(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case error:
+		return map[string]interface{}{"stringValue": v.Error()}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
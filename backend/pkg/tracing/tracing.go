@@ -0,0 +1,308 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span kinds, as OTLP numbers them
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Config sets where spans are exported
+type Config struct {
+	Endpoint      string            // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces; empty disables tracing
+	Headers       map[string]string // sent with every export, e.g. an API key
+	ServiceName   string
+	SampleRatio   float64 // share of traces kept, 0 to 1
+	BatchSize     int     // spans per export
+	QueueSize     int     // finished spans waiting for export; more are dropped
+	FlushInterval time.Duration
+}
+
+// DefaultConfig keeps every trace and exports every 5 seconds or 512 spans,
+// to no endpoint
+func DefaultConfig() Config {
+	return Config{
+		ServiceName:   "agent-workspace",
+		SampleRatio:   1,
+		BatchSize:     512,
+		QueueSize:     2048,
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+// ConfigFromEnv reads the standard OpenTelemetry variables:
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT with
+// /v1/traces appended; OTEL_EXPORTER_OTLP_HEADERS as "key=value,...";
+// OTEL_SERVICE_NAME; OTEL_TRACES_SAMPLER_ARG as the sample ratio; and
+// OTEL_SDK_DISABLED. Spans are sent as OTLP/HTTP JSON, so
+// OTEL_EXPORTER_OTLP_PROTOCOL may only be http/json.
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return config, nil
+	}
+
+	if protocol := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		return config, fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_PROTOCOL %q, only http/json is supported", protocol)
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	config.Endpoint = endpoint
+
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); value != "" {
+		config.Headers = make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return config, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS entry %q, expected key=value", pair)
+			}
+			config.Headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		config.ServiceName = name
+	}
+
+	if value := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return config, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q, expected a ratio from 0 to 1", value)
+		}
+		config.SampleRatio = ratio
+	}
+	return config, nil
+}
+
+// Tracer starts spans and exports the sampled ones once they end. A nil
+// Tracer, or one without an endpoint, starts no spans.
+type Tracer struct {
+	config   Config
+	exporter *exporter
+}
+
+// NewTracer creates a tracer exporting to config.Endpoint; call Shutdown
+// to flush the spans still queued
+func NewTracer(config Config) *Tracer {
+	defaults := DefaultConfig()
+	if config.ServiceName == "" {
+		config.ServiceName = defaults.ServiceName
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaults.FlushInterval
+	}
+
+	t := &Tracer{config: config}
+	if config.Endpoint != "" {
+		t.exporter = newExporter(config)
+	}
+	return t
+}
+
+// Enabled reports whether the tracer exports spans
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.exporter != nil
+}
+
+// Shutdown exports the queued spans, waiting until ctx is done at most
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if !t.Enabled() {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+// Start starts a span as a child of the span in ctx, if any, with attributes
+// given as key-value pairs like slog's. It returns ctx carrying the span,
+// and nil when tracing is off; Span methods accept a nil span.
+func (t *Tracer) Start(ctx context.Context, name string, args ...interface{}) (context.Context, *Span) {
+	if !t.Enabled() {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, kind: KindInternal, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+		span.sampled = parent.sampled
+	} else {
+		rand.Read(span.traceID[:])
+		span.sampled = sampled(span.traceID, t.config.SampleRatio)
+	}
+	rand.Read(span.spanID[:])
+	span.SetAttributes(args...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// sampled keeps a trace when its ID falls within ratio, so every span of a
+// trace makes the same choice
+func sampled(traceID [16]byte, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11)/(1<<53) < ratio
+}
+
+// defaultTracer is the tracer Start uses
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault makes t the tracer Start uses
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span with the default tracer; see Tracer.Start
+func Start(ctx context.Context, name string, args ...interface{}) (context.Context, *Span) {
+	return defaultTracer.Load().Start(ctx, name, args...)
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span ctx carries, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Span is one timed operation in a trace
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	name     string
+	kind     int
+	start    time.Time
+
+	mu            sync.Mutex
+	end           time.Time
+	attrs         []attribute
+	events        []event
+	failed        bool
+	statusMessage string
+	ended         bool
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type event struct {
+	name  string
+	time  time.Time
+	attrs []attribute
+}
+
+// TraceID returns the span's trace ID in hex, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SetKind marks the span as a client or server call; spans are internal
+// by default
+func (s *Span) SetKind(kind int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kind = kind
+}
+
+// SetAttributes adds attributes given as key-value pairs
+func (s *Span) SetAttributes(args ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, pairs(args)...)
+}
+
+// AddEvent records something that happened during the span
+func (s *Span) AddEvent(name string, args ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event{name: name, time: time.Now(), attrs: pairs(args)})
+}
+
+// RecordError marks the span failed and records err as an exception event;
+// a nil err is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.statusMessage = err.Error()
+	s.events = append(s.events, event{
+		name:  "exception",
+		time:  time.Now(),
+		attrs: []attribute{{"exception.message", err.Error()}, {"exception.type", fmt.Sprintf("%T", err)}},
+	})
+}
+
+// End ends the span and queues it for export; later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sampled {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+// pairs turns key-value arguments into attributes, dropping a trailing key
+// without a value and keys that aren't strings
+func pairs(args []interface{}) []attribute {
+	attrs := make([]attribute, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		if key, ok := args[i].(string); ok {
+			attrs = append(attrs, attribute{key, args[i+1]})
+		}
+	}
+	return attrs
+}
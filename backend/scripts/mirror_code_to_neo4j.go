@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"go/ast"
 	"go/parser"
@@ -454,11 +455,13 @@ func main() {
 		log.Fatal("NEO4J_PASSWORD environment variable is required")
 	}
 
-	projectName := "agent-workspace"
-	rootPath := "./backend"
+	// Each workspace mirrors into its own project
+	rootPath := flag.String("root", "./backend", "directory to mirror")
+	projectName := flag.String("project", "agent-workspace", "project to mirror into, e.g. the workspace name")
+	flag.Parse()
 
 	// Create mirror
-	mirror, err := NewCodeMirror(neo4jURI, neo4jUser, neo4jPass, projectName)
+	mirror, err := NewCodeMirror(neo4jURI, neo4jUser, neo4jPass, *projectName)
 	if err != nil {
 		log.Fatalf("Failed to create code mirror: %v", err)
 	}
@@ -466,10 +469,10 @@ func main() {
 
 	// Mirror directory
 	ctx := context.Background()
-	log.Printf("Starting code mirror for project: %s", projectName)
-	log.Printf("Root path: %s", rootPath)
+	log.Printf("Starting code mirror for project: %s", *projectName)
+	log.Printf("Root path: %s", *rootPath)
 
-	if err := mirror.MirrorDirectory(ctx, rootPath); err != nil {
+	if err := mirror.MirrorDirectory(ctx, *rootPath); err != nil {
 		log.Fatalf("Failed to mirror directory: %v", err)
 	}
 
@@ -5,6 +5,7 @@ import Chat from './components/Chat/Chat';
 import OpenEvolve from './components/OpenEvolve/OpenEvolve';
 import BottomPanel from './components/BottomPanel/BottomPanel';
 import ConnectionStatus from './components/Layout/ConnectionStatus';
+import { clearSession, session, wsUrl } from './auth';
 
 function App() {
   const [wsConnected, setWsConnected] = useState(false);
@@ -12,19 +13,48 @@ function App() {
   const [agentState, setAgentState] = useState('idle');
 
   useEffect(() => {
-    // Initialize WebSocket connections
-    const wsChat = new WebSocket('ws://localhost:8080/ws/chat');
-    const wsA2A = new WebSocket('ws://localhost:8080/ws/a2a');
+    let wsChat = null;
+    let wsA2A = null;
+    let chatStream = null;
+    let chatOpened = false;
+    let cancelled = false;
 
-    wsChat.onopen = () => setWsConnected(true);
-    wsChat.onclose = () => setWsConnected(false);
+    // Initialize WebSocket connections once there's a session
+    session().then((token) => {
+      if (cancelled) {
+        return;
+      }
+      wsChat = new WebSocket(wsUrl('/ws/chat', token));
+      wsA2A = new WebSocket(wsUrl('/ws/a2a', token));
 
-    wsA2A.onopen = () => setA2aConnected(true);
-    wsA2A.onclose = () => setA2aConnected(false);
+      wsChat.onopen = () => {
+        chatOpened = true;
+        setWsConnected(true);
+      };
+      wsChat.onclose = () => {
+        setWsConnected(false);
+        // Fall back to Server-Sent Events where WebSockets are blocked, and
+        // issue a new session on the next load in case this one was refused
+        if (!chatOpened && !chatStream) {
+          clearSession();
+          chatStream = new EventSource(wsUrl('/api/chat/stream', token));
+          chatStream.onopen = () => setWsConnected(true);
+          chatStream.onerror = () => setWsConnected(false);
+        }
+      };
+
+      wsA2A.onopen = () => setA2aConnected(true);
+      wsA2A.onclose = () => setA2aConnected(false);
+    });
 
     return () => {
-      wsChat.close();
-      wsA2A.close();
+      cancelled = true;
+      if (wsChat) {
+        wsChat.onclose = null;
+        wsChat.close();
+      }
+      wsA2A?.close();
+      chatStream?.close();
     };
   }, []);
 
@@ -0,0 +1,63 @@
+// sessionKey is where the session token is kept for the tab's lifetime
+const sessionKey = 'agent-workspace.session';
+
+// session returns a session token for the WebSockets and event streams,
+// exchanging an API key for one through POST /api/auth/sessions. Nothing is
+// built into the bundle: the server asks for no key when authentication is
+// off, and otherwise the user is asked for one. Only the session token is
+// kept, in sessionStorage until it expires; the key is never stored.
+export async function session() {
+  const stored = JSON.parse(sessionStorage.getItem(sessionKey) || 'null');
+  if (stored && (!stored.expires_at || Date.parse(stored.expires_at) > Date.now() + 60_000)) {
+    return stored.token;
+  }
+  sessionStorage.removeItem(sessionKey);
+
+  let response = await requestSession();
+  while (response.status === 401) {
+    const key = window.prompt('API key for the agent workspace (exchanged for a session, not stored)');
+    if (!key) {
+      return null;
+    }
+    response = await requestSession(key);
+  }
+  if (!response.ok) {
+    return null;
+  }
+  const issued = await response.json();
+  sessionStorage.setItem(sessionKey, JSON.stringify(issued));
+  return issued.token;
+}
+
+// clearSession forgets the session token, such as after the server
+// rejected it
+export function clearSession() {
+  sessionStorage.removeItem(sessionKey);
+}
+
+function requestSession(key) {
+  const headers = { 'Content-Type': 'application/json' };
+  if (key) {
+    headers['X-API-Key'] = key;
+  }
+  return fetch('/api/auth/sessions', {
+    method: 'POST',
+    headers,
+    body: JSON.stringify({ scope: 'browse' }),
+  });
+}
+
+// wsUrl resolves a backend path against the page's origin, which is the
+// backend itself when it serves the UI or the dev server's proxy, and adds
+// the session token the backend expects on WebSocket handshakes and event
+// streams
+export function wsUrl(path, token) {
+  const url = new URL(path, window.location.href);
+  if (path.startsWith('/ws/')) {
+    url.protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+  }
+  if (token) {
+    url.searchParams.set('token', token);
+  }
+  return url.toString();
+}
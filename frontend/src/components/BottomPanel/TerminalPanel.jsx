@@ -4,6 +4,7 @@ import { FitAddon } from '@xterm/addon-fit';
 import { WebLinksAddon } from '@xterm/addon-web-links';
 import { SearchAddon } from '@xterm/addon-search';
 import '@xterm/xterm/css/xterm.css';
+import { wsUrl } from '../../auth';
 
 export default function TerminalPanel({ takeoverMode }) {
   const terminalRef = useRef(null);
@@ -92,7 +93,7 @@ export default function TerminalPanel({ takeoverMode }) {
     window.addEventListener('resize', handleResize);
 
     // Connect to A2A WebSocket
-    const websocket = new WebSocket('ws://localhost:8080/ws/a2a');
+    const websocket = new WebSocket(wsUrl('/ws/a2a'));
     
     websocket.onopen = () => {
       term.writeln('\x1b[32m✅ Connected to A2A WebSocket\x1b[0m');
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"mcp-dynamic-thinking/internal/act"
 	"mcp-dynamic-thinking/internal/memory"
@@ -163,6 +164,8 @@ func (s *Server) handleToolsList(req MCPRequest) MCPResponse {
 					"task_id":       map[string]string{"type": "string"},
 					"perception_id": map[string]string{"type": "string"},
 					"num_branches":  map[string]string{"type": "number"},
+					"min_distance":  map[string]string{"type": "number"},
+					"max_retries":   map[string]string{"type": "number"},
 				},
 				"required": []string{"task_id", "perception_id"},
 			},
@@ -191,6 +194,17 @@ func (s *Server) handleToolsList(req MCPRequest) MCPResponse {
 				"required": []string{"task_id", "execution_id"},
 			},
 		},
+		{
+			"name":        "replay_execution",
+			"description": "Re-run a recorded execution and report divergences",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"execution_id": map[string]string{"type": "string"},
+				},
+				"required": []string{"execution_id"},
+			},
+		},
 		{
 			"name":        "get_short_term_memory",
 			"description": "Retrieve task context from short-term memory",
@@ -225,6 +239,17 @@ func (s *Server) handleToolsList(req MCPRequest) MCPResponse {
 				"required": []string{"query"},
 			},
 		},
+		{
+			"name":        "get_task_costs",
+			"description": "Report LLM tokens, latency and tool calls per PRAR phase",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"task_id": map[string]string{"type": "string"},
+				},
+				"required": []string{"task_id"},
+			},
+		},
 		{
 			"name":        "get_execution_trace",
 			"description": "Export training data for completed task",
@@ -255,6 +280,8 @@ func (s *Server) handleToolsCall(ctx context.Context, req MCPRequest) MCPRespons
 	var result map[string]interface{}
 	var err error
 
+	start := time.Now()
+
 	switch toolName {
 	case "perceive":
 		result, err = s.perceiver.Perceive(ctx, args)
@@ -264,6 +291,8 @@ func (s *Server) handleToolsCall(ctx context.Context, req MCPRequest) MCPRespons
 		result, err = s.actor.Act(ctx, args)
 	case "reflect":
 		result, err = s.reflector.Reflect(ctx, args)
+	case "replay_execution":
+		result, err = s.actor.Replay(ctx, args)
 	case "get_short_term_memory":
 		result, err = s.memory.GetShortTermMemory(ctx, args)
 	case "clear_short_term_memory":
@@ -272,6 +301,8 @@ func (s *Server) handleToolsCall(ctx context.Context, req MCPRequest) MCPRespons
 		result, err = s.memory.QueryStrategies(ctx, args)
 	case "get_execution_trace":
 		result, err = s.memory.GetExecutionTrace(ctx, args)
+	case "get_task_costs":
+		result, err = s.memory.GetTaskCosts(ctx, args)
 	default:
 		return MCPResponse{
 			JSONRPC: "2.0",
@@ -283,6 +314,8 @@ func (s *Server) handleToolsCall(ctx context.Context, req MCPRequest) MCPRespons
 		}
 	}
 
+	s.recordCost(toolName, args, result, err, time.Since(start))
+
 	if err != nil {
 		return MCPResponse{
 			JSONRPC: "2.0",
@@ -301,6 +334,44 @@ func (s *Server) handleToolsCall(ctx context.Context, req MCPRequest) MCPRespons
 	}
 }
 
+// prarPhases are the tools whose cost is tracked per task
+var prarPhases = map[string]bool{
+	"perceive":         true,
+	"reason":           true,
+	"act":              true,
+	"reflect":          true,
+	"replay_execution": true,
+}
+
+// recordCost stores tokens, tool calls and wall-clock time for a PRAR invocation
+func (s *Server) recordCost(toolName string, args, result map[string]interface{}, err error, elapsed time.Duration) {
+	if !prarPhases[toolName] {
+		return
+	}
+
+	taskID, _ := args["task_id"].(string)
+	if taskID == "" {
+		taskID, _ = result["task_id"].(string)
+	}
+	if taskID == "" {
+		return
+	}
+
+	entry := memory.CostEntry{
+		Phase:      toolName,
+		DurationMs: elapsed.Milliseconds(),
+		Success:    err == nil,
+		Timestamp:  time.Now(),
+	}
+
+	if usage, ok := result["usage"].(map[string]interface{}); ok {
+		entry.LLMTokens, _ = usage["llm_tokens"].(int)
+		entry.ToolCalls, _ = usage["tool_calls"].(int)
+	}
+
+	s.memory.RecordCost(taskID, entry)
+}
+
 func sendResponse(resp MCPResponse) error {
 	data, err := json.Marshal(resp)
 	if err != nil {
@@ -2,13 +2,26 @@ package act
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
+// ErrReplayUnsupported is returned by Replay when steps are only simulated
+var ErrReplayUnsupported = errors.New("replay is unsupported without a step executor")
+
+// StepExecutor runs a step of an action plan, through the browser, terminal
+// or MCP tools it describes
+type StepExecutor interface {
+	ExecuteStep(ctx context.Context, description string) (interface{}, error)
+}
+
 // Actor handles the Act phase of PRAR
 type Actor struct {
+	mu         sync.RWMutex
 	executions map[string]*Execution
+	executor   StepExecutor // nil simulates steps
 }
 
 // Execution represents an action execution
@@ -21,6 +34,7 @@ type Execution struct {
 	StartTime   time.Time
 	EndTime     time.Time
 	Result      map[string]interface{}
+	ReplayOf    string
 }
 
 // ExecutionStep represents a single step execution
@@ -41,6 +55,13 @@ func NewActor() *Actor {
 	}
 }
 
+// SetExecutor runs steps through executor instead of simulating them
+func (a *Actor) SetExecutor(executor StepExecutor) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.executor = executor
+}
+
 // Act executes an action plan with monitoring
 func (a *Actor) Act(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
 	taskID, ok := args["task_id"].(string)
@@ -69,7 +90,7 @@ func (a *Actor) Act(ctx context.Context, args map[string]interface{}) (map[strin
 	if err := a.executePlan(ctx, execution); err != nil {
 		execution.Status = "failed"
 		execution.EndTime = time.Now()
-		a.executions[executionID] = execution
+		a.storeExecution(execution)
 		
 		return nil, fmt.Errorf("execution failed: %w", err)
 	}
@@ -78,7 +99,7 @@ func (a *Actor) Act(ctx context.Context, args map[string]interface{}) (map[strin
 	execution.EndTime = time.Now()
 
 	// Store execution
-	a.executions[executionID] = execution
+	a.storeExecution(execution)
 
 	return map[string]interface{}{
 		"execution_id": executionID,
@@ -87,6 +108,10 @@ func (a *Actor) Act(ctx context.Context, args map[string]interface{}) (map[strin
 		"steps":        a.stepsToMap(execution.Steps),
 		"duration_ms":  execution.EndTime.Sub(execution.StartTime).Milliseconds(),
 		"result":       execution.Result,
+		"usage": map[string]interface{}{
+			"llm_tokens": 0,
+			"tool_calls": len(execution.Steps),
+		},
 	}, nil
 }
 
@@ -135,10 +160,16 @@ func (a *Actor) executePlan(ctx context.Context, execution *Execution) error {
 	return nil
 }
 
-// executeStep executes a single step
+// executeStep executes a single step, simulating it without an executor
 func (a *Actor) executeStep(ctx context.Context, description string) (interface{}, error) {
+	a.mu.RLock()
+	executor := a.executor
+	a.mu.RUnlock()
+	if executor != nil {
+		return executor.ExecuteStep(ctx, description)
+	}
+
 	// Simulate step execution
-	// In a real implementation, this would call browser, terminal, or MCP tools
 	
 	time.Sleep(100 * time.Millisecond) // Simulate work
 
@@ -169,7 +200,9 @@ func (a *Actor) stepsToMap(steps []ExecutionStep) []map[string]interface{} {
 
 // GetExecution retrieves an execution by ID
 func (a *Actor) GetExecution(executionID string) (*Execution, error) {
+	a.mu.RLock()
 	execution, exists := a.executions[executionID]
+	a.mu.RUnlock()
 	if !exists {
 		return nil, fmt.Errorf("execution %s not found", executionID)
 	}
@@ -177,6 +210,13 @@ func (a *Actor) GetExecution(executionID string) (*Execution, error) {
 	return execution, nil
 }
 
+// storeExecution keeps a finished execution for lookup and replay
+func (a *Actor) storeExecution(execution *Execution) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.executions[execution.ID] = execution
+}
+
 // MonitorExecution monitors an ongoing execution
 func (a *Actor) MonitorExecution(executionID string) (map[string]interface{}, error) {
 	execution, err := a.GetExecution(executionID)
@@ -0,0 +1,193 @@
+package act
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// volatileResultKeys are result fields expected to differ between runs
+var volatileResultKeys = map[string]bool{
+	"timestamp": true,
+}
+
+// Divergence describes a step whose replayed outcome differs from the original
+type Divergence struct {
+	StepID   string
+	Field    string
+	Original interface{}
+	Replayed interface{}
+}
+
+// Replay re-runs a recorded execution step-by-step and reports divergences.
+// Simulated steps always succeed the same way, so replaying them would
+// report every execution as deterministic; without a StepExecutor, Replay
+// returns ErrReplayUnsupported.
+func (a *Actor) Replay(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	executionID, ok := args["execution_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("execution_id is required")
+	}
+
+	a.mu.RLock()
+	simulated := a.executor == nil
+	a.mu.RUnlock()
+	if simulated {
+		return nil, ErrReplayUnsupported
+	}
+
+	original, err := a.GetExecution(executionID)
+	if err != nil {
+		return nil, err
+	}
+
+	replayID := fmt.Sprintf("execution_%d", time.Now().UnixNano())
+
+	replay := &Execution{
+		ID:         replayID,
+		TaskID:     original.TaskID,
+		ActionPlan: original.ActionPlan,
+		Steps:      make([]ExecutionStep, 0, len(original.Steps)),
+		Status:     "running",
+		StartTime:  time.Now(),
+		ReplayOf:   original.ID,
+	}
+
+	divergences := make([]Divergence, 0)
+
+	// Replay exactly the recorded steps, in order
+	for _, recorded := range original.Steps {
+		step := ExecutionStep{
+			ID:          recorded.ID,
+			Description: recorded.Description,
+			Status:      "running",
+			StartTime:   time.Now(),
+		}
+
+		result, err := a.executeStep(ctx, step.Description)
+		step.EndTime = time.Now()
+
+		if err != nil {
+			step.Status = "failed"
+			step.Error = err.Error()
+		} else {
+			step.Status = "completed"
+			step.Result = result
+		}
+
+		replay.Steps = append(replay.Steps, step)
+		divergences = append(divergences, compareSteps(recorded, step)...)
+
+		// Stop where the original stopped or where the replay fails
+		if step.Status == "failed" {
+			break
+		}
+	}
+
+	if len(replay.Steps) < len(original.Steps) {
+		divergences = append(divergences, Divergence{
+			StepID:   original.Steps[len(replay.Steps)].ID,
+			Field:    "executed",
+			Original: true,
+			Replayed: false,
+		})
+	}
+
+	replay.Status = "completed"
+	if len(replay.Steps) > 0 && replay.Steps[len(replay.Steps)-1].Status == "failed" {
+		replay.Status = "failed"
+	}
+	replay.EndTime = time.Now()
+	replay.Result = map[string]interface{}{
+		"success":         replay.Status == "completed",
+		"steps_completed": len(replay.Steps),
+	}
+
+	a.storeExecution(replay)
+
+	return map[string]interface{}{
+		"execution_id":         replayID,
+		"replay_of":            original.ID,
+		"task_id":              original.TaskID,
+		"status":               replay.Status,
+		"original_status":      original.Status,
+		"steps":                a.stepsToMap(replay.Steps),
+		"divergences":          divergencesToMap(divergences),
+		"divergence_count":     len(divergences),
+		"deterministic":        len(divergences) == 0 && replay.Status == original.Status,
+		"duration_ms":          replay.EndTime.Sub(replay.StartTime).Milliseconds(),
+		"original_duration_ms": original.EndTime.Sub(original.StartTime).Milliseconds(),
+		"usage": map[string]interface{}{
+			"llm_tokens": 0,
+			"tool_calls": len(replay.Steps),
+		},
+	}, nil
+}
+
+// compareSteps compares the stable fields of a recorded and replayed step
+func compareSteps(original, replayed ExecutionStep) []Divergence {
+	divergences := make([]Divergence, 0)
+
+	if original.Status != replayed.Status {
+		divergences = append(divergences, Divergence{
+			StepID:   original.ID,
+			Field:    "status",
+			Original: original.Status,
+			Replayed: replayed.Status,
+		})
+	}
+
+	if original.Error != replayed.Error {
+		divergences = append(divergences, Divergence{
+			StepID:   original.ID,
+			Field:    "error",
+			Original: original.Error,
+			Replayed: replayed.Error,
+		})
+	}
+
+	if !reflect.DeepEqual(stableResult(original.Result), stableResult(replayed.Result)) {
+		divergences = append(divergences, Divergence{
+			StepID:   original.ID,
+			Field:    "result",
+			Original: original.Result,
+			Replayed: replayed.Result,
+		})
+	}
+
+	return divergences
+}
+
+// stableResult strips volatile fields from a step result
+func stableResult(result interface{}) interface{} {
+	resultMap, ok := result.(map[string]interface{})
+	if !ok {
+		return result
+	}
+
+	stable := make(map[string]interface{}, len(resultMap))
+	for k, v := range resultMap {
+		if !volatileResultKeys[k] {
+			stable[k] = v
+		}
+	}
+
+	return stable
+}
+
+// divergencesToMap converts divergences to map format
+func divergencesToMap(divergences []Divergence) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(divergences))
+
+	for i, d := range divergences {
+		result[i] = map[string]interface{}{
+			"step_id":  d.StepID,
+			"field":    d.Field,
+			"original": d.Original,
+			"replayed": d.Replayed,
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveRecord is a task memory snapshot handed to an ArchiveSink
+type ArchiveRecord struct {
+	Key         string                 `json:"key"`
+	TaskID      string                 `json:"task_id"`
+	Perceptions []interface{}          `json:"perceptions"`
+	Reasoning   []interface{}          `json:"reasoning"`
+	Actions     []interface{}          `json:"actions"`
+	Reflections []interface{}          `json:"reflections"`
+	Context     map[string]interface{} `json:"context"`
+	CreatedAt   time.Time              `json:"created_at"`
+	ArchivedAt  time.Time              `json:"archived_at"`
+}
+
+// ArchiveSink persists archived task memory
+type ArchiveSink interface {
+	Archive(ctx context.Context, record *ArchiveRecord) error
+}
+
+// InMemorySink keeps archives in process memory (lost on restart)
+type InMemorySink struct {
+	records map[string]*ArchiveRecord
+	mu      sync.RWMutex
+}
+
+// NewInMemorySink creates a new in-memory archive sink
+func NewInMemorySink() *InMemorySink {
+	return &InMemorySink{
+		records: make(map[string]*ArchiveRecord),
+	}
+}
+
+// Archive stores the record under its key
+func (s *InMemorySink) Archive(ctx context.Context, record *ArchiveRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.Key] = record
+	return nil
+}
+
+// Get retrieves an archived record by key
+func (s *InMemorySink) Get(key string) (*ArchiveRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, exists := s.records[key]
+	return record, exists
+}
+
+// HTTPSink posts archives to the backend memory API (/api/memory/store)
+type HTTPSink struct {
+	url        string
+	apiKey     string // sent as a bearer token; the backend needs the execute scope
+	httpClient *http.Client
+}
+
+// NewHTTPSink creates a sink that posts to the given memory store URL,
+// authenticating with apiKey when it's set
+func NewHTTPSink(url, apiKey string) *HTTPSink {
+	return &HTTPSink{
+		url:    url,
+		apiKey: apiKey,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Archive posts the record to the backend memory store
+func (s *HTTPSink) Archive(ctx context.Context, record *ArchiveRecord) error {
+	body := map[string]interface{}{
+		"type":    "task_archive",
+		"content": formatArchiveContent(record),
+		"task_id": record.TaskID,
+		"metadata": map[string]interface{}{
+			"archive_key": record.Key,
+			"created_at":  record.CreatedAt.Format(time.RFC3339),
+			"archived_at": record.ArchivedAt.Format(time.RFC3339),
+		},
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send archive: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("memory store error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// NewArchiveSinkFromEnv selects a sink based on MEMORY_ARCHIVE_URL, which
+// authenticates with MEMORY_ARCHIVE_API_KEY
+func NewArchiveSinkFromEnv() ArchiveSink {
+	if url := os.Getenv("MEMORY_ARCHIVE_URL"); url != "" {
+		return NewHTTPSink(url, os.Getenv("MEMORY_ARCHIVE_API_KEY"))
+	}
+
+	return NewInMemorySink()
+}
+
+// formatArchiveContent renders a record as text suitable for knowledge extraction
+func formatArchiveContent(record *ArchiveRecord) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Task: %s\n", record.TaskID)
+	fmt.Fprintf(&b, "Started: %s\n", record.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Archived: %s\n", record.ArchivedAt.Format(time.RFC3339))
+
+	writeSection(&b, "Reasoning", record.Reasoning)
+	writeSection(&b, "Actions", record.Actions)
+	writeSection(&b, "Reflections", record.Reflections)
+
+	return b.String()
+}
+
+func writeSection(b *strings.Builder, title string, items []interface{}) {
+	if len(items) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "\n%s:\n", title)
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			fmt.Fprintf(b, "%d. %v\n", i+1, item)
+			continue
+		}
+		fmt.Fprintf(b, "%d. %s\n", i+1, string(data))
+	}
+}
@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CostEntry records the cost of a single PRAR phase invocation
+type CostEntry struct {
+	Phase      string
+	LLMTokens  int
+	ToolCalls  int
+	DurationMs int64
+	Success    bool
+	Timestamp  time.Time
+}
+
+// RecordCost appends a cost entry to a task's memory, creating it if needed
+func (m *MemoryManager) RecordCost(taskID string, entry CostEntry) {
+	memory, exists := m.shortTerm[taskID]
+	if !exists {
+		memory = newTaskMemory(taskID)
+		m.shortTerm[taskID] = memory
+	}
+
+	memory.Costs = append(memory.Costs, entry)
+}
+
+// GetTaskCosts returns per-invocation costs and per-phase totals for a task
+func (m *MemoryManager) GetTaskCosts(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	taskID, ok := args["task_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("task_id is required")
+	}
+
+	memory, exists := m.shortTerm[taskID]
+	if !exists {
+		return nil, fmt.Errorf("task memory %s not found", taskID)
+	}
+
+	byPhase := make(map[string]map[string]interface{})
+	totalTokens, totalToolCalls := 0, 0
+	var totalDuration int64
+
+	for _, entry := range memory.Costs {
+		phase, exists := byPhase[entry.Phase]
+		if !exists {
+			phase = map[string]interface{}{
+				"invocations": 0,
+				"llm_tokens":  0,
+				"tool_calls":  0,
+				"duration_ms": int64(0),
+			}
+			byPhase[entry.Phase] = phase
+		}
+
+		phase["invocations"] = phase["invocations"].(int) + 1
+		phase["llm_tokens"] = phase["llm_tokens"].(int) + entry.LLMTokens
+		phase["tool_calls"] = phase["tool_calls"].(int) + entry.ToolCalls
+		phase["duration_ms"] = phase["duration_ms"].(int64) + entry.DurationMs
+
+		totalTokens += entry.LLMTokens
+		totalToolCalls += entry.ToolCalls
+		totalDuration += entry.DurationMs
+	}
+
+	return map[string]interface{}{
+		"task_id":     taskID,
+		"invocations": costsToMap(memory.Costs),
+		"by_phase":    byPhase,
+		"totals": map[string]interface{}{
+			"invocations": len(memory.Costs),
+			"llm_tokens":  totalTokens,
+			"tool_calls":  totalToolCalls,
+			"duration_ms": totalDuration,
+		},
+	}, nil
+}
+
+// costsToMap converts cost entries to map format
+func costsToMap(costs []CostEntry) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(costs))
+
+	for i, entry := range costs {
+		result[i] = map[string]interface{}{
+			"phase":       entry.Phase,
+			"llm_tokens":  entry.LLMTokens,
+			"tool_calls":  entry.ToolCalls,
+			"duration_ms": entry.DurationMs,
+			"success":     entry.Success,
+			"timestamp":   entry.Timestamp.Format(time.RFC3339),
+		}
+	}
+
+	return result
+}
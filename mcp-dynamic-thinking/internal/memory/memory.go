@@ -9,7 +9,7 @@ import (
 // MemoryManager manages short-term and long-term memory
 type MemoryManager struct {
 	shortTerm map[string]*TaskMemory
-	longTerm  map[string]interface{}
+	archive   ArchiveSink
 }
 
 // TaskMemory represents short-term memory for a task
@@ -19,15 +19,35 @@ type TaskMemory struct {
 	Reasoning   []interface{}
 	Actions     []interface{}
 	Reflections []interface{}
+	Costs       []CostEntry
 	Context     map[string]interface{}
 	CreatedAt   time.Time
 }
 
 // NewMemoryManager creates a new memory manager
 func NewMemoryManager() *MemoryManager {
+	return NewMemoryManagerWithSink(NewArchiveSinkFromEnv())
+}
+
+// NewMemoryManagerWithSink creates a memory manager that archives to sink
+func NewMemoryManagerWithSink(sink ArchiveSink) *MemoryManager {
 	return &MemoryManager{
 		shortTerm: make(map[string]*TaskMemory),
-		longTerm:  make(map[string]interface{}),
+		archive:   sink,
+	}
+}
+
+// newTaskMemory creates an empty task memory
+func newTaskMemory(taskID string) *TaskMemory {
+	return &TaskMemory{
+		TaskID:      taskID,
+		Perceptions: make([]interface{}, 0),
+		Reasoning:   make([]interface{}, 0),
+		Actions:     make([]interface{}, 0),
+		Reflections: make([]interface{}, 0),
+		Costs:       make([]CostEntry, 0),
+		Context:     make(map[string]interface{}),
+		CreatedAt:   time.Now(),
 	}
 }
 
@@ -41,15 +61,7 @@ func (m *MemoryManager) GetShortTermMemory(ctx context.Context, args map[string]
 	memory, exists := m.shortTerm[taskID]
 	if !exists {
 		// Create new memory if it doesn't exist
-		memory = &TaskMemory{
-			TaskID:      taskID,
-			Perceptions: make([]interface{}, 0),
-			Reasoning:   make([]interface{}, 0),
-			Actions:     make([]interface{}, 0),
-			Reflections: make([]interface{}, 0),
-			Context:     make(map[string]interface{}),
-			CreatedAt:   time.Now(),
-		}
+		memory = newTaskMemory(taskID)
 		m.shortTerm[taskID] = memory
 	}
 
@@ -59,6 +71,7 @@ func (m *MemoryManager) GetShortTermMemory(ctx context.Context, args map[string]
 		"reasoning":    memory.Reasoning,
 		"actions":      memory.Actions,
 		"reflections":  memory.Reflections,
+		"costs":        costsToMap(memory.Costs),
 		"context":      memory.Context,
 		"created_at":   memory.CreatedAt.Format(time.RFC3339),
 		"age_seconds":  time.Since(memory.CreatedAt).Seconds(),
@@ -82,9 +95,11 @@ func (m *MemoryManager) ClearShortTermMemory(ctx context.Context, args map[strin
 		return nil, fmt.Errorf("task memory %s not found", taskID)
 	}
 
-	// Archive to long-term if requested
+	// Archive to long-term if requested; keep short-term memory on failure
 	if archiveToLongTerm {
-		m.archiveToLongTerm(memory)
+		if err := m.archiveToLongTerm(ctx, memory); err != nil {
+			return nil, fmt.Errorf("failed to archive task memory %s: %w", taskID, err)
+		}
 	}
 
 	// Clear short-term memory
@@ -155,6 +170,7 @@ func (m *MemoryManager) GetExecutionTrace(ctx context.Context, args map[string]i
 		"reasoning":   memory.Reasoning,
 		"actions":     memory.Actions,
 		"reflections": memory.Reflections,
+		"costs":       costsToMap(memory.Costs),
 		"context":     memory.Context,
 		"trace_type":  "prar_loop",
 		"version":     "1.0",
@@ -164,34 +180,27 @@ func (m *MemoryManager) GetExecutionTrace(ctx context.Context, args map[string]i
 }
 
 // archiveToLongTerm archives task memory to long-term storage
-func (m *MemoryManager) archiveToLongTerm(memory *TaskMemory) {
-	archiveKey := fmt.Sprintf("archive_%s_%d", memory.TaskID, time.Now().Unix())
-	
-	m.longTerm[archiveKey] = map[string]interface{}{
-		"task_id":     memory.TaskID,
-		"perceptions": memory.Perceptions,
-		"reasoning":   memory.Reasoning,
-		"actions":     memory.Actions,
-		"reflections": memory.Reflections,
-		"context":     memory.Context,
-		"created_at":  memory.CreatedAt.Format(time.RFC3339),
-		"archived_at": time.Now().Format(time.RFC3339),
-	}
+func (m *MemoryManager) archiveToLongTerm(ctx context.Context, memory *TaskMemory) error {
+	record := &ArchiveRecord{
+		Key:         fmt.Sprintf("archive_%s_%d", memory.TaskID, time.Now().Unix()),
+		TaskID:      memory.TaskID,
+		Perceptions: memory.Perceptions,
+		Reasoning:   memory.Reasoning,
+		Actions:     memory.Actions,
+		Reflections: memory.Reflections,
+		Context:     memory.Context,
+		CreatedAt:   memory.CreatedAt,
+		ArchivedAt:  time.Now(),
+	}
+
+	return m.archive.Archive(ctx, record)
 }
 
 // AddPerception adds a perception to task memory
 func (m *MemoryManager) AddPerception(taskID string, perception interface{}) error {
 	memory, exists := m.shortTerm[taskID]
 	if !exists {
-		memory = &TaskMemory{
-			TaskID:      taskID,
-			Perceptions: make([]interface{}, 0),
-			Reasoning:   make([]interface{}, 0),
-			Actions:     make([]interface{}, 0),
-			Reflections: make([]interface{}, 0),
-			Context:     make(map[string]interface{}),
-			CreatedAt:   time.Now(),
-		}
+		memory = newTaskMemory(taskID)
 		m.shortTerm[taskID] = memory
 	}
 
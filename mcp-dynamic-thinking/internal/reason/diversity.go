@@ -0,0 +1,170 @@
+package reason
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMinDistance is the minimum cosine distance between accepted branches
+	defaultMinDistance = 0.15
+	// defaultMaxRetries bounds how many near-duplicate candidates may be rejected
+	defaultMaxRetries = 5
+	// lexicalDimensions is the size of the fallback hashed bag-of-words vector
+	lexicalDimensions = 256
+)
+
+// Embedder turns branch text into a vector, reporting the LLM tokens consumed
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, int, error)
+}
+
+// OllamaEmbedder embeds text through the Ollama /api/embed endpoint,
+// falling back to a lexical embedding when Ollama is unavailable
+type OllamaEmbedder struct {
+	baseURL    string
+	model      string
+	httpClient *http.Client
+	fallback   Embedder
+}
+
+// NewOllamaEmbedder creates an embedder configured from the environment
+func NewOllamaEmbedder() *OllamaEmbedder {
+	baseURL := os.Getenv("OLLAMA_HOST")
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+
+	model := os.Getenv("OLLAMA_EMBEDDING_MODEL")
+	if model == "" {
+		model = "nomic-embed-text:v1.5"
+	}
+
+	return &OllamaEmbedder{
+		baseURL: baseURL,
+		model:   model,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		fallback: LexicalEmbedder{},
+	}
+}
+
+// Embed returns the Ollama embedding for text, or a lexical one on failure
+func (e *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float64, int, error) {
+	embedding, tokens, err := e.embedRemote(ctx, text)
+	if err != nil {
+		return e.fallback.Embed(ctx, text)
+	}
+
+	return embedding, tokens, nil
+}
+
+func (e *OllamaEmbedder) embedRemote(ctx context.Context, text string) ([]float64, int, error) {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"input": text,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/api/embed", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, 0, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var embedResp struct {
+		Embeddings      [][]float64 `json:"embeddings"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(embedResp.Embeddings) == 0 {
+		return nil, 0, fmt.Errorf("no embeddings returned")
+	}
+
+	return embedResp.Embeddings[0], embedResp.PromptEvalCount, nil
+}
+
+// LexicalEmbedder builds a hashed bag-of-words vector without any model
+type LexicalEmbedder struct{}
+
+// Embed returns a term-frequency vector over hashed lowercase tokens
+func (LexicalEmbedder) Embed(ctx context.Context, text string) ([]float64, int, error) {
+	vector := make([]float64, lexicalDimensions)
+
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	for _, token := range tokens {
+		h := fnv.New32a()
+		h.Write([]byte(token))
+		vector[h.Sum32()%lexicalDimensions]++
+	}
+
+	return vector, 0, nil
+}
+
+// DiversityConfig controls near-duplicate rejection during branch generation
+type DiversityConfig struct {
+	MinDistance float64
+	MaxRetries  int
+}
+
+// DiversityReport summarizes how diverse the accepted branches are
+type DiversityReport struct {
+	Rejected           int
+	MinPairwise        float64
+	ThresholdSatisfied bool
+	Tokens             int
+}
+
+// branchText is the text embedded to compare branches
+func branchText(branch *ReasoningBranch) string {
+	return branch.Reasoning + "\n" + strings.Join(branch.Steps, "\n")
+}
+
+// cosineDistance returns 1 - cosine similarity of a and b
+func cosineDistance(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 1
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 1
+	}
+
+	return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+}
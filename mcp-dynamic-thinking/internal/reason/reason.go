@@ -9,6 +9,7 @@ import (
 // Reasoner handles the Reason phase of PRAR
 type Reasoner struct {
 	branches map[string][]*ReasoningBranch
+	embedder Embedder
 }
 
 // ReasoningBranch represents a reasoning path
@@ -28,6 +29,7 @@ type ReasoningBranch struct {
 func NewReasoner() *Reasoner {
 	return &Reasoner{
 		branches: make(map[string][]*ReasoningBranch),
+		embedder: NewOllamaEmbedder(),
 	}
 }
 
@@ -48,8 +50,25 @@ func (r *Reasoner) Reason(ctx context.Context, args map[string]interface{}) (map
 		numBranches = int(n)
 	}
 
-	// Generate reasoning branches
-	branches := r.generateBranches(taskID, perceptionID, numBranches)
+	diversity := DiversityConfig{
+		MinDistance: defaultMinDistance,
+		MaxRetries:  defaultMaxRetries,
+	}
+	if d, ok := args["min_distance"].(float64); ok {
+		diversity.MinDistance = d
+	}
+	if n, ok := args["max_retries"].(float64); ok {
+		diversity.MaxRetries = int(n)
+	}
+
+	// Generate reasoning branches, rejecting near-duplicates
+	branches, report, err := r.generateBranches(ctx, taskID, perceptionID, numBranches, diversity)
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("no reasoning branches generated")
+	}
 
 	// Evaluate branches
 	bestBranch := r.evaluateBranches(branches)
@@ -68,22 +87,39 @@ func (r *Reasoner) Reason(ctx context.Context, args map[string]interface{}) (map
 			"confidence": bestBranch.Confidence,
 		},
 		"action_plan": r.createActionPlan(bestBranch),
+		"diversity": map[string]interface{}{
+			"min_distance":        diversity.MinDistance,
+			"min_pairwise":        report.MinPairwise,
+			"rejected":            report.Rejected,
+			"threshold_satisfied": report.ThresholdSatisfied,
+		},
+		"usage": map[string]interface{}{
+			"llm_tokens": report.Tokens,
+			"tool_calls": 0,
+		},
 	}, nil
 }
 
-// generateBranches generates multiple reasoning branches
-func (r *Reasoner) generateBranches(taskID, perceptionID string, count int) []*ReasoningBranch {
-	branches := make([]*ReasoningBranch, 0, count)
+// strategies is the candidate pool branches are drawn from, in preference order
+var strategies = []string{
+	"direct_approach",
+	"exploratory_approach",
+	"cautious_approach",
+	"decomposition_approach",
+	"backtracking_approach",
+	"verification_first_approach",
+}
 
-	strategies := []string{
-		"direct_approach",
-		"exploratory_approach",
-		"cautious_approach",
-	}
+// generateBranches generates multiple reasoning branches, re-drawing
+// candidates that are too close to an already accepted branch
+func (r *Reasoner) generateBranches(ctx context.Context, taskID, perceptionID string, count int, diversity DiversityConfig) ([]*ReasoningBranch, DiversityReport, error) {
+	branches := make([]*ReasoningBranch, 0, count)
+	embeddings := make([][]float64, 0, count)
+	report := DiversityReport{MinPairwise: 1, ThresholdSatisfied: true}
 
-	for i := 0; i < count && i < len(strategies); i++ {
+	for i := 0; len(branches) < count && i < len(strategies); i++ {
 		branchID := fmt.Sprintf("branch_%d_%d", time.Now().UnixNano(), i)
-		
+
 		branch := &ReasoningBranch{
 			ID:           branchID,
 			TaskID:       taskID,
@@ -96,10 +132,37 @@ func (r *Reasoner) generateBranches(taskID, perceptionID string, count int) []*R
 			Timestamp:    time.Now(),
 		}
 
+		embedding, tokens, err := r.embedder.Embed(ctx, branchText(branch))
+		if err != nil {
+			return nil, report, fmt.Errorf("failed to embed branch: %w", err)
+		}
+		report.Tokens += tokens
+
+		nearest := 1.0
+		for _, accepted := range embeddings {
+			if d := cosineDistance(embedding, accepted); d < nearest {
+				nearest = d
+			}
+		}
+
+		if len(embeddings) > 0 && nearest < diversity.MinDistance {
+			if report.Rejected < diversity.MaxRetries {
+				report.Rejected++
+				continue
+			}
+			// Retry budget exhausted: accept and report the violation
+			report.ThresholdSatisfied = false
+		}
+
+		if len(embeddings) > 0 && nearest < report.MinPairwise {
+			report.MinPairwise = nearest
+		}
+
 		branches = append(branches, branch)
+		embeddings = append(embeddings, embedding)
 	}
 
-	return branches
+	return branches, report, nil
 }
 
 // generateSteps generates steps for a strategy
@@ -128,6 +191,27 @@ func (r *Reasoner) generateSteps(strategy string) []string {
 			"Monitor for errors",
 			"Verify result",
 		}
+	case "decomposition_approach":
+		return []string{
+			"Split goal into independent subgoals",
+			"Order subgoals by dependency",
+			"Complete each subgoal in turn",
+			"Combine partial outcomes",
+		}
+	case "backtracking_approach":
+		return []string{
+			"Record a checkpoint of the current state",
+			"Attempt the most promising path",
+			"Roll back to the checkpoint on failure",
+			"Try the next candidate path",
+		}
+	case "verification_first_approach":
+		return []string{
+			"Define observable success criteria",
+			"Check whether criteria already hold",
+			"Act only on unmet criteria",
+			"Re-check criteria after acting",
+		}
 	default:
 		return []string{"Execute action"}
 	}
@@ -142,6 +226,12 @@ func (r *Reasoner) calculateConfidence(strategy string) float64 {
 		return 0.7
 	case "cautious_approach":
 		return 0.9
+	case "decomposition_approach":
+		return 0.75
+	case "backtracking_approach":
+		return 0.65
+	case "verification_first_approach":
+		return 0.8
 	default:
 		return 0.5
 	}
@@ -156,6 +246,12 @@ func (r *Reasoner) generateReasoning(strategy string) string {
 		return "Exploratory approach is best when we need to understand the environment before acting."
 	case "cautious_approach":
 		return "Cautious approach minimizes risk by validating each step before proceeding."
+	case "decomposition_approach":
+		return "Decomposition breaks a large goal into smaller subgoals that can be solved independently."
+	case "backtracking_approach":
+		return "Backtracking tolerates dead ends by restoring a known-good checkpoint and trying another path."
+	case "verification_first_approach":
+		return "Verification-first avoids redundant work by checking which success criteria are already met."
 	default:
 		return "Standard approach for unknown situations."
 	}
@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# Builds the frontend and a server binary that embeds it, so one binary
+# serves both the API and the UI
+
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+PROJECT_ROOT="$(cd "$SCRIPT_DIR/.." && pwd)"
+OUTPUT="${1:-$PROJECT_ROOT/bin/agent-workspace}"
+
+echo "→ Building frontend..."
+cd "$PROJECT_ROOT/frontend"
+npm ci
+npm run build
+
+echo "→ Copying the build into the backend..."
+rm -rf "$PROJECT_ROOT/backend/internal/webui/dist"
+cp -r "$PROJECT_ROOT/frontend/dist" "$PROJECT_ROOT/backend/internal/webui/dist"
+
+echo "→ Building server..."
+cd "$PROJECT_ROOT/backend"
+go build -tags embedui -o "$OUTPUT" ./cmd/server
+
+echo "✓ Built $OUTPUT"
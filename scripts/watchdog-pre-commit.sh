@@ -0,0 +1,43 @@
+#!/bin/sh
+
+# Watchdog pre-commit hook
+# Sends the staged changes to the watchdog, which refuses agent-authored
+# commits that introduce error findings. Install it with:
+#   ln -s ../../scripts/watchdog-pre-commit.sh .git/hooks/pre-commit
+# If the watchdog can't be reached the commit goes ahead. WATCHDOG_API_KEY
+# is an API key with the execute scope.
+
+WATCHDOG_URL="${WATCHDOG_URL:-http://localhost:8080}"
+
+ident=$(git var GIT_AUTHOR_IDENT) || exit 0
+author=$(printf '%s' "$ident" | sed 's/ <.*//')
+email=$(printf '%s' "$ident" | sed 's/.*<\(.*\)>.*/\1/')
+
+response=$(mktemp)
+trap 'rm -f "$response"' EXIT
+
+# Full context lets the watchdog parse whole Go files
+status=$(git diff --cached --no-color --no-ext-diff -U1000000 |
+	curl -s -o "$response" -w '%{http_code}' -X POST \
+		-H "Content-Type: text/x-diff" \
+		-H "X-Commit-Author: $author" \
+		-H "X-Commit-Email: $email" \
+		-H "X-API-Key: ${WATCHDOG_API_KEY:-}" \
+		--data-binary @- "$WATCHDOG_URL/api/watchdog/commits/check")
+
+case "$status" in
+	422)
+		echo "watchdog: commit blocked, it introduces error findings:" >&2
+		cat "$response" >&2
+		echo >&2
+		exit 1
+		;;
+	200|400)
+		# 400 is an empty diff, e.g. a commit that only changes modes
+		exit 0
+		;;
+	*)
+		echo "watchdog: commit not checked (HTTP $status)" >&2
+		exit 0
+		;;
+esac